@@ -102,6 +102,46 @@ async function getEditing(storagePath) {
   });
 }
 
+// List a project's annotations page by page over a native messaging port,
+// calling onPage with each streamed response as soon as the host has parsed
+// its files, so big projects populate progressively. Resolves with the
+// number of annotated files once the last page arrives.
+function listAnnotatedFiles(storagePath, project, tag, onPage) {
+  log.debug('Streaming annotated files', { project });
+  return new Promise((resolve, reject) => {
+    let done = false;
+    const port = chrome.runtime.connectNative(NATIVE_HOST);
+    port.onMessage.addListener((response) => {
+      if (!response.success) {
+        done = true;
+        port.disconnect();
+        reject(new Error(response.error));
+        return;
+      }
+      onPage(response);
+      if (response.page?.done) {
+        done = true;
+        port.disconnect();
+        resolve(response.total || 0);
+      }
+    });
+    port.onDisconnect.addListener(() => {
+      if (!done) {
+        const message = chrome.runtime.lastError?.message || 'Native host disconnected';
+        log.error('Native port error', message);
+        reject(new Error(message));
+      }
+    });
+    port.postMessage({
+      action: 'listAnnotatedFiles',
+      storagePath,
+      project,
+      tag,
+      stream: true
+    });
+  });
+}
+
 async function pingNativeHost() {
   return sendNativeMessage({ action: 'ping' });
 }
@@ -394,6 +434,20 @@ chrome.runtime.onMessage.addListener((message, sender, sendResponse) => {
     return true;
   }
 
+  if (message.action === 'annotation:listAnnotatedFiles') {
+    // Pages are forwarded to the asking tab as they stream in; the reply
+    // only reports the end of the listing
+    const tabId = sender.tab?.id;
+    listAnnotatedFiles(message.storagePath, message.project, message.tag, (page) => {
+      if (tabId !== undefined) {
+        chrome.tabs.sendMessage(tabId, { action: 'annotation:listAnnotatedFilesPage', project: message.project, ...page });
+      }
+    })
+      .then(total => sendResponse({ success: true, total }))
+      .catch(err => sendResponse({ success: false, error: err.message }));
+    return true;
+  }
+
   if (message.action === 'annotation:ping') {
     pingNativeHost()
       .then(sendResponse)
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// annotateSave is og_annotate's save request, one per hit annotated by
+// --annotate
+type annotateSave struct {
+	Action      string   `json:"action"`
+	StoragePath string   `json:"storagePath"`
+	Project     string   `json:"project"`
+	FilePath    string   `json:"filePath"`
+	Line        int      `json:"line"`
+	Author      string   `json:"author"`
+	Text        string   `json:"text"`
+	Tags        []string `json:"tags,omitempty"`
+	// Source is the file's content, sent for a file not annotated before so
+	// og_annotate can snapshot it
+	Source string `json:"source,omitempty"`
+}
+
+// annotateReply is the part of og_annotate's response --annotate reads
+type annotateReply struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// hitAnnotator saves one note on each of a search's hits through
+// og_annotate, so the notes land in its storage exactly as the browser
+// extension's do
+type hitAnnotator struct {
+	StoragePath string
+	Author      string
+	Text        string
+	Tags        []string
+	// Call sends one native messaging request to og_annotate
+	Call func(msg []byte) ([]byte, error)
+	// Fetch returns the content of a "/project/path" file
+	Fetch func(ctx context.Context, filePath string) (string, error)
+}
+
+// annotateSummary counts the hits --annotate noted
+type annotateSummary struct {
+	Saved int
+	// NoLine counts hits without a line number (path searches, or files
+	// matched by name), which can't carry a note
+	NoLine int
+	// Failed lists "project/path:line: error" for each hit not saved
+	Failed []string
+}
+
+// annotateHits saves a note on every line hit in resp, in result order.
+// A line hit twice is noted once. A failed hit is recorded and the rest
+// are still tried; only an interrupt stops early.
+func (a *hitAnnotator) annotateHits(ctx context.Context, resp *SearchResponse) (annotateSummary, error) {
+	var summary annotateSummary
+	seen := make(map[string]bool)
+	sources := make(map[string]bool) // Files whose source has been sent
+	for _, r := range resp.OrderedEntries() {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+		line, err := strconv.Atoi(string(r.LineNo))
+		if err != nil || line < 1 {
+			summary.NoLine++
+			continue
+		}
+		path := strings.TrimPrefix(r.FilePath(), "/")
+		key := fmt.Sprintf("%s/%s:%d", r.Project, path, line)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		req := annotateSave{
+			Action:      "save",
+			StoragePath: a.StoragePath,
+			Project:     r.Project,
+			FilePath:    path,
+			Line:        line,
+			Author:      a.Author,
+			Text:        a.Text,
+			Tags:        a.Tags,
+		}
+		if !sources[r.Project+"/"+path] && !a.annotated(r.Project, path) {
+			source, err := a.Fetch(ctx, projectPath(r.Project, path))
+			if isInterrupted(err) {
+				return summary, err
+			}
+			if err != nil {
+				summary.Failed = append(summary.Failed, fmt.Sprintf("%s: %v", key, err))
+				continue
+			}
+			req.Source = source
+		}
+		if err := a.save(req); err != nil {
+			summary.Failed = append(summary.Failed, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		sources[r.Project+"/"+path] = true
+		summary.Saved++
+	}
+	return summary, nil
+}
+
+// annotated reports whether the storage already has a file of notes for
+// project/path, and with it the snapshot of its source
+func (a *hitAnnotator) annotated(project, path string) bool {
+	_, err := os.Stat(filepath.Join(a.StoragePath, annotationFilename(project, path)))
+	return err == nil
+}
+
+// save sends one save request and returns og_annotate's error, if any
+func (a *hitAnnotator) save(req annotateSave) error {
+	msg, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxAnnotateMessage {
+		return fmt.Errorf("the file is too large for og_annotate to snapshot")
+	}
+	data, err := a.Call(msg)
+	if err != nil {
+		return err
+	}
+	var reply annotateReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("unexpected og_annotate response: %w", err)
+	}
+	if !reply.Success {
+		return fmt.Errorf("%s", reply.Error)
+	}
+	return nil
+}
+
+// printAnnotateSummary reports what --annotate saved, and each failure
+func printAnnotateSummary(w io.Writer, summary annotateSummary) {
+	fmt.Fprintf(w, "Annotated %d hits", summary.Saved)
+	if summary.NoLine > 0 {
+		fmt.Fprintf(w, " (%d without a line number skipped)", summary.NoLine)
+	}
+	fmt.Fprintln(w)
+	for _, failure := range summary.Failed {
+		fmt.Fprintf(w, "  failed: %s\n", failure)
+	}
+}
+
+// annotateAuthor returns the author --annotate writes notes as: the flag,
+// or the login name from the environment
+func annotateAuthor(flagAuthor string) string {
+	if flagAuthor != "" {
+		return flagAuthor
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
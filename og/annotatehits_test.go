@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateHits(t *testing.T) {
+	dir := t.TempDir()
+	// b.c already has notes, so its source isn't sent again
+	writeAnnotationFile(t, dir, "proj", "src/b.c", sampleV2Annotations)
+
+	resp := &SearchResponse{Entries: []ResultEntry{
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "3", Line: "<b>legacy</b>()"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "9", Line: "<b>legacy</b>()"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "9", Line: "<b>legacy</b>()"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/b.c", LineNo: "4", Line: "<b>legacy</b>()"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/c.c", LineNo: "", Line: ""}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/d.c", LineNo: "1", Line: "<b>legacy</b>()"}},
+	}}
+
+	var sent []annotateSave
+	var fetched []string
+	a := &hitAnnotator{
+		StoragePath: dir,
+		Author:      "alice",
+		Text:        "Replace before 2.0",
+		Tags:        []string{"review"},
+		Call: func(msg []byte) ([]byte, error) {
+			var req annotateSave
+			if err := json.Unmarshal(msg, &req); err != nil {
+				t.Fatal(err)
+			}
+			sent = append(sent, req)
+			if req.FilePath == "src/d.c" {
+				return []byte(`{"success":false,"error":"storage is read-only"}`), nil
+			}
+			return []byte(`{"success":true,"id":"1a2b3c4d"}`), nil
+		},
+		Fetch: func(ctx context.Context, filePath string) (string, error) {
+			fetched = append(fetched, filePath)
+			return "source of " + filePath, nil
+		},
+	}
+
+	summary, err := a.annotateHits(context.Background(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, req := range sent {
+		got = append(got, fmt.Sprintf("%s %s/%s:%d %q", req.Action, req.Project, req.FilePath, req.Line, req.Source))
+		if req.Author != "alice" || req.Text != "Replace before 2.0" || strings.Join(req.Tags, ",") != "review" || req.StoragePath != dir {
+			t.Errorf("request %+v", req)
+		}
+	}
+	want := []string{
+		`save proj/src/a.c:3 "source of /proj/src/a.c"`,
+		`save proj/src/a.c:9 ""`,
+		`save proj/src/b.c:4 ""`,
+		`save proj/src/d.c:1 "source of /proj/src/d.c"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Join(fetched, ",") != "/proj/src/a.c,/proj/src/d.c" {
+		t.Errorf("fetched %v", fetched)
+	}
+	if summary.Saved != 3 || summary.NoLine != 1 || len(summary.Failed) != 1 || summary.Failed[0] != "proj/src/d.c:1: storage is read-only" {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	var buf bytes.Buffer
+	printAnnotateSummary(&buf, summary)
+	if want := "Annotated 3 hits (1 without a line number skipped)\n  failed: proj/src/d.c:1: storage is read-only\n"; buf.String() != want {
+		t.Errorf("printAnnotateSummary() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAnnotateAuthor(t *testing.T) {
+	t.Setenv("USER", "bob")
+	if got := annotateAuthor(""); got != "bob" {
+		t.Errorf("annotateAuthor() = %q, want bob", got)
+	}
+	if got := annotateAuthor("carol"); got != "carol" {
+		t.Errorf("annotateAuthor(carol) = %q", got)
+	}
+}
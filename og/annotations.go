@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"og/pkg/annotation"
+	"og/pkg/trace"
+)
+
+// Annotation is a note read from og_annotate's v2 storage, in the form trace
+// nodes carry it
+type Annotation = trace.Annotation
+
+// annotationFilename converts project/path to og_annotate's storage filename
+func annotationFilename(project, filePath string) string {
+	return annotation.Filename(project, strings.TrimPrefix(filePath, "/"))
+}
+
+// decodeAnnotationFilename reverses annotationFilename
+var decodeAnnotationFilename = annotation.ParseFilename
+
+// readAnnotations reads the annotations for a file from og_annotate storage,
+// with og_annotate's own parser. A missing file yields no annotations and no
+// error.
+func readAnnotations(storagePath, project, filePath string) ([]Annotation, error) {
+	_, stored, _, err := annotation.ParseFile(filepath.Join(storagePath, annotationFilename(project, filePath)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	annotations := make([]Annotation, len(stored))
+	for i, a := range stored {
+		annotations[i] = Annotation{Line: a.Line, Author: a.Author, Timestamp: a.Timestamp, Text: a.Text, Tags: a.Tags}
+	}
+	return annotations, nil
+}
+
+// storedAnnotation is an annotation together with the file it belongs to
+type storedAnnotation struct {
+	Project  string
+	FilePath string
+	Annotation
+}
+
+// hasTag reports whether ann carries tag (case-insensitive)
+func hasTag(ann Annotation, tag string) bool {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	for _, t := range ann.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// listAnnotations reads every annotation in the storage, optionally limited
+// to one project and to annotations carrying tag, sorted by file and line
+func listAnnotations(storagePath, project, tag string) ([]storedAnnotation, error) {
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var listed []storedAnnotation
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name() == ".editing.md" {
+			continue
+		}
+		fileProject, filePath, ok := decodeAnnotationFilename(entry.Name())
+		if !ok || (project != "" && fileProject != project) {
+			continue
+		}
+		anns, err := readAnnotations(storagePath, fileProject, filePath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		for _, ann := range anns {
+			if tag == "" || hasTag(ann, tag) {
+				listed = append(listed, storedAnnotation{Project: fileProject, FilePath: filePath, Annotation: ann})
+			}
+		}
+	}
+
+	sort.SliceStable(listed, func(i, j int) bool {
+		a, b := listed[i], listed[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.Line < b.Line
+	})
+	return listed, nil
+}
+
+// annotationIndex caches annotation lookups per file
+type annotationIndex struct {
+	storagePath string
+	files       map[string][]Annotation
+}
+
+func newAnnotationIndex(storagePath string) *annotationIndex {
+	return &annotationIndex{storagePath: storagePath, files: make(map[string][]Annotation)}
+}
+
+// forFile returns annotations for a "/project/path" file path
+func (idx *annotationIndex) forFile(fullPath string) []Annotation {
+	if anns, ok := idx.files[fullPath]; ok {
+		return anns
+	}
+	var anns []Annotation
+	parts := strings.SplitN(strings.TrimPrefix(fullPath, "/"), "/", 2)
+	if len(parts) == 2 {
+		anns, _ = readAnnotations(idx.storagePath, parts[0], parts[1])
+	}
+	idx.files[fullPath] = anns
+	return anns
+}
+
+// resolveAnnotationsPath returns the annotation storage path: flag > config
+func resolveAnnotationsPath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if cfg, _ := LoadConfig(); cfg != nil {
+		return cfg.AnnotationsPath
+	}
+	return ""
+}
+
+// linkAnnotation returns the permalink of the annotation on line of
+// project/filePath (author's, if several authors annotated the line)
+func linkAnnotation(storagePath, serverURL, project, filePath string, line int, author string) (string, error) {
+	anns, err := readAnnotations(storagePath, project, filePath)
+	if err != nil {
+		return "", err
+	}
+	for _, ann := range anns {
+		if ann.Line == line && (author == "" || ann.Author == author) {
+			return annotationPermalink(AnnotationRef{
+				ServerURL: serverURL,
+				Project:   project,
+				Path:      filePath,
+				Line:      ann.Line,
+				Author:    ann.Author,
+				Timestamp: ann.Timestamp,
+			}), nil
+		}
+	}
+	return "", fmt.Errorf("no annotation on %s/%s:%d", project, strings.TrimPrefix(filePath, "/"), line)
+}
+
+// resolveAnnotationLink finds the annotation a permalink names, as
+// og_annotate's resolvePermalink does: by author and timestamp, so that
+// rebased notes are found at their new line, or else the author's note on
+// the linked line. The returned ref points at the note's current line.
+func resolveAnnotationLink(storagePath, link string) (AnnotationRef, storedAnnotation, error) {
+	ref, err := parseAnnotationPermalink(link)
+	if err != nil {
+		return ref, storedAnnotation{}, err
+	}
+	filePath := strings.TrimPrefix(ref.Path, "/")
+	anns, err := readAnnotations(storagePath, ref.Project, filePath)
+	if err != nil {
+		return ref, storedAnnotation{}, err
+	}
+
+	match := -1
+	for i, ann := range anns {
+		if ann.Author == ref.Author && ann.Timestamp == ref.Timestamp {
+			match = i
+			break
+		}
+		if match < 0 && ann.Author == ref.Author && ann.Line == ref.Line {
+			match = i
+		}
+	}
+	if match < 0 {
+		return ref, storedAnnotation{}, fmt.Errorf("annotation by %s on %s/%s:%d not found; it may have been deleted", ref.Author, ref.Project, filePath, ref.Line)
+	}
+	ann := anns[match]
+	ref.Line, ref.Timestamp = ann.Line, ann.Timestamp
+	return ref, storedAnnotation{Project: ref.Project, FilePath: filePath, Annotation: ann}, nil
+}
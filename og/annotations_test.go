@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sampleV2Annotations matches the format written by og_annotate
+const sampleV2Annotations = `---
+source: proj/src/drv.c
+hash: a1b2c3d4e5f6
+captured: 2024-01-15T10:30:00Z
+---
+
+1| void driver_init(void) {
+
+> **@alice** (2024-01-15):
+> Entry point for the driver.
+> Called once at boot.
+
+2| 	int x;
+3| 	probe();
+
+> **@bob** (2024-01-16) [bug, perf]:
+> Probe can fail here.
+
+4| }
+`
+
+func writeAnnotationFile(t *testing.T, dir, project, filePath, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, annotationFilename(project, filePath)), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnnotationFilename(t *testing.T) {
+	tests := []struct {
+		project, filePath, expected string
+	}{
+		{"myproject", "src/main/App.java", "myproject__src__main__App.java.md"},
+		{"myproject", "/src/util.js", "myproject__src__util.js.md"},
+		{"my__project", "src/my__file.go", "my___project__src__my___file.go.md"},
+	}
+	for _, tt := range tests {
+		if got := annotationFilename(tt.project, tt.filePath); got != tt.expected {
+			t.Errorf("annotationFilename(%q, %q) = %q, want %q", tt.project, tt.filePath, got, tt.expected)
+		}
+	}
+}
+
+func TestReadAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "src/drv.c", sampleV2Annotations)
+
+	anns, err := readAnnotations(dir, "proj", "src/drv.c")
+	if err != nil {
+		t.Fatalf("readAnnotations failed: %v", err)
+	}
+	if len(anns) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(anns))
+	}
+	if anns[0].Line != 1 || anns[0].Author != "alice" || anns[0].Text != "Entry point for the driver.\nCalled once at boot." {
+		t.Errorf("first annotation: %+v", anns[0])
+	}
+	if anns[1].Line != 3 || anns[1].Author != "bob" || strings.Join(anns[1].Tags, ",") != "bug,perf" {
+		t.Errorf("second annotation: %+v", anns[1])
+	}
+}
+
+func TestReadAnnotationsLineMarkers(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "a.c", "---\nsource: proj/a.c\nhash: \ncaptured: 2024-01-15T10:30:00Z\n---\n\n## Line 7\n\n> **@carol** (2024-01-15):\n> No source captured.\n\n")
+
+	anns, err := readAnnotations(dir, "proj", "a.c")
+	if err != nil {
+		t.Fatalf("readAnnotations failed: %v", err)
+	}
+	if len(anns) != 1 || anns[0].Line != 7 || anns[0].Text != "No source captured." {
+		t.Errorf("unexpected annotations: %+v", anns)
+	}
+}
+
+func TestReadAnnotationsSymbolAnchor(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "a.c", "---\nsource: proj/a.c\nhash: \ncaptured: 2024-01-15T10:30:00Z\n---\n\n1| int\n2| vn_rele(void)\n\n> **@carol** (2024-01-15) [bug] on `vn_rele` ^1a2b3c4d:\n> Follows the definition.\n\n")
+
+	anns, err := readAnnotations(dir, "proj", "a.c")
+	if err != nil {
+		t.Fatalf("readAnnotations failed: %v", err)
+	}
+	if len(anns) != 1 || anns[0].Line != 2 || anns[0].Text != "Follows the definition." || strings.Join(anns[0].Tags, ",") != "bug" {
+		t.Errorf("unexpected annotations: %+v", anns)
+	}
+}
+
+func TestReadAnnotationsMissingFile(t *testing.T) {
+	anns, err := readAnnotations(t.TempDir(), "proj", "none.c")
+	if err != nil || len(anns) != 0 {
+		t.Errorf("expected no annotations and no error, got %v, %v", anns, err)
+	}
+}
+
+func TestListAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "src/drv.c", sampleV2Annotations)
+	writeAnnotationFile(t, dir, "other", "a.c", "---\nsource: other/a.c\nhash: \ncaptured: 2024-01-15T10:30:00Z\n---\n\n## Line 7\n\n> **@carol** (2024-01-15) [question]:\n> Why here?\n\n")
+	if err := os.WriteFile(filepath.Join(dir, ".editing.md"), []byte("# Currently Being Edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := listAnnotations(dir, "", "")
+	if err != nil {
+		t.Fatalf("listAnnotations failed: %v", err)
+	}
+	if len(all) != 3 || all[0].Project != "other" || all[1].FilePath != "src/drv.c" || all[1].Line != 1 {
+		t.Errorf("unexpected listing: %+v", all)
+	}
+
+	bugs, err := listAnnotations(dir, "", "BUG")
+	if err != nil {
+		t.Fatalf("listAnnotations failed: %v", err)
+	}
+	if len(bugs) != 1 || bugs[0].Author != "bob" {
+		t.Errorf("tag bug: %+v", bugs)
+	}
+
+	questions, _ := listAnnotations(dir, "proj", "question")
+	if len(questions) != 0 {
+		t.Errorf("project filter ignored: %+v", questions)
+	}
+
+	var buf bytes.Buffer
+	printAnnotations(&buf, bugs, false)
+	if want := "proj/src/drv.c:3 @bob (2024-01-16) [bug, perf]\n    Probe can fail here.\n"; buf.String() != want {
+		t.Errorf("printAnnotations() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAnnotationLinks(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "src/drv.c", sampleV2Annotations)
+
+	link, err := linkAnnotation(dir, "https://og.example.com/source", "proj", "src/drv.c", 3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://og.example.com/source/xref/proj/src/drv.c?annotation=") || !strings.HasSuffix(link, "#3") {
+		t.Errorf("linkAnnotation() = %q", link)
+	}
+	if _, err := linkAnnotation(dir, "https://og.example.com/source", "proj", "src/drv.c", 3, "alice"); err == nil {
+		t.Error("expected no annotation by alice on line 3")
+	}
+
+	// The same note after a rebase moved it down two lines
+	writeAnnotationFile(t, dir, "proj", "src/drv.c", strings.Replace(sampleV2Annotations, "3| \tprobe();", "3| \tint y;\n4| \tint z;\n5| \tprobe();", 1))
+	ref, ann, err := resolveAnnotationLink(dir, link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ann.Project != "proj" || ann.FilePath != "src/drv.c" || ann.Line != 5 || ann.Author != "bob" {
+		t.Errorf("resolveAnnotationLink() = %+v, want bob's note at line 5", ann)
+	}
+	if got := annotationPermalink(ref); !strings.HasSuffix(got, "#5") {
+		t.Errorf("current link = %q, want line 5", got)
+	}
+
+	os.Remove(filepath.Join(dir, annotationFilename("proj", "src/drv.c")))
+	if _, _, err := resolveAnnotationLink(dir, link); err == nil || !strings.Contains(err.Error(), "may have been deleted") {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
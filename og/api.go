@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// apiMethods are the HTTP methods og api accepts
+var apiMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+}
+
+// readAPIData returns the request body for --data: the value itself,
+// "@file" for a file's contents, or "@-" for stdin
+func readAPIData(value string, stdin io.Reader) ([]byte, error) {
+	name, isFile := strings.CutPrefix(value, "@")
+	if !isFile {
+		return []byte(value), nil
+	}
+	if name == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// writeAPIResponse prints a raw API response body, pretty-printing JSON
+// unless raw is set. With include, the status line and headers come first,
+// as curl -i shows them.
+func writeAPIResponse(w io.Writer, resp *RawResponse, include, raw bool) {
+	if include {
+		fmt.Fprintln(w, resp.Status)
+		names := make([]string, 0, len(resp.Header))
+		for name := range resp.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, value := range resp.Header[name] {
+				fmt.Fprintf(w, "%s: %s\n", name, value)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	if len(resp.Body) == 0 {
+		return
+	}
+
+	var pretty bytes.Buffer
+	if !raw && json.Valid(resp.Body) && json.Indent(&pretty, resp.Body, "", "  ") == nil {
+		pretty.WriteByte('\n')
+		w.Write(pretty.Bytes())
+		return
+	}
+	w.Write(resp.Body)
+	if !bytes.HasSuffix(resp.Body, []byte("\n")) && !raw {
+		fmt.Fprintln(w)
+	}
+}
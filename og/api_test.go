@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWriteAPIResponse(t *testing.T) {
+	resp := &RawResponse{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"application/json"}, "Content-Length": {"17"}},
+		Body:       []byte(`["proj1","proj2"]`),
+	}
+
+	var buf bytes.Buffer
+	writeAPIResponse(&buf, resp, false, false)
+	if want := "[\n  \"proj1\",\n  \"proj2\"\n]\n"; buf.String() != want {
+		t.Errorf("pretty = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeAPIResponse(&buf, resp, true, true)
+	if want := "200 OK\nContent-Length: 17\nContent-Type: application/json\n\n[\"proj1\",\"proj2\"]"; buf.String() != want {
+		t.Errorf("include raw = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	writeAPIResponse(&buf, &RawResponse{Body: []byte("1.9.0")}, false, false)
+	if buf.String() != "1.9.0\n" {
+		t.Errorf("text = %q", buf.String())
+	}
+}
+
+func TestReadAPIData(t *testing.T) {
+	if b, _ := readAPIData(`{"a":1}`, nil); string(b) != `{"a":1}` {
+		t.Errorf("literal = %q", b)
+	}
+	if b, _ := readAPIData("@-", strings.NewReader("from stdin")); string(b) != "from stdin" {
+		t.Errorf("stdin = %q", b)
+	}
+	if _, err := readAPIData("@/nonexistent/body.json", nil); err == nil {
+		t.Error("missing file: no error")
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"og/pkg/opengrok"
+)
+
+// tokenExpirySkew refreshes tokens slightly before they actually expire
+const tokenExpirySkew = 30 * time.Second
+
+// OIDCConfig holds OAuth2/OIDC device-flow settings and the cached tokens
+type OIDCConfig struct {
+	Issuer       string    `json:"issuer"`
+	ClientID     string    `json:"client_id"`
+	Scopes       string    `json:"scopes,omitempty"`
+	AccessToken  string    `json:"access_token,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// loggedIn reports whether a login left tokens to authenticate with.
+// 'og auth logout' clears them but keeps the issuer and client ID for the
+// next login.
+func (o *OIDCConfig) loggedIn() bool {
+	return o.AccessToken != "" || o.RefreshToken != ""
+}
+
+// expired returns true if the access token is missing or about to expire
+func (o *OIDCConfig) expired(now time.Time) bool {
+	if o.AccessToken == "" {
+		return true
+	}
+	if o.Expiry.IsZero() {
+		return false // Token without expiry: use until the server rejects it
+	}
+	return !now.Add(tokenExpirySkew).Before(o.Expiry)
+}
+
+// oidcEndpoints are the endpoints discovered from the issuer metadata
+type oidcEndpoints struct {
+	DeviceAuthorization string `json:"device_authorization_endpoint"`
+	Token               string `json:"token_endpoint"`
+}
+
+// deviceAuthResponse is the device authorization endpoint response (RFC 8628)
+type deviceAuthResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// tokenResponse is the token endpoint response, including OAuth2 errors
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// OIDCProvider authenticates requests with an OIDC access token, refreshing it
+// with the refresh token when it expires
+type OIDCProvider struct {
+	Config     *OIDCConfig
+	HTTPClient *http.Client
+	// OnRefresh is called after tokens are refreshed so they can be persisted
+	OnRefresh func(*OIDCConfig) error
+
+	mu        sync.Mutex // Serializes refreshes when shared across goroutines (og serve)
+	now       func() time.Time
+	endpoints *oidcEndpoints
+}
+
+// NewOIDCProvider creates a provider for the given OIDC settings
+func NewOIDCProvider(cfg *OIDCConfig, onRefresh func(*OIDCConfig) error) *OIDCProvider {
+	return &OIDCProvider{
+		Config:     cfg,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		OnRefresh:  onRefresh,
+		now:        time.Now,
+	}
+}
+
+// Describe implements AuthProvider
+func (p *OIDCProvider) Describe() string {
+	desc := fmt.Sprintf("OIDC (issuer: %s)", p.Config.Issuer)
+	if p.Config.AccessToken == "" {
+		return desc + ", not logged in"
+	}
+	if !p.Config.Expiry.IsZero() {
+		if p.Config.expired(p.now()) {
+			desc += ", token expired"
+		} else {
+			desc += fmt.Sprintf(", token expires %s", p.Config.Expiry.Local().Format(time.RFC3339))
+		}
+	}
+	return desc
+}
+
+// Authorize implements AuthProvider
+func (p *OIDCProvider) Authorize(req *http.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Config.expired(p.now()) {
+		if err := p.Refresh(); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Authorization", "Bearer "+p.Config.AccessToken)
+	return nil
+}
+
+// Refresh exchanges the refresh token for a new access token
+func (p *OIDCProvider) Refresh() error {
+	if p.Config.RefreshToken == "" {
+		return fmt.Errorf("OIDC token expired and no refresh token is available: run 'og auth login --oidc' again")
+	}
+
+	endpoints, err := p.discover()
+	if err != nil {
+		return err
+	}
+
+	tok, err := p.postToken(endpoints.Token, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {p.Config.RefreshToken},
+		"client_id":     {p.Config.ClientID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refresh OIDC token: %w", err)
+	}
+	if tok.Error != "" {
+		return fmt.Errorf("failed to refresh OIDC token (%s): run 'og auth login --oidc' again", tok.Error)
+	}
+
+	p.applyToken(tok)
+	if p.OnRefresh != nil {
+		if err := p.OnRefresh(p.Config); err != nil {
+			return fmt.Errorf("failed to save refreshed token: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeviceLogin runs the OAuth2 device authorization grant (RFC 8628).
+// prompt is called once with the verification URL and user code to show the user;
+// sleep is used between token polls (time.Sleep outside of tests).
+func (p *OIDCProvider) DeviceLogin(prompt func(verificationURL, userCode string), sleep func(time.Duration)) error {
+	endpoints, err := p.discover()
+	if err != nil {
+		return err
+	}
+	if endpoints.DeviceAuthorization == "" {
+		return fmt.Errorf("issuer %s does not support the device authorization flow", p.Config.Issuer)
+	}
+
+	form := url.Values{"client_id": {p.Config.ClientID}}
+	if p.Config.Scopes != "" {
+		form.Set("scope", p.Config.Scopes)
+	}
+	resp, err := p.HTTPClient.PostForm(endpoints.DeviceAuthorization, form)
+	if err != nil {
+		return fmt.Errorf("failed to start device authorization: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, opengrok.MaxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read device authorization response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("device authorization returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var device deviceAuthResponse
+	if err := json.Unmarshal(body, &device); err != nil {
+		return fmt.Errorf("failed to parse device authorization response: %w", err)
+	}
+
+	verificationURL := device.VerificationURIComplete
+	if verificationURL == "" {
+		verificationURL = device.VerificationURI
+	}
+	prompt(verificationURL, device.UserCode)
+
+	interval := time.Duration(device.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := p.now().Add(time.Duration(device.ExpiresIn) * time.Second)
+	if device.ExpiresIn <= 0 {
+		deadline = p.now().Add(10 * time.Minute)
+	}
+
+	for {
+		if p.now().After(deadline) {
+			return fmt.Errorf("device code expired before login completed")
+		}
+		sleep(interval)
+
+		tok, err := p.postToken(endpoints.Token, url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {device.DeviceCode},
+			"client_id":   {p.Config.ClientID},
+		})
+		if err != nil {
+			return err
+		}
+
+		switch tok.Error {
+		case "":
+			p.applyToken(tok)
+			return nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return fmt.Errorf("login was denied")
+		case "expired_token":
+			return fmt.Errorf("device code expired before login completed")
+		default:
+			if tok.ErrorDesc != "" {
+				return fmt.Errorf("login failed (%s): %s", tok.Error, tok.ErrorDesc)
+			}
+			return fmt.Errorf("login failed (%s)", tok.Error)
+		}
+	}
+}
+
+// applyToken stores a successful token response in the config
+func (p *OIDCProvider) applyToken(tok *tokenResponse) {
+	p.Config.AccessToken = tok.AccessToken
+	if tok.RefreshToken != "" {
+		p.Config.RefreshToken = tok.RefreshToken
+	}
+	if tok.ExpiresIn > 0 {
+		p.Config.Expiry = p.now().Add(time.Duration(tok.ExpiresIn) * time.Second).UTC()
+	} else {
+		p.Config.Expiry = time.Time{}
+	}
+}
+
+// discover fetches the issuer's OpenID configuration (cached per provider)
+func (p *OIDCProvider) discover() (*oidcEndpoints, error) {
+	if p.endpoints != nil {
+		return p.endpoints, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.Config.Issuer, "/") + "/.well-known/openid-configuration"
+	resp, err := p.HTTPClient.Get(wellKnown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC configuration returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, opengrok.MaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC configuration: %w", err)
+	}
+	var endpoints oidcEndpoints
+	if err := json.Unmarshal(body, &endpoints); err != nil {
+		return nil, fmt.Errorf("failed to parse OIDC configuration: %w", err)
+	}
+	if endpoints.Token == "" {
+		return nil, fmt.Errorf("OIDC configuration is missing token_endpoint")
+	}
+
+	p.endpoints = &endpoints
+	return p.endpoints, nil
+}
+
+// postToken posts a form to the token endpoint. OAuth2 errors (400 with an
+// "error" field) are returned in the response rather than as Go errors.
+func (p *OIDCProvider) postToken(tokenURL string, form url.Values) (*tokenResponse, error) {
+	resp, err := p.HTTPClient.PostForm(tokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, opengrok.MaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var tok tokenResponse
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if tok.Error == "" && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned status %d", resp.StatusCode)
+	}
+	if tok.Error == "" && tok.AccessToken == "" {
+		return nil, fmt.Errorf("token response is missing access_token")
+	}
+	return &tok, nil
+}
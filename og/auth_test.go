@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestOIDCServer returns an issuer that serves discovery, device authorization,
+// and token endpoints. The device token endpoint reports authorization_pending
+// for the first pendingPolls requests.
+func newTestOIDCServer(t *testing.T, pendingPolls int) *httptest.Server {
+	t.Helper()
+	polls := 0
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"device_authorization_endpoint": server.URL + "/device",
+			"token_endpoint":                server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("client_id") != "og-cli" {
+			t.Errorf("device: unexpected client_id %q", r.FormValue("client_id"))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "dev-123",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": server.URL + "/activate",
+			"expires_in":       600,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		switch r.FormValue("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:device_code":
+			if polls < pendingPolls {
+				polls++
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token":  "access-1",
+				"refresh_token": "refresh-1",
+				"expires_in":    3600,
+			})
+		case "refresh_token":
+			if r.FormValue("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": "access-2",
+				"expires_in":   3600,
+			})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "unsupported_grant_type"})
+		}
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCDeviceLogin(t *testing.T) {
+	server := newTestOIDCServer(t, 2)
+	provider := NewOIDCProvider(&OIDCConfig{Issuer: server.URL, ClientID: "og-cli"}, nil)
+
+	var gotURL, gotCode string
+	sleeps := 0
+	err := provider.DeviceLogin(func(verificationURL, userCode string) {
+		gotURL = verificationURL
+		gotCode = userCode
+	}, func(time.Duration) { sleeps++ })
+	if err != nil {
+		t.Fatalf("DeviceLogin failed: %v", err)
+	}
+
+	if gotCode != "ABCD-EFGH" || !strings.HasSuffix(gotURL, "/activate") {
+		t.Errorf("prompt got url=%q code=%q", gotURL, gotCode)
+	}
+	if sleeps != 3 {
+		t.Errorf("expected 3 polls, got %d", sleeps)
+	}
+	if provider.Config.AccessToken != "access-1" || provider.Config.RefreshToken != "refresh-1" {
+		t.Errorf("unexpected tokens: %+v", provider.Config)
+	}
+	if provider.Config.Expiry.IsZero() {
+		t.Error("expected expiry to be set")
+	}
+}
+
+func TestOIDCAuthorizeRefreshesExpiredToken(t *testing.T) {
+	server := newTestOIDCServer(t, 0)
+	cfg := &OIDCConfig{
+		Issuer:       server.URL,
+		ClientID:     "og-cli",
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+
+	var saved *OIDCConfig
+	provider := NewOIDCProvider(cfg, func(c *OIDCConfig) error {
+		saved = c
+		return nil
+	})
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	if err := provider.Authorize(req); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer access-2" {
+		t.Errorf("Authorization header: got %q", got)
+	}
+	if saved == nil || saved.AccessToken != "access-2" {
+		t.Error("refreshed token should be persisted")
+	}
+	if cfg.RefreshToken != "refresh-1" {
+		t.Error("refresh token should be kept when not rotated")
+	}
+}
+
+func TestOIDCAuthorizeValidTokenSkipsRefresh(t *testing.T) {
+	provider := NewOIDCProvider(&OIDCConfig{
+		Issuer:      "http://unused.invalid",
+		AccessToken: "still-good",
+		Expiry:      time.Now().Add(time.Hour),
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	if err := provider.Authorize(req); err != nil {
+		t.Fatalf("Authorize failed: %v", err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer still-good" {
+		t.Errorf("Authorization header: got %q", got)
+	}
+}
+
+func TestOIDCAuthorizeExpiredWithoutRefreshToken(t *testing.T) {
+	provider := NewOIDCProvider(&OIDCConfig{
+		Issuer:      "http://unused.invalid",
+		AccessToken: "old",
+		Expiry:      time.Now().Add(-time.Hour),
+	}, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	err := provider.Authorize(req)
+	if err == nil || !strings.Contains(err.Error(), "og auth login") {
+		t.Errorf("expected login hint error, got %v", err)
+	}
+}
+
+func TestClientUsesAuthProvider(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`["proj"]`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Auth = NewOIDCProvider(&OIDCConfig{AccessToken: "tok"}, nil)
+
+	if _, err := client.GetProjects(); err != nil {
+		t.Fatalf("GetProjects failed: %v", err)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Authorization header: got %q", gotAuth)
+	}
+	if !client.HasAuth() {
+		t.Error("HasAuth should be true with an auth provider")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Presence records how a symbol occurs in one file of one project
+type Presence uint8
+
+const (
+	PresenceDef Presence = 1 << iota // The file defines the symbol
+	PresenceRef                      // The file references the symbol
+)
+
+// String formats a presence as a matrix cell
+func (p Presence) String() string {
+	switch p {
+	case PresenceDef | PresenceRef:
+		return "def+ref"
+	case PresenceDef:
+		return "def"
+	case PresenceRef:
+		return "ref"
+	}
+	return "-"
+}
+
+// SymbolComparison records which files define and reference a symbol in each
+// of several projects, typically forks indexed on the same server
+type SymbolComparison struct {
+	Symbol   string
+	Projects []string
+	Paths    []string // Paths within the projects, sorted
+	// Truncated is true if a search returned fewer files than it matched
+	Truncated bool
+
+	cells map[string]map[string]Presence // path -> project -> presence
+}
+
+// At returns how the symbol occurs in path within project
+func (c *SymbolComparison) At(path, project string) Presence {
+	return c.cells[path][project]
+}
+
+// ProjectCounts returns the number of files in project that define and that
+// reference the symbol
+func (c *SymbolComparison) ProjectCounts(project string) (defs, refs int) {
+	for _, byProject := range c.cells {
+		p := byProject[project]
+		if p&PresenceDef != 0 {
+			defs++
+		}
+		if p&PresenceRef != 0 {
+			refs++
+		}
+	}
+	return defs, refs
+}
+
+func (c *SymbolComparison) add(project, path string, p Presence) {
+	if c.cells == nil {
+		c.cells = make(map[string]map[string]Presence)
+	}
+	if c.cells[path] == nil {
+		c.cells[path] = make(map[string]Presence)
+		c.Paths = append(c.Paths, path)
+	}
+	c.cells[path][project] |= p
+}
+
+// CompareSymbol runs a definition and a symbol search for symbol across
+// projects and records, per file path, which projects define or reference
+// it. Files are matched across projects by their path within the project.
+func CompareSymbol(ctx context.Context, client *Client, symbol string, projects []string, fileType string, maxFiles int) (*SymbolComparison, error) {
+	c := &SymbolComparison{Symbol: symbol, Projects: projects}
+	listed := make(map[string]bool)
+	for _, p := range projects {
+		listed[p] = true
+	}
+
+	searches := []struct {
+		opts     SearchOptions
+		presence Presence
+	}{
+		{SearchOptions{Def: symbol}, PresenceDef},
+		{SearchOptions{Symbol: symbol}, PresenceRef},
+	}
+	for _, s := range searches {
+		s.opts.Projects = strings.Join(projects, ",")
+		s.opts.Type = fileType
+		s.opts.MaxResults = maxFiles
+		resp, err := client.SearchContext(ctx, s.opts)
+		if err != nil {
+			return nil, err
+		}
+		files := make(map[string]bool)
+		for _, r := range resp.OrderedEntries() {
+			path := r.FilePath()
+			if !listed[r.Project] || path == "" {
+				continue
+			}
+			files[projectPath(r.Project, path)] = true
+			c.add(r.Project, strings.TrimPrefix(path, "/"), s.presence)
+		}
+		if resp.ResultCount > len(files) {
+			c.Truncated = true
+		}
+	}
+
+	sort.Strings(c.Paths)
+	return c, nil
+}
+
+// FormatComparison renders a comparison as a matrix of paths by projects,
+// followed by per-project totals
+func FormatComparison(c *SymbolComparison, useColor bool) string {
+	var sb strings.Builder
+	bold := func(s string) string {
+		if useColor {
+			return colorBold + s + colorReset
+		}
+		return s
+	}
+
+	if len(c.Paths) == 0 {
+		sb.WriteString(fmt.Sprintf("%s not found in %s\n", c.Symbol, strings.Join(c.Projects, ", ")))
+		return sb.String()
+	}
+
+	pathWidth := len("PATH")
+	for _, path := range c.Paths {
+		pathWidth = max(pathWidth, len(path))
+	}
+	colWidths := make([]int, len(c.Projects))
+	for i, project := range c.Projects {
+		colWidths[i] = max(len(project), len("def+ref"))
+	}
+
+	// Header
+	sb.WriteString(bold(fmt.Sprintf("%-*s", pathWidth, "PATH")))
+	for i, project := range c.Projects {
+		sb.WriteString("  " + bold(fmt.Sprintf("%-*s", colWidths[i], project)))
+	}
+	sb.WriteString("\n")
+
+	for _, path := range c.Paths {
+		name := fmt.Sprintf("%-*s", pathWidth, path)
+		if useColor {
+			name = colorMagenta + name + colorReset
+		}
+		sb.WriteString(name)
+		for i, project := range c.Projects {
+			p := c.At(path, project)
+			cell := fmt.Sprintf("%-*s", colWidths[i], p)
+			if useColor && p == 0 {
+				cell = colorRed + cell + colorReset
+			}
+			sb.WriteString("  " + cell)
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n")
+	for _, project := range c.Projects {
+		defs, refs := c.ProjectCounts(project)
+		switch {
+		case defs == 0 && refs == 0:
+			sb.WriteString(fmt.Sprintf("%s: not found\n", project))
+		default:
+			sb.WriteString(fmt.Sprintf("%s: defined in %d files, referenced in %d files\n", project, defs, refs))
+		}
+	}
+	if c.Truncated {
+		sb.WriteString("(some results were not fetched; raise --max to see them)\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPresenceString(t *testing.T) {
+	tests := []struct {
+		p    Presence
+		want string
+	}{
+		{0, "-"},
+		{PresenceDef, "def"},
+		{PresenceRef, "ref"},
+		{PresenceDef | PresenceRef, "def+ref"},
+	}
+	for _, tt := range tests {
+		if got := tt.p.String(); got != tt.want {
+			t.Errorf("Presence(%d).String() = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestCompareSymbol(t *testing.T) {
+	result := func(path string) map[string]interface{} {
+		return map[string]interface{}{"path": path, "lineNo": 10, "line": "foo_init()"}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("projects") != "upstream,fork" {
+			t.Errorf("projects = %q, want upstream,fork", q.Get("projects"))
+		}
+		var resp map[string]interface{}
+		switch {
+		case q.Get("def") == "foo_init":
+			resp = map[string]interface{}{
+				"resultCount": 1,
+				"results": map[string]interface{}{
+					"upstream": []interface{}{result("/src/foo.c")},
+				},
+			}
+		case q.Get("symbol") == "foo_init":
+			resp = map[string]interface{}{
+				"resultCount": 4,
+				"results": map[string]interface{}{
+					"upstream": []interface{}{result("/src/foo.c"), result("/src/main.c")},
+					"fork":     []interface{}{result("/src/main.c")},
+					"other":    []interface{}{result("/src/other.c")},
+				},
+			}
+		default:
+			t.Errorf("unexpected query %v", q)
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := CompareSymbol(context.Background(), client, "foo_init", []string{"upstream", "fork"}, "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(c.Paths, ","); got != "src/foo.c,src/main.c" {
+		t.Errorf("Paths = %s, want src/foo.c,src/main.c", got)
+	}
+	cells := []struct {
+		path, project string
+		want          Presence
+	}{
+		{"src/foo.c", "upstream", PresenceDef | PresenceRef},
+		{"src/foo.c", "fork", 0},
+		{"src/main.c", "upstream", PresenceRef},
+		{"src/main.c", "fork", PresenceRef},
+	}
+	for _, tt := range cells {
+		if got := c.At(tt.path, tt.project); got != tt.want {
+			t.Errorf("At(%s, %s) = %s, want %s", tt.path, tt.project, got, tt.want)
+		}
+	}
+	if defs, refs := c.ProjectCounts("fork"); defs != 0 || refs != 1 {
+		t.Errorf("ProjectCounts(fork) = %d, %d, want 0, 1", defs, refs)
+	}
+	// "other" was not asked for, so its file does not count as fetched
+	if !c.Truncated {
+		t.Error("Truncated = false, want true when resultCount exceeds the files fetched")
+	}
+}
+
+func TestFormatComparison(t *testing.T) {
+	c := &SymbolComparison{Symbol: "foo_init", Projects: []string{"upstream", "fork"}}
+	c.add("upstream", "src/foo.c", PresenceDef)
+	c.add("upstream", "src/main.c", PresenceRef)
+	c.Paths = []string{"src/foo.c", "src/main.c"}
+
+	got := FormatComparison(c, false)
+	want := "PATH        upstream  fork   \n" +
+		"src/foo.c   def       -      \n" +
+		"src/main.c  ref       -      \n" +
+		"\n" +
+		"upstream: defined in 1 files, referenced in 1 files\n" +
+		"fork: not found\n"
+	if got != want {
+		t.Errorf("FormatComparison() =\n%s\nwant:\n%s", got, want)
+	}
+
+	empty := &SymbolComparison{Symbol: "foo_init", Projects: []string{"upstream", "fork"}}
+	if got := FormatComparison(empty, false); got != "foo_init not found in upstream, fork\n" {
+		t.Errorf("FormatComparison(empty) = %q", got)
+	}
+}
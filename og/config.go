@@ -11,12 +11,50 @@ const configFileName = ".og.json"
 
 // Config represents the CLI configuration
 type Config struct {
+	// Version is the file's layout version (see configMigrations), set on save
+	Version     int    `json:"version,omitempty"`
 	ServerURL   string `json:"server_url"`
 	Username    string `json:"username,omitempty"`
 	Password    string `json:"password,omitempty"`
 	APIKey      string `json:"api_key,omitempty"`
 	BearerToken string `json:"bearer_token,omitempty"`
 	WebLinks    bool   `json:"web_links,omitempty"`
+	Theme       string `json:"theme,omitempty"` // Syntax highlighting style ("none" disables)
+	// APIBase and XrefBase override ServerURL for the REST API and for the
+	// web pages and links, for reverse proxies that serve them apart
+	APIBase  string `json:"api_base,omitempty"`
+	XrefBase string `json:"xref_base,omitempty"`
+	// DefaultSearch is the search type run by "og <query>" (full when unset)
+	DefaultSearch string `json:"default_search,omitempty"`
+	// SearchCase is the case mode of searches without a case flag: smart,
+	// ignore or sensitive (see searchcase.go); unset leaves it to the server
+	SearchCase string `json:"search_case,omitempty"`
+	// Locale picks the language of messages, e.g. "de" (see i18n.go);
+	// unset uses LC_ALL, LC_MESSAGES or LANG
+	Locale string `json:"locale,omitempty"`
+	// LocaleDir holds <locale>.json message catalogs added over the built-in ones
+	LocaleDir string `json:"locale_dir,omitempty"`
+	// ProjectGroups maps a group name to its projects, referenced as --projects @name
+	ProjectGroups map[string][]string `json:"project_groups,omitempty"`
+	// LocalRoots maps a project name to its local checkout, used by --local-paths
+	LocalRoots map[string]string `json:"local_roots,omitempty"`
+	// AnnotationsPath is the og_annotate storage directory used to mark trace nodes
+	AnnotationsPath string `json:"annotations_path,omitempty"`
+	// Daemon is the address of an 'og serve' daemon to send requests through
+	Daemon string `json:"daemon,omitempty"`
+	// Trace holds trace defaults
+	Trace *TraceConfig `json:"trace,omitempty"`
+	// OIDC holds device-flow settings and cached tokens (set by 'og auth login --oidc')
+	OIDC *OIDCConfig `json:"oidc,omitempty"`
+	// Encrypted holds the credentials above when encryption is enabled
+	// ('og config encrypt'); they are decrypted on load and re-encrypted on save
+	Encrypted *EncryptedCredentials `json:"encrypted_credentials,omitempty"`
+}
+
+// TraceConfig holds the "trace" section of the config
+type TraceConfig struct {
+	// Excludes replaces trace.DefaultExcludes when set; [] turns them off
+	Excludes []string `json:"excludes"`
 }
 
 // getConfigPathDefault returns the path to the config file in the user's home directory
@@ -31,6 +69,10 @@ func getConfigPathDefault() (string, error) {
 // getConfigPath is a variable that can be overridden in tests
 var getConfigPath = getConfigPathDefault
 
+// configWarningsShown is set once LoadConfig has printed the config file's
+// warnings, so commands that load it more than once don't repeat them
+var configWarningsShown bool
+
 // LoadConfig loads the configuration from the config file
 func LoadConfig() (*Config, error) {
 	configPath, err := getConfigPath()
@@ -46,12 +88,30 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	config, migrated, problems, warnings, err := parseConfig(configPath, data)
+	if err != nil {
+		return nil, err
+	}
+	if !configWarningsShown {
+		configWarningsShown = true
+		for _, w := range warnings {
+			fmt.Fprint(os.Stderr, trf("Warning: config file %s: %s\n", configPath, w))
+		}
+	}
+	if migrated != nil && len(problems) == 0 {
+		writeMigratedConfig(configPath, migrated)
 	}
 
-	return &config, nil
+	if config.Encrypted != nil {
+		if err := decryptConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if problems = append(problems, validateConfig(config)...); len(problems) > 0 {
+		return nil, &ConfigError{Path: configPath, Problems: problems}
+	}
+	return config, nil
 }
 
 // SaveConfig saves the configuration to the config file
@@ -61,6 +121,13 @@ func SaveConfig(config *Config) error {
 		return err
 	}
 
+	config.Version = currentConfigVersion()
+	if config.Encrypted != nil {
+		if config, err = encryptedForm(config); err != nil {
+			return err
+		}
+	}
+
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
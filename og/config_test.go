@@ -42,12 +42,10 @@ func TestSaveAndLoadConfig(t *testing.T) {
 
 	// Test config to save
 	testConfig := &Config{
-		ServerURL:   "https://example.com/source",
-		Username:    "testuser",
-		Password:    "testpass",
-		APIKey:      "test-api-key",
-		BearerToken: "test-bearer-token",
-		WebLinks:    true,
+		ServerURL: "https://example.com/source",
+		Username:  "testuser",
+		Password:  "testpass",
+		WebLinks:  true,
 	}
 
 	// Save config
@@ -84,15 +82,27 @@ func TestSaveAndLoadConfig(t *testing.T) {
 	if loaded.Password != testConfig.Password {
 		t.Errorf("Password: got %q, want %q", loaded.Password, testConfig.Password)
 	}
-	if loaded.APIKey != testConfig.APIKey {
-		t.Errorf("APIKey: got %q, want %q", loaded.APIKey, testConfig.APIKey)
-	}
-	if loaded.BearerToken != testConfig.BearerToken {
-		t.Errorf("BearerToken: got %q, want %q", loaded.BearerToken, testConfig.BearerToken)
-	}
 	if loaded.WebLinks != testConfig.WebLinks {
 		t.Errorf("WebLinks: got %v, want %v", loaded.WebLinks, testConfig.WebLinks)
 	}
+	if loaded.Version != currentConfigVersion() {
+		t.Errorf("Version: got %d, want %d", loaded.Version, currentConfigVersion())
+	}
+
+	// The other auth types, one at a time
+	for _, auth := range []Config{{APIKey: "test-api-key"}, {BearerToken: "test-bearer-token"}} {
+		auth.ServerURL = testConfig.ServerURL
+		if err := SaveConfig(&auth); err != nil {
+			t.Fatalf("SaveConfig failed: %v", err)
+		}
+		loaded, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+		if loaded.APIKey != auth.APIKey || loaded.BearerToken != auth.BearerToken {
+			t.Errorf("auth: got %q/%q, want %q/%q", loaded.APIKey, loaded.BearerToken, auth.APIKey, auth.BearerToken)
+		}
+	}
 }
 
 func TestLoadConfigInvalidJSON(t *testing.T) {
@@ -184,3 +194,31 @@ func TestConfigJSONFormat(t *testing.T) {
 		t.Error("JSON should not contain empty api_key field (omitempty)")
 	}
 }
+
+func TestNewClientUsesConfiguredBases(t *testing.T) {
+	writeTestConfig(t, `{"version": 1, "server_url": "https://grok.example.com/source/", "api_base": "https://api.example.com/og", "xref_base": "https://web.example.com/source/"}`)
+	t.Cleanup(func() { xrefBases.Delete("https://grok.example.com/source") })
+
+	client, err := NewClient("https://grok.example.com/source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.SearchURL(SearchOptions{Full: "x"}); got != "https://api.example.com/og/api/v1/search?full=x" {
+		t.Errorf("SearchURL = %q", got)
+	}
+	if got := xrefURL("https://grok.example.com/source/", "proj", "/a.c", "3"); got != "https://web.example.com/source/xref/proj/a.c#3" {
+		t.Errorf("xrefURL = %q", got)
+	}
+
+	// Another server keeps its own URL for everything
+	other, err := NewClient("https://other.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.APIBase != "" || other.XrefBase != "" {
+		t.Errorf("bases applied to another server: %q, %q", other.APIBase, other.XrefBase)
+	}
+	if got := xrefURL("https://other.example.com", "proj", "/a.c", ""); got != "https://other.example.com/xref/proj/a.c" {
+		t.Errorf("xrefURL = %q", got)
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// passphraseEnvVar supplies the config passphrase for non-interactive use
+const passphraseEnvVar = "OG_CONFIG_PASSPHRASE"
+
+// Key sources for encrypted credentials
+const (
+	keySourcePassphrase = "passphrase"
+	keySourceKeyring    = "keyring"
+)
+
+// scrypt parameters for deriving a key from the passphrase
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	configKeyLen = 32 // AES-256
+)
+
+// ErrConfigLocked is returned when encrypted credentials cannot be decrypted
+var ErrConfigLocked = errors.New("config credentials are encrypted")
+
+// EncryptedCredentials is the encrypted form of the credentials section of the
+// config file (username, password, API key, bearer token and OIDC settings)
+type EncryptedCredentials struct {
+	KeySource  string `json:"key_source"`     // "passphrase" or "keyring"
+	Salt       string `json:"salt,omitempty"` // Base64 scrypt salt (passphrase only)
+	Nonce      string `json:"nonce"`          // Base64 AES-GCM nonce
+	Ciphertext string `json:"ciphertext"`     // Base64 AES-GCM ciphertext
+}
+
+// credentials is the plaintext that gets encrypted
+type credentials struct {
+	Username    string      `json:"username,omitempty"`
+	Password    string      `json:"password,omitempty"`
+	APIKey      string      `json:"api_key,omitempty"`
+	BearerToken string      `json:"bearer_token,omitempty"`
+	OIDC        *OIDCConfig `json:"oidc,omitempty"`
+}
+
+// configKey caches the unlocked key so the passphrase is asked for at most once
+// per process, however many times the config is loaded or saved
+var configKey struct {
+	source string
+	salt   string
+	key    []byte
+}
+
+// readPassphrase prompts for a passphrase; overridden in tests
+var readPassphrase = readPassphraseTerminal
+
+// readPassphraseTerminal prompts on stderr and reads a passphrase without echo.
+// Returns ErrConfigLocked if there is no terminal to prompt on.
+func readPassphraseTerminal(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("%w: set %s or run in a terminal to enter the passphrase", ErrConfigLocked, passphraseEnvVar)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return string(pass), nil
+}
+
+// deriveConfigKey derives an AES key from a passphrase and salt
+func deriveConfigKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, configKeyLen)
+}
+
+// unlockConfigKey returns the key for encrypted credentials, from the cache,
+// the OS keyring, OG_CONFIG_PASSPHRASE, or an interactive prompt
+func unlockConfigKey(enc *EncryptedCredentials) ([]byte, error) {
+	if configKey.key != nil && configKey.source == enc.KeySource && configKey.salt == enc.Salt {
+		return configKey.key, nil
+	}
+
+	var key []byte
+	switch enc.KeySource {
+	case keySourceKeyring:
+		configPath, err := getConfigPath()
+		if err != nil {
+			return nil, err
+		}
+		secret, err := keyringGet(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read key from OS keyring: %v", ErrConfigLocked, err)
+		}
+		key, err = base64.StdEncoding.DecodeString(secret)
+		if err != nil || len(key) != configKeyLen {
+			return nil, fmt.Errorf("%w: invalid key in OS keyring", ErrConfigLocked)
+		}
+	case keySourcePassphrase:
+		salt, err := base64.StdEncoding.DecodeString(enc.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid salt in config file: %w", err)
+		}
+		passphrase := os.Getenv(passphraseEnvVar)
+		if passphrase == "" {
+			passphrase, err = readPassphrase("Config passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+		}
+		key, err = deriveConfigKey(passphrase, salt)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown key source %q in config file", enc.KeySource)
+	}
+
+	configKey.source = enc.KeySource
+	configKey.salt = enc.Salt
+	configKey.key = key
+	return key, nil
+}
+
+// sealCredentials encrypts creds with key under a fresh nonce
+func sealCredentials(creds *credentials, key []byte) (nonce, ciphertext []byte, err error) {
+	gcm, err := newConfigGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+// openCredentials decrypts credentials sealed by sealCredentials
+func openCredentials(enc *EncryptedCredentials, key []byte) (*credentials, error) {
+	gcm, err := newConfigGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(enc.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce in config file: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(enc.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext in config file: %w", err)
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce in config file")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		if enc.KeySource == keySourcePassphrase {
+			return nil, fmt.Errorf("%w: incorrect passphrase", ErrConfigLocked)
+		}
+		return nil, fmt.Errorf("%w: key does not match", ErrConfigLocked)
+	}
+	var creds credentials
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted credentials: %w", err)
+	}
+	return &creds, nil
+}
+
+func newConfigGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptConfig unlocks encrypted credentials and copies them into config
+func decryptConfig(config *Config) error {
+	key, err := unlockConfigKey(config.Encrypted)
+	if err != nil {
+		return err
+	}
+	creds, err := openCredentials(config.Encrypted, key)
+	if err != nil {
+		// Don't keep a key that failed, so a retry prompts again
+		configKey.key = nil
+		return err
+	}
+	config.Username = creds.Username
+	config.Password = creds.Password
+	config.APIKey = creds.APIKey
+	config.BearerToken = creds.BearerToken
+	config.OIDC = creds.OIDC
+	return nil
+}
+
+// encryptedForm returns a copy of config with the credentials replaced by a
+// freshly encrypted section, ready to be written to disk
+func encryptedForm(config *Config) (*Config, error) {
+	key := configKey.key
+	if key == nil || configKey.source != config.Encrypted.KeySource || configKey.salt != config.Encrypted.Salt {
+		var err error
+		if key, err = unlockConfigKey(config.Encrypted); err != nil {
+			return nil, err
+		}
+	}
+
+	nonce, ciphertext, err := sealCredentials(&credentials{
+		Username:    config.Username,
+		Password:    config.Password,
+		APIKey:      config.APIKey,
+		BearerToken: config.BearerToken,
+		OIDC:        config.OIDC,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	out := *config
+	out.Username = ""
+	out.Password = ""
+	out.APIKey = ""
+	out.BearerToken = ""
+	out.OIDC = nil
+	out.Encrypted = &EncryptedCredentials{
+		KeySource:  config.Encrypted.KeySource,
+		Salt:       config.Encrypted.Salt,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}
+	return &out, nil
+}
+
+// EnableConfigEncryption marks config for encryption with a passphrase, or a
+// random key stored in the OS keyring if passphrase is empty. The credentials
+// are encrypted when the config is next saved.
+func EnableConfigEncryption(config *Config, passphrase string) error {
+	enc := &EncryptedCredentials{}
+	var key []byte
+
+	if passphrase != "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		var err error
+		if key, err = deriveConfigKey(passphrase, salt); err != nil {
+			return err
+		}
+		enc.KeySource = keySourcePassphrase
+		enc.Salt = base64.StdEncoding.EncodeToString(salt)
+	} else {
+		key = make([]byte, configKeyLen)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		configPath, err := getConfigPath()
+		if err != nil {
+			return err
+		}
+		if err := keyringSet(configPath, base64.StdEncoding.EncodeToString(key)); err != nil {
+			return fmt.Errorf("failed to store key in OS keyring: %w", err)
+		}
+		enc.KeySource = keySourceKeyring
+	}
+
+	configKey.source = enc.KeySource
+	configKey.salt = enc.Salt
+	configKey.key = key
+	config.Encrypted = enc
+	return nil
+}
+
+// DisableConfigEncryption makes config save its credentials in plaintext again,
+// removing any key stored in the OS keyring
+func DisableConfigEncryption(config *Config) error {
+	if config.Encrypted == nil {
+		return nil
+	}
+	if config.Encrypted.KeySource == keySourceKeyring {
+		configPath, err := getConfigPath()
+		if err != nil {
+			return err
+		}
+		if err := keyringDelete(configPath); err != nil {
+			return fmt.Errorf("failed to remove key from OS keyring: %w", err)
+		}
+	}
+	config.Encrypted = nil
+	configKey.key = nil
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupEncryptedConfigTest points the config at a temp file and resets the
+// cached key and passphrase sources
+func setupEncryptedConfigTest(t *testing.T) string {
+	t.Helper()
+	oldGetConfigPath := getConfigPath
+	oldReadPassphrase := readPassphrase
+	t.Cleanup(func() {
+		getConfigPath = oldGetConfigPath
+		readPassphrase = oldReadPassphrase
+		configKey.key = nil
+	})
+
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	getConfigPath = func() (string, error) { return configFile, nil }
+	readPassphrase = func(string) (string, error) {
+		return "", errors.New("unexpected passphrase prompt")
+	}
+	configKey.key = nil
+	t.Setenv(passphraseEnvVar, "")
+	return configFile
+}
+
+func TestConfigEncryptionPassphrase(t *testing.T) {
+	configFile := setupEncryptedConfigTest(t)
+
+	config := &Config{
+		ServerURL: "https://example.com/source",
+		Username:  "alice",
+		Password:  "s3cret-password",
+		OIDC:      &OIDCConfig{Issuer: "https://sso.example.com", RefreshToken: "s3cret-refresh"},
+	}
+	if err := EnableConfigEncryption(config, "correct horse"); err != nil {
+		t.Fatalf("EnableConfigEncryption failed: %v", err)
+	}
+	if err := SaveConfig(config); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"alice", "s3cret-password", "s3cret-refresh"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("config file contains plaintext %q", secret)
+		}
+	}
+	if !strings.Contains(string(data), "https://example.com/source") {
+		t.Error("server URL should stay in plaintext")
+	}
+
+	// A new process has no cached key and reads the passphrase from the environment
+	configKey.key = nil
+	t.Setenv(passphraseEnvVar, "correct horse")
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if loaded.Username != "alice" || loaded.Password != "s3cret-password" {
+		t.Errorf("credentials not decrypted: %+v", loaded)
+	}
+	if loaded.OIDC == nil || loaded.OIDC.RefreshToken != "s3cret-refresh" {
+		t.Errorf("OIDC settings not decrypted: %+v", loaded.OIDC)
+	}
+}
+
+func TestConfigEncryptionLocked(t *testing.T) {
+	setupEncryptedConfigTest(t)
+
+	config := &Config{ServerURL: "https://example.com/source", APIKey: "key"}
+	if err := EnableConfigEncryption(config, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// No passphrase available
+	configKey.key = nil
+	readPassphrase = readPassphraseTerminal
+	if _, err := LoadConfig(); !errors.Is(err, ErrConfigLocked) || !strings.Contains(err.Error(), passphraseEnvVar) {
+		t.Errorf("expected locked error mentioning %s, got %v", passphraseEnvVar, err)
+	}
+
+	// Wrong passphrase
+	readPassphrase = func(string) (string, error) { return "wrong", nil }
+	if _, err := LoadConfig(); !errors.Is(err, ErrConfigLocked) || !strings.Contains(err.Error(), "incorrect passphrase") {
+		t.Errorf("expected incorrect passphrase error, got %v", err)
+	}
+
+	// The failed key is not cached, so the next attempt prompts again
+	prompts := 0
+	readPassphrase = func(string) (string, error) { prompts++; return "correct horse", nil }
+	for i := 0; i < 2; i++ {
+		if _, err := LoadConfig(); err != nil {
+			t.Fatalf("LoadConfig failed: %v", err)
+		}
+	}
+	if prompts != 1 {
+		t.Errorf("expected one passphrase prompt, got %d", prompts)
+	}
+}
+
+func TestConfigEncryptionKeyring(t *testing.T) {
+	configFile := setupEncryptedConfigTest(t)
+
+	keyring := map[string]string{}
+	oldGet, oldSet, oldDelete := keyringGet, keyringSet, keyringDelete
+	t.Cleanup(func() { keyringGet, keyringSet, keyringDelete = oldGet, oldSet, oldDelete })
+	keyringGet = func(account string) (string, error) {
+		secret, ok := keyring[account]
+		if !ok {
+			return "", errors.New("not found")
+		}
+		return secret, nil
+	}
+	keyringSet = func(account, secret string) error { keyring[account] = secret; return nil }
+	keyringDelete = func(account string) error { delete(keyring, account); return nil }
+
+	config := &Config{ServerURL: "https://example.com/source", APIKey: "s3cret-key"}
+	if err := EnableConfigEncryption(config, ""); err != nil {
+		t.Fatalf("EnableConfigEncryption failed: %v", err)
+	}
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keyring[configFile]; !ok {
+		t.Fatal("expected key to be stored in keyring under the config path")
+	}
+
+	configKey.key = nil
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if loaded.APIKey != "s3cret-key" || loaded.Encrypted.KeySource != keySourceKeyring {
+		t.Errorf("unexpected config: %+v", loaded)
+	}
+
+	// Decrypting removes the keyring entry and writes plaintext
+	if err := DisableConfigEncryption(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyring) != 0 {
+		t.Error("expected keyring entry to be removed")
+	}
+	data, _ := os.ReadFile(configFile)
+	if !strings.Contains(string(data), "s3cret-key") || strings.Contains(string(data), "encrypted_credentials") {
+		t.Errorf("expected plaintext config after decrypt:\n%s", data)
+	}
+
+	// A missing keyring entry locks the config
+	if err := EnableConfigEncryption(loaded, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveConfig(loaded); err != nil {
+		t.Fatal(err)
+	}
+	delete(keyring, configFile)
+	configKey.key = nil
+	if _, err := LoadConfig(); !errors.Is(err, ErrConfigLocked) {
+		t.Errorf("expected locked error, got %v", err)
+	}
+}
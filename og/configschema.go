@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configMigrations upgrade a config file one layout version at a time:
+// configMigrations[i] turns version i into version i+1, returning a note
+// for each change the user should hear about. Files without a "version" key
+// predate versioning and are version 0. When a change moves settings around
+// (e.g. into new sections), add a migration here rather than reading the
+// old layout elsewhere.
+var configMigrations = []func(raw map[string]json.RawMessage) ([]string, error){
+	// 0 -> 1: the version key itself, and only one auth type, as version 1
+	// requires (see validateConfig)
+	dropUnusedAuth,
+}
+
+// dropUnusedAuth removes the credentials of a version 0 file that og never
+// used because one of higher precedence is set: bearer_token beats api_key,
+// which beats username and password
+func dropUnusedAuth(raw map[string]json.RawMessage) ([]string, error) {
+	set := func(key string) bool {
+		var s string
+		return json.Unmarshal(raw[key], &s) == nil && s != ""
+	}
+	var used string
+	var unused []string
+	for _, key := range []string{"bearer_token", "api_key", "username"} {
+		if !set(key) {
+			continue
+		}
+		if used == "" {
+			used = key
+		} else {
+			unused = append(unused, key)
+		}
+	}
+	if len(unused) == 0 {
+		return nil, nil
+	}
+	for _, key := range unused {
+		delete(raw, key)
+		if key == "username" {
+			delete(raw, "password")
+		}
+	}
+	return []string{fmt.Sprintf("removed \"%s\", which og never used: %q takes precedence", strings.Join(unused, `" and "`), used)}, nil
+}
+
+// currentConfigVersion is the layout version this og reads and writes
+func currentConfigVersion() int {
+	return len(configMigrations)
+}
+
+// ConfigError lists the problems found in a config file
+type ConfigError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config file %s:\n  %s", e.Path, strings.Join(e.Problems, "\n  "))
+}
+
+// parseConfig decodes a config file, migrating older layouts, and returns
+// its unknown keys and values of the wrong type as problems. Files from
+// before versioning were never checked for unknown keys, so theirs are
+// warnings instead, with the notes of the migrations. migrated is the
+// upgraded file to write back, nil if it was current or still has unknown
+// keys. Credentials are still encrypted at this point; see validateConfig
+// for the checks on decrypted values.
+func parseConfig(path string, data []byte) (config *Config, migrated []byte, problems, warnings []string, err error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, jsonErrorPosition(data, err))
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil || version < 0 {
+			return nil, nil, nil, nil, &ConfigError{Path: path, Problems: []string{fmt.Sprintf("\"version\" must be a whole number, not %s", v)}}
+		}
+	}
+	if version > currentConfigVersion() {
+		return nil, nil, nil, nil, fmt.Errorf("config file %s has version %d, but this og only understands up to version %d; upgrade og", path, version, currentConfigVersion())
+	}
+	if version < currentConfigVersion() {
+		for _, migrate := range configMigrations[version:] {
+			notes, err := migrate(raw)
+			if err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("failed to migrate config file %s from version %d: %w", path, version, err)
+			}
+			warnings = append(warnings, notes...)
+		}
+		raw["version"] = json.RawMessage(fmt.Sprint(currentConfigVersion()))
+		if data, err = json.MarshalIndent(raw, "", "  "); err != nil {
+			return nil, nil, nil, nil, err
+		}
+		migrated = data
+	}
+
+	unknown := unknownConfigKeys(raw, reflect.TypeOf(Config{}), "")
+	if version == 0 && len(unknown) > 0 {
+		// Kept at version 0 until they are removed, as version 1 refuses them
+		for _, u := range unknown {
+			warnings = append(warnings, u+" is ignored")
+		}
+		migrated = nil
+	} else {
+		problems = unknown
+	}
+	config = &Config{}
+	var typeErr *json.UnmarshalTypeError
+	if err := json.Unmarshal(data, config); errors.As(err, &typeErr) {
+		problems = append(problems, fmt.Sprintf("%q must be a %s, not a JSON %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value))
+	} else if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return config, migrated, problems, warnings, nil
+}
+
+// validateConfig checks the values of a decoded config, returning one
+// actionable message per problem
+func validateConfig(config *Config) []string {
+	var problems []string
+	if config.ServerURL != "" {
+		if err := checkHTTPURL(config.ServerURL); err != nil {
+			problems = append(problems, fmt.Sprintf("\"server_url\" %q %v; run 'og init <server-url>' to set it", config.ServerURL, err))
+		}
+	}
+	for _, base := range []struct{ key, value string }{{"api_base", config.APIBase}, {"xref_base", config.XrefBase}} {
+		if base.value == "" {
+			continue
+		}
+		if err := checkHTTPURL(base.value); err != nil {
+			problems = append(problems, fmt.Sprintf("%q %q %v; set it to the URL /api/v1 or /xref is under, or remove it", base.key, base.value, err))
+		}
+	}
+	if config.OIDC != nil && config.OIDC.Issuer != "" {
+		if err := checkHTTPURL(config.OIDC.Issuer); err != nil {
+			problems = append(problems, fmt.Sprintf("\"oidc.issuer\" %q %v; run 'og auth login --oidc --issuer <url>' to set it", config.OIDC.Issuer, err))
+		}
+	}
+
+	var auth []string
+	if config.Username != "" {
+		auth = append(auth, "username")
+	} else if config.Password != "" {
+		problems = append(problems, "\"password\" is set without \"username\"; add the username or remove the password")
+	}
+	if config.APIKey != "" {
+		auth = append(auth, "api_key")
+	}
+	if config.BearerToken != "" {
+		auth = append(auth, "bearer_token")
+	}
+	if len(auth) > 1 {
+		// Listed in increasing precedence, so the last one is the one used
+		used := auth[len(auth)-1]
+		problems = append(problems, fmt.Sprintf("\"%s\" and %q are mutually exclusive auth types; remove all but one (og would use %q)", strings.Join(auth[:len(auth)-1], `", "`), used, used))
+	}
+
+	if config.DefaultSearch != "" && !isSearchType(config.DefaultSearch) {
+		problems = append(problems, fmt.Sprintf("\"default_search\" %q is not a search type (%s); see 'og config default-search'", config.DefaultSearch, strings.Join(searchTypes, ", ")))
+	}
+	if config.SearchCase != "" && !isCaseMode(config.SearchCase) {
+		problems = append(problems, fmt.Sprintf("\"search_case\" %q is not a case mode (%s); see 'og config search-case'", config.SearchCase, strings.Join(caseModes, ", ")))
+	}
+	if config.Locale != "" && !localeTagRegex.MatchString(config.Locale) {
+		problems = append(problems, fmt.Sprintf("\"locale\" %q is not a locale; use a language code such as \"de\" or \"pt_BR\"", config.Locale))
+	}
+	return problems
+}
+
+// checkHTTPURL reports why s is not an absolute http(s) URL, phrased to
+// follow the URL in a message
+func checkHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	switch {
+	case err != nil:
+		return errors.New("is not a valid URL")
+	case u.Scheme != "http" && u.Scheme != "https":
+		return errors.New("must start with http:// or https://")
+	case u.Host == "":
+		return errors.New("has no host name")
+	}
+	return nil
+}
+
+// unknownConfigKeys returns a message for each key of raw that t (a struct
+// type) has no field for, looking into nested sections. prefix is the
+// dotted path of raw within the file.
+func unknownConfigKeys(raw map[string]json.RawMessage, t reflect.Type, prefix string) []string {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	known := make([]string, 0, len(fields))
+	for name := range fields {
+		known = append(known, name)
+	}
+	sort.Strings(known)
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		fieldType, ok := fields[key]
+		if !ok {
+			msg := fmt.Sprintf("unknown key %q", prefix+key)
+			if suggestion := closestKey(key, known); suggestion != "" {
+				msg += fmt.Sprintf(" (did you mean %q?)", prefix+suggestion)
+			}
+			problems = append(problems, msg)
+			continue
+		}
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		var section map[string]json.RawMessage
+		if fieldType.Kind() == reflect.Struct && json.Unmarshal(raw[key], &section) == nil {
+			problems = append(problems, unknownConfigKeys(section, fieldType, prefix+key+".")...)
+		}
+	}
+	return problems
+}
+
+// closestKey returns the known key that key most likely misspells, or ""
+func closestKey(key string, known []string) string {
+	normalize := func(s string) string {
+		return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(s))
+	}
+	best, bestDistance := "", 3
+	for _, k := range known {
+		if d := editDistance(normalize(key), normalize(k)); d < bestDistance {
+			best, bestDistance = k, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// jsonTypeName describes a Go type by the JSON value it decodes from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean (true or false)"
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		return "number"
+	case reflect.Map, reflect.Struct, reflect.Pointer:
+		return "object"
+	case reflect.Slice:
+		return "list"
+	}
+	return t.String()
+}
+
+// jsonErrorPosition adds the line and column to a JSON syntax error
+func jsonErrorPosition(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	// Offset counts the offending byte
+	before := data[:max(0, min(int(syntaxErr.Offset)-1, len(data)))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
+
+// writeMigratedConfig saves a config file upgraded by parseConfig. Failing
+// to write it is not fatal: the file is migrated again on the next load.
+func writeMigratedConfig(path string, data []byte) {
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save migrated config: %v\n", err)
+	}
+}
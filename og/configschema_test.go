@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestConfig points the config path at a temp file holding data
+func writeTestConfig(t *testing.T, data string) string {
+	t.Helper()
+	oldGetConfigPath := getConfigPath
+	t.Cleanup(func() { getConfigPath = oldGetConfigPath })
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	getConfigPath = func() (string, error) { return configFile, nil }
+	if err := os.WriteFile(configFile, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestLoadConfigMigratesUnversioned(t *testing.T) {
+	configFile := writeTestConfig(t, `{"server_url": "https://example.com/source", "web_links": true}`)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.ServerURL != "https://example.com/source" || !config.WebLinks {
+		t.Errorf("settings lost in migration: %+v", config)
+	}
+
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]any
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved["version"] != float64(currentConfigVersion()) || saved["web_links"] != true {
+		t.Errorf("migrated file not saved: %s", data)
+	}
+}
+
+func TestLoadConfigRunsMigrationsInOrder(t *testing.T) {
+	oldMigrations := configMigrations
+	defer func() { configMigrations = oldMigrations }()
+	// A later layout that moved the theme into a section, migrated back here
+	// so that the test can check it through Config
+	configMigrations = append(configMigrations[:len(configMigrations):len(configMigrations)], func(raw map[string]json.RawMessage) ([]string, error) {
+		raw["theme"] = json.RawMessage(`"monokai"`)
+		return nil, nil
+	})
+
+	writeTestConfig(t, `{"server_url": "https://example.com/source"}`)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.Theme != "monokai" || config.Version != 2 {
+		t.Errorf("migrations not applied: %+v", config)
+	}
+}
+
+func TestLoadConfigUnversionedLeniency(t *testing.T) {
+	// Files from before versioning only warn about what version 1 refuses
+	configFile := writeTestConfig(t, `{"server_url": "https://x", "username": "u", "password": "p", "api_key": "k", "bearer_token": "b"}`)
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if config.BearerToken != "b" || config.APIKey != "" || config.Username != "" || config.Password != "" {
+		t.Errorf("unused auth kept: %+v", config)
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version"`) || strings.Contains(string(data), `"api_key"`) {
+		t.Errorf("migrated file not saved: %s", data)
+	}
+
+	configFile = writeTestConfig(t, `{"server_url": "https://x", "colour": true}`)
+	if _, err := LoadConfig(); err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if data, err := os.ReadFile(configFile); err != nil || strings.Contains(string(data), `"version"`) {
+		t.Errorf("file with unknown keys migrated: %s", data)
+	}
+	_, _, problems, warnings, err := parseConfig(configFile, []byte(`{"colour": true, "username": "u", "api_key": "k"}`))
+	if err != nil || len(problems) != 0 || len(warnings) != 2 {
+		t.Errorf("problems %q, warnings %q, err %v", problems, warnings, err)
+	}
+}
+
+func TestLoadConfigNewerVersion(t *testing.T) {
+	writeTestConfig(t, `{"version": 99, "server_url": "https://example.com/source"}`)
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "upgrade og") {
+		t.Errorf("expected an upgrade error, got %v", err)
+	}
+}
+
+func TestLoadConfigProblems(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []string
+	}{
+		{
+			"unknown keys",
+			`{"version": 1, "serverUrl": "https://x", "oidc": {"issuer": "https://sso", "clientid": "og"}, "colour": true}`,
+			[]string{`unknown key "colour"`, `unknown key "oidc.clientid" (did you mean "oidc.client_id"?)`, `unknown key "serverUrl" (did you mean "server_url"?)`},
+		},
+		{
+			"wrong type",
+			`{"version": 1, "web_links": "yes"}`,
+			[]string{`"web_links" must be a boolean (true or false), not a JSON string`},
+		},
+		{
+			"malformed URLs",
+			`{"version": 1, "server_url": "opengrok.example.com/source", "oidc": {"issuer": "https://", "client_id": "og"}}`,
+			[]string{`"server_url" "opengrok.example.com/source" must start with http:// or https://`, `"oidc.issuer" "https://" has no host name`},
+		},
+		{
+			"malformed bases",
+			`{"version": 1, "server_url": "https://x", "api_base": "/api", "xref_base": "https://web/source"}`,
+			[]string{`"api_base" "/api" must start with http:// or https://; set it to the URL /api/v1 or /xref is under, or remove it`},
+		},
+		{
+			"auth types",
+			`{"version": 1, "server_url": "https://x", "username": "u", "password": "p", "api_key": "k", "bearer_token": "b"}`,
+			[]string{`"username", "api_key" and "bearer_token" are mutually exclusive auth types; remove all but one (og would use "bearer_token")`},
+		},
+		{
+			"password alone",
+			`{"version": 1, "server_url": "https://x", "password": "p"}`,
+			[]string{`"password" is set without "username"`},
+		},
+		{
+			"search case",
+			`{"version": 1, "server_url": "https://x", "search_case": "insensitive"}`,
+			[]string{`"search_case" "insensitive" is not a case mode (smart, ignore, sensitive)`},
+		},
+		{
+			"locale",
+			`{"version": 1, "server_url": "https://x", "locale": "German"}`,
+			[]string{`"locale" "German" is not a locale`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTestConfig(t, tt.data)
+			_, err := LoadConfig()
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected a ConfigError, got %v", err)
+			}
+			if len(configErr.Problems) != len(tt.want) {
+				t.Fatalf("got problems %q, want %d", configErr.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(configErr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, configErr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigSyntaxErrorPosition(t *testing.T) {
+	writeTestConfig(t, "{\n  \"server_url\": \"https://x\",\n}\n")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "line 3, column 1") {
+		t.Errorf("expected the error position, got %v", err)
+	}
+}
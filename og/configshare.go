@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxConfigImportSize bounds a config fetched by 'og config import <url>'
+const maxConfigImportSize = 1 << 20
+
+// exportConfig returns the part of cfg worth handing to a teammate: the
+// server, its bases, project groups and defaults. Settings tied to this
+// machine (local checkouts, the annotations and catalog directories, the
+// daemon address)
+// and cached OIDC tokens are left out, as are the credentials with
+// noSecrets. The result carries the config version so imports can migrate it.
+func exportConfig(cfg *Config, noSecrets bool) *Config {
+	out := &Config{
+		Version:       currentConfigVersion(),
+		ServerURL:     cfg.ServerURL,
+		WebLinks:      cfg.WebLinks,
+		Theme:         cfg.Theme,
+		APIBase:       cfg.APIBase,
+		XrefBase:      cfg.XrefBase,
+		DefaultSearch: cfg.DefaultSearch,
+		SearchCase:    cfg.SearchCase,
+		Locale:        cfg.Locale,
+		ProjectGroups: cfg.ProjectGroups,
+		Trace:         cfg.Trace,
+	}
+	if cfg.OIDC != nil {
+		out.OIDC = &OIDCConfig{Issuer: cfg.OIDC.Issuer, ClientID: cfg.OIDC.ClientID, Scopes: cfg.OIDC.Scopes}
+	}
+	if !noSecrets {
+		out.Username = cfg.Username
+		out.Password = cfg.Password
+		out.APIKey = cfg.APIKey
+		out.BearerToken = cfg.BearerToken
+	}
+	return out
+}
+
+// hasCredentials reports whether cfg holds a username, password, API key or
+// bearer token
+func hasCredentials(cfg *Config) bool {
+	return cfg.Username != "" || cfg.Password != "" || cfg.APIKey != "" || cfg.BearerToken != ""
+}
+
+// readConfigImport reads a config to import from a file, an http(s) URL or
+// "-" for stdin
+func readConfigImport(source string) ([]byte, error) {
+	switch {
+	case source == "-":
+		return io.ReadAll(io.LimitReader(os.Stdin, maxConfigImportSize))
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %s: %s", source, resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxConfigImportSize))
+	default:
+		return os.ReadFile(source)
+	}
+}
+
+// parseConfigImport decodes a config to import, migrating it from older
+// versions and rejecting unknown keys and invalid values as LoadConfig
+// would. Encrypted credentials can't be imported: the key stays with the
+// machine that encrypted them.
+func parseConfigImport(source string, data []byte) (*Config, error) {
+	imported, _, problems, warnings, err := parseConfig(source, data)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, warnings...)
+	if imported.Encrypted != nil {
+		return nil, fmt.Errorf("%s has encrypted credentials; export it with 'og config export --no-secrets'", source)
+	}
+	if problems = append(problems, validateConfig(imported)...); len(problems) > 0 {
+		return nil, &ConfigError{Path: source, Problems: problems}
+	}
+	return imported, nil
+}
+
+// mergeConfigImport merges imported into cfg and returns the keys it
+// changed. Set values replace the local ones; project groups are merged by
+// name. Credentials are replaced as a whole, so an imported API key doesn't
+// end up next to a local username. Machine-specific settings are kept.
+func mergeConfigImport(cfg, imported *Config) []string {
+	var changed []string
+	setString := func(key string, dst *string, src string) {
+		if src != "" && *dst != src {
+			*dst = src
+			changed = append(changed, key)
+		}
+	}
+	setString("server_url", &cfg.ServerURL, imported.ServerURL)
+	setString("api_base", &cfg.APIBase, imported.APIBase)
+	setString("xref_base", &cfg.XrefBase, imported.XrefBase)
+	setString("theme", &cfg.Theme, imported.Theme)
+	setString("default_search", &cfg.DefaultSearch, imported.DefaultSearch)
+	setString("search_case", &cfg.SearchCase, imported.SearchCase)
+	setString("locale", &cfg.Locale, imported.Locale)
+	if imported.WebLinks && !cfg.WebLinks {
+		cfg.WebLinks = true
+		changed = append(changed, "web_links")
+	}
+
+	if hasCredentials(imported) && (cfg.Username != imported.Username || cfg.Password != imported.Password ||
+		cfg.APIKey != imported.APIKey || cfg.BearerToken != imported.BearerToken) {
+		cfg.Username = imported.Username
+		cfg.Password = imported.Password
+		cfg.APIKey = imported.APIKey
+		cfg.BearerToken = imported.BearerToken
+		changed = append(changed, "credentials")
+	}
+
+	var groups []string
+	for name, projects := range imported.ProjectGroups {
+		if current, ok := cfg.ProjectGroups[name]; ok && strings.Join(current, ",") == strings.Join(projects, ",") {
+			continue
+		}
+		if cfg.ProjectGroups == nil {
+			cfg.ProjectGroups = make(map[string][]string)
+		}
+		cfg.ProjectGroups[name] = projects
+		groups = append(groups, groupPrefix+name)
+	}
+	if len(groups) > 0 {
+		sort.Strings(groups)
+		changed = append(changed, "project_groups ("+strings.Join(groups, ", ")+")")
+	}
+
+	if imported.Trace != nil && !reflect.DeepEqual(cfg.Trace, imported.Trace) {
+		cfg.Trace = imported.Trace
+		changed = append(changed, "trace")
+	}
+	if imported.OIDC != nil && imported.OIDC.Issuer != "" {
+		if cfg.OIDC == nil || cfg.OIDC.Issuer != imported.OIDC.Issuer || cfg.OIDC.ClientID != imported.OIDC.ClientID {
+			// Tokens from another issuer or client are useless
+			cfg.OIDC = &OIDCConfig{Issuer: imported.OIDC.Issuer, ClientID: imported.OIDC.ClientID, Scopes: imported.OIDC.Scopes}
+			changed = append(changed, "oidc")
+		}
+	}
+	return changed
+}
+
+// writeConfigExport writes an exported config as indented JSON
+func writeConfigExport(w io.Writer, cfg *Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigExportImportRoundTrip(t *testing.T) {
+	cfg := &Config{
+		ServerURL:       "https://og.example.com/source",
+		Username:        "alice",
+		Password:        "secret",
+		Theme:           "github",
+		DefaultSearch:   "symbol",
+		ProjectGroups:   map[string][]string{"kernel": {"illumos-gate", "linux"}},
+		LocalRoots:      map[string]string{"linux": "/home/alice/src/linux"},
+		AnnotationsPath: "/home/alice/notes",
+		Daemon:          "127.0.0.1:7777",
+		OIDC:            &OIDCConfig{Issuer: "https://sso.example.com", ClientID: "og", AccessToken: "tok", Expiry: time.Now()},
+	}
+
+	var buf bytes.Buffer
+	if err := writeConfigExport(&buf, exportConfig(cfg, true)); err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"alice", "secret", "tok", "local_roots", "annotations_path", "daemon"} {
+		if strings.Contains(buf.String(), leaked) {
+			t.Errorf("export contains %q:\n%s", leaked, buf.String())
+		}
+	}
+
+	imported, err := parseConfigImport("team.json", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := &Config{
+		ServerURL:     "https://old.example.com",
+		APIKey:        "mine",
+		ProjectGroups: map[string][]string{"mine": {"a"}, "kernel": {"linux"}},
+		LocalRoots:    map[string]string{"a": "/src/a"},
+	}
+	changed := mergeConfigImport(local, imported)
+	want := []string{"server_url", "theme", "default_search", "project_groups (@kernel)", "oidc"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if local.APIKey != "mine" || local.LocalRoots["a"] != "/src/a" || len(local.ProjectGroups) != 2 ||
+		strings.Join(local.ProjectGroups["kernel"], ",") != "illumos-gate,linux" || local.OIDC.AccessToken != "" {
+		t.Errorf("merged = %+v", local)
+	}
+	if changed := mergeConfigImport(local, imported); len(changed) != 0 {
+		t.Errorf("second import changed %v", changed)
+	}
+
+	// Credentials replace the local ones as a whole
+	withSecrets := exportConfig(cfg, false)
+	if changed := mergeConfigImport(local, withSecrets); !reflect.DeepEqual(changed, []string{"credentials"}) ||
+		local.APIKey != "" || local.Username != "alice" || local.Password != "secret" {
+		t.Errorf("changed %v, merged %+v", changed, local)
+	}
+}
+
+func TestParseConfigImportRejects(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{`{"server_url": "og.example.com"}`, "must start with http"},
+		{`{"sever_url": "https://og.example.com"}`, `did you mean "server_url"`},
+		{`{"username": "a", "api_key": "k"}`, `"api_key" takes precedence`},
+		{`{"version": 1, "username": "a", "api_key": "k"}`, "mutually exclusive"},
+		{`{"encrypted_credentials": {"key_source": "keyring"}}`, "encrypted credentials"},
+		{`{"version": 99}`, "upgrade og"},
+		{`not json`, "failed to parse"},
+	}
+	for _, tt := range tests {
+		if _, err := parseConfigImport("team.json", []byte(tt.data)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseConfigImport(%s) error = %v, want %q", tt.data, err, tt.want)
+		}
+	}
+}
+
+func TestReadConfigImportURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/og.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"server_url": "https://og.example.com"}`))
+	}))
+	defer server.Close()
+
+	data, err := readConfigImport(server.URL + "/og.json")
+	if err != nil || !strings.Contains(string(data), "og.example.com") {
+		t.Errorf("readConfigImport() = %s, %v", data, err)
+	}
+	if _, err := readConfigImport(server.URL + "/missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing file error = %v", err)
+	}
+}
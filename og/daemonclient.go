@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// upstreamHeader carries the OpenGrok URL of a request sent to the daemon's
+// /upstream endpoint
+const upstreamHeader = "X-Og-Upstream"
+
+// daemonAddr returns the address of the 'og serve' daemon CLI requests go
+// through: OG_DAEMON, else "daemon" in cfg, else "" for none
+func daemonAddr(cfg *Config) string {
+	if addr := os.Getenv(envDaemon); addr != "" {
+		return addr
+	}
+	if cfg != nil {
+		return cfg.Daemon
+	}
+	return ""
+}
+
+// newDaemonTransport returns a transport sending requests through the
+// daemon at addr, or next when that can't be done safely: the address must
+// be a loopback one, and the daemon's token file (see readDaemonToken) must
+// be there to prove the daemon is the user's. No daemon running means no
+// token file, and requests go straight to the server.
+func newDaemonTransport(addr string, next http.RoundTripper) http.RoundTripper {
+	if !isLoopbackAddr(addr) {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring daemon address %s; only loopback addresses are used\n", addr)
+		return next
+	}
+	token, err := readDaemonToken()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: not using the daemon: %v\n", err)
+		}
+		return next
+	}
+	return &daemonTransport{addr: addr, token: token, next: next}
+}
+
+// daemonTransport sends GET requests through a local 'og serve' daemon, so
+// concurrent og processes share its rate limit, response cache and
+// connections. The daemon is sent its token and never the caller's
+// credentials; it uses its own. Requests go straight to the server when the
+// daemon is not running or serves another server, and for other methods,
+// whose bodies can't be replayed after a failed attempt.
+type daemonTransport struct {
+	addr  string
+	token string
+	next  http.RoundTripper
+}
+
+func (t *daemonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.next.RoundTrip(req)
+	}
+	out := req.Clone(req.Context())
+	out.URL = &url.URL{Scheme: "http", Host: t.addr, Path: "/upstream"}
+	out.Host = ""
+	out.Header.Set("Authorization", "Bearer "+t.token)
+	out.Header.Set(upstreamHeader, req.URL.String())
+	resp, err := t.next.RoundTrip(out)
+	if err != nil {
+		var opErr *net.OpError
+		if req.Context().Err() == nil && errors.As(err, &opErr) && opErr.Op == "dial" {
+			return t.next.RoundTrip(req)
+		}
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMisdirectedRequest {
+		resp.Body.Close()
+		return t.next.RoundTrip(req)
+	}
+	return resp, nil
+}
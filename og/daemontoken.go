@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// getDaemonTokenPathDefault returns where 'og serve' keeps its token, in the
+// user's cache directory
+func getDaemonTokenPathDefault() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "og", "daemon.token"), nil
+}
+
+// getDaemonTokenPath is a variable that can be overridden in tests
+var getDaemonTokenPath = getDaemonTokenPathDefault
+
+// resolveDaemonToken returns the daemon token from the flag or the
+// environment, in that order, or a new random one
+func resolveDaemonToken(flagToken string) (string, error) {
+	switch {
+	case flagToken != "":
+		return flagToken, nil
+	case os.Getenv(envDaemonToken) != "":
+		return os.Getenv(envDaemonToken), nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// writeDaemonToken saves the token where the user's other og processes
+// find it, readable only by the user. An existing file is replaced rather
+// than written through, so a file or link planted there is never followed.
+func writeDaemonToken(token string) (string, error) {
+	path, err := getDaemonTokenPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(token + "\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// readDaemonToken returns the token of the running daemon. The file must
+// be a regular file the user owns and only the user can read; anything
+// else could have been left by another user to be sent their requests.
+func readDaemonToken() (string, error) {
+	path, err := getDaemonTokenPath()
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() || !privateToUser(info) {
+		return "", fmt.Errorf("%s is not a private file of yours; ignoring it", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// isLoopbackHost reports whether a Host header ("127.0.0.1:7878",
+// "localhost", "[::1]:7878") names the loopback interface. Requests for
+// any other name are refused, so a DNS rebinding page can't reach the
+// daemon under its own domain.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
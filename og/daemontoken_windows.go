@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// privateToUser reports whether a file is private to the current user.
+// Windows has no mode bits to check, and the cache directory is private to
+// the user, so files in it are taken to be.
+func privateToUser(info os.FileInfo) bool {
+	return true
+}
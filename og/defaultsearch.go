@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// searchTypes are the search commands, in the order help lists them
+var searchTypes = []string{"full", "def", "symbol", "path", "hist"}
+
+// isSearchType reports whether name is one of searchTypes
+func isSearchType(name string) bool {
+	for _, t := range searchTypes {
+		if name == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isImplicitQuery reports whether the first argument, not being a command,
+// is a query for "og <query>" rather than a misplaced option or server URL
+func isImplicitQuery(arg string) bool {
+	return strings.TrimSpace(arg) != "" && !strings.HasPrefix(arg, "-") && !looksLikeServerURL(arg)
+}
+
+// mistypedCommand returns the command a query for "og <query>" is probably a
+// misspelling of, or "" if it is close to none. Only lower case words are
+// checked, so identifiers and paths are searched as usual.
+func mistypedCommand(arg string) string {
+	if strings.Trim(arg, "abcdefghijklmnopqrstuvwxyz-") != "" {
+		return ""
+	}
+	names := []string{"help", "man"}
+	for _, c := range commands {
+		names = append(names, strings.Fields(c.Name)[0])
+	}
+	// closestKey allows two edits, which would turn most short words into
+	// commands; keep to about one edit in three letters
+	best := closestKey(arg, names)
+	if best == "" || 3*editDistance(arg, best) > len(best)+1 {
+		return ""
+	}
+	return best
+}
+
+// looksLikePath reports whether a query is better run as a path search: a
+// single word with a "/" in it, such as "uts/common/os" or "src/*.c"
+func looksLikePath(query string) bool {
+	return strings.Contains(query, "/") && !strings.ContainsAny(query, " \t\"")
+}
+
+// implicitSearchType picks the search run by "og <query>": a path search for
+// queries that look like paths, otherwise defaultSearch (the default_search
+// setting), which is full when unset
+func implicitSearchType(query, defaultSearch string) (string, error) {
+	if defaultSearch != "" && !isSearchType(defaultSearch) {
+		return "", fmt.Errorf("default_search %q is not a search type (%s)", defaultSearch, strings.Join(searchTypes, ", "))
+	}
+	switch {
+	case looksLikePath(query):
+		return "path", nil
+	case defaultSearch != "":
+		return defaultSearch, nil
+	}
+	return "full", nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func TestImplicitSearchType(t *testing.T) {
+	tests := []struct {
+		query, defaultSearch, want string
+	}{
+		{"mutex_enter", "", "full"},
+		{"mutex_enter", "symbol", "symbol"},
+		{"uts/common/os", "", "path"},
+		{"src/*.c", "def", "path"},
+		{"and/or usage", "", "full"},
+		{`"a/b"`, "", "full"},
+	}
+	for _, tt := range tests {
+		got, err := implicitSearchType(tt.query, tt.defaultSearch)
+		if err != nil || got != tt.want {
+			t.Errorf("implicitSearchType(%q, %q) = %q, %v; want %q", tt.query, tt.defaultSearch, got, err, tt.want)
+		}
+	}
+	if _, err := implicitSearchType("x", "grep"); err == nil {
+		t.Error("implicitSearchType accepted default_search \"grep\"")
+	}
+}
+
+func TestMistypedCommand(t *testing.T) {
+	for arg, want := range map[string]string{
+		"sevre":        "serve",
+		"trce":         "trace",
+		"line-hisotry": "line-history",
+		"mutex":        "",
+		"lock":         "",
+		"mutex_entr":   "",
+		"uts/comon":    "",
+	} {
+		if got := mistypedCommand(arg); got != want {
+			t.Errorf("mistypedCommand(%q) = %q, want %q", arg, got, want)
+		}
+	}
+}
+
+func TestIsImplicitQuery(t *testing.T) {
+	for arg, want := range map[string]bool{
+		"mutex_enter":            true,
+		"uts/common":             true,
+		"--max":                  false,
+		"-p":                     false,
+		"http://opengrok/source": false,
+		" ":                      false,
+	} {
+		if got := isImplicitQuery(arg); got != want {
+			t.Errorf("isImplicitQuery(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
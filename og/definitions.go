@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefinitionHit is one hit of a def search, described by what it defines
+type DefinitionHit struct {
+	Symbol    string `json:"symbol"`
+	Kind      string `json:"kind"` // e.g. "function", "struct", "macro"; "" if not recognized
+	Signature string `json:"signature"`
+	Project   string `json:"project"`
+	Path      string `json:"path"` // Path within the project
+	Line      int    `json:"line,omitempty"`
+	URL       string `json:"url"`
+	// Role tells a C/C++ function's "declaration" from its "definition"
+	// (see pairDefinitions); "" for other hits
+	Role string `json:"role,omitempty"`
+	// Labels are what a --pipe filter added to the hit
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// matchedSymbolRegex finds the term OpenGrok highlighted in a hit
+var matchedSymbolRegex = regexp.MustCompile(`<b>([^<]+)</b>`)
+
+// definitionKinds classifies definition lines, most specific first. %s is
+// replaced with the quoted symbol; the first pattern that matches wins.
+var definitionKinds = []struct {
+	kind    string
+	pattern string
+}{
+	{"macro", `^#\s*define\s+%s\b`},
+	{"typedef", `^typedef\b.*\b%s\s*(;|\[|\))`},
+	{"struct", `^(typedef\s+)?struct\s+%s\b`},
+	{"union", `^(typedef\s+)?union\s+%s\b`},
+	{"enum", `^(typedef\s+)?enum\s+(class\s+)?%s\b`},
+	{"method", `^func\s*\([^)]*\)\s*%s\s*[\[(]`},
+	{"function", `^func\s+%s\s*[\[(]`},
+	{"struct", `^type\s+%s\s+struct\b`},
+	{"interface", `^type\s+%s\s+interface\b`},
+	{"type", `^type\s+%s\b`},
+	{"class", `^((public|private|protected|abstract|final|static|export|default|data|sealed)\s+)*class\s+%s\b`},
+	{"interface", `^((public|private|protected|export|sealed)\s+)*(interface|trait|protocol)\s+%s\b`},
+	{"function", `^(async\s+)?(def|fn|function|fun)\s+%s\b`},
+	{"function", `^(pub(\([^)]*\))?\s+)?(async\s+)?(unsafe\s+)?fn\s+%s\b`},
+	{"struct", `^(pub(\([^)]*\))?\s+)?struct\s+%s\b`},
+	{"enum", `^(pub(\([^)]*\))?\s+)?enum\s+%s\b`},
+	{"interface", `^(pub(\([^)]*\))?\s+)?trait\s+%s\b`},
+	{"constant", `^((export|pub)\s+)?const\s+(\w+\s+)*%s\b`},
+	{"variable", `^((export)\s+)?(var|let)\s+%s\b`},
+	// C-like: a name followed by "(" is a function, unless the line ends
+	// with ";" (a prototype); otherwise a name followed by "=", ";" or "["
+	// is a variable
+	{"prototype", `\b%s\s*\(.*\)\s*;$`},
+	{"function", `\b%s\s*\(`},
+	{"variable", `\b%s\s*(=|;|\[|,)`},
+}
+
+// parseDefinition extracts the kind and signature of a definition from the
+// line a def search returned. The signature is the line without a trailing
+// "{" or comment.
+func parseDefinition(symbol, line string) (kind, signature string) {
+	signature = cleanSignature(line)
+	quoted := regexp.QuoteMeta(symbol)
+	for _, k := range definitionKinds {
+		re, err := regexp.Compile(strings.ReplaceAll(k.pattern, "%s", quoted))
+		if err != nil {
+			continue
+		}
+		if re.MatchString(signature) {
+			return k.kind, signature
+		}
+	}
+	return "", signature
+}
+
+// cleanSignature trims a definition line to its signature
+func cleanSignature(line string) string {
+	s := strings.TrimSpace(line)
+	// Drop a trailing line comment, but not "//" inside a string or URL
+	for _, marker := range []string{" //", "\t//", " /*", "\t/*", " #"} {
+		if i := strings.Index(s, marker); i > 0 && !strings.Contains(s[:i], `"`) {
+			s = strings.TrimSpace(s[:i])
+		}
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(s, "{"))
+	return strings.TrimSpace(strings.TrimSuffix(s, ":"))
+}
+
+// newDefinitions converts def search results into definitions. The symbol is
+// the term the server highlighted, falling back to the query.
+func newDefinitions(resp *SearchResponse, query, serverURL string) []DefinitionHit {
+	defs := []DefinitionHit{}
+	for _, r := range resp.OrderedEntries() {
+		symbol := query
+		if m := matchedSymbolRegex.FindStringSubmatch(r.Line); m != nil {
+			symbol = html.UnescapeString(m[1])
+		}
+		line := html.UnescapeString(stripHTMLTags(r.Line))
+		kind, signature := parseDefinition(symbol, line)
+		path := r.FilePath()
+		lineNo, _ := strconv.Atoi(string(r.LineNo))
+		defs = append(defs, DefinitionHit{
+			Symbol:    symbol,
+			Kind:      kind,
+			Signature: signature,
+			Project:   r.Project,
+			Path:      path,
+			Line:      lineNo,
+			URL:       xrefURL(serverURL, r.Project, path, string(r.LineNo)),
+			Labels:    r.Labels,
+		})
+	}
+	return defs
+}
+
+// maxSignatureColumn caps the column locations are aligned to, so one long
+// signature doesn't push every location off screen
+const maxSignatureColumn = 60
+
+// printDefinitions prints one definition per line, signature first:
+// symbol, kind, role (if any hit has one), signature and location, in
+// aligned columns
+func printDefinitions(w io.Writer, defs []DefinitionHit, useColor, webLinks bool, local *localPaths, previews hitPreviews) {
+	if len(defs) == 0 {
+		fmt.Fprintln(w, "No results found.")
+		return
+	}
+	symbolWidth, kindWidth, roleWidth, signatureWidth := 0, 0, 0, 0
+	for _, d := range defs {
+		symbolWidth = max(symbolWidth, displayWidth(d.Symbol))
+		kindWidth = max(kindWidth, len(definitionKindLabel(d.Kind)))
+		roleWidth = max(roleWidth, len(d.Role))
+		signatureWidth = max(signatureWidth, displayWidth(d.Signature))
+	}
+	signatureWidth = min(signatureWidth, maxSignatureColumn)
+
+	for _, d := range defs {
+		location := local.display(d.Project, d.Path)
+		if d.Line > 0 {
+			location += ":" + strconv.Itoa(d.Line)
+		}
+		symbol := d.Symbol + strings.Repeat(" ", symbolWidth-displayWidth(d.Symbol))
+		kind := fmt.Sprintf("%-*s", kindWidth, definitionKindLabel(d.Kind))
+		// The role column is only there when C/C++ functions were paired
+		if roleWidth > 0 {
+			kind += fmt.Sprintf("  %-*s", roleWidth, d.Role)
+		}
+		if useColor {
+			symbol = colorBold + symbol + colorReset
+			kind = colorCyan + kind + colorReset
+			location = colorMagenta + location + colorReset
+		}
+		if webLinks {
+			location = fmt.Sprintf("\033]8;;%s\033\\%s\033]8;;\033\\", d.URL, location)
+		}
+		signature := d.Signature + strings.Repeat(" ", max(signatureWidth-displayWidth(d.Signature), 0))
+		fmt.Fprintf(w, "%s  %s  %s  %s\n", symbol, kind, signature, location)
+		printHitLabels(w, d.Labels, useColor)
+		if previews != nil {
+			printPreview(w, previews.get(d.Project, d.Path, d.Line), useColor, resolveTheme(""))
+		}
+	}
+}
+
+// definitionKindLabel shows unrecognized kinds as "-"
+func definitionKindLabel(kind string) string {
+	if kind == "" {
+		return "-"
+	}
+	return kind
+}
+
+// writeDefinitionsJSON writes definitions and the search summary as an
+// indented JSON object
+func writeDefinitionsJSON(w io.Writer, defs []DefinitionHit, totals ResultTotals) error {
+	if defs == nil {
+		defs = []DefinitionHit{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Definitions []DefinitionHit `json:"definitions"`
+		Summary     ResultTotals    `json:"summary"`
+	}{defs, totals})
+}
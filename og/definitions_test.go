@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDefinition(t *testing.T) {
+	tests := []struct {
+		symbol, line    string
+		kind, signature string
+	}{
+		{"MAX_DEPTH", "#define MAX_DEPTH 32", "macro", "#define MAX_DEPTH 32"},
+		{"MIN", "#define\tMIN(a, b) ((a) < (b) ? (a) : (b))", "macro", "#define\tMIN(a, b) ((a) < (b) ? (a) : (b))"},
+		{"vnode", "struct vnode {", "struct", "struct vnode"},
+		{"vnode_t", "typedef struct vnode vnode_t;", "typedef", "typedef struct vnode vnode_t;"},
+		{"vtype", "enum vtype { VNON, VREG };", "enum", "enum vtype { VNON, VREG };"},
+		{"vn_open", "vn_open(char *pnamep, enum uio_seg seg, int filemode)", "function", "vn_open(char *pnamep, enum uio_seg seg, int filemode)"},
+		{"vn_open", "int vn_open(char *, enum uio_seg, int);", "prototype", "int vn_open(char *, enum uio_seg, int);"},
+		{"rootvp", "vnode_t *rootvp;\t/* root vnode */", "variable", "vnode_t *rootvp;"},
+		{"Search", "func (c *Client) Search(opts SearchOptions) (*SearchResponse, error) {", "method", "func (c *Client) Search(opts SearchOptions) (*SearchResponse, error)"},
+		{"NewClient", "func NewClient(baseURL string) (*Client, error) {", "function", "func NewClient(baseURL string) (*Client, error)"},
+		{"Client", "type Client struct {", "struct", "type Client struct"},
+		{"Source", "type Source interface {", "interface", "type Source interface"},
+		{"parse", "def parse(self, text):  # entry point", "function", "def parse(self, text)"},
+		{"Parser", "public final class Parser extends Base {", "class", "public final class Parser extends Base"},
+		{"run", "pub async fn run(cfg: &Config) -> Result<()> {", "function", "pub async fn run(cfg: &Config) -> Result<()>"},
+		{"limit", "const limit = 10", "constant", "const limit = 10"},
+		{"mystery", "mystery", "", "mystery"},
+	}
+	for _, tt := range tests {
+		kind, signature := parseDefinition(tt.symbol, tt.line)
+		if kind != tt.kind || signature != tt.signature {
+			t.Errorf("parseDefinition(%q, %q) = %q, %q; want %q, %q", tt.symbol, tt.line, kind, signature, tt.kind, tt.signature)
+		}
+	}
+}
+
+func TestPrintDefinitions(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 2,
+		Results: map[string][]SearchResult{
+			"proj": {
+				{Path: "/src/vnode.c", LineNo: "120", Line: "<b>vn_open</b>(char *pnamep, int mode)"},
+				{Path: "/include/vnode.h", LineNo: "40", Line: "struct <b>vnode</b> {"},
+			},
+		},
+	}
+	defs := newDefinitions(resp, "vn*", "http://og")
+
+	var buf bytes.Buffer
+	printDefinitions(&buf, defs, false, false, nil, nil)
+	want := "vn_open  function  vn_open(char *pnamep, int mode)  proj/src/vnode.c:120\n" +
+		"vnode    struct    struct vnode                     proj/include/vnode.h:40\n"
+	if buf.String() != want {
+		t.Errorf("printDefinitions() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := writeDefinitionsJSON(&buf, defs, ResultTotals{ShownLines: 2, FetchedLines: 2, FetchedFiles: 2, MatchingFiles: 2, ElapsedMs: 7}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Definitions []DefinitionHit `json:"definitions"`
+		Summary     map[string]any  `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if defs := decoded.Definitions; len(defs) != 2 || defs[0].Symbol != "vn_open" || defs[0].Kind != "function" ||
+		defs[0].URL != "http://og/xref/proj/src/vnode.c#120" || defs[1].Line != 40 {
+		t.Errorf("JSON = %+v", decoded)
+	}
+	if decoded.Summary["elapsed_ms"] != 7.0 || decoded.Summary["matching_files"] != 2.0 || decoded.Summary["truncated"] != false {
+		t.Errorf("summary = %v", decoded.Summary)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Roles of C/C++ function hits in def search output
+const (
+	roleDeclaration = "declaration" // A prototype
+	roleDefinition  = "definition"  // The function's body
+)
+
+// C and C++ file extensions, told apart for pairing headers with sources
+var (
+	cHeaderExts = map[string]bool{".h": true, ".hh": true, ".hpp": true, ".hxx": true, ".h++": true}
+	cSourceExts = map[string]bool{".c": true, ".cc": true, ".cpp": true, ".cxx": true, ".c++": true}
+)
+
+// maxPairLookups bounds the def searches one listing runs for declarations
+// whose implementation isn't among the hits
+const maxPairLookups = 10
+
+// pairLookupMaxFiles bounds each of those searches
+const pairLookupMaxFiles = 50
+
+// definitionRole returns whether a hit in a C or C++ file declares or
+// defines a function ("" for other hits)
+func definitionRole(d DefinitionHit) string {
+	ext := strings.ToLower(path.Ext(d.Path))
+	if !cHeaderExts[ext] && !cSourceExts[ext] {
+		return ""
+	}
+	switch d.Kind {
+	case "prototype":
+		return roleDeclaration
+	case "function":
+		return roleDefinition
+	}
+	return ""
+}
+
+// pairDefinitions labels the C/C++ function hits of a def search as
+// declarations or definitions. A prototype in a header whose function has
+// no definition among the hits of its project gets one looked up with find
+// (a def search of the symbol in the project), and the definitions found in
+// source files are listed right after it. Lookups stop at the first error,
+// which is returned with the hits labeled so far.
+func pairDefinitions(defs []DefinitionHit, find func(project, symbol string) ([]DefinitionHit, error)) ([]DefinitionHit, error) {
+	key := func(d DefinitionHit) string { return d.Project + "\x00" + d.Symbol }
+	defined := make(map[string]bool)
+	listed := make(map[string]bool)
+	for i := range defs {
+		defs[i].Role = definitionRole(defs[i])
+		if defs[i].Role == roleDefinition {
+			defined[key(defs[i])] = true
+		}
+		listed[definitionKey(defs[i].Project, defs[i].Path, strconv.Itoa(defs[i].Line))] = true
+	}
+
+	var err error
+	lookups := 0
+	paired := make([]DefinitionHit, 0, len(defs))
+	for _, d := range defs {
+		paired = append(paired, d)
+		ext := strings.ToLower(path.Ext(d.Path))
+		if d.Role != roleDeclaration || !cHeaderExts[ext] || defined[key(d)] || err != nil || lookups >= maxPairLookups {
+			continue
+		}
+		// Looked up once per function, found or not
+		defined[key(d)] = true
+		lookups++
+		var found []DefinitionHit
+		if found, err = find(d.Project, d.Symbol); err != nil {
+			continue
+		}
+		for _, f := range found {
+			id := definitionKey(f.Project, f.Path, strconv.Itoa(f.Line))
+			if f.Project != d.Project || f.Symbol != d.Symbol || !cSourceExts[strings.ToLower(path.Ext(f.Path))] ||
+				definitionRole(f) != roleDefinition || listed[id] {
+				continue
+			}
+			listed[id] = true
+			f.Role = roleDefinition
+			paired = append(paired, f)
+		}
+	}
+	return paired, err
+}
+
+// definitionFinder returns the lookup pairDefinitions runs: a def search
+// for the symbol in one project
+func definitionFinder(ctx context.Context, client *Client, serverURL string) func(project, symbol string) ([]DefinitionHit, error) {
+	return func(project, symbol string) ([]DefinitionHit, error) {
+		resp, err := client.SearchContext(ctx, SearchOptions{Def: symbol, Projects: project, MaxResults: pairLookupMaxFiles})
+		if err != nil {
+			return nil, err
+		}
+		return newDefinitions(resp, symbol, serverURL), nil
+	}
+}
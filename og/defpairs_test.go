@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPairDefinitions(t *testing.T) {
+	defs := []DefinitionHit{
+		{Symbol: "vn_open", Kind: "prototype", Project: "proj", Path: "/include/vnode.h", Line: 40, Signature: "int vn_open(char *, int);"},
+		{Symbol: "vn_rele", Kind: "prototype", Project: "proj", Path: "/include/vnode.h", Line: 41, Signature: "void vn_rele(vnode_t *);"},
+		{Symbol: "vn_rele", Kind: "function", Project: "proj", Path: "/src/vnode.c", Line: 300, Signature: "vn_rele(vnode_t *vp)"},
+		{Symbol: "vnode", Kind: "struct", Project: "proj", Path: "/include/vnode.h", Line: 10, Signature: "struct vnode"},
+		{Symbol: "Open", Kind: "function", Project: "proj", Path: "/tools/open.go", Line: 5, Signature: "func Open()"},
+	}
+	var lookups []string
+	find := func(project, symbol string) ([]DefinitionHit, error) {
+		lookups = append(lookups, project+":"+symbol)
+		return []DefinitionHit{
+			{Symbol: "vn_open", Kind: "prototype", Project: "proj", Path: "/include/vnode.h", Line: 40},
+			{Symbol: "vn_open", Kind: "function", Project: "proj", Path: "/src/vnode.c", Line: 120, Signature: "vn_open(char *pnamep, int mode)"},
+			{Symbol: "vn_open", Kind: "function", Project: "other", Path: "/src/vnode.c", Line: 99},
+		}, nil
+	}
+
+	paired, err := pairDefinitions(defs, find)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only vn_open needs a lookup: vn_rele's definition is listed already
+	if strings.Join(lookups, ",") != "proj:vn_open" {
+		t.Errorf("lookups = %v", lookups)
+	}
+	var got []string
+	for _, d := range paired {
+		got = append(got, d.Symbol+"@"+d.Path+"="+d.Role)
+	}
+	want := "vn_open@/include/vnode.h=declaration vn_open@/src/vnode.c=definition vn_rele@/include/vnode.h=declaration " +
+		"vn_rele@/src/vnode.c=definition vnode@/include/vnode.h= Open@/tools/open.go="
+	if strings.Join(got, " ") != want {
+		t.Errorf("paired = %v\nwant %s", got, want)
+	}
+
+	var buf bytes.Buffer
+	printDefinitions(&buf, paired[:2], false, false, nil, nil)
+	if want := "vn_open  prototype  declaration  int vn_open(char *, int);        proj/include/vnode.h:40\n" +
+		"vn_open  function   definition   vn_open(char *pnamep, int mode)  proj/src/vnode.c:120\n"; buf.String() != want {
+		t.Errorf("printDefinitions() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// A failed lookup leaves the declaration unpaired and stops the others
+	_, err = pairDefinitions(defs[:1], func(project, symbol string) ([]DefinitionHit, error) {
+		return nil, errors.New("server down")
+	})
+	if err == nil {
+		t.Error("lookup error not returned")
+	}
+}
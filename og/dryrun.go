@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+)
+
+// printRequest writes a GET request as it would be sent: the URL, its decoded
+// query parameters, and the authentication method
+func printRequest(w io.Writer, client *Client, requestURL string) {
+	fmt.Fprintf(w, "GET %s\n", requestURL)
+
+	if u, err := url.Parse(requestURL); err == nil && u.RawQuery != "" {
+		params := u.Query()
+		keys := make([]string, 0, len(params))
+		width := 0
+		for key := range params {
+			keys = append(keys, key)
+			if len(key) > width {
+				width = len(key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, value := range params[key] {
+				fmt.Fprintf(w, "  %-*s = %s\n", width, key, value)
+			}
+		}
+	}
+	fmt.Fprintf(w, "  Auth: %s\n", client.AuthMethod())
+}
+
+// printSearchDryRun shows the request(s) a search would send
+func printSearchDryRun(w io.Writer, client *Client, opts SearchOptions, filesOnly bool) {
+	if filesOnly {
+		opts.MaxResults = filesPageSize
+		fmt.Fprintf(w, "# First page of matching files\n")
+	}
+	printRequest(w, client, client.SearchURL(opts))
+	if filesOnly {
+		fmt.Fprintf(w, "\n# Further pages repeat the request with start=%d, %d, ... until resultCount is reached\n", filesPageSize, 2*filesPageSize)
+	}
+}
+
+// printTraceDryRun shows the requests a trace starts with. Later requests
+// depend on the callers found, so they are only described.
+func printTraceDryRun(w io.Writer, client *Client, opts TraceOptions) {
+	fmt.Fprintf(w, "# 1. Find definitions of %s\n", opts.Symbol)
+	printRequest(w, client, client.SearchURL(SearchOptions{
+		Def:        opts.Symbol,
+		Projects:   opts.Projects,
+		Type:       opts.Type,
+		MaxResults: 50,
+	}))
+
+	fmt.Fprintf(w, "\n# 2. Find direct callers of %s\n", opts.Symbol)
+	printRequest(w, client, client.SearchURL(SearchOptions{
+		Symbol:     opts.Symbol,
+		Projects:   opts.ProjectsForLevel(1),
+		Type:       opts.Type,
+		MaxResults: 50,
+	}))
+
+	depth := opts.Depth
+	if depth <= 0 {
+		depth = 2
+	}
+	if depth > 1 {
+		fmt.Fprintf(w, "\n# 3. For each caller, fetch %s/raw/<project>/<path> to find the enclosing function,\n", client.XrefBaseURL())
+		fmt.Fprintf(w, "#    then search its callers the same way, for up to %d levels", depth)
+		if len(opts.LevelProjects) > 0 {
+			fmt.Fprintf(w, " (projects per --level-projects)")
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPrintSearchDryRun(t *testing.T) {
+	client, err := NewClient("https://opengrok.example.com/source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Username = "alice"
+	client.Password = "secret"
+
+	var buf bytes.Buffer
+	printSearchDryRun(&buf, client, SearchOptions{Full: `"out of memory"`, Projects: "a,b", MaxResults: 25}, false)
+	out := buf.String()
+
+	for _, want := range []string{
+		"GET https://opengrok.example.com/source/api/v1/search?full=%22out+of+memory%22&maxresults=25&projects=a%2Cb\n",
+		`  full       = "out of memory"`,
+		"  projects   = a,b",
+		"  Auth: Basic auth (user: alice)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Error("dry run output must not reveal the password")
+	}
+}
+
+func TestPrintSearchDryRunFilesOnly(t *testing.T) {
+	client, err := NewClient("https://opengrok.example.com/source")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	printSearchDryRun(&buf, client, SearchOptions{Full: "x", MaxResults: 25}, true)
+	out := buf.String()
+	if !strings.Contains(out, "maxresults = 1000") || !strings.Contains(out, "start=1000, 2000") {
+		t.Errorf("expected paging details:\n%s", out)
+	}
+	if !strings.Contains(out, "Auth: None") {
+		t.Errorf("expected no auth:\n%s", out)
+	}
+}
+
+func TestPrintTraceDryRun(t *testing.T) {
+	client, err := NewClient("https://opengrok.example.com/source")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BearerToken = "tok"
+
+	var buf bytes.Buffer
+	printTraceDryRun(&buf, client, TraceOptions{Symbol: "probe", Depth: 3, Projects: "all", LevelProjects: []string{"drivers"}})
+	out := buf.String()
+
+	for _, want := range []string{
+		"search?def=probe&maxresults=50&projects=all",
+		"search?maxresults=50&projects=drivers&symbol=probe",
+		"for up to 3 levels (projects per --level-projects)",
+		"Auth: Bearer token",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dry run output missing %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Environment variables read when neither a flag nor the config file gives a
+// setting, so og can run in containers and scratch machines without 'og init'
+const (
+	envServer      = "OG_SERVER"
+	envUsername    = "OG_USERNAME"
+	envPassword    = "OG_PASSWORD"
+	envAPIKey      = "OG_API_KEY"
+	envBearerToken = "OG_BEARER_TOKEN"
+	envDaemon      = "OG_DAEMON"
+	envDaemonToken = "OG_DAEMON_TOKEN"
+)
+
+// globalServerURL is set by a --server given before the command
+// ("og --server <url> full <query>")
+var globalServerURL string
+
+// envAuthOptions returns the credentials set in the environment
+func envAuthOptions() AuthOptions {
+	return AuthOptions{
+		Username:    os.Getenv(envUsername),
+		Password:    os.Getenv(envPassword),
+		APIKey:      os.Getenv(envAPIKey),
+		BearerToken: os.Getenv(envBearerToken),
+	}
+}
+
+// empty reports whether no credentials are set
+func (o AuthOptions) empty() bool {
+	return o.Username == "" && o.APIKey == "" && o.BearerToken == ""
+}
+
+// extractGlobalServer removes a leading "--server <url>" (or "-s <url>",
+// "--server=<url>") from args, returning the remaining args and the URL
+func extractGlobalServer(args []string) ([]string, string) {
+	if len(args) < 2 {
+		return args, ""
+	}
+	switch arg := args[1]; {
+	case strings.HasPrefix(arg, "--server="):
+		return append(args[:1:1], args[2:]...), strings.TrimPrefix(arg, "--server=")
+	case (arg == "--server" || arg == "-s") && len(args) > 2:
+		return append(args[:1:1], args[3:]...), args[2]
+	}
+	return args, ""
+}
+
+// looksLikeServerURL reports whether a positional argument is a server URL
+// rather than part of a query
+func looksLikeServerURL(arg string) bool {
+	return strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://")
+}
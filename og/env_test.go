@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractGlobalServer(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantArgs []string
+		wantURL  string
+	}{
+		{"none", []string{"og", "full", "TODO"}, []string{"og", "full", "TODO"}, ""},
+		{"long", []string{"og", "--server", "http://h/source", "full", "TODO"}, []string{"og", "full", "TODO"}, "http://h/source"},
+		{"short", []string{"og", "-s", "http://h/source", "def", "main"}, []string{"og", "def", "main"}, "http://h/source"},
+		{"equals", []string{"og", "--server=http://h/source", "projects"}, []string{"og", "projects"}, "http://h/source"},
+		{"missing value", []string{"og", "--server"}, []string{"og", "--server"}, ""},
+		{"after command", []string{"og", "full", "--server", "http://h"}, []string{"og", "full", "--server", "http://h"}, ""},
+		{"no args", []string{"og"}, []string{"og"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, url := extractGlobalServer(tt.args)
+			if !reflect.DeepEqual(args, tt.wantArgs) || url != tt.wantURL {
+				t.Errorf("extractGlobalServer(%v) = %v, %q; want %v, %q", tt.args, args, url, tt.wantArgs, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestGetServerURLPrecedence(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(envServer, "http://env/source/")
+	defer func(old string) { globalServerURL = old }(globalServerURL)
+
+	globalServerURL = ""
+	if got := getServerURL(""); got != "http://env/source" {
+		t.Errorf("env: got %q", got)
+	}
+	globalServerURL = "http://global/source"
+	if got := getServerURL(""); got != "http://global/source" {
+		t.Errorf("global: got %q", got)
+	}
+	if got := getServerURL("http://flag/source"); got != "http://flag/source" {
+		t.Errorf("flag: got %q", got)
+	}
+}
+
+func TestEnvAuthOptions(t *testing.T) {
+	t.Setenv(envUsername, "alice")
+	t.Setenv(envPassword, "secret")
+	t.Setenv(envAPIKey, "")
+	t.Setenv(envBearerToken, "tok")
+
+	got := envAuthOptions()
+	want := AuthOptions{Username: "alice", Password: "secret", BearerToken: "tok"}
+	if got != want {
+		t.Errorf("envAuthOptions() = %+v, want %+v", got, want)
+	}
+	if got.empty() {
+		t.Error("expected options from environment to be non-empty")
+	}
+	if !(AuthOptions{Password: "orphan"}).empty() {
+		t.Error("a password without a username should count as empty")
+	}
+}
+
+func TestLooksLikeServerURL(t *testing.T) {
+	for arg, want := range map[string]bool{
+		"http://opengrok/source":  true,
+		"https://opengrok/source": true,
+		"TODO":                    false,
+		"--projects":              false,
+	} {
+		if got := looksLikeServerURL(arg); got != want {
+			t.Errorf("looksLikeServerURL(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "context"
+
+// excludeDefsMaxFiles bounds the def search run by --exclude-defs; a symbol
+// is rarely defined in more files than this
+const excludeDefsMaxFiles = 200
+
+// definitionKey identifies a line of a file for --exclude-defs
+func definitionKey(project, path, lineNo string) string {
+	return project + "\x00" + path + "\x00" + lineNo
+}
+
+// excludeDefsOptions turns the options of a symbol search into those of the
+// def search finding the symbol's definitions, with the same filters
+func excludeDefsOptions(opts SearchOptions) SearchOptions {
+	opts.Def, opts.Symbol = opts.Symbol, ""
+	opts.MaxResults = excludeDefsMaxFiles
+	opts.Start = 0
+	return opts
+}
+
+// definitionLines runs the def search matching the symbol search opts and
+// returns the lines defining the symbol, keyed by definitionKey
+func definitionLines(ctx context.Context, client *Client, opts SearchOptions) (map[string]bool, error) {
+	resp, err := client.SearchContext(ctx, excludeDefsOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+	lines := make(map[string]bool)
+	for _, r := range resp.OrderedEntries() {
+		lines[definitionKey(r.Project, r.FilePath(), string(r.LineNo))] = true
+	}
+	return lines, nil
+}
+
+// FilterDefinitions drops the hits of a symbol search on the lines defining
+// the symbol, leaving its references, and returns the number of hits dropped
+func FilterDefinitions(resp *SearchResponse, definitions map[string]bool) int {
+	entries := resp.OrderedEntries()
+	kept := make([]ResultEntry, 0, len(entries))
+	results := make(map[string][]SearchResult)
+	for _, r := range entries {
+		if definitions[definitionKey(r.Project, r.FilePath(), string(r.LineNo))] {
+			continue
+		}
+		kept = append(kept, r)
+		results[r.Project] = append(results[r.Project], r.SearchResult)
+	}
+	dropped := len(entries) - len(kept)
+	if dropped > 0 {
+		resp.Entries = kept
+		resp.Results = results
+		resp.ResultCount = countResultFiles(kept)
+	}
+	return dropped
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFilterDefinitions(t *testing.T) {
+	var query map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		query = map[string]string{"def": q.Get("def"), "symbol": q.Get("symbol"), "projects": q.Get("projects"), "maxresults": q.Get("maxresults")}
+		w.Write([]byte(`{"resultCount":2,"results":{` +
+			`"/proj/uts/vnode.c":[{"line":"<b>vn_rele</b>(vnode_t *vp)","lineNo":"120"}],` +
+			`"/proj/uts/vnode.h":[{"line":"extern void <b>vn_rele</b>(vnode_t *);","lineNo":"30"}]}}`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	definitions, err := definitionLines(context.Background(), client, SearchOptions{Symbol: "vn_rele", Projects: "proj", MaxResults: 25, Start: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query["def"] != "vn_rele" || query["symbol"] != "" || query["projects"] != "proj" || query["maxresults"] != "200" {
+		t.Errorf("def search query = %v", query)
+	}
+	if len(definitions) != 2 {
+		t.Fatalf("definitions = %v, want 2 lines", definitions)
+	}
+
+	resp := &SearchResponse{
+		ResultCount: 3,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/vnode.c", LineNo: "120", Line: "vn_rele(vnode_t *vp)"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/vnode.c", LineNo: "300", Line: "\tvn_rele(vp);"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/vnode.h", LineNo: "30", Line: "extern void vn_rele(vnode_t *);"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/fs.c", LineNo: "120", Line: "\tvn_rele(dvp);"}},
+		},
+	}
+	if dropped := FilterDefinitions(resp, definitions); dropped != 2 {
+		t.Errorf("dropped = %d, want 2", dropped)
+	}
+	if len(resp.Entries) != 2 || resp.Entries[0].LineNo != "300" || resp.Entries[1].Path != "/uts/fs.c" {
+		t.Errorf("entries = %+v, want the references in vnode.c and fs.c", resp.Entries)
+	}
+	if resp.ResultCount != 2 {
+		t.Errorf("result count = %d, want 2 files", resp.ResultCount)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2/lexers"
+)
+
+// XrefPart is a run of source text, linked when URL is set
+type XrefPart struct {
+	Text string
+	URL  string
+}
+
+// XrefLine is one source line of an xref page
+type XrefLine struct {
+	Number int
+	Parts  []XrefPart
+}
+
+// Text returns the line without links
+func (l XrefLine) Text() string {
+	var b strings.Builder
+	for _, p := range l.Parts {
+		b.WriteString(p.Text)
+	}
+	return b.String()
+}
+
+// xrefTagRegex matches the tags of an xref page's source block
+var xrefTagRegex = regexp.MustCompile(`<(/?)([a-zA-Z]+)([^>]*)>`)
+
+// xrefAttrRegex matches one attribute of a tag
+var xrefAttrRegex = regexp.MustCompile(`([a-zA-Z-]+)\s*=\s*"([^"]*)"`)
+
+// xrefSource returns the HTML inside the page's source <pre> block: the one
+// with id="src" (on the <pre> itself or a wrapping <div>), else the first
+func xrefSource(page string) (string, error) {
+	start := 0
+	if i := strings.Index(page, `id="src"`); i >= 0 {
+		start = strings.LastIndex(page[:i], "<")
+	}
+	i := strings.Index(page[start:], "<pre")
+	if i < 0 {
+		return "", fmt.Errorf("no source block in xref page")
+	}
+	start += i
+	open := strings.Index(page[start:], ">")
+	if open < 0 {
+		return "", fmt.Errorf("no source block in xref page")
+	}
+	start += open + 1
+	end := strings.Index(page[start:], "</pre>")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated source block in xref page")
+	}
+	return page[start : start+end], nil
+}
+
+// parseXref splits an xref page into source lines, keeping the links OpenGrok
+// put on symbols. Link targets are resolved against pageURL, the URL the
+// page was fetched from. Line number anchors are dropped.
+func parseXref(page, pageURL string) ([]XrefLine, error) {
+	source, err := xrefSource(page)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []XrefLine{{Number: 1}}
+	link := ""           // URL of the <a> being read
+	var anchors []string // Open <a> tags: their URL, or "-" for line numbers
+	addText := func(text string) {
+		for i, segment := range strings.Split(html.UnescapeString(text), "\n") {
+			if i > 0 {
+				lines = append(lines, XrefLine{Number: len(lines) + 1})
+			}
+			if segment == "" || (len(anchors) > 0 && anchors[len(anchors)-1] == "-") {
+				continue
+			}
+			cur := &lines[len(lines)-1]
+			if n := len(cur.Parts); n > 0 && cur.Parts[n-1].URL == link {
+				cur.Parts[n-1].Text += segment
+			} else {
+				cur.Parts = append(cur.Parts, XrefPart{Text: segment, URL: link})
+			}
+		}
+	}
+
+	pos := 0
+	for _, m := range xrefTagRegex.FindAllStringSubmatchIndex(source, -1) {
+		addText(source[pos:m[0]])
+		pos = m[1]
+		if strings.ToLower(source[m[4]:m[5]]) != "a" {
+			continue
+		}
+		if source[m[2]:m[3]] == "/" {
+			if len(anchors) > 0 {
+				anchors = anchors[:len(anchors)-1]
+			}
+		} else if !strings.HasSuffix(source[m[6]:m[7]], "/") {
+			anchors = append(anchors, xrefLinkTarget(source[m[6]:m[7]], base))
+		}
+		link = ""
+		for i := len(anchors) - 1; i >= 0; i-- {
+			if anchors[i] != "-" {
+				link = anchors[i]
+				break
+			}
+		}
+	}
+	addText(source[pos:])
+
+	// The block ends with the last line's newline
+	if last := lines[len(lines)-1]; len(lines) > 1 && len(last.Parts) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, nil
+}
+
+// xrefLinkTarget returns the absolute URL of an <a> tag's href, "" if it has
+// none, or "-" for the line number anchors whose text is not source
+func xrefLinkTarget(attrs string, base *url.URL) string {
+	var href, class string
+	for _, a := range xrefAttrRegex.FindAllStringSubmatch(attrs, -1) {
+		switch strings.ToLower(a[1]) {
+		case "href":
+			href = html.UnescapeString(a[2])
+		case "class":
+			class = a[2]
+		}
+	}
+	for _, c := range strings.Fields(class) {
+		if c == "l" || c == "hl" {
+			return "-"
+		}
+	}
+	if href == "" {
+		return ""
+	}
+	ref, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(ref).String()
+}
+
+// xrefLineRange selects lines from..to (inclusive, 0 for no bound)
+func xrefLineRange(lines []XrefLine, from, to int) []XrefLine {
+	var selected []XrefLine
+	for _, l := range lines {
+		if l.Number >= from && (to == 0 || l.Number <= to) {
+			selected = append(selected, l)
+		}
+	}
+	return selected
+}
+
+// parseLineRange parses "N", "N-M", "N-" or "-M"
+func parseLineRange(s string) (from, to int, err error) {
+	if s == "" {
+		return 0, 0, nil
+	}
+	fromStr, toStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		toStr = fromStr
+	}
+	if fromStr != "" {
+		if from, err = strconv.Atoi(fromStr); err != nil || from < 1 {
+			return 0, 0, fmt.Errorf("invalid line range %q", s)
+		}
+	}
+	if toStr != "" {
+		if to, err = strconv.Atoi(toStr); err != nil || to < 1 {
+			return 0, 0, fmt.Errorf("invalid line range %q", s)
+		}
+	}
+	if to != 0 && to < from {
+		return 0, 0, fmt.Errorf("invalid line range %q: end before start", s)
+	}
+	return from, to, nil
+}
+
+// markdownFence returns a code fence longer than any backtick run in the
+// lines, so the excerpt can't close it early
+func markdownFence(lines []XrefLine) string {
+	longest := 0
+	for _, l := range lines {
+		run := 0
+		for _, r := range l.Text() {
+			if r == '`' {
+				run++
+				longest = max(longest, run)
+			} else {
+				run = 0
+			}
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// markdownLanguage returns the code fence language for a file name
+func markdownLanguage(filename string) string {
+	lexer := lexers.Match(path.Base(filename))
+	if lexer == nil || len(lexer.Config().Aliases) == 0 {
+		return ""
+	}
+	return lexer.Config().Aliases[0]
+}
+
+// writeXrefMarkdown writes lines as a Markdown excerpt: a heading linking to
+// the file, the code in a fenced block, and the symbol links found in it,
+// each with the lines it appears on
+func writeXrefMarkdown(w io.Writer, serverURL, filePath string, lines []XrefLine, lineNumbers bool) {
+	name := strings.TrimPrefix(filePath, "/")
+	heading := xrefURL(serverURL, "", filePath, "")
+	if len(lines) > 0 {
+		first, last := lines[0].Number, lines[len(lines)-1].Number
+		name += fmt.Sprintf(":%d-%d", first, last)
+		heading = xrefURL(serverURL, "", filePath, strconv.Itoa(first))
+	}
+	fmt.Fprintf(w, "[`%s`](%s)\n\n", name, heading)
+
+	fence := markdownFence(lines)
+	fmt.Fprintf(w, "%s%s\n", fence, markdownLanguage(filePath))
+	width := 0
+	if len(lines) > 0 {
+		width = len(strconv.Itoa(lines[len(lines)-1].Number))
+	}
+	for _, l := range lines {
+		if lineNumbers {
+			fmt.Fprintf(w, "%*d  %s\n", width, l.Number, l.Text())
+		} else {
+			fmt.Fprintln(w, l.Text())
+		}
+	}
+	fmt.Fprintln(w, fence)
+
+	// Links in the order they first appear, with every line they are on
+	type symbolLink struct {
+		text, url string
+		lines     []string
+	}
+	var links []*symbolLink
+	seen := make(map[string]*symbolLink)
+	for _, l := range lines {
+		for _, p := range l.Parts {
+			text := strings.TrimSpace(p.Text)
+			if p.URL == "" || text == "" {
+				continue
+			}
+			key := text + "\x00" + p.URL
+			link := seen[key]
+			if link == nil {
+				link = &symbolLink{text: text, url: p.URL}
+				seen[key] = link
+				links = append(links, link)
+			}
+			number := strconv.Itoa(l.Number)
+			if n := len(link.lines); n == 0 || link.lines[n-1] != number {
+				link.lines = append(link.lines, number)
+			}
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	for _, link := range links {
+		label := "line"
+		if len(link.lines) > 1 {
+			label = "lines"
+		}
+		fmt.Fprintf(w, "- [`%s`](%s) (%s %s)\n", strings.ReplaceAll(link.text, "`", ""), link.url, label, strings.Join(link.lines, ", "))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testXrefPage = `<html><body><div id="src" data-navigate-window-enabled="false">
+<pre><a class="l" name="1" href="#1">1</a><b>int</b>
+<a class="hl" name="2" href="#2">2</a><a class="xf" name="vn_open"/><a href="/source/s?refs=vn_open&amp;project=proj" class="xf intelliWindow-symbol" data-definition-place="def">vn_open</a>(<b>char</b> *<a class="xa" name="pnamep"/><a href="/source/s?refs=pnamep&amp;project=proj" class="xa intelliWindow-symbol">pnamep</a>)
+<a class="l" name="3" href="#3">3</a>{
+<a class="l" name="4" href="#4">4</a>	<b>return</b> <a href="/source/s?defs=lookup&amp;project=proj" class="intelliWindow-symbol" data-definition-place="undefined-in-file">lookup</a>(<a href="#pnamep" class="intelliWindow-symbol">pnamep</a>) &lt; 0;
+<a class="l" name="5" href="#5">5</a>}
+</pre></div></body></html>`
+
+func TestParseXref(t *testing.T) {
+	lines, err := parseXref(testXrefPage, "http://og/source/xref/proj/src/vnode.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"int", "vn_open(char *pnamep)", "{", "\treturn lookup(pnamep) < 0;", "}"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i, l := range lines {
+		if l.Number != i+1 || l.Text() != want[i] {
+			t.Errorf("line %d = %d %q, want %q", i, l.Number, l.Text(), want[i])
+		}
+	}
+	if p := lines[1].Parts[0]; p.Text != "vn_open" || p.URL != "http://og/source/s?refs=vn_open&project=proj" {
+		t.Errorf("vn_open link = %+v", p)
+	}
+	if p := lines[3].Parts[3]; p.Text != "pnamep" || p.URL != "http://og/source/xref/proj/src/vnode.c#pnamep" {
+		t.Errorf("in-page link = %+v", p)
+	}
+}
+
+func TestWriteXrefMarkdown(t *testing.T) {
+	lines, err := parseXref(testXrefPage, "http://og/source/xref/proj/src/vnode.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeXrefMarkdown(&buf, "http://og/source", "/proj/src/vnode.c", xrefLineRange(lines, 2, 4), true)
+	want := "[`proj/src/vnode.c:2-4`](http://og/source/xref/proj/src/vnode.c#2)\n\n" +
+		"```c\n" +
+		"2  vn_open(char *pnamep)\n" +
+		"3  {\n" +
+		"4  \treturn lookup(pnamep) < 0;\n" +
+		"```\n\n" +
+		"- [`vn_open`](http://og/source/s?refs=vn_open&project=proj) (line 2)\n" +
+		"- [`pnamep`](http://og/source/s?refs=pnamep&project=proj) (line 2)\n" +
+		"- [`lookup`](http://og/source/s?defs=lookup&project=proj) (line 4)\n" +
+		"- [`pnamep`](http://og/source/xref/proj/src/vnode.c#pnamep) (line 4)\n"
+	if buf.String() != want {
+		t.Errorf("writeXrefMarkdown() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		in       string
+		from, to int
+		ok       bool
+	}{
+		{"", 0, 0, true},
+		{"12", 12, 12, true},
+		{"10-20", 10, 20, true},
+		{"10-", 10, 0, true},
+		{"-20", 0, 20, true},
+		{"20-10", 0, 0, false},
+		{"a-b", 0, 0, false},
+		{"0", 0, 0, false},
+	}
+	for _, tt := range tests {
+		from, to, err := parseLineRange(tt.in)
+		if (err == nil) != tt.ok || from != tt.from || to != tt.to {
+			t.Errorf("parseLineRange(%q) = %d, %d, %v", tt.in, from, to, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// genreDescriptions explains the genres OpenGrok indexes files as
+var genreDescriptions = map[string]string{
+	"PLAIN":    "plain text",
+	"XREFABLE": "source code with cross-references",
+	"HTML":     "HTML",
+	"IMAGE":    "image",
+	"DATA":     "binary data, not searchable as text",
+}
+
+// FileRevision is the newest commit in the history OpenGrok has for a file
+type FileRevision struct {
+	Revision string `json:"revision"`
+	Date     string `json:"date"` // YYYY-MM-DD
+	Author   string `json:"author,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+}
+
+// FileInfo is the metadata OpenGrok keeps for one indexed file
+type FileInfo struct {
+	Path  string `json:"path"` // "/project/path"
+	Genre string `json:"genre"`
+	Size  int64  `json:"size"` // Bytes
+	// Modified is the file's modification time on the server, nil if the
+	// server doesn't send it
+	Modified *time.Time `json:"modified,omitempty"`
+	// Revision is nil when the file has no history; see HistoryError
+	Revision     *FileRevision `json:"revision,omitempty"`
+	HistoryError string        `json:"historyError,omitempty"`
+}
+
+// CollectFileInfo fetches a file's genre, size and last revision. The genre
+// comes from the file's index document, so a file missing from the index
+// fails. History is disabled on some servers and for some repositories, so
+// failing to read it is reported in the info instead. Steps are shown as
+// subtasks of task, which may be nil.
+func CollectFileInfo(ctx context.Context, client *Client, filePath string, task *ProgressTask) (*FileInfo, error) {
+	step := task.Start("reading the index")
+	genre, err := client.GetFileGenreContext(ctx, filePath)
+	step.Done()
+	if err != nil {
+		return nil, err
+	}
+	info := &FileInfo{Path: filePath, Genre: genre}
+
+	step = task.Start("measuring the file")
+	size, modified, err := client.GetFileSizeContext(ctx, filePath)
+	step.Done()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	info.Size = size
+	if !modified.IsZero() {
+		info.Modified = &modified
+	}
+
+	step = task.Start("reading history")
+	defer step.Done()
+	entries, err := client.GetHistoryContext(ctx, filePath, 1)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return nil, err
+	case err != nil:
+		info.HistoryError = err.Error()
+	case len(entries) == 0:
+		info.HistoryError = "no history"
+	default:
+		e := entries[0]
+		info.Revision = &FileRevision{Revision: e.Revision, Date: e.Day(), Author: e.Author, Summary: e.Summary()}
+	}
+	return info, nil
+}
+
+// printFileInfo prints the info as labeled lines
+func printFileInfo(w io.Writer, info *FileInfo, useColor bool) {
+	name := strings.TrimPrefix(info.Path, "/")
+	if useColor {
+		name = colorMagenta + name + colorReset
+	}
+	fmt.Fprintln(w, name)
+
+	genre := info.Genre
+	if desc := genreDescriptions[genre]; desc != "" {
+		genre += " (" + desc + ")"
+	}
+	fmt.Fprintf(w, "  genre:     %s\n", genre)
+	fmt.Fprintf(w, "  size:      %d bytes\n", info.Size)
+	if info.Modified != nil {
+		fmt.Fprintf(w, "  modified:  %s\n", info.Modified.UTC().Format("2006-01-02 15:04:05 UTC"))
+	}
+	if info.Revision == nil {
+		fmt.Fprintf(w, "  revision:  (unavailable: %s)\n", info.HistoryError)
+		return
+	}
+	r := info.Revision
+	revision := r.Revision
+	if useColor {
+		revision = colorCyan + revision + colorReset
+	}
+	details := []string{revision, r.Date}
+	for _, d := range []string{r.Author, r.Summary} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	fmt.Fprintf(w, "  revision:  %s\n", strings.Join(details, "  "))
+}
+
+// writeFileInfoJSON writes the info as indented JSON
+func writeFileInfoJSON(w io.Writer, info *FileInfo) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCollectFileInfo(t *testing.T) {
+	modified := time.Date(2026, 10, 1, 9, 12, 44, 0, time.UTC)
+	history, chunked := true, false
+	var rawGets int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/file/genre" && r.URL.Query().Get("path") == "/proj/src/a.c":
+			w.Write([]byte("XREFABLE"))
+		case r.URL.Path == "/raw/proj/src/a.c":
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			if r.Method == "GET" {
+				rawGets++
+			}
+			if chunked {
+				// No Content-Length
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte("int main(void) {}\n"))
+		case r.URL.Path == "/api/v1/history" && history:
+			json.NewEncoder(w).Encode(map[string]any{"entries": []map[string]any{
+				{"revision": "4f1c2a9e", "date": 1727690400000, "author": "alice", "message": "Fix panic message\n\nDetails"},
+			}})
+		case r.URL.Path == "/api/v1/history":
+			http.Error(w, "history disabled", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := CollectFileInfo(context.Background(), client, "/proj/src/a.c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Genre != "XREFABLE" || info.Size != 18 || info.Modified == nil || !info.Modified.Equal(modified) || info.Revision == nil {
+		t.Fatalf("info = %+v", info)
+	}
+	if rawGets != 0 {
+		t.Errorf("file downloaded %d times to measure it", rawGets)
+	}
+
+	var buf bytes.Buffer
+	printFileInfo(&buf, info, false)
+	want := "proj/src/a.c\n" +
+		"  genre:     XREFABLE (source code with cross-references)\n" +
+		"  size:      18 bytes\n" +
+		"  modified:  2026-10-01 09:12:44 UTC\n" +
+		"  revision:  4f1c2a9e  2024-09-30  alice  Fix panic message\n"
+	if buf.String() != want {
+		t.Errorf("printFileInfo() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Without a Content-Length the file is read
+	chunked = true
+	info, err = CollectFileInfo(context.Background(), client, "/proj/src/a.c", nil)
+	if err != nil || info.Size != 18 || rawGets != 1 {
+		t.Errorf("without Content-Length: info = %+v, err = %v, %d downloads", info, err, rawGets)
+	}
+	chunked = false
+
+	// History is optional
+	history = false
+	info, err = CollectFileInfo(context.Background(), client, "/proj/src/a.c", nil)
+	if err != nil || info.Revision != nil || info.HistoryError == "" {
+		t.Errorf("without history: info = %+v, err = %v", info, err)
+	}
+
+	// A file the index doesn't have
+	if _, err := CollectFileInfo(context.Background(), client, "/proj/gone.c", nil); !errors.Is(err, ErrNotIndexed) {
+		t.Errorf("missing file: err = %v, want ErrNotIndexed", err)
+	}
+}
@@ -3,14 +3,17 @@ module og
 go 1.21
 
 require (
+	github.com/alecthomas/chroma/v2 v2.14.0
 	github.com/briandowns/spinner v1.23.1
 	github.com/spf13/pflag v1.0.10
+	golang.org/x/crypto v0.26.0
+	golang.org/x/sys v0.25.0
+	golang.org/x/term v0.23.0
 )
 
 require (
+	github.com/dlclark/regexp2 v1.11.0 // indirect
 	github.com/fatih/color v1.18.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	golang.org/x/sys v0.25.0 // indirect
-	golang.org/x/term v0.22.0 // indirect
 )
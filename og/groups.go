@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// groupPrefix marks a project group reference in a project list (e.g. "@kernel")
+const groupPrefix = "@"
+
+// validateGroupName checks that name can be stored and referenced as a group
+func validateGroupName(name string) error {
+	if name == "" {
+		return fmt.Errorf("group name must not be empty")
+	}
+	if strings.HasPrefix(name, groupPrefix) {
+		return fmt.Errorf("group name %q must not start with %s", name, groupPrefix)
+	}
+	if strings.ContainsAny(name, ", \t") || name == "*" {
+		return fmt.Errorf("invalid group name %q", name)
+	}
+	return nil
+}
+
+// splitProjectList splits a comma-separated project list, dropping empty items
+func splitProjectList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// expandProjects replaces "@name" references in a comma-separated project
+// list with the members of that group. Groups may reference other groups.
+// Duplicates are removed, keeping the first occurrence.
+func expandProjects(list string, groups map[string][]string) (string, error) {
+	if !strings.Contains(list, groupPrefix) {
+		return list, nil
+	}
+
+	var expanded []string
+	seen := make(map[string]bool)
+	var expand func(items []string, path []string) error
+	expand = func(items []string, path []string) error {
+		for _, item := range items {
+			if !strings.HasPrefix(item, groupPrefix) {
+				if !seen[item] {
+					seen[item] = true
+					expanded = append(expanded, item)
+				}
+				continue
+			}
+
+			name := strings.TrimPrefix(item, groupPrefix)
+			for _, p := range path {
+				if p == name {
+					return fmt.Errorf("project group %s%s references itself (%s)", groupPrefix, name, strings.Join(append(path, name), " -> "))
+				}
+			}
+			members, ok := groups[name]
+			if !ok {
+				return unknownGroupError(name, groups)
+			}
+			if err := expand(members, append(path, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := expand(splitProjectList(list), nil); err != nil {
+		return "", err
+	}
+	return strings.Join(expanded, ","), nil
+}
+
+// expandLevelProjects expands group references in each --level-projects entry,
+// leaving "*" (all projects) as is
+func expandLevelProjects(levels []string, groups map[string][]string) ([]string, error) {
+	var expanded []string
+	for _, level := range levels {
+		if strings.TrimSpace(level) == "*" {
+			expanded = append(expanded, level)
+			continue
+		}
+		projects, err := expandProjects(level, groups)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, projects)
+	}
+	return expanded, nil
+}
+
+// unknownGroupError lists the defined groups to help fix a typo
+func unknownGroupError(name string, groups map[string][]string) error {
+	if len(groups) == 0 {
+		return fmt.Errorf("unknown project group %s%s (no groups defined; see 'og config group')", groupPrefix, name)
+	}
+	return fmt.Errorf("unknown project group %s%s (defined: %s)", groupPrefix, name, strings.Join(groupNames(groups), ", "))
+}
+
+// groupNames returns the group names in sorted order
+func groupNames(groups map[string][]string) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadProjectGroups returns the project groups from the config file
+func loadProjectGroups() map[string][]string {
+	if cfg, _ := LoadConfig(); cfg != nil {
+		return cfg.ProjectGroups
+	}
+	return nil
+}
+
+// resolveProjects expands group references in a --projects value, then
+// patterns against the projects of client's server, exiting with an error
+// if a group is unknown or a pattern doesn't fit
+func resolveProjects(list string, client *Client) string {
+	expanded, err := expandProjects(list, loadProjectGroups())
+	if err == nil {
+		expanded, err = expandProjectPatterns(expanded, cachedProjects(client))
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	return expanded
+}
+
+// resolveLevelProjects is resolveProjects for --level-projects values
+func resolveLevelProjects(levels []string, client *Client) []string {
+	expanded, err := expandLevelProjects(levels, loadProjectGroups())
+	if err == nil {
+		expanded, err = expandLevelProjectPatterns(expanded, cachedProjects(client))
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	return expanded
+}
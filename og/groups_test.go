@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandProjects(t *testing.T) {
+	groups := map[string][]string{
+		"kernel":  {"illumos-gate", "smartos-live"},
+		"drivers": {"nvme", "@kernel"},
+		"loop":    {"a", "@loop2"},
+		"loop2":   {"@loop"},
+	}
+
+	tests := []struct {
+		name     string
+		list     string
+		expected string
+		errText  string
+	}{
+		{"no groups", "proj1,proj2", "proj1,proj2", ""},
+		{"empty", "", "", ""},
+		{"single group", "@kernel", "illumos-gate,smartos-live", ""},
+		{"group and project", "extra, @kernel", "extra,illumos-gate,smartos-live", ""},
+		{"nested group", "@drivers", "nvme,illumos-gate,smartos-live", ""},
+		{"duplicates removed", "smartos-live,@drivers", "smartos-live,nvme,illumos-gate", ""},
+		{"unknown group", "@nope", "", "unknown project group @nope (defined: drivers, kernel, loop, loop2)"},
+		{"cycle", "@loop", "", "references itself (loop -> loop2 -> loop)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandProjects(tt.list, groups)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("expected error containing %q, got %v", tt.errText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expandProjects(%q) = %q, want %q", tt.list, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandLevelProjects(t *testing.T) {
+	groups := map[string][]string{"kernel": {"illumos-gate", "smartos-live"}}
+	got, err := expandLevelProjects([]string{"@kernel", "*", "other"}, groups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"illumos-gate,smartos-live", "*", "other"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandLevelProjects() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateGroupName(t *testing.T) {
+	for _, name := range []string{"kernel", "my-group", "g1"} {
+		if err := validateGroupName(name); err != nil {
+			t.Errorf("validateGroupName(%q) unexpected error: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "@kernel", "a,b", "a b", "*"} {
+		if err := validateGroupName(name); err == nil {
+			t.Errorf("validateGroupName(%q) expected error", name)
+		}
+	}
+}
@@ -0,0 +1,877 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// commandHelp describes one command for 'og help', the usage summary and the
+// generated man page
+type commandHelp struct {
+	Name        string   // Command words, e.g. "trace" or "config group"
+	Args        string   // Positional arguments, e.g. "<symbol>"
+	Summary     string   // One line for the command list
+	Description string   // Paragraphs separated by blank lines
+	Options     []string // Option group names, see optionGroups
+	Examples    []string // Command lines without the program name
+}
+
+// optionHelp describes one flag
+type optionHelp struct {
+	Short string // Single letter, or "" if there is none
+	Long  string
+	Arg   string // Value placeholder, or "" for a boolean flag
+	Text  string
+}
+
+// optionGroup is a set of flags that several commands share
+type optionGroup struct {
+	Name    string
+	Title   string
+	Options []optionHelp
+}
+
+// helpTopic is a help page that is not a command
+type helpTopic struct {
+	Name    string
+	Summary string
+	Text    string
+}
+
+var optionGroups = []optionGroup{
+	{"server", "Server Options", []optionHelp{
+		{"s", "server", "url", "OpenGrok server URL (overrides config and OG_SERVER)"},
+		{"q", "quiet", "", "Suppress progress output (spinners)"},
+	}},
+	{"search", "Search Options", []optionHelp{
+		{"p", "projects", "list", "Comma-separated projects to search (@name for a group, linux-* for a pattern)"},
+		{"t", "type", "ext", "File type filter"},
+		{"", "path", "pattern", "Restrict any search to matching file paths"},
+		{"", "path-glob", "glob", "Keep hits in files matching a glob, ** for any directories (repeatable)"},
+		{"", "changed-since", "date", "Only hits in files last changed on or after a date"},
+		{"m", "max", "n", "Maximum number of files to fetch (default: 25)"},
+		{"", "max-files", "n", "Same as --max"},
+		{"", "max-lines", "n", "Maximum number of line hits to print"},
+		{"", "max-line-width", "n", "Cut hit lines to n columns around the match (default: terminal)"},
+		{"", "wrap", "", "Wrap long hit lines instead of cutting them"},
+		{"", "page", "n", "Show the nth page of matching files"},
+		{"", "per-page", "n", "Matching files per page (default: 25)"},
+		{"", "sort", "order", "Sort results: path, lastmod (newest first, from file history), or relevance"},
+		{"", "phrase", "", "Match the query as an exact phrase"},
+		{"", "and", "term", "Require an additional term (repeatable)"},
+		{"", "or", "term", "Accept an alternative term (repeatable)"},
+		{"", "not", "term", "Exclude hits matching a term (repeatable)"},
+		{"i", "ignore-case", "", "Match regardless of case, also in def and symbol searches"},
+		{"", "case-sensitive", "", "Match case exactly, also in full, path and hist searches"},
+		{"S", "smart-case", "", "Match case exactly only if the query has an uppercase letter"},
+		{"", "exclude-defs", "", "symbol: leave out the symbol's definitions, keeping only references"},
+		{"", "tree", "", "Show matching files as a directory tree"},
+		{"l", "files-with-matches", "", "Stream matching file paths across all pages"},
+		{"", "all", "", "Fetch every matching file, spooling results to disk when they outgrow memory"},
+		{"", "count", "", "Only count matching files and lines per project, as a histogram"},
+		{"", "local-paths", "", "Show paths in local checkouts (see config local)"},
+		{"", "template", "tmpl", "Format each result with a Go template ({{.Path}}, {{.LineNo}}, ...)"},
+		{"", "save-results", "file", "Save the fetched results as JSON for diff-results"},
+		{"", "web", "", "Open results in system web browser"},
+		{"w", "web-links", "", "Display clickable OpenGrok URLs for file references"},
+		{"N", "numbered", "", "Print one numbered line per hit (see open-last)"},
+		{"", "preview", "", "Show the source around the first hits, hit line marked"},
+		{"", "preview-hits", "n", "Number of hits to preview (default: 5)"},
+		{"", "preview-lines", "n", "Lines of source either side of a previewed hit (default: 3)"},
+		{"", "json", "", "Print hits as JSON with the byte span of each match, and a result summary (def: definitions)"},
+		{"", "pipe", "cmd", "Collect the hits, pass them as one JSON document through a shell command and show the hits (and labels) it returns when it exits"},
+		{"", "open", "n", "Open the nth result in the browser"},
+		{"", "edit", "", "With --open, open the result in $EDITOR instead"},
+		{"", "dry-run", "", "Print the HTTP requests without sending them"},
+	}},
+	{"annotate-hits", "Annotation Options", []optionHelp{
+		{"", "annotate", "text", "Save this note with og_annotate on every line hit shown"},
+		{"", "annotate-tag", "tag", "Tag the notes (repeatable)"},
+		{"", "annotate-author", "name", "Author of the notes (default: $USER)"},
+		{"", "annotations", "dir", "og_annotate storage directory (overrides config)"},
+		{"", "annotate-bin", "path", "og_annotate binary (default: og_annotate on the PATH)"},
+	}},
+	{"replace", "Replace Preview Options", []optionHelp{
+		{"", "replace", "regex", "Show the diff of replacing regex on the hit lines in local checkouts"},
+		{"", "replace-with", "text", "Replacement text ($1 or ${name} for submatches)"},
+	}},
+	{"hist", "History Options", []optionHelp{
+		{"", "after", "date", "Only commits on or after a date (YYYY-MM-DD, \"2 weeks ago\")"},
+		{"", "before", "date", "Only commits on or before a date (YYYY-MM-DD, yesterday)"},
+		{"", "author", "name", "Only commits whose author contains this text"},
+	}},
+	{"trace", "Trace Options", []optionHelp{
+		{"p", "projects", "list", "Comma-separated projects to search (@name for a group, linux-* for a pattern)"},
+		{"t", "type", "ext", "File type filter"},
+		{"d", "depth", "n", "Maximum traversal depth (default: 2)"},
+		{"", "max-total", "n", "Maximum total nodes to explore (default: 100)"},
+		{"", "total-timeout", "dur", "Stop after this long (e.g. 2m) and show the tree so far"},
+		{"", "level-projects", "list", "Projects for each BFS level in turn, \"*\" for all (repeatable)"},
+		{"", "def-path", "path", "Pick the definition to trace when a symbol has several"},
+		{"", "alias", "old=new", "Also follow callers of an alias name (repeatable)"},
+		{"", "exclude", "pattern", "Leave out call sites in matching files (repeatable)"},
+		{"", "no-default-excludes", "", "Include call sites in test and generated code"},
+		{"", "same-project-only", "", "Never follow callers into another project"},
+		{"", "root-from-file", "path", "Count the callers of every function in a file (project/path)"},
+		{"", "callers-of-file", "path", "List the files calling the exported functions of a file (project/path)"},
+		{"", "save", "file", "Save the trace as JSON for 'og trace render'"},
+		{"", "format", "fmt", "Output format: tree (default), or ndjson to stream nodes as found"},
+		{"", "annotations", "dir", "og_annotate storage used to mark annotated nodes"},
+		{"", "show-annotations", "", "Show annotation text under annotated nodes"},
+		{"", "summary", "", "Print per-level caller counts, top fan-in and top files"},
+		{"", "relative-to", "dir", "Show paths relative to a prefix"},
+		{"", "max-width", "n", "Shorten paths to fit n columns (default: terminal width)"},
+		{"", "full-paths", "", "Never shorten paths"},
+		{"w", "web-links", "", "Display clickable OpenGrok URLs for file references"},
+		{"", "dry-run", "", "Print the first HTTP requests without sending them"},
+		{"y", "yes", "", "Run even if the trace would far exceed --max-total"},
+	}},
+	{"trace render", "Render Options", []optionHelp{
+		{"", "format", "fmt", "Output format: tree (default), dot (Graphviz) or mermaid"},
+		{"d", "depth", "n", "Only show callers up to this depth (default: all saved)"},
+		{"", "exclude", "pattern", "Leave out call sites in matching files (repeatable)"},
+		{"", "annotations", "dir", "og_annotate storage used to mark annotated nodes"},
+		{"", "show-annotations", "", "Show annotation text under annotated nodes"},
+		{"", "summary", "", "Print per-level caller counts, top fan-in and top files"},
+		{"", "relative-to", "dir", "Show paths relative to a prefix"},
+		{"", "max-width", "n", "Shorten paths to fit n columns (default: terminal width)"},
+		{"", "full-paths", "", "Never shorten paths"},
+		{"w", "web-links", "", "Display clickable OpenGrok URLs for file references"},
+	}},
+	{"auth", "Authentication Options", []optionHelp{
+		{"", "username", "user", "Username for basic authentication"},
+		{"", "password", "pass", "Password for basic authentication"},
+		{"", "api-key", "key", "API key for authentication"},
+		{"", "bearer-token", "tok", "Bearer token for authentication"},
+	}},
+	{"init", "Init Options", []optionHelp{
+		{"w", "web-links", "", "Enable web links by default in output"},
+		{"", "from-env", "", "Save the server URL and credentials from OG_* variables"},
+		{"", "test-query", "query", "After saving, list projects and run a search to check the settings (default query: main)"},
+	}},
+	{"whoami", "Whoami Options", []optionHelp{
+		{"", "no-probe", "", "Only show the credentials, without contacting the server"},
+	}},
+	{"cat", "Cat Options", []optionHelp{
+		{"n", "line-numbers", "", "Prefix each line with its line number"},
+		{"", "theme", "name", "Syntax highlighting style (\"none\" disables)"},
+		{"", "encoding", "name", "Decode as utf-8, latin1, windows-1252, utf-16le or utf-16be (default: detect)"},
+	}},
+	{"lines", "Lines Options", []optionHelp{
+		{"w", "web-links", "", "Print the OpenGrok URL of the first line above the range"},
+		{"", "theme", "name", "Syntax highlighting style (\"none\" disables)"},
+	}},
+	{"export-xref", "Export Options", []optionHelp{
+		{"l", "lines", "range", "Only export these lines (e.g. 120-160)"},
+		{"n", "line-numbers", "", "Prefix each line with its line number"},
+	}},
+	{"api", "API Options", []optionHelp{
+		{"d", "data", "body", "Request body (@file reads a file, @- reads stdin)"},
+		{"i", "include", "", "Print the response status line and headers"},
+		{"", "raw", "", "Print the body as received, without pretty-printing JSON"},
+	}},
+	{"line-history", "Line History Options", []optionHelp{
+		{"m", "max", "n", "Maximum number of commits to follow back (default: 5)"},
+		{"", "web", "", "Open the diff view of each commit in system web browser"},
+	}},
+	{"compare", "Compare Options", []optionHelp{
+		{"p", "projects", "list", "Projects to compare, at least two (@name for a group, linux-* for a pattern)"},
+		{"t", "type", "ext", "File type filter"},
+		{"m", "max", "n", "Maximum number of files to fetch per search (default: 100)"},
+	}},
+	{"todo", "Todo Options", []optionHelp{
+		{"p", "projects", "list", "Comma-separated projects to scan (@name for a group, linux-* for a pattern)"},
+		{"t", "type", "ext", "File type filter"},
+		{"", "path", "pattern", "Only scan files whose path matches this pattern"},
+		{"m", "max", "n", "Maximum number of files to fetch (default: 200)"},
+		{"", "markers", "list", "Markers to look for (subset of TODO,FIXME,XXX)"},
+		{"", "owner", "name", "Only markers attributed to this owner"},
+		{"", "json", "", "Print the report as JSON"},
+	}},
+	{"project-stats", "Project Stats Options", []optionHelp{
+		{"", "top", "n", "Rows to show per breakdown (default: 10, 0 for all)"},
+		{"", "json", "", "Print the statistics as JSON"},
+	}},
+	{"fileinfo", "File Info Options", []optionHelp{
+		{"", "json", "", "Print the metadata as JSON"},
+	}},
+	{"diff-results", "Diff Options", []optionHelp{
+		{"q", "quiet", "", "Print nothing; only set the exit status"},
+	}},
+	{"open-last", "Open Options", []optionHelp{
+		{"", "edit", "", "Open the result in $VISUAL/$EDITOR in its local checkout"},
+	}},
+	{"watchlist add", "Watchlist Options", []optionHelp{
+		{"p", "projects", "list", "Comma-separated projects to look for callers in (@name for a group)"},
+		{"", "def-path", "path", "Pick the definition to watch when a symbol has several"},
+	}},
+	{"watchlist run", "Run Options", []optionHelp{
+		{"", "max-total", "n", "Maximum callers to find per symbol (default: 500)"},
+	}},
+	{"annotate", "Annotate Options", []optionHelp{
+		{"", "tag", "tag", "Only list annotations with this tag"},
+		{"", "annotations", "dir", "og_annotate storage directory (overrides config)"},
+	}},
+	{"annotate link", "Link Options", []optionHelp{
+		{"s", "server", "url", "OpenGrok server URL the link points at (overrides config)"},
+		{"", "author", "name", "Link this author's note when several people annotated the line"},
+		{"", "annotations", "dir", "og_annotate storage directory (overrides config)"},
+	}},
+	{"annotate resolve", "Resolve Options", []optionHelp{
+		{"", "open", "", "Open the annotated line in the browser"},
+		{"", "annotations", "dir", "og_annotate storage directory (overrides config)"},
+	}},
+	{"serve", "Serve Options", []optionHelp{
+		{"s", "server", "url", "OpenGrok server URL (overrides config and OG_SERVER)"},
+		{"", "listen", "addr", "Address to listen on (default: 127.0.0.1:7878)"},
+		{"", "cache-ttl", "dur", "How long to cache search/trace responses (0 disables)"},
+		{"", "annotate-bin", "path", "og_annotate binary for /api/annotate"},
+		{"", "token", "token", "Bearer token clients must send (default: $OG_DAEMON_TOKEN, or a random one)"},
+		{"", "rate", "n", "Maximum requests per second to the server (default: 10, 0 for no limit)"},
+		{"", "burst", "n", "Requests allowed at once before --rate applies (default: 20)"},
+	}},
+	{"lsp", "Language Server Options", []optionHelp{
+		{"s", "server", "url", "OpenGrok server URL (overrides config and OG_SERVER)"},
+		{"p", "projects", "list", "Projects to search (default: the edited file's project)"},
+		{"", "max", "n", "Maximum results per request (default: 100)"},
+		{"v", "verbose", "", "Log failed requests and unmapped results to stderr"},
+	}},
+	{"auth login", "Login Options", []optionHelp{
+		{"", "oidc", "", "Log in using the OIDC device authorization flow"},
+		{"", "issuer", "url", "OIDC issuer URL (defaults to the saved issuer)"},
+		{"", "client-id", "id", "OIDC client ID (defaults to the saved client ID)"},
+		{"", "scopes", "list", "Space-separated scopes (default: \"openid offline_access\")"},
+		{"", "no-browser", "", "Do not open the verification URL in a browser"},
+	}},
+	{"config encrypt", "Encrypt Options", []optionHelp{
+		{"", "keyring", "", "Store a random key in the OS keyring instead of using a passphrase"},
+	}},
+	{"config export", "Export Options", []optionHelp{
+		{"", "no-secrets", "", "Leave out the username, password, API key and bearer token"},
+		{"o", "output", "file", "Write the export to a file instead of stdout"},
+	}},
+	{"config import", "Import Options", []optionHelp{
+		{"", "dry-run", "", "Show what would change without saving"},
+	}},
+	{"delete", "Options", []optionHelp{
+		{"", "delete", "", "Remove the entry instead of showing or setting it"},
+	}},
+}
+
+// searchDescription is shared by the search commands
+const searchDescription = `Results are printed as project/path:line:text, like grep. The query uses OpenGrok's Lucene syntax; see 'og help query'.
+
+Only the first --max files are fetched; hits beyond --max-lines are counted but not printed. With -l the matching paths are streamed through every result page instead.`
+
+var commands = []commandHelp{
+	{
+		Name:    "init",
+		Args:    "<server-url>",
+		Summary: "Initialize with server URL (saves to config)",
+		Description: `Saves the server URL, and any credentials given, to ~/.og.json. With --from-env the OG_* environment settings are saved instead, so a CI job's settings can be kept.
+
+--test-query then lists the server's projects and runs a one-file full search, printing ok or FAILED for each with a hint on the likely cause: a URL missing OpenGrok's context path, missing or rejected credentials, or a login page in front of the REST API. The query defaults to "main"; give another as --test-query=<query>. The config is saved either way, and og exits with status 1 if a check failed.
+
+Credentials are stored in plaintext unless 'og config encrypt' is run afterwards.`,
+		Options:  []string{"init", "auth"},
+		Examples: []string{"init http://opengrok.example.com/source", "init --from-env", "init http://opengrok.example.com/source --api-key KEY --test-query"},
+	},
+	{
+		Name:        "status",
+		Summary:     "Show current server URL configuration",
+		Description: "Prints the configured server URL and which kind of authentication is set up, without contacting the server.",
+		Examples:    []string{"status"},
+	},
+	{
+		Name:    "whoami",
+		Summary: "Show which credentials would be sent, and check them",
+		Description: `Prints the server URL and the credentials a command given the same flags would use, and where each comes from: a flag, an OG_* environment variable or the config file (noting when it is encrypted). Flags take precedence over the environment, which takes precedence over the config file.
+
+Tokens and API keys are never printed: only their last 4 characters, when long enough, and a fingerprint (the start of their SHA-256) to tell them apart. Passwords are only reported as set.
+
+It then lists the server's projects with those credentials, printing ok or FAILED with a hint on the likely cause, and exits with status 1 if that fails. --no-probe skips the request.`,
+		Options:  []string{"server", "auth", "whoami"},
+		Examples: []string{"whoami", "whoami --api-key KEY", "whoami --no-probe"},
+	},
+	{
+		Name:        "projects",
+		Summary:     "List available projects",
+		Description: "Lists the projects indexed on the server.",
+		Options:     []string{"server", "auth"},
+		Examples:    []string{"projects"},
+	},
+	{
+		Name:        "full",
+		Args:        "<query>",
+		Summary:     "Full text search",
+		Description: "Searches the full text of every indexed file.\n\n" + searchDescription,
+		Options:     []string{"server", "search", "auth", "annotate-hits", "replace"},
+		Examples: []string{
+			`full "TODO"`,
+			`full "TODO" http://opengrok.example.com/source`,
+			`full "out of memory" --phrase --and kmalloc`,
+			`full "mutex_enter" --projects @kernel`,
+			`full "copyright" -l > files.txt`,
+			`full "strcpy" --changed-since "1 month ago"`,
+			`full "panic(" -N`,
+			`full "panic(" --open 3 --edit`,
+			`full "strcpy" --pipe ./add-owners`,
+			`full "kmem_alloc(" -p illumos-gate --replace 'kmem_alloc\((\w+), KM_SLEEP\)' --replace-with 'kmem_zalloc($1, KM_SLEEP)'`,
+		},
+	},
+	{
+		Name:        "def",
+		Args:        "<query>",
+		Summary:     "Definition search (find where symbols are defined)",
+		Description: "Finds the definitions of functions, types, macros and variables. Each hit is printed signature first: the symbol, its kind (function, struct, macro, ...), the definition line and its location. --template and --tree give other layouts. A C/C++ prototype in a header whose function body isn't among the hits gets it looked up, and function hits are labeled declaration or definition.\n\n" + searchDescription,
+		Options:     []string{"server", "search", "auth", "annotate-hits", "replace"},
+		Examples: []string{
+			`def "main" --projects myproject`,
+			`def "main" --projects myproject --local-paths`,
+			`def "vn_open" --json`,
+			`def "main" --template '{{.Path}}:{{.LineNo}} {{.Line}}'`,
+		},
+	},
+	{
+		Name:        "symbol",
+		Args:        "<query>",
+		Summary:     "Symbol search (find symbol references)",
+		Description: "Finds the places a symbol is referenced, excluding comments and strings. OpenGrok counts a definition as a reference too; --exclude-defs runs a def search for the symbol as well and drops the hits on its definition lines, so only the uses are left.\n\n" + searchDescription,
+		Options:     []string{"server", "search", "auth", "annotate-hits", "replace"},
+		Examples:    []string{"symbol legacy_api --max 500 --save-results before.json", "symbol vn_rele --exclude-defs -p illumos-gate", `symbol legacy_alloc --exclude-defs --max 200 --annotate "Moves to kmem_zalloc in 2.0" --annotate-tag review`},
+	},
+	{
+		Name:        "path",
+		Args:        "<pattern>",
+		Summary:     "Path search (search file paths)",
+		Description: "Matches file paths rather than contents. --path cannot be combined with a path search; put the pattern in the query.\n\n" + searchDescription,
+		Options:     []string{"server", "search", "auth"},
+		Examples:    []string{`path "*.h" --projects myproject --tree`},
+	},
+	{
+		Name:    "hist",
+		Args:    "<query>",
+		Summary: "History search (search version control history)",
+		Description: `Searches commit messages. With --after, --before or --author, og fetches the history of each matching file and prints the matching commits instead of the raw hits. Dates are ISO (2023-01-31) or relative: today, yesterday, "3 days ago", "2 weeks ago", "6 months ago".
+
+` + searchDescription,
+		Options: []string{"server", "search", "hist", "auth"},
+		Examples: []string{
+			`hist "race" --path 'uts/common/*' --after 2023-01-01 --author alice`,
+			`hist "leak" --after "2 weeks ago"`,
+		},
+	},
+	{
+		Name:    "trace",
+		Args:    "<symbol>",
+		Summary: "Trace call graph (find callers of a symbol)",
+		Description: `Finds the callers of a symbol, then their callers, breadth-first down to --depth levels. When the symbol is defined in several places, og asks which definition to trace; without a terminal it warns and traces the callers of all of them (pick one with --def-path). If the first page of callers suggests the trace would far exceed --max-total, og asks before starting (or lowers --depth when it can't ask); --yes skips the check.
+
+Callers of a symbol's aliases are followed too: names given with --alias old_name=new_name, and wrapper macros ("#define foo(x) bar(x)") found among the callers. Such callers are marked "via <name>()".
+
+A caller in another project than the function it calls is marked "↪ project:<name>"; --same-project-only leaves such callers out.
+
+Call sites in test and generated code (*_test.go, /test/, /generated/, *.pb.c) are skipped; set "excludes" in the config's "trace" section to change the list, or pass --no-default-excludes.
+
+--root-from-file project/path replaces the symbol: og traces every function the file defines, one level deep unless --depth is given, and prints a table of direct callers, callers in other files and total callers per function. Functions nothing outside the file calls are candidates for removal.
+
+--callers-of-file project/path also replaces the symbol: og traces the callers of each function the file exports (static C functions, private methods, lowercase Go and _-prefixed Python names are skipped) and groups them by calling file, listing each call site and the function it calls. Files reached only through deeper levels are listed as indirect dependents.
+
+--save trace.json writes the call tree to a file, partial if the trace was interrupted, so 'og trace render' can show it again later.
+
+--format ndjson prints each node as a JSON line the moment it is found, instead of the tree at the end, so other programs can draw the graph as it grows. Each line has the node's id, its parent's id and its level; a final {"type":"done"} line carries the totals.
+
+On a terminal, paths are shortened to fit its width. Ctrl-C prints the tree found so far.`,
+		Options: []string{"server", "trace", "auth"},
+		Examples: []string{
+			"trace malloc --depth 3 --projects myproject",
+			"trace my_probe --level-projects drivers --level-projects '*'",
+			"trace vn_rele --alias VN_RELE=vn_rele",
+			"trace my_probe --exclude '*_mock.c'",
+			"trace --root-from-file myproject/src/legacy.c",
+			"trace --callers-of-file myproject/src/buffer.c --depth 2",
+			"trace vfs_write --depth 4 --save vfs_write.json",
+			"trace vfs_write --depth 4 --format ndjson | my-graph-viewer",
+		},
+	},
+	{
+		Name:        "trace render",
+		Args:        "<trace.json>",
+		Summary:     "Re-render a trace saved with --save",
+		Description: "Prints a trace saved with 'og trace --save' without querying the server: as a tree like 'og trace', or as a Graphviz (--format dot) or Mermaid (--format mermaid) graph with one box per function and an arrow from each caller to what it calls, labeled with the call's line. --depth and --exclude narrow the saved tree. Annotations are looked up when rendering, so notes added since the trace show up. To trace a function named render, put an option first: 'og trace render --depth 2'.",
+		Options:     []string{"trace render"},
+		Examples:    []string{"trace render vfs_write.json --depth 2", "trace render vfs_write.json --format dot | dot -Tsvg > vfs_write.svg", "trace render vfs_write.json --format mermaid --exclude /fs/nfs/"},
+	},
+	{
+		Name:        "cat",
+		Args:        "<project/path>",
+		Summary:     "Print a file with syntax highlighting",
+		Description: "Fetches a file and prints it, colorized by language when writing to a terminal. The encoding is detected (UTF-8, a byte order mark, the server's charset, else Windows-1252) and bytes that don't decode print as U+FFFD; binary files are not printed unless --encoding is given.",
+		Options:     []string{"server", "cat", "auth"},
+		Examples:    []string{"cat myproject/src/main.c -n --theme dracula"},
+	},
+	{
+		Name:        "lines",
+		Args:        "<project/path> <start> <end>",
+		Summary:     "Print a range of a file's lines with line numbers",
+		Description: "Fetches a file and prints lines start to end, each with its line number, for pasting a referenced snippet into a review or chat. --web-links puts the OpenGrok URL of the first line above them.",
+		Options:     []string{"server", "lines", "auth"},
+		Examples:    []string{"lines myproject/src/main.c 120 135 -w"},
+	},
+	{
+		Name:        "export-xref",
+		Args:        "<project/path>",
+		Summary:     "Print a file's cross-reference as Markdown with its links",
+		Description: "Fetches the file's xref page and prints the source in a fenced code block, headed by a link to the file and followed by the definition and reference links OpenGrok put on its symbols. Paste the output into design docs or review write-ups.",
+		Options:     []string{"server", "export-xref", "auth"},
+		Examples:    []string{"export-xref myproject/src/vnode.c --lines 120-160 -n > excerpt.md"},
+	},
+	{
+		Name:    "api",
+		Args:    "<method> <path>",
+		Summary: "Send a request to the server's REST API and print the response",
+		Description: `Issues an authenticated request to any REST API endpoint, using the configured server and credentials, and prints the response body, pretty-printing JSON. Use it for endpoints og doesn't wrap yet. Paths are relative to /api/v1 unless they start with api/, so 'projects' and '/api/v1/projects' are the same. A --data body that is a JSON object or array is sent as application/json, anything else as text/plain.
+
+The exit status is 1 if the server answers with an error status; the response body is still printed.`,
+		Options: []string{"server", "api", "auth"},
+		Examples: []string{
+			"api GET projects",
+			"api GET 'search?full=mutex_enter&maxresults=5'",
+			"api PUT projects/myproject/property/tabSize --data 4",
+			"api POST api/v1/messages --data @message.json",
+		},
+	},
+	{
+		Name:        "line-history",
+		Args:        "<path>:<line>",
+		Summary:     "Show the commits that changed a line, newest first",
+		Description: "Blames the line, then follows it back through earlier revisions of the file until the commit that added it, or --max commits.",
+		Options:     []string{"server", "line-history", "auth"},
+		Examples:    []string{"line-history myproject/src/main.c:120 --web"},
+	},
+	{
+		Name:        "compare",
+		Args:        "<symbol>",
+		Summary:     "Show which of --projects define/reference a symbol, by path",
+		Description: "Runs one definition and one symbol search across the projects and prints a matrix of paths by project, useful for tracking divergence between forks.",
+		Options:     []string{"server", "compare", "auth"},
+		Examples:    []string{"compare foo_init --projects upstream,vendor-fork"},
+	},
+	{
+		Name:        "todo",
+		Summary:     "List TODO/FIXME/XXX comments by file and owner",
+		Description: `Runs one full-text search for the markers and keeps the hits where a marker appears in upper case. "TODO(alice)" attributes the marker to alice; the report lists markers by file and then counts them per owner. --owner "(unassigned)" shows the markers nobody claimed.`,
+		Options:     []string{"server", "todo", "auth"},
+		Examples:    []string{"todo --projects myproject --path 'src/*'", "todo --owner alice --json"},
+	},
+	{
+		Name:        "project-stats",
+		Args:        "<project>",
+		Summary:     "Profile a project: files by type and directory, repositories",
+		Description: "Fetches the project's indexed file list and shows how many files it has by extension and by top-level directory, with the type, branch and current revision of each repository. Servers often restrict repository details to administrators; the file counts are shown without them. --json prints every row.",
+		Options:     []string{"server", "project-stats", "auth"},
+		Examples:    []string{"project-stats myproject", "project-stats myproject --top 0 --json"},
+	},
+	{
+		Name:        "fileinfo",
+		Args:        "<project>/<path>",
+		Summary:     "Show a file's indexed genre, size and last revision",
+		Description: "Shows the metadata OpenGrok keeps for a file: the genre it was indexed as (PLAIN, XREFABLE, HTML, IMAGE or DATA), its size and modification time on the server, and the newest revision in its history, to check whether the index has the version you expect. A file missing from the index is an error. History is disabled on some servers and repositories; the rest is shown without it. --json prints the same fields.",
+		Options:     []string{"server", "fileinfo", "auth"},
+		Examples:    []string{"fileinfo myproject/src/main.c", "fileinfo myproject/src/main.c --json"},
+	},
+	{
+		Name:        "diff-results",
+		Args:        "<old> <new>",
+		Summary:     "Compare two --save-results files (added/removed hits)",
+		Description: "Compares two result files saved with --save-results and lists the hits removed (-) and added (+) in the new one. Hits are matched by project, path and line text, so moved lines are not reported. Exits with status 1 if the files differ.",
+		Options:     []string{"diff-results"},
+		Examples:    []string{"diff-results before.json after.json"},
+	},
+	{
+		Name:        "open-last",
+		Args:        "[n]",
+		Summary:     "Open result n of the last search (browser or --edit)",
+		Description: "Every search that prints results remembers them, numbered as --numbered shows them. open-last opens result n (default 1) in the browser on the server that was searched, or with --edit in $VISUAL or $EDITOR at its line in the local checkout configured with 'og config local'.",
+		Options:     []string{"open-last"},
+		Examples:    []string{"open-last 3", "open-last 3 --edit"},
+	},
+	{
+		Name:        "watchlist add",
+		Args:        "<symbol>",
+		Summary:     "Watch a symbol for new callers",
+		Description: "Adds a symbol to the watchlist kept in ~/.og_watchlist.json. 'og watchlist run' traces its direct callers and reports the ones that are new since the previous run, a lightweight way to see who starts depending on an internal API.",
+		Options:     []string{"watchlist add"},
+		Examples:    []string{"watchlist add zfs_internal_lookup --projects illumos", "watchlist add foo_init --def-path src/foo.c"},
+	},
+	{
+		Name:        "watchlist remove",
+		Args:        "<symbol>",
+		Summary:     "Stop watching a symbol",
+		Description: "Removes a symbol and its snapshot from the watchlist.",
+		Examples:    []string{"watchlist remove zfs_internal_lookup"},
+	},
+	{
+		Name:        "watchlist list",
+		Summary:     "List the watched symbols and their last snapshot",
+		Description: "Lists the watched symbols with their --projects and --def-path and the caller count and time of their last snapshot.",
+		Examples:    []string{"watchlist list"},
+	},
+	{
+		Name:        "watchlist run",
+		Summary:     "Trace the watched symbols and report new callers",
+		Description: "Traces each watched symbol to depth 1, compares its direct callers with the snapshot of the previous run and saves the new snapshot. New callers are listed with +, removed ones with -; callers are matched by function and file, so moved lines are not reported. The first run, or a run against another server, takes a baseline. A symbol that fails to trace keeps its snapshot, and the command exits with status 1.",
+		Options:     []string{"server", "watchlist run", "auth"},
+		Examples:    []string{"watchlist run", "watchlist run -q --max-total 1000"},
+	},
+	{
+		Name:        "annotate list",
+		Args:        "[project]",
+		Summary:     "List og_annotate notes (--tag to filter)",
+		Description: "Lists the annotations in og_annotate storage by file and line, optionally for one project and one tag.",
+		Options:     []string{"annotate"},
+		Examples:    []string{"annotate list myproject --tag bug"},
+	},
+	{
+		Name:        "annotate link",
+		Args:        "<project>/<path>:<line>",
+		Summary:     "Print a shareable permalink to an annotation",
+		Description: "Prints the OpenGrok xref URL of the annotated line with the note encoded in an annotation parameter, for pasting into tickets and chat. The link opens at the line for anyone; 'og annotate resolve' and og_annotate's resolvePermalink find the note from it.",
+		Options:     []string{"annotate link"},
+		Examples:    []string{"annotate link myproject/src/main.c:42", "annotate link myproject/src/main.c:42 --author alice"},
+	},
+	{
+		Name:        "annotate resolve",
+		Args:        "<permalink>",
+		Summary:     "Show the annotation a permalink names",
+		Description: "Finds the note a permalink names by its author and timestamp, so notes moved by a rebase are found at their new line, and prints it. With --open the line is opened in the browser.",
+		Options:     []string{"annotate resolve"},
+		Examples:    []string{"annotate resolve 'https://opengrok.example.com/source/xref/myproject/src/main.c?annotation=YWxpY2UKMjAyNC0wMS0xNQ#42' --open"},
+	},
+	{
+		Name:        "auth login",
+		Summary:     "Log in via OIDC device flow (for SSO-protected servers)",
+		Description: "Runs the OIDC device authorization flow and saves the tokens to the config file. Access tokens are refreshed automatically. A bearer token, API key or basic auth credentials saved in the config are removed, with a warning.",
+		Options:     []string{"auth login"},
+		Examples:    []string{"auth login --oidc --issuer https://sso.example.com --client-id og"},
+	},
+	{
+		Name:        "auth logout",
+		Summary:     "Remove stored OIDC tokens",
+		Description: "Removes the OIDC tokens from the config file; commands then run without credentials. The issuer and client ID are kept for the next login.",
+		Examples:    []string{"auth logout"},
+	},
+	{
+		Name:        "config encrypt",
+		Summary:     "Encrypt stored credentials (passphrase or --keyring)",
+		Description: "Encrypts the credentials in the config file. Without --keyring, the passphrase is read from OG_CONFIG_PASSPHRASE or prompted for.",
+		Options:     []string{"config encrypt"},
+		Examples:    []string{"config encrypt --keyring"},
+	},
+	{
+		Name:        "config decrypt",
+		Summary:     "Store credentials in plaintext again",
+		Description: "Decrypts the credentials in the config file and stores them in plaintext.",
+		Examples:    []string{"config decrypt"},
+	},
+	{
+		Name:        "config group",
+		Args:        "<name> [list]",
+		Summary:     "Define a project group for --projects @<name>",
+		Description: "Defines, shows or deletes a named list of projects. Groups expand wherever --projects is accepted.",
+		Options:     []string{"delete"},
+		Examples:    []string{"config group kernel illumos-gate,smartos-live"},
+	},
+	{
+		Name:        "config groups",
+		Summary:     "List project groups",
+		Description: "Lists the project groups defined in the config file.",
+		Examples:    []string{"config groups"},
+	},
+	{
+		Name:        "config local",
+		Args:        "[project] [dir]",
+		Summary:     "Map a project to a local checkout for --local-paths",
+		Description: "Maps a project to its local checkout so --local-paths can show results as local files. Without a dir, prints the mapping; without a project, lists all mappings.",
+		Options:     []string{"delete"},
+		Examples:    []string{"config local myproject ~/src/myproject"},
+	},
+	{
+		Name:        "config default-search",
+		Args:        "[type]",
+		Summary:     "Set the search run by 'og <query>' (default: full)",
+		Description: "Sets the search type (full, def, symbol, path or hist) that runs when og is given a query instead of a command. Queries that look like paths, a single word containing \"/\", run a path search whatever the default, and words close to a command name are refused as likely typos. Without a type, prints the current default.",
+		Examples:    []string{"config default-search symbol"},
+	},
+	{
+		Name:        "config search-case",
+		Args:        "[mode]",
+		Summary:     "Set how searches match case (smart, ignore, sensitive)",
+		Description: "Sets the case mode of searches run without --ignore-case, --case-sensitive or --smart-case: smart matches case exactly when the query has an uppercase letter, ignore and sensitive always do as they say. \"server\" clears it, leaving full, path and hist searches case-insensitive and def and symbol searches case-sensitive, as OpenGrok indexes them. Without a mode, prints the current one.",
+		Examples:    []string{"config search-case smart"},
+	},
+	{
+		Name:        "config export",
+		Summary:     "Print the shareable config for a team setup",
+		Description: "Prints the server URL and its bases, project groups, defaults (theme, web links, default search, search case, trace excludes) and OIDC settings as a config file for 'og config import'. Local checkouts, the annotations path, the daemon address and cached OIDC tokens stay behind. Credentials are included unless --no-secrets is given; a warning is printed when they are.",
+		Options:     []string{"config export"},
+		Examples:    []string{"config export --no-secrets -o team-og.json"},
+	},
+	{
+		Name:        "config import",
+		Args:        "<file|url|->",
+		Summary:     "Merge a shared config into yours",
+		Description: "Reads a config written by 'og config export' from a file, an http(s) URL or stdin and merges it into ~/.og.json: settings it has replace yours, project groups are merged by name, and credentials are replaced only when it has some. The import is checked like the config file itself, and unknown keys or bad URLs are refused. Older config versions are migrated.",
+		Options:     []string{"config import"},
+		Examples:    []string{"config import https://wiki.example.com/og-team.json", "config import team-og.json --dry-run"},
+	},
+	{
+		Name:    "serve",
+		Summary: "Run a local HTTP daemon for editor integrations",
+		Description: `Serves search, trace and file requests over HTTP on the loopback interface, caching responses, so editor plugins avoid starting og for every request. Every request must send "Authorization: Bearer <token>" and name a loopback host; the token is written to daemon.token in og's cache directory, readable only by you, and printed with its path at startup.
+
+With OG_DAEMON (or "daemon" in the config) set to the daemon's address, other og commands send their requests through it, so concurrent og processes share one rate limit (--rate, --burst), response cache and connection pool. They send the daemon its token, never their own credentials; the daemon uses its own. Commands fall back to the server when the daemon is not running, and ignore a daemon address that isn't a loopback one.`,
+		Options:  []string{"serve", "auth"},
+		Examples: []string{"serve --listen 127.0.0.1:7878 --cache-ttl 1m", "serve --rate 5 --burst 10"},
+	},
+	{
+		Name:        "lsp",
+		Summary:     "Run a language server answering definitions and references from OpenGrok",
+		Description: "Speaks the Language Server Protocol on stdin/stdout, answering go-to-definition and find-references with def and symbol searches, so editors can fall back on OpenGrok for code bases too large to index locally. Edited files are mapped to projects through the checkouts of 'og config local', and only results inside a checkout are returned.",
+		Options:     []string{"lsp", "auth"},
+		Examples:    []string{"lsp --projects myproject"},
+	},
+}
+
+var helpTopics = []helpTopic{
+	{
+		Name:    "query",
+		Summary: "Query syntax (Lucene operators, wildcards)",
+		Text: `Queries are passed to OpenGrok, which parses them with Lucene:
+
+  foo bar          Files containing both terms (AND is the default)
+  "foo bar"        The exact phrase
+  foo OR bar       Either term
+  foo AND NOT bar  foo but not bar (also: foo -bar)
+  +foo bar         foo is required, bar is optional
+  (foo OR bar) baz Grouping with parentheses
+  foo*             Wildcard: any run of characters
+  fo?              Wildcard: exactly one character
+  foo~             Fuzzy match (similar spelling)
+  "foo bar"~3      Terms within 3 words of each other
+
+Operators must be upper case, and characters such as + - && || ! ( ) { } [ ] ^ " ~ * ? : \ / need a backslash to be matched literally.
+
+--phrase quotes the whole query, --and adds a required term, --or an alternative and --not an excluded one, so most searches need no operators. Their terms are matched as text: og escapes the characters above and quotes terms with spaces, leaving only * and ? as wildcards:
+
+  og full "out of memory" --phrase --and kmalloc
+  og full kmalloc --or vmalloc --and GFP_KERNEL --not "test code"
+
+Field prefixes such as defs: or hist: are not needed; og picks the field from the command (full, def, symbol, path, hist).`,
+	},
+	{
+		Name:    "environment",
+		Summary: "Environment variables and config file",
+		Text: `og reads its settings from flags, then the environment, then ~/.og.json:
+
+  OG_SERVER             Server URL
+  OG_USERNAME           Username for basic authentication
+  OG_PASSWORD           Password for basic authentication
+  OG_API_KEY            API key
+  OG_BEARER_TOKEN       Bearer token
+  OG_DAEMON             Address of an 'og serve' daemon to send requests through
+  OG_DAEMON_TOKEN       Token 'og serve' requires (default: a random one)
+  OG_CONFIG_PASSPHRASE  Passphrase for an encrypted config file
+  OG_LOCALE             Language of messages, e.g. de (overrides "locale" in the config)
+
+Messages, usage and summaries are printed in the language of "locale" in ~/.og.json, or else of LC_ALL, LC_MESSAGES or LANG, when og has a catalog for it. "locale_dir" names a directory of <locale>.json catalogs mapping English messages to translations, added over the built-in ones. JSON and template output is never translated.
+
+A global --server before the command applies to any command, e.g. 'og --server URL projects'.`,
+	},
+}
+
+// findCommands returns the commands named name, or all subcommands of name
+// (e.g. every "config ..." command for "config")
+func findCommands(name string) []commandHelp {
+	var found []commandHelp
+	for _, c := range commands {
+		if c.Name == name {
+			return []commandHelp{c}
+		}
+		if strings.HasPrefix(c.Name, name+" ") {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+func findOptionGroup(name string) *optionGroup {
+	for i := range optionGroups {
+		if optionGroups[i].Name == name {
+			return &optionGroups[i]
+		}
+	}
+	return nil
+}
+
+// synopsis returns "name args" for a command
+func (c commandHelp) synopsis() string {
+	if c.Args == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Args
+}
+
+// flagText formats a flag as "-s, --server <url>"
+func (o optionHelp) flagText() string {
+	text := "    --" + o.Long
+	if o.Short != "" {
+		text = "-" + o.Short + ", --" + o.Long
+	}
+	if o.Arg != "" {
+		text += " <" + o.Arg + ">"
+	}
+	return text
+}
+
+// printUsage prints the command list
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, tr("og - Search OpenGrok instances from the command line\n\n"))
+	fmt.Fprint(w, trf("Usage: %s [--server <url>] <command> [options]\n", os.Args[0]))
+	fmt.Fprint(w, trf("       %s [--server <url>] <query> [options]   (default search; see config default-search)\n\n", os.Args[0]))
+	fmt.Fprint(w, tr("Commands:\n"))
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-28s %s\n", c.synopsis(), tr(c.Summary))
+	}
+	fmt.Fprint(w, tr("\nHelp topics:\n"))
+	for _, t := range helpTopics {
+		fmt.Fprintf(w, "  %-28s %s\n", t.Name, tr(t.Summary))
+	}
+	fmt.Fprint(w, trf("\nRun '%s help <command>' for a command's options and examples,\n", os.Args[0]))
+	fmt.Fprint(w, trf("or '%s man' to generate a man page.\n", os.Args[0]))
+}
+
+// printCommandHelp prints the help page for one command
+func printCommandHelp(w io.Writer, c commandHelp) {
+	options := ""
+	if len(c.Options) > 0 {
+		options = " [options]"
+	}
+	fmt.Fprint(w, trf("Usage: %s %s%s\n\n", os.Args[0], c.synopsis(), options))
+	fmt.Fprintf(w, "%s\n", tr(c.Description))
+	for _, name := range c.Options {
+		group := findOptionGroup(name)
+		fmt.Fprintf(w, "\n%s:\n", tr(group.Title))
+		for _, o := range group.Options {
+			fmt.Fprintf(w, "  %-28s %s\n", o.flagText(), tr(o.Text))
+		}
+	}
+	if len(c.Examples) > 0 {
+		fmt.Fprint(w, tr("\nExamples:\n"))
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, "  %s %s\n", os.Args[0], example)
+		}
+	}
+}
+
+// handleHelp prints the usage summary, a command's help page or a topic
+func handleHelp() {
+	if len(os.Args) < 3 {
+		printUsage(os.Stdout)
+		return
+	}
+	name := strings.Join(os.Args[2:], " ")
+	for _, t := range helpTopics {
+		if t.Name == name {
+			fmt.Println(tr(t.Text))
+			return
+		}
+	}
+	found := findCommands(name)
+	if len(found) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: no help for %q\n\n", name))
+		printUsage(os.Stderr)
+		os.Exit(1)
+	}
+	for i, c := range found {
+		if i > 0 {
+			fmt.Println()
+		}
+		printCommandHelp(os.Stdout, c)
+	}
+}
+
+// roffEscape escapes text for use in a man page
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	// A leading . or ' would start a request
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, ".") || strings.HasPrefix(line, "'") {
+			lines[i] = `\&` + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// writeManPage writes og(1) in groff man format
+func writeManPage(w io.Writer) {
+	fmt.Fprintf(w, ".TH OG 1\n")
+	fmt.Fprintf(w, ".SH NAME\nog \\- search OpenGrok instances from the command line\n")
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B og\n[\\fB\\-\\-server\\fR \\fIurl\\fR]\n\\fIcommand\\fR [\\fIoptions\\fR]\n.br\n.B og\n[\\fB\\-\\-server\\fR \\fIurl\\fR]\n\\fIquery\\fR [\\fIoptions\\fR]\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\nog runs OpenGrok searches, call graph traces and related queries from a terminal, printing results in a grep\\-like format.\n")
+
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, ".TP\n.B og %s\n", roffEscape(c.synopsis()))
+		for i, para := range strings.Split(c.Description, "\n\n") {
+			if i > 0 {
+				fmt.Fprintf(w, ".IP\n")
+			}
+			fmt.Fprintf(w, "%s\n", roffEscape(para))
+		}
+		if len(c.Options) > 0 {
+			titles := make([]string, len(c.Options))
+			for i, name := range c.Options {
+				titles[i] = findOptionGroup(name).Title
+			}
+			fmt.Fprintf(w, ".IP\nSee %s.\n", roffEscape(strings.Join(titles, ", ")))
+		}
+	}
+
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	for _, group := range optionGroups {
+		fmt.Fprintf(w, ".SS %s\n", roffEscape(group.Title))
+		for _, o := range group.Options {
+			fmt.Fprintf(w, ".TP\n.B %s\n%s\n", roffEscape(strings.TrimSpace(o.flagText())), roffEscape(o.Text))
+		}
+	}
+
+	for _, t := range helpTopics {
+		fmt.Fprintf(w, ".SH %s\n", roffEscape(strings.ToUpper(t.Summary)))
+		for _, para := range strings.Split(t.Text, "\n\n") {
+			if strings.HasPrefix(para, "  ") {
+				// Indented blocks are tables and commands; keep their layout
+				fmt.Fprintf(w, ".PP\n.nf\n%s\n.fi\n", roffEscape(para))
+			} else {
+				fmt.Fprintf(w, ".PP\n%s\n", roffEscape(para))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, ".SH FILES\n.TP\n.I ~/.og.json\nServer URL, credentials, project groups and other settings.\n")
+	fmt.Fprintf(w, ".SH EXAMPLES\n.nf\n")
+	for _, c := range commands {
+		for _, example := range c.Examples {
+			fmt.Fprintf(w, "og %s\n", roffEscape(example))
+		}
+	}
+	fmt.Fprintf(w, ".fi\n")
+}
+
+func handleMan() {
+	writeManPage(os.Stdout)
+}
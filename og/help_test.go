@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCommandHelpOptionGroupsExist(t *testing.T) {
+	for _, c := range commands {
+		for _, name := range c.Options {
+			if findOptionGroup(name) == nil {
+				t.Errorf("command %q refers to unknown option group %q", c.Name, name)
+			}
+		}
+		if c.Summary == "" || c.Description == "" {
+			t.Errorf("command %q needs a summary and a description", c.Name)
+		}
+	}
+}
+
+func TestFindCommands(t *testing.T) {
+	if got := findCommands("trace"); len(got) != 1 || got[0].Name != "trace" {
+		t.Errorf("findCommands(trace) = %+v", got)
+	}
+	var names []string
+	for _, c := range findCommands("config") {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, ","); got != "config encrypt,config decrypt,config group,config groups,config local,config default-search,config search-case,config export,config import" {
+		t.Errorf("findCommands(config) = %s", got)
+	}
+	if got := findCommands("nosuch"); len(got) != 0 {
+		t.Errorf("findCommands(nosuch) = %+v", got)
+	}
+}
+
+func TestPrintCommandHelp(t *testing.T) {
+	var buf bytes.Buffer
+	printCommandHelp(&buf, findCommands("hist")[0])
+	out := buf.String()
+	for _, want := range []string{"hist <query> [options]", "History Options:", "      --after <date>", "  -m, --max <n>", "Examples:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("hist help lacks %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteManPage(t *testing.T) {
+	var buf bytes.Buffer
+	writeManPage(&buf)
+	out := buf.String()
+	for _, want := range []string{".TH OG 1\n", ".SH COMMANDS\n", ".B og trace <symbol>\n", ".B \\-d, \\-\\-depth <n>\n", ".SH QUERY SYNTAX (LUCENE OPERATORS, WILDCARDS)\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("man page lacks %q", want)
+		}
+	}
+	for i, line := range strings.Split(out, "\n") {
+		// Unescaped text lines must not start a roff request by accident
+		if strings.HasPrefix(line, "'") {
+			t.Errorf("line %d starts with a quote: %q", i+1, line)
+		}
+	}
+}
+
+func TestRoffEscape(t *testing.T) {
+	if got := roffEscape(`.hidden --flag a\b`); got != `\&.hidden \-\-flag a\eb` {
+		t.Errorf("roffEscape() = %q", got)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// defaultTheme is the chroma style used when none is configured
+const defaultTheme = "monokai"
+
+// themeNone disables syntax highlighting
+const themeNone = "none"
+
+// resolveTheme returns the theme to use: flag > config > default
+func resolveTheme(flagTheme string) string {
+	if flagTheme != "" {
+		return flagTheme
+	}
+	if cfg, _ := LoadConfig(); cfg != nil && cfg.Theme != "" {
+		return cfg.Theme
+	}
+	return defaultTheme
+}
+
+// highlightLines colorizes source lines for the terminal using a lexer chosen
+// by file name (falling back to content analysis). The result has exactly one
+// entry per input line with colors reset at each line end, so callers can add
+// prefixes such as line numbers. Lines are returned unchanged if no lexer
+// matches or the theme is "none".
+func highlightLines(filename string, lines []string, theme string) []string {
+	if theme == themeNone || len(lines) == 0 {
+		return lines
+	}
+
+	source := strings.Join(lines, "\n")
+	lexer := lexers.Match(filename)
+	if lexer == nil {
+		lexer = lexers.Analyse(source)
+	}
+	if lexer == nil {
+		return lines
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	style := styles.Get(theme)
+	if style == nil {
+		style = styles.Fallback
+	}
+	formatter := formatters.Get("terminal256")
+
+	iterator, err := lexer.Tokenise(nil, source+"\n")
+	if err != nil {
+		return lines
+	}
+
+	out := make([]string, 0, len(lines))
+	for _, lineTokens := range chroma.SplitTokensIntoLines(iterator.Tokens()) {
+		if len(out) == len(lines) {
+			break
+		}
+		if n := len(lineTokens); n > 0 {
+			lineTokens[n-1].Value = strings.TrimSuffix(lineTokens[n-1].Value, "\n")
+		}
+		var sb strings.Builder
+		if err := formatter.Format(&sb, style, chroma.Literator(lineTokens...)); err != nil {
+			return lines
+		}
+		out = append(out, sb.String())
+	}
+	// Lexers may drop trailing empty lines; keep the output aligned with the input
+	for len(out) < len(lines) {
+		out = append(out, lines[len(out)])
+	}
+	return out
+}
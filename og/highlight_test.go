@@ -0,0 +1,54 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+func TestHighlightLinesGo(t *testing.T) {
+	lines := []string{
+		"package main",
+		"",
+		"/* block comment",
+		"   spans lines */",
+		"func main() {",
+		"\tprintln(\"hi\")",
+		"}",
+	}
+
+	got := highlightLines("main.go", lines, "monokai")
+	if len(got) != len(lines) {
+		t.Fatalf("expected %d lines, got %d", len(lines), len(got))
+	}
+	if got[4] == lines[4] {
+		t.Error("expected func line to be colorized")
+	}
+	for i := range lines {
+		if plain := ansiRegex.ReplaceAllString(got[i], ""); plain != lines[i] {
+			t.Errorf("line %d: stripped output %q, want %q", i, plain, lines[i])
+		}
+	}
+}
+
+func TestHighlightLinesDisabled(t *testing.T) {
+	lines := []string{"int main(void) {", "}"}
+	got := highlightLines("main.c", lines, themeNone)
+	for i := range lines {
+		if got[i] != lines[i] {
+			t.Errorf("theme none should not change line %d: %q", i, got[i])
+		}
+	}
+}
+
+func TestHighlightLinesUnknownStyleFallsBack(t *testing.T) {
+	lines := []string{"int main(void) {", "}"}
+	got := highlightLines("main.c", lines, "no-such-style")
+	if len(got) != len(lines) {
+		t.Fatalf("expected %d lines, got %d", len(lines), len(got))
+	}
+	if plain := ansiRegex.ReplaceAllString(got[0], ""); plain != lines[0] {
+		t.Errorf("stripped output %q, want %q", plain, lines[0])
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyDateLayout is the format of --after and --before
+const historyDateLayout = "2006-01-02"
+
+// historyNow is the reference time for relative dates; tests override it
+var historyNow = time.Now
+
+// relativeDateUnits maps the units of "N <unit> ago" to years, months, days
+var relativeDateUnits = map[string][3]int{
+	"day":   {0, 0, 1},
+	"week":  {0, 0, 7},
+	"month": {0, 1, 0},
+	"year":  {1, 0, 0},
+}
+
+// HistoryFilter narrows history search hits to the commits that match. The
+// search API has no date or author parameters, so these are applied to each
+// matching file's history.
+type HistoryFilter struct {
+	After  time.Time // Inclusive, zero for no lower bound
+	Before time.Time // Inclusive (whole day), zero for no upper bound
+	Author string    // Case-insensitive substring of the author
+	Terms  []string  // Lowercased query words; a commit message must contain one
+}
+
+// Active reports whether any date or author restriction is set
+func (f HistoryFilter) Active() bool {
+	return !f.After.IsZero() || !f.Before.IsZero() || f.Author != ""
+}
+
+// parseHistoryDate parses a --after/--before value: an ISO date
+// (YYYY-MM-DD, or a timestamp whose date part is used), "today", "yesterday"
+// or "N days/weeks/months/years ago". Dates have whole-day precision.
+func parseHistoryDate(flagName, value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(historyDateLayout, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return truncateToDay(t), nil
+		}
+	}
+	if t, ok := parseRelativeDate(strings.ToLower(value), historyNow()); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --%s date %q (expected YYYY-MM-DD or e.g. \"2 weeks ago\")", flagName, value)
+}
+
+// parseRelativeDate resolves "today", "yesterday" and "N <unit>(s) ago"
+// ("a week ago" also works) against now's calendar date
+func parseRelativeDate(value string, now time.Time) (time.Time, bool) {
+	today := truncateToDay(now)
+	switch value {
+	case "today":
+		return today, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 3 || fields[2] != "ago" {
+		return time.Time{}, false
+	}
+	n, err := strconv.Atoi(fields[0])
+	if fields[0] == "a" || fields[0] == "an" {
+		n, err = 1, nil
+	}
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	unit, ok := relativeDateUnits[strings.TrimSuffix(fields[1], "s")]
+	if !ok {
+		return time.Time{}, false
+	}
+	return today.AddDate(-n*unit[0], -n*unit[1], -n*unit[2]), true
+}
+
+// truncateToDay returns t's calendar date as midnight UTC, the form dates
+// parsed from YYYY-MM-DD take
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// validateHistoryRange rejects a range that can't contain any commit
+func validateHistoryRange(after, before time.Time) error {
+	if !after.IsZero() && !before.IsZero() && after.After(before) {
+		return fmt.Errorf("--after %s is later than --before %s", after.Format(historyDateLayout), before.Format(historyDateLayout))
+	}
+	return nil
+}
+
+// historyTerms extracts plain words from a history query for matching commit
+// messages, dropping query syntax (operators, quotes, wildcards, fields)
+func historyTerms(query string) []string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		if word == "AND" || word == "OR" || word == "NOT" || word == "&&" || word == "||" {
+			continue
+		}
+		if i := strings.Index(word, ":"); i >= 0 {
+			word = word[i+1:]
+		}
+		word = strings.Trim(word, `"'()+-*?~^!`)
+		if word != "" {
+			terms = append(terms, strings.ToLower(word))
+		}
+	}
+	return terms
+}
+
+// Match reports whether a commit passes the filter. Commits without a
+// parseable date fail any date bound.
+func (f HistoryFilter) Match(e HistoryEntry) bool {
+	if f.Author != "" && !strings.Contains(strings.ToLower(e.Author), strings.ToLower(f.Author)) {
+		return false
+	}
+	if !f.After.IsZero() || !f.Before.IsZero() {
+		t, ok := e.Time()
+		if !ok {
+			return false
+		}
+		if !f.After.IsZero() && t.Before(f.After) {
+			return false
+		}
+		if !f.Before.IsZero() && !t.Before(f.Before.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+	if len(f.Terms) == 0 {
+		return true
+	}
+	message := strings.ToLower(e.Message)
+	for _, term := range f.Terms {
+		if strings.Contains(message, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// FileHistory is a file from a history search with its matching commits
+type FileHistory struct {
+	Project string
+	Path    string // Path within the project
+	Entries []HistoryEntry
+}
+
+// FilterHistoryResults fetches the history of each file in a history search
+// response and keeps the commits that pass the filter. Files left without
+// commits are dropped. The files done before an error are returned with it.
+// The file being checked is shown as a subtask of task, which may be nil.
+func FilterHistoryResults(ctx context.Context, client *Client, resp *SearchResponse, filter HistoryFilter, task *ProgressTask) ([]FileHistory, error) {
+	var filePaths []string
+	projects := make(map[string]string)
+	for _, r := range resp.OrderedEntries() {
+		filePath := buildTraceFilePath(r.Project, r.SearchResult)
+		if filePath == "" || projects[filePath] != "" {
+			continue
+		}
+		projects[filePath] = r.Project
+		filePaths = append(filePaths, filePath)
+	}
+
+	var files []FileHistory
+	step := task.Start("")
+	defer step.Done()
+	for i, filePath := range filePaths {
+		step.Updatef("%s (%d/%d)", strings.TrimPrefix(filePath, "/"), i+1, len(filePaths))
+		history, err := client.GetHistoryContext(ctx, filePath, historyPageSize)
+		if err != nil {
+			return files, fmt.Errorf("failed to fetch history of %s: %w", filePath, err)
+		}
+		var matched []HistoryEntry
+		for _, e := range history {
+			if filter.Match(e) {
+				matched = append(matched, e)
+			}
+		}
+		if len(matched) > 0 {
+			files = append(files, FileHistory{
+				Project: projects[filePath],
+				Path:    strings.TrimPrefix(filePath, "/"+projects[filePath]),
+				Entries: matched,
+			})
+		}
+	}
+	return files, nil
+}
+
+// FilterChangedSince keeps the hits in files last changed on or after since,
+// dropping the rest from resp. OpenGrok lists history newest first, so one
+// entry per file gives its last modification; files without a dated commit
+// (e.g. not under version control) are dropped. The file being checked is
+// shown as a subtask of task, which may be nil. On error resp is unchanged.
+func FilterChangedSince(ctx context.Context, client *Client, resp *SearchResponse, since time.Time, task *ProgressTask) error {
+	entries := resp.OrderedEntries()
+	changed, err := lastChanged(ctx, client, entries, task)
+	if err != nil {
+		return err
+	}
+
+	kept := make([]ResultEntry, 0, len(entries))
+	results := make(map[string][]SearchResult)
+	for _, r := range entries {
+		t := changed[buildTraceFilePath(r.Project, r.SearchResult)]
+		if t.IsZero() || t.Before(since) {
+			continue
+		}
+		kept = append(kept, r)
+		results[r.Project] = append(results[r.Project], r.SearchResult)
+	}
+	resp.Entries = kept
+	resp.Results = results
+	resp.ResultCount = countResultFiles(kept)
+	return nil
+}
+
+// lastChanged returns when each file with hits in entries was last changed,
+// by "/project/path", from the newest entry of its history. Files without a
+// dated commit get the zero time. The file being checked is shown as a
+// subtask of task, which may be nil.
+func lastChanged(ctx context.Context, client *Client, entries []ResultEntry, task *ProgressTask) (map[string]time.Time, error) {
+	changed := make(map[string]time.Time)
+	var filePaths []string
+	for _, r := range entries {
+		filePath := buildTraceFilePath(r.Project, r.SearchResult)
+		if _, seen := changed[filePath]; filePath == "" || seen {
+			continue
+		}
+		changed[filePath] = time.Time{}
+		filePaths = append(filePaths, filePath)
+	}
+
+	step := task.Start("")
+	defer step.Done()
+	for i, filePath := range filePaths {
+		step.Updatef("%s (%d/%d)", strings.TrimPrefix(filePath, "/"), i+1, len(filePaths))
+		history, err := client.GetHistoryContext(ctx, filePath, 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch history of %s: %w", filePath, err)
+		}
+		if len(history) > 0 {
+			if t, ok := history[0].Time(); ok {
+				changed[filePath] = t
+			}
+		}
+	}
+	return changed, nil
+}
+
+// printFileHistories prints each file followed by its matching commits
+func printFileHistories(w io.Writer, files []FileHistory, useColor bool) {
+	if len(files) == 0 {
+		fmt.Fprintln(w, "No matching commits found.")
+		return
+	}
+	commits := 0
+	for i, f := range files {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if useColor {
+			fmt.Fprintf(w, "%s%s%s\n", colorMagenta, f.Project+f.Path, colorReset)
+		} else {
+			fmt.Fprintln(w, f.Project+f.Path)
+		}
+		for _, e := range f.Entries {
+			rev := e.Revision
+			if len(rev) > 12 {
+				rev = rev[:12]
+			}
+			if useColor {
+				fmt.Fprintf(w, "  %s%s%s %s %s%s%s  %s\n", colorCyan, rev, colorReset, e.Day(), colorBold, e.Author, colorReset, e.Summary())
+			} else {
+				fmt.Fprintf(w, "  %s %s %s  %s\n", rev, e.Day(), e.Author, e.Summary())
+			}
+			commits++
+		}
+	}
+	fmt.Fprintf(w, "\n%d matching commits in %d files.\n", commits, len(files))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"race", []string{"race"}},
+		{`"Fix race" AND startup`, []string{"fix", "race", "startup"}},
+		{"(mutex OR lock*) NOT +test", []string{"mutex", "lock", "test"}},
+		{"hist:deadlock", []string{"deadlock"}},
+		{"*", nil},
+	}
+	for _, tt := range tests {
+		if got := historyTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("historyTerms(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseHistoryDate(t *testing.T) {
+	if d, err := parseHistoryDate("after", ""); err != nil || !d.IsZero() {
+		t.Errorf("empty date = %v, %v", d, err)
+	}
+	if d, err := parseHistoryDate("after", "2023-01-01"); err != nil || d.Format("2006-01-02") != "2023-01-01" {
+		t.Errorf("valid date = %v, %v", d, err)
+	}
+	if _, err := parseHistoryDate("before", "01/02/2023"); err == nil || !strings.Contains(err.Error(), "--before") {
+		t.Errorf("expected --before error, got %v", err)
+	}
+}
+
+func TestParseHistoryDateRelative(t *testing.T) {
+	historyNow = func() time.Time { return time.Date(2024, 3, 15, 22, 30, 0, 0, time.Local) }
+	defer func() { historyNow = time.Now }()
+
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"2024-03-01T12:00:00Z", "2024-03-01"},
+		{"2024-03-01 08:15", "2024-03-01"},
+		{"today", "2024-03-15"},
+		{"Yesterday", "2024-03-14"},
+		{"3 days ago", "2024-03-12"},
+		{"2 weeks ago", "2024-03-01"},
+		{"a week ago", "2024-03-08"},
+		{"1 month ago", "2024-02-15"},
+		{"2 years ago", "2022-03-15"},
+	}
+	for _, tt := range tests {
+		d, err := parseHistoryDate("after", tt.value)
+		if err != nil || d.Format(historyDateLayout) != tt.want {
+			t.Errorf("parseHistoryDate(%q) = %v, %v; want %s", tt.value, d, err, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"2 fortnights ago", "weeks ago", "-1 days ago", "2 weeks"} {
+		if _, err := parseHistoryDate("after", bad); err == nil {
+			t.Errorf("parseHistoryDate(%q) should fail", bad)
+		}
+	}
+}
+
+func TestValidateHistoryRange(t *testing.T) {
+	early, _ := parseHistoryDate("after", "2023-01-01")
+	late, _ := parseHistoryDate("before", "2023-06-30")
+	if err := validateHistoryRange(early, late); err != nil {
+		t.Errorf("valid range rejected: %v", err)
+	}
+	if err := validateHistoryRange(early, early); err != nil {
+		t.Errorf("single-day range rejected: %v", err)
+	}
+	if err := validateHistoryRange(late, early); err == nil {
+		t.Error("expected an error for an inverted range")
+	}
+	if err := validateHistoryRange(late, time.Time{}); err != nil {
+		t.Errorf("open range rejected: %v", err)
+	}
+}
+
+func TestHistoryFilterMatch(t *testing.T) {
+	after, _ := parseHistoryDate("after", "2023-01-01")
+	before, _ := parseHistoryDate("before", "2023-06-30")
+	filter := HistoryFilter{After: after, Before: before, Author: "Alice", Terms: []string{"race"}}
+
+	tests := []struct {
+		name  string
+		entry HistoryEntry
+		want  bool
+	}{
+		{"match", HistoryEntry{Date: "1680307200000", Author: "alice <a@example.com>", Message: "Fix RACE in startup"}, true},
+		{"last day of range", HistoryEntry{Date: "1688169599000", Author: "alice", Message: "race"}, true},
+		{"too early", HistoryEntry{Date: "1640995200000", Author: "alice", Message: "race"}, false},
+		{"too late", HistoryEntry{Date: "1688169600000", Author: "alice", Message: "race"}, false},
+		{"other author", HistoryEntry{Date: "1680307200000", Author: "bob", Message: "race"}, false},
+		{"message lacks term", HistoryEntry{Date: "1680307200000", Author: "alice", Message: "cleanup"}, false},
+		{"no date", HistoryEntry{Author: "alice", Message: "race"}, false},
+	}
+	for _, tt := range tests {
+		if got := filter.Match(tt.entry); got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if (HistoryFilter{Terms: []string{"race"}}).Active() {
+		t.Error("terms alone should not make the filter active")
+	}
+}
+
+func TestFilterHistoryResults(t *testing.T) {
+	histories := map[string][]HistoryEntry{
+		"/proj/uts/a.c": {
+			{Revision: "r3", Date: "1680307200000", Author: "alice", Message: "Fix race in a"},
+			{Revision: "r1", Date: "1640995200000", Author: "alice", Message: "Race from 2022"},
+		},
+		"/proj/uts/b.c": {
+			{Revision: "r2", Date: "1680307200000", Author: "bob", Message: "Fix race in b"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/history" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"entries": histories[r.URL.Query().Get("path")]})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &SearchResponse{
+		ResultCount: 2,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/a.c", Line: "Fix race in a"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/a.c", Line: "Race from 2022"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/b.c", Line: "Fix race in b"}},
+		},
+	}
+	after, _ := parseHistoryDate("after", "2023-01-01")
+	files, err := FilterHistoryResults(context.Background(), client, resp, HistoryFilter{After: after, Author: "alice", Terms: []string{"race"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Project != "proj" || files[0].Path != "/uts/a.c" || len(files[0].Entries) != 1 || files[0].Entries[0].Revision != "r3" {
+		t.Fatalf("files = %+v", files)
+	}
+
+	var buf bytes.Buffer
+	printFileHistories(&buf, files, false)
+	want := "proj/uts/a.c\n  r3 2023-04-01 alice  Fix race in a\n\n1 matching commits in 1 files.\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFilterChangedSince(t *testing.T) {
+	histories := map[string][]HistoryEntry{
+		"/proj/uts/new.c": {{Revision: "r3", Date: "1680307200000"}}, // 2023-04-01
+		"/proj/uts/old.c": {{Revision: "r1", Date: "1640995200000"}}, // 2022-01-01
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("max") != "1" {
+			t.Errorf("history max = %q, want 1", r.URL.Query().Get("max"))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"entries": histories[r.URL.Query().Get("path")]})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &SearchResponse{
+		ResultCount: 3,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/old.c", Line: "strcpy(a, b)"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/new.c", Line: "strcpy(c, d)"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/new.c", Line: "strcpy(e, f)"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/uts/untracked.c", Line: "strcpy(g, h)"}},
+		},
+	}
+	since, _ := parseHistoryDate("changed-since", "2023-01-01")
+	if err := FilterChangedSince(context.Background(), client, resp, since, nil); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ResultCount != 1 || len(resp.Entries) != 2 || len(resp.Results["proj"]) != 2 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	for _, e := range resp.Entries {
+		if e.Path != "/uts/new.c" {
+			t.Errorf("kept %s", e.Path)
+		}
+	}
+}
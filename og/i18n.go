@@ -0,0 +1,164 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// User-facing messages are looked up in a message catalog for the user's
+// locale, keyed by their English text (as with gettext), so a message
+// missing from a catalog is printed in English. Only text meant for people
+// is translated: JSON, templates and other machine-read output never go
+// through a catalog.
+
+// envLocale overrides the locale for og alone
+const envLocale = "OG_LOCALE"
+
+//go:embed locales/*.json
+var builtinCatalogs embed.FS
+
+// messageCatalog maps English messages (printf formats included) to their
+// translations
+type messageCatalog map[string]string
+
+var (
+	catalogOnce   sync.Once
+	activeCatalog messageCatalog
+)
+
+// tr returns the translation of msg in the user's locale, or msg itself
+func tr(msg string) string {
+	catalogOnce.Do(func() {
+		activeCatalog = loadCatalog(readLocaleConfig())
+	})
+	if t, ok := activeCatalog[msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// trf formats a translated printf format, for messages with arguments
+func trf(format string, args ...any) string {
+	return fmt.Sprintf(tr(format), args...)
+}
+
+// localeTagRegex matches the locales og takes in config: a language code,
+// with an optional region ("de", "pt_BR", "pt-BR")
+var localeTagRegex = regexp.MustCompile(`^[a-zA-Z]{2,3}([_-][a-zA-Z0-9]{2,8})?$`)
+
+// userLocale picks the locale to use: OG_LOCALE, then the config's
+// "locale", then the POSIX variables in their usual order. The config wins
+// over LANG and friends, which are nearly always set, so an org can pick
+// og's language without changing the rest of the system.
+func userLocale(configured string) string {
+	if l := os.Getenv(envLocale); l != "" {
+		return l
+	}
+	if configured != "" {
+		return configured
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if l := os.Getenv(name); l != "" {
+			return l
+		}
+	}
+	return ""
+}
+
+// localeCandidates returns the catalog names to try for a locale, most
+// specific first: "pt_BR.UTF-8" gives "pt_BR" then "pt". English and the
+// C locale need no catalog.
+func localeCandidates(locale string) []string {
+	locale, _, _ = strings.Cut(locale, ".") // Encoding
+	locale, _, _ = strings.Cut(locale, "@") // Modifier
+	locale = strings.ReplaceAll(locale, "-", "_")
+	lang, _, hasRegion := strings.Cut(locale, "_")
+	lang = strings.ToLower(lang)
+	if lang == "" || lang == "c" || lang == "posix" || lang == "en" {
+		return nil
+	}
+	if hasRegion {
+		return []string{locale, lang}
+	}
+	return []string{lang}
+}
+
+// readLocaleConfig reads the "locale" and "locale_dir" keys of the config
+// file. It doesn't use LoadConfig, which may prompt for a passphrase and
+// reports errors itself: a config og can't read just leaves messages in
+// English.
+func readLocaleConfig() (locale, dir string) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return userLocale(""), ""
+	}
+	var cfg struct {
+		Locale    string `json:"locale"`
+		LocaleDir string `json:"locale_dir"`
+	}
+	if data, err := os.ReadFile(configPath); err == nil {
+		json.Unmarshal(data, &cfg)
+	}
+	return userLocale(cfg.Locale), cfg.LocaleDir
+}
+
+// loadCatalog returns the message catalog for locale: the built-in one,
+// with the messages of <dir>/<name>.json added over it, so a deployment can
+// ship its own language or reword ours. Unreadable catalogs are skipped with
+// a warning.
+func loadCatalog(locale, dir string) messageCatalog {
+	for _, name := range localeCandidates(locale) {
+		catalog := make(messageCatalog)
+		found := false
+		if data, err := builtinCatalogs.ReadFile("locales/" + name + ".json"); err == nil {
+			found = json.Unmarshal(data, &catalog) == nil
+		}
+		if dir != "" {
+			path := filepath.Join(dir, name+".json")
+			if data, err := os.ReadFile(path); err == nil {
+				if err := json.Unmarshal(data, &catalog); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: ignoring message catalog %s: %v\n", path, err)
+				} else {
+					found = true
+				}
+			}
+		}
+		if found {
+			return catalog
+		}
+	}
+	return nil
+}
+
+// catalogProblems checks a catalog's translations against their messages:
+// each must use the same printf verbs in the same order, or the formatted
+// text would be garbled
+func catalogProblems(catalog messageCatalog) []string {
+	var problems []string
+	for msg, t := range catalog {
+		if want, got := printfVerbs(msg), printfVerbs(t); strings.Join(want, " ") != strings.Join(got, " ") {
+			problems = append(problems, fmt.Sprintf("%q: verbs %v, want %v", t, got, want))
+		}
+	}
+	return problems
+}
+
+// printfVerbRegex matches a printf verb with its flags, width and precision
+var printfVerbRegex = regexp.MustCompile(`%[-+# 0]*(\*|\d+)?(\.(\*|\d+))?[a-zA-Z%]`)
+
+// printfVerbs returns the printf verbs of format in order, "%%" left out
+func printfVerbs(format string) []string {
+	var verbs []string
+	for _, verb := range printfVerbRegex.FindAllString(format, -1) {
+		if verb != "%%" {
+			verbs = append(verbs, verb)
+		}
+	}
+	return verbs
+}
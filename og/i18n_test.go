@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestUserLocale(t *testing.T) {
+	for _, name := range []string{envLocale, "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("LANG", "fr_FR.UTF-8")
+	if got := userLocale(""); got != "fr_FR.UTF-8" {
+		t.Errorf("LANG: got %q", got)
+	}
+	t.Setenv("LC_MESSAGES", "it_IT")
+	if got := userLocale(""); got != "it_IT" {
+		t.Errorf("LC_MESSAGES over LANG: got %q", got)
+	}
+	if got := userLocale("de"); got != "de" {
+		t.Errorf("config over LC_MESSAGES: got %q", got)
+	}
+	t.Setenv(envLocale, "pt_BR")
+	if got := userLocale("de"); got != "pt_BR" {
+		t.Errorf("OG_LOCALE over config: got %q", got)
+	}
+}
+
+func TestLocaleCandidates(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   []string
+	}{
+		{"de_DE.UTF-8", []string{"de_DE", "de"}},
+		{"pt-BR", []string{"pt_BR", "pt"}},
+		{"sr_RS@latin", []string{"sr_RS", "sr"}},
+		{"DE", []string{"de"}},
+		{"en_US.UTF-8", nil},
+		{"C.UTF-8", nil},
+		{"POSIX", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := localeCandidates(tt.locale); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("localeCandidates(%q) = %v, want %v", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	if catalog := loadCatalog("en_GB", ""); catalog != nil {
+		t.Errorf("English catalog = %v, want none", catalog)
+	}
+	if catalog := loadCatalog("xx", ""); catalog != nil {
+		t.Errorf("unknown locale catalog = %v, want none", catalog)
+	}
+
+	catalog := loadCatalog("de_AT.UTF-8", "")
+	if got := catalog["No results found."]; got != "Keine Treffer gefunden." {
+		t.Errorf("de_AT falls back to de: got %q", got)
+	}
+
+	// A catalog in locale_dir adds to the built-in one and can add languages
+	dir := t.TempDir()
+	write := func(name string, catalog messageCatalog) {
+		data, err := json.Marshal(catalog)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("de.json", messageCatalog{"No results found.": "Nichts gefunden."})
+	write("nl.json", messageCatalog{"Commands:\n": "Opdrachten:\n"})
+	catalog = loadCatalog("de", dir)
+	if catalog["No results found."] != "Nichts gefunden." || catalog["Commands:\n"] != "Befehle:\n" {
+		t.Errorf("de with locale_dir = %v", catalog)
+	}
+	if catalog = loadCatalog("nl_NL", dir); catalog["Commands:\n"] != "Opdrachten:\n" {
+		t.Errorf("nl from locale_dir = %v", catalog)
+	}
+}
+
+func TestBuiltinCatalogs(t *testing.T) {
+	entries, err := builtinCatalogs.ReadDir("locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		data, err := builtinCatalogs.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var catalog messageCatalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			t.Errorf("%s: %v", entry.Name(), err)
+			continue
+		}
+		for _, problem := range catalogProblems(catalog) {
+			t.Errorf("%s: %s", entry.Name(), problem)
+		}
+	}
+}
+
+func TestCatalogProblems(t *testing.T) {
+	catalog := messageCatalog{
+		"%d of %d lines shown": "%d von %d Zeilen angezeigt",
+		"Error: %v\n":          "Fehler: %s\n",
+		"%5.1f%% done in %v":   "%5.1f%% fertig",
+		"unknown command %q\n": "unbekannter Befehl %q\n",
+	}
+	if problems := catalogProblems(catalog); len(problems) != 2 {
+		t.Errorf("problems = %q, want the %%s and the missing %%v", problems)
+	}
+}
+
+func TestStderrMessagesTranslated(t *testing.T) {
+	// Errors and summaries on stderr go through trf so catalogs can
+	// translate them; a literal format written straight to stderr can't be
+	raw := regexp.MustCompile(`fmt\.Fprint(f|ln)?\(os\.Stderr, "(Error|\()`)
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, line := range strings.Split(string(data), "\n") {
+			if raw.MatchString(line) {
+				t.Errorf("%s:%d: untranslated message: %s", file, i+1, strings.TrimSpace(line))
+			}
+		}
+	}
+}
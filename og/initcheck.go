@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultTestQuery is the search 'og init --test-query' runs without a query
+// of its own: a word nearly every code base has
+const defaultTestQuery = "main"
+
+// endpointCheck is the outcome of trying one server endpoint at setup time
+type endpointCheck struct {
+	Name    string // e.g. "Projects"
+	OK      bool
+	Skipped bool   // Not tried, as an earlier check failed
+	Detail  string // What was found, or why it failed
+	Hint    string // How to fix a failure, "" if there is nothing to suggest
+}
+
+// checkServer tries the projects listing and a one-file search for query
+// with client's settings, so 'og init --test-query' catches a wrong URL or
+// missing credentials before the first real search
+func checkServer(ctx context.Context, client *Client, query string) []endpointCheck {
+	projects := checkProjects(ctx, client)
+	search := endpointCheck{Name: fmt.Sprintf("Search for %q", query)}
+	if !projects.OK {
+		// The search would fail the same way
+		search.Skipped = true
+		search.Detail = "the projects listing failed"
+		return []endpointCheck{projects, search}
+	}
+	resp, err := client.SearchContext(ctx, SearchOptions{Full: query, MaxResults: 1})
+	switch {
+	case err != nil:
+		search.Detail = err.Error()
+		search.Hint = searchRefusedHint(err)
+	default:
+		search.OK = true
+		search.Detail = fmt.Sprintf("%d matching files", resp.ResultCount)
+	}
+	return []endpointCheck{projects, search}
+}
+
+// checkProjects lists the server's projects, explaining failures by their
+// HTTP status: a missing REST API usually means the URL lacks OpenGrok's
+// context path, and a web page instead of JSON a login page in front of it
+func checkProjects(ctx context.Context, client *Client) endpointCheck {
+	check := endpointCheck{Name: "Projects"}
+	resp, err := client.RawRequestContext(ctx, http.MethodGet, "projects", nil)
+	if err != nil {
+		check.Detail = err.Error()
+		check.Hint = "Check the host name and port, and that the server is up."
+		return check
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var projects []string
+		if json.Unmarshal(resp.Body, &projects) != nil {
+			check.Detail = "the server answered with a web page, not the REST API"
+			check.Hint = "A login page (single sign-on) may be in front of OpenGrok: try 'og auth login --oidc', or an API key or bearer token."
+			return check
+		}
+		check.OK = true
+		check.Detail = fmt.Sprintf("%d projects", len(projects))
+	case http.StatusUnauthorized:
+		if client.HasAuth() {
+			check.Detail = "the credentials were rejected (401 Unauthorized)"
+			check.Hint = "Check the username and password, API key or token."
+		} else {
+			check.Detail = "authentication needed (401 Unauthorized)"
+			check.Hint = "Run 'og init' again with --username and --password, --api-key or --bearer-token."
+		}
+	case http.StatusForbidden:
+		check.Detail = "access denied (403 Forbidden)"
+		check.Hint = "The account may lack access to the REST API; ask the server's administrator."
+	case http.StatusNotFound:
+		check.Detail = "no REST API at this URL (404 Not Found)"
+		check.Hint = contextPathHint(client.BaseURL)
+	default:
+		check.Detail = "the server returned " + resp.Status
+	}
+	return check
+}
+
+// contextPathHint suggests a URL when the REST API isn't under the one
+// given: OpenGrok is usually deployed under a context path such as /source
+func contextPathHint(serverURL string) string {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return ""
+	}
+	switch path := strings.TrimRight(u.Path, "/"); {
+	case path == "":
+		return fmt.Sprintf("The URL may lack OpenGrok's context path: try %s/source, or the URL its web pages are under.", strings.TrimRight(serverURL, "/"))
+	case strings.HasSuffix(path, "/api/v1") || strings.HasSuffix(path, "/xref") || strings.HasSuffix(path, "/search"):
+		u.Path = path[:strings.LastIndex(path, "/")]
+		u.Path = strings.TrimSuffix(u.Path, "/api")
+		return fmt.Sprintf("Give the URL OpenGrok is deployed under, without the page or API path: try %s.", u.String())
+	}
+	return "Check the context path: the server URL is the one OpenGrok's web pages are under, e.g. http://host:8080/source."
+}
+
+// printServerChecks prints one line per check, with hints under failures,
+// and reports whether all passed
+func printServerChecks(w io.Writer, checks []endpointCheck) bool {
+	ok := true
+	for _, c := range checks {
+		status := "ok"
+		switch {
+		case c.Skipped:
+			status = "skipped"
+			ok = false
+		case !c.OK:
+			status = "FAILED"
+			ok = false
+		}
+		fmt.Fprintf(w, "%s: %s (%s)\n", c.Name, status, c.Detail)
+		if c.Hint != "" {
+			fmt.Fprintf(w, "  %s\n", c.Hint)
+		}
+	}
+	return ok
+}
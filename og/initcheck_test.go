@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		apiKey  string
+		want    []string
+		ok      bool
+	}{
+		{
+			"working server",
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v1/projects" {
+					w.Write([]byte(`["illumos-gate","smartos-live"]`))
+					return
+				}
+				w.Write([]byte(`{"resultCount":42,"results":{"/illumos-gate/main.c":[{"line":"int <b>main</b>()","lineNo":"3"}]}}`))
+			},
+			"",
+			[]string{"Projects: ok (2 projects)", `Search for "main": ok (42 matching files)`},
+			true,
+		},
+		{
+			"authentication needed",
+			func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) },
+			"",
+			[]string{"Projects: FAILED (authentication needed (401 Unauthorized))", "--api-key", `Search for "main": skipped`},
+			false,
+		},
+		{
+			"credentials rejected",
+			func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) },
+			"wrong",
+			[]string{"the credentials were rejected", "Check the username and password"},
+			false,
+		},
+		{
+			"login page",
+			func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("<html><form>Sign in</form></html>")) },
+			"",
+			[]string{"the server answered with a web page", "og auth login --oidc"},
+			false,
+		},
+		{
+			"missing context path",
+			http.NotFound,
+			"",
+			[]string{"no REST API at this URL (404 Not Found)", "/source, or the URL its web pages are under"},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			client, err := NewClient(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client.APIKey = tt.apiKey
+
+			var buf bytes.Buffer
+			ok := printServerChecks(&buf, checkServer(context.Background(), client, defaultTestQuery))
+			if ok != tt.ok {
+				t.Errorf("ok = %v, want %v", ok, tt.ok)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(buf.String(), s) {
+					t.Errorf("output missing %q:\n%s", s, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestContextPathHint(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"http://grok:8080", "try http://grok:8080/source"},
+		{"http://grok:8080/source/xref", "try http://grok:8080/source."},
+		{"http://grok:8080/source/api/v1/", "try http://grok:8080/source."},
+		{"http://grok:8080/src", "Check the context path"},
+	}
+	for _, tt := range tests {
+		if got := contextPathHint(tt.url); !strings.Contains(got, tt.want) {
+			t.Errorf("contextPathHint(%q) = %q, want it to contain %q", tt.url, got, tt.want)
+		}
+	}
+}
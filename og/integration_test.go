@@ -3,6 +3,7 @@
 package main
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"testing"
@@ -498,7 +499,7 @@ func TestIntegrationTrace(t *testing.T) {
 		Projects: "illumos-gate",
 	}
 
-	result, err := Trace(client, opts)
+	result, err := Trace(context.Background(), client, opts)
 	skipOnServerError(t, err)
 
 	if result == nil {
@@ -553,7 +554,7 @@ func TestIntegrationTraceFormatOutput(t *testing.T) {
 		Projects: "illumos-gate",
 	}
 
-	result, err := Trace(client, opts)
+	result, err := Trace(context.Background(), client, opts)
 	skipOnServerError(t, err)
 
 	// Format the output
@@ -581,7 +582,7 @@ func TestIntegrationTraceNoResults(t *testing.T) {
 		Projects: "illumos-gate",
 	}
 
-	result, err := Trace(client, opts)
+	result, err := Trace(context.Background(), client, opts)
 	// Note: This might return an error or empty result depending on the server
 
 	if err != nil {
@@ -620,7 +621,7 @@ func TestIntegrationTraceResultsSortedNumerically(t *testing.T) {
 		Projects: "illumos-gate",
 	}
 
-	result, err := Trace(client, opts)
+	result, err := Trace(context.Background(), client, opts)
 	skipOnServerError(t, err)
 
 	if result == nil {
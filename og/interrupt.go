@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// exitInterrupted is the exit status after Ctrl-C, as shells use (128+SIGINT)
+const exitInterrupted = 130
+
+// interruptContext returns a context canceled by the first Ctrl-C, which
+// aborts the request in flight so commands can print what they have so far.
+// A second Ctrl-C exits immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop() // Restore default handling for the next Ctrl-C
+	}()
+	return ctx, stop
+}
+
+// isInterrupted reports whether err comes from a Ctrl-C cancellation
+func isInterrupted(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// exitIfInterrupted reports the interruption and exits when err is one
+func exitIfInterrupted(w io.Writer, err error) {
+	if isInterrupted(err) {
+		fmt.Fprintln(w, "Interrupted.")
+		os.Exit(exitInterrupted)
+	}
+}
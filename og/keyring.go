@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringService is the service name og's secrets are stored under
+const keyringService = "og"
+
+// OS keyring access, overridden in tests. Secrets are keyed by account, which
+// is the config file path so separate configs get separate keys.
+var (
+	keyringGet    = osKeyringGet
+	keyringSet    = osKeyringSet
+	keyringDelete = osKeyringDelete
+)
+
+// osKeyringGet reads a secret using the macOS Keychain or the Secret Service
+// (via secret-tool) on Linux
+func osKeyringGet(account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keyringService, "-a", account, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keyringService, "account", account)
+	default:
+		return "", fmt.Errorf("OS keyring is not supported on %s", runtime.GOOS)
+	}
+	out, err := runKeyringCommand(cmd)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(out)
+	if secret == "" {
+		return "", fmt.Errorf("no key found for %s", account)
+	}
+	return secret, nil
+}
+
+// osKeyringSet stores a secret, replacing any existing one
+func osKeyringSet(account, secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// Both helpers read the secret from stdin, keeping it out of the
+		// process list. security prompts for it when -w is last and has no
+		// value, then asks again to confirm.
+		cmd = exec.Command("security", "add-generic-password", "-U", "-s", keyringService, "-a", account, "-w")
+		cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	case "linux":
+		cmd = exec.Command("secret-tool", "store", "--label=og config key", "service", keyringService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	default:
+		return fmt.Errorf("OS keyring is not supported on %s", runtime.GOOS)
+	}
+	_, err := runKeyringCommand(cmd)
+	return err
+}
+
+// osKeyringDelete removes a stored secret
+func osKeyringDelete(account string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", account)
+	case "linux":
+		cmd = exec.Command("secret-tool", "clear", "service", keyringService, "account", account)
+	default:
+		return fmt.Errorf("OS keyring is not supported on %s", runtime.GOOS)
+	}
+	_, err := runKeyringCommand(cmd)
+	return err
+}
+
+// runKeyringCommand runs a keyring helper, including its stderr in errors
+func runKeyringCommand(cmd *exec.Cmd) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", cmd.Args[0], msg)
+		}
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// getLastResultsPathDefault returns where the last search's results are
+// kept for 'og open-last', in the user's cache directory
+func getLastResultsPathDefault() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "og", "last_results.json"), nil
+}
+
+// getLastResultsPath is a variable that can be overridden in tests
+var getLastResultsPath = getLastResultsPathDefault
+
+// saveLastResults keeps a search's hits, numbered as --numbered shows them,
+// for 'og open-last'
+func saveLastResults(snap *ResultSnapshot) error {
+	path, err := getLastResultsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return saveResultSnapshot(path, snap)
+}
+
+// loadLastResults returns the hits of the last search
+func loadLastResults() (*ResultSnapshot, error) {
+	path, err := getLastResultsPath()
+	if err != nil {
+		return nil, err
+	}
+	snap, err := loadResultSnapshot(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no previous search results; run a search first")
+	}
+	return snap, err
+}
+
+// parseResultNumber parses the n of --open n or 'og open-last n'
+func parseResultNumber(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid result number %q (results are numbered from 1)", s)
+	}
+	return n, nil
+}
+
+// selectHit returns the nth (1-based) hit of a snapshot
+func selectHit(snap *ResultSnapshot, n int) (SnapshotHit, error) {
+	if n < 1 || n > len(snap.Hits) {
+		return SnapshotHit{}, fmt.Errorf("no result %d; the search had %d results", n, len(snap.Hits))
+	}
+	return snap.Hits[n-1], nil
+}
+
+// openHit opens a hit in the browser, or in a local editor when edit is set
+func openHit(serverURL string, hit SnapshotHit, edit bool) error {
+	name := displayPath(hit.Project, hit.Path)
+	if hit.LineNo != "" {
+		name += ":" + hit.LineNo
+	}
+	if edit {
+		local := newLocalPaths(loadLocalRoots()).resolve(hit.Project, hit.Path)
+		if local == "" {
+			return fmt.Errorf("%s is not in a local checkout (see 'og config local')", name)
+		}
+		args := editorCommand(editorFromEnv(), local, hit.LineNo)
+		fmt.Printf("Editing %s\n", name)
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+
+	webURL := xrefURL(serverURL, hit.Project, hit.Path, hit.LineNo)
+	fmt.Printf("Opening %s\n", name)
+	if err := openBrowser(webURL); err != nil {
+		return fmt.Errorf("opening browser: %w (URL: %s)", err, webURL)
+	}
+	return nil
+}
+
+// editorFromEnv returns the user's editor: $VISUAL, then $EDITOR, then vi
+func editorFromEnv() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// editorCommand returns the command that opens file at line in editor (which
+// may include arguments). GUI editors take "file:line"; the rest follow the
+// vi convention of "+line file".
+func editorCommand(editor, file, line string) []string {
+	args := strings.Fields(editor)
+	if line == "" {
+		return append(args, file)
+	}
+	switch strings.TrimSuffix(filepath.Base(args[0]), ".exe") {
+	case "code", "code-insiders", "codium":
+		return append(args, "-g", file+":"+line)
+	case "subl", "zed":
+		return append(args, file+":"+line)
+	}
+	return append(args, "+"+line, file)
+}
+
+// printNumberedResults prints each hit with its number for --open and
+// 'og open-last', compacted to one short line
+func printNumberedResults(w io.Writer, resp *SearchResponse, useColor bool, local *localPaths) {
+	entries := resp.OrderedEntries()
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No results found.")
+		return
+	}
+	width := len(strconv.Itoa(len(entries)))
+	for i, r := range entries {
+		name := local.display(r.Project, r.FilePath())
+		if r.LineNo != "" {
+			name += ":" + string(r.LineNo)
+		}
+		line := strings.TrimSpace(r.Line)
+		if useColor {
+			fmt.Fprintf(w, "%s%*d%s  %s%s%s  %s\n", colorCyan, width, i+1, colorReset, colorMagenta, name, colorReset, highlightMatch(line))
+		} else {
+			fmt.Fprintf(w, "%*d  %s  %s\n", width, i+1, name, stripHTMLTags(line))
+		}
+		printHitLabels(w, r.Labels, useColor)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLastResultsRoundTrip(t *testing.T) {
+	oldGetLastResultsPath := getLastResultsPath
+	defer func() { getLastResultsPath = oldGetLastResultsPath }()
+	path := filepath.Join(t.TempDir(), "cache", "og", "last_results.json")
+	getLastResultsPath = func() (string, error) { return path, nil }
+
+	if _, err := loadLastResults(); err == nil || !strings.Contains(err.Error(), "run a search first") {
+		t.Errorf("loadLastResults() before any search: err = %v", err)
+	}
+
+	resp := &SearchResponse{
+		ResultCount: 2,
+		Results: map[string][]SearchResult{
+			"proj": {
+				{Path: "/src/a.c", LineNo: "12", Line: "<b>panic</b>(msg);"},
+				{Path: "/src/b.c", LineNo: "3", Line: "panic();"},
+			},
+		},
+	}
+	if err := saveLastResults(newResultSnapshot(resp, "http://og", "full", "panic")); err != nil {
+		t.Fatal(err)
+	}
+	snap, err := loadLastResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hit, err := selectHit(snap, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (SnapshotHit{Project: "proj", Path: "/src/b.c", LineNo: "3", Line: "panic();"}); hit != want {
+		t.Errorf("selectHit(2) = %+v, want %+v", hit, want)
+	}
+	for _, n := range []int{0, 3} {
+		if _, err := selectHit(snap, n); err == nil || !strings.Contains(err.Error(), "had 2 results") {
+			t.Errorf("selectHit(%d): err = %v", n, err)
+		}
+	}
+}
+
+func TestParseResultNumber(t *testing.T) {
+	if n, err := parseResultNumber("3"); err != nil || n != 3 {
+		t.Errorf("parseResultNumber(\"3\") = %d, %v", n, err)
+	}
+	for _, s := range []string{"0", "-1", "x"} {
+		if _, err := parseResultNumber(s); err == nil {
+			t.Errorf("parseResultNumber(%q) succeeded", s)
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	tests := []struct {
+		editor, line string
+		want         []string
+	}{
+		{"vim", "12", []string{"vim", "+12", "/src/a.c"}},
+		{"emacs -nw", "12", []string{"emacs", "-nw", "+12", "/src/a.c"}},
+		{"code --wait", "12", []string{"code", "--wait", "-g", "/src/a.c:12"}},
+		{"/usr/local/bin/subl", "12", []string{"/usr/local/bin/subl", "/src/a.c:12"}},
+		{"vim", "", []string{"vim", "/src/a.c"}},
+	}
+	for _, tt := range tests {
+		if got := editorCommand(tt.editor, "/src/a.c", tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("editorCommand(%q, %q) = %q, want %q", tt.editor, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestPrintNumberedResults(t *testing.T) {
+	var results []SearchResult
+	for i := 1; i <= 10; i++ {
+		results = append(results, SearchResult{Path: "/src/a.c", LineNo: FlexibleString(strings.Repeat("1", i)), Line: "  <b>x</b>;"})
+	}
+	resp := &SearchResponse{ResultCount: 1, Results: map[string][]SearchResult{"proj": results}}
+
+	var buf bytes.Buffer
+	printNumberedResults(&buf, resp, false, nil)
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("got %d lines, want 10:\n%s", len(lines), buf.String())
+	}
+	if want := " 1  proj/src/a.c:1  x;"; lines[0] != want {
+		t.Errorf("first line = %q, want %q", lines[0], want)
+	}
+	if want := "10  proj/src/a.c:1111111111  x;"; lines[9] != want {
+		t.Errorf("last line = %q, want %q", lines[9], want)
+	}
+
+	buf.Reset()
+	printNumberedResults(&buf, &SearchResponse{}, false, nil)
+	if buf.String() != "No results found.\n" {
+		t.Errorf("empty results printed %q", buf.String())
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ResultTotals counts what a search returned and what was shown of it.
+// OpenGrok limits results by file (document), so line hits are only known
+// for the files that were fetched.
+type ResultTotals struct {
+	ShownLines    int `json:"shown_lines"`    // Line hits printed
+	FetchedLines  int `json:"fetched_lines"`  // Line hits in the fetched files
+	FetchedFiles  int `json:"fetched_files"`  // Files in the response
+	MatchingFiles int `json:"matching_files"` // Files matching the query on the server
+	// FirstFile and LastFile number the fetched files among the matching
+	// ones, from 1 (0 when none were fetched); past 1 with --page
+	FirstFile int   `json:"first_file"`
+	LastFile  int   `json:"last_file"`
+	ElapsedMs int64 `json:"elapsed_ms"` // Server search time (summed over pages)
+}
+
+// HiddenLines returns the number of fetched line hits cut by --max-lines
+func (t ResultTotals) HiddenLines() int {
+	return t.FetchedLines - t.ShownLines
+}
+
+// UnfetchedFiles returns the number of matching files beyond the file limit
+func (t ResultTotals) UnfetchedFiles() int {
+	return max(t.MatchingFiles-t.FetchedFiles, 0)
+}
+
+// Truncated reports whether any result was left out, by the line or the
+// file limit
+func (t ResultTotals) Truncated() bool {
+	return t.HiddenLines() > 0 || t.UnfetchedFiles() > 0
+}
+
+// String formats the totals as a one-line summary, in the user's language
+func (t ResultTotals) String() string {
+	files := trf("from %d of %d matching files", t.FetchedFiles, t.MatchingFiles)
+	if t.FirstFile > 1 {
+		files = trf("from matching files %d–%d of %d", t.FirstFile, t.LastFile, t.MatchingFiles)
+	}
+	s := trf("%d of %d lines shown, %s in %v",
+		t.ShownLines, t.FetchedLines, files, time.Duration(t.ElapsedMs)*time.Millisecond)
+	if t.Truncated() {
+		s += tr(" (truncated)")
+	}
+	return s
+}
+
+// MarshalJSON adds the truncation flag to the totals, so JSON output carries
+// the same summary as the text one
+func (t ResultTotals) MarshalJSON() ([]byte, error) {
+	type totals ResultTotals // Without this method
+	return json.Marshal(struct {
+		totals
+		Truncated bool `json:"truncated"`
+	}{totals(t), t.Truncated()})
+}
+
+// limitResultLines truncates resp to its first maxLines line hits (0 for no
+// limit) and returns the totals before and after truncation
+func limitResultLines(resp *SearchResponse, maxLines int) ResultTotals {
+	entries := resp.OrderedEntries()
+	totals := ResultTotals{
+		ShownLines:    len(entries),
+		FetchedLines:  len(entries),
+		FetchedFiles:  countResultFiles(entries),
+		MatchingFiles: resp.ResultCount,
+		ElapsedMs:     resp.Time,
+	}
+	totals.FirstFile, totals.LastFile = documentRange(resp, totals.FetchedFiles)
+	if maxLines > 0 && len(entries) > maxLines {
+		resp.Entries = entries[:maxLines]
+		totals.ShownLines = maxLines
+	}
+	return totals
+}
+
+// documentRange returns the 1-based numbers of the first and last of the
+// fetched files among the matching ones, from the response's startDocument
+// and endDocument (0-based, inclusive). Servers and test doubles that leave
+// endDocument out still get a range covering the files fetched.
+func documentRange(resp *SearchResponse, fetchedFiles int) (first, last int) {
+	if fetchedFiles == 0 {
+		return 0, 0
+	}
+	first = resp.StartDocument + 1
+	last = max(resp.EndDocument+1, first+fetchedFiles-1)
+	if resp.ResultCount > 0 {
+		last = min(last, resp.ResultCount)
+	}
+	return first, last
+}
+
+// countResultFiles returns the number of distinct files among entries
+func countResultFiles(entries []ResultEntry) int {
+	files := make(map[string]bool)
+	for _, e := range entries {
+		files[projectPath(e.Project, e.FilePath())] = true
+	}
+	return len(files)
+}
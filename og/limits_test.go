@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func newLimitTestResponse() *SearchResponse {
+	return &SearchResponse{
+		ResultCount: 40,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c", LineNo: "1"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c", LineNo: "5"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c", LineNo: "9"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/b.c", LineNo: "2"}},
+			{Project: "other", SearchResult: SearchResult{Directory: "/lib", Filename: "c.c", LineNo: "3"}},
+		},
+	}
+}
+
+func TestLimitResultLines(t *testing.T) {
+	resp := newLimitTestResponse()
+	totals := limitResultLines(resp, 2)
+
+	want := ResultTotals{ShownLines: 2, FetchedLines: 5, FetchedFiles: 3, MatchingFiles: 40, FirstFile: 1, LastFile: 3}
+	if totals != want {
+		t.Errorf("totals = %+v, want %+v", totals, want)
+	}
+	if totals.HiddenLines() != 3 {
+		t.Errorf("HiddenLines() = %d, want 3", totals.HiddenLines())
+	}
+	if entries := resp.OrderedEntries(); len(entries) != 2 || entries[1].LineNo != "5" {
+		t.Errorf("entries after truncation = %+v", entries)
+	}
+	if got := totals.String(); got != "2 of 5 lines shown, from 3 of 40 matching files in 0s (truncated)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestLimitResultLinesNoLimit(t *testing.T) {
+	for _, maxLines := range []int{0, 5, 10} {
+		resp := newLimitTestResponse()
+		totals := limitResultLines(resp, maxLines)
+		if totals.ShownLines != 5 || totals.HiddenLines() != 0 || len(resp.OrderedEntries()) != 5 {
+			t.Errorf("maxLines %d: totals = %+v", maxLines, totals)
+		}
+	}
+}
+
+func TestPrintResultTotals(t *testing.T) {
+	totals := ResultTotals{ShownLines: 2, FetchedLines: 5, FetchedFiles: 3, MatchingFiles: 40}
+
+	var buf bytes.Buffer
+	printResultTotals(&buf, totals, false)
+	want := "(3 more hits hidden; raise --max-lines to see them)\n2 of 5 lines shown, from 3 of 40 matching files in 0s (truncated)\n"
+	if buf.String() != want {
+		t.Errorf("output = %q, want %q", buf.String(), want)
+	}
+
+	// Quiet keeps the truncation warning but drops the summary
+	buf.Reset()
+	printResultTotals(&buf, totals, true)
+	if buf.String() != "(3 more hits hidden; raise --max-lines to see them)\n" {
+		t.Errorf("quiet output = %q", buf.String())
+	}
+}
+
+func TestResultTotalsSummary(t *testing.T) {
+	complete := ResultTotals{ShownLines: 5, FetchedLines: 5, FetchedFiles: 3, MatchingFiles: 3, ElapsedMs: 1250}
+	if got := complete.String(); got != "5 of 5 lines shown, from 3 of 3 matching files in 1.25s" {
+		t.Errorf("String() = %q", got)
+	}
+	// Files beyond --max truncate the results as much as hidden lines do
+	partial := ResultTotals{ShownLines: 5, FetchedLines: 5, FetchedFiles: 3, MatchingFiles: 9, FirstFile: 1, LastFile: 3, ElapsedMs: 12}
+	if !partial.Truncated() || partial.UnfetchedFiles() != 6 || complete.Truncated() {
+		t.Errorf("Truncated() = %v for %+v, %v for %+v", partial.Truncated(), partial, complete.Truncated(), complete)
+	}
+
+	data, err := json.Marshal(partial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"shown_lines":5,"fetched_lines":5,"fetched_files":3,"matching_files":9,"first_file":1,"last_file":3,"elapsed_ms":12,"truncated":true}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+}
+
+func TestResultTotalsPage(t *testing.T) {
+	// The second page of 3 files, as the server numbers it
+	resp := newLimitTestResponse()
+	resp.StartDocument, resp.EndDocument = 3, 5
+	totals := limitResultLines(resp, 0)
+	if totals.FirstFile != 4 || totals.LastFile != 6 {
+		t.Errorf("range = %d–%d, want 4–6", totals.FirstFile, totals.LastFile)
+	}
+	if got := totals.String(); got != "5 of 5 lines shown, from matching files 4–6 of 40 in 0s (truncated)" {
+		t.Errorf("String() = %q", got)
+	}
+
+	var buf bytes.Buffer
+	printPageNote(&buf, 2, 3, totals)
+	if buf.String() != "(page 2 of 14; --page 3 for more)\n" {
+		t.Errorf("page note = %q", buf.String())
+	}
+	buf.Reset()
+	printPageNote(&buf, 20, 3, ResultTotals{MatchingFiles: 40})
+	if buf.String() != "(page 20 is past the last page, 14)\n" {
+		t.Errorf("past the end = %q", buf.String())
+	}
+	buf.Reset()
+	printPageNote(&buf, 14, 3, ResultTotals{FetchedFiles: 1, MatchingFiles: 40, FirstFile: 40, LastFile: 40})
+	if buf.Len() != 0 {
+		t.Errorf("last page note = %q", buf.String())
+	}
+}
+
+func TestDocumentRange(t *testing.T) {
+	tests := []struct {
+		start, end, count, fetched int
+		first, last                int
+	}{
+		{0, 1, 2, 2, 1, 2},
+		{25, 49, 112, 25, 26, 50},
+		{0, 0, 450, 200, 1, 200}, // No endDocument: the files fetched
+		{100, 130, 120, 20, 101, 120},
+		{0, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		resp := &SearchResponse{StartDocument: tt.start, EndDocument: tt.end, ResultCount: tt.count}
+		if first, last := documentRange(resp, tt.fetched); first != tt.first || last != tt.last {
+			t.Errorf("documentRange(%+v, %d) = %d, %d; want %d, %d", tt, tt.fetched, first, last, tt.first, tt.last)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "og/pkg/linediff"
+
+// mapLine maps a 1-based line of a onto b. A line that survived unchanged maps
+// exactly. A changed line maps to the same offset within the replacement hunk
+// in b (clamped to its last line). Returns false if the hunk has no lines in
+// b, i.e. the line was added or removed outright.
+func mapLine(a, b []string, line int) (int, bool) {
+	idx := line - 1
+	if idx < 0 || idx >= len(a) {
+		return 0, false
+	}
+	lineMap := linediff.Map(a, b)
+	if lineMap[idx] >= 0 {
+		return lineMap[idx] + 1, true
+	}
+
+	// The hunk spans the unmatched lines between the nearest matched neighbours
+	startA, startB := 0, 0
+	for i := idx - 1; i >= 0; i-- {
+		if lineMap[i] >= 0 {
+			startA, startB = i+1, lineMap[i]+1
+			break
+		}
+	}
+	endB := len(b)
+	for i := idx + 1; i < len(a); i++ {
+		if lineMap[i] >= 0 {
+			endB = lineMap[i]
+			break
+		}
+	}
+	if endB <= startB {
+		return 0, false
+	}
+	return min(startB+idx-startA, endB-1) + 1, true
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// historyPageSize caps the number of file history entries fetched for a
+// line history; a line's commits are looked up among them
+const historyPageSize = 1000
+
+// LineChange is a commit that touched a line, newest first in a LineHistory
+type LineChange struct {
+	HistoryEntry
+	Line   int    // Line number in the file as of this revision
+	Text   string // Line content as of this revision
+	Parent string // Previous revision of the file, empty for its first commit
+	Added  bool   // The line did not exist before this commit
+}
+
+// LineHistory follows a line of a file back through version control and
+// returns up to max commits that changed it, newest first. Each step blames
+// the line, then maps it onto the previous revision of the file by diffing
+// the two versions; it stops at the commit that added the line. Commits found
+// before an error (including ctx being canceled) are returned with it.
+func LineHistory(ctx context.Context, client *Client, filePath string, line, max int) ([]LineChange, error) {
+	history, err := client.GetHistoryContext(ctx, filePath, historyPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch history: %w", err)
+	}
+
+	contents := make(map[string][]string)
+	fileLines := func(revision string) ([]string, error) {
+		if lines, ok := contents[revision]; ok {
+			return lines, nil
+		}
+		content, err := client.GetFileRevisionContext(ctx, filePath, revision)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+		contents[revision] = lines
+		return lines, nil
+	}
+
+	var changes []LineChange
+	revision := "" // Current version
+	for len(changes) < max {
+		blame, err := client.GetAnnotationContext(ctx, filePath, revision)
+		if err != nil {
+			return changes, fmt.Errorf("failed to fetch annotation: %w", err)
+		}
+		if line < 1 || line > len(blame) {
+			if revision == "" {
+				return nil, fmt.Errorf("line %d is out of range (%s has %d lines)", line, filePath, len(blame))
+			}
+			return changes, fmt.Errorf("line %d is out of range at revision %s", line, revision)
+		}
+		ann := blame[line-1]
+
+		idx := findRevision(history, ann.Revision)
+		if idx < 0 {
+			// Older than the fetched history; report what blame knows and stop
+			changes = append(changes, LineChange{
+				HistoryEntry: HistoryEntry{Revision: ann.Revision, Author: ann.Author, Message: ann.Description},
+				Line:         line,
+			})
+			break
+		}
+		change := LineChange{HistoryEntry: history[idx]}
+
+		// Blame reports line numbers in the blamed version; find the line in
+		// the version where the commit made it
+		from, err := fileLines(revision)
+		if err != nil {
+			return changes, err
+		}
+		at, err := fileLines(change.Revision)
+		if err != nil {
+			return changes, err
+		}
+		if change.Line, _ = mapLine(from, at, line); change.Line == 0 {
+			change.Line = line
+		}
+		if change.Line <= len(at) {
+			change.Text = at[change.Line-1]
+		}
+
+		if idx+1 >= len(history) {
+			// The file's first commit, unless the history was cut short
+			change.Added = len(history) < historyPageSize
+			changes = append(changes, change)
+			break
+		}
+		change.Parent = history[idx+1].Revision
+
+		before, err := fileLines(change.Parent)
+		if err != nil {
+			return changes, err
+		}
+		prevLine, ok := mapLine(at, before, change.Line)
+		change.Added = !ok
+		changes = append(changes, change)
+		if !ok {
+			break
+		}
+		revision, line = change.Parent, prevLine
+	}
+	return changes, nil
+}
+
+// findRevision returns the index of a revision in history. Blame and history
+// may abbreviate hashes differently, so a prefix of either side matches.
+func findRevision(history []HistoryEntry, revision string) int {
+	if revision == "" {
+		return -1
+	}
+	for i, e := range history {
+		if e.Revision != "" && (strings.HasPrefix(e.Revision, revision) || strings.HasPrefix(revision, e.Revision)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseFileLine splits a "project/path:line" argument into an API file path
+// ("/project/path") and line number
+func parseFileLine(arg string) (string, int, error) {
+	i := strings.LastIndex(arg, ":")
+	if i < 0 {
+		return "", 0, fmt.Errorf("expected <project>/<path>:<line>, got %q", arg)
+	}
+	line, err := strconv.Atoi(arg[i+1:])
+	if err != nil || line < 1 {
+		return "", 0, fmt.Errorf("invalid line number %q", arg[i+1:])
+	}
+	filePath := arg[:i]
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+	if strings.Count(filePath, "/") < 2 {
+		return "", 0, fmt.Errorf("expected <project>/<path>:<line>, got %q", arg)
+	}
+	return filePath, line, nil
+}
+
+// lineChangeURL returns the OpenGrok page showing a change: the diff against
+// the previous revision, or the file at the revision for its first commit
+func lineChangeURL(serverURL, filePath string, change LineChange) string {
+	if change.Parent == "" {
+		return fmt.Sprintf("%s/xref%s?r=%s#%d", serverURL, filePath, url.QueryEscape(change.Revision), change.Line)
+	}
+	return fmt.Sprintf("%s/diff%s?r1=%s&r2=%s", serverURL, filePath,
+		url.QueryEscape(filePath+"@"+change.Parent), url.QueryEscape(filePath+"@"+change.Revision))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseFileLine(t *testing.T) {
+	tests := []struct {
+		arg      string
+		wantPath string
+		wantLine int
+		wantErr  bool
+	}{
+		{"proj/src/main.c:120", "/proj/src/main.c", 120, false},
+		{"/proj/src/main.c:7", "/proj/src/main.c", 7, false},
+		{"proj/dir:with:colons.c:3", "/proj/dir:with:colons.c", 3, false},
+		{"proj/src/main.c", "", 0, true},
+		{"proj/src/main.c:0", "", 0, true},
+		{"proj/src/main.c:abc", "", 0, true},
+		{"main.c:5", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		path, line, err := parseFileLine(tt.arg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFileLine(%q) error = %v, wantErr %v", tt.arg, err, tt.wantErr)
+			continue
+		}
+		if path != tt.wantPath || line != tt.wantLine {
+			t.Errorf("parseFileLine(%q) = %q, %d, want %q, %d", tt.arg, path, line, tt.wantPath, tt.wantLine)
+		}
+	}
+}
+
+func TestMapLine(t *testing.T) {
+	a := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name   string
+		b      []string
+		line   int
+		want   int
+		wantOK bool
+	}{
+		{"unchanged", a, 3, 3, true},
+		{"shifted down", []string{"x", "y", "a", "b", "c", "d", "e"}, 3, 5, true},
+		{"changed in place", []string{"a", "b", "C", "d", "e"}, 3, 3, true},
+		{"hunk shrinks", []string{"a", "B", "e"}, 4, 2, true},
+		{"removed", []string{"a", "b", "d", "e"}, 3, 0, false},
+		{"out of range", a, 9, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := mapLine(a, tt.b, tt.line)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("mapLine(%d) = %d, %v, want %d, %v", tt.line, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// newLineHistoryServer serves three revisions of /proj/main.c. r2 changed the
+// line "x = 1" to "x = 2"; r3 inserted a header line above it.
+func newLineHistoryServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	files := map[string]string{
+		"r1": "a\nx = 1\nb\n",
+		"r2": "a\nx = 2\nb\n",
+		"r3": "header\na\nx = 2\nb\n",
+		"":   "header\na\nx = 2\nb\n",
+	}
+	blame := map[string][]string{
+		"":   {"r3", "r1", "r2", "r1"},
+		"r2": {"r1", "r2", "r1"},
+		"r1": {"r1", "r1", "r1"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/history", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "/proj/main.c" {
+			t.Errorf("history path = %q", r.URL.Query().Get("path"))
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"entries": []map[string]interface{}{
+				{"revision": "r3", "date": 1680307200000, "author": "carol", "message": "Add header"},
+				{"revision": "r2", "date": 1672531200000, "author": "bob", "message": "Bump x"},
+				{"revision": "r1", "date": 1640995200000, "author": "alice", "message": "Initial import"},
+			},
+		})
+	})
+	mux.HandleFunc("/api/v1/annotation", func(w http.ResponseWriter, r *http.Request) {
+		revs, ok := blame[r.URL.Query().Get("revision")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		var lines []LineAnnotation
+		for _, rev := range revs {
+			lines = append(lines, LineAnnotation{Revision: rev, Author: "someone"})
+		}
+		json.NewEncoder(w).Encode(lines)
+	})
+	mux.HandleFunc("/raw/proj/main.c", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Query().Get("r")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(content))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestLineHistory(t *testing.T) {
+	server := newLineHistoryServer(t)
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := LineHistory(context.Background(), client, "/proj/main.c", 3, 5)
+	if err != nil {
+		t.Fatalf("LineHistory failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("got %d changes, want 2: %+v", len(changes), changes)
+	}
+
+	if c := changes[0]; c.Revision != "r2" || c.Parent != "r1" || c.Line != 2 || c.Text != "x = 2" || c.Added {
+		t.Errorf("changes[0] = %+v", c)
+	}
+	if c := changes[1]; c.Revision != "r1" || c.Parent != "" || c.Line != 2 || c.Text != "x = 1" || !c.Added {
+		t.Errorf("changes[1] = %+v", c)
+	}
+
+	// --max stops early
+	changes, err = LineHistory(context.Background(), client, "/proj/main.c", 3, 1)
+	if err != nil || len(changes) != 1 || changes[0].Revision != "r2" {
+		t.Errorf("LineHistory(max 1) = %+v, %v", changes, err)
+	}
+
+	if _, err := LineHistory(context.Background(), client, "/proj/main.c", 10, 5); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("expected out of range error, got %v", err)
+	}
+}
+
+func TestPrintLineHistory(t *testing.T) {
+	changes := []LineChange{
+		{HistoryEntry: HistoryEntry{Revision: "0123456789abcdef", Date: "1672531200000", Author: "bob", Message: "Bump x"}, Line: 2, Text: "  x = 2", Parent: "r1"},
+	}
+
+	var buf bytes.Buffer
+	printLineHistory(&buf, "/proj/main.c", 3, changes, false)
+	out := buf.String()
+
+	for _, want := range []string{"proj/main.c:3\n", "0123456789ab 2023-01-01 bob (line 2)", "    Bump x\n", "    | x = 2\n", "use --max"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	changes[0].Added = true
+	buf.Reset()
+	printLineHistory(&buf, "/proj/main.c", 3, changes, false)
+	if out := buf.String(); !strings.Contains(out, "(line 2, added)") || strings.Contains(out, "use --max") {
+		t.Errorf("unexpected output for added line:\n%s", out)
+	}
+}
+
+func TestLineChangeURL(t *testing.T) {
+	diff := lineChangeURL("http://og", "/proj/main.c", LineChange{HistoryEntry: HistoryEntry{Revision: "r2"}, Parent: "r1", Line: 2})
+	if diff != "http://og/diff/proj/main.c?r1=%2Fproj%2Fmain.c%40r1&r2=%2Fproj%2Fmain.c%40r2" {
+		t.Errorf("diff URL = %s", diff)
+	}
+	first := lineChangeURL("http://og", "/proj/main.c", LineChange{HistoryEntry: HistoryEntry{Revision: "r1"}, Line: 2, Added: true})
+	if first != "http://og/xref/proj/main.c?r=r1#2" {
+		t.Errorf("first commit URL = %s", first)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// parseLineBounds reads the <start> <end> arguments of 'og lines'
+func parseLineBounds(startArg, endArg string) (start, end int, err error) {
+	start, err = strconv.Atoi(startArg)
+	if err != nil || start < 1 {
+		return 0, 0, fmt.Errorf("invalid start line %q", startArg)
+	}
+	end, err = strconv.Atoi(endArg)
+	if err != nil || end < 1 {
+		return 0, 0, fmt.Errorf("invalid end line %q", endArg)
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("end line %d is before start line %d", end, start)
+	}
+	return start, end, nil
+}
+
+// printLineRange prints lines numbered from start, the numbers padded to
+// the widest. A non-empty link (the xref URL of the first line) is printed
+// on its own line first, so the excerpt pastes with a way back to it.
+func printLineRange(w io.Writer, lines []string, start int, link string, useColor bool) {
+	if link != "" {
+		fmt.Fprintln(w, link)
+	}
+	width := len(strconv.Itoa(start + len(lines) - 1))
+	for i, line := range lines {
+		if useColor {
+			fmt.Fprintf(w, "%s%*d%s  %s\n", colorCyan, width, start+i, colorReset, line)
+		} else {
+			fmt.Fprintf(w, "%*d  %s\n", width, start+i, line)
+		}
+	}
+}
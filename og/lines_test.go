@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseLineBounds(t *testing.T) {
+	if start, end, err := parseLineBounds("98", "102"); err != nil || start != 98 || end != 102 {
+		t.Errorf("parseLineBounds(98, 102) = %d, %d, %v", start, end, err)
+	}
+	for _, args := range [][2]string{{"0", "5"}, {"x", "5"}, {"5", ""}, {"10", "9"}} {
+		if _, _, err := parseLineBounds(args[0], args[1]); err == nil {
+			t.Errorf("parseLineBounds(%q, %q) succeeded", args[0], args[1])
+		}
+	}
+}
+
+func TestPrintLineRange(t *testing.T) {
+	var buf bytes.Buffer
+	printLineRange(&buf, []string{"\tif (x)", "\t\treturn;", "}"}, 98, "http://og/source/xref/proj/src/a.c#98", false)
+	want := "http://og/source/xref/proj/src/a.c#98\n" +
+		" 98  \tif (x)\n" +
+		" 99  \t\treturn;\n" +
+		"100  }\n"
+	if buf.String() != want {
+		t.Errorf("printLineRange() = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minLineWidth is the narrowest a result line's text is cut to when it is
+// fitted to the terminal, however long its path
+const minLineWidth = 20
+
+// lineLayout is how printResults fits long result lines, such as those of
+// minified or generated files, to the screen
+type lineLayout struct {
+	// MaxWidth is the most columns a line's text may take (--max-line-width),
+	// 0 for no limit
+	MaxWidth int
+	// Terminal, without MaxWidth, is the terminal width whole output lines
+	// are fitted to (0 when not on a terminal)
+	Terminal int
+	// Wrap continues long lines on the following lines instead of cutting
+	// them
+	Wrap bool
+}
+
+// textWidth returns the columns left for a line's text after a prefix
+// ("path:line:") of the given width, 0 for no limit
+func (l lineLayout) textWidth(prefix int) int {
+	switch {
+	case l.MaxWidth > 0:
+		return l.MaxWidth
+	case l.Terminal > 0:
+		return max(l.Terminal-prefix, minLineWidth)
+	}
+	return 0
+}
+
+// format renders a result line (OpenGrok's HTML, matches in <b>) after a
+// prefix of the given width: highlighted or plain, and cut or wrapped to
+// fit. Wrapped lines continue under the text, indented by the prefix.
+func (l lineLayout) format(line string, prefix int, useColor bool) string {
+	width := l.textWidth(prefix)
+	if width <= 0 {
+		if useColor {
+			return highlightMatch(line)
+		}
+		return stripHTMLTags(line)
+	}
+	render := func(text string, spans []MatchSpan) string {
+		if useColor {
+			return highlightSpans(text, spans)
+		}
+		return text
+	}
+
+	text, spans := parseMatches(line)
+	if !l.Wrap {
+		return render(fitMatchLine(text, spans, width))
+	}
+	var sb strings.Builder
+	for i, chunk := range wrapMatchLine(text, spans, width) {
+		if i > 0 {
+			sb.WriteString("\n" + strings.Repeat(" ", prefix))
+		}
+		sb.WriteString(render(chunk.text, chunk.spans))
+	}
+	return sb.String()
+}
+
+// runeOffsets returns the byte offset of each rune of s, followed by len(s)
+func runeOffsets(s string) []int {
+	offsets := make([]int, 0, len(s)+1)
+	for i := range s {
+		offsets = append(offsets, i)
+	}
+	return append(offsets, len(s))
+}
+
+// runeIndex returns the rune a byte offset in offsets (see runeOffsets)
+// falls in
+func runeIndex(offsets []int, byteOffset int) int {
+	return sort.SearchInts(offsets, byteOffset)
+}
+
+// sliceMatches returns the part of spans between the byte offsets from and
+// to of their text, shifted so from becomes shift
+func sliceMatches(spans []MatchSpan, from, to, shift int) []MatchSpan {
+	var sliced []MatchSpan
+	for _, s := range spans {
+		start, end := max(s.Start, from), min(s.End, to)
+		if start < end {
+			sliced = append(sliced, MatchSpan{Start: start - from + shift, End: end - from + shift})
+		}
+	}
+	return sliced
+}
+
+// fitMatchLine cuts text to width runes around its first match, replacing
+// what is cut at either end with "…", and returns it with spans moved to
+// match. The match is centered in the part kept; a match wider than that
+// keeps its start. Lines that fit are returned as they are.
+func fitMatchLine(text string, spans []MatchSpan, width int) (string, []MatchSpan) {
+	offsets := runeOffsets(text)
+	n := len(offsets) - 1
+	if width <= 0 || n <= width {
+		return text, spans
+	}
+	width = max(width, 3)
+
+	focusStart, focusEnd := 0, 0
+	if len(spans) > 0 {
+		focusStart, focusEnd = runeIndex(offsets, spans[0].Start), runeIndex(offsets, spans[0].End)
+	}
+	start := focusStart - (width-(focusEnd-focusStart))/2
+	if focusEnd-focusStart >= width-2 {
+		// Room for the ellipsis before the match
+		start = focusStart - 1
+	}
+	start = max(0, min(start, n-width))
+	end := start + width
+
+	var head, tail string
+	if start > 0 {
+		start++
+		head = "…"
+	}
+	if end < n {
+		end--
+		tail = "…"
+	}
+	from, to := offsets[start], offsets[end]
+	return head + text[from:to] + tail, sliceMatches(spans, from, to, len(head))
+}
+
+// wrappedLine is one line of a wrapped result line
+type wrappedLine struct {
+	text  string
+	spans []MatchSpan
+}
+
+// wrapMatchLine splits text into lines of width runes, each with the parts
+// of spans that fall in it
+func wrapMatchLine(text string, spans []MatchSpan, width int) []wrappedLine {
+	offsets := runeOffsets(text)
+	n := len(offsets) - 1
+	if width <= 0 || n <= width {
+		return []wrappedLine{{text, spans}}
+	}
+	var lines []wrappedLine
+	for start := 0; start < n; start += width {
+		from, to := offsets[start], offsets[min(start+width, n)]
+		lines = append(lines, wrappedLine{text[from:to], sliceMatches(spans, from, to, 0)})
+	}
+	return lines
+}
+
+// resultPrefixWidth returns the columns "name:lineNo:" takes before a
+// result line's text
+func resultPrefixWidth(name, lineNo string) int {
+	width := displayWidth(name) + 1
+	if lineNo != "" {
+		width += utf8.RuneCountInString(lineNo) + 1
+	}
+	return width
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFitMatchLine(t *testing.T) {
+	long := strings.Repeat("a", 40) + "<b>needle</b>" + strings.Repeat("z", 40)
+	tests := []struct {
+		name, line string
+		width      int
+		want       string
+		match      string // Text of the first span after fitting
+	}{
+		{"fits", "x = <b>needle</b>;", 40, "x = needle;", "needle"},
+		{"match centered", long, 20, "…aaaaaaneedlezzzzzz…", "needle"},
+		{"match at start", "<b>needle</b>" + strings.Repeat("z", 40), 12, "needlezzzzz…", "needle"},
+		{"match at end", strings.Repeat("a", 40) + "<b>needle</b>", 12, "…aaaaaneedle", "needle"},
+		{"wide match", "aaaa<b>" + strings.Repeat("n", 30) + "</b>zz", 10, "…nnnnnnnn…", "nnnnnnnn"},
+		{"no match", strings.Repeat("a", 30), 10, "aaaaaaaaa…", ""},
+		{"multibyte", "ééééé<b>ü</b>ééééé", 5, "…éüé…", "ü"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, spans := parseMatches(tt.line)
+			got, gotSpans := fitMatchLine(text, spans, tt.width)
+			if got != tt.want {
+				t.Errorf("fitMatchLine() = %q, want %q", got, tt.want)
+			}
+			var match string
+			if len(gotSpans) > 0 {
+				match = got[gotSpans[0].Start:gotSpans[0].End]
+			}
+			if match != tt.match {
+				t.Errorf("first match = %q, want %q", match, tt.match)
+			}
+		})
+	}
+}
+
+func TestLineLayoutFormat(t *testing.T) {
+	line := "var x = \"" + strings.Repeat("a", 20) + "<b>key</b>" + strings.Repeat("b", 20) + "\";"
+
+	if got := (lineLayout{}).format(line, 10, false); got != stripHTMLTags(line) {
+		t.Errorf("without a width = %q, want the line unchanged", got)
+	}
+	if got := (lineLayout{Terminal: 40}).format(line, 10, false); len([]rune(got)) != 30 || !strings.Contains(got, "key") {
+		t.Errorf("fitted to the terminal = %q, want 30 columns around the match", got)
+	}
+	if got := (lineLayout{MaxWidth: 16, Terminal: 200}).format(line, 10, false); got != "…aaaaakeybbbbbb…" {
+		t.Errorf("--max-line-width 16 = %q", got)
+	}
+
+	wrapped := (lineLayout{MaxWidth: 20, Wrap: true}).format(line, 4, false)
+	want := "var x = \"" + strings.Repeat("a", 11) + "\n    " + strings.Repeat("a", 9) + "keybbbbbbbb\n    " + strings.Repeat("b", 12) + "\";"
+	if wrapped != want {
+		t.Errorf("wrapped =\n%s\nwant\n%s", wrapped, want)
+	}
+	// A match split across lines is highlighted on both
+	split := (lineLayout{MaxWidth: 5, Wrap: true}).format("abcd<b>efgh</b>", 0, true)
+	if strings.Count(split, colorRed) != 2 {
+		t.Errorf("split match = %q, want it highlighted on both lines", split)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// localPaths rewrites result paths to files in local checkouts (--local-paths).
+// A nil *localPaths leaves paths alone.
+type localPaths struct {
+	roots    map[string]string // Project name to checkout root
+	resolved map[string]string // "project/path" to local file, "" if missing
+	unmapped map[string]bool   // Projects seen without a root
+	missing  int               // Files not found in their checkout
+}
+
+// newLocalPaths returns a path mapper for the given project roots
+func newLocalPaths(roots map[string]string) *localPaths {
+	return &localPaths{roots: roots, resolved: make(map[string]string), unmapped: make(map[string]bool)}
+}
+
+// resolve returns the local file for a result path ("/dir/file" within
+// project), or "" if the project has no root or the file does not exist there
+func (l *localPaths) resolve(project, path string) string {
+	if l == nil {
+		return ""
+	}
+	root, ok := l.roots[project]
+	if !ok {
+		l.unmapped[project] = true
+		return ""
+	}
+	if local, ok := l.resolved[project+path]; ok {
+		return local
+	}
+	local := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(path, "/")))
+	if info, err := os.Stat(local); err != nil || info.IsDir() {
+		l.missing++
+		local = ""
+	}
+	l.resolved[project+path] = local
+	return local
+}
+
+// display returns the path to show for a result: the local file when there
+// is one, otherwise the usual "project/path"
+func (l *localPaths) display(project, path string) string {
+	if local := l.resolve(project, path); local != "" {
+		return local
+	}
+	return displayPath(project, path)
+}
+
+// warn reports results that were left with their server paths
+func (l *localPaths) warn(w io.Writer) {
+	if l == nil {
+		return
+	}
+	if len(l.unmapped) > 0 {
+		projects := make([]string, 0, len(l.unmapped))
+		for p := range l.unmapped {
+			projects = append(projects, p)
+		}
+		sort.Strings(projects)
+		fmt.Fprintf(w, "Warning: no local checkout configured for %s (see 'og config local')\n", strings.Join(projects, ", "))
+	}
+	if l.missing > 0 {
+		fmt.Fprintf(w, "Warning: %d files not found in their local checkout; showing server paths\n", l.missing)
+	}
+}
+
+// loadLocalRoots returns the project checkout roots from the config file
+func loadLocalRoots() map[string]string {
+	if cfg, _ := LoadConfig(); cfg != nil {
+		return cfg.LocalRoots
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPathsResolve(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "src", "main.c"), []byte("int main;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	local := newLocalPaths(map[string]string{"proj": root})
+
+	want := filepath.Join(root, "src", "main.c")
+	if got := local.display("proj", "/src/main.c"); got != want {
+		t.Errorf("display(existing) = %q, want %q", got, want)
+	}
+	if got := local.display("proj", "/src/gone.c"); got != "proj/src/gone.c" {
+		t.Errorf("display(missing) = %q, want server path", got)
+	}
+	if got := local.display("proj", "/src"); got != "proj/src" {
+		t.Errorf("display(directory) = %q, want server path", got)
+	}
+	if got := local.display("other", "/a.c"); got != "other/a.c" {
+		t.Errorf("display(unmapped) = %q, want server path", got)
+	}
+	// Repeated lookups are cached and not counted twice
+	local.display("proj", "/src/gone.c")
+
+	var buf bytes.Buffer
+	local.warn(&buf)
+	out := buf.String()
+	if !strings.Contains(out, "no local checkout configured for other") {
+		t.Errorf("missing unmapped warning:\n%s", out)
+	}
+	if !strings.Contains(out, "2 files not found") {
+		t.Errorf("missing not-found warning:\n%s", out)
+	}
+}
+
+func TestLocalPathsNil(t *testing.T) {
+	var local *localPaths
+	if got := local.display("proj", "/a.c"); got != "proj/a.c" {
+		t.Errorf("nil display = %q", got)
+	}
+	if got := local.resolve("proj", "/a.c"); got != "" {
+		t.Errorf("nil resolve = %q", got)
+	}
+	var buf bytes.Buffer
+	local.warn(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("nil warn wrote %q", buf.String())
+	}
+}
+
+func TestLocalRootsConfigRoundTrip(t *testing.T) {
+	oldGetConfigPath := getConfigPath
+	defer func() { getConfigPath = oldGetConfigPath }()
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	getConfigPath = func() (string, error) { return configFile, nil }
+
+	if err := SaveConfig(&Config{ServerURL: "http://og", LocalRoots: map[string]string{"proj": "/home/me/src/proj"}}); err != nil {
+		t.Fatal(err)
+	}
+	roots := loadLocalRoots()
+	if roots["proj"] != "/home/me/src/proj" {
+		t.Errorf("loadLocalRoots() = %v", roots)
+	}
+}
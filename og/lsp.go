@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	flag "github.com/spf13/pflag"
+)
+
+// og lsp answers go-to-definition and find-references for an editor over the
+// Language Server Protocol, using OpenGrok as the index. Editor files are
+// mapped to project paths through the local checkouts of 'og config local',
+// and results are mapped back the same way, so only results inside a
+// configured checkout can be opened.
+
+// maxLSPMessage caps the Content-Length of a message from the editor, so a
+// malformed header can't make the server allocate without bound
+const maxLSPMessage = 64 * 1024 * 1024
+
+// JSON-RPC and LSP error codes
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspRequestFailed  = -32803
+)
+
+// lspMessage is an incoming request or notification (notifications have no ID)
+type lspMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// lspResponse answers a request with either a result (possibly null) or an error
+type lspResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"` // UTF-16 code units
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position lspPosition `json:"position"`
+}
+
+type lspDidChangeParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"` // didOpen only
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// lspServer serves one editor session. Requests are handled one at a time.
+type lspServer struct {
+	client     *Client
+	roots      map[string]string // Project name to checkout root
+	projects   string            // Search scope; "" searches the document's project
+	maxResults int
+	local      *localPaths
+	docs       map[string]string // Open documents by URI, as last synced
+	log        io.Writer
+	out        *bufio.Writer
+}
+
+func newLSPServer(client *Client, roots map[string]string, projects string, maxResults int) *lspServer {
+	return &lspServer{
+		client:     client,
+		roots:      roots,
+		projects:   projects,
+		maxResults: maxResults,
+		local:      newLocalPaths(roots),
+		docs:       make(map[string]string),
+		log:        io.Discard,
+	}
+}
+
+// run reads messages from in and writes responses to out until the editor
+// sends "exit" or closes the stream
+func (s *lspServer) run(ctx context.Context, in io.Reader, out io.Writer) error {
+	r := bufio.NewReader(in)
+	s.out = bufio.NewWriter(out)
+	for {
+		body, err := readLSPMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg lspMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			fmt.Fprintf(s.log, "og lsp: ignoring malformed message: %v\n", err)
+			continue
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		result, rpcErr := s.handle(ctx, msg)
+		if msg.ID == nil {
+			continue // Notifications get no response
+		}
+		resp := lspResponse{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr}
+		if rpcErr == nil {
+			if resp.Result, err = json.Marshal(result); err != nil {
+				return err
+			}
+		}
+		if err := writeLSPMessage(s.out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle dispatches one message, returning its result or error
+func (s *lspServer) handle(ctx context.Context, msg lspMessage) (interface{}, *lspError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":   1, // Full document text on every change
+				"definitionProvider": true,
+				"referencesProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "og"},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+		var params lspDidChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.syncDocument(msg.Method, params)
+		}
+		return nil, nil
+	case "textDocument/definition", "textDocument/references":
+		var params lspPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+		}
+		locations, err := s.locate(ctx, msg.Method == "textDocument/definition", params)
+		if err != nil {
+			fmt.Fprintf(s.log, "og lsp: %s: %v\n", msg.Method, err)
+			return nil, &lspError{Code: lspRequestFailed, Message: err.Error()}
+		}
+		return locations, nil
+	}
+	if msg.ID != nil {
+		return nil, &lspError{Code: lspMethodNotFound, Message: "method not supported: " + msg.Method}
+	}
+	return nil, nil // Other notifications ("initialized", "$/cancelRequest", ...)
+}
+
+// syncDocument records the text of open documents, which may differ from
+// the files on disk
+func (s *lspServer) syncDocument(method string, params lspDidChangeParams) {
+	uri := params.TextDocument.URI
+	switch method {
+	case "textDocument/didOpen":
+		s.docs[uri] = params.TextDocument.Text
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[uri] = params.ContentChanges[n-1].Text
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+	}
+}
+
+// locate searches OpenGrok for the definitions (or references) of the symbol
+// under the cursor and returns the results found in local checkouts
+func (s *lspServer) locate(ctx context.Context, definitions bool, params lspPositionParams) ([]lspLocation, error) {
+	filePath, err := fileURIPath(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	lines := strings.Split(text, "\n")
+	if params.Position.Line < 0 || params.Position.Line >= len(lines) {
+		return nil, fmt.Errorf("line %d is outside the document", params.Position.Line)
+	}
+	symbol := symbolAt(strings.TrimSuffix(lines[params.Position.Line], "\r"), params.Position.Character)
+	if symbol == "" {
+		return nil, nil
+	}
+
+	opts := SearchOptions{Projects: s.projects, MaxResults: s.maxResults}
+	if opts.Projects == "" {
+		opts.Projects = projectForFile(s.roots, filePath)
+	}
+	if definitions {
+		opts.Def = symbol
+	} else {
+		opts.Symbol = symbol
+	}
+	resp, err := s.client.SearchContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	locations := []lspLocation{}
+	skipped := 0
+	for _, r := range resp.OrderedEntries() {
+		local := s.local.resolve(r.Project, r.FilePath())
+		line, err := strconv.Atoi(string(r.LineNo))
+		if local == "" || err != nil || line < 1 {
+			skipped++
+			continue
+		}
+		// The column comes from the hit's text, which is the line as indexed
+		start := 0
+		if text := html.UnescapeString(stripHTMLTags(r.Line)); strings.Contains(text, symbol) {
+			start = utf16Len(text[:strings.Index(text, symbol)])
+		}
+		locations = append(locations, lspLocation{
+			URI: fileURI(local),
+			Range: lspRange{
+				Start: lspPosition{Line: line - 1, Character: start},
+				End:   lspPosition{Line: line - 1, Character: start + utf16Len(symbol)},
+			},
+		})
+	}
+	if skipped > 0 {
+		fmt.Fprintf(s.log, "og lsp: %d results for %s are not in a local checkout (see 'og config local')\n", skipped, symbol)
+	}
+	return locations, nil
+}
+
+// projectForFile returns the project whose checkout holds filePath, or "".
+// Nested checkouts resolve to the innermost.
+func projectForFile(roots map[string]string, filePath string) string {
+	projects := make([]string, 0, len(roots))
+	for p := range roots {
+		projects = append(projects, p)
+	}
+	// Longest roots first, so the innermost checkout wins
+	sort.Slice(projects, func(i, j int) bool {
+		if len(roots[projects[i]]) != len(roots[projects[j]]) {
+			return len(roots[projects[i]]) > len(roots[projects[j]])
+		}
+		return projects[i] < projects[j]
+	})
+	for _, p := range projects {
+		rel, err := filepath.Rel(filepath.Clean(roots[p]), filepath.Clean(filePath))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return p
+	}
+	return ""
+}
+
+// symbolAt returns the identifier at a UTF-16 column of line, or just before
+// it when the cursor sits at the identifier's end
+func symbolAt(line string, character int) string {
+	offset := byteOffset(line, character)
+	isIdent := func(b byte) bool {
+		return b == '_' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+	}
+	if (offset >= len(line) || !isIdent(line[offset])) && offset > 0 && isIdent(line[offset-1]) {
+		offset--
+	}
+	if offset >= len(line) || !isIdent(line[offset]) {
+		return ""
+	}
+	start, end := offset, offset
+	for start > 0 && isIdent(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdent(line[end]) {
+		end++
+	}
+	if line[start] >= '0' && line[start] <= '9' {
+		return "" // A number, not a name
+	}
+	return line[start:end]
+}
+
+// byteOffset converts a UTF-16 column of line to a byte offset
+func byteOffset(line string, character int) int {
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+// utf16Len returns the length of s in UTF-16 code units, LSP's column unit
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// fileURIPath returns the local path of a file:// URI
+func fileURIPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported document URI %q: only file:// is supported", uri)
+	}
+	p := u.Path
+	if runtime.GOOS == "windows" {
+		p = strings.TrimPrefix(p, "/") // "/C:/src/a.c"
+	}
+	return filepath.FromSlash(p), nil
+}
+
+// fileURI returns the file:// URI of a local path
+func fileURI(path string) string {
+	p := filepath.ToSlash(path)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // Windows drive letter
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+// readLSPMessage reads one message body framed by a Content-Length header
+func readLSPMessage(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read message header: %w", err)
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	if length > maxLSPMessage {
+		return nil, fmt.Errorf("message too large (%d bytes)", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("failed to read message body: %w", err)
+	}
+	return body, nil
+}
+
+// writeLSPMessage writes v as a message framed by a Content-Length header
+func writeLSPMessage(w *bufio.Writer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body))
+	w.Write(body)
+	return w.Flush()
+}
+
+func handleLSP() {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	projects := fs.StringP("projects", "p", "", "Projects to search (default: the project of the file being edited; @group expands a project group, linux-* matches project names)")
+	maxResults := fs.Int("max", 100, "Maximum results per request")
+	verbose := fs.BoolP("verbose", "v", false, "Log failed requests and results outside local checkouts to stderr")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lsp [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Run a language server on stdin/stdout answering go-to-definition and\n")
+		fmt.Fprintf(os.Stderr, "find-references from OpenGrok. Files are mapped to projects through the\n")
+		fmt.Fprintf(os.Stderr, "local checkouts set with 'og config local'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:])
+
+	roots := loadLocalRoots()
+	if len(roots) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: no local checkouts configured; run '%s config local <project> <dir>'\n", os.Args[0]))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	s := newLSPServer(client, roots, resolveProjects(*projects, client), *maxResults)
+	if *verbose {
+		s.log = os.Stderr
+	}
+	if err := s.run(context.Background(), os.Stdin, os.Stdout); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+}
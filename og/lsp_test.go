@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lspRequests frames messages as an editor would send them
+func lspRequests(t *testing.T, messages ...string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, m := range messages {
+		if !json.Valid([]byte(m)) {
+			t.Fatalf("invalid test message %s", m)
+		}
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return &buf
+}
+
+// readLSPResponses decodes every response the server wrote
+func readLSPResponses(t *testing.T, out *bytes.Buffer) []lspResponse {
+	t.Helper()
+	r := bufio.NewReader(out)
+	var responses []lspResponse
+	for {
+		body, err := readLSPMessage(r)
+		if err != nil {
+			return responses
+		}
+		var resp lspResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+}
+
+func TestLSPDefinitionAndReferences(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"src/main.c":  "int main(void) {\n\treturn vn_rele(vp);\n}\n",
+		"src/vnode.c": "void\nvn_rele(vnode_t *vp)\n{\n}\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries = append(queries, fmt.Sprintf("def=%s symbol=%s projects=%s", q.Get("def"), q.Get("symbol"), strings.Join(q["projects"], ",")))
+		if q.Get("def") != "" {
+			fmt.Fprint(w, `{"resultCount": 2, "results": {
+				"/proj/src/vnode.c": [{"line": "<b>vn_rele</b>(vnode_t *vp)", "lineNo": "2", "path": "/proj/src/vnode.c"}],
+				"/other/vnode.c": [{"line": "vn_rele(vnode_t *vp)", "lineNo": "9", "path": "/other/vnode.c"}]}}`)
+			return
+		}
+		fmt.Fprint(w, `{"resultCount": 1, "results": {"/proj/src/main.c": [{"line": "\treturn <b>vn_rele</b>(vp);", "lineNo": "2", "path": "/proj/src/main.c"}]}}`)
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := fileURI(filepath.Join(root, "src", "main.c"))
+	// The open buffer differs from the file on disk: the call moved down a line
+	in := lspRequests(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "initialized", "params": {}}`,
+		fmt.Sprintf(`{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": %q, "text": "int main(void) {\n\n\treturn vn_rele(vp);\n}\n"}}}`, uri),
+		fmt.Sprintf(`{"jsonrpc": "2.0", "id": 2, "method": "textDocument/definition", "params": {"textDocument": {"uri": %q}, "position": {"line": 2, "character": 12}}}`, uri),
+		fmt.Sprintf(`{"jsonrpc": "2.0", "id": 3, "method": "textDocument/references", "params": {"textDocument": {"uri": %q}, "position": {"line": 2, "character": 15}, "context": {"includeDeclaration": true}}}`, uri),
+		fmt.Sprintf(`{"jsonrpc": "2.0", "id": 4, "method": "textDocument/definition", "params": {"textDocument": {"uri": %q}, "position": {"line": 1, "character": 0}}}`, uri),
+		`{"jsonrpc": "2.0", "id": 5, "method": "textDocument/hover", "params": {}}`,
+		`{"jsonrpc": "2.0", "id": 6, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "method": "exit"}`,
+	)
+	var out bytes.Buffer
+	s := newLSPServer(client, map[string]string{"proj": root}, "", 100)
+	if err := s.run(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := readLSPResponses(t, &out)
+	if len(responses) != 6 {
+		t.Fatalf("got %d responses, want one per request: %+v", len(responses), responses)
+	}
+	if !strings.Contains(string(responses[0].Result), `"definitionProvider":true`) {
+		t.Errorf("initialize = %s", responses[0].Result)
+	}
+
+	// Only the definition inside the checkout is returned
+	vnode := fileURI(filepath.Join(root, "src", "vnode.c"))
+	want := fmt.Sprintf(`[{"uri":%q,"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":7}}}]`, vnode)
+	if got := string(responses[1].Result); got != want {
+		t.Errorf("definition = %s, want %s", got, want)
+	}
+	want = fmt.Sprintf(`[{"uri":%q,"range":{"start":{"line":1,"character":8},"end":{"line":1,"character":15}}}]`, uri)
+	if got := string(responses[2].Result); got != want {
+		t.Errorf("references = %s, want %s", got, want)
+	}
+	if got := string(responses[3].Result); got != "null" {
+		t.Errorf("definition on a blank line = %s, want null", got)
+	}
+	if responses[4].Error == nil || responses[4].Error.Code != lspMethodNotFound {
+		t.Errorf("hover = %+v, want method not found", responses[4])
+	}
+	if string(responses[5].Result) != "null" || responses[5].Error != nil {
+		t.Errorf("shutdown = %+v", responses[5])
+	}
+
+	// Searches are scoped to the edited file's project
+	wantQueries := []string{"def=vn_rele symbol= projects=proj", "def= symbol=vn_rele projects=proj"}
+	if strings.Join(queries, "\n") != strings.Join(wantQueries, "\n") {
+		t.Errorf("queries = %q, want %q", queries, wantQueries)
+	}
+}
+
+func TestReadLSPMessageLimits(t *testing.T) {
+	for header, want := range map[string]string{
+		"Content-Length: 99999999999\r\n\r\n": "too large",
+		"Content-Length: -1\r\n\r\n":          "invalid Content-Length",
+		"Content-Length: x\r\n\r\n":           "invalid Content-Length",
+	} {
+		_, err := readLSPMessage(bufio.NewReader(strings.NewReader(header)))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: err = %v, want %q", header, err, want)
+		}
+	}
+}
+
+func TestSymbolAt(t *testing.T) {
+	tests := []struct {
+		line      string
+		character int
+		want      string
+	}{
+		{"\treturn vn_rele(vp);", 8, "vn_rele"},
+		{"\treturn vn_rele(vp);", 14, "vn_rele"},
+		{"\treturn vn_rele(vp);", 15, "vn_rele"}, // Just after the name
+		{"\treturn vn_rele(vp);", 16, "vp"},
+		{"\treturn vn_rele(vp);", 0, ""},
+		{"x = 42;", 5, ""},
+		{"s := \"é\" + name", 12, "name"}, // é is one UTF-16 unit but two bytes
+		{"", 0, ""},
+		{"abc", 10, "abc"},
+	}
+	for _, tt := range tests {
+		if got := symbolAt(tt.line, tt.character); got != tt.want {
+			t.Errorf("symbolAt(%q, %d) = %q, want %q", tt.line, tt.character, got, tt.want)
+		}
+	}
+}
+
+func TestProjectForFile(t *testing.T) {
+	roots := map[string]string{
+		"kernel":  "/src/kernel",
+		"drivers": "/src/kernel/drivers",
+		"kern":    "/src/kern",
+	}
+	tests := map[string]string{
+		"/src/kernel/sched.c":         "kernel",
+		"/src/kernel/drivers/usb/x.c": "drivers",
+		"/src/kern/a.c":               "kern",
+		"/src/kernelx/a.c":            "",
+		"/elsewhere/a.c":              "",
+	}
+	for path, want := range tests {
+		if got := projectForFile(roots, filepath.FromSlash(path)); got != want {
+			t.Errorf("projectForFile(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
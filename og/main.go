@@ -1,13 +1,21 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/briandowns/spinner"
 	flag "github.com/spf13/pflag"
 )
 
@@ -18,12 +26,15 @@ const (
 	colorMagenta = "\033[35m"
 	colorRed     = "\033[31m"
 	colorCyan    = "\033[36m"
+	colorGreen   = "\033[32m"
 )
 
 // htmlTagRegex is pre-compiled for stripping HTML tags from output
 var htmlTagRegex = regexp.MustCompile(`<[^>]+>`)
 
 func main() {
+	os.Args, globalServerURL = extractGlobalServer(os.Args)
+
 	// Check for subcommands first
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
@@ -33,6 +44,9 @@ func main() {
 		case "status":
 			handleStatus()
 			return
+		case "whoami":
+			handleWhoami()
+			return
 		case "projects":
 			handleProjects()
 			return
@@ -42,10 +56,75 @@ func main() {
 		case "trace":
 			handleTrace()
 			return
-		case "-h", "--help", "help":
+		case "auth":
+			handleAuth()
+			return
+		case "config":
+			handleConfig()
+			return
+		case "serve":
+			handleServe()
+			return
+		case "lsp":
+			handleLSP()
+			return
+		case "cat":
+			handleCat()
+			return
+		case "lines":
+			handleLines()
+			return
+		case "export-xref":
+			handleExportXref()
+			return
+		case "api":
+			handleAPI()
+			return
+		case "line-history":
+			handleLineHistory()
+			return
+		case "compare":
+			handleCompare()
+			return
+		case "todo":
+			handleTodo()
+			return
+		case "project-stats":
+			handleProjectStats()
+			return
+		case "fileinfo":
+			handleFileInfo()
+			return
+		case "annotate":
+			handleAnnotate()
+			return
+		case "diff-results":
+			handleDiffResults()
+			return
+		case "open-last":
+			handleOpenLast()
+			return
+		case "watchlist":
+			handleWatchlist()
+			return
+		case "help":
+			handleHelp()
+			return
+		case "man":
+			handleMan()
+			return
+		case "-h", "--help":
 			printUsage(os.Stdout)
 			return
 		}
+		if isImplicitQuery(os.Args[1]) {
+			if name := mistypedCommand(os.Args[1]); name != "" {
+				fmt.Fprint(os.Stderr, trf("Error: unknown command %q (did you mean %q?); to search for it, run '%s full %s'\n", os.Args[1], name, os.Args[0], os.Args[1]))
+				os.Exit(1)
+			}
+			handleImplicitSearch()
+			return
+		}
 	}
 
 	// No valid command provided
@@ -53,49 +132,10 @@ func main() {
 	os.Exit(1)
 }
 
-func printUsage(w *os.File) {
-	fmt.Fprintf(w, "og - Search OpenGrok instances from the command line\n\n")
-	fmt.Fprintf(w, "Usage: %s <command> [options]\n\n", os.Args[0])
-	fmt.Fprintf(w, "Commands:\n")
-	fmt.Fprintf(w, "  init <server-url>    Initialize with server URL (saves to config)\n")
-	fmt.Fprintf(w, "  status               Show current server URL configuration\n")
-	fmt.Fprintf(w, "  projects             List available projects\n")
-	fmt.Fprintf(w, "  full <query>         Full text search\n")
-	fmt.Fprintf(w, "  def <query>          Definition search (find where symbols are defined)\n")
-	fmt.Fprintf(w, "  symbol <query>       Symbol search (find symbol references)\n")
-	fmt.Fprintf(w, "  path <pattern>       Path search (search file paths)\n")
-	fmt.Fprintf(w, "  hist <query>         History search (search version control history)\n")
-	fmt.Fprintf(w, "  trace <symbol>       Trace call graph (find callers of a symbol)\n")
-	fmt.Fprintf(w, "\nSearch Options:\n")
-	fmt.Fprintf(w, "  -s, --server <url>       OpenGrok server URL (overrides config)\n")
-	fmt.Fprintf(w, "  -p, --projects <list>    Comma-separated list of projects to search\n")
-	fmt.Fprintf(w, "  -t, --type <ext>         File type filter\n")
-	fmt.Fprintf(w, "  -m, --max <n>            Maximum number of results (default: 25)\n")
-	fmt.Fprintf(w, "      --web                Open results in system web browser\n")
-	fmt.Fprintf(w, "  -w, --web-links          Display clickable OpenGrok URLs for file references\n")
-	fmt.Fprintf(w, "  -q, --quiet              Suppress progress output (spinners)\n")
-	fmt.Fprintf(w, "\nAuthentication Options:\n")
-	fmt.Fprintf(w, "      --username <user>    Username for basic authentication\n")
-	fmt.Fprintf(w, "      --password <pass>    Password for basic authentication\n")
-	fmt.Fprintf(w, "      --api-key <key>      API key for authentication\n")
-	fmt.Fprintf(w, "      --bearer-token <tok> Bearer token for authentication\n")
-	fmt.Fprintf(w, "\nTrace Options:\n")
-	fmt.Fprintf(w, "  -d, --depth <n>          Maximum traversal depth (default: 2)\n")
-	fmt.Fprintf(w, "      --max-total <n>      Maximum total nodes to explore (default: 100)\n")
-	fmt.Fprintf(w, "\nExamples:\n")
-	fmt.Fprintf(w, "  %s init http://opengrok.example.com/source\n", os.Args[0])
-	fmt.Fprintf(w, "  %s status\n", os.Args[0])
-	fmt.Fprintf(w, "  %s full \"TODO\"\n", os.Args[0])
-	fmt.Fprintf(w, "  %s def \"main\" --projects myproject\n", os.Args[0])
-	fmt.Fprintf(w, "  %s projects\n", os.Args[0])
-	fmt.Fprintf(w, "  %s full \"TODO\" --web\n", os.Args[0])
-	fmt.Fprintf(w, "  %s trace malloc --depth 3 --projects myproject\n", os.Args[0])
-}
-
 func handleStatus() {
 	config, err := LoadConfig()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to load config: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
 		os.Exit(1)
 	}
 	if config == nil || config.ServerURL == "" {
@@ -104,6 +144,12 @@ func handleStatus() {
 		os.Exit(0)
 	}
 	fmt.Printf("Server URL: %s\n", config.ServerURL)
+	if config.APIBase != "" {
+		fmt.Printf("API base: %s\n", config.APIBase)
+	}
+	if config.XrefBase != "" {
+		fmt.Printf("Xref base: %s\n", config.XrefBase)
+	}
 
 	// Show authentication status
 	if config.BearerToken != "" {
@@ -112,9 +158,14 @@ func handleStatus() {
 		fmt.Println("Authentication: API key configured")
 	} else if config.Username != "" {
 		fmt.Printf("Authentication: Basic auth (user: %s)\n", config.Username)
+	} else if config.OIDC != nil && config.OIDC.loggedIn() {
+		fmt.Printf("Authentication: %s\n", NewOIDCProvider(config.OIDC, nil).Describe())
 	} else {
 		fmt.Println("Authentication: None")
 	}
+	if config.Encrypted != nil {
+		fmt.Printf("Credentials: Encrypted (%s)\n", config.Encrypted.KeySource)
+	}
 
 	// Show web-links setting
 	if config.WebLinks {
@@ -122,6 +173,48 @@ func handleStatus() {
 	}
 }
 
+func handleWhoami() {
+	fs := flag.NewFlagSet("whoami", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+	noProbe := fs.Bool("no-probe", false, "Only show the credentials, without contacting the server")
+	fs.Parse(os.Args[2:])
+
+	url := getServerURL(*serverURL)
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	configPath, _ := getConfigPath()
+	opts := AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	}
+	printWhoami(os.Stdout, url, serverSource(*serverURL, configPath), chooseAuth(opts, envAuthOptions(), config), configPath, config)
+	if *noProbe {
+		return
+	}
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	configureClientAuth(client, opts)
+	ctx, stop := interruptContext()
+	defer stop()
+	if !printServerChecks(os.Stdout, []endpointCheck{checkProjects(ctx, client)}) {
+		exitIfInterrupted(os.Stderr, ctx.Err())
+		os.Exit(1)
+	}
+}
+
 // AuthOptions holds authentication options parsed from flags
 type AuthOptions struct {
 	Username    string
@@ -131,87 +224,3194 @@ type AuthOptions struct {
 }
 
 // configureClientAuth applies authentication settings to a client
-// Priority: flags > config file
+// Priority: flags > environment > config file
 func configureClientAuth(client *Client, opts AuthOptions) {
 	// Load config for defaults
-	config, _ := LoadConfig()
+	config, err := LoadConfig()
+	if errors.Is(err, ErrConfigLocked) {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	choice := chooseAuth(opts, envAuthOptions(), config)
+	client.BearerToken = choice.BearerToken
+	client.APIKey = choice.APIKey
+	client.Username, client.Password = choice.Username, choice.Password
+	if choice.OIDC != nil {
+		client.Auth = NewOIDCProvider(choice.OIDC, func(updated *OIDCConfig) error {
+			config.OIDC = updated
+			return SaveConfig(config)
+		})
+	}
+}
+
+func handleAuth() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s auth <login|logout> [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "login":
+		handleAuthLogin()
+	case "logout":
+		handleAuthLogout()
+	default:
+		fmt.Fprint(os.Stderr, trf("Error: unknown auth command %q\n", os.Args[2]))
+		fmt.Fprintf(os.Stderr, "Usage: %s auth <login|logout> [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+}
+
+func handleAuthLogin() {
+	fs := flag.NewFlagSet("auth login", flag.ExitOnError)
+	oidc := fs.Bool("oidc", false, "Log in using the OIDC device authorization flow")
+	issuer := fs.String("issuer", "", "OIDC issuer URL (defaults to the saved issuer)")
+	clientID := fs.String("client-id", "", "OIDC client ID (defaults to the saved client ID)")
+	scopes := fs.String("scopes", "", "Space-separated scopes to request (default: \"openid offline_access\")")
+	noBrowser := fs.Bool("no-browser", false, "Do not open the verification URL in a browser")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s auth login --oidc --issuer <url> --client-id <id> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+
+	if !*oidc {
+		fmt.Fprint(os.Stderr, trf("Error: only --oidc login is supported\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil || config.ServerURL == "" {
+		fmt.Fprint(os.Stderr, trf("Error: no server URL configured\n"))
+		fmt.Fprintf(os.Stderr, "Run '%s init <server-url>' first\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	oidcConfig := &OIDCConfig{Scopes: "openid offline_access"}
+	if config.OIDC != nil {
+		oidcConfig.Issuer = config.OIDC.Issuer
+		oidcConfig.ClientID = config.OIDC.ClientID
+		if config.OIDC.Scopes != "" {
+			oidcConfig.Scopes = config.OIDC.Scopes
+		}
+	}
+	if *issuer != "" {
+		oidcConfig.Issuer = strings.TrimSuffix(*issuer, "/")
+	}
+	if *clientID != "" {
+		oidcConfig.ClientID = *clientID
+	}
+	if *scopes != "" {
+		oidcConfig.Scopes = *scopes
+	}
+	if oidcConfig.Issuer == "" || oidcConfig.ClientID == "" {
+		fmt.Fprint(os.Stderr, trf("Error: --issuer and --client-id are required for the first login\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Static credentials take priority over OIDC, so they are removed on
+	// login; say so before any are lost
+	var replaced []string
+	if config.BearerToken != "" {
+		replaced = append(replaced, "bearer token")
+	}
+	if config.APIKey != "" {
+		replaced = append(replaced, "API key")
+	}
+	if config.Username != "" {
+		replaced = append(replaced, "basic auth credentials")
+	}
+	if len(replaced) > 0 {
+		fmt.Fprint(os.Stderr, trf("Warning: logging in removes the %s saved in the config\n", strings.Join(replaced, " and ")))
+	}
 
-	// Apply flags first (highest priority)
-	if opts.BearerToken != "" {
-		client.BearerToken = opts.BearerToken
-	} else if opts.APIKey != "" {
-		client.APIKey = opts.APIKey
-	} else if opts.Username != "" {
-		client.Username = opts.Username
-		client.Password = opts.Password
-	} else if config != nil {
-		// Fall back to config file
-		if config.BearerToken != "" {
-			client.BearerToken = config.BearerToken
-		} else if config.APIKey != "" {
-			client.APIKey = config.APIKey
-		} else if config.Username != "" {
-			client.Username = config.Username
-			client.Password = config.Password
+	provider := NewOIDCProvider(oidcConfig, nil)
+	err = provider.DeviceLogin(func(verificationURL, userCode string) {
+		fmt.Printf("To log in, visit: %s\n", verificationURL)
+		fmt.Printf("and enter the code: %s\n", userCode)
+		if !*noBrowser {
+			openBrowser(verificationURL)
 		}
+		fmt.Println("Waiting for authorization...")
+	}, time.Sleep)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	config.Username = ""
+	config.Password = ""
+	config.APIKey = ""
+	config.BearerToken = ""
+	config.OIDC = oidcConfig
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
 	}
+	fmt.Printf("Logged in. Authentication: %s\n", provider.Describe())
 }
 
-func handleProjects() {
-	// Parse flags for projects command
-	fs := flag.NewFlagSet("projects", flag.ExitOnError)
-	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
-	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
-	username := fs.String("username", "", "Username for basic authentication")
-	password := fs.String("password", "", "Password for basic authentication")
-	apiKey := fs.String("api-key", "", "API key for authentication")
-	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
-	fs.Parse(os.Args[2:])
+func handleAuthLogout() {
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil || config.OIDC == nil || config.OIDC.AccessToken == "" {
+		fmt.Println("Not logged in.")
+		return
+	}
+
+	// Keep issuer and client ID so the next login needs no flags
+	config.OIDC.AccessToken = ""
+	config.OIDC.RefreshToken = ""
+	config.OIDC.Expiry = time.Time{}
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Println("Logged out.")
+}
+
+func handleConfig() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s config <encrypt|decrypt|group|groups|local|default-search|search-case|export|import> [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "encrypt":
+		handleConfigEncrypt()
+	case "decrypt":
+		handleConfigDecrypt()
+	case "group":
+		handleConfigGroup()
+	case "groups":
+		handleConfigGroups()
+	case "local":
+		handleConfigLocal()
+	case "default-search":
+		handleConfigDefaultSearch()
+	case "search-case":
+		handleConfigSearchCase()
+	case "export":
+		handleConfigExport()
+	case "import":
+		handleConfigImport()
+	default:
+		fmt.Fprint(os.Stderr, trf("Error: unknown config command %q\n", os.Args[2]))
+		fmt.Fprintf(os.Stderr, "Usage: %s config <encrypt|decrypt|group|groups|local|default-search|search-case|export|import> [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+}
+
+func handleConfigEncrypt() {
+	fs := flag.NewFlagSet("config encrypt", flag.ExitOnError)
+	useKeyring := fs.Bool("keyring", false, "Store a random key in the OS keyring instead of using a passphrase")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config encrypt [--keyring]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Encrypts the credentials in the config file. Without --keyring, a passphrase\n")
+		fmt.Fprintf(os.Stderr, "is read from %s or prompted for.\n\n", passphraseEnvVar)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		fmt.Fprint(os.Stderr, trf("Error: no config file found\n"))
+		fmt.Fprintf(os.Stderr, "Run '%s init <server-url>' first\n", os.Args[0])
+		os.Exit(1)
+	}
+	if config.Encrypted != nil {
+		fmt.Fprint(os.Stderr, trf("Error: credentials are already encrypted (%s)\n", config.Encrypted.KeySource))
+		fmt.Fprintf(os.Stderr, "Run '%s config decrypt' first to change how they are encrypted\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	passphrase := ""
+	if !*useKeyring {
+		passphrase = os.Getenv(passphraseEnvVar)
+		if passphrase == "" {
+			passphrase, err = readPassphrase("New config passphrase: ")
+			if err == nil && passphrase != "" {
+				var confirm string
+				confirm, err = readPassphrase("Confirm passphrase: ")
+				if err == nil && confirm != passphrase {
+					err = fmt.Errorf("passphrases do not match")
+				}
+			}
+			if err != nil {
+				fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+				os.Exit(1)
+			}
+		}
+		if passphrase == "" {
+			fmt.Fprint(os.Stderr, trf("Error: passphrase must not be empty\n"))
+			os.Exit(1)
+		}
+	}
+
+	if err := EnableConfigEncryption(config, passphrase); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Credentials encrypted (%s).\n", config.Encrypted.KeySource)
+}
+
+func handleConfigDecrypt() {
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil || config.Encrypted == nil {
+		fmt.Println("Credentials are not encrypted.")
+		return
+	}
+
+	if err := DisableConfigEncryption(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Println("Credentials decrypted.")
+}
+
+func handleConfigGroup() {
+	fs := flag.NewFlagSet("config group", flag.ExitOnError)
+	del := fs.Bool("delete", false, "Delete the group")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config group <name> [projects] [--delete]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Defines a project group used as --projects @name. Projects are\n")
+		fmt.Fprintf(os.Stderr, "comma-separated and may reference other groups. Without projects,\n")
+		fmt.Fprintf(os.Stderr, "prints the group.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 4 || strings.HasPrefix(os.Args[3], "-") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	name := strings.TrimPrefix(os.Args[3], groupPrefix)
+	members := ""
+	rest := os.Args[4:]
+	if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		members = rest[0]
+		rest = rest[1:]
+	}
+	fs.Parse(rest)
+
+	if err := validateGroupName(name); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	if *del {
+		if _, ok := config.ProjectGroups[name]; !ok {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", unknownGroupError(name, config.ProjectGroups)))
+			os.Exit(1)
+		}
+		delete(config.ProjectGroups, name)
+		if err := SaveConfig(config); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted group %s%s\n", groupPrefix, name)
+		return
+	}
+
+	if members == "" {
+		projects, ok := config.ProjectGroups[name]
+		if !ok {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", unknownGroupError(name, config.ProjectGroups)))
+			os.Exit(1)
+		}
+		fmt.Printf("%s%s = %s\n", groupPrefix, name, strings.Join(projects, ","))
+		return
+	}
+
+	projects := splitProjectList(members)
+	if len(projects) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: group %s%s must contain at least one project\n", groupPrefix, name))
+		os.Exit(1)
+	}
+
+	// Validate references to other groups (including cycles) before saving
+	groups := make(map[string][]string, len(config.ProjectGroups)+1)
+	for k, v := range config.ProjectGroups {
+		groups[k] = v
+	}
+	groups[name] = projects
+	expanded, err := expandProjects(groupPrefix+name, groups)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	config.ProjectGroups = groups
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Saved group %s%s = %s\n", groupPrefix, name, expanded)
+}
+
+func handleConfigGroups() {
+	groups := loadProjectGroups()
+	if len(groups) == 0 {
+		fmt.Println("No project groups defined.")
+		fmt.Printf("Run '%s config group <name> <projects>' to define one.\n", os.Args[0])
+		return
+	}
+	for _, name := range groupNames(groups) {
+		fmt.Printf("%s%s = %s\n", groupPrefix, name, strings.Join(groups[name], ","))
+	}
+}
+
+func handleConfigLocal() {
+	fs := flag.NewFlagSet("config local", flag.ExitOnError)
+	del := fs.Bool("delete", false, "Remove the project's local checkout")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config local [project] [dir] [--delete]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Maps a project to its local checkout so --local-paths can show\n")
+		fmt.Fprintf(os.Stderr, "results as local files. Without a dir, prints the mapping; without\n")
+		fmt.Fprintf(os.Stderr, "a project, lists all mappings.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	var args []string
+	rest := os.Args[3:]
+	for len(rest) > 0 && len(args) < 2 && !strings.HasPrefix(rest[0], "-") {
+		args = append(args, rest[0])
+		rest = rest[1:]
+	}
+	fs.Parse(rest)
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	if len(args) == 0 {
+		if *del {
+			fs.Usage()
+			os.Exit(1)
+		}
+		if len(config.LocalRoots) == 0 {
+			fmt.Println("No local checkouts configured.")
+			fmt.Printf("Run '%s config local <project> <dir>' to add one.\n", os.Args[0])
+			return
+		}
+		projects := make([]string, 0, len(config.LocalRoots))
+		for project := range config.LocalRoots {
+			projects = append(projects, project)
+		}
+		sort.Strings(projects)
+		for _, project := range projects {
+			fmt.Printf("%s = %s\n", project, config.LocalRoots[project])
+		}
+		return
+	}
+
+	project := args[0]
+	root, ok := config.LocalRoots[project]
+	if *del || len(args) == 1 {
+		if !ok {
+			fmt.Fprint(os.Stderr, trf("Error: no local checkout configured for %s\n", project))
+			os.Exit(1)
+		}
+		if !*del {
+			fmt.Printf("%s = %s\n", project, root)
+			return
+		}
+		delete(config.LocalRoots, project)
+		if err := SaveConfig(config); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+			os.Exit(1)
+		}
+		fmt.Printf("Removed local checkout for %s\n", project)
+		return
+	}
+
+	root, err = filepath.Abs(args[1])
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fmt.Fprint(os.Stderr, trf("Error: %s is not a directory\n", root))
+		os.Exit(1)
+	}
+	if config.LocalRoots == nil {
+		config.LocalRoots = make(map[string]string)
+	}
+	config.LocalRoots[project] = root
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Saved local checkout %s = %s\n", project, root)
+}
+
+func handleConfigDefaultSearch() {
+	fs := flag.NewFlagSet("config default-search", flag.ExitOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config default-search [type]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Sets the search run by '%s <query>' without a command (%s).\n", os.Args[0], strings.Join(searchTypes, ", "))
+		fmt.Fprintf(os.Stderr, "Queries that look like paths run a path search regardless.\n")
+		fmt.Fprintf(os.Stderr, "Without a type, prints the current default.\n")
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	if fs.NArg() == 0 {
+		if config.DefaultSearch == "" {
+			fmt.Println("full (default)")
+		} else {
+			fmt.Println(config.DefaultSearch)
+		}
+		return
+	}
+
+	searchType := fs.Arg(0)
+	if !isSearchType(searchType) {
+		fmt.Fprint(os.Stderr, trf("Error: %q is not a search type (%s)\n", searchType, strings.Join(searchTypes, ", ")))
+		os.Exit(1)
+	}
+	config.DefaultSearch = searchType
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Saved default search: %s\n", searchType)
+}
+
+func handleConfigSearchCase() {
+	fs := flag.NewFlagSet("config search-case", flag.ExitOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config search-case [mode]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Sets how searches without a case flag match case (%s),\n", strings.Join(caseModes, ", "))
+		fmt.Fprintf(os.Stderr, "or \"server\" to leave it to the server. Without a mode, prints the current one.\n")
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &Config{}
+	}
+
+	if fs.NArg() == 0 {
+		if config.SearchCase == "" {
+			fmt.Println("server (default)")
+		} else {
+			fmt.Println(config.SearchCase)
+		}
+		return
+	}
+
+	mode := fs.Arg(0)
+	if mode != "server" && !isCaseMode(mode) {
+		fmt.Fprint(os.Stderr, trf("Error: %q is not a case mode (%s, server)\n", mode, strings.Join(caseModes, ", ")))
+		os.Exit(1)
+	}
+	config.SearchCase = mode
+	if mode == "server" {
+		config.SearchCase = ""
+	}
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Saved search case: %s\n", mode)
+}
+
+func handleConfigExport() {
+	fs := flag.NewFlagSet("config export", flag.ExitOnError)
+	noSecrets := fs.Bool("no-secrets", false, "Leave out the username, password, API key and bearer token")
+	output := fs.StringP("output", "o", "", "Write the export to a file instead of stdout")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config export [--no-secrets] [-o file]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints the shareable part of the config as JSON: the server, project\n")
+		fmt.Fprintf(os.Stderr, "groups and defaults, for '%s config import' on another machine.\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Local checkouts, the annotations path, the daemon and OIDC tokens\n")
+		fmt.Fprintf(os.Stderr, "are left out.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		fmt.Fprint(os.Stderr, trf("Error: no config file found\n"))
+		fmt.Fprintf(os.Stderr, "Run '%s init <server-url>' first\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	exported := exportConfig(config, *noSecrets)
+	w := io.Writer(os.Stdout)
+	if *output != "" {
+		// Credentials may be in it, so keep it private like the config
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := writeConfigExport(w, exported); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if hasCredentials(exported) {
+		fmt.Fprint(os.Stderr, trf("Warning: the export includes credentials in plain text; use --no-secrets to share it\n"))
+	}
+}
+
+func handleConfigImport() {
+	fs := flag.NewFlagSet("config import", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Show what would change without saving")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config import <file|url|-> [--dry-run]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Merges a config written by '%s config export' into the local config.\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Settings it has replace the local ones and project groups are merged\n")
+		fmt.Fprintf(os.Stderr, "by name; local checkouts and other machine settings are kept.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	source := fs.Arg(0)
+
+	data, err := readConfigImport(source)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	imported, err := parseConfigImport(source, data)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load config: %v\n", err))
+		os.Exit(1)
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	oldServer := config.ServerURL
+	changed := mergeConfigImport(config, imported)
+	if len(changed) == 0 {
+		fmt.Println("Config already up to date.")
+		return
+	}
+	if problems := validateConfig(config); len(problems) > 0 {
+		fmt.Fprint(os.Stderr, trf("Error: the merged config would be invalid:\n  %s\n", strings.Join(problems, "\n  ")))
+		os.Exit(1)
+	}
+	if *dryRun {
+		fmt.Printf("Would update: %s\n", strings.Join(changed, ", "))
+		return
+	}
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+	fmt.Printf("Updated: %s\n", strings.Join(changed, ", "))
+	if oldServer != "" && config.ServerURL != oldServer && !hasCredentials(imported) && hasCredentials(config) {
+		fmt.Fprint(os.Stderr, trf("Warning: the server is now %s, but the credentials kept are the ones for %s\n", config.ServerURL, oldServer))
+	}
+}
+
+func handleProjects() {
+	// Parse flags for projects command
+	fs := flag.NewFlagSet("projects", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+	fs.Parse(os.Args[2:])
+
+	// Get server URL
+	url := getServerURL(*serverURL)
+
+	// Create client
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	// Configure authentication
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	progress := newProgress(*quietMode)
+	task := progress.Start("Fetching projects...")
+	projectsList, err := client.GetProjects()
+	task.Done()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error listing projects: %v\n", err))
+		os.Exit(1)
+	}
+
+	fmt.Println("Available projects:")
+	for _, project := range projectsList {
+		fmt.Printf("  - %s\n", project)
+	}
+}
+
+// handleImplicitSearch runs "og <query> [options]" as the search picked by
+// implicitSearchType
+func handleImplicitSearch() {
+	var defaultSearch string
+	if cfg, _ := LoadConfig(); cfg != nil {
+		defaultSearch = cfg.DefaultSearch
+	}
+	searchType, err := implicitSearchType(os.Args[1], defaultSearch)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	os.Args = append([]string{os.Args[0], searchType}, os.Args[1:]...)
+	handleSearch(searchType)
+}
+
+func handleSearch(searchType string) {
+	// Parse flags for search command
+	fs := flag.NewFlagSet(searchType, flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	typeFilter := fs.StringP("type", "t", "", "File type filter")
+	projects := fs.StringP("projects", "p", "", "Projects to search (comma-separated, @group expands a project group, linux-* matches project names)")
+	pathFilter := fs.String("path", "", "Only match files whose path matches this pattern (e.g. 'uts/common/*')")
+	pathGlobs := fs.StringArray("path-glob", nil, "Only keep hits in files matching this glob, ** for any directories (e.g. 'uts/**/io/*.c'); repeatable")
+	afterDate := fs.String("after", "", "hist: only commits on or after this date (YYYY-MM-DD or e.g. \"2 weeks ago\")")
+	beforeDate := fs.String("before", "", "hist: only commits on or before this date (YYYY-MM-DD or e.g. yesterday)")
+	author := fs.String("author", "", "hist: only commits whose author contains this text")
+	changedSince := fs.String("changed-since", "", "Only hits in files last changed on or after this date (YYYY-MM-DD or e.g. \"2 weeks ago\")")
+	maxResults := fs.IntP("max", "m", 25, "Maximum number of files to fetch (same as --max-files)")
+	maxFiles := fs.Int("max-files", 25, "Maximum number of files to fetch from the server")
+	maxLines := fs.Int("max-lines", 0, "Maximum number of line hits to print (0 for no limit)")
+	maxLineWidth := fs.Int("max-line-width", 0, "Cut result lines to this many columns, keeping the match in view (default: fit the terminal; 0 for no limit)")
+	wrapLines := fs.Bool("wrap", false, "Wrap long result lines onto the following lines instead of cutting them")
+	page := fs.Int("page", 0, "Show the nth page of matching files, --per-page files each")
+	perPage := fs.Int("per-page", 25, "Matching files per page with --page")
+	sortMode := fs.String("sort", "", "Sort results: path, lastmod (newest first, from file history), or relevance")
+	phrase := fs.Bool("phrase", false, "Match the query as an exact phrase")
+	andTerms := fs.StringArray("and", nil, "Additional term that must also match (repeatable)")
+	orTerms := fs.StringArray("or", nil, "Alternative term that may match instead of the query (repeatable)")
+	notTerms := fs.StringArray("not", nil, "Term that must not match (repeatable)")
+	ignoreCase := fs.BoolP("ignore-case", "i", false, "Match regardless of case, also for def and symbol searches")
+	caseSensitiveMode := fs.Bool("case-sensitive", false, "Match case exactly, also for full, path and hist searches (filtered client-side)")
+	smartCase := fs.BoolP("smart-case", "S", false, "Match case exactly if the query has an uppercase letter, else ignore case")
+	excludeDefs := fs.Bool("exclude-defs", false, "symbol: leave out the lines defining the symbol (found with a def search), showing only references")
+	treeMode := fs.Bool("tree", false, "Show matching files as a directory tree")
+	filesOnly := fs.BoolP("files-with-matches", "l", false, "Print only matching file paths, streaming through all result pages")
+	allPages := fs.Bool("all", false, "Fetch every matching file, page by page, spooling results to disk when they outgrow memory")
+	countMode := fs.Bool("count", false, "Only count matching files and lines per project, shown as a histogram")
+	localPathsMode := fs.Bool("local-paths", false, "Show paths in local checkouts (see 'og config local') instead of server paths")
+	templateText := fs.String("template", "", "Format each result with a Go template, e.g. '{{.Path}}:{{.LineNo}} {{.Line}}'")
+	saveResults := fs.String("save-results", "", "Also save the fetched results to this JSON file for 'og diff-results'")
+	jsonOutput := fs.Bool("json", false, "Print the hits as JSON, with the column span of each match; def searches print definitions (symbol, kind, signature, location)")
+	dryRun := fs.Bool("dry-run", false, "Print the HTTP request(s) that would be sent without sending them")
+	webMode := fs.Bool("web", false, "Open results in system web browser")
+	webLinks := fs.BoolP("web-links", "w", false, "Display clickable OpenGrok URLs for file references")
+	numbered := fs.BoolP("numbered", "N", false, "Print one numbered line per hit, for 'og open-last <n>'")
+	previewMode := fs.Bool("preview", false, "Show the source around the first hits, with the hit line marked")
+	previewHits := fs.Int("preview-hits", 5, "Number of hits to preview with --preview")
+	previewLines := fs.Int("preview-lines", 3, "Lines of source before and after each previewed hit")
+	openNth := fs.Int("open", 0, "Open the nth result in the system web browser")
+	editMode := fs.Bool("edit", false, "With --open, open the result in $VISUAL/$EDITOR in its local checkout")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners and the result summary)")
+	annotateText := fs.String("annotate", "", "Save this note with og_annotate on every line hit shown")
+	annotateTags := fs.StringArray("annotate-tag", nil, "Tag the --annotate notes (e.g. review); repeatable")
+	annotateAs := fs.String("annotate-author", "", "Author of the --annotate notes (default: $USER)")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory for --annotate (overrides config)")
+	annotateBin := fs.String("annotate-bin", "og_annotate", "og_annotate binary that saves the --annotate notes")
+	replacePattern := fs.String("replace", "", "Preview replacing this regex on the hit lines of your local checkouts, as a diff (no files are written)")
+	replaceWith := fs.String("replace-with", "", "Replacement text for --replace ($1 or ${name} for submatches)")
+	pipeCommand := fs.String("pipe", "", "Collect the hits, pass them as one JSON document (see --json) through this shell command and show the hits it prints back when it exits")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s <query> [server-url] [options]\n\n", os.Args[0], searchType)
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// We need at least one argument (the query)
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The query is the first argument after the command
+	query := os.Args[2]
+
+	// Check if query looks like a flag
+	if strings.HasPrefix(query, "-") {
+		fmt.Fprint(os.Stderr, trf("Error: query is required before options\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// Parse remaining flags (after query)
+	fs.Parse(os.Args[3:])
+
+	// A server URL after the query runs a one-off search without 'og init'
+	if fs.NArg() > 0 && looksLikeServerURL(fs.Arg(0)) && *serverURL == "" {
+		*serverURL = fs.Arg(0)
+	}
+
+	// --max and --max-files both limit files, which is what OpenGrok pages by
+	if fs.Changed("max") && fs.Changed("max-files") {
+		fmt.Fprint(os.Stderr, trf("Error: use either --max or --max-files, not both\n"))
+		os.Exit(1)
+	}
+	fileLimitSet := fs.Changed("max") || fs.Changed("max-files")
+	fileLimit := *maxFiles
+	if fs.Changed("max") {
+		fileLimit = *maxResults
+	}
+	if *maxLines < 0 {
+		fmt.Fprint(os.Stderr, trf("Error: --max-lines must not be negative\n"))
+		os.Exit(1)
+	}
+	if *maxLineWidth < 0 {
+		fmt.Fprint(os.Stderr, trf("Error: --max-line-width must not be negative\n"))
+		os.Exit(1)
+	}
+	// On a terminal, long lines are fitted to its width; piped output keeps
+	// them whole unless asked otherwise
+	layout := lineLayout{MaxWidth: *maxLineWidth, Wrap: *wrapLines}
+	if !fs.Changed("max-line-width") {
+		layout.Terminal = terminalWidth(os.Stdout)
+	}
+	// A page is a fixed range of files, fetched from --per-page times the
+	// pages before it
+	paging := fs.Changed("page") || fs.Changed("per-page")
+	if paging {
+		if fileLimitSet {
+			fmt.Fprint(os.Stderr, trf("Error: use either --per-page or --max/--max-files, not both\n"))
+			os.Exit(1)
+		}
+		if fs.Changed("page") && *page < 1 {
+			fmt.Fprint(os.Stderr, trf("Error: --page takes a page number, starting at 1\n"))
+			os.Exit(1)
+		}
+		if *perPage < 1 {
+			fmt.Fprint(os.Stderr, trf("Error: --per-page must be at least 1\n"))
+			os.Exit(1)
+		}
+		*page = max(*page, 1)
+		fileLimit = *perPage
+		fileLimitSet = true
+	}
+	// Every fetched file has at least one hit, so fetching as many files as
+	// lines wanted fills the line limit whenever there are enough matches
+	if !fileLimitSet && *maxLines > fileLimit {
+		fileLimit = *maxLines
+	}
+
+	var resultTemplate *template.Template
+	if *templateText != "" {
+		if *treeMode || *webMode || *filesOnly {
+			fmt.Fprint(os.Stderr, trf("Error: --template cannot be combined with --tree, --web or --files-with-matches\n"))
+			os.Exit(1)
+		}
+		var err error
+		if resultTemplate, err = parseResultTemplate(*templateText); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	after, err := parseHistoryDate("after", *afterDate)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	before, err := parseHistoryDate("before", *beforeDate)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if err := validateHistoryRange(after, before); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	histFilter := HistoryFilter{After: after, Before: before, Author: *author}
+	if histFilter.Active() {
+		if searchType != "hist" {
+			fmt.Fprint(os.Stderr, trf("Error: --after, --before and --author only apply to hist searches\n"))
+			os.Exit(1)
+		}
+		if *treeMode || *webMode || *filesOnly || *templateText != "" || *localPathsMode {
+			fmt.Fprint(os.Stderr, trf("Error: --after, --before and --author cannot be combined with --tree, --web, --files-with-matches, --template or --local-paths\n"))
+			os.Exit(1)
+		}
+		histFilter.Terms = historyTerms(query)
+	}
+	since, err := parseHistoryDate("changed-since", *changedSince)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if !since.IsZero() {
+		if searchType == "hist" {
+			fmt.Fprint(os.Stderr, trf("Error: --changed-since does not apply to hist searches; use --after\n"))
+			os.Exit(1)
+		}
+		if *filesOnly {
+			fmt.Fprint(os.Stderr, trf("Error: --changed-since cannot be combined with --files-with-matches\n"))
+			os.Exit(1)
+		}
+	}
+	if *pathFilter != "" && searchType == "path" {
+		fmt.Fprint(os.Stderr, trf("Error: --path cannot be used with path searches; put the pattern in the query\n"))
+		os.Exit(1)
+	}
+	if len(*pathGlobs) > 0 {
+		if searchType == "path" {
+			fmt.Fprint(os.Stderr, trf("Error: --path-glob cannot be used with path searches; put the pattern in the query\n"))
+			os.Exit(1)
+		}
+		if *allPages || *countMode {
+			fmt.Fprint(os.Stderr, trf("Error: --path-glob cannot be combined with --all or --count\n"))
+			os.Exit(1)
+		}
+		for _, pattern := range *pathGlobs {
+			if err := checkPathGlob(pattern); err != nil {
+				fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+				os.Exit(1)
+			}
+		}
+	}
+	if *excludeDefs {
+		if searchType != "symbol" {
+			fmt.Fprint(os.Stderr, trf("Error: --exclude-defs only applies to symbol searches\n"))
+			os.Exit(1)
+		}
+		if *filesOnly || *allPages || *countMode {
+			fmt.Fprint(os.Stderr, trf("Error: --exclude-defs cannot be combined with --files-with-matches, --all or --count\n"))
+			os.Exit(1)
+		}
+	}
+	if *jsonOutput {
+		if *treeMode || *webMode || *filesOnly || *templateText != "" {
+			fmt.Fprint(os.Stderr, trf("Error: --json cannot be combined with --tree, --web, --files-with-matches or --template\n"))
+			os.Exit(1)
+		}
+	}
+
+	if fs.Changed("open") {
+		if *openNth < 1 {
+			fmt.Fprint(os.Stderr, trf("Error: --open takes a result number, starting at 1\n"))
+			os.Exit(1)
+		}
+		if *treeMode || *webMode || *filesOnly || *templateText != "" || *jsonOutput || histFilter.Active() {
+			fmt.Fprint(os.Stderr, trf("Error: --open cannot be combined with --tree, --web, --files-with-matches, --template, --json or --after/--before/--author\n"))
+			os.Exit(1)
+		}
+	} else if *editMode {
+		fmt.Fprint(os.Stderr, trf("Error: --edit needs --open <n>\n"))
+		os.Exit(1)
+	}
+	if *numbered && (*treeMode || *webMode || *filesOnly || *templateText != "" || *jsonOutput) {
+		fmt.Fprint(os.Stderr, trf("Error: --numbered cannot be combined with --tree, --web, --files-with-matches, --template or --json\n"))
+		os.Exit(1)
+	}
+	if *previewMode {
+		if searchType == "path" {
+			fmt.Fprint(os.Stderr, trf("Error: --preview needs line hits; path searches only find files\n"))
+			os.Exit(1)
+		}
+		if *treeMode || *webMode || *filesOnly || *allPages || *countMode || *templateText != "" || *jsonOutput || *numbered || fs.Changed("open") || histFilter.Active() {
+			fmt.Fprint(os.Stderr, trf("Error: --preview cannot be combined with --tree, --web, --files-with-matches, --all, --count, --template, --json, --numbered, --open or --after/--before/--author\n"))
+			os.Exit(1)
+		}
+		if *previewHits < 1 || *previewLines < 0 {
+			fmt.Fprint(os.Stderr, trf("Error: --preview-hits must be at least 1 and --preview-lines not negative\n"))
+			os.Exit(1)
+		}
+	} else if fs.Changed("preview-hits") || fs.Changed("preview-lines") {
+		fmt.Fprint(os.Stderr, trf("Error: --preview-hits and --preview-lines need --preview\n"))
+		os.Exit(1)
+	}
+	if *allPages {
+		if fileLimitSet {
+			fmt.Fprint(os.Stderr, trf("Error: --all fetches every matching file; drop --max/--max-files/--page\n"))
+			os.Exit(1)
+		}
+		if *treeMode || *webMode || *filesOnly || *saveResults != "" || fs.Changed("open") || *numbered || *jsonOutput || !since.IsZero() || histFilter.Active() {
+			fmt.Fprint(os.Stderr, trf("Error: --all cannot be combined with --tree, --web, --files-with-matches, --save-results, --open, --numbered, --json, --changed-since or --after/--before/--author\n"))
+			os.Exit(1)
+		}
+		// Spooled pages are printed as fetched, so only the server could sort
+		// them, and not all servers do
+		if *sortMode == "path" || *sortMode == "lastmod" {
+			fmt.Fprint(os.Stderr, trf("Error: --all cannot be combined with --sort %s; the pages are printed in the server's order\n", *sortMode))
+			os.Exit(1)
+		}
+	}
+
+	if *countMode {
+		if fileLimitSet || *maxLines > 0 || *allPages || *treeMode || *webMode || *filesOnly || *templateText != "" || *jsonOutput || *saveResults != "" || fs.Changed("open") || *numbered || *localPathsMode || !since.IsZero() || histFilter.Active() {
+			fmt.Fprint(os.Stderr, trf("Error: --count cannot be combined with --max/--max-files/--max-lines/--page, --all, --tree, --web, --files-with-matches, --template, --json, --save-results, --open, --numbered, --local-paths, --changed-since or --after/--before/--author\n"))
+			os.Exit(1)
+		}
+	}
+
+	var annotator *hitAnnotator
+	if fs.Changed("annotate") {
+		if searchType == "path" || searchType == "hist" {
+			fmt.Fprint(os.Stderr, trf("Error: --annotate needs line hits; %s searches don't have them\n", searchType))
+			os.Exit(1)
+		}
+		if *webMode || *filesOnly || *allPages || *countMode || *jsonOutput || fs.Changed("open") {
+			fmt.Fprint(os.Stderr, trf("Error: --annotate cannot be combined with --web, --files-with-matches, --all, --count, --json or --open\n"))
+			os.Exit(1)
+		}
+		if strings.TrimSpace(*annotateText) == "" {
+			fmt.Fprint(os.Stderr, trf("Error: --annotate needs the text of the note\n"))
+			os.Exit(1)
+		}
+		author := annotateAuthor(*annotateAs)
+		if author == "" {
+			fmt.Fprint(os.Stderr, trf("Error: no author for the notes; pass --annotate-author\n"))
+			os.Exit(1)
+		}
+		host := &nativeHost{bin: *annotateBin}
+		defer host.Close()
+		annotator = &hitAnnotator{
+			StoragePath: annotationStorage(*annotationsPath),
+			Author:      author,
+			Text:        *annotateText,
+			Tags:        *annotateTags,
+			Call:        host.call,
+		}
+	} else if fs.Changed("annotate-tag") || fs.Changed("annotate-author") || fs.Changed("annotations") || fs.Changed("annotate-bin") {
+		fmt.Fprint(os.Stderr, trf("Error: --annotate-tag, --annotate-author, --annotations and --annotate-bin need --annotate\n"))
+		os.Exit(1)
+	}
+
+	var replacer *hitReplacer
+	if fs.Changed("replace") {
+		if searchType == "path" || searchType == "hist" {
+			fmt.Fprint(os.Stderr, trf("Error: --replace needs line hits; %s searches don't have them\n", searchType))
+			os.Exit(1)
+		}
+		if *webMode || *filesOnly || *allPages || *countMode || *jsonOutput || fs.Changed("open") || *treeMode || *templateText != "" || *numbered || annotator != nil {
+			fmt.Fprint(os.Stderr, trf("Error: --replace cannot be combined with --web, --files-with-matches, --all, --count, --json, --open, --tree, --template, --numbered or --annotate\n"))
+			os.Exit(1)
+		}
+		pattern, err := regexp.Compile(*replacePattern)
+		if err != nil || *replacePattern == "" {
+			fmt.Fprint(os.Stderr, trf("Error: invalid --replace pattern %q\n", *replacePattern))
+			os.Exit(1)
+		}
+		roots := loadLocalRoots()
+		if len(roots) == 0 {
+			fmt.Fprint(os.Stderr, trf("Error: --replace works on local checkouts and none are configured; run '%s config local <project> <dir>'\n", os.Args[0]))
+			os.Exit(1)
+		}
+		replacer = &hitReplacer{Pattern: pattern, With: *replaceWith, Local: newLocalPaths(roots)}
+	} else if fs.Changed("replace-with") {
+		fmt.Fprint(os.Stderr, trf("Error: --replace-with needs --replace\n"))
+		os.Exit(1)
+	}
+
+	if fs.Changed("pipe") {
+		if strings.TrimSpace(*pipeCommand) == "" {
+			fmt.Fprint(os.Stderr, trf("Error: --pipe needs a command\n"))
+			os.Exit(1)
+		}
+		if *webMode || *filesOnly || *allPages || *countMode || fs.Changed("open") || histFilter.Active() {
+			fmt.Fprint(os.Stderr, trf("Error: --pipe cannot be combined with --web, --files-with-matches, --all, --count, --open or --after/--before/--author\n"))
+			os.Exit(1)
+		}
+	}
+
+	var local *localPaths
+	if *localPathsMode {
+		if *treeMode || *webMode {
+			fmt.Fprint(os.Stderr, trf("Error: --local-paths cannot be combined with --tree or --web\n"))
+			os.Exit(1)
+		}
+		roots := loadLocalRoots()
+		if len(roots) == 0 {
+			fmt.Fprint(os.Stderr, trf("Error: no local checkouts configured; run '%s config local <project> <dir>'\n", os.Args[0]))
+			os.Exit(1)
+		}
+		local = newLocalPaths(roots)
+	}
+
+	for _, terms := range [][]string{*andTerms, *orTerms, *notTerms} {
+		if slices.ContainsFunc(terms, func(term string) bool { return strings.TrimSpace(term) == "" }) {
+			fmt.Fprint(os.Stderr, trf("Error: --and, --or and --not need a term\n"))
+			os.Exit(1)
+		}
+	}
+	query = BuildQuery(query, QueryOptions{
+		Phrase: *phrase,
+		And:    *andTerms,
+		Or:     *orTerms,
+		Not:    *notTerms,
+	})
+
+	var configuredCase string
+	if cfg, _ := LoadConfig(); cfg != nil {
+		configuredCase = cfg.SearchCase
+	}
+	caseMode, err := resolveSearchCase(*ignoreCase, *caseSensitiveMode, *smartCase, configuredCase)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	terms := caseTerms(query)
+	caseMode = effectiveCase(caseMode, terms)
+	// The server ignores case in full, path and hist searches, so exact case
+	// is checked on the fetched hits, which streaming modes don't keep
+	filterCase := caseMode == caseSensitive && !serverCaseSensitive(searchType)
+	if filterCase && (*filesOnly || *allPages || *countMode) {
+		if *caseSensitiveMode {
+			fmt.Fprint(os.Stderr, trf("Error: --case-sensitive cannot be combined with --files-with-matches, --all or --count in %s searches, which the server matches ignoring case\n", searchType))
+			os.Exit(1)
+		}
+		filterCase = false
+	}
+	serverQuery := query
+	if caseMode == caseIgnore && serverCaseSensitive(searchType) {
+		serverQuery = ignoreCaseQuery(query)
+	}
+
+	// Get server URL
+	url := getServerURL(*serverURL)
+
+	// Create client
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	// Configure authentication
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	sortBy, err := sortParam(*sortMode)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	// Build search options based on search type
+	opts := SearchOptions{
+		Type:       *typeFilter,
+		Projects:   resolveProjects(*projects, client),
+		MaxResults: fileLimit,
+		Start:      max(*page-1, 0) * fileLimit,
+		Sort:       sortBy,
+	}
+
+	switch searchType {
+	case "full":
+		opts.Full = query
+	case "def":
+		opts.Def = serverQuery
+	case "symbol":
+		opts.Symbol = serverQuery
+	case "path":
+		opts.Path = query
+	case "hist":
+		opts.Hist = query
+	}
+	if *pathFilter != "" {
+		opts.Path = *pathFilter
+	} else if len(*pathGlobs) > 0 {
+		// The server narrows by the glob's leading directories; the glob
+		// itself is matched against the hits
+		opts.Path = globServerPath(*pathGlobs)
+	}
+
+	if *dryRun {
+		printSearchDryRun(os.Stdout, client, opts, *filesOnly || *countMode)
+		if *excludeDefs {
+			fmt.Fprintf(os.Stdout, "\n# Definitions to leave out (--exclude-defs)\n")
+			printRequest(os.Stdout, client, client.SearchURL(excludeDefsOptions(opts)))
+		}
+		return
+	}
+
+	// Ctrl-C aborts the request in flight instead of killing og mid-output
+	ctx, stop := interruptContext()
+	defer stop()
+
+	if *countMode {
+		progress := newProgress(*quietMode)
+		task := progress.Start("Counting matches...")
+		counts, err := client.CountMatchesContext(ctx, opts, filesPageSize)
+		task.Done()
+		if isInterrupted(err) {
+			// Show the pages counted before Ctrl-C
+			printMatchCounts(os.Stdout, counts, colorOutput(os.Stdout))
+			exitIfInterrupted(os.Stderr, err)
+		}
+		if err != nil {
+			printSearchError(os.Stderr, err)
+			os.Exit(1)
+		}
+		printMatchCounts(os.Stdout, counts, colorOutput(os.Stdout))
+		return
+	}
+
+	if *filesOnly {
+		if *treeMode || *webMode || *maxLines > 0 || *saveResults != "" || paging {
+			fmt.Fprint(os.Stderr, trf("Error: --files-with-matches cannot be combined with --tree, --web, --max-lines, --save-results or --page\n"))
+			os.Exit(1)
+		}
+		// The file limit only applies to the stream when given explicitly
+		limit := 0
+		if fileLimitSet {
+			limit = fileLimit
+		}
+		streamMatchingFiles(ctx, client, opts, limit, *pathGlobs, colorOutput(os.Stdout), local)
+		local.warn(os.Stderr)
+		return
+	}
+
+	if *allPages {
+		printAllResults(ctx, client, opts, allResultsOptions{
+			SearchType: searchType,
+			Query:      query,
+			ServerURL:  url,
+			MaxLines:   *maxLines,
+			Template:   resultTemplate,
+			WebLinks:   *webLinks,
+			Quiet:      *quietMode,
+			Local:      local,
+			Layout:     layout,
+		})
+		return
+	}
+
+	// Perform search with progress
+	progress := newProgress(*quietMode)
+	task := progress.Start("Searching...")
+	result, err := client.SearchContext(ctx, opts)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		printSearchError(os.Stderr, err)
+		os.Exit(1)
+	}
+	sortResults(result, *sortMode)
+	if *sortMode == "lastmod" {
+		task := progress.Start("Sorting by last change...")
+		err := sortByLastChange(ctx, client, result, task)
+		task.Done()
+		if err != nil {
+			exitIfInterrupted(os.Stderr, err)
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	if *excludeDefs {
+		task := progress.Start("Finding definitions...")
+		definitions, err := definitionLines(ctx, client, opts)
+		task.Done()
+		if err != nil {
+			exitIfInterrupted(os.Stderr, err)
+			fmt.Fprint(os.Stderr, trf("Error finding definitions: %v\n", err))
+			os.Exit(1)
+		}
+		if dropped := FilterDefinitions(result, definitions); dropped > 0 && !*quietMode {
+			fmt.Fprint(os.Stderr, trf("(%d definition lines dropped)\n", dropped))
+		}
+	}
+	if len(*pathGlobs) > 0 {
+		if dropped := FilterPathGlobs(result, *pathGlobs); dropped > 0 && !*quietMode {
+			fmt.Fprint(os.Stderr, trf("(%d hits in files outside --path-glob dropped)\n", dropped))
+		}
+	}
+	if filterCase {
+		if dropped := FilterCaseSensitive(result, searchType, terms); dropped > 0 && !*quietMode {
+			fmt.Fprint(os.Stderr, trf("(%d hits matching only with a different case dropped)\n", dropped))
+		}
+	}
+
+	if !since.IsZero() {
+		task := progress.Start("Checking file history...")
+		err := FilterChangedSince(ctx, client, result, since, task)
+		task.Done()
+		if err != nil {
+			exitIfInterrupted(os.Stderr, err)
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	if *saveResults != "" {
+		if err := saveResultSnapshot(*saveResults, newResultSnapshot(result, url, searchType, query)); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error saving results: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	if histFilter.Active() {
+		task := progress.Start("Filtering history...")
+		files, err := FilterHistoryResults(ctx, client, result, histFilter, task)
+		task.Done()
+		if isInterrupted(err) {
+			// Show the files whose history was checked before Ctrl-C
+			printFileHistories(os.Stdout, files, colorOutput(os.Stdout))
+			exitIfInterrupted(os.Stderr, err)
+		}
+		if err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		printFileHistories(os.Stdout, files, colorOutput(os.Stdout))
+		return
+	}
+
+	if *jsonOutput {
+		totals := limitResultLines(result, *maxLines)
+		if *pipeCommand != "" {
+			result, totals = pipeSearchResults(ctx, *pipeCommand, result, url, totals, *quietMode)
+		}
+		if searchType == "def" {
+			defs := pairDefinitionHits(ctx, client, newDefinitions(result, query, url), url, progress)
+			err = writeDefinitionsJSON(os.Stdout, defs, totals)
+		} else {
+			err = writeSearchHitsJSON(os.Stdout, newSearchHits(result, url), totals)
+		}
+		if err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *openNth > 0 {
+		limitResultLines(result, *maxLines)
+		snap := newResultSnapshot(result, url, searchType, query)
+		if err := saveLastResults(snap); err != nil {
+			fmt.Fprint(os.Stderr, trf("Warning: failed to save results for open-last: %v\n", err))
+		}
+		hit, err := selectHit(snap, *openNth)
+		if err == nil {
+			err = openHit(url, hit, *editMode)
+		}
+		if err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Handle web mode or display results
+	if *webMode {
+		openSearchResults(url, result)
+	} else {
+		useColor := colorOutput(os.Stdout)
+		enableWebLinks := searchWebLinks(*webLinks)
+		totals := limitResultLines(result, *maxLines)
+		if *pipeCommand != "" {
+			result, totals = pipeSearchResults(ctx, *pipeCommand, result, url, totals, *quietMode)
+		}
+		if replacer != nil {
+			preview := replacer.preview(result)
+			printReplaceDiff(os.Stdout, preview, useColor)
+			replacer.Local.warn(os.Stderr)
+			printReplaceSummary(os.Stderr, preview)
+			if len(preview.Failed) > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+		var previews hitPreviews
+		if *previewMode {
+			task := progress.Start("Fetching previews...")
+			var failed int
+			previews, failed, err = fetchPreviews(ctx, client, result, *previewHits, *previewLines, task)
+			task.Done()
+			exitIfInterrupted(os.Stderr, err)
+			if failed > 0 {
+				fmt.Fprint(os.Stderr, trf("Warning: no preview for %d hits: %v\n", failed, err))
+			}
+		}
+		// Remember the hits as displayed so 'og open-last <n>' can open one
+		if err := saveLastResults(newResultSnapshot(result, url, searchType, query)); err != nil {
+			fmt.Fprint(os.Stderr, trf("Warning: failed to save results for open-last: %v\n", err))
+		}
+		if resultTemplate != nil {
+			if err := executeResultTemplate(os.Stdout, resultTemplate, result, url, local); err != nil {
+				fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+				os.Exit(1)
+			}
+		} else if *treeMode {
+			if result.ResultCount == 0 {
+				fmt.Println(tr("No results found."))
+			} else {
+				fmt.Print(FormatPathTree(result, useColor, enableWebLinks, url))
+			}
+		} else if *numbered {
+			printNumberedResults(os.Stdout, result, useColor, local)
+		} else if searchType == "def" {
+			defs := pairDefinitionHits(ctx, client, newDefinitions(result, query, url), url, progress)
+			printDefinitions(os.Stdout, defs, useColor, enableWebLinks, local, previews)
+		} else {
+			printResults(result, useColor, enableWebLinks, url, local, previews, layout)
+		}
+		local.warn(os.Stderr)
+		if result.ResultCount > 0 {
+			printResultTotals(os.Stderr, totals, *quietMode)
+			if paging {
+				printPageNote(os.Stderr, *page, fileLimit, totals)
+			}
+		}
+		if annotator != nil {
+			annotator.Fetch = client.GetFileContext
+			task := progress.Start("Annotating hits...")
+			summary, err := annotator.annotateHits(ctx, result)
+			task.Done()
+			printAnnotateSummary(os.Stderr, summary)
+			exitIfInterrupted(os.Stderr, err)
+			if len(summary.Failed) > 0 {
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// pairDefinitionHits labels the C/C++ declarations and definitions among
+// defs, looking up the implementations of header prototypes that have none
+// listed. A failed lookup only leaves its declarations unpaired.
+func pairDefinitionHits(ctx context.Context, client *Client, defs []DefinitionHit, serverURL string, progress *Progress) []DefinitionHit {
+	// The progress shows once a lookup is needed, which most listings skip
+	find := definitionFinder(ctx, client, serverURL)
+	var task *ProgressTask
+	defs, err := pairDefinitions(defs, func(project, symbol string) ([]DefinitionHit, error) {
+		if task == nil {
+			task = progress.Start("Finding implementations...")
+		}
+		return find(project, symbol)
+	})
+	if task != nil {
+		task.Done()
+	}
+	exitIfInterrupted(os.Stderr, err)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Warning: implementations not looked up for every declaration: %v\n", err))
+	}
+	return defs
+}
+
+// pipeSearchResults runs the --pipe filter over the results, exiting if it
+// fails
+func pipeSearchResults(ctx context.Context, command string, result *SearchResponse, serverURL string, totals ResultTotals, quiet bool) (*SearchResponse, ResultTotals) {
+	shown := totals.ShownLines
+	piped, totals, err := pipeResults(ctx, command, result, serverURL, totals)
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if dropped := shown - totals.ShownLines; dropped > 0 && !quiet {
+		fmt.Fprint(os.Stderr, trf("(%d hits dropped by --pipe)\n", dropped))
+	}
+	return piped, totals
+}
+
+// printSearchError reports a failed search, with a hint on narrowing it
+// when the server refused it as too broad
+func printSearchError(w io.Writer, err error) {
+	fmt.Fprintf(w, "Error performing search: %v\n", err)
+	if hint := searchRefusedHint(err); hint != "" {
+		fmt.Fprintln(w, hint)
+	}
+}
+
+// searchRefusedHint suggests how to narrow a search the server refused, or
+// returns "" for other errors
+func searchRefusedHint(err error) string {
+	switch {
+	case errors.Is(err, ErrProjectRequired):
+		return "Choose projects with --projects (list them with 'og projects', or name a set with 'og config group')."
+	case errors.Is(err, ErrQueryTooBroad):
+		return "Narrow the query: give wildcards a longer prefix (\"mem*\" rather than \"m*\"), or add --projects, --path or --type."
+	}
+	return ""
+}
+
+// printPageNote points at the next page of a --page search, or says the page
+// is past the last one
+func printPageNote(w io.Writer, page, perPage int, totals ResultTotals) {
+	pages := (totals.MatchingFiles + perPage - 1) / perPage
+	switch {
+	case totals.FetchedFiles == 0:
+		fmt.Fprintf(w, "(page %d is past the last page, %d)\n", page, pages)
+	case page < pages:
+		fmt.Fprintf(w, "(page %d of %d; --page %d for more)\n", page, pages, page+1)
+	}
+}
+
+// searchWebLinks reports whether to print hyperlinks: when asked for with
+// --web-links, or else when the config enables them, and stdout shows them
+func searchWebLinks(flagSet bool) bool {
+	enabled := flagSet
+	if !flagSet {
+		if cfg, _ := LoadConfig(); cfg != nil {
+			enabled = cfg.WebLinks
+		}
+	}
+	return enabled && hyperlinksOutput(os.Stdout)
+}
+
+// allResultsOptions controls how printAllResults displays a search
+type allResultsOptions struct {
+	SearchType string
+	Query      string
+	ServerURL  string
+	MaxLines   int
+	Template   *template.Template
+	WebLinks   bool // --web-links given
+	Quiet      bool
+	Local      *localPaths
+	Layout     lineLayout
+}
+
+// printAllResults fetches every page of a search for --all into a result
+// spool, which keeps memory bounded by spilling to disk, then formats the
+// results from the spool. Nothing is printed if a page fails.
+func printAllResults(ctx context.Context, client *Client, opts SearchOptions, o allResultsOptions) {
+	progress := newProgress(o.Quiet)
+	task := progress.Start("Searching...")
+	spool := newResultSpool(spoolMemoryBudget)
+	totals, err := fetchAllResults(ctx, client, opts, spool, task)
+	task.Done()
+	if err != nil {
+		spool.Close()
+		exitIfInterrupted(os.Stderr, err)
+		printSearchError(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer spool.Close()
+	if spool.Len() == 0 {
+		fmt.Println(tr("No results found."))
+		return
+	}
+
+	useColor := colorOutput(os.Stdout)
+	webLinks := searchWebLinks(o.WebLinks)
+	totals, err = printSpooledResults(spool, totals, o.MaxLines, func(resp *SearchResponse) error {
+		switch {
+		case o.Template != nil:
+			return executeResultTemplate(os.Stdout, o.Template, resp, o.ServerURL, o.Local)
+		case o.SearchType == "def":
+			printDefinitions(os.Stdout, newDefinitions(resp, o.Query, o.ServerURL), useColor, webLinks, o.Local, nil)
+		default:
+			printResults(resp, useColor, webLinks, o.ServerURL, o.Local, nil, o.Layout)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	o.Local.warn(os.Stderr)
+	printResultTotals(os.Stderr, totals, o.Quiet)
+}
+
+// printResultTotals reports hits hidden by --max-lines and, unless quiet, the
+// line and file totals
+func printResultTotals(w io.Writer, totals ResultTotals, quiet bool) {
+	if hidden := totals.HiddenLines(); hidden > 0 {
+		fmt.Fprint(w, trf("(%d more hits hidden; raise --max-lines to see them)\n", hidden))
+	}
+	if !quiet {
+		fmt.Fprintln(w, totals)
+	}
+}
+
+// filesPageSize is the number of documents requested per page when streaming
+// matching file paths
+const filesPageSize = 1000
+
+// streamMatchingFiles prints each matching file path as its page arrives,
+// like a remote 'grep -rl'. With globs, files matching none of them are
+// skipped; limit still counts the files fetched.
+func streamMatchingFiles(ctx context.Context, client *Client, opts SearchOptions, limit int, globs []string, useColor bool, local *localPaths) {
+	skipped := 0
+	count, err := client.SearchFilesContext(ctx, opts, filesPageSize, limit, func(project, path string) error {
+		if len(globs) > 0 && !matchAnyPathGlob(globs, path) {
+			skipped++
+			return nil
+		}
+		name := local.display(project, path)
+		if useColor {
+			_, err := fmt.Printf("%s%s%s\n", colorMagenta, name, colorReset)
+			return err
+		}
+		_, err := fmt.Println(name)
+		return err
+	})
+	if err != nil {
+		// Paths already printed stay on stdout
+		exitIfInterrupted(os.Stderr, err)
+		printSearchError(os.Stderr, err)
+		os.Exit(1)
+	}
+	if skipped > 0 {
+		fmt.Fprint(os.Stderr, trf("(%d files outside --path-glob skipped)\n", skipped))
+	}
+	if count-skipped == 0 {
+		fmt.Fprintln(os.Stderr, tr("No results found."))
+	}
+}
+
+// getServerURL returns the server URL from the flag, a global --server,
+// OG_SERVER or the config file, in that order
+func getServerURL(flagURL string) string {
+	if flagURL == "" {
+		flagURL = globalServerURL
+	}
+	if flagURL == "" {
+		flagURL = os.Getenv(envServer)
+	}
+	if flagURL != "" {
+		return strings.TrimRight(flagURL, "/")
+	}
+
+	config, err := LoadConfig()
+	var configErr *ConfigError
+	if errors.Is(err, ErrConfigLocked) || errors.As(err, &configErr) {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprint(os.Stderr, trf("Warning: failed to load config: %v\n", err))
+	} else if config != nil && config.ServerURL != "" {
+		return strings.TrimRight(config.ServerURL, "/")
+	}
+
+	fmt.Fprint(os.Stderr, trf("Error: no server URL configured\n"))
+	fmt.Fprintf(os.Stderr, "Run '%s init <server-url>', use the --server flag, or set %s\n", os.Args[0], envServer)
+	os.Exit(1)
+	return ""
+}
+
+func printResults(resp *SearchResponse, useColor bool, webLinks bool, serverURL string, local *localPaths, previews hitPreviews, layout lineLayout) {
+	if resp.ResultCount == 0 {
+		fmt.Println(tr("No results found."))
+		return
+	}
+
+	for _, r := range resp.OrderedEntries() {
+		project := r.Project
+		path := r.FilePath()
+
+		name := local.display(project, path)
+		line := strings.TrimSpace(r.Line)
+		lineNo := string(r.LineNo)
+		prefix := resultPrefixWidth(name, lineNo)
+
+		// Construct web URL if --web-links is enabled
+		var webURL string
+		if webLinks {
+			webURL = xrefURL(serverURL, project, path, lineNo)
+		}
+
+		if useColor {
+			// Format: project/path:line:content (with colors like ripgrep)
+			if lineNo != "" {
+				if webLinks {
+					// Add clickable link using OSC 8 hyperlink escape sequence
+					fmt.Printf("\033]8;;%s\033\\%s%s%s\033]8;;\033\\:%s%s%s:%s\n",
+						webURL,
+						colorMagenta, name, colorReset,
+						colorCyan, lineNo, colorReset,
+						layout.format(line, prefix, true))
+				} else {
+					fmt.Printf("%s%s%s:%s%s%s:%s\n",
+						colorMagenta, name, colorReset,
+						colorCyan, lineNo, colorReset,
+						layout.format(line, prefix, true))
+				}
+			} else {
+				// No line number available for this result
+				if webLinks {
+					fmt.Printf("\033]8;;%s\033\\%s%s%s\033]8;;\033\\:%s\n",
+						webURL,
+						colorMagenta, name, colorReset,
+						layout.format(line, prefix, true))
+				} else {
+					fmt.Printf("%s%s%s:%s\n",
+						colorMagenta, name, colorReset,
+						layout.format(line, prefix, true))
+				}
+			}
+		} else {
+			if lineNo != "" {
+				if webLinks {
+					// Plain mode with web link - only path is clickable
+					fmt.Printf("\033]8;;%s\033\\%s\033]8;;\033\\:%s:%s\n",
+						webURL, name, lineNo, layout.format(line, prefix, false))
+				} else {
+					fmt.Printf("%s:%s:%s\n", name, lineNo, layout.format(line, prefix, false))
+				}
+			} else {
+				// No line number available for this result
+				if webLinks {
+					fmt.Printf("\033]8;;%s\033\\%s\033]8;;\033\\:%s\n",
+						webURL, name, layout.format(line, prefix, false))
+				} else {
+					fmt.Printf("%s:%s\n", name, layout.format(line, prefix, false))
+				}
+			}
+		}
+		printHitLabels(os.Stdout, r.Labels, useColor)
+		if previews != nil {
+			lineNum, _ := strconv.Atoi(lineNo)
+			printPreview(os.Stdout, previews.get(project, path, lineNum), useColor, resolveTheme(""))
+		}
+	}
+}
+
+// stripHTMLTags removes HTML tags from the string
+func stripHTMLTags(s string) string {
+	return htmlTagRegex.ReplaceAllString(s, "")
+}
+
+func openSearchResults(serverURL string, resp *SearchResponse) {
+	if resp.ResultCount == 0 {
+		fmt.Println(tr("No results found."))
+		return
+	}
+
+	// Count total results and capture single result if there's exactly one
+	totalResults := 0
+	var singleProject string
+	var singleResult SearchResult
+	for _, r := range resp.OrderedEntries() {
+		totalResults++
+		if totalResults == 1 {
+			singleProject = r.Project
+			singleResult = r.SearchResult
+		}
+	}
+
+	var webURL string
+	if totalResults == 1 {
+		// Open the specific file at the line number
+		path := resultPath(singleProject, singleResult)
+		webURL = xrefURL(serverURL, singleProject, path, string(singleResult.LineNo))
+		fmt.Printf("Opening file: %s\n", displayPath(singleProject, path))
+	} else {
+		// Open the search results page in the web interface
+		// OpenGrok web interface uses the same base URL with /search path
+		webURL = serverURL + "/search"
+		fmt.Printf("Opening search results (%d results) in browser...\n", resp.ResultCount)
+	}
+
+	if err := openBrowser(webURL); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error opening browser: %v\n", err))
+		fmt.Fprintf(os.Stderr, "URL: %s\n", webURL)
+		os.Exit(1)
+	}
+}
+
+func handleInit() {
+	// Parse flags for init command
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+	webLinks := fs.BoolP("web-links", "w", false, "Enable web links by default in output")
+	fromEnv := fs.Bool("from-env", false, "Take the server URL and credentials from OG_* environment variables (flags override)")
+	testQuery := fs.String("test-query", "", "After saving, list the projects and run this search (--test-query alone searches for \""+defaultTestQuery+"\") to check the settings")
+	fs.Lookup("test-query").NoOptDefVal = defaultTestQuery
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s init <server-url> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s init --from-env [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Example: %s init http://opengrok.example.com/source\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s init http://opengrok.example.com/source --username user --password pass\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s=http://opengrok.example.com/source %s init --from-env\n", envServer, os.Args[0])
+		fmt.Fprintf(os.Stderr, "         %s init http://opengrok.example.com/source --api-key KEY --test-query\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The server URL is the first argument after "init", unless it comes
+	// from the environment
+	serverURL := ""
+	rest := os.Args[2:]
+	if !strings.HasPrefix(rest[0], "-") {
+		serverURL = rest[0]
+		rest = rest[1:]
+	}
+
+	// Parse remaining flags (after server URL)
+	fs.Parse(rest)
+
+	if *fromEnv {
+		env := envAuthOptions()
+		if serverURL == "" {
+			serverURL = os.Getenv(envServer)
+		}
+		// Flags given alongside --from-env take precedence
+		if *username == "" {
+			*username, *password = env.Username, env.Password
+		}
+		if *apiKey == "" {
+			*apiKey = env.APIKey
+		}
+		if *bearerToken == "" {
+			*bearerToken = env.BearerToken
+		}
+	}
+
+	if serverURL == "" {
+		if *fromEnv {
+			fmt.Fprint(os.Stderr, trf("Error: no server URL given and %s is not set\n\n", envServer))
+		} else {
+			fmt.Fprint(os.Stderr, trf("Error: server URL is required before options\n\n"))
+		}
+		fs.Usage()
+		os.Exit(1)
+	}
+	serverURL = strings.TrimSuffix(serverURL, "/")
+
+	// The config file holds one auth type (see validateConfig)
+	authTypes := 0
+	for _, set := range []bool{*username != "", *apiKey != "", *bearerToken != ""} {
+		if set {
+			authTypes++
+		}
+	}
+	if authTypes > 1 {
+		fmt.Fprint(os.Stderr, trf("Error: use only one of --username, --api-key and --bearer-token\n"))
+		os.Exit(1)
+	}
+
+	// Validate the URL by trying to create a client
+	client, err := NewClient(serverURL)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: invalid server URL: %v\n", err))
+		os.Exit(1)
+	}
+
+	config := &Config{
+		ServerURL:   serverURL,
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+		WebLinks:    *webLinks,
+	}
+
+	if err := SaveConfig(config); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save config: %v\n", err))
+		os.Exit(1)
+	}
+
+	fmt.Printf("Server URL saved: %s\n", serverURL)
+	if *bearerToken != "" {
+		fmt.Println("Authentication: Bearer token configured")
+	} else if *apiKey != "" {
+		fmt.Println("Authentication: API key configured")
+	} else if *username != "" {
+		fmt.Println("Authentication: Basic auth configured")
+	}
+	if *webLinks {
+		fmt.Println("Web links: Enabled by default")
+	}
+	fmt.Println("You can now run searches without the --server flag.")
+
+	if *testQuery != "" {
+		client.Username, client.Password = config.Username, config.Password
+		client.APIKey, client.BearerToken = config.APIKey, config.BearerToken
+		ctx, stop := interruptContext()
+		defer stop()
+		fmt.Println()
+		if !printServerChecks(os.Stdout, checkServer(ctx, client, *testQuery)) {
+			exitIfInterrupted(os.Stderr, ctx.Err())
+			fmt.Fprint(os.Stderr, trf("Error: the server checks failed; fix the settings and run '%s init' again\n", os.Args[0]))
+			os.Exit(1)
+		}
+	}
+}
+
+// chooseDefinition lists the candidate definitions and prompts for one on
+// the terminal, returning its "/project/path:line" for TraceOptions.DefPath
+func chooseDefinition(e *AmbiguousDefinitionError) string {
+	fmt.Fprintf(os.Stderr, "%s is defined in %d places:\n", e.Symbol, len(e.Candidates))
+	for i, c := range e.Candidates {
+		fmt.Fprintf(os.Stderr, "  %d) %s  %s\n", i+1, c.String(), c.Line)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "Select definition [1-%d]: ", len(e.Candidates))
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			os.Exit(1)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(input))
+		if err == nil && n >= 1 && n <= len(e.Candidates) {
+			return e.Candidates[n-1].String()
+		}
+	}
+}
+
+// confirmTraceBudget warns when a trace would obviously exceed --max-total
+// and asks whether to go on, returning the depth to trace with. Without a
+// terminal to prompt on, the depth is lowered to fit the budget instead.
+func confirmTraceBudget(est TraceEstimate) int {
+	fmt.Fprintf(os.Stderr, "Warning: about %d direct callers; a depth-%d trace would explore roughly %d nodes (--max-total %d)\n",
+		est.DirectCallers, est.Depth, est.Nodes, est.MaxTotal)
+
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		depth := fitTraceDepth(est.DirectCallers, est.Depth, est.MaxTotal)
+		if depth < est.Depth {
+			fmt.Fprint(os.Stderr, trf("Warning: tracing to depth %d instead; pass --yes to keep --depth %d\n", depth, est.Depth))
+		} else {
+			fmt.Fprint(os.Stderr, trf("Warning: the trace will stop at --max-total %d; narrow it with -p or -t\n", est.MaxTotal))
+		}
+		return depth
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Fprintf(os.Stderr, "Continue anyway? [y/N] ")
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(os.Stderr)
+		os.Exit(1)
+	}
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "y", "yes":
+		return est.Depth
+	}
+	fmt.Fprintf(os.Stderr, "Trace canceled; narrow it with -p, -t or --depth, or pass --yes\n")
+	os.Exit(1)
+	return 0
+}
+
+func handleTrace() {
+	// Parse flags for trace command
+	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	projects := fs.StringP("projects", "p", "", "Projects to search (comma-separated, @group expands a project group, linux-* matches project names)")
+	typeFilter := fs.StringP("type", "t", "", "File type filter")
+	depth := fs.IntP("depth", "d", 2, "Maximum traversal depth")
+	maxTotal := fs.Int("max-total", 100, "Maximum total nodes to explore")
+	totalTimeout := fs.Duration("total-timeout", 0, "Stop exploring after this long (e.g. 30s, 2m) and show the tree found so far (default: no limit)")
+	levelProjects := fs.StringArray("level-projects", nil, "Projects for the next BFS level, \"*\" for all (repeatable, one per level)")
+	defPath := fs.String("def-path", "", "Trace the definition whose path contains this string (when the symbol is defined in several places)")
+	aliasFlags := fs.StringArray("alias", nil, "Also follow callers of an alias, as old_name=new_name (repeatable)")
+	excludes := fs.StringArray("exclude", nil, "Leave out call sites in files matching a pattern, e.g. \"*_mock.c\" or \"/vendor/\" (repeatable)")
+	noDefaultExcludes := fs.Bool("no-default-excludes", false, "Include call sites in test and generated code, which are left out by default")
+	sameProjectOnly := fs.Bool("same-project-only", false, "Leave out callers in other projects than the function they call, so the trace stays in the definition's project")
+	saveFile := fs.String("save", "", "Save the trace to a JSON file for 'og trace render'")
+	format := fs.String("format", "tree", "Output format: tree, or ndjson to print each node as a JSON line as soon as it is found")
+	rootFile := fs.String("root-from-file", "", "Trace every function defined in this file (project/path) instead of one symbol, and print each one's caller counts (depth defaults to 1)")
+	callersOfFile := fs.String("callers-of-file", "", "Trace the callers of every exported function defined in this file (project/path) and print the files that depend on it (depth defaults to 1)")
+	dryRun := fs.Bool("dry-run", false, "Print the HTTP requests the trace would start with without sending them")
+	yes := fs.BoolP("yes", "y", false, "Skip the size estimate and run even if the trace would exceed --max-total")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory used to mark annotated nodes (overrides config)")
+	showAnnotations := fs.Bool("show-annotations", false, "Show annotation text under annotated nodes")
+	showSummary := fs.Bool("summary", false, "Print callers per level, top fan-in functions and top files after the tree")
+	relativeTo := fs.String("relative-to", "", "Show paths relative to this prefix (e.g. /myproject/usr/src)")
+	maxWidth := fs.Int("max-width", 0, "Shorten paths to fit lines in this many columns (default: terminal width)")
+	fullPaths := fs.Bool("full-paths", false, "Show full paths even on a terminal (no prefix stripping or shortening)")
+	webLinks := fs.BoolP("web-links", "w", false, "Display clickable OpenGrok URLs for file references")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s trace <symbol> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s trace --root-from-file <project/path> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s trace --callers-of-file <project/path> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s trace render <trace.json> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Trace the call graph by finding callers of a symbol.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// "og trace render <file>"; "og trace render [options]" traces render()
+	if len(os.Args) > 3 && os.Args[2] == "render" && !strings.HasPrefix(os.Args[3], "-") {
+		handleTraceRender()
+		return
+	}
+
+	// We need at least one argument (the symbol)
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	// The symbol is the first argument after the command; --root-from-file
+	// or --callers-of-file takes its place
+	symbol := os.Args[2]
+	if strings.HasPrefix(symbol, "-") {
+		symbol = ""
+		fs.Parse(os.Args[2:])
+	} else {
+		fs.Parse(os.Args[3:])
+	}
+	if symbol == "" && *rootFile == "" && *callersOfFile == "" {
+		fmt.Fprint(os.Stderr, trf("Error: symbol is required before options\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *rootFile != "" && *callersOfFile != "" {
+		fmt.Fprint(os.Stderr, trf("Error: --root-from-file and --callers-of-file are mutually exclusive\n"))
+		os.Exit(1)
+	}
+	if !slices.Contains(traceFormats, *format) {
+		fmt.Fprint(os.Stderr, trf("Error: unknown --format %q (%s)\n", *format, strings.Join(traceFormats, ", ")))
+		os.Exit(1)
+	}
+	for _, fileFlag := range []struct{ name, value string }{{"root-from-file", *rootFile}, {"callers-of-file", *callersOfFile}} {
+		if fileFlag.value == "" {
+			continue
+		}
+		if symbol != "" {
+			fmt.Fprint(os.Stderr, trf("Error: give either a symbol or --%s, not both\n", fileFlag.name))
+			os.Exit(1)
+		}
+		if *dryRun || *saveFile != "" {
+			fmt.Fprint(os.Stderr, trf("Error: --dry-run and --save do not apply to --%s\n", fileFlag.name))
+			os.Exit(1)
+		}
+		if *format != "tree" {
+			fmt.Fprint(os.Stderr, trf("Error: --format %s does not apply to --%s\n", *format, fileFlag.name))
+			os.Exit(1)
+		}
+		if *totalTimeout != 0 {
+			fmt.Fprint(os.Stderr, trf("Error: --total-timeout does not apply to --%s\n", fileFlag.name))
+			os.Exit(1)
+		}
+	}
+	if *totalTimeout < 0 {
+		fmt.Fprint(os.Stderr, trf("Error: --total-timeout must not be negative\n"))
+		os.Exit(1)
+	}
+
+	aliases, err := parseTraceAliases(*aliasFlags)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	// Get server URL
+	url := getServerURL(*serverURL)
+
+	// Create client
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	// Configure authentication
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	// Build trace options
+	opts := TraceOptions{
+		Symbol:          symbol,
+		Depth:           *depth,
+		Direction:       "callers", // Only callers supported in v1
+		MaxTotal:        *maxTotal,
+		Projects:        resolveProjects(*projects, client),
+		Type:            *typeFilter,
+		LevelProjects:   resolveLevelProjects(*levelProjects, client),
+		DefPath:         *defPath,
+		Aliases:         aliases,
+		Exclude:         traceExcludes(loadTraceExcludes(), *noDefaultExcludes, *excludes),
+		TotalTimeout:    *totalTimeout,
+		SameProjectOnly: *sameProjectOnly,
+	}
+
+	if *dryRun {
+		printTraceDryRun(os.Stdout, client, opts)
+		return
+	}
+
+	// Perform trace with progress; Ctrl-C stops it and shows the partial tree
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+
+	if *rootFile != "" {
+		// A shallow trace per function is enough to see what calls into
+		// the file
+		if !fs.Changed("depth") {
+			opts.Depth = 1
+		}
+		traceFileRoots(ctx, client, *rootFile, opts, progress)
+		return
+	}
+	if *callersOfFile != "" {
+		if !fs.Changed("depth") {
+			opts.Depth = 1
+		}
+		traceFileDependents(ctx, client, *callersOfFile, opts, progress)
+		return
+	}
+
+	// Check the first page of direct callers before committing to a long
+	// run; if the estimate fails, the trace reports the error itself
+	if !*yes {
+		task := progress.Start("Estimating trace size...")
+		est, err := EstimateTrace(ctx, client, opts)
+		task.Done()
+		if err == nil && est.OverBudget() {
+			opts.Depth = confirmTraceBudget(est)
+		}
+	}
+
+	// With --format ndjson, nodes are printed as the explorer adds them
+	var stream *traceStream
+	if *format == "ndjson" {
+		stream = newTraceStream(os.Stdout)
+		opts.OnNode = stream.node
+	}
+
+	// Several definitions share the name: let the user pick one, or
+	// without a terminal to ask on, trace the callers of all of them
+	opts.AnyDefinition = !isTerminal(os.Stdin) || !isTerminal(os.Stderr)
+	task := progress.Start("Tracing call graph...")
+	result, err := Trace(ctx, client, opts)
+	task.Done()
+
+	var ambiguous *AmbiguousDefinitionError
+	if errors.As(err, &ambiguous) {
+		opts.DefPath = chooseDefinition(ambiguous)
+		task = progress.Start("Tracing call graph...")
+		result, err = Trace(ctx, client, opts)
+		task.Done()
+	}
+	warnAnyDefinition(result)
+	if stream != nil {
+		stream.done(result, err)
+	}
+	if result == nil {
+		exitIfInterrupted(os.Stderr, err)
+	}
+	if err != nil && !isInterrupted(err) {
+		fmt.Fprint(os.Stderr, trf("Error tracing call graph: %v\n", err))
+		if hint := searchRefusedHint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, hint)
+		}
+		os.Exit(1)
+	}
+
+	if *saveFile != "" {
+		if err := saveTrace(*saveFile, url, opts, result); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error saving trace: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	if stream != nil {
+		if result.Interrupted {
+			os.Exit(exitInterrupted)
+		}
+		return
+	}
+
+	// On a terminal, paths are shortened to keep deep trees on one line each;
+	// piped output keeps full paths unless asked otherwise
+	width := *maxWidth
+	if !fs.Changed("max-width") && !*fullPaths {
+		width = terminalWidth(os.Stdout)
+	}
+	printTraceTree(result, url, traceDisplay{
+		WebLinks:        *webLinks,
+		AnnotationsPath: *annotationsPath,
+		ShowAnnotations: *showAnnotations,
+		Summary:         *showSummary,
+		RelativeTo:      *relativeTo,
+		FullPaths:       *fullPaths,
+		MaxWidth:        width,
+	})
+	if result.Interrupted {
+		os.Exit(exitInterrupted)
+	}
+}
+
+// traceDisplay holds the display flags shared by 'og trace' and
+// 'og trace render'
+type traceDisplay struct {
+	WebLinks        bool // --web-links given
+	AnnotationsPath string
+	ShowAnnotations bool
+	Summary         bool
+	RelativeTo      string
+	FullPaths       bool
+	MaxWidth        int
+}
+
+// printTraceTree prints a trace as a tree, followed by the number of call
+// locations and, if asked for, the summary
+func printTraceTree(result *TraceResult, serverURL string, d traceDisplay) {
+	useColor := colorOutput(os.Stdout)
+	// Use config's WebLinks setting as default if flag wasn't explicitly set
+	enableWebLinks := d.WebLinks
+	if !d.WebLinks {
+		if cfg, _ := LoadConfig(); cfg != nil {
+			enableWebLinks = cfg.WebLinks
+		}
+	}
+	enableWebLinks = enableWebLinks && hyperlinksOutput(os.Stdout)
+	AnnotateTrace(result, resolveAnnotationsPath(d.AnnotationsPath))
+	output := FormatTreeWithOptions(result, TreeFormatOptions{
+		UseColor:          useColor,
+		WebLinks:          enableWebLinks,
+		ServerURL:         serverURL,
+		ShowAnnotations:   d.ShowAnnotations,
+		RelativeTo:        d.RelativeTo,
+		StripCommonPrefix: isTerminal(os.Stdout) && !d.FullPaths,
+		MaxWidth:          d.MaxWidth,
+	})
+	fmt.Print(output)
+
+	// Show summary
+	if result.TotalNodes > 0 {
+		fmt.Printf("\nFound %d call locations.\n", result.TotalNodes)
+		if d.Summary {
+			fmt.Printf("\n%s", FormatTraceStats(ComputeTraceStats(result), useColor))
+		}
+	} else if !result.Interrupted {
+		fmt.Println("\nNo callers found.")
+	}
+}
+
+func handleTraceRender() {
+	fs := flag.NewFlagSet("trace render", flag.ExitOnError)
+	format := fs.String("format", "tree", "Output format: tree, dot (Graphviz) or mermaid")
+	depth := fs.IntP("depth", "d", 0, "Only show callers up to this depth (default: all saved)")
+	excludes := fs.StringArray("exclude", nil, "Leave out call sites in files matching a pattern, e.g. \"*_mock.c\" or \"/vendor/\" (repeatable)")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory used to mark annotated nodes (overrides config)")
+	showAnnotations := fs.Bool("show-annotations", false, "Show annotation text under annotated nodes")
+	showSummary := fs.Bool("summary", false, "Print callers per level, top fan-in functions and top files after the tree")
+	relativeTo := fs.String("relative-to", "", "Show paths relative to this prefix (e.g. /myproject/usr/src)")
+	maxWidth := fs.Int("max-width", 0, "Shorten paths to fit lines in this many columns (default: terminal width)")
+	fullPaths := fs.Bool("full-paths", false, "Show full paths even on a terminal (no prefix stripping or shortening)")
+	webLinks := fs.BoolP("web-links", "w", false, "Display clickable OpenGrok URLs for file references")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s trace render <trace.json> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Renders a trace saved with '%s trace --save' without querying the server.\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[4:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if !slices.Contains(traceRenderFormats, *format) {
+		fmt.Fprint(os.Stderr, trf("Error: unknown --format %q (%s)\n", *format, strings.Join(traceRenderFormats, ", ")))
+		os.Exit(1)
+	}
+	if *depth < 0 {
+		fmt.Fprint(os.Stderr, trf("Error: --depth must not be negative\n"))
+		os.Exit(1)
+	}
+
+	saved, err := loadTrace(os.Args[3])
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	result := pruneTrace(saved.Result, *depth, *excludes)
+
+	switch *format {
+	case "dot":
+		fmt.Print(FormatTraceDot(result))
+	case "mermaid":
+		fmt.Print(FormatTraceMermaid(result))
+	default:
+		width := *maxWidth
+		if !fs.Changed("max-width") && !*fullPaths {
+			width = terminalWidth(os.Stdout)
+		}
+		printTraceTree(result, saved.Server, traceDisplay{
+			WebLinks:        *webLinks,
+			AnnotationsPath: *annotationsPath,
+			ShowAnnotations: *showAnnotations,
+			Summary:         *showSummary,
+			RelativeTo:      *relativeTo,
+			FullPaths:       *fullPaths,
+			MaxWidth:        width,
+		})
+		if result.Interrupted {
+			fmt.Fprint(os.Stderr, trf("(the saved trace was interrupted and is partial)\n"))
+		}
+	}
+}
+
+func handleCat() {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	lineNumbers := fs.BoolP("line-numbers", "n", false, "Prefix each line with its line number")
+	theme := fs.String("theme", "", "Syntax highlighting style (default: config or monokai; \"none\" disables)")
+	encoding := fs.String("encoding", "", "Encoding of the file: utf-8, latin1, windows-1252, utf-16le or utf-16be (default: detect, refusing binary files)")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s cat <project/path> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	filePath := os.Args[2]
+	if strings.HasPrefix(filePath, "-") {
+		fmt.Fprint(os.Stderr, trf("Error: file path is required before options\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+
+	fs.Parse(os.Args[3:])
+	if err := checkEncoding(*encoding); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	client.Encoding = *encoding
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	progress := newProgress(*quietMode)
+	task := progress.Start("Fetching file...")
+	content, err := client.GetFile(filePath)
+	task.Done()
+	if errors.Is(err, ErrBinaryFile) {
+		// Printed as text it would only fill the terminal with garbage
+		fmt.Fprint(os.Stderr, trf("Binary file %s not shown (give --encoding to print it as text)\n", strings.TrimPrefix(filePath, "/")))
+		return
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error fetching file: %v\n", err))
+		os.Exit(1)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	useColor := colorOutput(os.Stdout)
+	if useColor {
+		lines = highlightLines(filePath, lines, resolveTheme(*theme))
+	}
+
+	width := len(fmt.Sprintf("%d", len(lines)))
+	for i, line := range lines {
+		if *lineNumbers {
+			if useColor {
+				fmt.Printf("%s%*d%s  %s\n", colorCyan, width, i+1, colorReset, line)
+			} else {
+				fmt.Printf("%*d  %s\n", width, i+1, line)
+			}
+		} else {
+			fmt.Println(line)
+		}
+	}
+}
+
+func handleLines() {
+	fs := flag.NewFlagSet("lines", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	webLinks := fs.BoolP("web-links", "w", false, "Print the OpenGrok URL of the first line above the range")
+	theme := fs.String("theme", "", "Syntax highlighting style (default: config or monokai; \"none\" disables)")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s lines <project/path> <start> <end> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print a range of a file's lines with their line numbers.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	fs.Parse(os.Args[2:])
+	if fs.NArg() != 3 {
+		fmt.Fprint(os.Stderr, trf("Error: file path, start and end lines are required\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+	filePath := fs.Arg(0)
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+	start, end, err := parseLineBounds(fs.Arg(1), fs.Arg(2))
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	progress := newProgress(*quietMode)
+	task := progress.Start("Fetching file...")
+	lines, err := client.GetFileLines(filePath, start, end)
+	task.Done()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error fetching file: %v\n", err))
+		os.Exit(1)
+	}
+	// A range running past the end of a file that ends in a newline gets an
+	// empty line after the last one
+	if n := len(lines); n > 0 && n < end-start+1 && lines[n-1] == "" {
+		lines = lines[:n-1]
+	}
+	if len(lines) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: %s has no lines in range %d-%d\n", strings.TrimPrefix(filePath, "/"), start, end))
+		os.Exit(1)
+	}
+
+	useColor := colorOutput(os.Stdout)
+	if useColor {
+		lines = highlightLines(filePath, lines, resolveTheme(*theme))
+	}
+	var link string
+	if *webLinks {
+		link = xrefURL(url, "", filePath, strconv.Itoa(start))
+	}
+	printLineRange(os.Stdout, lines, start, link, useColor)
+}
+
+func handleExportXref() {
+	fs := flag.NewFlagSet("export-xref", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	lineRange := fs.StringP("lines", "l", "", "Only export these lines (e.g. 120-160)")
+	lineNumbers := fs.BoolP("line-numbers", "n", false, "Prefix each line with its line number")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s export-xref <project/path> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print a file's cross-referenced source as Markdown, keeping its symbol links.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	filePath := os.Args[2]
+	if strings.HasPrefix(filePath, "-") {
+		fmt.Fprint(os.Stderr, trf("Error: file path is required before options\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
+
+	fs.Parse(os.Args[3:])
+
+	from, to, err := parseLineRange(*lineRange)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	progress := newProgress(*quietMode)
+	task := progress.Start("Fetching cross-reference...")
+	page, err := client.GetXref(filePath)
+	task.Done()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error fetching cross-reference: %v\n", err))
+		os.Exit(1)
+	}
+
+	lines, err := parseXref(page, xrefURL(url, "", filePath, ""))
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	lines = xrefLineRange(lines, from, to)
+	if len(lines) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: %s has no lines in range %s\n", strings.TrimPrefix(filePath, "/"), *lineRange))
+		os.Exit(1)
+	}
+	writeXrefMarkdown(os.Stdout, url, filePath, lines, *lineNumbers)
+}
+
+func handleAPI() {
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	data := fs.StringP("data", "d", "", "Request body (@file reads a file, @- reads stdin)")
+	include := fs.BoolP("include", "i", false, "Print the response status line and headers")
+	raw := fs.Bool("raw", false, "Print the response body as received, without pretty-printing JSON")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s api <method> <path> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Send a request to the server's REST API and print the response.\n")
+		fmt.Fprintf(os.Stderr, "Paths are relative to /api/v1 unless they start with api/.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 4 || strings.HasPrefix(os.Args[2], "-") || strings.HasPrefix(os.Args[3], "-") {
+		fs.Usage()
+		os.Exit(1)
+	}
+	method := strings.ToUpper(os.Args[2])
+	if !apiMethods[method] {
+		fmt.Fprint(os.Stderr, trf("Error: unknown HTTP method %q\n", os.Args[2]))
+		os.Exit(1)
+	}
+	path := os.Args[3]
+
+	fs.Parse(os.Args[4:])
+
+	var body []byte
+	if fs.Changed("data") {
+		var err error
+		if body, err = readAPIData(*data, os.Stdin); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error reading --data: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	progress := newProgress(*quietMode)
+	task := progress.Start(fmt.Sprintf("%s %s...", method, apiPath(path)))
+	resp, err := client.RawRequestContext(ctx, method, path, body)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	writeAPIResponse(os.Stdout, resp, *include, *raw)
+	if resp.StatusCode >= 400 {
+		fmt.Fprint(os.Stderr, trf("Error: server returned %s\n", resp.Status))
+		os.Exit(1)
+	}
+}
+
+func handleLineHistory() {
+	fs := flag.NewFlagSet("line-history", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	maxChanges := fs.IntP("max", "m", 5, "Maximum number of commits to follow back")
+	openWeb := fs.Bool("web", false, "Open the diff view of each commit in system web browser")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s line-history <project/path:line> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if len(os.Args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	arg := os.Args[2]
+	if strings.HasPrefix(arg, "-") {
+		fmt.Fprint(os.Stderr, trf("Error: file path and line are required before options\n\n"))
+		fs.Usage()
+		os.Exit(1)
+	}
+	filePath, line, err := parseFileLine(arg)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	fs.Parse(os.Args[3:])
+
+	if *maxChanges < 1 {
+		fmt.Fprint(os.Stderr, trf("Error: --max must be at least 1\n"))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Following line history...")
+	changes, err := LineHistory(ctx, client, filePath, line, *maxChanges)
+	task.Done()
+	if err != nil && len(changes) == 0 {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	printLineHistory(os.Stdout, filePath, line, changes, colorOutput(os.Stdout))
+	if isInterrupted(err) {
+		fmt.Fprintf(os.Stderr, "Interrupted; showing the commits found so far.\n")
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		// Earlier commits were found before the failure; show them anyway
+		fmt.Fprint(os.Stderr, trf("Warning: stopped early: %v\n", err))
+	}
+
+	if *openWeb {
+		for _, change := range changes {
+			webURL := lineChangeURL(url, filePath, change)
+			if err := openBrowser(webURL); err != nil {
+				fmt.Fprint(os.Stderr, trf("Error opening browser: %v\n", err))
+				fmt.Fprintf(os.Stderr, "URL: %s\n", webURL)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+func handleDiffResults() {
+	fs := flag.NewFlagSet("diff-results", flag.ExitOnError)
+	quietMode := fs.BoolP("quiet", "q", false, "Print nothing; only set the exit status")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s diff-results <saved1.json> <saved2.json> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compares two result files saved with --save-results and lists the hits\n")
+		fmt.Fprintf(os.Stderr, "removed (-) and added (+) in the second. Exits with status 1 if they differ.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:])
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	before, err := loadResultSnapshot(fs.Arg(0))
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(2)
+	}
+	after, err := loadResultSnapshot(fs.Arg(1))
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(2)
+	}
+	if before.Search != after.Search || before.Query != after.Query {
+		fmt.Fprint(os.Stderr, trf("Warning: comparing different searches (%s %q and %s %q)\n", before.Search, before.Query, after.Search, after.Query))
+	}
+
+	diff := diffSnapshots(before, after)
+	if !*quietMode {
+		printResultDiff(os.Stdout, diff, colorOutput(os.Stdout))
+	}
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func handleOpenLast() {
+	fs := flag.NewFlagSet("open-last", flag.ExitOnError)
+	editMode := fs.Bool("edit", false, "Open the result in $VISUAL/$EDITOR in its local checkout")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s open-last [n] [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Opens result n (default 1) of the last search, as numbered by --numbered.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:])
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	n := 1
+	if fs.NArg() == 1 {
+		var err error
+		if n, err = parseResultNumber(fs.Arg(0)); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+	}
+
+	snap, err := loadLastResults()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	hit, err := selectHit(snap, n)
+	if err == nil {
+		// Links go to the server that was searched, whatever the current default
+		err = openHit(snap.Server, hit, *editMode)
+	}
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+}
+
+func handleWatchlist() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s watchlist add|remove|list|run [args] [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "add":
+		handleWatchlistAdd()
+	case "remove":
+		handleWatchlistRemove()
+	case "list":
+		handleWatchlistList()
+	case "run":
+		handleWatchlistRun()
+	default:
+		fmt.Fprint(os.Stderr, trf("Error: unknown watchlist command %q\n", os.Args[2]))
+		fmt.Fprintf(os.Stderr, "Usage: %s watchlist add|remove|list|run [args] [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+}
+
+// mustLoadWatchlist loads the watchlist, or exits
+func mustLoadWatchlist() *Watchlist {
+	list, err := loadWatchlist()
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to load watchlist: %v\n", err))
+		os.Exit(1)
+	}
+	return list
+}
+
+// mustSaveWatchlist saves the watchlist, or exits
+func mustSaveWatchlist(list *Watchlist) {
+	if err := saveWatchlist(list); err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: failed to save watchlist: %v\n", err))
+		os.Exit(1)
+	}
+}
+
+func handleWatchlistAdd() {
+	fs := flag.NewFlagSet("watchlist add", flag.ExitOnError)
+	projects := fs.StringP("projects", "p", "", "Projects to look for callers in (comma-separated, @group expands a project group, linux-* matches project names)")
+	defPath := fs.String("def-path", "", "Watch the definition whose path contains this string (when the symbol is defined in several places)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watchlist add <symbol> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Adds a symbol to the watchlist; 'og watchlist run' reports its new callers.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	list := mustLoadWatchlist()
+	err := list.add(WatchedSymbol{Symbol: fs.Arg(0), Projects: *projects, DefPath: *defPath, Added: time.Now()})
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	mustSaveWatchlist(list)
+	fmt.Printf("Watching %s; run '%s watchlist run' to take its first snapshot\n", fs.Arg(0), os.Args[0])
+}
+
+func handleWatchlistRemove() {
+	fs := flag.NewFlagSet("watchlist remove", flag.ExitOnError)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watchlist remove <symbol>\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Removes a symbol and its snapshot from the watchlist.\n")
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	list := mustLoadWatchlist()
+	if list.remove(fs.Arg(0)) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: %s is not in the watchlist\n", fs.Arg(0)))
+		os.Exit(1)
+	}
+	mustSaveWatchlist(list)
+	fmt.Printf("Stopped watching %s\n", fs.Arg(0))
+}
+
+func handleWatchlistList() {
+	list := mustLoadWatchlist()
+	if len(list.Symbols) == 0 {
+		fmt.Println("The watchlist is empty.")
+		fmt.Printf("Run '%s watchlist add <symbol>' to watch one.\n", os.Args[0])
+		return
+	}
+	formatWatchlist(os.Stdout, list)
+}
+
+func handleWatchlistRun() {
+	fs := flag.NewFlagSet("watchlist run", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	maxTotal := fs.Int("max-total", watchMaxTotal, "Maximum callers to find per symbol")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s watchlist run [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Traces the direct callers of each watched symbol, reports the callers\n")
+		fmt.Fprintf(os.Stderr, "added and removed since the last run and saves the new snapshots.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 0 {
+		fmt.Fprint(os.Stderr, trf("Error: unexpected argument %q\n\n", fs.Arg(0)))
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	list := mustLoadWatchlist()
+	if len(list.Symbols) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: the watchlist is empty\n"))
+		fmt.Fprintf(os.Stderr, "Run '%s watchlist add <symbol>' to watch one.\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+
+	// Groups and patterns are expanded up front, as a bad one exits
+	projects := make(map[string]string)
+	for _, w := range list.Symbols {
+		projects[w.Projects] = resolveProjects(w.Projects, client)
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Tracing watched symbols...")
+	excludes := traceExcludes(loadTraceExcludes(), false, nil)
+	done := 0
+	var ambiguous []*TraceResult
+	reports, err := runWatchlist(ctx, list, url, time.Now(), func(w WatchedSymbol) (*TraceResult, error) {
+		done++
+		task.Updatef("Tracing %s (%d/%d)...", w.Symbol, done, len(list.Symbols))
+		result, err := Trace(ctx, client, TraceOptions{
+			Symbol:        w.Symbol,
+			Depth:         1,
+			Direction:     "callers",
+			MaxTotal:      *maxTotal,
+			Projects:      projects[w.Projects],
+			DefPath:       w.DefPath,
+			AnyDefinition: true,
+			Exclude:       excludes,
+		})
+		if err == nil && len(result.Candidates) > 0 {
+			ambiguous = append(ambiguous, result)
+		}
+		return result, err
+	})
+	task.Done()
+	for _, result := range ambiguous {
+		warnAnyDefinition(result)
+	}
+
+	// Snapshots taken before an interrupt are kept
+	mustSaveWatchlist(list)
+	formatWatchReports(os.Stdout, reports, colorOutput(os.Stdout))
+	exitIfInterrupted(os.Stderr, err)
+	for _, r := range reports {
+		if r.Err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+func handleAnnotate() {
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "Usage: %s annotate list|link|resolve [args] [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	switch os.Args[2] {
+	case "list":
+		handleAnnotateList()
+	case "link":
+		handleAnnotateLink()
+	case "resolve":
+		handleAnnotateResolve()
+	default:
+		fmt.Fprint(os.Stderr, trf("Error: unknown annotate command %q\n", os.Args[2]))
+		fmt.Fprintf(os.Stderr, "Usage: %s annotate list|link|resolve [args] [options]\n", os.Args[0])
+		os.Exit(1)
+	}
+}
+
+func handleAnnotateList() {
+	fs := flag.NewFlagSet("annotate list", flag.ExitOnError)
+	tag := fs.String("tag", "", "Only list annotations with this tag (e.g. bug, question, perf)")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory (overrides config)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s annotate list [project] [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Lists the annotations in og_annotate storage, by file and line.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	storagePath := annotationStorage(*annotationsPath)
+
+	listed, err := listAnnotations(storagePath, fs.Arg(0), *tag)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	if len(listed) == 0 {
+		fmt.Fprintln(os.Stderr, "No annotations found.")
+		return
+	}
+	printAnnotations(os.Stdout, listed, colorOutput(os.Stdout))
+}
+
+// annotationStorage returns the og_annotate storage directory, or exits
+func annotationStorage(flagPath string) string {
+	storagePath := resolveAnnotationsPath(flagPath)
+	if storagePath == "" {
+		fmt.Fprint(os.Stderr, trf("Error: no annotation storage configured\n"))
+		fmt.Fprintf(os.Stderr, "Pass --annotations <dir> or set \"annotations_path\" in the config file\n")
+		os.Exit(1)
+	}
+	return storagePath
+}
+
+func handleAnnotateLink() {
+	fs := flag.NewFlagSet("annotate link", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL the link points at (overrides config)")
+	author := fs.String("author", "", "Link this author's note when several people annotated the line")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory (overrides config)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s annotate link <project>/<path>:<line> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Prints a shareable permalink to the annotation on a line.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[3:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
 
-	// Get server URL
-	url := getServerURL(*serverURL)
+	filePath, line, err := parseFileLine(fs.Arg(0))
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	project, path, _ := strings.Cut(strings.TrimPrefix(filePath, "/"), "/")
+	storagePath := annotationStorage(*annotationsPath)
 
-	// Create client
-	client, err := NewClient(url)
+	link, err := linkAnnotation(storagePath, getServerURL(*serverURL), project, path, line, *author)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
+	fmt.Println(link)
+}
 
-	// Configure authentication
-	configureClientAuth(client, AuthOptions{
-		Username:    *username,
-		Password:    *password,
-		APIKey:      *apiKey,
-		BearerToken: *bearerToken,
-	})
+func handleAnnotateResolve() {
+	fs := flag.NewFlagSet("annotate resolve", flag.ExitOnError)
+	openLink := fs.Bool("open", false, "Open the annotated line in the browser")
+	annotationsPath := fs.String("annotations", "", "og_annotate storage directory (overrides config)")
 
-	s := newSpinner("Fetching projects...")
-	if !*quietMode && isTerminal(os.Stderr) {
-		s.Start()
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s annotate resolve <permalink> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Shows the annotation a permalink names, at its current line.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
 	}
-	projectsList, err := client.GetProjects()
-	s.Stop()
+	fs.Parse(os.Args[3:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	storagePath := annotationStorage(*annotationsPath)
+	ref, ann, err := resolveAnnotationLink(storagePath, fs.Arg(0))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing projects: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
+	printAnnotations(os.Stdout, []storedAnnotation{ann}, colorOutput(os.Stdout))
 
-	fmt.Println("Available projects:")
-	for _, project := range projectsList {
-		fmt.Printf("  - %s\n", project)
+	// The link points at the server it was made for, which may not be ours
+	link := annotationPermalink(ref)
+	if link != strings.TrimSpace(fs.Arg(0)) {
+		fmt.Fprint(os.Stderr, trf("(the note has moved or changed; current link: %s)\n", link))
+	}
+	if *openLink {
+		if err := openBrowser(link); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error opening browser: %v\n", err))
+			fmt.Fprintf(os.Stderr, "URL: %s\n", link)
+			os.Exit(1)
+		}
 	}
 }
 
-func handleSearch(searchType string) {
-	// Parse flags for search command
-	fs := flag.NewFlagSet(searchType, flag.ExitOnError)
+// printAnnotations prints listed annotations as "project/path:line" headers
+// followed by the indented text
+func printAnnotations(w io.Writer, listed []storedAnnotation, useColor bool) {
+	for _, ann := range listed {
+		location := fmt.Sprintf("%s/%s:%d", ann.Project, ann.FilePath, ann.Line)
+		date := ann.Timestamp
+		if len(date) > 10 {
+			date = date[:10]
+		}
+		header := fmt.Sprintf("@%s (%s)", ann.Author, date)
+		if len(ann.Tags) > 0 {
+			tags := "[" + strings.Join(ann.Tags, ", ") + "]"
+			if useColor {
+				tags = colorBold + tags + colorReset
+			}
+			header += " " + tags
+		}
+		if useColor {
+			location = colorMagenta + location + colorReset
+		}
+		fmt.Fprintf(w, "%s %s\n", location, header)
+		for _, line := range strings.Split(ann.Text, "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+}
+
+func handleCompare() {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
 	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	projects := fs.StringP("projects", "p", "", "Projects to compare (comma-separated, @group expands a project group, linux-* matches project names)")
 	typeFilter := fs.StringP("type", "t", "", "File type filter")
-	projects := fs.StringP("projects", "p", "", "Projects to search (comma-separated)")
-	maxResults := fs.IntP("max", "m", 25, "Maximum number of results")
-	webMode := fs.Bool("web", false, "Open results in system web browser")
-	webLinks := fs.BoolP("web-links", "w", false, "Display clickable OpenGrok URLs for file references")
+	maxFiles := fs.IntP("max", "m", 100, "Maximum number of files to fetch per search")
 	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
 	username := fs.String("username", "", "Username for basic authentication")
 	password := fs.String("password", "", "Password for basic authentication")
@@ -219,41 +3419,34 @@ func handleSearch(searchType string) {
 	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s %s <query> [options]\n\n", os.Args[0], searchType)
+		fmt.Fprintf(os.Stderr, "Usage: %s compare <symbol> --projects <a,b,...> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Show which projects define and reference a symbol, file by file.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 	}
 
-	// We need at least one argument (the query)
 	if len(os.Args) < 3 {
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	// The query is the first argument after the command
-	query := os.Args[2]
-
-	// Check if query looks like a flag
-	if strings.HasPrefix(query, "-") {
-		fmt.Fprintf(os.Stderr, "Error: query is required before options\n\n")
+	symbol := os.Args[2]
+	if strings.HasPrefix(symbol, "-") {
+		fmt.Fprint(os.Stderr, trf("Error: symbol is required before options\n\n"))
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	// Parse remaining flags (after query)
 	fs.Parse(os.Args[3:])
 
-	// Get server URL
 	url := getServerURL(*serverURL)
 
-	// Create client
 	client, err := NewClient(url)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
 
-	// Configure authentication
 	configureClientAuth(client, AuthOptions{
 		Username:    *username,
 		Password:    *password,
@@ -261,320 +3454,187 @@ func handleSearch(searchType string) {
 		BearerToken: *bearerToken,
 	})
 
-	// Build search options based on search type
-	opts := SearchOptions{
-		Type:       *typeFilter,
-		Projects:   *projects,
-		MaxResults: *maxResults,
+	var projectList []string
+	for _, p := range strings.Split(resolveProjects(*projects, client), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			projectList = append(projectList, p)
+		}
 	}
-
-	switch searchType {
-	case "full":
-		opts.Full = query
-	case "def":
-		opts.Def = query
-	case "symbol":
-		opts.Symbol = query
-	case "path":
-		opts.Path = query
-	case "hist":
-		opts.Hist = query
+	if len(projectList) < 2 {
+		fmt.Fprint(os.Stderr, trf("Error: --projects must list at least two projects to compare\n"))
+		os.Exit(1)
 	}
 
-	// Perform search with spinner
-	s := newSpinner("Searching...")
-	if !*quietMode && isTerminal(os.Stderr) {
-		s.Start()
-	}
-	result, err := client.Search(opts)
-	s.Stop()
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Comparing projects...")
+	comparison, err := CompareSymbol(ctx, client, symbol, projectList, *typeFilter, *maxFiles)
+	task.Done()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error performing search: %v\n", err)
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error comparing projects: %v\n", err))
 		os.Exit(1)
 	}
 
-	// Handle web mode or display results
-	if *webMode {
-		openSearchResults(url, result)
-	} else {
-		useColor := isTerminal(os.Stdout)
-		// Use config's WebLinks setting as default if flag wasn't explicitly set
-		enableWebLinks := *webLinks
-		if !*webLinks {
-			if cfg, _ := LoadConfig(); cfg != nil {
-				enableWebLinks = cfg.WebLinks
-			}
-		}
-		printResults(result, useColor, enableWebLinks, url)
-	}
+	fmt.Print(FormatComparison(comparison, colorOutput(os.Stdout)))
 }
 
-// getServerURL returns the server URL from the flag or config
-func getServerURL(flagURL string) string {
-	if flagURL != "" {
-		return strings.TrimSuffix(flagURL, "/")
-	}
+func handleTodo() {
+	fs := flag.NewFlagSet("todo", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	projects := fs.StringP("projects", "p", "", "Projects to scan (comma-separated, @group expands a project group, linux-* matches project names)")
+	typeFilter := fs.StringP("type", "t", "", "File type filter")
+	pathFilter := fs.String("path", "", "Only scan files whose path matches this pattern (e.g. 'uts/common/*')")
+	maxFiles := fs.IntP("max", "m", 200, "Maximum number of files to fetch")
+	markers := fs.String("markers", "", "Markers to look for (comma-separated subset of TODO,FIXME,XXX)")
+	owner := fs.String("owner", "", "Only show markers attributed to this owner (\""+unassignedOwner+"\" for none)")
+	jsonOutput := fs.Bool("json", false, "Print the report as JSON")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
 
-	config, err := LoadConfig()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to load config: %v\n", err)
-	} else if config != nil && config.ServerURL != "" {
-		return config.ServerURL
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s todo [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List TODO, FIXME and XXX comments by file, with a summary per owner.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
 	}
-
-	fmt.Fprintf(os.Stderr, "Error: no server URL configured\n")
-	fmt.Fprintf(os.Stderr, "Run '%s init <server-url>' or use --server flag\n", os.Args[0])
-	os.Exit(1)
-	return ""
-}
-
-func printResults(resp *SearchResponse, useColor bool, webLinks bool, serverURL string) {
-	if resp.ResultCount == 0 {
-		fmt.Println("No results found.")
-		return
+	fs.Parse(os.Args[2:])
+	if fs.NArg() > 0 {
+		fmt.Fprint(os.Stderr, trf("Error: unexpected argument %q\n\n", fs.Arg(0)))
+		fs.Usage()
+		os.Exit(1)
 	}
 
-	for project, results := range resp.Results {
-		for _, r := range results {
-			path := r.Path
-			if path == "" {
-				path = r.Directory
-				if path != "" && !strings.HasSuffix(path, "/") {
-					path += "/"
-				}
-				path += r.Filename
-			}
-
-			line := strings.TrimSpace(r.Line)
-			lineNo := string(r.LineNo)
-
-			// Construct web URL if --web-links is enabled
-			var webURL string
-			if webLinks {
-				webURL = fmt.Sprintf("%s/xref/%s%s", serverURL, project, path)
-				if lineNo != "" {
-					webURL += "#" + lineNo
-				}
-			}
+	url := getServerURL(*serverURL)
 
-			if useColor {
-				// Format: project/path:line:content (with colors like ripgrep)
-				if lineNo != "" {
-					if webLinks {
-						// Add clickable link using OSC 8 hyperlink escape sequence
-						fmt.Printf("\033]8;;%s\033\\%s%s%s\033]8;;\033\\:%s%s%s:%s\n",
-							webURL,
-							colorMagenta, project+path, colorReset,
-							colorCyan, lineNo, colorReset,
-							highlightMatch(line))
-					} else {
-						fmt.Printf("%s%s%s:%s%s%s:%s\n",
-							colorMagenta, project+path, colorReset,
-							colorCyan, lineNo, colorReset,
-							highlightMatch(line))
-					}
-				} else {
-					// No line number available for this result
-					if webLinks {
-						fmt.Printf("\033]8;;%s\033\\%s%s%s\033]8;;\033\\:%s\n",
-							webURL,
-							colorMagenta, project+path, colorReset,
-							highlightMatch(line))
-					} else {
-						fmt.Printf("%s%s%s:%s\n",
-							colorMagenta, project+path, colorReset,
-							highlightMatch(line))
-					}
-				}
-			} else {
-				if lineNo != "" {
-					if webLinks {
-						// Plain mode with web link - only path is clickable
-						fmt.Printf("\033]8;;%s\033\\%s\033]8;;\033\\:%s:%s\n",
-							webURL, project+path, lineNo, stripHTMLTags(line))
-					} else {
-						fmt.Printf("%s:%s:%s\n", project+path, lineNo, stripHTMLTags(line))
-					}
-				} else {
-					// No line number available for this result
-					if webLinks {
-						fmt.Printf("\033]8;;%s\033\\%s\033]8;;\033\\:%s\n",
-							webURL, project+path, stripHTMLTags(line))
-					} else {
-						fmt.Printf("%s:%s\n", project+path, stripHTMLTags(line))
-					}
-				}
-			}
-		}
+	client, err := NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
 	}
-}
-
-// highlightMatch adds bold formatting to <b> tags in the line
-// OpenGrok returns matches wrapped in <b> tags
-func highlightMatch(line string) string {
-	// Replace <b> with bold+red, </b> with reset
-	result := strings.ReplaceAll(line, "<b>", colorBold+colorRed)
-	result = strings.ReplaceAll(result, "</b>", colorReset)
-	// Strip any other HTML tags that might be in the response
-	result = stripHTMLTags(result)
-	return result
-}
 
-// stripHTMLTags removes HTML tags from the string
-func stripHTMLTags(s string) string {
-	return htmlTagRegex.ReplaceAllString(s, "")
-}
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
 
-func openSearchResults(serverURL string, resp *SearchResponse) {
-	if resp.ResultCount == 0 {
-		fmt.Println("No results found.")
-		return
+	opts := TodoOptions{
+		Projects: resolveProjects(*projects, client),
+		FileType: *typeFilter,
+		Path:     *pathFilter,
+		MaxFiles: *maxFiles,
+		Owner:    *owner,
 	}
-
-	// Count total results and capture single result if there's exactly one
-	totalResults := 0
-	var singleProject string
-	var singleResult SearchResult
-	for project, results := range resp.Results {
-		for _, r := range results {
-			totalResults++
-			if totalResults == 1 {
-				singleProject = project
-				singleResult = r
+	if *markers != "" {
+		for _, m := range strings.Split(*markers, ",") {
+			m = strings.ToUpper(strings.TrimSpace(m))
+			if !containsString(todoMarkers, m) {
+				fmt.Fprint(os.Stderr, trf("Error: unknown marker %q (expected %s)\n", m, strings.Join(todoMarkers, ", ")))
+				os.Exit(1)
 			}
+			opts.Markers = append(opts.Markers, m)
 		}
 	}
 
-	var webURL string
-	if totalResults == 1 {
-		// Open the specific file at the line number
-		path := singleResult.Path
-		if path == "" {
-			path = singleResult.Directory
-			if path != "" && !strings.HasSuffix(path, "/") {
-				path += "/"
-			}
-			path += singleResult.Filename
-		}
-		webURL = fmt.Sprintf("%s/xref/%s%s", serverURL, singleProject, path)
-		if singleResult.LineNo != "" {
-			webURL += "#" + string(singleResult.LineNo)
-		}
-		fmt.Printf("Opening file: %s%s\n", singleProject, path)
-	} else {
-		// Open the search results page in the web interface
-		// OpenGrok web interface uses the same base URL with /search path
-		webURL = serverURL + "/search"
-		fmt.Printf("Opening search results (%d results) in browser...\n", resp.ResultCount)
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Scanning for markers...")
+	report, err := FindTodos(ctx, client, opts)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
 	}
 
-	if err := openBrowser(webURL); err != nil {
-		fmt.Fprintf(os.Stderr, "Error opening browser: %v\n", err)
-		fmt.Fprintf(os.Stderr, "URL: %s\n", webURL)
-		os.Exit(1)
+	if *jsonOutput {
+		if err := writeTodoJSON(os.Stdout, report); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		return
 	}
+	printTodoReport(os.Stdout, report, colorOutput(os.Stdout))
 }
 
-func handleInit() {
-	// Parse flags for init command
-	fs := flag.NewFlagSet("init", flag.ExitOnError)
+func handleProjectStats() {
+	fs := flag.NewFlagSet("project-stats", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	top := fs.Int("top", 10, "Rows to show per breakdown (0 for all)")
+	jsonOutput := fs.Bool("json", false, "Print the statistics as JSON")
+	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
 	username := fs.String("username", "", "Username for basic authentication")
 	password := fs.String("password", "", "Password for basic authentication")
 	apiKey := fs.String("api-key", "", "API key for authentication")
 	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
-	webLinks := fs.BoolP("web-links", "w", false, "Enable web links by default in output")
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s init <server-url> [options]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Example: %s init http://opengrok.example.com/source\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "         %s init http://opengrok.example.com/source --username user --password pass\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "\nOptions:\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s project-stats <project> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Summarize a project's indexed files by type and directory, and its repositories.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 	}
 
-	if len(os.Args) < 3 {
+	if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
 		fs.Usage()
 		os.Exit(1)
 	}
+	project := os.Args[2]
 
-	// The server URL is the first argument after "init"
-	serverURL := os.Args[2]
-
-	// Check if serverURL looks like a flag
-	if strings.HasPrefix(serverURL, "-") {
-		fmt.Fprintf(os.Stderr, "Error: server URL is required before options\n\n")
-		fs.Usage()
+	fs.Parse(os.Args[3:])
+	if *top < 0 {
+		fmt.Fprint(os.Stderr, trf("Error: --top must not be negative\n"))
 		os.Exit(1)
 	}
 
-	serverURL = strings.TrimSuffix(serverURL, "/")
-
-	// Parse remaining flags (after server URL)
-	fs.Parse(os.Args[3:])
+	url := getServerURL(*serverURL)
 
-	// Validate the URL by trying to create a client
-	_, err := NewClient(serverURL)
+	client, err := NewClient(url)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: invalid server URL: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
 
-	config := &Config{
-		ServerURL:   serverURL,
+	configureClientAuth(client, AuthOptions{
 		Username:    *username,
 		Password:    *password,
 		APIKey:      *apiKey,
 		BearerToken: *bearerToken,
-		WebLinks:    *webLinks,
-	}
+	})
 
-	if err := SaveConfig(config); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to save config: %v\n", err)
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Collecting project statistics...")
+	stats, err := CollectProjectStats(ctx, client, project, task)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
 
-	fmt.Printf("Server URL saved: %s\n", serverURL)
-	if *bearerToken != "" {
-		fmt.Println("Authentication: Bearer token configured")
-	} else if *apiKey != "" {
-		fmt.Println("Authentication: API key configured")
-	} else if *username != "" {
-		fmt.Println("Authentication: Basic auth configured")
-	}
-	if *webLinks {
-		fmt.Println("Web links: Enabled by default")
-	}
-	fmt.Println("You can now run searches without the --server flag.")
-}
-
-// newSpinner creates a new spinner with the given message.
-// Uses the same spinner style as the gh CLI (CharSet 11 - dots).
-// Returns a no-op spinner if stderr is not a terminal.
-func newSpinner(message string) *spinner.Spinner {
-	s := spinner.New(spinner.CharSets[11], 120*time.Millisecond, spinner.WithWriter(os.Stderr))
-	s.Suffix = " " + message
-	s.FinalMSG = ""
-	return s
-}
-
-// isTerminal returns true if the file is a terminal.
-func isTerminal(f *os.File) bool {
-	stat, err := f.Stat()
-	if err != nil {
-		return false
+	if *jsonOutput {
+		if err := writeProjectStatsJSON(os.Stdout, stats); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
+		}
+		return
 	}
-	return (stat.Mode() & os.ModeCharDevice) != 0
+	printProjectStats(os.Stdout, stats, *top, colorOutput(os.Stdout))
 }
 
-func handleTrace() {
-	// Parse flags for trace command
-	fs := flag.NewFlagSet("trace", flag.ExitOnError)
+func handleFileInfo() {
+	fs := flag.NewFlagSet("fileinfo", flag.ExitOnError)
 	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
-	projects := fs.StringP("projects", "p", "", "Projects to search (comma-separated)")
-	typeFilter := fs.StringP("type", "t", "", "File type filter")
-	depth := fs.IntP("depth", "d", 2, "Maximum traversal depth")
-	maxTotal := fs.Int("max-total", 100, "Maximum total nodes to explore")
-	webLinks := fs.BoolP("web-links", "w", false, "Display clickable OpenGrok URLs for file references")
+	jsonOutput := fs.Bool("json", false, "Print the metadata as JSON")
 	quietMode := fs.BoolP("quiet", "q", false, "Suppress progress output (spinners)")
 	username := fs.String("username", "", "Username for basic authentication")
 	password := fs.String("password", "", "Password for basic authentication")
@@ -582,42 +3642,36 @@ func handleTrace() {
 	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
 
 	fs.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s trace <symbol> [options]\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Trace the call graph by finding callers of a symbol.\n\n")
+		fmt.Fprintf(os.Stderr, "Usage: %s fileinfo <project/path> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Show the metadata OpenGrok keeps for an indexed file: genre, size and last revision.\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fs.PrintDefaults()
 	}
 
-	// We need at least one argument (the symbol)
-	if len(os.Args) < 3 {
+	if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
 		fs.Usage()
 		os.Exit(1)
 	}
+	filePath := os.Args[2]
+	if !strings.HasPrefix(filePath, "/") {
+		filePath = "/" + filePath
+	}
 
-	// The symbol is the first argument after the command
-	symbol := os.Args[2]
-
-	// Check if symbol looks like a flag
-	if strings.HasPrefix(symbol, "-") {
-		fmt.Fprintf(os.Stderr, "Error: symbol is required before options\n\n")
+	fs.Parse(os.Args[3:])
+	if fs.NArg() > 0 {
+		fmt.Fprint(os.Stderr, trf("Error: unexpected argument %q\n\n", fs.Arg(0)))
 		fs.Usage()
 		os.Exit(1)
 	}
 
-	// Parse remaining flags (after symbol)
-	fs.Parse(os.Args[3:])
-
-	// Get server URL
 	url := getServerURL(*serverURL)
 
-	// Create client
 	client, err := NewClient(url)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
 
-	// Configure authentication
 	configureClientAuth(client, AuthOptions{
 		Username:    *username,
 		Password:    *password,
@@ -625,44 +3679,65 @@ func handleTrace() {
 		BearerToken: *bearerToken,
 	})
 
-	// Build trace options
-	opts := TraceOptions{
-		Symbol:    symbol,
-		Depth:     *depth,
-		Direction: "callers", // Only callers supported in v1
-		MaxTotal:  *maxTotal,
-		Projects:  *projects,
-		Type:      *typeFilter,
-	}
-
-	// Perform trace with spinner
-	s := newSpinner("Tracing call graph...")
-	if !*quietMode && isTerminal(os.Stderr) {
-		s.Start()
-	}
-	result, err := Trace(client, opts)
-	s.Stop()
+	ctx, stop := interruptContext()
+	defer stop()
+	progress := newProgress(*quietMode)
+	task := progress.Start("Reading file metadata...")
+	info, err := CollectFileInfo(ctx, client, filePath, task)
+	task.Done()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error tracing call graph: %v\n", err)
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
 		os.Exit(1)
 	}
 
-	// Display results
-	useColor := isTerminal(os.Stdout)
-	// Use config's WebLinks setting as default if flag wasn't explicitly set
-	enableWebLinks := *webLinks
-	if !*webLinks {
-		if cfg, _ := LoadConfig(); cfg != nil {
-			enableWebLinks = cfg.WebLinks
+	if *jsonOutput {
+		if err := writeFileInfoJSON(os.Stdout, info); err != nil {
+			fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+			os.Exit(1)
 		}
+		return
 	}
-	output := FormatTree(result, useColor, enableWebLinks, url)
-	fmt.Print(output)
+	printFileInfo(os.Stdout, info, colorOutput(os.Stdout))
+}
 
-	// Show summary
-	if result.TotalNodes > 0 {
-		fmt.Printf("\nFound %d call locations.\n", result.TotalNodes)
+// printLineHistory prints the commits that changed a line, newest first, with
+// the line as each commit left it
+func printLineHistory(w io.Writer, filePath string, line int, changes []LineChange, useColor bool) {
+	name := strings.TrimPrefix(filePath, "/")
+	if useColor {
+		fmt.Fprintf(w, "%s%s%s:%s%d%s\n", colorMagenta, name, colorReset, colorCyan, line, colorReset)
 	} else {
-		fmt.Println("\nNo callers found.")
+		fmt.Fprintf(w, "%s:%d\n", name, line)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No history found.")
+		return
+	}
+
+	for _, c := range changes {
+		rev := c.Revision
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		note := fmt.Sprintf("line %d", c.Line)
+		if c.Added {
+			note += ", added"
+		}
+		if useColor {
+			fmt.Fprintf(w, "\n%s%s%s %s %s%s%s (%s)\n", colorCyan, rev, colorReset, c.Day(), colorBold, c.Author, colorReset, note)
+		} else {
+			fmt.Fprintf(w, "\n%s %s %s (%s)\n", rev, c.Day(), c.Author, note)
+		}
+		if summary := c.Summary(); summary != "" {
+			fmt.Fprintf(w, "    %s\n", summary)
+		}
+		if c.Text != "" {
+			fmt.Fprintf(w, "    | %s\n", strings.TrimSpace(c.Text))
+		}
+	}
+
+	if last := changes[len(changes)-1]; !last.Added && last.Parent != "" {
+		fmt.Fprintf(w, "\n(older changes not shown; use --max to follow further back)\n")
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MatchSpan is one match the server highlighted in a result line, as byte
+// offsets into the line's plain text: Start is the first byte, End the byte
+// after the last, both counted from 0
+type MatchSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// parseMatches splits a result line as OpenGrok returns it, HTML with each
+// match wrapped in <b>...</b>, into plain text and the spans of the matches
+// in it. Other tags are dropped and entities unescaped, so the offsets line
+// up with the source line rather than its markup. A <b> left open runs to
+// the end of the line; empty matches are dropped.
+func parseMatches(line string) (string, []MatchSpan) {
+	var text strings.Builder
+	var spans []MatchSpan
+	start := -1
+	for line != "" {
+		lt := strings.IndexByte(line, '<')
+		if lt < 0 {
+			text.WriteString(html.UnescapeString(line))
+			break
+		}
+		text.WriteString(html.UnescapeString(line[:lt]))
+		gt := strings.IndexByte(line[lt:], '>')
+		if gt < 0 {
+			// Not a tag: keep the rest as text, as stripHTMLTags would
+			text.WriteString(html.UnescapeString(line[lt:]))
+			break
+		}
+		tag := line[lt+1 : lt+gt]
+		if strings.Contains(tag, "<") {
+			// A stray "<" before a tag
+			text.WriteByte('<')
+			line = line[lt+1:]
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(tag)) {
+		case "b":
+			if start < 0 {
+				start = text.Len()
+			}
+		case "/b":
+			if start >= 0 && text.Len() > start {
+				spans = append(spans, MatchSpan{Start: start, End: text.Len()})
+			}
+			start = -1
+		}
+		line = line[lt+gt+1:]
+	}
+	if start >= 0 && text.Len() > start {
+		spans = append(spans, MatchSpan{Start: start, End: text.Len()})
+	}
+	return text.String(), spans
+}
+
+// highlightMatch renders a result line for the terminal with its matches in
+// bold red
+func highlightMatch(line string) string {
+	return highlightSpans(parseMatches(line))
+}
+
+// highlightSpans renders plain text for the terminal with the given spans in
+// bold red
+func highlightSpans(text string, spans []MatchSpan) string {
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		sb.WriteString(text[last:s.Start])
+		sb.WriteString(colorBold + colorRed + text[s.Start:s.End] + colorReset)
+		last = s.End
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// SearchHit is one line hit of a search, as 'og search --json' prints it
+type SearchHit struct {
+	Project string `json:"project"`
+	Path    string `json:"path"` // Path within the project
+	Line    int    `json:"line,omitempty"`
+	// Text is the line as plain text, untrimmed so Matches index into it
+	Text    string      `json:"text"`
+	Matches []MatchSpan `json:"matches"`
+	URL     string      `json:"url"`
+	// Labels are what a --pipe filter added to the hit, e.g. its owner
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// newSearchHits converts search results into hits with their match spans
+func newSearchHits(resp *SearchResponse, serverURL string) []SearchHit {
+	hits := []SearchHit{}
+	for _, r := range resp.OrderedEntries() {
+		text, spans := parseMatches(r.Line)
+		if spans == nil {
+			spans = []MatchSpan{}
+		}
+		path := r.FilePath()
+		lineNo, _ := strconv.Atoi(string(r.LineNo))
+		hits = append(hits, SearchHit{
+			Project: r.Project,
+			Path:    path,
+			Line:    lineNo,
+			Text:    text,
+			Matches: spans,
+			URL:     xrefURL(serverURL, r.Project, path, string(r.LineNo)),
+			Labels:  r.Labels,
+		})
+	}
+	return hits
+}
+
+// writeSearchHitsJSON writes hits and the search summary as an indented
+// JSON object
+func writeSearchHitsJSON(w io.Writer, hits []SearchHit, totals ResultTotals) error {
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Hits    []SearchHit  `json:"hits"`
+		Summary ResultTotals `json:"summary"`
+	}{hits, totals})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseMatches(t *testing.T) {
+	tests := []struct {
+		line  string
+		text  string
+		spans []MatchSpan
+	}{
+		{"no matches", "no matches", nil},
+		{"\tp = <b>kmem_alloc</b>(size);", "\tp = kmem_alloc(size);", []MatchSpan{{5, 15}}},
+		{"<b>a</b> &lt; <b>b</b>", "a < b", []MatchSpan{{0, 1}, {4, 5}}},
+		{"if (x &amp;&amp; <b>y</b>)", "if (x && y)", []MatchSpan{{9, 10}}},
+		{"<span class=\"c\">// <b>TODO</b></span>", "// TODO", []MatchSpan{{3, 7}}},
+		{"<B>upper</B> case", "upper case", []MatchSpan{{0, 5}}},
+		{"open <b>to the end", "open to the end", []MatchSpan{{5, 15}}},
+		{"empty <b></b>match", "empty match", nil},
+		{"a < b <b>c</b>", "a < b c", []MatchSpan{{6, 7}}},
+		{"héllo <b>wörld</b>", "héllo wörld", []MatchSpan{{7, 13}}},
+	}
+	for _, tt := range tests {
+		text, spans := parseMatches(tt.line)
+		if text != tt.text || !reflect.DeepEqual(spans, tt.spans) {
+			t.Errorf("parseMatches(%q) = %q, %v; want %q, %v", tt.line, text, spans, tt.text, tt.spans)
+		}
+	}
+}
+
+func TestHighlightMatch(t *testing.T) {
+	got := highlightMatch("x &lt;= <b>max</b> &amp;&amp; <b>y</b>")
+	want := "x <= " + colorBold + colorRed + "max" + colorReset + " && " + colorBold + colorRed + "y" + colorReset
+	if got != want {
+		t.Errorf("highlightMatch() = %q, want %q", got, want)
+	}
+}
+
+func TestWriteSearchHitsJSON(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 1,
+		Results: map[string][]SearchResult{
+			"proj": {
+				{Path: "/mm/slab.c", LineNo: "88", Line: "\tp = <b>kmem_alloc</b>(n) &gt; 0;"},
+				{Path: "/mm/slab.c", Line: "kmem_alloc.h"},
+			},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeSearchHitsJSON(&buf, newSearchHits(resp, "http://og"), ResultTotals{ShownLines: 2, FetchedFiles: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Hits    []map[string]any `json:"hits"`
+		Summary map[string]any   `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Hits) != 2 || decoded.Summary["shown_lines"] != 2.0 {
+		t.Fatalf("JSON = %s", buf.String())
+	}
+	hit := decoded.Hits[0]
+	if hit["text"] != "\tp = kmem_alloc(n) > 0;" || hit["line"] != 88.0 || hit["url"] != "http://og/xref/proj/mm/slab.c#88" {
+		t.Errorf("hit = %v", hit)
+	}
+	if m := hit["matches"].([]any); len(m) != 1 || !reflect.DeepEqual(m[0], map[string]any{"start": 5.0, "end": 15.0}) {
+		t.Errorf("matches = %v", hit["matches"])
+	}
+	// Hits without matches have an empty list, not null, and no line
+	if m, ok := decoded.Hits[1]["matches"].([]any); !ok || len(m) != 0 {
+		t.Errorf("matches = %#v", decoded.Hits[1]["matches"])
+	}
+	if _, ok := decoded.Hits[1]["line"]; ok {
+		t.Errorf("hit without a line number has one: %v", decoded.Hits[1])
+	}
+}
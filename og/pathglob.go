@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// checkPathGlob reports a malformed --path-glob pattern
+func checkPathGlob(pattern string) error {
+	if strings.Trim(pattern, "/") == "" {
+		return fmt.Errorf("--path-glob pattern %q is empty", pattern)
+	}
+	for _, elem := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("--path-glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// globElements splits a --path-glob pattern into path elements. Without a
+// leading "/" it may match below any directory, so it starts with "**".
+func globElements(pattern string) []string {
+	elems := strings.Split(strings.Trim(pattern, "/"), "/")
+	if !strings.HasPrefix(pattern, "/") {
+		elems = append([]string{"**"}, elems...)
+	}
+	return elems
+}
+
+// matchPathGlob reports whether filePath, a path within its project,
+// matches pattern. "*", "?" and "[...]" match within one path element, as in
+// path.Match; "**" matches any number of elements, none included. A leading
+// "/" anchors the pattern at the project root; otherwise it may start at any
+// directory.
+func matchPathGlob(pattern, filePath string) bool {
+	return matchGlobElements(globElements(pattern), strings.Split(strings.Trim(filePath, "/"), "/"))
+}
+
+func matchGlobElements(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchGlobElements(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// matchAnyPathGlob reports whether filePath matches one of patterns
+func matchAnyPathGlob(patterns []string, filePath string) bool {
+	for _, pattern := range patterns {
+		if matchPathGlob(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// globServerPath returns the path query that narrows a search to files
+// the patterns can match, for the server to do the coarse part of the
+// filtering: the directories a single pattern starts with, up to its first
+// wildcard ("uts/**/io/*.c" gives "uts"). It is "" when there is no such
+// prefix or several patterns.
+func globServerPath(patterns []string) string {
+	if len(patterns) != 1 {
+		return ""
+	}
+	var literal []string
+	for _, elem := range strings.Split(strings.Trim(patterns[0], "/"), "/") {
+		if strings.ContainsAny(elem, `*?[\`) {
+			break
+		}
+		literal = append(literal, elem)
+	}
+	return strings.Join(literal, "/")
+}
+
+// FilterPathGlobs keeps the hits in files matching one of patterns and
+// returns the number of hits dropped
+func FilterPathGlobs(resp *SearchResponse, patterns []string) int {
+	entries := resp.OrderedEntries()
+	kept := make([]ResultEntry, 0, len(entries))
+	results := make(map[string][]SearchResult)
+	for _, r := range entries {
+		if !matchAnyPathGlob(patterns, r.FilePath()) {
+			continue
+		}
+		kept = append(kept, r)
+		results[r.Project] = append(results[r.Project], r.SearchResult)
+	}
+	dropped := len(entries) - len(kept)
+	if dropped > 0 {
+		resp.Entries = kept
+		resp.Results = results
+		resp.ResultCount = countResultFiles(kept)
+	}
+	return dropped
+}
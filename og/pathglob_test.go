@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"uts/**/io/*.c", "/uts/common/io/ddi.c", true},
+		{"uts/**/io/*.c", "/uts/io/ddi.c", true},
+		{"uts/**/io/*.c", "/usr/src/uts/intel/io/pci.c", true},
+		{"uts/**/io/*.c", "/uts/common/io/ddi.h", false},
+		{"uts/**/io/*.c", "/uts/common/io/sub/ddi.c", false},
+		{"/uts/**/*.c", "/usr/src/uts/a.c", false},
+		{"/usr/**/*.c", "/usr/src/uts/a.c", true},
+		{"*.c", "/a/b/c.c", true},
+		{"io/*.[ch]", "/uts/common/io/ddi.h", true},
+		{"uts/common", "/uts/common/os/x.c", false},
+		{"uts/common/**", "/uts/common/os/x.c", true},
+	}
+	for _, tt := range tests {
+		if got := matchPathGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchPathGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPathGlob(t *testing.T) {
+	if err := checkPathGlob("uts/**/io/*.c"); err != nil {
+		t.Errorf("valid glob: %v", err)
+	}
+	for _, bad := range []string{"uts/[io/*.c", "/", ""} {
+		if err := checkPathGlob(bad); err == nil {
+			t.Errorf("checkPathGlob(%q) accepted", bad)
+		}
+	}
+}
+
+func TestGlobServerPath(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     string
+	}{
+		{[]string{"uts/**/io/*.c"}, "uts"},
+		{[]string{"/usr/src/uts/*.c"}, "usr/src/uts"},
+		{[]string{"*.c"}, ""},
+		{[]string{"uts/*.c", "usr/*.c"}, ""},
+	}
+	for _, tt := range tests {
+		if got := globServerPath(tt.patterns); got != tt.want {
+			t.Errorf("globServerPath(%q) = %q, want %q", tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestFilterPathGlobs(t *testing.T) {
+	resp := &SearchResponse{Results: map[string][]SearchResult{
+		"illumos": {
+			{Path: "/illumos/uts/common/io/ddi.c", LineNo: "1"},
+			{Path: "/illumos/uts/common/io/ddi.c", LineNo: "9"},
+			{Path: "/illumos/uts/common/os/main.c", LineNo: "2"},
+			{Path: "/illumos/lib/io/x.c", LineNo: "3"},
+		},
+	}}
+	if dropped := FilterPathGlobs(resp, []string{"uts/**/io/*.c"}); dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+	if resp.ResultCount != 1 || len(resp.OrderedEntries()) != 2 {
+		t.Errorf("kept %d hits in %d files, want 2 in 1", len(resp.OrderedEntries()), resp.ResultCount)
+	}
+}
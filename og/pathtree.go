@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// pathTreeNode is a directory or file in a tree of matching paths
+type pathTreeNode struct {
+	Name     string
+	FullPath string // project-relative path with leading slash (files only)
+	IsFile   bool
+	Children map[string]*pathTreeNode
+}
+
+func newPathTreeNode(name string) *pathTreeNode {
+	return &pathTreeNode{Name: name, Children: make(map[string]*pathTreeNode)}
+}
+
+// buildPathTree arranges result paths into one tree per project.
+// Duplicate paths (e.g. several matching lines in one file) appear once.
+func buildPathTree(entries []ResultEntry) (projects []string, roots map[string]*pathTreeNode) {
+	roots = make(map[string]*pathTreeNode)
+	for _, e := range entries {
+		path := strings.TrimPrefix(e.FilePath(), "/")
+		if path == "" {
+			continue
+		}
+		root, ok := roots[e.Project]
+		if !ok {
+			root = newPathTreeNode(e.Project)
+			roots[e.Project] = root
+			projects = append(projects, e.Project)
+		}
+
+		node := root
+		parts := strings.Split(path, "/")
+		for i, part := range parts {
+			child, ok := node.Children[part]
+			if !ok {
+				child = newPathTreeNode(part)
+				node.Children[part] = child
+			}
+			if i == len(parts)-1 {
+				child.IsFile = true
+				child.FullPath = "/" + path
+			}
+			node = child
+		}
+	}
+	sort.Strings(projects)
+	return projects, roots
+}
+
+// sortedChildren returns a node's children in name order
+func (n *pathTreeNode) sortedChildren() []*pathTreeNode {
+	children := make([]*pathTreeNode, 0, len(n.Children))
+	for _, child := range n.Children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+// countFiles returns the number of matching files at or below this node
+func (n *pathTreeNode) countFiles() int {
+	count := 0
+	if n.IsFile {
+		count++
+	}
+	for _, child := range n.Children {
+		count += child.countFiles()
+	}
+	return count
+}
+
+// FormatPathTree renders search results as a directory tree per project.
+// Chains of directories with a single subdirectory are collapsed onto one
+// line (e.g. "usr/src/uts/") and each directory shows its match count.
+func FormatPathTree(resp *SearchResponse, useColor bool, webLinks bool, serverURL string) string {
+	var sb strings.Builder
+	projects, roots := buildPathTree(resp.OrderedEntries())
+
+	for i, project := range projects {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		root := roots[project]
+		if useColor {
+			sb.WriteString(colorBold + project + colorReset)
+		} else {
+			sb.WriteString(project)
+		}
+		sb.WriteString(fmt.Sprintf(" (%d)\n", root.countFiles()))
+		formatPathTreeNodes(&sb, root.sortedChildren(), "", project, useColor, webLinks, serverURL)
+	}
+
+	return sb.String()
+}
+
+// formatPathTreeNodes recursively formats tree nodes
+func formatPathTreeNodes(sb *strings.Builder, children []*pathTreeNode, prefix, project string, useColor bool, webLinks bool, serverURL string) {
+	for i, child := range children {
+		isLast := i == len(children)-1
+
+		var connector, childPrefix string
+		if isLast {
+			connector = "└── "
+			childPrefix = prefix + "    "
+		} else {
+			connector = "├── "
+			childPrefix = prefix + "│   "
+		}
+
+		sb.WriteString(prefix)
+		sb.WriteString(connector)
+
+		if child.IsFile && len(child.Children) == 0 {
+			name := child.Name
+			if useColor {
+				name = colorMagenta + name + colorReset
+			}
+			if webLinks && serverURL != "" {
+				webURL := xrefURL(serverURL, project, child.FullPath, "")
+				name = fmt.Sprintf("\033]8;;%s\033\\%s\033]8;;\033\\", webURL, name)
+			}
+			sb.WriteString(name + "\n")
+			continue
+		}
+
+		// Collapse single-directory chains
+		label := child.Name + "/"
+		dir := child
+		for len(dir.Children) == 1 && !dir.IsFile {
+			only := dir.sortedChildren()[0]
+			if only.IsFile && len(only.Children) == 0 {
+				break
+			}
+			dir = only
+			label += dir.Name + "/"
+		}
+
+		if useColor {
+			sb.WriteString(colorBold + colorCyan + label + colorReset)
+		} else {
+			sb.WriteString(label)
+		}
+		sb.WriteString(fmt.Sprintf(" (%d)\n", dir.countFiles()))
+		formatPathTreeNodes(sb, dir.sortedChildren(), childPrefix, project, useColor, webLinks, serverURL)
+	}
+}
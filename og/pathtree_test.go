@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatPathTree(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 5,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/usr/src/uts/io/foo.c"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/usr/src/uts/io/bar.c"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/usr/src/uts/io/bar.c", LineNo: "9"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/usr/src/lib/baz.c"}},
+			{Project: "other", SearchResult: SearchResult{Path: "/README"}},
+		},
+	}
+
+	got := FormatPathTree(resp, false, false, "")
+	want := `other (1)
+└── README
+
+proj (3)
+└── usr/src/ (3)
+    ├── lib/ (1)
+    │   └── baz.c
+    └── uts/io/ (2)
+        ├── bar.c
+        └── foo.c
+`
+	if got != want {
+		t.Errorf("FormatPathTree mismatch\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFormatPathTreeWebLinks(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 1,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/src/a.c"}},
+		},
+	}
+
+	got := FormatPathTree(resp, false, true, "http://example.com/source")
+	if !strings.Contains(got, "\033]8;;http://example.com/source/xref/proj/src/a.c\033\\") {
+		t.Errorf("expected OSC 8 link to file, got %q", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pipeResults runs a --pipe filter over resp: the hits go to the command's
+// stdin as 'og search --json' prints them, and the hits it writes back in
+// the same shape replace them, to be displayed as if the server had
+// returned them. The command runs in the shell, so it may have arguments
+// and pipes; its stderr is passed through. totals are updated for the hits
+// the filter dropped or added.
+func pipeResults(ctx context.Context, command string, resp *SearchResponse, serverURL string, totals ResultTotals) (*SearchResponse, ResultTotals, error) {
+	var in bytes.Buffer
+	if err := writeSearchHitsJSON(&in, newSearchHits(resp, serverURL), totals); err != nil {
+		return nil, totals, err
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var out bytes.Buffer
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &in, &out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, totals, ctxErr
+		}
+		return nil, totals, fmt.Errorf("--pipe %s: %w", command, err)
+	}
+
+	var piped struct {
+		Hits *[]SearchHit `json:"hits"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &piped); err != nil {
+		return nil, totals, fmt.Errorf("--pipe %s: output is not the JSON og sent: %w", command, err)
+	}
+	if piped.Hits == nil {
+		return nil, totals, fmt.Errorf("--pipe %s: output has no \"hits\" array", command)
+	}
+	filtered, err := responseFromHits(*piped.Hits, resp)
+	if err != nil {
+		return nil, totals, fmt.Errorf("--pipe %s: %w", command, err)
+	}
+	change := len(*piped.Hits) - totals.ShownLines
+	totals.ShownLines += change
+	totals.FetchedLines += change
+	return filtered, totals, nil
+}
+
+// responseFromHits rebuilds a search response from hits, keeping the
+// counts and timing of orig. Each hit's matches are marked up again as the
+// server would, so the hits display like the ones og sent, and the labels
+// the filter added are kept.
+func responseFromHits(hits []SearchHit, orig *SearchResponse) (*SearchResponse, error) {
+	resp := &SearchResponse{
+		Time:          orig.Time,
+		ResultCount:   orig.ResultCount,
+		StartDocument: orig.StartDocument,
+		EndDocument:   orig.EndDocument,
+		Results:       make(map[string][]SearchResult),
+		Entries:       []ResultEntry{},
+	}
+	if len(hits) == 0 {
+		resp.ResultCount = 0
+	}
+	for i, hit := range hits {
+		if hit.Path == "" {
+			return nil, fmt.Errorf("hit %d has no path", i+1)
+		}
+		line, err := markMatches(hit.Text, hit.Matches)
+		if err != nil {
+			return nil, fmt.Errorf("hit %d (%s): %w", i+1, hit.Path, err)
+		}
+		result := SearchResult{Path: hit.Path, Line: line, Labels: hit.Labels}
+		if hit.Line > 0 {
+			result.LineNo = FlexibleString(strconv.Itoa(hit.Line))
+		}
+		resp.Results[hit.Project] = append(resp.Results[hit.Project], result)
+		resp.Entries = append(resp.Entries, ResultEntry{Project: hit.Project, SearchResult: result})
+	}
+	return resp, nil
+}
+
+// printHitLabels prints the labels a --pipe filter added to a hit, if any,
+// on an indented line below it: "owner: @net-team  area: fs"
+func printHitLabels(w io.Writer, labels map[string]string, useColor bool) {
+	if len(labels) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		key := k + ":"
+		if useColor {
+			key = colorCyan + key + colorReset
+		}
+		parts[i] = key + " " + labels[k]
+	}
+	fmt.Fprintf(w, "    %s\n", strings.Join(parts, "  "))
+}
+
+// markMatches is the inverse of parseMatches: text escaped as HTML with
+// each span wrapped in <b>...</b>. Spans must be in order, within the text
+// and not overlap.
+func markMatches(text string, spans []MatchSpan) (string, error) {
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.Start < last || s.End <= s.Start || s.End > len(text) {
+			return "", fmt.Errorf("match %d-%d is out of order or outside the text", s.Start, s.End)
+		}
+		sb.WriteString(html.EscapeString(text[last:s.Start]))
+		sb.WriteString("<b>" + html.EscapeString(text[s.Start:s.End]) + "</b>")
+		last = s.End
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return sb.String(), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPipeResults(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("filters run with sh")
+	}
+	resp := &SearchResponse{ResultCount: 2, Entries: []ResultEntry{
+		{Project: "proj", SearchResult: SearchResult{Path: "/src/a.c", LineNo: "3", Line: "if (a &lt; b) <b>foo</b>();"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/vendor/b.c", LineNo: "9", Line: "<b>foo</b>(x);"}},
+	}}
+	totals := limitResultLines(resp, 0)
+
+	// cat hands the hits back unchanged
+	piped, got, err := pipeResults(context.Background(), "cat", resp, "http://og", totals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := piped.OrderedEntries()
+	if len(entries) != 2 || entries[0].Line != resp.Entries[0].Line || entries[1].FilePath() != "/vendor/b.c" || got != totals {
+		t.Errorf("round trip changed the hits: %+v, totals %+v", entries, got)
+	}
+
+	// A filter that drops the vendored hit and labels the other
+	filter := `cat >/dev/null; echo '{"hits":[{"project":"proj","path":"/src/a.c","line":3,"text":"foo(); // checked","matches":[{"start":0,"end":3}],"labels":{"owner":"@core","area":"fs"}}]}'`
+	piped, got, err = pipeResults(context.Background(), filter, resp, "http://og", totals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = piped.OrderedEntries()
+	if len(entries) != 1 || entries[0].Line != "<b>foo</b>(); // checked" || entries[0].LineNo != "3" {
+		t.Errorf("filtered hits = %+v", entries)
+	}
+	var buf bytes.Buffer
+	printHitLabels(&buf, entries[0].Labels, false)
+	if buf.String() != "    area: fs  owner: @core\n" {
+		t.Errorf("labels printed as %q", buf.String())
+	}
+	if got.ShownLines != 1 || got.FetchedLines != 1 || got.HiddenLines() != 0 {
+		t.Errorf("totals = %+v, want one line shown", got)
+	}
+
+	for filter, want := range map[string]string{
+		"exit 3":        "exit status 3",
+		"echo not json": "not the JSON og sent",
+		`echo '{}'`:     `no "hits" array`,
+		`echo '{"hits":[{"path":"/a.c","text":"x","matches":[{"start":0,"end":5}]}]}'`: "outside the text",
+	} {
+		if _, _, err := pipeResults(context.Background(), "cat >/dev/null; "+filter, resp, "", totals); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", filter, err, want)
+		}
+	}
+}
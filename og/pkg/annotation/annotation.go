@@ -0,0 +1,343 @@
+// Package annotation reads and writes og_annotate's annotation files (the
+// v2 format): Markdown with a frontmatter naming the source and its hash,
+// the source lines as captured, and each note as a blockquote under its
+// line. og_annotate stores notes in them; og reads them to show notes in
+// traces and listings.
+package annotation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxLineLength is the longest line Parse reads
+const MaxLineLength = 1024 * 1024
+
+// Patterns of the lines Parse recognizes
+var (
+	sourceLineRe       = regexp.MustCompile(`^\s*(\d+)\|(.*)$`)
+	lineMarkerRe       = regexp.MustCompile(`^## Line (\d+)$`)
+	annotationHeaderRe = regexp.MustCompile("^> \\*\\*@([^*]+)\\*\\* \\(([^)]+)\\)(?: \\[([^\\]]*)\\])?(?: on `([^`]+)`)?(?: \\^([0-9a-f]+))?:$")
+)
+
+// Annotation represents a single annotation on a line. A line can carry
+// several, told apart by ID.
+type Annotation struct {
+	// ID identifies the annotation among those on its file (8 hex digits);
+	// annotations saved before IDs existed have none
+	ID        string   `json:"id,omitempty"`
+	Line      int      `json:"line"`
+	Author    string   `json:"author"`
+	Timestamp string   `json:"timestamp"`
+	Text      string   `json:"text"`
+	Tags      []string `json:"tags,omitempty"` // e.g. "bug", "question", "perf"
+	// Symbol anchors the annotation to a definition (a function, struct or
+	// other name) rather than to Line, which then follows the symbol when the
+	// file changes
+	Symbol   string   `json:"symbol,omitempty"`
+	Context  []string `json:"context,omitempty"`
+	FilePath string   `json:"filePath,omitempty"` // Used when listing all annotated files
+}
+
+// Header is the frontmatter of an annotation file
+type Header struct {
+	Source   string // project/path
+	Hash     string // SHA-256 prefix (12 chars)
+	Captured string // ISO 8601 timestamp
+}
+
+// Filename converts project/path to the name of its annotation file.
+// Uses __ as path separator, ___ to escape actual __ in names.
+func Filename(project, filePath string) string {
+	// First escape any existing __ as ___
+	project = strings.ReplaceAll(project, "__", "___")
+	filePath = strings.ReplaceAll(filePath, "__", "___")
+
+	// Replace path separators with __
+	filePath = strings.ReplaceAll(filePath, "/", "__")
+
+	return project + "__" + filePath + ".md"
+}
+
+// ParseFilename converts an annotation file name back to project/path
+func ParseFilename(filename string) (project, filePath string, ok bool) {
+	// Remove .md suffix
+	if !strings.HasSuffix(filename, ".md") {
+		return "", "", false
+	}
+	filename = strings.TrimSuffix(filename, ".md")
+
+	// Split into parts by __ (but not ___)
+	// We need to handle ___ (escaped __) vs __ (separator)
+	// Strategy: replace ___ with a placeholder, split by __, then restore
+
+	placeholder := "\x00"
+	temp := strings.ReplaceAll(filename, "___", placeholder)
+	parts := strings.Split(temp, "__")
+
+	if len(parts) < 2 {
+		return "", "", false
+	}
+
+	// First part is project
+	project = strings.ReplaceAll(parts[0], placeholder, "__")
+
+	// Rest is the file path
+	pathParts := parts[1:]
+	for i := range pathParts {
+		pathParts[i] = strings.ReplaceAll(pathParts[i], placeholder, "__")
+	}
+	filePath = strings.Join(pathParts, "/")
+
+	return project, filePath, true
+}
+
+// HasTag reports whether the annotation carries tag (case-insensitive)
+func (a Annotation) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimPrefix(tag, "#"))
+	for _, t := range a.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTags splits the tag list of an annotation header ("bug, perf")
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// FormatHeader formats the header line of an annotation:
+// "> **@author** (date):", with " [tag, tag]" before the colon when tagged
+// and " on `symbol`" after the tags when anchored to a symbol, then " ^id"
+// when it has an ID
+func FormatHeader(ann Annotation) string {
+	// Format date from timestamp (extract date part)
+	dateStr := ann.Timestamp
+	if len(dateStr) >= 10 {
+		dateStr = dateStr[:10] // YYYY-MM-DD
+	}
+	header := fmt.Sprintf("> **@%s** (%s)", ann.Author, dateStr)
+	if len(ann.Tags) > 0 {
+		header += " [" + strings.Join(ann.Tags, ", ") + "]"
+	}
+	if ann.Symbol != "" {
+		header += " on `" + ann.Symbol + "`"
+	}
+	if ann.ID != "" {
+		header += " ^" + ann.ID
+	}
+	return header + ":"
+}
+
+// formatLineNumber formats a line number with right-aligned padding
+func formatLineNumber(lineNum, maxLineNum int) string {
+	width := len(strconv.Itoa(maxLineNum))
+	return fmt.Sprintf("%*d|", width, lineNum)
+}
+
+// ParseFile parses an annotation file
+func ParseFile(path string) (header Header, annotations []Annotation, sourceLines []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return header, nil, nil, err
+	}
+	defer file.Close()
+	return Parse(file)
+}
+
+// Parse parses annotation file content: the frontmatter, the captured
+// source lines, if any, and the annotations in file order. A note's text is
+// its blockquote, with a bare ">" line (as editors leave "> " trimmed) read
+// as a blank line within it.
+func Parse(r io.Reader) (header Header, annotations []Annotation, sourceLines []string, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineLength)
+
+	// Parse frontmatter
+	inFrontmatter := false
+	frontmatterDone := false
+
+	var currentAnnotation *Annotation
+	var annotationLines []string
+	lastSourceLine := 0
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Handle frontmatter
+		if line == "---" {
+			if !inFrontmatter && !frontmatterDone {
+				inFrontmatter = true
+				continue
+			} else if inFrontmatter {
+				inFrontmatter = false
+				frontmatterDone = true
+				continue
+			}
+		}
+
+		if inFrontmatter {
+			if strings.HasPrefix(line, "source:") {
+				header.Source = strings.TrimSpace(strings.TrimPrefix(line, "source:"))
+			} else if strings.HasPrefix(line, "hash:") {
+				header.Hash = strings.TrimSpace(strings.TrimPrefix(line, "hash:"))
+			} else if strings.HasPrefix(line, "captured:") {
+				header.Captured = strings.TrimSpace(strings.TrimPrefix(line, "captured:"))
+			}
+			continue
+		}
+
+		// Check if this is a source line
+		if matches := sourceLineRe.FindStringSubmatch(line); matches != nil {
+			// Save any pending annotation
+			if currentAnnotation != nil {
+				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
+				annotations = append(annotations, *currentAnnotation)
+				currentAnnotation = nil
+				annotationLines = nil
+			}
+
+			lineNum, _ := strconv.Atoi(matches[1])
+			lastSourceLine = lineNum
+			// Remove leading space after the | separator
+			content := matches[2]
+			if len(content) > 0 && content[0] == ' ' {
+				content = content[1:]
+			}
+			sourceLines = append(sourceLines, content)
+			continue
+		}
+
+		// Check if this is a line marker (used when no source content)
+		if matches := lineMarkerRe.FindStringSubmatch(line); matches != nil {
+			// Save any pending annotation
+			if currentAnnotation != nil {
+				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
+				annotations = append(annotations, *currentAnnotation)
+				currentAnnotation = nil
+				annotationLines = nil
+			}
+
+			lineNum, _ := strconv.Atoi(matches[1])
+			lastSourceLine = lineNum
+			continue
+		}
+
+		// Check if this is an annotation header
+		if matches := annotationHeaderRe.FindStringSubmatch(line); matches != nil {
+			// Save any pending annotation first
+			if currentAnnotation != nil {
+				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
+				annotations = append(annotations, *currentAnnotation)
+				annotationLines = nil
+			}
+
+			currentAnnotation = &Annotation{
+				Line:      lastSourceLine,
+				Author:    matches[1],
+				Timestamp: matches[2],
+				Tags:      parseTags(matches[3]),
+				Symbol:    matches[4],
+				ID:        matches[5],
+			}
+			continue
+		}
+
+		// Check if this is annotation content (blockquote)
+		if (strings.HasPrefix(line, "> ") || line == ">") && currentAnnotation != nil {
+			annotationLines = append(annotationLines, strings.TrimPrefix(strings.TrimPrefix(line, ">"), " "))
+			continue
+		}
+
+		// Empty line might end an annotation
+		if line == "" && currentAnnotation != nil && len(annotationLines) > 0 {
+			currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
+			annotations = append(annotations, *currentAnnotation)
+			currentAnnotation = nil
+			annotationLines = nil
+		}
+	}
+
+	// Save final annotation if any
+	if currentAnnotation != nil {
+		currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
+		annotations = append(annotations, *currentAnnotation)
+	}
+
+	return header, annotations, sourceLines, scanner.Err()
+}
+
+// Format renders the canonical form of an annotation file
+func Format(file io.Writer, header Header, sourceLines []string, annotations []Annotation) {
+	// Write frontmatter
+	fmt.Fprintln(file, "---")
+	fmt.Fprintf(file, "source: %s\n", header.Source)
+	fmt.Fprintf(file, "hash: %s\n", header.Hash)
+	fmt.Fprintf(file, "captured: %s\n", header.Captured)
+	fmt.Fprintln(file, "---")
+	fmt.Fprintln(file)
+
+	// Build annotation map by line
+	annotationMap := make(map[int][]Annotation)
+	for _, ann := range annotations {
+		annotationMap[ann.Line] = append(annotationMap[ann.Line], ann)
+	}
+
+	maxLineNum := len(sourceLines)
+
+	// If we have source lines, write them with inline annotations
+	if len(sourceLines) > 0 {
+		for i, sourceLine := range sourceLines {
+			lineNum := i + 1
+			fmt.Fprintf(file, "%s %s\n", formatLineNumber(lineNum, maxLineNum), sourceLine)
+
+			// Write any annotations for this line
+			if anns, ok := annotationMap[lineNum]; ok {
+				for _, ann := range anns {
+					fmt.Fprintln(file)
+					fmt.Fprintln(file, FormatHeader(ann))
+					for _, textLine := range strings.Split(ann.Text, "\n") {
+						fmt.Fprintf(file, "> %s\n", textLine)
+					}
+					fmt.Fprintln(file)
+				}
+			}
+		}
+	} else {
+		// No source lines - write annotations with explicit line markers
+		// Sort annotations by line for consistent output
+		sortedLines := make([]int, 0, len(annotationMap))
+		for line := range annotationMap {
+			sortedLines = append(sortedLines, line)
+		}
+		sort.Ints(sortedLines)
+
+		for _, lineNum := range sortedLines {
+			// Write line marker
+			fmt.Fprintf(file, "## Line %d\n", lineNum)
+
+			for _, ann := range annotationMap[lineNum] {
+				fmt.Fprintln(file)
+				fmt.Fprintln(file, FormatHeader(ann))
+				for _, textLine := range strings.Split(ann.Text, "\n") {
+					fmt.Fprintf(file, "> %s\n", textLine)
+				}
+				fmt.Fprintln(file)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package annotation
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBlankQuoteLines(t *testing.T) {
+	// Editors trim "> " on blank lines of a note to ">"
+	content := "---\nsource: proj/a.c\nhash: a1b2c3d4e5f6\ncaptured: 2024-01-15T10:30:00Z\n---\n\n" +
+		"1| int x;\n\n> **@alice** (2024-01-15) ^0badcafe:\n> First paragraph.\n>\n> Second paragraph.\n\n2| int y;\n"
+
+	header, anns, lines, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Source != "proj/a.c" || !reflect.DeepEqual(lines, []string{"int x;", "int y;"}) {
+		t.Errorf("header %+v, lines %q", header, lines)
+	}
+	if len(anns) != 1 || anns[0].ID != "0badcafe" || anns[0].Text != "First paragraph.\n\nSecond paragraph." {
+		t.Fatalf("annotations = %+v", anns)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	header := Header{Source: "proj/a.c", Hash: "a1b2c3d4e5f6", Captured: "2024-01-15T10:30:00Z"}
+	lines := []string{"int", "vn_rele(void)", "{"}
+	anns := []Annotation{
+		{ID: "1a2b3c4d", Line: 2, Author: "carol", Timestamp: "2024-01-15", Text: "Follows the definition.\n\nKeep it.", Tags: []string{"bug"}, Symbol: "vn_rele"},
+		{ID: "5e6f7a8b", Line: 2, Author: "dave", Timestamp: "2024-01-16", Text: "Second note."},
+	}
+
+	var buf bytes.Buffer
+	Format(&buf, header, lines, anns)
+	gotHeader, gotAnns, gotLines, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHeader != header || !reflect.DeepEqual(gotLines, lines) || !reflect.DeepEqual(gotAnns, anns) {
+		t.Errorf("round trip = %+v, %q, %+v", gotHeader, gotLines, gotAnns)
+	}
+}
+
+func TestFilename(t *testing.T) {
+	name := Filename("my__project", "src/my__file.go")
+	if name != "my___project__src__my___file.go.md" {
+		t.Errorf("Filename() = %q", name)
+	}
+	if project, filePath, ok := ParseFilename(name); !ok || project != "my__project" || filePath != "src/my__file.go" {
+		t.Errorf("ParseFilename(%q) = %q, %q, %v", name, project, filePath, ok)
+	}
+}
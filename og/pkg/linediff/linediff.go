@@ -0,0 +1,103 @@
+// Package linediff maps lines between two versions of a file with a line
+// diff, so notes and positions recorded against one version can follow
+// their lines into another. og uses it to follow a line through history and
+// og_annotate to move annotations onto changed source.
+package linediff
+
+// Map diffs two line slices and returns, for each line of a, its index in b,
+// or -1 if the line was changed or removed
+func Map(a, b []string) []int {
+	lineMap := make([]int, len(a))
+	for i := range lineMap {
+		lineMap[i] = -1
+	}
+
+	// Common prefix and suffix are matched directly, which keeps the diff
+	// itself small for typical edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		lineMap[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		lineMap[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+
+	for _, m := range myersMatches(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		lineMap[prefix+m[0]] = prefix + m[1]
+	}
+	return lineMap
+}
+
+// myersMatches returns the index pairs of lines kept by a shortest edit
+// script from a to b (Myers' O(ND) algorithm)
+func myersMatches(a, b []string) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return nil
+	}
+
+	maxD := n + m
+	offset := maxD
+	v := make([]int, 2*maxD+2)
+	// trace[d] holds v for diagonals -d..d as it was before round d
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackMatches(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrackMatches walks the Myers trace back from (n, m) collecting matches
+func backtrackMatches(trace [][]int, n, m int) [][2]int {
+	var matches [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		vd := trace[d]
+		get := func(k int) int { return vd[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	// Round 0 is a single diagonal run from the origin
+	for x > 0 && y > 0 {
+		x--
+		y--
+		matches = append(matches, [2]int{x, y})
+	}
+	return matches
+}
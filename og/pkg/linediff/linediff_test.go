@@ -0,0 +1,28 @@
+package linediff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     []string
+		expected []int
+	}{
+		{"identical", []string{"a", "b", "c"}, []string{"a", "b", "c"}, []int{0, 1, 2}},
+		{"insert at top", []string{"a", "b"}, []string{"x", "y", "a", "b"}, []int{2, 3}},
+		{"delete middle", []string{"a", "b", "c", "d"}, []string{"a", "d"}, []int{0, -1, -1, 1}},
+		{"change line", []string{"a", "b", "c"}, []string{"a", "B", "c"}, []int{0, -1, 2}},
+		{"move block", []string{"a", "b", "c", "d", "e"}, []string{"c", "d", "e", "a", "b"}, []int{-1, -1, 0, 1, 2}},
+		{"interleaved", []string{"a", "b", "c", "d"}, []string{"x", "a", "c", "y", "d", "z"}, []int{1, -1, 2, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Map(tt.a, tt.b); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Map() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,709 @@
+// Package opengrok is a client for the OpenGrok REST API (v1) and the raw
+// file endpoint. og is built on it; other Go tools can use it to search an
+// OpenGrok server without shelling out to og.
+//
+// Every request method has a ...Context variant taking a context.Context for
+// cancellation and deadlines; the plain methods use context.Background().
+package opengrok
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxResponseSize limits response body to 10MB to prevent memory exhaustion
+	MaxResponseSize = 10 * 1024 * 1024
+)
+
+// AuthProvider supplies credentials for outgoing API requests.
+// Static credentials (basic auth, API key, bearer token) are handled directly by
+// Client; providers cover schemes that need to fetch or refresh tokens.
+type AuthProvider interface {
+	// Authorize adds credentials to the request, refreshing them first if needed
+	Authorize(req *http.Request) error
+	// Describe returns a short human-readable description for status output
+	Describe() string
+}
+
+// Client represents an OpenGrok API client
+type Client struct {
+	BaseURL     string
+	HTTPClient  *http.Client
+	Username    string
+	Password    string
+	APIKey      string
+	BearerToken string
+	// Auth is an optional provider for token-based schemes (e.g. OIDC).
+	// It is used when no static credentials are set.
+	Auth AuthProvider
+	// Profile adapts requests and parsing to the server's release; nil
+	// means DefaultProfile. DetectProfile sets it.
+	Profile *ServerProfile
+	// APIBase and XrefBase replace BaseURL for the REST API (/api/v1/...)
+	// and the web application (/xref, /raw) respectively, for reverse
+	// proxies that serve them under different URLs. Empty means BaseURL.
+	APIBase  string
+	XrefBase string
+	// FileCache, if set, keeps raw file downloads so fetching an unchanged
+	// file again only costs a revalidation (see FileCache)
+	FileCache FileCache
+	// Encoding is the encoding raw files are in (see TextEncodings); empty
+	// detects it per file and refuses binary files (see decodeRaw)
+	Encoding string
+}
+
+// NewClient creates a new OpenGrok API client
+func NewClient(baseURL string) (*Client, error) {
+	// Validate URL
+	parsedURL, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+
+	// Check for valid scheme
+	scheme := strings.ToLower(parsedURL.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("invalid URL scheme %q: must be http or https", parsedURL.Scheme)
+	}
+
+	// Check for host
+	if parsedURL.Host == "" {
+		return nil, fmt.Errorf("invalid server URL: missing host")
+	}
+
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}, nil
+}
+
+// JoinURL appends p to base, a server URL that may carry a path prefix
+// ("https://host/source", with or without trailing slashes). Characters
+// in p that would end or alter a URL path, such as spaces, "#", "?" and
+// "%", are escaped; "/" separators are kept.
+func JoinURL(base, p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return strings.TrimRight(base, "/") + (&url.URL{Path: p}).EscapedPath()
+}
+
+// APIURL returns the URL of a REST API endpoint ("/api/v1/search")
+func (c *Client) APIURL(endpoint string) string {
+	if c.APIBase != "" {
+		return JoinURL(c.APIBase, endpoint)
+	}
+	return JoinURL(c.BaseURL, endpoint)
+}
+
+// XrefBaseURL returns the URL the web application's pages (/xref, /raw)
+// and web links are under
+func (c *Client) XrefBaseURL() string {
+	if c.XrefBase != "" {
+		return strings.TrimRight(c.XrefBase, "/")
+	}
+	return c.BaseURL
+}
+
+// setAuthHeaders adds authentication headers to the request based on configured credentials
+func (c *Client) setAuthHeaders(req *http.Request) error {
+	// Priority: Bearer token > API Key > Basic Auth > Auth provider
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	} else if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	} else if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	} else if c.Auth != nil {
+		return c.Auth.Authorize(req)
+	}
+	return nil
+}
+
+// Authorize adds the client's credentials to a request it didn't build,
+// such as one a daemon sends on for another program
+func (c *Client) Authorize(req *http.Request) error {
+	return c.setAuthHeaders(req)
+}
+
+// AuthMethod describes the authentication sent with requests, without
+// revealing secrets. It follows the priority order of setAuthHeaders.
+func (c *Client) AuthMethod() string {
+	switch {
+	case c.BearerToken != "":
+		return "Bearer token"
+	case c.APIKey != "":
+		return "API key (sent as Bearer token)"
+	case c.Username != "":
+		return fmt.Sprintf("Basic auth (user: %s)", c.Username)
+	case c.Auth != nil:
+		return c.Auth.Describe()
+	}
+	return "None"
+}
+
+// HasAuth returns true if the client has any authentication configured
+func (c *Client) HasAuth() bool {
+	return c.BearerToken != "" || c.APIKey != "" || c.Username != "" || c.Auth != nil
+}
+
+// formatHTTPError returns a user-friendly error message for HTTP error responses
+func (c *Client) formatHTTPError(statusCode int, body []byte) error {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		if c.HasAuth() {
+			return fmt.Errorf("authentication failed (401 Unauthorized): the provided credentials were rejected by the server")
+		}
+		return fmt.Errorf("authentication required (401 Unauthorized): this server requires authentication. " +
+			"Configure credentials with 'og init <url> --username <user> --password <pass>' or use --bearer-token/--api-key flags")
+	case http.StatusForbidden:
+		return fmt.Errorf("access denied (403 Forbidden): you don't have permission to access this resource")
+	case http.StatusNotFound:
+		return fmt.Errorf("not found (404): the API endpoint was not found. Verify the server URL is correct")
+	default:
+		// For other errors, include a truncated body if it looks like HTML (common for error pages)
+		bodyStr := string(body)
+		if len(bodyStr) > 200 {
+			bodyStr = bodyStr[:200] + "..."
+		}
+		return fmt.Errorf("API returned status %d: %s", statusCode, bodyStr)
+	}
+}
+
+// FlexibleString is a type that can unmarshal from either a JSON string or number
+type FlexibleString string
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (f *FlexibleString) UnmarshalJSON(data []byte) error {
+	// Handle null explicitly
+	if string(data) == "null" {
+		*f = ""
+		return nil
+	}
+
+	// Try to unmarshal as a string first (handles quoted strings like "123")
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = FlexibleString(s)
+		return nil
+	}
+
+	// Try to unmarshal as a float64 (handles bare numbers like 123)
+	// json.Unmarshal uses float64 for all JSON numbers by default
+	var num float64
+	if err := json.Unmarshal(data, &num); err == nil {
+		// Format as integer if it's a whole number (which line numbers should be)
+		if num == float64(int64(num)) {
+			*f = FlexibleString(fmt.Sprintf("%d", int64(num)))
+		} else {
+			*f = FlexibleString(fmt.Sprintf("%g", num))
+		}
+		return nil
+	}
+
+	// If both fail, set to empty string
+	*f = ""
+	return nil
+}
+
+// String returns the string value
+func (f FlexibleString) String() string {
+	return string(f)
+}
+
+// SearchResult represents a single search result from OpenGrok
+type SearchResult struct {
+	Line      string         `json:"line"`
+	LineNo    FlexibleString `json:"lineNo"`
+	Path      string         `json:"path"`
+	Filename  string         `json:"filename"`
+	Directory string         `json:"directory"`
+	// Labels are added by programs that post-process results (og's --pipe
+	// filters), e.g. {"owner": "@net-team"}; the server sends none
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// UnmarshalJSON decodes a result with DefaultProfile, which accepts every
+// line number field name OpenGrok releases use (see ServerProfile.LineFields)
+func (s *SearchResult) UnmarshalJSON(data []byte) error {
+	return DefaultProfile.decodeResult(data, s)
+}
+
+// SearchResponse represents the response from the OpenGrok search API
+type SearchResponse struct {
+	Time          int64                     `json:"time"`
+	ResultCount   int                       `json:"resultCount"`
+	StartDocument int                       `json:"startDocument"`
+	EndDocument   int                       `json:"endDocument"`
+	Results       map[string][]SearchResult `json:"results"`
+	// Entries holds the same results flattened in the order the server returned them
+	Entries []ResultEntry `json:"-"`
+}
+
+// ResultEntry pairs a search result with the project it belongs to
+type ResultEntry struct {
+	Project string
+	SearchResult
+}
+
+// OrderedEntries returns the results in server order. Responses built without
+// Entries (e.g. in tests) fall back to project name order.
+func (resp *SearchResponse) OrderedEntries() []ResultEntry {
+	if resp.Entries != nil {
+		return resp.Entries
+	}
+	projects := make([]string, 0, len(resp.Results))
+	for project := range resp.Results {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+
+	var entries []ResultEntry
+	for _, project := range projects {
+		for _, r := range resp.Results[project] {
+			entries = append(entries, ResultEntry{Project: project, SearchResult: r})
+		}
+	}
+	return entries
+}
+
+// resultKeyOrder returns the keys of the "results" object in document order,
+// which Go maps do not preserve
+func resultKeyOrder(body []byte) []string {
+	var envelope struct {
+		Results json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || len(envelope.Results) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(envelope.Results))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return keys
+		}
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return keys
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// orderedResultEntries flattens raw results following keys, normalizing paths
+// the same way as normalizeResultsByProject
+func orderedResultEntries(keys []string, results map[string][]SearchResult) []ResultEntry {
+	entries := []ResultEntry{}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		project, keyPath := parseResultKey(key)
+		if project == "" {
+			project = key
+		}
+		for _, entry := range results[key] {
+			entry.Path = normalizeResultPath(project, keyPath, entry)
+			entries = append(entries, ResultEntry{Project: project, SearchResult: entry})
+		}
+	}
+	return entries
+}
+
+func normalizeResultsByProject(results map[string][]SearchResult) map[string][]SearchResult {
+	normalized := make(map[string][]SearchResult)
+
+	for key, entries := range results {
+		project, keyPath := parseResultKey(key)
+
+		// If key doesn't include a path, treat it as a project name.
+		if project == "" {
+			project = key
+		}
+
+		for _, entry := range entries {
+			entry.Path = normalizeResultPath(project, keyPath, entry)
+			normalized[project] = append(normalized[project], entry)
+		}
+	}
+
+	return normalized
+}
+
+func parseResultKey(key string) (project string, keyPath string) {
+	trimmed := strings.TrimPrefix(key, "/")
+	if strings.Contains(trimmed, "/") {
+		parts := strings.SplitN(trimmed, "/", 2)
+		return parts[0], parts[1]
+	}
+	return "", ""
+}
+
+// normalizeResultPath returns the canonical path of a raw result, falling
+// back to the path in its results key when the entry has none
+func normalizeResultPath(project, keyPath string, entry SearchResult) string {
+	if entry.Path == "" && keyPath != "" {
+		entry.Path = "/" + keyPath
+	}
+	return ResultPath(project, entry)
+}
+
+// SearchOptions contains optional parameters for the search
+type SearchOptions struct {
+	// Full search (searches all text)
+	Full string
+	// Definition search (searches symbol definitions)
+	Def string
+	// Symbol search (searches symbol references)
+	Symbol string
+	// Path search (searches file paths)
+	Path string
+	// History search (searches version control history)
+	Hist string
+	// Type search (searches file types)
+	Type string
+	// Projects to search in (comma-separated)
+	Projects string
+	// Maximum number of results
+	MaxResults int
+	// Start index for pagination
+	Start int
+	// Sort order requested from the server ("relevancy", "lastmodtime", "fullpath")
+	Sort string
+}
+
+// Search performs a search against the OpenGrok API
+func (c *Client) Search(opts SearchOptions) (*SearchResponse, error) {
+	return c.SearchContext(context.Background(), opts)
+}
+
+// SearchContext is Search with a context. When the server refuses to search
+// every project (ErrProjectRequired) and opts names none, the first page is
+// searched one project at a time instead; see searchEachProject.
+func (c *Client) SearchContext(ctx context.Context, opts SearchOptions) (*SearchResponse, error) {
+	resp, err := c.searchOnce(ctx, opts)
+	var refused *SearchRefusedError
+	if errors.As(err, &refused) && refused.Reason == ErrProjectRequired && opts.Projects == "" && opts.Start == 0 {
+		return c.searchEachProject(ctx, opts, refused)
+	}
+	return resp, err
+}
+
+// searchOnce runs a search in a single request
+func (c *Client) searchOnce(ctx context.Context, opts SearchOptions) (*SearchResponse, error) {
+	resp, err := c.doSearch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Parse the response with size limit
+	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
+	body, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	searchResp, err := c.profile().decodeSearchResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if searchResp.Results != nil {
+		searchResp.Entries = orderedResultEntries(resultKeyOrder(body), searchResp.Results)
+		searchResp.Results = normalizeResultsByProject(searchResp.Results)
+	}
+
+	return searchResp, nil
+}
+
+// searchParams converts search options to API query parameters
+func searchParams(opts SearchOptions) url.Values {
+	params := url.Values{}
+
+	if opts.Full != "" {
+		params.Set("full", opts.Full)
+	}
+	if opts.Def != "" {
+		params.Set("def", opts.Def)
+	}
+	if opts.Symbol != "" {
+		params.Set("symbol", opts.Symbol)
+	}
+	if opts.Path != "" {
+		params.Set("path", opts.Path)
+	}
+	if opts.Hist != "" {
+		params.Set("hist", opts.Hist)
+	}
+	if opts.Type != "" {
+		params.Set("type", opts.Type)
+	}
+	if opts.Projects != "" {
+		params.Set("projects", opts.Projects)
+	}
+	if opts.MaxResults > 0 {
+		params.Set("maxresults", fmt.Sprintf("%d", opts.MaxResults))
+	}
+	if opts.Start > 0 {
+		params.Set("start", fmt.Sprintf("%d", opts.Start))
+	}
+	if opts.Sort != "" {
+		params.Set("sort", opts.Sort)
+	}
+	return params
+}
+
+// SearchURL returns the API URL a search with opts requests
+func (c *Client) SearchURL(opts SearchOptions) string {
+	return c.APIURL("/api/v1/search") + "?" + searchParams(opts).Encode()
+}
+
+// doSearch executes a search request and returns the response once its
+// status has been checked. The caller must close the body.
+func (c *Client) doSearch(ctx context.Context, opts SearchOptions) (*http.Response, error) {
+	// Create the request
+	req, err := http.NewRequestWithContext(ctx, "GET", c.SearchURL(opts), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+
+	// Execute the request
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+
+	// Check for non-200 status codes
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+		if refused := searchRefusal(resp.StatusCode, body); refused != nil {
+			return nil, refused
+		}
+		return nil, c.formatHTTPError(resp.StatusCode, body)
+	}
+
+	return resp, nil
+}
+
+// GetProjects retrieves the list of available projects from OpenGrok
+func (c *Client) GetProjects() ([]string, error) {
+	return c.GetProjectsContext(context.Background())
+}
+
+// GetProjectsContext is GetProjects with a context
+func (c *Client) GetProjectsContext(ctx context.Context) ([]string, error) {
+	projectsURL := c.APIURL("/api/v1/projects")
+
+	req, err := http.NewRequestWithContext(ctx, "GET", projectsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, c.formatHTTPError(resp.StatusCode, body)
+	}
+
+	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
+	body, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var projects []string
+	if err := json.Unmarshal(body, &projects); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return projects, nil
+}
+
+// GetFile fetches the full content of a file using the raw API
+func (c *Client) GetFile(filePath string) (string, error) {
+	return c.GetFileRevisionContext(context.Background(), filePath, "")
+}
+
+// GetFileContext is GetFile with a context
+func (c *Client) GetFileContext(ctx context.Context, filePath string) (string, error) {
+	return c.GetFileRevisionContext(ctx, filePath, "")
+}
+
+// GetFileRevision fetches a file as it was at a version control revision, or
+// the current version if revision is empty
+func (c *Client) GetFileRevision(filePath, revision string) (string, error) {
+	return c.GetFileRevisionContext(context.Background(), filePath, revision)
+}
+
+// GetFileRevisionContext is GetFileRevision with a context. The file is
+// decoded to UTF-8 (see Client.Encoding); binary files fail with
+// ErrBinaryFile.
+func (c *Client) GetFileRevisionContext(ctx context.Context, filePath, revision string) (string, error) {
+	// OpenGrok raw endpoint: /raw/path/to/file
+	// This returns plain text, much faster than parsing xref HTML
+	rawURL := JoinURL(c.XrefBaseURL(), "/raw"+filePath)
+	if revision != "" {
+		rawURL += "?r=" + url.QueryEscape(revision)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/plain")
+	if err := c.setAuthHeaders(req); err != nil {
+		return "", err
+	}
+	// A cached copy is revalidated; failing to read it just means a download
+	var cached *CachedFile
+	if c.FileCache != nil {
+		cached, _ = c.FileCache.Get(rawURL)
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return c.decodeRaw(cached.Content, "")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("raw API returned status %d", resp.StatusCode)
+	}
+
+	// Read the response
+	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
+	body, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	// Only responses the server can revalidate are worth keeping; a
+	// truncated one is not kept either
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if c.FileCache != nil && (etag != "" || lastModified != "") && len(body) < MaxResponseSize {
+		c.FileCache.Put(rawURL, &CachedFile{ETag: etag, LastModified: lastModified, Content: body})
+	}
+
+	return c.decodeRaw(body, resp.Header.Get("Content-Type"))
+}
+
+// GetXref fetches the cross-referenced HTML page of a file ("/project/path"),
+// whose source lines link symbols to their definitions and uses
+func (c *Client) GetXref(filePath string) (string, error) {
+	return c.GetXrefContext(context.Background(), filePath)
+}
+
+// GetXrefContext is GetXref with a context
+func (c *Client) GetXrefContext(ctx context.Context, filePath string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", JoinURL(c.XrefBaseURL(), "/xref"+filePath), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/html")
+	if err := c.setAuthHeaders(req); err != nil {
+		return "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", c.formatHTTPError(resp.StatusCode, body)
+	}
+
+	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
+	body, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return string(body), nil
+}
+
+// GetFileLines fetches lines from a file using the raw API
+// This is used to get context around a specific line to extract function names
+// Returns lines in the range [startLine, endLine] inclusive (1-indexed)
+func (c *Client) GetFileLines(filePath string, startLine, endLine int) ([]string, error) {
+	return c.GetFileLinesContext(context.Background(), filePath, startLine, endLine)
+}
+
+// GetFileLinesContext is GetFileLines with a context
+func (c *Client) GetFileLinesContext(ctx context.Context, filePath string, startLine, endLine int) ([]string, error) {
+	content, err := c.GetFileContext(ctx, filePath)
+	if err != nil {
+		// If raw API fails, return empty - don't fail the whole trace
+		return nil, err
+	}
+
+	// Split into lines and extract the range we need
+	allLines := strings.Split(content, "\n")
+
+	var result []string
+	// Lines are 1-indexed in the API, but 0-indexed in our array
+	for i := startLine - 1; i < endLine && i < len(allLines); i++ {
+		if i >= 0 {
+			result = append(result, allLines[i])
+		}
+	}
+
+	return result, nil
+}
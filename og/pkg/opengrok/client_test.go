@@ -1,8 +1,11 @@
-package main
+package opengrok
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -400,8 +403,8 @@ func TestHasAuth(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := tt.client.hasAuth(); got != tt.expected {
-				t.Errorf("hasAuth() = %v, want %v", got, tt.expected)
+			if got := tt.client.HasAuth(); got != tt.expected {
+				t.Errorf("HasAuth() = %v, want %v", got, tt.expected)
 			}
 		})
 	}
@@ -502,3 +505,90 @@ func TestFormatHTTPError(t *testing.T) {
 		})
 	}
 }
+
+func TestSearchParamsPathFilter(t *testing.T) {
+	params := searchParams(SearchOptions{Hist: "race", Path: "uts/common/*"})
+	if params.Get("hist") != "race" || params.Get("path") != "uts/common/*" {
+		t.Errorf("params = %v", params)
+	}
+}
+
+func TestSearchContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"resultCount":0,"results":{}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.SearchContext(ctx, SearchOptions{Full: "x"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("SearchContext with canceled context: got %v, want context.Canceled", err)
+	}
+	if _, err := client.GetFileContext(ctx, "/proj/a.c"); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetFileContext with canceled context: got %v, want context.Canceled", err)
+	}
+	if _, err := client.Search(SearchOptions{Full: "x"}); err != nil {
+		t.Errorf("Search: %v", err)
+	}
+}
+
+func TestClientURLsUnderPathPrefixes(t *testing.T) {
+	// A proxy serving the API under /grok-api and the web application
+	// under /deep/source
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/grok-api/api/v1/search"):
+			w.Write([]byte(`{"resultCount":0,"results":{}}`))
+		case r.URL.Path == "/grok-api/api/v1/projects":
+			w.Write([]byte(`["proj"]`))
+		case strings.HasPrefix(r.URL.Path, "/deep/source/raw/"), strings.HasPrefix(r.URL.Path, "/deep/source/xref/"):
+			w.Write([]byte("text"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL + "/deep/source/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.BaseURL != server.URL+"/deep/source" {
+		t.Errorf("BaseURL = %q, want the trailing slash dropped", client.BaseURL)
+	}
+	client.APIBase = server.URL + "/grok-api/"
+
+	if _, err := client.Search(SearchOptions{Full: "x"}); err != nil {
+		t.Errorf("Search: %v", err)
+	}
+	if _, err := client.GetProjects(); err != nil {
+		t.Errorf("GetProjects: %v", err)
+	}
+	if _, err := client.GetFile("/proj/my dir/a#1.c"); err != nil {
+		t.Errorf("GetFile: %v", err)
+	}
+	if _, err := client.GetXref("/proj/a.c"); err != nil {
+		t.Errorf("GetXref: %v", err)
+	}
+	want := []string{
+		"/grok-api/api/v1/search",
+		"/grok-api/api/v1/projects",
+		"/deep/source/raw/proj/my%20dir/a%231.c",
+		"/deep/source/xref/proj/a.c",
+	}
+	if strings.Join(paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requested %q, want %q", paths, want)
+	}
+
+	client.XrefBase = server.URL + "/web"
+	if got := client.XrefBaseURL(); got != server.URL+"/web" {
+		t.Errorf("XrefBaseURL = %q", got)
+	}
+}
@@ -0,0 +1,159 @@
+package opengrok
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrBinaryFile is returned for raw files that look binary rather than text
+var ErrBinaryFile = errors.New("binary file")
+
+// TextEncodings are the encodings DecodeText takes besides "auto"
+var TextEncodings = []string{"utf-8", "latin1", "windows-1252", "utf-16le", "utf-16be"}
+
+// binarySniffLen is how much of a file IsBinary looks at, as git does
+const binarySniffLen = 8000
+
+// IsBinary reports whether data looks like a binary file: a NUL byte in its
+// first 8000 bytes, as git and grep decide, unless a byte order mark says
+// it is UTF-16 text
+func IsBinary(data []byte) bool {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) || bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		return false
+	}
+	return bytes.IndexByte(data[:min(len(data), binarySniffLen)], 0) >= 0
+}
+
+// normalizeEncoding maps the spellings of an encoding name ("UTF8",
+// "ISO-8859-1", "cp1252") to one of TextEncodings, "auto" for "" or
+// "auto", and "" for names it doesn't know
+func normalizeEncoding(name string) string {
+	switch strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(strings.TrimSpace(name))) {
+	case "", "auto":
+		return "auto"
+	case "utf8":
+		return "utf-8"
+	case "latin1", "iso88591", "l1":
+		return "latin1"
+	case "windows1252", "cp1252":
+		return "windows-1252"
+	case "utf16le":
+		return "utf-16le"
+	case "utf16be":
+		return "utf-16be"
+	}
+	return ""
+}
+
+// CheckEncoding validates an encoding name for DecodeText
+func CheckEncoding(name string) error {
+	if normalizeEncoding(name) == "" {
+		return fmt.Errorf("unknown encoding %q (use auto, %s)", name, strings.Join(TextEncodings, ", "))
+	}
+	return nil
+}
+
+// DetectEncoding picks the encoding of data: a byte order mark wins, then
+// UTF-8 if data is valid UTF-8, then the charset of contentType (a
+// Content-Type header, "" if none). Anything else is taken as Windows-1252,
+// the superset of Latin-1 that legacy source files are usually in.
+func DetectEncoding(data []byte, contentType string) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return "utf-8"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return "utf-16le"
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return "utf-16be"
+	}
+	if utf8.Valid(data) {
+		return "utf-8"
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if enc := normalizeEncoding(params["charset"]); enc != "" && enc != "auto" && enc != "utf-8" {
+			return enc
+		}
+	}
+	return "windows-1252"
+}
+
+// DecodeText converts data in encoding (see TextEncodings; "auto" or ""
+// detects it with DetectEncoding) to UTF-8. Bytes that aren't valid in the
+// encoding become U+FFFD (a run of them one U+FFFD, in UTF-8), so the result
+// is always valid UTF-8, and a byte order mark is dropped.
+func DecodeText(data []byte, encoding string) (string, error) {
+	enc := normalizeEncoding(encoding)
+	switch enc {
+	case "":
+		return "", CheckEncoding(encoding)
+	case "auto":
+		enc = DetectEncoding(data, "")
+	}
+	return decodeAs(data, enc), nil
+}
+
+// decodeAs converts data from a normalized encoding to UTF-8
+func decodeAs(data []byte, enc string) string {
+	switch enc {
+	case "latin1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	case "windows-1252":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+			if b >= 0x80 && b < 0xA0 {
+				runes[i] = windows1252[b-0x80]
+			}
+		}
+		return string(runes)
+	case "utf-16le", "utf-16be":
+		units := make([]uint16, 0, len(data)/2)
+		for i := 0; i+1 < len(data); i += 2 {
+			if enc == "utf-16le" {
+				units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+			} else {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			}
+		}
+		s := string(utf16.Decode(units))
+		if len(data)%2 == 1 {
+			s += string(utf8.RuneError) // A dangling byte
+		}
+		return strings.TrimPrefix(s, "\uFEFF")
+	}
+	s := strings.ToValidUTF8(string(data), string(utf8.RuneError))
+	return strings.TrimPrefix(s, "\uFEFF")
+}
+
+// windows1252 maps bytes 0x80-0x9F, control characters in Latin-1, to the
+// characters Windows-1252 puts there; its five unused bytes become U+FFFD
+var windows1252 = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
+
+// decodeRaw converts a raw file download to text in c.Encoding, detecting
+// the encoding when it is unset. Without an encoding given, files that look
+// binary (see IsBinary) fail with ErrBinaryFile.
+func (c *Client) decodeRaw(data []byte, contentType string) (string, error) {
+	enc := normalizeEncoding(c.Encoding)
+	switch enc {
+	case "":
+		return "", CheckEncoding(c.Encoding)
+	case "auto":
+		if IsBinary(data) {
+			return "", ErrBinaryFile
+		}
+		enc = DetectEncoding(data, contentType)
+	}
+	return decodeAs(data, enc), nil
+}
@@ -0,0 +1,108 @@
+package opengrok
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"text", []byte("int main(void)\n"), false},
+		{"empty", nil, false},
+		{"NUL byte", []byte("\x7fELF\x02\x01\x01\x00"), true},
+		{"UTF-16 with BOM", []byte{0xFF, 0xFE, 'a', 0, 'b', 0}, false},
+		{"latin1", []byte("caf\xe9\n"), false},
+	}
+	for _, tt := range tests {
+		if got := IsBinary(tt.data); got != tt.want {
+			t.Errorf("%s: IsBinary() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		data        string
+		contentType string
+		want        string
+	}{
+		{"plain ascii", "", "utf-8"},
+		{"\xef\xbb\xbfbom", "", "utf-8"},
+		{"\xff\xfea\x00", "", "utf-16le"},
+		{"\xfe\xff\x00a", "", "utf-16be"},
+		{"caf\xe9", "", "windows-1252"},
+		{"caf\xe9", "text/plain; charset=ISO-8859-1", "latin1"},
+		{"caf\xc3\xa9", "text/plain; charset=ISO-8859-1", "utf-8"},
+	}
+	for _, tt := range tests {
+		if got := DetectEncoding([]byte(tt.data), tt.contentType); got != tt.want {
+			t.Errorf("DetectEncoding(%q, %q) = %s, want %s", tt.data, tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		data     string
+		encoding string
+		want     string
+	}{
+		{"caf\xe9", "latin1", "café"},
+		{"\x93quoted\x94 \x80", "windows-1252", "“quoted” €"},
+		{"\x93quoted\x94", "", "“quoted”"},
+		{"\x81", "cp1252", "�"},
+		{"ok \xff\xfe bad", "utf-8", "ok � bad"},
+		{"\xef\xbb\xbfhi", "auto", "hi"},
+		{"\xff\xfeh\x00i\x00", "auto", "hi"},
+		{"\x00h\x00i\x00", "utf-16be", "hi�"},
+	}
+	for _, tt := range tests {
+		got, err := DecodeText([]byte(tt.data), tt.encoding)
+		if err != nil {
+			t.Errorf("DecodeText(%q, %q): %v", tt.data, tt.encoding, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("DecodeText(%q, %q) = %q, want %q", tt.data, tt.encoding, got, tt.want)
+		}
+	}
+	if _, err := DecodeText([]byte("x"), "ebcdic"); err == nil {
+		t.Error("DecodeText() with an unknown encoding succeeded")
+	}
+}
+
+func TestGetFileDecodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/raw/proj/latin1.c":
+			w.Header().Set("Content-Type", "text/plain; charset=ISO-8859-1")
+			w.Write([]byte("/* caf\xe9 */\n"))
+		case "/raw/proj/logo.png":
+			w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := client.GetFile("/proj/latin1.c")
+	if err != nil || content != "/* café */\n" {
+		t.Errorf("GetFile(latin1) = %q, %v", content, err)
+	}
+	if _, err := client.GetFile("/proj/logo.png"); !errors.Is(err, ErrBinaryFile) {
+		t.Errorf("GetFile(binary) error = %v, want ErrBinaryFile", err)
+	}
+
+	client.Encoding = "latin1"
+	if content, err := client.GetFile("/proj/logo.png"); err != nil || content != "\u0089PNG\r\n\x1a\n\x00\x00\x00\rIHDR" {
+		t.Errorf("GetFile(binary) with an encoding = %q, %v", content, err)
+	}
+}
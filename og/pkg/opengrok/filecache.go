@@ -0,0 +1,151 @@
+package opengrok
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FileCache keeps raw file downloads between runs (see Client.FileCache).
+// A cached file is revalidated with the server on every fetch, using its
+// ETag or Last-Modified date, so it is only downloaded again when it has
+// changed.
+type FileCache interface {
+	// Get returns the file cached under key, or nil if there is none
+	Get(key string) (*CachedFile, error)
+	// Put stores a file under key, replacing any cached before
+	Put(key string, file *CachedFile) error
+}
+
+// CachedFile is a raw file download with the validators the server sent
+// with it
+type CachedFile struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Content      []byte `json:"-"`
+}
+
+// DiskFileCache is a FileCache in a directory, holding each file's content
+// and validators in two files named after a hash of its key. When the
+// contents outgrow MaxBytes (0 for no limit), the least recently stored
+// files are removed.
+type DiskFileCache struct {
+	Dir      string
+	MaxBytes int64
+}
+
+// paths returns the content and validator files of key
+func (c *DiskFileCache) paths(key string) (content, meta string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, name), filepath.Join(c.Dir, name+".json")
+}
+
+// Get implements FileCache
+func (c *DiskFileCache) Get(key string) (*CachedFile, error) {
+	contentPath, metaPath := c.paths(key)
+	meta, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file CachedFile
+	if err := json.Unmarshal(meta, &file); err != nil {
+		return nil, err
+	}
+	if file.Content, err = os.ReadFile(contentPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Put implements FileCache. The validators are written last, so a file
+// interrupted while being stored is never read back with the wrong content.
+func (c *DiskFileCache) Put(key string, file *CachedFile) error {
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+	contentPath, metaPath := c.paths(key)
+	meta, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	os.Remove(metaPath)
+	if err := writeFileAtomic(contentPath, file.Content); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(metaPath, meta); err != nil {
+		return err
+	}
+	if c.MaxBytes > 0 {
+		c.prune()
+	}
+	return nil
+}
+
+// prune removes the least recently stored files until the cache fits in
+// MaxBytes
+func (c *DiskFileCache) prune() {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		content string
+		size    int64
+		modTime int64
+	}
+	var files []cached
+	var total int64
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != "" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, cached{filepath.Join(c.Dir, e.Name()), info.Size(), info.ModTime().UnixNano()})
+		total += info.Size()
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime < files[j].modTime })
+	for _, f := range files {
+		if total <= c.MaxBytes {
+			break
+		}
+		os.Remove(f.content + ".json")
+		os.Remove(f.content)
+		total -= f.size
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into
+// place, so readers see the old or the new file but never part of one
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
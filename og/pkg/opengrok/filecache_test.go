@@ -0,0 +1,105 @@
+package opengrok
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetFileRevalidatesCachedFile(t *testing.T) {
+	content := "int main(void) {}\n"
+	etag := `"v1"`
+	var downloads, revalidations int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			revalidations++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.FileCache = &DiskFileCache{Dir: t.TempDir()}
+
+	for i := 0; i < 2; i++ {
+		got, err := client.GetFile("/proj/main.c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != content {
+			t.Errorf("fetch %d = %q, want %q", i+1, got, content)
+		}
+	}
+	if downloads != 1 || revalidations != 1 {
+		t.Errorf("downloads = %d, revalidations = %d; want 1 and 1", downloads, revalidations)
+	}
+
+	// A changed file is downloaded again and replaces the cached copy
+	content, etag = "int main(void) { return 1; }\n", `"v2"`
+	if got, err := client.GetFile("/proj/main.c"); err != nil || got != content {
+		t.Errorf("changed file = %q, %v", got, err)
+	}
+	if got, err := client.GetFile("/proj/main.c"); err != nil || got != content || downloads != 2 || revalidations != 2 {
+		t.Errorf("changed file from cache = %q, %v (downloads %d, revalidations %d)", got, err, downloads, revalidations)
+	}
+}
+
+func TestGetFileWithoutValidatorsIsNotCached(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("text"))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	client.FileCache = &DiskFileCache{Dir: dir}
+	if _, err := client.GetFile("/proj/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("cache holds %d files, want none", len(entries))
+	}
+}
+
+func TestDiskFileCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	cache := &DiskFileCache{Dir: dir, MaxBytes: 25}
+	old := time.Now().Add(-time.Hour)
+	for i, key := range []string{"a", "b", "c"} {
+		if err := cache.Put(key, &CachedFile{ETag: key, Content: []byte(strings.Repeat(key, 10))}); err != nil {
+			t.Fatal(err)
+		}
+		// Stored a minute apart, oldest first
+		contentPath, _ := cache.paths(key)
+		stamp := old.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(contentPath, stamp, stamp)
+	}
+	cache.prune()
+
+	for key, want := range map[string]bool{"a": false, "b": true, "c": true} {
+		file, err := cache.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (file != nil) != want {
+			t.Errorf("%s cached = %v, want %v", key, file != nil, want)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("temporary files left: %v", matches)
+	}
+}
@@ -0,0 +1,107 @@
+package opengrok
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrNotIndexed is returned for files the index has no document for
+var ErrNotIndexed = errors.New("not found in the index")
+
+// GetFileGenre returns the genre a file ("/project/path") was indexed as:
+// PLAIN, XREFABLE, IMAGE, DATA or HTML. Files missing from the index fail
+// with ErrNotIndexed.
+func (c *Client) GetFileGenre(filePath string) (string, error) {
+	return c.GetFileGenreContext(context.Background(), filePath)
+}
+
+// GetFileGenreContext is GetFileGenre with a context
+func (c *Client) GetFileGenreContext(ctx context.Context, filePath string) (string, error) {
+	params := url.Values{}
+	params.Set("path", filePath)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.APIURL("/api/v1/file/genre")+"?"+params.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "text/plain")
+	if err := c.setAuthHeaders(req); err != nil {
+		return "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%s: %w", filePath, ErrNotIndexed)
+	case resp.StatusCode != http.StatusOK:
+		return "", c.formatHTTPError(resp.StatusCode, body)
+	}
+	return strings.Trim(strings.TrimSpace(string(body)), `"`), nil
+}
+
+// GetFileSize returns the size in bytes of a file's current version, and
+// when the server says it was last modified (zero if it doesn't say). The
+// size comes from the Content-Length of a HEAD request on the raw endpoint;
+// servers that don't send one have the file read and discarded instead, so
+// binary files and files larger than MaxResponseSize are measured too.
+func (c *Client) GetFileSize(filePath string) (int64, time.Time, error) {
+	return c.GetFileSizeContext(context.Background(), filePath)
+}
+
+// GetFileSizeContext is GetFileSize with a context
+func (c *Client) GetFileSizeContext(ctx context.Context, filePath string) (int64, time.Time, error) {
+	// Servers that refuse HEAD get the GET too
+	resp, err := c.getRaw(ctx, "HEAD", filePath)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if err != nil || resp.ContentLength < 0 {
+		if resp, err = c.getRaw(ctx, "GET", filePath); err != nil {
+			return 0, time.Time{}, err
+		}
+		defer resp.Body.Close()
+		if resp.ContentLength, err = io.Copy(io.Discard, resp.Body); err != nil {
+			return 0, time.Time{}, fmt.Errorf("failed to read response body: %w", err)
+		}
+	}
+	modified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.ContentLength, modified, nil
+}
+
+// getRaw sends a request for a file on the raw endpoint, failing unless the
+// server answers 200
+func (c *Client) getRaw(ctx context.Context, method, filePath string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, JoinURL(c.XrefBaseURL(), "/raw"+filePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("raw API returned status %d", resp.StatusCode)
+	}
+	return resp, nil
+}
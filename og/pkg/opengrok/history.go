@@ -0,0 +1,127 @@
+package opengrok
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryEntry is one commit in a file's version control history
+type HistoryEntry struct {
+	Revision string         `json:"revision"`
+	Date     FlexibleString `json:"date"` // Milliseconds since the epoch
+	Author   string         `json:"author"`
+	Message  string         `json:"message"`
+}
+
+// Time returns the commit date, or false if it is not a timestamp
+func (e HistoryEntry) Time() (time.Time, bool) {
+	ms, err := strconv.ParseInt(string(e.Date), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms).UTC(), true
+}
+
+// Day formats the commit date as YYYY-MM-DD, falling back to the raw value
+// when it is not a timestamp
+func (e HistoryEntry) Day() string {
+	t, ok := e.Time()
+	if !ok {
+		return string(e.Date)
+	}
+	return t.Format("2006-01-02")
+}
+
+// Summary returns the first line of the commit message
+func (e HistoryEntry) Summary() string {
+	summary, _, _ := strings.Cut(strings.TrimSpace(e.Message), "\n")
+	return strings.TrimSpace(summary)
+}
+
+// LineAnnotation is the blame information for one line of a file
+type LineAnnotation struct {
+	Revision    string `json:"revision"`
+	Author      string `json:"author"`
+	Description string `json:"description"`
+}
+
+// GetHistory fetches up to max history entries for a file, newest first
+func (c *Client) GetHistory(filePath string, max int) ([]HistoryEntry, error) {
+	return c.GetHistoryContext(context.Background(), filePath, max)
+}
+
+// GetHistoryContext is GetHistory with a context
+func (c *Client) GetHistoryContext(ctx context.Context, filePath string, max int) ([]HistoryEntry, error) {
+	var resp struct {
+		Entries []HistoryEntry `json:"entries"`
+	}
+	params := url.Values{}
+	params.Set("path", filePath)
+	params.Set("max", strconv.Itoa(max))
+	if err := c.getJSON(ctx, "/api/v1/history", params, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// GetAnnotation fetches the blame information for every line of a file at a
+// revision, or the current version if revision is empty
+func (c *Client) GetAnnotation(filePath, revision string) ([]LineAnnotation, error) {
+	return c.GetAnnotationContext(context.Background(), filePath, revision)
+}
+
+// GetAnnotationContext is GetAnnotation with a context
+func (c *Client) GetAnnotationContext(ctx context.Context, filePath, revision string) ([]LineAnnotation, error) {
+	var lines []LineAnnotation
+	params := url.Values{}
+	params.Set("path", filePath)
+	if revision != "" {
+		params.Set("revision", revision)
+	}
+	if err := c.getJSON(ctx, "/api/v1/annotation", params, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// getJSON sends a GET request to an API endpoint and decodes the JSON reply
+func (c *Client) getJSON(ctx context.Context, endpoint string, params url.Values, v any) error {
+	if p := c.profile(); !p.Supports(endpoint) {
+		return fmt.Errorf("%s is not available on OpenGrok %s", endpoint, p.Version)
+	}
+	apiURL := c.APIURL(endpoint) + "?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if err := c.setAuthHeaders(req); err != nil {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return c.formatHTTPError(resp.StatusCode, body)
+	}
+
+	limitedReader := io.LimitReader(resp.Body, MaxResponseSize)
+	if err := json.NewDecoder(limitedReader).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
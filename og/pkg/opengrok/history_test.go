@@ -0,0 +1,16 @@
+package opengrok
+
+import "testing"
+
+func TestHistoryEntryFormatting(t *testing.T) {
+	e := HistoryEntry{Date: "1680307200000", Message: "Fix race in startup\n\nLonger description"}
+	if got := e.Day(); got != "2023-04-01" {
+		t.Errorf("Day() = %q, want 2023-04-01", got)
+	}
+	if got := e.Summary(); got != "Fix race in startup" {
+		t.Errorf("Summary() = %q", got)
+	}
+	if got := (HistoryEntry{Date: "2023-04-01T10:00"}).Day(); got != "2023-04-01T10:00" {
+		t.Errorf("Day() of non-timestamp = %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package opengrok
+
+import (
+	"path"
+	"strings"
+)
+
+// Result paths reach clients in several shapes: as Path or as Directory plus
+// Filename, with or without a leading slash, and sometimes prefixed with the
+// project name. Everything og shows, links or serializes goes through the
+// functions below so every consumer sees the same canonical form:
+//
+//	ResultPath      "/dir/file.c"             path within the project
+//	ProjectPath     "/project/dir/file.c"     server-wide path (xref, history)
+//	DisplayPath     "project/dir/file.c"      what og prints
+//	XrefURL         "<server>/xref/project/dir/file.c"
+
+// ResultPath returns a result's path within project in canonical form: one
+// leading slash, no project prefix, no trailing slash or empty elements.
+// It returns "" if the result carries no path.
+func ResultPath(project string, r SearchResult) string {
+	p := r.Path
+	if p == "" {
+		dir := strings.TrimSuffix(r.Directory, "/")
+		switch {
+		case dir != "" && r.Filename != "":
+			p = dir + "/" + r.Filename
+		case r.Filename != "":
+			p = r.Filename
+		default:
+			p = dir
+		}
+	}
+	return canonicalPath(project, p)
+}
+
+// canonicalPath cleans p and strips a leading project directory
+func canonicalPath(project, p string) string {
+	p = cleanPath(p)
+	if project != "" && strings.HasPrefix(p, "/"+project+"/") {
+		p = strings.TrimPrefix(p, "/"+project)
+	}
+	return p
+}
+
+// cleanPath returns p with one leading slash and no trailing slash, "." or
+// empty elements, or "" for an empty or root path
+func cleanPath(p string) string {
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return ""
+	}
+	return p
+}
+
+// FilePath returns the entry's canonical path within its project
+func (e ResultEntry) FilePath() string {
+	return ResultPath(e.Project, e.SearchResult)
+}
+
+// ProjectPath joins a project and a path within it into a server-wide path
+// ("/project/dir/file.c"). The leading slash of p is optional; "" gives the
+// project's root ("/project").
+func ProjectPath(project, p string) string {
+	p = cleanPath(p)
+	if project == "" {
+		return p
+	}
+	return "/" + project + p
+}
+
+// DisplayPath returns the "project/dir/file.c" form og prints
+func DisplayPath(project, p string) string {
+	return strings.TrimPrefix(ProjectPath(project, p), "/")
+}
+
+// XrefURL returns the OpenGrok web URL of a file, at line if it is not ""
+func XrefURL(serverURL, project, p, line string) string {
+	u := JoinURL(serverURL, "/xref"+ProjectPath(project, p))
+	if line != "" {
+		u += DefaultProfile.lineAnchor(line)
+	}
+	return u
+}
@@ -0,0 +1,97 @@
+package opengrok
+
+import "testing"
+
+func TestResultPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		project string
+		result  SearchResult
+		want    string
+	}{
+		{"path with slash", "proj", SearchResult{Path: "/src/main.c"}, "/src/main.c"},
+		{"path without slash", "proj", SearchResult{Path: "src/main.c"}, "/src/main.c"},
+		{"path with project prefix", "proj", SearchResult{Path: "/proj/src/main.c"}, "/src/main.c"},
+		{"path with project prefix, no slash", "proj", SearchResult{Path: "proj/src/main.c"}, "/src/main.c"},
+		{"project-named file kept", "proj", SearchResult{Path: "/proj"}, "/proj"},
+		{"similar project name kept", "proj", SearchResult{Path: "/project/main.c"}, "/project/main.c"},
+		{"doubled slashes", "proj", SearchResult{Path: "//src//main.c"}, "/src/main.c"},
+		{"dot elements", "proj", SearchResult{Path: "/src/./main.c"}, "/src/main.c"},
+		{"directory and filename", "proj", SearchResult{Directory: "/src", Filename: "main.c"}, "/src/main.c"},
+		{"directory with trailing slash", "proj", SearchResult{Directory: "/src/", Filename: "main.c"}, "/src/main.c"},
+		{"directory without slash", "proj", SearchResult{Directory: "src", Filename: "main.c"}, "/src/main.c"},
+		{"directory with project prefix", "proj", SearchResult{Directory: "/proj/src", Filename: "main.c"}, "/src/main.c"},
+		{"root directory", "proj", SearchResult{Directory: "/", Filename: "Makefile"}, "/Makefile"},
+		{"filename only", "proj", SearchResult{Filename: "Makefile"}, "/Makefile"},
+		{"directory only", "proj", SearchResult{Directory: "/src/"}, "/src"},
+		{"path wins over directory", "proj", SearchResult{Path: "/a.c", Directory: "/src", Filename: "b.c"}, "/a.c"},
+		{"no project", "", SearchResult{Path: "src/main.c"}, "/src/main.c"},
+		{"empty", "proj", SearchResult{}, ""},
+		{"root only", "proj", SearchResult{Path: "/"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResultPath(tt.project, tt.result); got != tt.want {
+				t.Errorf("ResultPath(%q, %+v) = %q, want %q", tt.project, tt.result, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResultEntryFilePath(t *testing.T) {
+	e := ResultEntry{Project: "proj", SearchResult: SearchResult{Directory: "proj/src/", Filename: "x.c"}}
+	if got := e.FilePath(); got != "/src/x.c" {
+		t.Errorf("FilePath() = %q", got)
+	}
+}
+
+func TestProjectAndDisplayPath(t *testing.T) {
+	tests := []struct {
+		project, path      string
+		wantFull, wantShow string
+	}{
+		{"proj", "/src/main.c", "/proj/src/main.c", "proj/src/main.c"},
+		{"proj", "src/main.c", "/proj/src/main.c", "proj/src/main.c"},
+		{"proj", "/src/", "/proj/src", "proj/src"},
+		{"proj", "", "/proj", "proj"},
+		// Already canonical paths are not stripped again
+		{"proj", "/proj/main.c", "/proj/proj/main.c", "proj/proj/main.c"},
+		{"", "/src/main.c", "/src/main.c", "src/main.c"},
+		{"", "", "", ""},
+	}
+	for _, tt := range tests {
+		if got := ProjectPath(tt.project, tt.path); got != tt.wantFull {
+			t.Errorf("ProjectPath(%q, %q) = %q, want %q", tt.project, tt.path, got, tt.wantFull)
+		}
+		if got := DisplayPath(tt.project, tt.path); got != tt.wantShow {
+			t.Errorf("DisplayPath(%q, %q) = %q, want %q", tt.project, tt.path, got, tt.wantShow)
+		}
+	}
+}
+
+func TestXrefURL(t *testing.T) {
+	tests := []struct {
+		server, project, path, line string
+		want                        string
+	}{
+		{"http://og/source", "proj", "/src/main.c", "42", "http://og/source/xref/proj/src/main.c#42"},
+		{"http://og/source/", "proj", "src/main.c", "", "http://og/source/xref/proj/src/main.c"},
+		{"http://og", "", "/proj/src/main.c", "7", "http://og/xref/proj/src/main.c#7"},
+		{"http://og", "proj", "", "", "http://og/xref/proj"},
+		{"https://host/a/b/source//", "proj", "/my dir/c#.c", "3", "https://host/a/b/source/xref/proj/my%20dir/c%23.c#3"},
+	}
+	for _, tt := range tests {
+		if got := XrefURL(tt.server, tt.project, tt.path, tt.line); got != tt.want {
+			t.Errorf("XrefURL(%q, %q, %q, %q) = %q, want %q", tt.server, tt.project, tt.path, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeResultPathUsesKeyPath(t *testing.T) {
+	if got := normalizeResultPath("proj", "src/main.c", SearchResult{}); got != "/src/main.c" {
+		t.Errorf("normalizeResultPath() = %q", got)
+	}
+	if got := normalizeResultPath("proj", "src/main.c", SearchResult{Path: "/other.c"}); got != "/other.c" {
+		t.Errorf("entry path should win over key path, got %q", got)
+	}
+}
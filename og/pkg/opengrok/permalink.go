@@ -0,0 +1,76 @@
+package opengrok
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AnnotationParam is the query parameter that identifies an annotation in a
+// permalink. OpenGrok ignores it, so the link still opens the file at the
+// annotated line for readers without the extension.
+const AnnotationParam = "annotation"
+
+// AnnotationRef identifies an og_annotate annotation. Author and Timestamp
+// stay the same when a rebase moves the note, so Line is only where the note
+// was when the link was made.
+type AnnotationRef struct {
+	ServerURL string
+	Project   string
+	Path      string // Canonical path within the project
+	Line      int
+	Author    string
+	Timestamp string
+}
+
+// AnnotationPermalink returns a shareable link to the annotation: the xref
+// URL of its line, with the annotation encoded in AnnotationParam, e.g.
+// "<server>/xref/project/dir/file.c?annotation=YWxpY2UKMjAyNC0wMS0xNQ#42"
+func AnnotationPermalink(ref AnnotationRef) string {
+	token := base64.RawURLEncoding.EncodeToString([]byte(ref.Author + "\n" + ref.Timestamp))
+	return XrefURL(ref.ServerURL, ref.Project, ref.Path, "") + "?" + AnnotationParam + "=" + token +
+		DefaultProfile.lineAnchor(strconv.Itoa(ref.Line))
+}
+
+// ParseAnnotationPermalink reverses AnnotationPermalink
+func ParseAnnotationPermalink(link string) (AnnotationRef, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return AnnotationRef{}, fmt.Errorf("not an annotation permalink: %q", link)
+	}
+	i := strings.LastIndex(u.Path, "/xref/")
+	if i < 0 {
+		return AnnotationRef{}, fmt.Errorf("not an OpenGrok xref link: %q", link)
+	}
+	project, p, _ := strings.Cut(u.Path[i+len("/xref/"):], "/")
+	if project == "" || cleanPath(p) == "" {
+		return AnnotationRef{}, fmt.Errorf("link names no project file: %q", link)
+	}
+
+	token := u.Query().Get(AnnotationParam)
+	if token == "" {
+		return AnnotationRef{}, fmt.Errorf("link has no %s parameter: %q", AnnotationParam, link)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	author, timestamp, ok := strings.Cut(string(decoded), "\n")
+	if err != nil || !ok || author == "" {
+		return AnnotationRef{}, fmt.Errorf("invalid %s parameter in %q", AnnotationParam, link)
+	}
+
+	// Line anchors are "#42" or, on some servers, "#L42"
+	line, err := strconv.Atoi(strings.TrimLeft(u.Fragment, "Ll"))
+	if err != nil || line < 1 {
+		return AnnotationRef{}, fmt.Errorf("link has no line number: %q", link)
+	}
+
+	return AnnotationRef{
+		ServerURL: u.Scheme + "://" + u.Host + u.Path[:i],
+		Project:   project,
+		Path:      cleanPath(p),
+		Line:      line,
+		Author:    author,
+		Timestamp: timestamp,
+	}, nil
+}
@@ -0,0 +1,51 @@
+package opengrok
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnotationPermalinkRoundTrip(t *testing.T) {
+	ref := AnnotationRef{
+		ServerURL: "https://opengrok.example.com/source",
+		Project:   "illumos-gate",
+		Path:      "/usr/src/uts/common/fs/vnode.c",
+		Line:      42,
+		Author:    "alice",
+		Timestamp: "2024-01-15T10:30:00Z",
+	}
+	link := AnnotationPermalink(ref)
+	if want := "https://opengrok.example.com/source/xref/illumos-gate/usr/src/uts/common/fs/vnode.c?annotation="; !strings.HasPrefix(link, want) {
+		t.Errorf("AnnotationPermalink() = %q, want prefix %q", link, want)
+	}
+	if !strings.HasSuffix(link, "#42") {
+		t.Errorf("AnnotationPermalink() = %q, want the line anchor", link)
+	}
+
+	got, err := ParseAnnotationPermalink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != ref {
+		t.Errorf("ParseAnnotationPermalink() = %+v, want %+v", got, ref)
+	}
+}
+
+func TestParseAnnotationPermalinkErrors(t *testing.T) {
+	tests := []struct {
+		link, want string
+	}{
+		{"vnode.c:42", "not an annotation permalink"},
+		{"https://x/source/search?q=vnode", "not an OpenGrok xref link"},
+		{"https://x/source/xref/proj?annotation=YQpi#1", "names no project file"},
+		{"https://x/source/xref/proj/a.c#42", "no annotation parameter"},
+		{"https://x/source/xref/proj/a.c?annotation=!!!#42", "invalid annotation parameter"},
+		{"https://x/source/xref/proj/a.c?annotation=YWxpY2U#42", "invalid annotation parameter"},
+		{"https://x/source/xref/proj/a.c?annotation=YQpi", "no line number"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseAnnotationPermalink(tt.link); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseAnnotationPermalink(%q) error = %v, want %q", tt.link, err, tt.want)
+		}
+	}
+}
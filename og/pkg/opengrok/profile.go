@@ -0,0 +1,261 @@
+package opengrok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// OpenGrok releases differ in small ways: the field carrying a result's line
+// number, the endpoints available, the form of line anchors. A ServerProfile
+// collects those differences so parsing and requests consult one place
+// instead of each growing its own fallbacks. Clients use DefaultProfile,
+// which tolerates every known variant, until DetectProfile asks the server
+// for its version.
+
+// ServerProfile describes the API quirks of one OpenGrok server
+type ServerProfile struct {
+	// Version is the release reported by /api/v1/system/version, "" if the
+	// server did not say
+	Version string
+	// LineFields are the result fields holding the line number, tried in order
+	LineFields []string
+	// LineAnchor formats the xref URL fragment for a line number
+	LineAnchor string
+	// Missing lists the API endpoints the release does not serve
+	Missing []string
+}
+
+// DefaultProfile accepts every known line number field and assumes every
+// endpoint exists
+var DefaultProfile = &ServerProfile{
+	// "lineNo" in symbol/definition results of older servers, "lineNumber"
+	// in newer ones (e.g. illumos OpenGrok), "lineno" in some full text results
+	LineFields: []string{"lineNo", "lineNumber", "lineno"},
+	LineAnchor: "#%s",
+}
+
+// endpointReleases records the first release serving each versioned endpoint
+var endpointReleases = []struct {
+	endpoint string
+	since    string
+}{
+	{"/api/v1/history", "1.7"},
+	{"/api/v1/annotation", "1.8"},
+}
+
+// ProfileForVersion returns the profile of a server reporting version.
+// Unparseable versions get DefaultProfile's quirks with the version noted.
+func ProfileForVersion(version string) *ServerProfile {
+	profile := *DefaultProfile
+	profile.Version = version
+	profile.Missing = nil
+	if _, ok := parseVersion(version); !ok {
+		return &profile
+	}
+	for _, e := range endpointReleases {
+		if compareVersions(version, e.since) < 0 {
+			profile.Missing = append(profile.Missing, e.endpoint)
+		}
+	}
+	return &profile
+}
+
+// Supports reports whether the server is expected to serve endpoint
+func (p *ServerProfile) Supports(endpoint string) bool {
+	for _, missing := range p.Missing {
+		if missing == endpoint {
+			return false
+		}
+	}
+	return true
+}
+
+// lineAnchor returns the URL fragment for line
+func (p *ServerProfile) lineAnchor(line string) string {
+	return fmt.Sprintf(p.LineAnchor, line)
+}
+
+// decodeResult decodes one search result, reading the line number from the
+// first of LineFields present
+func (p *ServerProfile) decodeResult(data []byte, s *SearchResult) error {
+	var fields struct {
+		Line      string            `json:"line"`
+		Path      string            `json:"path"`
+		Filename  string            `json:"filename"`
+		Directory string            `json:"directory"`
+		Labels    map[string]string `json:"labels"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*s = SearchResult{
+		Line:      fields.Line,
+		Path:      fields.Path,
+		Filename:  fields.Filename,
+		Directory: fields.Directory,
+		Labels:    fields.Labels,
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil // Don't fail, just use what we have
+	}
+	for _, name := range p.LineFields {
+		value, ok := raw[name]
+		if !ok {
+			continue
+		}
+		var lineNo FlexibleString
+		if err := json.Unmarshal(value, &lineNo); err == nil && lineNo != "" {
+			s.LineNo = lineNo
+			return nil
+		}
+	}
+	return nil
+}
+
+// decodeSearchResponse parses a search reply with the profile's quirks
+func (p *ServerProfile) decodeSearchResponse(body []byte) (*SearchResponse, error) {
+	var envelope struct {
+		Time          int64                        `json:"time"`
+		ResultCount   int                          `json:"resultCount"`
+		StartDocument int                          `json:"startDocument"`
+		EndDocument   int                          `json:"endDocument"`
+		Results       map[string][]json.RawMessage `json:"results"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	resp := &SearchResponse{
+		Time:          envelope.Time,
+		ResultCount:   envelope.ResultCount,
+		StartDocument: envelope.StartDocument,
+		EndDocument:   envelope.EndDocument,
+	}
+	if envelope.Results == nil {
+		return resp, nil
+	}
+	resp.Results = make(map[string][]SearchResult, len(envelope.Results))
+	for key, raws := range envelope.Results {
+		results := make([]SearchResult, len(raws))
+		for i, raw := range raws {
+			if err := p.decodeResult(raw, &results[i]); err != nil {
+				return nil, err
+			}
+		}
+		resp.Results[key] = results
+	}
+	return resp, nil
+}
+
+// profile returns the client's server profile
+func (c *Client) profile() *ServerProfile {
+	if c.Profile != nil {
+		return c.Profile
+	}
+	return DefaultProfile
+}
+
+// DetectProfile asks the server for its version and sets Client.Profile to
+// match. Servers without the version endpoint get DefaultProfile.
+func (c *Client) DetectProfile(ctx context.Context) (*ServerProfile, error) {
+	version, err := c.ServerVersion(ctx)
+	if errors.Is(err, errNotFound) {
+		c.Profile = DefaultProfile
+		return c.Profile, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Profile = ProfileForVersion(version)
+	return c.Profile, nil
+}
+
+// errNotFound marks a 404 from an endpoint the server does not have
+var errNotFound = errors.New("endpoint not found")
+
+// ServerVersion returns the release reported by /api/v1/system/version
+func (c *Client) ServerVersion(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.APIURL("/api/v1/system/version"), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if err := c.setAuthHeaders(req); err != nil {
+		return "", err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return "", errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", c.formatHTTPError(resp.StatusCode, body)
+	}
+
+	// Plain text on current servers; accept a JSON string too
+	version := strings.TrimSpace(string(body))
+	var quoted string
+	if json.Unmarshal(body, &quoted) == nil {
+		version = strings.TrimSpace(quoted)
+	}
+	return version, nil
+}
+
+// parseVersion splits a release such as "1.7.19" or "1.13.9-SNAPSHOT" into
+// its numeric parts
+func parseVersion(version string) ([]int, bool) {
+	version, _, _ = strings.Cut(version, "-")
+	if version == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// compareVersions orders two releases, treating missing parts as 0.
+// Unparseable versions compare equal to anything.
+func compareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0
+	}
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+package opengrok
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.7.19", "1.7", 1},
+		{"1.6.9", "1.7", -1},
+		{"1.13.9-SNAPSHOT", "1.8", 1},
+		{"1.7", "1.7.0", 0},
+		{"unknown", "1.7", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestProfileForVersion(t *testing.T) {
+	old := ProfileForVersion("1.6.2")
+	if old.Supports("/api/v1/history") || old.Supports("/api/v1/annotation") || !old.Supports("/api/v1/search") {
+		t.Errorf("1.6.2 missing = %v", old.Missing)
+	}
+	if p := ProfileForVersion("1.7.19"); !p.Supports("/api/v1/history") || p.Supports("/api/v1/annotation") {
+		t.Errorf("1.7.19 missing = %v", p.Missing)
+	}
+	if p := ProfileForVersion("dev"); len(p.Missing) != 0 || p.Version != "dev" {
+		t.Errorf("unparseable version profile = %+v", p)
+	}
+	if len(DefaultProfile.Missing) != 0 {
+		t.Error("ProfileForVersion modified DefaultProfile")
+	}
+}
+
+func TestDetectProfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/system/version":
+			w.Write([]byte("1.6.2\n"))
+		case "/api/v1/search":
+			w.Write([]byte(`{"resultCount": 1, "results": {"proj": [{"line": "x", "lineNumber": 7, "path": "/a.c"}]}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := client.DetectProfile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Version != "1.6.2" || client.Profile != profile {
+		t.Errorf("DetectProfile() = %+v", profile)
+	}
+
+	// Missing endpoints fail without a request
+	if _, err := client.GetHistory("/proj/a.c", 10); err == nil || !strings.Contains(err.Error(), "not available on OpenGrok 1.6.2") {
+		t.Errorf("GetHistory() error = %v", err)
+	}
+
+	resp, err := client.Search(SearchOptions{Full: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Results["proj"][0].LineNo; got != "7" {
+		t.Errorf("LineNo = %q, want 7", got)
+	}
+}
+
+func TestDetectProfileWithoutVersionEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile, err := client.DetectProfile(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile != DefaultProfile {
+		t.Errorf("DetectProfile() = %+v, want DefaultProfile", profile)
+	}
+}
@@ -0,0 +1,56 @@
+package opengrok
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// GetProjectFiles lists the indexed files of a project, as paths starting
+// with "/project/"
+func (c *Client) GetProjectFiles(project string) ([]string, error) {
+	return c.GetProjectFilesContext(context.Background(), project)
+}
+
+// GetProjectFilesContext is GetProjectFiles with a context
+func (c *Client) GetProjectFilesContext(ctx context.Context, project string) ([]string, error) {
+	var files []string
+	if err := c.getJSON(ctx, "/api/v1/projects/"+url.PathEscape(project)+"/files", url.Values{}, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetProjectRepositories lists the source paths of a project's repositories
+func (c *Client) GetProjectRepositories(project string) ([]string, error) {
+	return c.GetProjectRepositoriesContext(context.Background(), project)
+}
+
+// GetProjectRepositoriesContext is GetProjectRepositories with a context
+func (c *Client) GetProjectRepositoriesContext(ctx context.Context, project string) ([]string, error) {
+	var repos []string
+	if err := c.getJSON(ctx, "/api/v1/projects/"+url.PathEscape(project)+"/repositories", url.Values{}, &repos); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// GetRepositoryProperty returns one property of a repository (e.g. "type",
+// "branch", "currentVersion" or "parent"), "" if it is unset
+func (c *Client) GetRepositoryProperty(repository, field string) (string, error) {
+	return c.GetRepositoryPropertyContext(context.Background(), repository, field)
+}
+
+// GetRepositoryPropertyContext is GetRepositoryProperty with a context
+func (c *Client) GetRepositoryPropertyContext(ctx context.Context, repository, field string) (string, error) {
+	var value any
+	params := url.Values{}
+	params.Set("repository", repository)
+	if err := c.getJSON(ctx, "/api/v1/repositories/property/"+url.PathEscape(field), params, &value); err != nil {
+		return "", err
+	}
+	if value == nil {
+		return "", nil
+	}
+	return fmt.Sprint(value), nil
+}
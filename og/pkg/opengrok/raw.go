@@ -0,0 +1,80 @@
+package opengrok
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// RawResponse is the undecoded response to a RawRequest
+type RawResponse struct {
+	Status     string // e.g. "200 OK"
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// APIPath resolves a path given to RawRequest: paths under api/ are taken as
+// they are, anything else is relative to /api/v1 (so "projects" and
+// "/api/v1/projects" name the same endpoint)
+func APIPath(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "api" || strings.HasPrefix(path, "api/") {
+		return "/" + path
+	}
+	return "/api/v1/" + path
+}
+
+// RawRequest sends an authenticated request to an arbitrary REST API
+// endpoint (see APIPath) and returns the response whatever its status, for
+// endpoints the client doesn't wrap. A JSON object or array body is sent as
+// application/json, any other as text/plain, which is what OpenGrok's
+// property and configuration endpoints take (so "4" stays a plain value).
+func (c *Client) RawRequest(method, path string, body []byte) (*RawResponse, error) {
+	return c.RawRequestContext(context.Background(), method, path, body)
+}
+
+// RawRequestContext is RawRequest with a context
+func (c *Client) RawRequestContext(ctx context.Context, method, path string, body []byte) (*RawResponse, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), c.APIURL(APIPath(path)), reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+			req.Header.Set("Content-Type", "application/json")
+		} else {
+			req.Header.Set("Content-Type", "text/plain")
+		}
+	}
+	if err := c.setAuthHeaders(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return &RawResponse{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       data,
+	}, nil
+}
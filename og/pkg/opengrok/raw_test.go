@@ -0,0 +1,56 @@
+package opengrok
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIPath(t *testing.T) {
+	tests := map[string]string{
+		"projects":             "/api/v1/projects",
+		"/projects":            "/api/v1/projects",
+		"/api/v1/projects":     "/api/v1/projects",
+		"api/v2/status":        "/api/v2/status",
+		"search?full=x":        "/api/v1/search?full=x",
+		"apis/not-an-api-root": "/api/v1/apis/not-an-api-root",
+	}
+	for in, want := range tests {
+		if got := APIPath(in); got != want {
+			t.Errorf("APIPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRawRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "PUT" || r.URL.Path != "/api/v1/projects/p/property/tabSize" || string(body) != "4" {
+			t.Errorf("got %s %s %q", r.Method, r.URL.Path, body)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "text/plain" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer tok" {
+			t.Errorf("Authorization = %q", auth)
+		}
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"error":"busy"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.BearerToken = "tok"
+	resp, err := client.RawRequest("put", "projects/p/property/tabSize", []byte("4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Error statuses are returned, not turned into errors
+	if resp.StatusCode != http.StatusConflict || string(resp.Body) != `{"error":"busy"}` {
+		t.Errorf("resp = %d %q", resp.StatusCode, resp.Body)
+	}
+}
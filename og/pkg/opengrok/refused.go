@@ -0,0 +1,146 @@
+package opengrok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Reasons a server refuses a search; match them with errors.Is
+var (
+	// ErrProjectRequired: the server won't search all projects at once
+	ErrProjectRequired = errors.New("the server requires projects to be selected")
+	// ErrQueryTooBroad: the query expands to more terms than the server
+	// allows (Lucene's maxClauseCount), typically a short wildcard prefix
+	ErrQueryTooBroad = errors.New("the query is too broad for the server")
+)
+
+// MaxProjectFanOut is the most projects SearchContext searches one by one
+// when the server requires projects and none were given
+const MaxProjectFanOut = 50
+
+// SearchRefusedError is a search the server refused as too broad, rather
+// than failed. Reason is ErrProjectRequired or ErrQueryTooBroad.
+type SearchRefusedError struct {
+	Reason     error
+	StatusCode int
+	Message    string // The server's explanation, as plain text
+	// Projects is the number of projects on the server when a search without
+	// projects could not be retried per project because there are too many
+	Projects int
+}
+
+func (e *SearchRefusedError) Error() string {
+	msg := e.Reason.Error()
+	if e.Projects > 0 {
+		msg += fmt.Sprintf(" (it has %d projects, too many to search one by one)", e.Projects)
+	}
+	if e.Message != "" {
+		msg += fmt.Sprintf(": %d: %s", e.StatusCode, e.Message)
+	}
+	return msg
+}
+
+func (e *SearchRefusedError) Unwrap() error {
+	return e.Reason
+}
+
+// refusalPatterns recognize refusals in the messages of OpenGrok releases
+// and the servlet containers and proxies in front of them, lowercased
+var refusalPatterns = []struct {
+	reason error
+	re     *regexp.Regexp
+}{
+	{ErrProjectRequired, regexp.MustCompile(`no projects? (were |was )?(specified|selected|given)|projects? (is |are )?(required|mandatory)|(select|specify|choose) (at least one |a )?project|search(ing)? (in |across )?all projects is (disabled|not allowed)|projects parameter is (required|missing|empty)`)},
+	{ErrQueryTooBroad, regexp.MustCompile(`toomanyclauses|too many (boolean )?clauses|maxclausecount|query (is )?too (broad|complex)|too many (terms|expansions)`)},
+}
+
+// htmlTitleRegex and htmlTagsRegex pull the text out of an HTML error page
+var (
+	htmlTitleRegex = regexp.MustCompile(`(?is)<title>(.*?)</title>`)
+	htmlTagsRegex  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// serverErrorMessage extracts the explanation from an error response body:
+// the "message" or "error" of a JSON body, or the text of an HTML page,
+// whitespace collapsed
+func serverErrorMessage(body []byte) string {
+	var payload struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		if payload.Message != "" {
+			return payload.Message
+		}
+		if payload.Error != "" {
+			return payload.Error
+		}
+	}
+	text := string(body)
+	if strings.Contains(text, "<") {
+		text = htmlTitleRegex.ReplaceAllString(text, "$1. ")
+		text = htmlTagsRegex.ReplaceAllString(text, " ")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// searchRefusal returns a SearchRefusedError if an error response says the
+// search was refused for its scope, else nil
+func searchRefusal(statusCode int, body []byte) *SearchRefusedError {
+	message := serverErrorMessage(body)
+	lower := strings.ToLower(message)
+	for _, p := range refusalPatterns {
+		if p.re.MatchString(lower) {
+			if len(message) > 300 {
+				message = message[:300] + "..."
+			}
+			return &SearchRefusedError{Reason: p.reason, StatusCode: statusCode, Message: message}
+		}
+	}
+	return nil
+}
+
+// searchEachProject runs a search the server refused for want of projects
+// once per project and merges the results, keeping the first
+// opts.MaxResults files. refused is returned if the projects can't be
+// listed or there are more than MaxProjectFanOut.
+func (c *Client) searchEachProject(ctx context.Context, opts SearchOptions, refused *SearchRefusedError) (*SearchResponse, error) {
+	projects, err := c.GetProjectsContext(ctx)
+	if err != nil || len(projects) == 0 {
+		return nil, refused
+	}
+	if len(projects) > MaxProjectFanOut {
+		tooMany := *refused
+		tooMany.Projects = len(projects)
+		return nil, &tooMany
+	}
+
+	merged := &SearchResponse{Results: map[string][]SearchResult{}, Entries: []ResultEntry{}}
+	files := make(map[string]bool)
+	for _, project := range projects {
+		opts.Projects = project
+		resp, err := c.searchOnce(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("searching project %s: %w", project, err)
+		}
+		merged.Time += resp.Time
+		merged.ResultCount += resp.ResultCount
+		for _, entry := range resp.OrderedEntries() {
+			key := entry.Project + "\x00" + entry.Path
+			if !files[key] {
+				if opts.MaxResults > 0 && len(files) >= opts.MaxResults {
+					continue
+				}
+				files[key] = true
+			}
+			merged.Entries = append(merged.Entries, entry)
+			merged.Results[entry.Project] = append(merged.Results[entry.Project], entry.SearchResult)
+		}
+	}
+	merged.EndDocument = len(files)
+	return merged, nil
+}
@@ -0,0 +1,143 @@
+package opengrok
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Error payloads seen from OpenGrok deployments: the REST API's JSON
+// errors, Tomcat's HTML error pages wrapping a Lucene exception, and plain
+// text from proxies
+var refusalPayloads = []struct {
+	name   string
+	status int
+	body   string
+	want   error
+}{
+	{"json project required", 400, `{"message":"No project specified, but search in all projects is disabled"}`, ErrProjectRequired},
+	{"json projects parameter", 400, `{"error":"projects parameter is required"}`, ErrProjectRequired},
+	{"text select project", 400, "Please select a project to search in.", ErrProjectRequired},
+	{"tomcat too many clauses", 500, `<!doctype html><html lang="en"><head><title>HTTP Status 500 – Internal Server Error</title></head><body><h1>HTTP Status 500 – Internal Server Error</h1><p><b>Message</b> org.apache.lucene.search.IndexSearcher$TooManyClauses: maxClauseCount is set to 1024</p></body></html>`, ErrQueryTooBroad},
+	{"json too many boolean clauses", 400, `{"message":"Too many boolean clauses"}`, ErrQueryTooBroad},
+	{"text query too broad", 503, "query is too broad; add a project or path filter", ErrQueryTooBroad},
+	{"unrelated json", 400, `{"message":"Cannot parse 'foo(': Encountered <EOF>"}`, nil},
+	{"unrelated html", 500, `<html><head><title>Error</title></head><body>NullPointerException</body></html>`, nil},
+}
+
+func TestSearchRefusal(t *testing.T) {
+	for _, p := range refusalPayloads {
+		refused := searchRefusal(p.status, []byte(p.body))
+		if p.want == nil {
+			if refused != nil {
+				t.Errorf("%s: refusal %v, want none", p.name, refused)
+			}
+			continue
+		}
+		if refused == nil || !errors.Is(refused, p.want) || refused.StatusCode != p.status {
+			t.Errorf("%s: refusal %v, want %v", p.name, refused, p.want)
+			continue
+		}
+		if strings.Contains(refused.Message, "<p>") {
+			t.Errorf("%s: markup left in message %q", p.name, refused.Message)
+		}
+	}
+	if got := serverErrorMessage([]byte(refusalPayloads[3].body)); !strings.HasPrefix(got, "HTTP Status 500 – Internal Server Error.") {
+		t.Errorf("serverErrorMessage(HTML) = %q", got)
+	}
+}
+
+func TestSearchRefusedErrors(t *testing.T) {
+	for _, p := range refusalPayloads {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(p.status)
+			w.Write([]byte(p.body))
+		}))
+		client, _ := NewClient(server.URL)
+		_, err := client.Search(SearchOptions{Full: "m*", Projects: "proj"})
+		server.Close()
+
+		var refused *SearchRefusedError
+		if isRefused := errors.As(err, &refused); isRefused != (p.want != nil) || (p.want != nil && !errors.Is(err, p.want)) {
+			t.Errorf("%s: error %v, want %v", p.name, err, p.want)
+		}
+		if p.want == nil && !strings.Contains(fmt.Sprint(err), fmt.Sprintf("status %d", p.status)) {
+			t.Errorf("%s: error %v, want the status", p.name, err)
+		}
+	}
+}
+
+func TestSearchRetriesPerProject(t *testing.T) {
+	var searches []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects":
+			w.Write([]byte(`["alpha","beta","gamma"]`))
+		case "/api/v1/search":
+			project := r.URL.Query().Get("projects")
+			searches = append(searches, project)
+			switch project {
+			case "":
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message":"No project specified, but search in all projects is disabled"}`))
+			case "gamma":
+				w.Write([]byte(`{"resultCount":0,"results":{}}`))
+			default:
+				fmt.Fprintf(w, `{"time":2,"resultCount":2,"results":{"/%[1]s/a.c":[{"line":"x","lineNumber":"1"},{"line":"y","lineNumber":"2"}],"/%[1]s/b.c":[{"line":"z","lineNumber":"3"}]}}`, project)
+			}
+		}
+	}))
+	defer server.Close()
+	client, _ := NewClient(server.URL)
+
+	resp, err := client.Search(SearchOptions{Full: "x", MaxResults: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(searches, ",") != ",alpha,beta,gamma" {
+		t.Errorf("searches = %q", searches)
+	}
+	// Three files are kept of the four found; hits in a kept file all stay
+	var got []string
+	for _, e := range resp.OrderedEntries() {
+		got = append(got, e.Project+e.Path+":"+string(e.LineNo))
+	}
+	if strings.Join(got, " ") != "alpha/a.c:1 alpha/a.c:2 alpha/b.c:3 beta/a.c:1 beta/a.c:2" {
+		t.Errorf("entries = %v", got)
+	}
+	if resp.ResultCount != 4 || resp.EndDocument != 3 || resp.Time != 4 || len(resp.Results["beta"]) != 2 {
+		t.Errorf("response = %+v", resp)
+	}
+
+	// Paging and explicit projects are not retried
+	searches = nil
+	if _, err := client.Search(SearchOptions{Full: "x", Start: 25}); !errors.Is(err, ErrProjectRequired) || len(searches) != 1 {
+		t.Errorf("paged search: %v after %q", err, searches)
+	}
+}
+
+func TestSearchTooManyProjectsToRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/projects" {
+			names := make([]string, MaxProjectFanOut+1)
+			for i := range names {
+				names[i] = fmt.Sprintf(`"p%d"`, i)
+			}
+			w.Write([]byte("[" + strings.Join(names, ",") + "]"))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"message":"projects parameter is required"}`))
+	}))
+	defer server.Close()
+	client, _ := NewClient(server.URL)
+
+	_, err := client.Search(SearchOptions{Full: "x"})
+	var refused *SearchRefusedError
+	if !errors.As(err, &refused) || refused.Projects != MaxProjectFanOut+1 || !strings.Contains(err.Error(), "51 projects") {
+		t.Errorf("error = %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package opengrok
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// errStopFiles ends a file stream early once the limit is reached
+var errStopFiles = errors.New("file limit reached")
+
+// fileRef holds just the fields needed to identify a result's file and
+// whether it is a line hit. Decoding into it skips the matched line content:
+// Line is kept raw, only to tell a hit from a path search's bare file.
+type fileRef struct {
+	Path      string          `json:"path"`
+	Directory string          `json:"directory"`
+	Filename  string          `json:"filename"`
+	Line      json.RawMessage `json:"line"`
+}
+
+// hitFunc is called for every result of a streamed page with the file it
+// belongs to and whether it is a line hit (path searches return files only)
+type hitFunc func(project, path string, line bool)
+
+// filePage describes one decoded page of streamed results
+type filePage struct {
+	ResultCount int // Total documents matching the query
+	Documents   int // Documents (result keys) in this page
+}
+
+// SearchFiles streams the paths of files matching opts, paging through the
+// results pageSize documents at a time. fn is called for each file as soon as
+// it is decoded; results are never collected, so memory use is bounded by a
+// single result however many files match. limit caps the number of files
+// (0 for no limit). Returns the number of files passed to fn.
+func (c *Client) SearchFiles(opts SearchOptions, pageSize, limit int, fn func(project, path string) error) (int, error) {
+	return c.SearchFilesContext(context.Background(), opts, pageSize, limit, fn)
+}
+
+// SearchFilesContext is SearchFiles with a context
+func (c *Client) SearchFilesContext(ctx context.Context, opts SearchOptions, pageSize, limit int, fn func(project, path string) error) (int, error) {
+	count := 0
+	opts.MaxResults = pageSize
+
+	for {
+		resp, err := c.doSearch(ctx, opts)
+		if err != nil {
+			return count, err
+		}
+		page, err := decodeFilePage(resp.Body, func(project, path string) error {
+			if limit > 0 && count >= limit {
+				return errStopFiles
+			}
+			count++
+			return fn(project, path)
+		}, nil)
+		resp.Body.Close()
+		if errors.Is(err, errStopFiles) {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		opts.Start += page.Documents
+		if page.Documents == 0 || opts.Start >= page.ResultCount || (limit > 0 && count >= limit) {
+			return count, nil
+		}
+	}
+}
+
+// MatchCount is the number of files and line hits matching a query in one
+// project
+type MatchCount struct {
+	Project string `json:"project"`
+	Files   int    `json:"files"`
+	Lines   int    `json:"lines"`
+}
+
+// CountMatches pages through every result matching opts, pageSize documents
+// at a time, and counts the matching files and line hits per project. Like
+// SearchFiles, it decodes only the fields identifying each result's file.
+// Counts are returned by project name; on error, the counts so far are
+// returned with it.
+func (c *Client) CountMatches(opts SearchOptions, pageSize int) ([]MatchCount, error) {
+	return c.CountMatchesContext(context.Background(), opts, pageSize)
+}
+
+// CountMatchesContext is CountMatches with a context
+func (c *Client) CountMatchesContext(ctx context.Context, opts SearchOptions, pageSize int) ([]MatchCount, error) {
+	counts := make(map[string]*MatchCount)
+	project := func(name string) *MatchCount {
+		if counts[name] == nil {
+			counts[name] = &MatchCount{Project: name}
+		}
+		return counts[name]
+	}
+	sorted := func() []MatchCount {
+		list := make([]MatchCount, 0, len(counts))
+		for _, c := range counts {
+			list = append(list, *c)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Project < list[j].Project })
+		return list
+	}
+
+	opts.MaxResults = pageSize
+	for {
+		resp, err := c.doSearch(ctx, opts)
+		if err != nil {
+			return sorted(), err
+		}
+		page, err := decodeFilePage(resp.Body, func(name, path string) error {
+			project(name).Files++
+			return nil
+		}, func(name, path string, line bool) {
+			if line {
+				project(name).Lines++
+			}
+		})
+		resp.Body.Close()
+		if err != nil {
+			return sorted(), fmt.Errorf("failed to parse response: %w", err)
+		}
+
+		opts.Start += page.Documents
+		if page.Documents == 0 || opts.Start >= page.ResultCount {
+			return sorted(), nil
+		}
+	}
+}
+
+// decodeFilePage decodes a search response as a stream, calling fn for each
+// distinct file, and hit (if not nil) for each result, without holding more
+// than one result in memory
+func decodeFilePage(r io.Reader, fn func(project, path string) error, hit hitFunc) (filePage, error) {
+	var page filePage
+	dec := json.NewDecoder(r)
+
+	if err := expectDelim(dec, '{'); err != nil {
+		return page, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return page, err
+		}
+		switch tok {
+		case "resultCount":
+			if err := dec.Decode(&page.ResultCount); err != nil {
+				return page, err
+			}
+		case "results":
+			if page.Documents, err = decodeResultFiles(dec, fn, hit); err != nil {
+				return page, err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return page, err
+			}
+		}
+	}
+	return page, nil
+}
+
+// decodeResultFiles decodes the "results" object, returning the number of keys.
+// Keys are normally "/project/path" (one per file); keys that are bare project
+// names group several files, so paths are de-duplicated per key.
+func decodeResultFiles(dec *json.Decoder, fn func(project, path string) error, hit hitFunc) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	if tok == nil {
+		return 0, nil // "results": null
+	}
+	if tok != json.Delim('{') {
+		return 0, fmt.Errorf("unexpected results value %v", tok)
+	}
+
+	keys := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return keys, fmt.Errorf("unexpected results key %v", tok)
+		}
+		keys++
+
+		project, keyPath := parseResultKey(key)
+		if project == "" {
+			project = key
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return keys, err
+		}
+		seen := make(map[string]bool)
+		for dec.More() {
+			var ref fileRef
+			if err := dec.Decode(&ref); err != nil {
+				return keys, err
+			}
+			path := normalizeResultPath(project, keyPath, SearchResult{
+				Path:      ref.Path,
+				Directory: ref.Directory,
+				Filename:  ref.Filename,
+			})
+			if path == "" {
+				continue
+			}
+			if hit != nil {
+				hit(project, path, len(ref.Line) > 0 && string(ref.Line) != `""` && string(ref.Line) != "null")
+			}
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if err := fn(project, path); err != nil {
+				return keys, err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return keys, err
+		}
+	}
+	return keys, expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and checks it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
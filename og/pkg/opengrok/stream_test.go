@@ -0,0 +1,154 @@
+package opengrok
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeFilePage(t *testing.T) {
+	body := `{
+		"time": 12,
+		"results": {
+			"/proj/src/a.c": [
+				{"line": "first match", "lineNumber": "1", "path": "/proj/src/a.c"},
+				{"line": "second match", "lineNumber": "9", "path": "/proj/src/a.c"}
+			],
+			"other": [
+				{"line": "x", "lineNo": "3", "directory": "/other/lib", "filename": "b.go"},
+				{"line": "y", "lineNo": "4", "directory": "/other/lib", "filename": "b.go"},
+				{"line": "z", "lineNo": "5", "directory": "/other/lib", "filename": "c.go"}
+			]
+		},
+		"resultCount": 40,
+		"startDocument": 0,
+		"endDocument": 1
+	}`
+
+	var got []string
+	page, err := decodeFilePage(strings.NewReader(body), func(project, path string) error {
+		got = append(got, project+path)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("decodeFilePage failed: %v", err)
+	}
+	want := []string{"proj/src/a.c", "other/lib/b.go", "other/lib/c.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if page.ResultCount != 40 || page.Documents != 2 {
+		t.Errorf("page = %+v, want ResultCount 40, Documents 2", page)
+	}
+}
+
+func TestDecodeFilePageNullResults(t *testing.T) {
+	page, err := decodeFilePage(strings.NewReader(`{"resultCount": 0, "results": null}`), func(string, string) error {
+		t.Error("unexpected file")
+		return nil
+	}, nil)
+	if err != nil || page.Documents != 0 {
+		t.Errorf("got %+v, %v", page, err)
+	}
+}
+
+// newPagedSearchServer serves total files in pages, recording requested starts
+func newPagedSearchServer(t *testing.T, total int, starts *[]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		max, _ := strconv.Atoi(r.URL.Query().Get("maxresults"))
+		*starts = append(*starts, start)
+
+		var entries []string
+		for i := start; i < start+max && i < total; i++ {
+			path := fmt.Sprintf("/proj/f%03d.c", i)
+			entries = append(entries, fmt.Sprintf(`%q: [{"line": "match", "lineNumber": "1", "path": %q}]`, path, path))
+		}
+		fmt.Fprintf(w, `{"resultCount": %d, "results": {%s}}`, total, strings.Join(entries, ","))
+	}))
+}
+
+func TestSearchFilesPages(t *testing.T) {
+	var starts []int
+	server := newPagedSearchServer(t, 25, &starts)
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	count, err := client.SearchFiles(SearchOptions{Full: "x"}, 10, 0, func(project, path string) error {
+		files = append(files, project+path)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if count != 25 || len(files) != 25 || files[0] != "proj/f000.c" || files[24] != "proj/f024.c" {
+		t.Errorf("got %d files: %v", count, files)
+	}
+	if !reflect.DeepEqual(starts, []int{0, 10, 20}) {
+		t.Errorf("requested starts = %v, want [0 10 20]", starts)
+	}
+}
+
+func TestSearchFilesLimit(t *testing.T) {
+	var starts []int
+	server := newPagedSearchServer(t, 100, &starts)
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := client.SearchFiles(SearchOptions{Full: "x"}, 10, 15, func(string, string) error { return nil })
+	if err != nil {
+		t.Fatalf("SearchFiles failed: %v", err)
+	}
+	if count != 15 {
+		t.Errorf("count = %d, want 15", count)
+	}
+	if len(starts) != 2 {
+		t.Errorf("expected 2 page requests, got %v", starts)
+	}
+}
+
+func TestCountMatches(t *testing.T) {
+	var starts []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		starts = append(starts, start)
+		if start == 0 {
+			fmt.Fprint(w, `{"resultCount": 3, "results": {
+				"/proj/a.c": [{"line": "x()", "lineNumber": "1"}, {"line": "y = x", "lineNumber": "9"}],
+				"/other/b.c": [{"line": "x()", "lineNumber": "4"}]}}`)
+			return
+		}
+		// A path search style hit: the file without a matched line
+		fmt.Fprint(w, `{"resultCount": 3, "results": {"/proj/c.c": [{"line": "", "path": "/c.c"}]}}`)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts, err := client.CountMatches(SearchOptions{Full: "x"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MatchCount{{Project: "other", Files: 1, Lines: 1}, {Project: "proj", Files: 2, Lines: 2}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+	if !reflect.DeepEqual(starts, []int{0, 2}) {
+		t.Errorf("requested starts = %v, want [0 2]", starts)
+	}
+}
@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxAliasSearches bounds the extra searches one expansion makes for a
+// symbol's aliases and wrapper macros
+const maxAliasSearches = 8
+
+// defineRegex matches a #define, capturing the macro name and its body
+var defineRegex = regexp.MustCompile(`^\s*#\s*define\s+([A-Za-z_]\w*)(?:\([^)]*\))?(.*)$`)
+
+// aliasGroups links each name in aliases (alias name to the symbol it stands
+// for) to every other name it is transitively an alias of, in both
+// directions: tracing either name follows the callers of the others
+func aliasGroups(aliases map[string]string) map[string][]string {
+	adjacent := make(map[string][]string)
+	for alias, symbol := range aliases {
+		if alias == "" || symbol == "" || alias == symbol {
+			continue
+		}
+		adjacent[alias] = append(adjacent[alias], symbol)
+		adjacent[symbol] = append(adjacent[symbol], alias)
+	}
+
+	groups := make(map[string][]string)
+	for name := range adjacent {
+		seen := map[string]bool{name: true}
+		queue := []string{name}
+		var group []string
+		for len(queue) > 0 {
+			next := queue[0]
+			queue = queue[1:]
+			for _, n := range adjacent[next] {
+				if !seen[n] {
+					seen[n] = true
+					group = append(group, n)
+					queue = append(queue, n)
+				}
+			}
+		}
+		sort.Strings(group)
+		groups[name] = group
+	}
+	return groups
+}
+
+// ParseWrapperMacro returns the name of the macro whose #define starts at
+// lines[0] and continues over backslash-continued lines, if its body uses
+// symbol (e.g. "#define foo(x) bar(x)" wraps bar), or ""
+func ParseWrapperMacro(lines []string, symbol string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	m := defineRegex.FindStringSubmatch(lines[0])
+	if m == nil || m[1] == symbol {
+		return ""
+	}
+	body := m[2]
+	for i := 1; strings.HasSuffix(strings.TrimSpace(body), `\`) && i < len(lines); i++ {
+		body = strings.TrimSuffix(strings.TrimSpace(body), `\`) + " " + lines[i]
+	}
+	if !regexp.MustCompile(`\b` + regexp.QuoteMeta(symbol) + `\b`).MatchString(body) {
+		return ""
+	}
+	return m[1]
+}
+
+// wrapperMacro returns the macro a hit defines around symbol, or "". With
+// the file at hand (useXref), multi-line macros are recognized from any of
+// their lines; otherwise only from the hit line itself.
+func (e *Explorer) wrapperMacro(ctx context.Context, h Hit, symbol string, useXref bool) string {
+	if !useXref {
+		return ParseWrapperMacro([]string{h.Line}, symbol)
+	}
+	lineNo, _ := strconv.Atoi(h.LineNo)
+	lines, err := e.fileLines(ctx, h.FilePath)
+	if err != nil || lineNo < 1 || lineNo > len(lines) {
+		return ParseWrapperMacro([]string{h.Line}, symbol)
+	}
+	// Back up to the #define over the continued lines before the hit
+	start := lineNo - 1
+	for start > 0 && strings.HasSuffix(strings.TrimSpace(lines[start-1]), `\`) {
+		start--
+	}
+	return ParseWrapperMacro(lines[start:], symbol)
+}
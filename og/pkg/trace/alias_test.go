@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseWrapperMacro(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{[]string{"#define VN_RELE(vp) vn_rele(vp)"}, "VN_RELE"},
+		{[]string{"  #  define kfree_old kfree"}, "kfree_old"},
+		{[]string{"#define LOCK(m) \\", "\tdo { \\", "\t\tmutex_enter(m); \\", "\t} while (0)"}, "LOCK"},
+		{[]string{"#define LOCK(m) \\", "\tdo { } while (0)", "mutex_enter(m);"}, ""},
+		{[]string{"#define vn_rele(vp) vn_rele_impl(vp)"}, ""}, // Defines the symbol itself
+		{[]string{"#define VN_HOLD(vp) vn_hold(vp)"}, ""},
+		{[]string{"#define VN_RELE(vp) vn_rele_async(vp)"}, ""}, // Not a whole word
+		{[]string{"vn_rele(vp);"}, ""},
+	}
+	for _, tt := range tests {
+		symbol := "vn_rele"
+		if strings.Contains(tt.lines[0], "kfree") {
+			symbol = "kfree"
+		} else if strings.Contains(tt.lines[0], "LOCK") {
+			symbol = "mutex_enter"
+		}
+		if got := ParseWrapperMacro(tt.lines, symbol); got != tt.want {
+			t.Errorf("ParseWrapperMacro(%q, %s) = %q, want %q", tt.lines, symbol, got, tt.want)
+		}
+	}
+}
+
+func TestAliasGroups(t *testing.T) {
+	groups := aliasGroups(map[string]string{"old": "new", "older": "old", "x": "x"})
+	want := map[string][]string{
+		"new":   {"old", "older"},
+		"old":   {"new", "older"},
+		"older": {"new", "old"},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("aliasGroups() = %v, want %v", groups, want)
+	}
+}
+
+// newMacroSource models vn_rele() called directly from a.c and through
+// VN_RELE(), a multi-line wrapper macro, which is wrapped by VN_RELE_ALL()
+func newMacroSource() *fakeSource {
+	return &fakeSource{
+		refs: map[string][]Hit{
+			"vn_rele":     {{FilePath: "/p/a.c", LineNo: "2"}, {FilePath: "/p/vnode.h", LineNo: "3"}},
+			"VN_RELE":     {{FilePath: "/p/b.c", LineNo: "2"}, {FilePath: "/p/vnode.h", LineNo: "5", Line: "#define VN_RELE_ALL(v) VN_RELE(v[0])"}},
+			"VN_RELE_ALL": {{FilePath: "/p/c.c", LineNo: "2"}},
+		},
+		files: map[string]string{
+			"/p/a.c":     "void close_a(void) {\n\tvn_rele(vp);\n}\n",
+			"/p/b.c":     "void close_b(void) {\n\tVN_RELE(vp);\n}\n",
+			"/p/c.c":     "void close_c(void) {\n\tVN_RELE_ALL(vps);\n}\n",
+			"/p/vnode.h": "#define VN_RELE(vp) \\\n\tdo { \\\n\t\tvn_rele(vp); \\\n\t} while (0)\n#define VN_RELE_ALL(v) VN_RELE(v[0])\n",
+		},
+	}
+}
+
+func TestTraceFollowsWrapperMacros(t *testing.T) {
+	src := newMacroSource()
+	result, err := Trace(context.Background(), src, Options{Symbol: "vn_rele", Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, child := range result.Root.Children {
+		got = append(got, child.Symbol+" via "+child.Via)
+	}
+	want := []string{"close_a via ", "close_b via VN_RELE", "close_c via VN_RELE_ALL"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("callers = %q, want %q", got, want)
+	}
+	if want := "vn_rele@ VN_RELE@ VN_RELE_ALL@"; !strings.HasPrefix(strings.Join(src.searches, " "), want) {
+		t.Errorf("searches = %v, want prefix %s", src.searches, want)
+	}
+}
+
+func TestTraceFollowsMacrosWithoutFileFetches(t *testing.T) {
+	// At depth 1 files are not fetched, so only one-line #defines are seen
+	src := newMacroSource()
+	src.refs["vn_rele"] = append(src.refs["vn_rele"], Hit{FilePath: "/p/compat.h", LineNo: "1", Line: "#define VN_RELE(vp) vn_rele(vp)"})
+	result, err := Trace(context.Background(), src, Options{Symbol: "vn_rele", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, child := range result.Root.Children {
+		if child.FilePath == "/p/compat.h" {
+			t.Errorf("the #define is listed as a caller: %+v", child)
+		}
+	}
+	if len(result.Root.Children) != 4 {
+		t.Errorf("expected the multi-line #define, a.c and both macro callers, got %d children", len(result.Root.Children))
+	}
+}
+
+func TestTraceFollowsAliases(t *testing.T) {
+	// old_free() is a wrapper function given as an alias of kfree()
+	src := &fakeSource{
+		refs: map[string][]Hit{
+			"kfree":    {{FilePath: "/p/a.c", LineNo: "2"}, {FilePath: "/p/compat.c", LineNo: "2"}},
+			"old_free": {{FilePath: "/p/b.c", LineNo: "2"}},
+		},
+		files: map[string]string{
+			"/p/a.c":      "void new_user(void) {\n\tkfree(p);\n}\n",
+			"/p/b.c":      "void old_user(void) {\n\told_free(p);\n}\n",
+			"/p/compat.c": "void old_free(void *p) {\n\tkfree(p);\n}\n",
+		},
+	}
+	result, err := Trace(context.Background(), src, Options{Symbol: "kfree", Depth: 2, Aliases: map[string]string{"old_free": "kfree"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, child := range result.Root.Children {
+		got = append(got, child.Symbol+" via "+child.Via)
+	}
+	// The wrapper's own body is left out; its callers are listed directly
+	if want := []string{"new_user via ", "old_user via old_free"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("callers = %q, want %q", got, want)
+	}
+
+	// The alias works from the other name too
+	src.searches = nil
+	if _, err := Trace(context.Background(), src, Options{Symbol: "old_free", Depth: 1, Aliases: map[string]string{"old_free": "kfree"}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "old_free@ kfree@"; strings.Join(src.searches, " ") != want {
+		t.Errorf("searches = %v, want %s", src.searches, want)
+	}
+}
@@ -0,0 +1,261 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// caller holds extracted caller information
+type caller struct {
+	Symbol   string
+	FilePath string
+	LineNo   string
+	DefLine  int
+	// Macro is set instead of Symbol when the hit is in the #define of a
+	// macro wrapping the searched symbol; its callers call the symbol too
+	Macro string
+	// Via is the alias or macro searched to find this caller, if not the
+	// symbol itself
+	Via string
+}
+
+// extractCallers extracts caller information from search hits
+// If useXref is true, fetches surrounding context to determine enclosing function names
+// This enables depth > 1 traversal but is slower due to additional API calls
+func (e *Explorer) extractCallers(ctx context.Context, hits []Hit, searchedSymbol string, useXref bool) []caller {
+	var callers []caller
+	seen := make(map[string]bool)
+
+	for _, h := range hits {
+		if h.LineNo == "" || h.LineNo == "0" || h.FilePath == "" {
+			continue
+		}
+
+		// Create a unique key for this location
+		key := h.FilePath + ":" + h.LineNo
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// Skipped before any file fetch, which excluded files don't need
+		if Excluded(h.FilePath, e.opts.Exclude) {
+			e.result.Skipped++
+			continue
+		}
+
+		if macro := e.wrapperMacro(ctx, h, searchedSymbol, useXref); macro != "" {
+			callers = append(callers, caller{FilePath: h.FilePath, LineNo: h.LineNo, Macro: macro})
+			continue
+		}
+
+		var symbol string
+		var defLine int
+		if useXref {
+			// Fetch surrounding context to find enclosing function
+			// This is slower but enables multi-level traversal
+			lineNoInt := 0
+			fmt.Sscanf(h.LineNo, "%d", &lineNoInt)
+			if lineNoInt > 0 {
+				symbol, defLine = e.enclosingFunction(ctx, h.FilePath, lineNoInt)
+			}
+		}
+
+		// Fallback to simple line-based extraction if xref didn't work
+		if symbol == "" {
+			symbol = extractSymbolFromLine(h.Line, searchedSymbol)
+		}
+
+		callers = append(callers, caller{
+			Symbol:   symbol,
+			FilePath: h.FilePath,
+			LineNo:   h.LineNo,
+			DefLine:  defLine,
+		})
+	}
+
+	return callers
+}
+
+// extractSymbolFromLine attempts to extract a caller function name from a source line
+// This is a heuristic approach - we look for patterns that suggest function calls
+// Returns empty string if no caller can be identified
+//
+// LIMITATION: The basic OpenGrok search API only returns the line where a symbol
+// is referenced, not the enclosing function name. To find the enclosing function,
+// we would need to:
+//  1. Fetch surrounding lines using OpenGrok's xref API
+//  2. Parse backwards to find the function signature
+//  3. Handle complex cases (nested functions, macros, etc.)
+//
+// For now, this returns empty string, which means --depth > 1 will not traverse
+// beyond direct callers. Future enhancement: use xref API for context.
+func extractSymbolFromLine(line, searchedSymbol string) string {
+	cleaned := strings.TrimSpace(line)
+
+	// Skip obvious non-caller patterns
+	lowerLine := strings.ToLower(cleaned)
+	if strings.HasPrefix(lowerLine, "//") || strings.HasPrefix(lowerLine, "/*") ||
+		strings.HasPrefix(lowerLine, "*") || strings.HasPrefix(lowerLine, "#") {
+		return "" // Comment or preprocessor
+	}
+
+	// TODO: Implement function name extraction using OpenGrok xref API
+	// For now, return empty - the file:line location is still useful
+	return ""
+}
+
+// enclosingFunction fetches surrounding source lines and parses backwards to
+// find the enclosing function name and the line it is defined on.
+// Files are cached for the explorer's lifetime, as callers cluster in files.
+func (e *Explorer) enclosingFunction(ctx context.Context, filePath string, lineNo int) (string, int) {
+	// Fetch lines around the target line (look back up to 100 lines)
+	startLine := lineNo - 100
+	if startLine < 1 {
+		startLine = 1
+	}
+
+	lines, err := e.fileLines(ctx, filePath)
+	if err != nil {
+		// If we can't fetch context, return empty
+		return "", 0
+	}
+
+	// Extract the range we need from the cached full file
+	// Lines are 1-indexed, array is 0-indexed
+	var contextLines []string
+	for i := startLine - 1; i < lineNo && i < len(lines); i++ {
+		if i >= 0 {
+			contextLines = append(contextLines, lines[i])
+		}
+	}
+
+	// Parse backwards to find function definition
+	funcName, idx := ParseFunctionDef(contextLines)
+	if funcName == "" {
+		return "", 0
+	}
+	return funcName, startLine + idx
+}
+
+// fileLines returns the lines of a file, fetching the entire file once and
+// caching it (more efficient than many small requests)
+func (e *Explorer) fileLines(ctx context.Context, filePath string) ([]string, error) {
+	if lines, found := e.fileCache[filePath]; found {
+		return lines, nil
+	}
+	lines, err := e.src.FileLines(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	e.fileCache[filePath] = lines
+	return lines, nil
+}
+
+// parseFunctionName parses source lines backwards to find the enclosing function
+// Handles C/C++ function definitions with patterns like:
+//
+//	return_type function_name(params) {
+//	type* function_name(params) {
+//	static inline type function_name(params) {
+func parseFunctionName(lines []string) string {
+	name, _ := ParseFunctionDef(lines)
+	return name
+}
+
+// ParseFunctionDef parses source lines backwards to find the enclosing C/C++
+// function, returning its name and the index in lines of the definition
+// (-1 if not found)
+func ParseFunctionDef(lines []string) (string, int) {
+	// Work backwards from the last line
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i] // Keep original indentation for analysis
+		trimmed := strings.TrimSpace(line)
+
+		// Skip empty lines, comments, and preprocessor
+		if trimmed == "" || strings.HasPrefix(trimmed, "//") ||
+			strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*") ||
+			strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// Function definitions start at column 0 or with minimal indentation
+		// Skip lines that are clearly inside a function body (indented)
+		leadingSpaces := len(line) - len(strings.TrimLeft(line, " \t"))
+		if leadingSpaces > 1 {
+			continue // Too indented to be a function definition
+		}
+
+		// Skip lines that look like function calls or statements, not definitions:
+		// - Lines starting with "if", "for", "while", "return", etc.
+		// - Lines containing "=" before "(" (assignments)
+		// - Lines containing ";" (statements)
+		if strings.Contains(trimmed, ";") {
+			continue
+		}
+		// Look for function definition pattern: identifier followed by (
+		parenIdx := strings.Index(trimmed, "(")
+		if parenIdx == -1 {
+			continue
+		}
+		// Skip assignments where = appears before (
+		if eqIdx := strings.Index(trimmed, "="); eqIdx != -1 && eqIdx < parenIdx {
+			continue
+		}
+
+		// Extract tokens before the (
+		before := trimmed[:parenIdx]
+		tokens := strings.Fields(before)
+
+		if len(tokens) == 0 {
+			continue
+		}
+
+		// The last token before ( is likely the function name
+		funcName := tokens[len(tokens)-1]
+
+		// Clean up any pointer/reference markers (from either side)
+		funcName = strings.Trim(funcName, "*&")
+
+		// Skip common keywords that aren't function names
+		if isCommonKeyword(funcName) {
+			continue
+		}
+
+		// Skip if it looks like a macro or type cast
+		if strings.ToUpper(funcName) == funcName && len(funcName) > 2 {
+			continue // ALL_CAPS likely a macro
+		}
+
+		// For a function definition, the opening brace should be on this line
+		// or within the next few lines (for multi-line parameter lists)
+		if strings.Contains(trimmed, "{") {
+			return funcName, i
+		}
+
+		// Look ahead a few lines for opening brace (multi-line params)
+		for j := i + 1; j < len(lines) && j < i+10; j++ {
+			nextLine := strings.TrimSpace(lines[j])
+			// If we hit another function-like pattern, stop looking
+			if strings.Contains(nextLine, ";") && !strings.Contains(nextLine, "{") {
+				break
+			}
+			if strings.HasPrefix(nextLine, "{") || strings.Contains(nextLine, ")") && strings.Contains(nextLine, "{") {
+				return funcName, i
+			}
+		}
+	}
+
+	return "", -1
+}
+
+// isCommonKeyword returns true if s is a common C/C++ keyword or construct
+func isCommonKeyword(s string) bool {
+	keywords := map[string]bool{
+		"if": true, "for": true, "while": true, "switch": true,
+		"return": true, "sizeof": true, "typeof": true, "struct": true,
+		"union": true, "enum": true, "case": true, "do": true,
+	}
+	return keywords[s]
+}
@@ -0,0 +1,266 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExtractSymbolFromLine(t *testing.T) {
+	tests := []struct {
+		name           string
+		line           string
+		searchedSymbol string
+		expected       string
+	}{
+		{
+			name:           "comment line",
+			line:           "// This calls malloc for allocation",
+			searchedSymbol: "malloc",
+			expected:       "",
+		},
+		{
+			name:           "block comment",
+			line:           "/* malloc is used here */",
+			searchedSymbol: "malloc",
+			expected:       "",
+		},
+		{
+			name:           "preprocessor directive",
+			line:           "#define USE_MALLOC 1",
+			searchedSymbol: "malloc",
+			expected:       "",
+		},
+		{
+			name:           "normal code line",
+			line:           "    ptr = malloc(size);",
+			searchedSymbol: "malloc",
+			expected:       "", // Current implementation returns empty
+		},
+		{
+			name:           "html tags stripped",
+			line:           "    ptr = <b>malloc</b>(size);",
+			searchedSymbol: "malloc",
+			expected:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := extractSymbolFromLine(tt.line, tt.searchedSymbol)
+			if result != tt.expected {
+				t.Errorf("got %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func newTestExplorer(src Source) *Explorer {
+	return &Explorer{src: src, fileCache: make(map[string][]string)}
+}
+
+func TestExtractCallers(t *testing.T) {
+	hits := []Hit{
+		{Line: "ptr = malloc(size);", LineNo: "42", FilePath: "/project/src/file1.c"},
+		{Line: "buf = malloc(len);", LineNo: "100", FilePath: "/project/src/file1.c"},
+		{Line: "data = malloc(n);", LineNo: "50", FilePath: "/project/src/file2.c"},
+	}
+
+	// Without xref the source is never used
+	callers := newTestExplorer(nil).extractCallers(context.Background(), hits, "malloc", false)
+
+	// Should have 3 unique callers
+	if len(callers) != 3 {
+		t.Errorf("Expected 3 callers, got %d", len(callers))
+	}
+
+	want := map[string]bool{
+		"/project/src/file1.c:42":  false,
+		"/project/src/file1.c:100": false,
+		"/project/src/file2.c:50":  false,
+	}
+	for _, c := range callers {
+		want[c.FilePath+":"+c.LineNo] = true
+	}
+	for loc, found := range want {
+		if !found {
+			t.Errorf("Expected to find %s", loc)
+		}
+	}
+}
+
+func TestExtractCallersDeduplication(t *testing.T) {
+	hits := []Hit{
+		{Line: "call1", LineNo: "42", FilePath: "/project/src/file.c"},
+		{Line: "call2", LineNo: "42", FilePath: "/project/src/file.c"}, // Same line number - should be deduplicated
+	}
+
+	callers := newTestExplorer(nil).extractCallers(context.Background(), hits, "test", false)
+
+	// Should only have 1 caller after deduplication
+	if len(callers) != 1 {
+		t.Errorf("Expected 1 caller after deduplication, got %d", len(callers))
+	}
+}
+
+func TestExtractCallersSkipsInvalidLineNumbers(t *testing.T) {
+	hits := []Hit{
+		{Line: "valid", LineNo: "42", FilePath: "/project/src/file.c"},
+		{Line: "empty", LineNo: "", FilePath: "/project"}, // Should be skipped
+		{Line: "zero", LineNo: "0", FilePath: "/project"}, // Should be skipped
+		{Line: "no path", LineNo: "7"},                    // Should be skipped
+		{Line: "another valid", LineNo: "100", FilePath: "/project/src/file.c"},
+	}
+
+	callers := newTestExplorer(nil).extractCallers(context.Background(), hits, "test", false)
+
+	// Should only have 2 callers (skipping empty and "0" line numbers)
+	if len(callers) != 2 {
+		t.Errorf("Expected 2 valid callers, got %d", len(callers))
+	}
+}
+
+func TestExtractCallersFindsEnclosingFunction(t *testing.T) {
+	src := &fakeSource{files: map[string]string{
+		"/project/drv.c": "void driver_init(void) {\n\tint x;\n\tprobe();\n}\n",
+	}}
+	hits := []Hit{{Line: "probe();", LineNo: "3", FilePath: "/project/drv.c"}}
+
+	callers := newTestExplorer(src).extractCallers(context.Background(), hits, "probe", true)
+	if len(callers) != 1 || callers[0].Symbol != "driver_init" || callers[0].DefLine != 1 {
+		t.Errorf("extractCallers() = %+v, want driver_init defined on line 1", callers)
+	}
+}
+
+func TestParseFunctionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []string
+		expected string
+	}{
+		{
+			name: "simple function",
+			lines: []string{
+				"int calculate_sum(int a, int b) {",
+				"    return a + b;",
+			},
+			expected: "calculate_sum",
+		},
+		{
+			name: "function with return type on separate line",
+			lines: []string{
+				"static void",
+				"process_data(void *ptr) {",
+				"    // processing",
+			},
+			expected: "process_data",
+		},
+		{
+			name: "function with pointer return type",
+			lines: []string{
+				"char *get_name(void) {",
+				"    return \"test\";",
+			},
+			expected: "get_name",
+		},
+		{
+			name: "function with multiple qualifiers",
+			lines: []string{
+				"static inline int compute_value(int x) {",
+				"    return x * 2;",
+			},
+			expected: "compute_value",
+		},
+		{
+			name: "function definition with opening brace on next line",
+			lines: []string{
+				"void helper_function(void)",
+				"{",
+				"    // code",
+			},
+			expected: "helper_function",
+		},
+		{
+			name: "skip if statement",
+			lines: []string{
+				"if (condition) {",
+				"    do_something();",
+			},
+			expected: "",
+		},
+		{
+			name: "skip for loop",
+			lines: []string{
+				"for (int i = 0; i < 10; i++) {",
+				"    process(i);",
+			},
+			expected: "",
+		},
+		{
+			name: "empty lines",
+			lines: []string{
+				"",
+				"",
+				"",
+			},
+			expected: "",
+		},
+		{
+			name: "comments only",
+			lines: []string{
+				"// This is a comment",
+				"/* Block comment */",
+				"* Another comment line",
+			},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parseFunctionName(tt.lines)
+			if result != tt.expected {
+				t.Errorf("got %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseFunctionDefIndex(t *testing.T) {
+	lines := []string{
+		"#include <stdio.h>",
+		"",
+		"static int helper(int x)",
+		"{",
+		"\treturn x + 1;",
+	}
+	name, idx := ParseFunctionDef(lines)
+	if name != "helper" || idx != 2 {
+		t.Errorf("ParseFunctionDef() = %q, %d; want %q, 2", name, idx, "helper")
+	}
+}
+
+func TestIsCommonKeyword(t *testing.T) {
+	tests := []struct {
+		word     string
+		expected bool
+	}{
+		{"if", true},
+		{"for", true},
+		{"while", true},
+		{"return", true},
+		{"sizeof", true},
+		{"struct", true},
+		{"my_function", false},
+		{"calculate", false},
+		{"process_data", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.word, func(t *testing.T) {
+			result := isCommonKeyword(tt.word)
+			if result != tt.expected {
+				t.Errorf("isCommonKeyword(%q) = %v, want %v", tt.word, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Definition is a place where a traced symbol is defined
+type Definition struct {
+	FilePath string `json:"filePath"` // "/project/path", as in Node.FilePath
+	LineNo   string `json:"lineNo"`
+	Line     string `json:"line"` // Source line, usually the signature
+}
+
+// String formats a definition as "/project/path:line"
+func (d Definition) String() string {
+	return d.FilePath + ":" + d.LineNo
+}
+
+// AmbiguousDefinitionError is returned by Trace and NewExplorer when the
+// symbol is defined in more than one place and no definition path was given
+// to pick one
+type AmbiguousDefinitionError struct {
+	Symbol     string
+	Candidates []Definition
+}
+
+func (e *AmbiguousDefinitionError) Error() string {
+	paths := make([]string, len(e.Candidates))
+	for i, c := range e.Candidates {
+		paths[i] = c.String()
+	}
+	return fmt.Sprintf("%s has %d definitions (%s); choose one by path", e.Symbol, len(e.Candidates), strings.Join(paths, ", "))
+}
+
+// FindDefinitions runs a definition search for symbol and returns the distinct
+// definition sites in search order
+func FindDefinitions(ctx context.Context, src Source, symbol, projects, fileType string) ([]Definition, error) {
+	hits, err := src.Definitions(ctx, symbol, projects, fileType, searchBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	var defs []Definition
+	seen := make(map[string]bool)
+	for _, h := range hits {
+		if h.FilePath == "" {
+			continue
+		}
+		def := Definition{
+			FilePath: h.FilePath,
+			LineNo:   h.LineNo,
+			Line:     strings.TrimSpace(h.Line),
+		}
+		if seen[def.String()] {
+			continue
+		}
+		seen[def.String()] = true
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
+
+// selectDefinition picks the definition to trace. defPath, if set, selects
+// the candidates whose path contains it. Returns nil (no restriction) when the
+// symbol has no known definition.
+func selectDefinition(symbol string, defs []Definition, defPath string) (*Definition, error) {
+	candidates := defs
+	if defPath != "" {
+		candidates = nil
+		for _, d := range defs {
+			if strings.Contains(d.FilePath, defPath) || strings.Contains(d.String(), defPath) {
+				candidates = append(candidates, d)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("no definition of %s matches --def-path %q", symbol, defPath)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &candidates[0], nil
+	default:
+		return nil, &AmbiguousDefinitionError{Symbol: symbol, Candidates: candidates}
+	}
+}
+
+// pathProximity returns the number of leading path components two file paths
+// share (the project counts as the first component)
+func pathProximity(a, b string) int {
+	partsA := strings.Split(strings.Trim(a, "/"), "/")
+	partsB := strings.Split(strings.Trim(b, "/"), "/")
+	n := 0
+	for n < len(partsA) && n < len(partsB) && partsA[n] == partsB[n] {
+		n++
+	}
+	return n
+}
+
+// nearestToDefinition reports whether a caller file is at least as close to
+// the chosen definition as to any other definition of the same name. Callers
+// closer to another definition most likely call that one instead.
+func nearestToDefinition(callerPath string, chosen *Definition, defs []Definition) bool {
+	best := pathProximity(callerPath, chosen.FilePath)
+	for _, d := range defs {
+		if d.FilePath != chosen.FilePath && pathProximity(callerPath, d.FilePath) > best {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package trace
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultExcludes are the path patterns og leaves out of traces unless told
+// otherwise: call sites in test harnesses and generated code rarely matter
+// and can easily outnumber the real callers
+var DefaultExcludes = []string{"*_test.go", "/test/", "/generated/", "*.pb.c"}
+
+// Excluded reports whether a "/project/path" file matches one of patterns.
+// A pattern without wildcards matches as a substring (e.g. "/test/" for
+// every test directory). A pattern with wildcards (*, ?, [...]) matches the
+// file name, or with a slash in it, the end of the path (e.g. "gen/*.c").
+func Excluded(filePath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if !strings.ContainsAny(pattern, "*?[") {
+			if strings.Contains(filePath, pattern) {
+				return true
+			}
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, path.Base(filePath)); ok {
+				return true
+			}
+			continue
+		}
+		// Try the pattern against each tail of the path that starts a
+		// path element
+		for tail := filePath; tail != ""; {
+			if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), strings.TrimPrefix(tail, "/")); ok {
+				return true
+			}
+			i := strings.Index(tail[1:], "/")
+			if i < 0 {
+				break
+			}
+			tail = tail[i+1:]
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExcluded(t *testing.T) {
+	tests := []struct {
+		path     string
+		patterns []string
+		want     bool
+	}{
+		{"/proj/pkg/client_test.go", DefaultExcludes, true},
+		{"/proj/test/harness.c", DefaultExcludes, true},
+		{"/proj/src/generated/api.c", DefaultExcludes, true},
+		{"/proj/proto/msg.pb.c", DefaultExcludes, true},
+		{"/proj/src/client.go", DefaultExcludes, false},
+		{"/proj/testing/util.c", DefaultExcludes, false}, // "/test/" is a whole directory
+		{"/proj/src/latest_test.c", DefaultExcludes, false},
+		{"/proj/src/x_mock.c", []string{"*_mock.c"}, true},
+		{"/proj/gen/a.c", []string{"gen/*.c"}, true},
+		{"/proj/gen/sub/a.c", []string{"gen/*.c"}, false},
+		{"/proj/src/regen/a.c", []string{"/gen/*.c"}, false},
+		{"/proj/src/a.c", []string{"", "[unclosed"}, false},
+		{"/proj/src/a.c", nil, false},
+	}
+	for _, tt := range tests {
+		if got := Excluded(tt.path, tt.patterns); got != tt.want {
+			t.Errorf("Excluded(%q, %q) = %v, want %v", tt.path, tt.patterns, got, tt.want)
+		}
+	}
+}
+
+func TestTraceSkipsExcludedFiles(t *testing.T) {
+	src := newCallChainSource()
+	src.refs["probe"] = append(src.refs["probe"], Hit{FilePath: "/drivers/drv_test.go", LineNo: "9", Line: "probe()"})
+	result, err := Trace(context.Background(), src, Options{Symbol: "probe", Depth: 1, Exclude: DefaultExcludes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Root.Children) != 1 || result.Root.Children[0].FilePath != "/drivers/drv.c" || result.Skipped != 1 {
+		t.Errorf("children = %+v, skipped = %d; want drv.c only, 1 skipped", result.Root.Children, result.Skipped)
+	}
+
+	// Without exclusions the test file is a caller like any other
+	result, err = Trace(context.Background(), src, Options{Symbol: "probe", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Root.Children) != 2 || result.Skipped != 0 {
+		t.Errorf("children = %+v, skipped = %d; want both callers", result.Root.Children, result.Skipped)
+	}
+}
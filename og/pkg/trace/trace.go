@@ -0,0 +1,504 @@
+// Package trace explores OpenGrok call graphs by repeatedly searching for the
+// callers of a symbol.
+//
+// Trace runs a whole breadth-first exploration in one call. Programs that
+// want to grow the graph on demand (a TUI expanding the node under the
+// cursor, an editor plugin, a daemon) create an Explorer and call ExpandNode
+// for the nodes they are interested in.
+//
+// Canceling the context stops an exploration between requests and aborts the
+// request in flight; the nodes found so far are kept. Options.TotalTimeout
+// does the same when Run's time budget runs out.
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults applied to zero Options fields
+const (
+	DefaultDepth    = 2
+	DefaultMaxTotal = 100
+)
+
+// searchBatch is the number of results requested per search
+const searchBatch = 50
+
+// Options configures the call graph exploration
+type Options struct {
+	Symbol    string // The function/symbol to trace
+	Depth     int    // Maximum traversal depth for Run (default: 2)
+	Direction string // "callers" only in v1 (callees would require source parsing)
+	MaxTotal  int    // Max total nodes to explore (prevents runaway)
+	Projects  string // Projects to search in (comma-separated)
+	Type      string // File type filter
+	// LevelProjects overrides Projects per BFS level: entry 0 applies to direct
+	// callers, entry 1 to their callers, and so on. "*" searches all projects.
+	// Levels beyond the list use Projects.
+	LevelProjects []string
+	// DefPath picks one definition when the symbol is defined in several
+	// places (matched as a substring of "/project/path:line")
+	DefPath string
+	// AnyDefinition traces the callers of every definition when the symbol
+	// has several and DefPath is empty, instead of failing with
+	// *AmbiguousDefinitionError. Result.Candidates then lists them.
+	AnyDefinition bool
+	// Aliases maps alias names to the symbols they stand for (e.g. an old
+	// name kept for compatibility to its replacement). Expanding either name
+	// also searches for callers of the other. Wrapper macros
+	// ("#define foo(x) bar(x)") found among the callers are followed the same
+	// way without being listed.
+	Aliases map[string]string
+	// Exclude lists path patterns (see Excluded) of files whose call sites
+	// are left out, e.g. DefaultExcludes
+	Exclude []string
+	// TotalTimeout bounds the wall-clock time of Run (0 for no limit). When
+	// it runs out, the request in flight is aborted and Run returns the graph
+	// found so far with Result.TimedOut set, like MaxTotal rather than a
+	// cancel. Each request keeps its own client timeout.
+	TotalTimeout time.Duration
+	// SameProjectOnly leaves out callers in another project than the node
+	// they call, so the graph never crosses a project boundary: with the
+	// definition known, every node is in its project. Callers of a root
+	// whose definition is unknown may come from any project, each then
+	// staying in its own.
+	SameProjectOnly bool
+	// OnNode, if set, is called as each node joins the graph (the root once
+	// the definition is resolved, then callers and Ref nodes as they are
+	// found) with its parent, nil for the root, and its level. Programs can
+	// use it to show the graph growing; it must not modify the nodes.
+	OnNode func(node, parent *Node, level int)
+}
+
+// ProjectsForLevel returns the project scope for a BFS level (1 = direct callers)
+func (o Options) ProjectsForLevel(level int) string {
+	if level >= 1 && level <= len(o.LevelProjects) {
+		projects := strings.TrimSpace(o.LevelProjects[level-1])
+		if projects == "*" {
+			return ""
+		}
+		return projects
+	}
+	return o.Projects
+}
+
+// Node represents a node in the call graph
+type Node struct {
+	Symbol   string  `json:"symbol"`             // Function/symbol name
+	FilePath string  `json:"filePath,omitempty"` // Full file path where this call occurs
+	Project  string  `json:"project,omitempty"`  // Project of FilePath (see ProjectOf)
+	LineNo   string  `json:"lineNo,omitempty"`   // Line number
+	Relation string  `json:"relation"`           // "caller" or "callee"
+	Children []*Node `json:"children,omitempty"` // Child nodes (further callers/callees)
+	// DefLine is the line where the enclosing function starts (0 if unknown)
+	DefLine int `json:"defLine,omitempty"`
+	// Via is the alias or wrapper macro this caller uses instead of its
+	// parent's symbol ("" when it calls the symbol directly)
+	Via string `json:"via,omitempty"`
+	// Ref marks a call from a function already in the graph. Its callers
+	// hang off the function's first node, so a Ref node is never expanded.
+	Ref bool `json:"ref,omitempty"`
+	// Annotations attached to this call site by the program (og attaches
+	// og_annotate notes); the explorer itself never sets them
+	Annotations []Annotation `json:"annotations,omitempty"`
+}
+
+// ProjectOf returns the project of a "/project/path" file path ("" if it
+// has none)
+func ProjectOf(filePath string) string {
+	project, _, _ := strings.Cut(strings.TrimPrefix(filePath, "/"), "/")
+	return project
+}
+
+// Annotation is a note attached to a call site
+type Annotation struct {
+	Line      int      `json:"line"`
+	Author    string   `json:"author"`
+	Timestamp string   `json:"timestamp"`
+	Text      string   `json:"text"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// Result contains the trace output and metadata
+type Result struct {
+	Root       *Node `json:"root"`       // Root of the call tree
+	TotalNodes int   `json:"totalNodes"` // Total nodes explored
+	MaxReached bool  `json:"maxReached"` // True if MaxTotal was reached
+	// Definition is the traced definition when the symbol's definition is known
+	Definition *Definition `json:"definition,omitempty"`
+	// Candidates lists the symbol's definitions when it has several and
+	// Options.AnyDefinition traced them all
+	Candidates []Definition `json:"candidates,omitempty"`
+	// Excluded counts direct callers dropped because they are closer to
+	// another definition of the same name
+	Excluded int `json:"excluded,omitempty"`
+	// Interrupted is true if the context was canceled before Run finished,
+	// leaving the graph partial
+	Interrupted bool `json:"interrupted,omitempty"`
+	// TimedOut is true if Options.TotalTimeout ran out before Run finished,
+	// leaving the graph partial
+	TimedOut bool `json:"timedOut,omitempty"`
+	// Skipped counts call sites left out because their file matches
+	// Options.Exclude
+	Skipped int `json:"skipped,omitempty"`
+	// CrossProject counts callers left out by Options.SameProjectOnly
+	CrossProject int `json:"crossProject,omitempty"`
+	// Refs counts the Ref nodes. They are not counted in TotalNodes or
+	// against MaxTotal, as they cost no searches.
+	Refs int `json:"refs,omitempty"`
+}
+
+// Hit is one search result line
+type Hit struct {
+	FilePath string // "/project/path"
+	LineNo   string
+	Line     string // Source line with any highlighting markup removed
+}
+
+// Source runs the searches and file fetches a trace needs. og adapts its
+// OpenGrok client to this interface; tests and other programs can supply
+// their own.
+type Source interface {
+	// Definitions returns the definition sites of symbol
+	Definitions(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error)
+	// References returns the lines that reference symbol
+	References(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error)
+	// FileLines returns the full contents of a "/project/path" file as lines
+	FileLines(ctx context.Context, filePath string) ([]string, error)
+}
+
+// Explorer grows a call graph one node at a time. It remembers visited
+// symbols and locations across expansions so the graph stays acyclic: a
+// function reached again through another branch (or recursion) is added as
+// a Ref node instead of being explored a second time. Nodes are counted
+// against Options.MaxTotal. An Explorer is not safe for
+// concurrent use.
+type Explorer struct {
+	src    Source
+	opts   Options
+	result *Result
+	defs   []Definition
+
+	aliases   map[string][]string
+	visited   map[string]bool
+	expanded  map[*Node]bool
+	levels    map[*Node]int
+	fileCache map[string][]string
+}
+
+// NewExplorer validates opts, resolves the symbol's definition and returns an
+// explorer whose root node has no children yet. It returns an
+// *AmbiguousDefinitionError when the symbol has several definitions and
+// opts.DefPath does not pick one, unless opts.AnyDefinition is set.
+func NewExplorer(ctx context.Context, src Source, opts Options) (*Explorer, error) {
+	if opts.Depth <= 0 {
+		opts.Depth = DefaultDepth
+	}
+	if opts.MaxTotal <= 0 {
+		opts.MaxTotal = DefaultMaxTotal // Conservative default
+	}
+	if opts.Direction == "" {
+		opts.Direction = "callers" // Only callers supported in v1
+	}
+
+	if opts.Direction != "callers" {
+		return nil, fmt.Errorf("only --direction=callers is supported in this version (callees requires source parsing)")
+	}
+
+	// Find where the symbol is defined so callers of unrelated functions with
+	// the same name can be left out. A failed lookup only matters if the
+	// caller asked for a specific definition.
+	defs, err := FindDefinitions(ctx, src, opts.Symbol, opts.Projects, opts.Type)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil && opts.DefPath != "" {
+		return nil, fmt.Errorf("definition search failed: %w", err)
+	}
+	def, err := selectDefinition(opts.Symbol, defs, opts.DefPath)
+	var ambiguous *AmbiguousDefinitionError
+	var candidates []Definition
+	if errors.As(err, &ambiguous) && opts.DefPath == "" && opts.AnyDefinition {
+		candidates, err = ambiguous.Candidates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Node{
+		Symbol:   opts.Symbol,
+		Relation: "root",
+	}
+	if def != nil {
+		root.FilePath = def.FilePath
+		root.Project = ProjectOf(def.FilePath)
+		root.LineNo = def.LineNo
+	}
+
+	e := &Explorer{
+		src:  src,
+		opts: opts,
+		result: &Result{
+			Root:       root,
+			TotalNodes: 0, // Don't count root node against the limit
+			Definition: def,
+			Candidates: candidates,
+		},
+		defs:      defs,
+		aliases:   aliasGroups(opts.Aliases),
+		visited:   map[string]bool{opts.Symbol: true},
+		expanded:  make(map[*Node]bool),
+		levels:    map[*Node]int{root: 0},
+		fileCache: make(map[string][]string),
+	}
+	e.added(root, nil, 0)
+	return e, nil
+}
+
+// Root returns the traced symbol's node
+func (e *Explorer) Root() *Node {
+	return e.result.Root
+}
+
+// Result returns the graph explored so far. It is updated in place by later
+// expansions.
+func (e *Explorer) Result() *Result {
+	return e.result
+}
+
+// Level returns how many caller hops node is from the root (0 for the root,
+// -1 for nodes this explorer did not create)
+func (e *Explorer) Level(node *Node) int {
+	if level, ok := e.levels[node]; ok {
+		return level
+	}
+	return -1
+}
+
+// Expandable reports whether ExpandNode could still add callers to node
+func (e *Explorer) Expandable(node *Node) bool {
+	return node.Symbol != "" && !node.Ref && !e.expanded[node] && !e.result.MaxReached
+}
+
+// ExpandNode searches for the callers of node, appends the ones not seen
+// before to node.Children and returns them; calls from functions already in
+// the graph are appended as Ref nodes but not returned. Expanding a node
+// twice returns its existing children without searching again. Nodes
+// without a symbol (call sites whose enclosing function is unknown) and Ref
+// nodes have no callers to find. When MaxTotal is reached,
+// Result().MaxReached is set and no further nodes are added.
+func (e *Explorer) ExpandNode(ctx context.Context, node *Node) ([]*Node, error) {
+	if e.expanded[node] {
+		return node.Children, nil
+	}
+	if node.Symbol == "" || node.Ref {
+		return nil, nil
+	}
+	result := e.result
+	if result.TotalNodes >= e.opts.MaxTotal {
+		result.MaxReached = true
+		return nil, nil
+	}
+	level := e.Level(node) + 1
+	if level == 0 {
+		return nil, fmt.Errorf("node %s does not belong to this trace", node.Symbol)
+	}
+
+	callers, err := e.findCallers(ctx, node.Symbol, level)
+	if err != nil {
+		return nil, err
+	}
+	e.expanded[node] = true
+
+	// Sort callers for deterministic output (numerically by line number)
+	sort.Slice(callers, func(i, j int) bool {
+		if callers[i].FilePath != callers[j].FilePath {
+			return callers[i].FilePath < callers[j].FilePath
+		}
+		// Parse line numbers as integers for proper numerical sorting
+		lineI, _ := strconv.Atoi(callers[i].LineNo)
+		lineJ, _ := strconv.Atoi(callers[j].LineNo)
+		return lineI < lineJ
+	})
+
+	def := result.Definition
+	var added []*Node
+	for _, caller := range callers {
+		if result.TotalNodes >= e.opts.MaxTotal {
+			result.MaxReached = true
+			break
+		}
+
+		// Drop direct callers that belong to another same-named definition
+		if node == result.Root && def != nil && len(e.defs) > 1 && !nearestToDefinition(caller.FilePath, def, e.defs) {
+			result.Excluded++
+			continue
+		}
+		project := ProjectOf(caller.FilePath)
+		if e.opts.SameProjectOnly && node.Project != "" && project != node.Project {
+			result.CrossProject++
+			continue
+		}
+
+		// Use file:line as unique identifier to prevent duplicate locations
+		locationKey := caller.FilePath + ":" + caller.LineNo
+		if e.visited[locationKey] {
+			continue
+		}
+		e.visited[locationKey] = true
+
+		child := &Node{
+			Symbol:   caller.Symbol,
+			FilePath: caller.FilePath,
+			Project:  project,
+			LineNo:   caller.LineNo,
+			Relation: "caller",
+			DefLine:  caller.DefLine,
+			Via:      caller.Via,
+		}
+		e.levels[child] = level
+
+		// Also track by symbol name: a function already in the graph is
+		// shown as a reference to it, which also breaks cycles
+		if caller.Symbol != "" && e.visited[caller.Symbol] {
+			child.Ref = true
+			node.Children = append(node.Children, child)
+			result.Refs++
+			e.added(child, node, level)
+			continue
+		}
+		if caller.Symbol != "" {
+			e.visited[caller.Symbol] = true
+		}
+
+		node.Children = append(node.Children, child)
+		result.TotalNodes++
+		added = append(added, child)
+		e.added(child, node, level)
+	}
+	return added, nil
+}
+
+// added reports a new node to Options.OnNode
+func (e *Explorer) added(node, parent *Node, level int) {
+	if e.opts.OnNode != nil {
+		e.opts.OnNode(node, parent, level)
+	}
+}
+
+// findCallers searches for the callers of symbol and of its aliases, adding
+// the wrapper macros it comes across to the names searched. The symbol's own
+// search must succeed; a failed alias search only loses that alias's callers.
+func (e *Explorer) findCallers(ctx context.Context, symbol string, level int) ([]caller, error) {
+	names := append([]string{symbol}, e.aliases[symbol]...)
+	isAlias := make(map[string]bool)
+	for _, name := range names[1:] {
+		isAlias[name] = true
+	}
+
+	var callers []caller
+	for i := 0; i < len(names) && i <= maxAliasSearches; i++ {
+		name := names[i]
+		// Find callers of the current symbol using symbol search
+		hits, err := e.src.References(ctx, name, e.opts.ProjectsForLevel(level), e.opts.Type, searchBatch)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			continue
+		}
+
+		// Use the enclosing function names only when depth allows deeper
+		// traversal, as finding them costs a file fetch per caller file
+		// (if ctx is canceled meanwhile, the callers are still added, without
+		// names for the files not fetched)
+		for _, c := range e.extractCallers(ctx, hits, name, e.opts.Depth > 1) {
+			switch {
+			case c.Macro != "":
+				if c.Macro != symbol && !isAlias[c.Macro] {
+					isAlias[c.Macro] = true
+					names = append(names, c.Macro)
+				}
+			case isAlias[c.Symbol]:
+				// The body of a wrapper function given as an alias, whose
+				// callers are searched directly
+			default:
+				if name != symbol {
+					c.Via = name
+				}
+				callers = append(callers, c)
+			}
+		}
+	}
+	return callers, nil
+}
+
+// Run expands the graph breadth-first down to Options.Depth levels and
+// returns the result. Search failures on one branch leave that branch
+// unexpanded without stopping the others. If ctx is canceled, Run stops and
+// returns the partial result, marked Interrupted, with the context's error.
+// If Options.TotalTimeout runs out first, the partial result is marked
+// TimedOut instead and returned without an error.
+func (e *Explorer) Run(ctx context.Context) (*Result, error) {
+	budget := ctx
+	if e.opts.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		budget, cancel = context.WithTimeout(ctx, e.opts.TotalTimeout)
+		defer cancel()
+	}
+
+	queue := []*Node{e.result.Root}
+	for len(queue) > 0 && !e.result.MaxReached {
+		if stopped, err := e.stopped(ctx, budget); stopped {
+			return e.result, err
+		}
+		node := queue[0]
+		queue = queue[1:]
+
+		if e.Level(node) >= e.opts.Depth {
+			continue
+		}
+		children, err := e.ExpandNode(budget, node)
+		if err != nil {
+			// Continue with other branches
+			continue
+		}
+		queue = append(queue, children...)
+	}
+	if stopped, err := e.stopped(ctx, budget); stopped {
+		return e.result, err
+	}
+	return e.result, nil
+}
+
+// stopped reports whether Run must stop, marking the result Interrupted
+// (returning ctx's error) when ctx is canceled or TimedOut when only the
+// budget derived from it has run out
+func (e *Explorer) stopped(ctx, budget context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		e.result.Interrupted = true
+		return true, err
+	}
+	if budget.Err() != nil {
+		e.result.TimedOut = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// Trace performs call graph exploration starting from the given symbol. When
+// ctx is canceled during the exploration, it returns the partial result
+// along with the context's error.
+func Trace(ctx context.Context, src Source, opts Options) (*Result, error) {
+	e, err := NewExplorer(ctx, src, opts)
+	if err != nil {
+		return nil, err
+	}
+	return e.Run(ctx)
+}
@@ -0,0 +1,505 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSource serves canned hits and files
+type fakeSource struct {
+	defs     map[string][]Hit
+	refs     map[string][]Hit
+	files    map[string]string
+	searches []string // "symbol@projects" per reference search
+}
+
+func (f *fakeSource) Definitions(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error) {
+	return f.defs[symbol], nil
+}
+
+func (f *fakeSource) References(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error) {
+	f.searches = append(f.searches, symbol+"@"+projects)
+	if symbol == "broken" {
+		return nil, fmt.Errorf("search failed")
+	}
+	return f.refs[symbol], nil
+}
+
+func (f *fakeSource) FileLines(ctx context.Context, filePath string) ([]string, error) {
+	content, ok := f.files[filePath]
+	if !ok {
+		return nil, fmt.Errorf("%s not found", filePath)
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// newCallChainSource models probe() <- driver_init() <- kernel_main()
+func newCallChainSource() *fakeSource {
+	return &fakeSource{
+		refs: map[string][]Hit{
+			"probe":       {{FilePath: "/drivers/drv.c", LineNo: "3", Line: "probe();"}},
+			"driver_init": {{FilePath: "/kernel/main.c", LineNo: "2", Line: "driver_init();"}},
+		},
+		files: map[string]string{
+			"/drivers/drv.c": "void driver_init(void) {\n\tint x;\n\tprobe();\n}\n",
+			"/kernel/main.c": "int kernel_main(void) {\n\tdriver_init();\n}\n",
+		},
+	}
+}
+
+func TestTraceOptionsDefaults(t *testing.T) {
+	// Test that Trace handles default options correctly
+	// This is a unit test that doesn't make network calls
+
+	opts := Options{
+		Symbol: "test_func",
+		// Leave other options at zero values
+	}
+
+	// Check that zero values exist (the Trace function will set defaults)
+	if opts.Depth != 0 {
+		t.Error("Expected Depth to be zero initially")
+	}
+	if opts.MaxTotal != 0 {
+		t.Error("Expected MaxTotal to be zero initially")
+	}
+	if opts.Direction != "" {
+		t.Error("Expected Direction to be empty initially")
+	}
+}
+
+func TestTraceInvalidDirection(t *testing.T) {
+	_, err := Trace(context.Background(), &fakeSource{}, Options{Symbol: "test", Direction: "callees"})
+	if err == nil || !strings.Contains(err.Error(), "callees") {
+		t.Errorf("Expected error mentioning 'callees', got: %v", err)
+	}
+}
+
+func TestExplorerExpandNode(t *testing.T) {
+	src := newCallChainSource()
+	e, err := NewExplorer(context.Background(), src, Options{Symbol: "probe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Root().Children) != 0 || e.Result().TotalNodes != 0 {
+		t.Fatal("a new explorer should not search for callers yet")
+	}
+
+	callers, err := e.ExpandNode(context.Background(), e.Root())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(callers) != 1 || callers[0].Symbol != "driver_init" || callers[0].DefLine != 1 {
+		t.Fatalf("direct callers = %+v", callers)
+	}
+	if e.Level(callers[0]) != 1 {
+		t.Errorf("Level(driver_init) = %d, want 1", e.Level(callers[0]))
+	}
+
+	// Expanding again returns the same children without searching
+	again, _ := e.ExpandNode(context.Background(), e.Root())
+	if len(again) != 1 || again[0] != callers[0] || len(src.searches) != 1 {
+		t.Errorf("second expansion searched again or changed children: %v", src.searches)
+	}
+	if e.Expandable(e.Root()) || !e.Expandable(callers[0]) {
+		t.Error("Expandable should be false after expansion and true before")
+	}
+
+	// Nodes can be expanded beyond Options.Depth on demand
+	next, err := e.ExpandNode(context.Background(), callers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next) != 1 || next[0].Symbol != "kernel_main" || e.Level(next[0]) != 2 {
+		t.Errorf("callers of driver_init = %+v", next)
+	}
+	if e.Result().TotalNodes != 2 {
+		t.Errorf("TotalNodes = %d, want 2", e.Result().TotalNodes)
+	}
+
+	if _, err := e.ExpandNode(context.Background(), &Node{Symbol: "stranger"}); err == nil {
+		t.Error("expected an error for a node from another trace")
+	}
+}
+
+func TestExplorerExpandNodeError(t *testing.T) {
+	src := &fakeSource{}
+	e, err := NewExplorer(context.Background(), src, Options{Symbol: "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.ExpandNode(context.Background(), e.Root()); err == nil {
+		t.Fatal("expected the search error")
+	}
+	// A failed expansion can be retried
+	if !e.Expandable(e.Root()) {
+		t.Error("root should stay expandable after a failed search")
+	}
+}
+
+func TestExplorerMaxTotal(t *testing.T) {
+	src := &fakeSource{refs: map[string][]Hit{
+		"f": {
+			{FilePath: "/p/a.c", LineNo: "1"},
+			{FilePath: "/p/a.c", LineNo: "2"},
+			{FilePath: "/p/a.c", LineNo: "3"},
+		},
+	}}
+	result, err := Trace(context.Background(), src, Options{Symbol: "f", Depth: 1, MaxTotal: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalNodes != 2 || !result.MaxReached {
+		t.Errorf("TotalNodes = %d, MaxReached = %v; want 2, true", result.TotalNodes, result.MaxReached)
+	}
+}
+
+func TestTraceRunsToDepth(t *testing.T) {
+	src := newCallChainSource()
+	result, err := Trace(context.Background(), src, Options{
+		Symbol:        "probe",
+		Depth:         2,
+		Projects:      "drivers",
+		LevelProjects: []string{"drivers", "*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalNodes != 2 {
+		t.Errorf("expected 2 nodes, got %d", result.TotalNodes)
+	}
+	// kernel_main is at the depth limit, so it is not searched
+	want := []string{"probe@drivers", "driver_init@"}
+	if strings.Join(src.searches, " ") != strings.Join(want, " ") {
+		t.Errorf("searches = %v, want %v", src.searches, want)
+	}
+}
+
+func TestTraceReportsNodesAsAdded(t *testing.T) {
+	var seen []string
+	onNode := func(node, parent *Node, level int) {
+		from := "-"
+		if parent != nil {
+			from = parent.Symbol
+		}
+		if len(node.Children) != 0 {
+			t.Errorf("%s reported with children", node.Symbol)
+		}
+		seen = append(seen, fmt.Sprintf("%s<-%s@%d", from, node.Symbol, level))
+	}
+	result, err := Trace(context.Background(), newCallChainSource(), Options{Symbol: "probe", Depth: 3, OnNode: onNode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-<-probe@0 probe<-driver_init@1 driver_init<-kernel_main@2"; strings.Join(seen, " ") != want {
+		t.Errorf("reported %v, want %s", seen, want)
+	}
+	if result.TotalNodes != 2 {
+		t.Errorf("TotalNodes = %d, want 2", result.TotalNodes)
+	}
+}
+
+func TestTraceSharedFunctionsBecomeRefs(t *testing.T) {
+	// probe() <- read_a(), read_b(); both <- dispatch(), which is explored once
+	src := &fakeSource{
+		refs: map[string][]Hit{
+			"probe":    {{FilePath: "/p/a.c", LineNo: "2"}, {FilePath: "/p/b.c", LineNo: "2"}},
+			"read_a":   {{FilePath: "/p/main.c", LineNo: "2"}},
+			"read_b":   {{FilePath: "/p/main.c", LineNo: "3"}},
+			"dispatch": {{FilePath: "/p/boot.c", LineNo: "2"}},
+		},
+		files: map[string]string{
+			"/p/a.c":    "void read_a(void) {\n\tprobe();\n}\n",
+			"/p/b.c":    "void read_b(void) {\n\tprobe();\n}\n",
+			"/p/main.c": "void dispatch(void) {\n\tread_a();\n\tread_b();\n}\n",
+			"/p/boot.c": "void boot(void) {\n\tdispatch();\n}\n",
+		},
+	}
+	result, err := Trace(context.Background(), src, Options{Symbol: "probe", Depth: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readA, readB := result.Root.Children[0], result.Root.Children[1]
+	if len(readA.Children) != 1 || readA.Children[0].Ref || len(readA.Children[0].Children) != 1 {
+		t.Fatalf("first dispatch() should be explored: %+v", readA.Children)
+	}
+	if len(readB.Children) != 1 || !readB.Children[0].Ref || readB.Children[0].Symbol != "dispatch" {
+		t.Fatalf("second dispatch() should be a reference: %+v", readB.Children)
+	}
+	if result.TotalNodes != 4 || result.Refs != 1 {
+		t.Errorf("TotalNodes = %d, Refs = %d; want 4, 1", result.TotalNodes, result.Refs)
+	}
+	// dispatch is searched once
+	if want := "probe@ read_a@ read_b@ dispatch@"; strings.Join(src.searches, " ") != want {
+		t.Errorf("searches = %v, want %s", src.searches, want)
+	}
+}
+
+func TestCallersSortedNumerically(t *testing.T) {
+	// Callers are sorted by line number numerically, not lexicographically.
+	// Without numerical sorting, "100" < "42" < "9" because string comparison
+	// uses character-by-character ordering.
+	src := &fakeSource{refs: map[string][]Hit{
+		"test": {
+			{Line: "line 100", LineNo: "100", FilePath: "/project/src/file.c"},
+			{Line: "line 42", LineNo: "42", FilePath: "/project/src/file.c"},
+			{Line: "line 9", LineNo: "9", FilePath: "/project/src/file.c"},
+			{Line: "line 1000", LineNo: "1000", FilePath: "/project/src/file.c"},
+		},
+	}}
+	result, err := Trace(context.Background(), src, Options{Symbol: "test", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the order is numerically correct: 9, 42, 100, 1000
+	expected := []string{"9", "42", "100", "1000"}
+	if len(result.Root.Children) != len(expected) {
+		t.Fatalf("Expected %d callers, got %d", len(expected), len(result.Root.Children))
+	}
+	for i, caller := range result.Root.Children {
+		if caller.LineNo != expected[i] {
+			t.Errorf("Position %d: got line %s, want %s", i, caller.LineNo, expected[i])
+		}
+	}
+}
+
+func TestCallersSortedByFileAndLine(t *testing.T) {
+	src := &fakeSource{refs: map[string][]Hit{
+		"test": {
+			{Line: "line 50", LineNo: "50", FilePath: "/project/b/file.c"},
+			{Line: "line 10", LineNo: "10", FilePath: "/project/b/file.c"},
+			{Line: "line 100", LineNo: "100", FilePath: "/project/a/file.c"},
+			{Line: "line 5", LineNo: "5", FilePath: "/project/a/file.c"},
+			{Line: "line 1", LineNo: "1", FilePath: "/project/c/file.c"},
+			{Line: "line 999", LineNo: "999", FilePath: "/project/c/file.c"},
+		},
+	}}
+	result, err := Trace(context.Background(), src, Options{Symbol: "test", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedOrder := []string{
+		"/project/a/file.c:5",
+		"/project/a/file.c:100",
+		"/project/b/file.c:10",
+		"/project/b/file.c:50",
+		"/project/c/file.c:1",
+		"/project/c/file.c:999",
+	}
+	if len(result.Root.Children) != len(expectedOrder) {
+		t.Fatalf("Expected %d callers, got %d", len(expectedOrder), len(result.Root.Children))
+	}
+	for i, caller := range result.Root.Children {
+		if got := caller.FilePath + ":" + caller.LineNo; got != expectedOrder[i] {
+			t.Errorf("Position %d: got %s, want %s", i, got, expectedOrder[i])
+		}
+	}
+}
+
+func TestProjectsForLevel(t *testing.T) {
+	opts := Options{
+		Projects:      "default",
+		LevelProjects: []string{"drivers", "*"},
+	}
+
+	tests := []struct {
+		level    int
+		expected string
+	}{
+		{1, "drivers"},
+		{2, ""},
+		{3, "default"},
+	}
+	for _, tt := range tests {
+		if got := opts.ProjectsForLevel(tt.level); got != tt.expected {
+			t.Errorf("ProjectsForLevel(%d) = %q, want %q", tt.level, got, tt.expected)
+		}
+	}
+}
+
+func TestSelectDefinition(t *testing.T) {
+	defs := []Definition{
+		{FilePath: "/illumos/usr/src/uts/common/fs/vnode.c", LineNo: "100"},
+		{FilePath: "/illumos/usr/src/cmd/fs/vnode.c", LineNo: "20"},
+	}
+
+	if _, err := selectDefinition("vn_open", defs, ""); err == nil {
+		t.Error("expected ambiguity error without --def-path")
+	} else if amb, ok := err.(*AmbiguousDefinitionError); !ok || len(amb.Candidates) != 2 {
+		t.Errorf("expected AmbiguousDefinitionError with 2 candidates, got %v", err)
+	}
+
+	def, err := selectDefinition("vn_open", defs, "uts/")
+	if err != nil || def == nil || def.LineNo != "100" {
+		t.Errorf("selectDefinition(uts/) = %v, %v", def, err)
+	}
+
+	if _, err := selectDefinition("vn_open", defs, "nomatch"); err == nil {
+		t.Error("expected error when --def-path matches nothing")
+	}
+
+	if def, err := selectDefinition("vn_open", nil, ""); def != nil || err != nil {
+		t.Errorf("no definitions should mean no restriction, got %v, %v", def, err)
+	}
+}
+
+func TestNearestToDefinition(t *testing.T) {
+	kernel := Definition{FilePath: "/illumos/usr/src/uts/common/os/init.c"}
+	user := Definition{FilePath: "/illumos/usr/src/cmd/init/init.c"}
+	defs := []Definition{kernel, user}
+
+	tests := []struct {
+		caller   string
+		expected bool
+	}{
+		{"/illumos/usr/src/uts/common/os/main.c", true},
+		{"/illumos/usr/src/uts/i86pc/os/startup.c", true},
+		{"/illumos/usr/src/cmd/init/boot.c", false},
+		{"/other/src/x.c", true}, // Equally far from both: keep
+	}
+	for _, tt := range tests {
+		if got := nearestToDefinition(tt.caller, &kernel, defs); got != tt.expected {
+			t.Errorf("nearestToDefinition(%q) = %v, want %v", tt.caller, got, tt.expected)
+		}
+	}
+}
+
+// cancelingSource cancels the trace's context during the nth reference search
+type cancelingSource struct {
+	*fakeSource
+	cancel context.CancelFunc
+	after  int
+}
+
+func (c *cancelingSource) References(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error) {
+	hits, err := c.fakeSource.References(ctx, symbol, projects, fileType, max)
+	if len(c.searches) == c.after {
+		c.cancel()
+	}
+	return hits, err
+}
+
+func TestTraceCanceledKeepsPartialResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// Cancel right after the direct callers are found: the call site in
+	// drv.c is kept and nothing else is searched for
+	src := &cancelingSource{fakeSource: newCallChainSource(), cancel: cancel, after: 1}
+
+	result, err := Trace(ctx, src, Options{Symbol: "probe", Depth: 3})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if result == nil || !result.Interrupted {
+		t.Fatalf("expected an interrupted partial result, got %+v", result)
+	}
+	if result.TotalNodes != 1 || result.Root.Children[0].FilePath != "/drivers/drv.c" {
+		t.Errorf("expected the direct caller found before the cancel, got %+v", result.Root.Children)
+	}
+	if len(src.searches) != 1 {
+		t.Errorf("searches after cancel: %v", src.searches)
+	}
+}
+
+// stallingSource answers the first reference search, then blocks every
+// later one until its context is done
+type stallingSource struct {
+	*fakeSource
+}
+
+func (s *stallingSource) References(ctx context.Context, symbol, projects, fileType string, max int) ([]Hit, error) {
+	hits, err := s.fakeSource.References(ctx, symbol, projects, fileType, max)
+	if len(s.searches) > 1 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return hits, err
+}
+
+func TestTraceTotalTimeoutKeepsPartialResult(t *testing.T) {
+	src := &stallingSource{fakeSource: newCallChainSource()}
+
+	result, err := Trace(context.Background(), src, Options{Symbol: "probe", Depth: 3, TotalTimeout: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("a timed out trace should not fail: %v", err)
+	}
+	if !result.TimedOut || result.Interrupted {
+		t.Errorf("TimedOut = %v, Interrupted = %v, want a timed out result", result.TimedOut, result.Interrupted)
+	}
+	if result.TotalNodes != 1 || result.Root.Children[0].FilePath != "/drivers/drv.c" {
+		t.Errorf("expected the direct caller found in time, got %+v", result.Root.Children)
+	}
+}
+
+func TestNewExplorerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewExplorer(ctx, newCallChainSource(), Options{Symbol: "probe"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestTraceSameProjectOnly(t *testing.T) {
+	src := &fakeSource{
+		defs: map[string][]Hit{"probe": {{FilePath: "/drivers/drv.c", LineNo: "10"}}},
+		refs: map[string][]Hit{"probe": {
+			{FilePath: "/drivers/bus.c", LineNo: "4", Line: "probe();"},
+			{FilePath: "/kernel/main.c", LineNo: "7", Line: "probe();"},
+		}},
+	}
+
+	result, err := Trace(context.Background(), src, Options{Symbol: "probe", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Root.Project != "drivers" || len(result.Root.Children) != 2 || result.Root.Children[1].Project != "kernel" {
+		t.Fatalf("projects not set: root %q, children %+v", result.Root.Project, result.Root.Children)
+	}
+
+	result, err = Trace(context.Background(), src, Options{Symbol: "probe", Depth: 1, SameProjectOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Root.Children) != 1 || result.Root.Children[0].FilePath != "/drivers/bus.c" || result.CrossProject != 1 {
+		t.Errorf("children %+v, crossProject %d; want only /drivers/bus.c", result.Root.Children, result.CrossProject)
+	}
+}
+
+func TestTraceAnyDefinition(t *testing.T) {
+	src := &fakeSource{
+		defs: map[string][]Hit{"init": {
+			{FilePath: "/kernel/os/init.c", LineNo: "10"},
+			{FilePath: "/cmd/init/init.c", LineNo: "20"},
+		}},
+		refs: map[string][]Hit{"init": {
+			{FilePath: "/kernel/os/main.c", LineNo: "4", Line: "init();"},
+			{FilePath: "/cmd/init/boot.c", LineNo: "7", Line: "init();"},
+		}},
+	}
+
+	var ambiguous *AmbiguousDefinitionError
+	if _, err := Trace(context.Background(), src, Options{Symbol: "init", Depth: 1}); !errors.As(err, &ambiguous) {
+		t.Fatalf("expected AmbiguousDefinitionError, got %v", err)
+	}
+
+	// The callers of both definitions are kept
+	result, err := Trace(context.Background(), src, Options{Symbol: "init", Depth: 1, AnyDefinition: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Definition != nil || len(result.Candidates) != 2 || len(result.Root.Children) != 2 {
+		t.Errorf("definition %v, candidates %v, children %d; want no definition, 2 candidates and 2 callers",
+			result.Definition, result.Candidates, len(result.Root.Children))
+	}
+
+	// A --def-path matching both still fails
+	if _, err := Trace(context.Background(), src, Options{Symbol: "init", Depth: 1, DefPath: "init.c", AnyDefinition: true}); !errors.As(err, &ambiguous) {
+		t.Errorf("ambiguous DefPath: expected AmbiguousDefinitionError, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// hitPreview is the source around a line hit, shown below it by --preview
+type hitPreview struct {
+	Path  string   // File path, for choosing a syntax highlighter
+	Start int      // Line number of Lines[0]
+	Line  int      // Line number of the hit
+	Lines []string // Source from Start, the hit line included
+}
+
+// hitPreviews maps "project\x00path\x00line" to the preview of that hit
+type hitPreviews map[string]*hitPreview
+
+// get returns the preview of a hit, or nil; a nil map has none
+func (p hitPreviews) get(project, path string, line int) *hitPreview {
+	return p[project+"\x00"+path+"\x00"+strconv.Itoa(line)]
+}
+
+// previewWindow cuts the lines within context lines of line out of content
+func previewWindow(path, content string, line, context int) *hitPreview {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	start := max(line-context, 1)
+	end := min(line+context, len(lines))
+	window := make([]string, 0, end-start+1)
+	for _, l := range lines[start-1 : end] {
+		window = append(window, strings.TrimSuffix(l, "\r"))
+	}
+	return &hitPreview{Path: path, Start: start, Line: line, Lines: window}
+}
+
+// fetchPreviews fetches the source around the first hits line hits of resp,
+// context lines either side, each file once. Hits whose file can't be
+// fetched get no preview: failed counts them and err is the first failure.
+// An interrupted fetch returns just the error.
+func fetchPreviews(ctx context.Context, client *Client, resp *SearchResponse, hits, context int, task *ProgressTask) (previews hitPreviews, failed int, err error) {
+	type hit struct {
+		project, path string
+		line          int
+	}
+	var wanted []hit
+	var files []string
+	seenFile := make(map[string]bool)
+	for _, r := range resp.OrderedEntries() {
+		if len(wanted) == hits {
+			break
+		}
+		line, err := strconv.Atoi(string(r.LineNo))
+		if err != nil || line < 1 {
+			continue
+		}
+		h := hit{r.Project, r.FilePath(), line}
+		wanted = append(wanted, h)
+		if filePath := projectPath(h.project, h.path); !seenFile[filePath] {
+			seenFile[filePath] = true
+			files = append(files, filePath)
+		}
+	}
+
+	step := task.Start("")
+	defer step.Done()
+	contents := make(map[string]string)
+	var firstErr error
+	for i, filePath := range files {
+		step.Updatef("%s (%d/%d)", strings.TrimPrefix(filePath, "/"), i+1, len(files))
+		content, err := client.GetFileContext(ctx, filePath)
+		if isInterrupted(err) {
+			return nil, 0, err
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", strings.TrimPrefix(filePath, "/"), err)
+			}
+			continue
+		}
+		contents[filePath] = content
+	}
+
+	previews = make(hitPreviews)
+	for _, h := range wanted {
+		content, ok := contents[projectPath(h.project, h.path)]
+		if !ok {
+			failed++
+			continue
+		}
+		if p := previewWindow(h.path, content, h.line, context); p != nil {
+			previews[h.project+"\x00"+h.path+"\x00"+strconv.Itoa(h.line)] = p
+		}
+	}
+	return previews, failed, firstErr
+}
+
+// printPreview prints a preview below its hit, grep -C style: the hit line
+// marked with ">", every line numbered, syntax highlighted with color
+func printPreview(w io.Writer, p *hitPreview, useColor bool, theme string) {
+	if p == nil {
+		return
+	}
+	lines := p.Lines
+	if useColor {
+		lines = highlightLines(p.Path, lines, theme)
+	}
+	width := len(strconv.Itoa(p.Start + len(lines) - 1))
+	for i, line := range lines {
+		lineNo := p.Start + i
+		marker := " "
+		if lineNo == p.Line {
+			marker = ">"
+		}
+		switch {
+		case useColor && lineNo == p.Line:
+			fmt.Fprintf(w, "  %s%s%s %s%*d%s  %s\n", colorBold+colorRed, marker, colorReset, colorBold+colorCyan, width, lineNo, colorReset, line)
+		case useColor:
+			fmt.Fprintf(w, "  %s %s%*d%s  %s\n", marker, colorCyan, width, lineNo, colorReset, line)
+		default:
+			fmt.Fprintf(w, "  %s %*d  %s\n", marker, width, lineNo, line)
+		}
+	}
+	fmt.Fprintln(w)
+}
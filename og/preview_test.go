@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreviewWindow(t *testing.T) {
+	content := "one\r\ntwo\nthree\nfour\nfive\n"
+	p := previewWindow("/a.c", content, 2, 2)
+	if p.Start != 1 || p.Line != 2 || strings.Join(p.Lines, ",") != "one,two,three,four" {
+		t.Errorf("window at start = %+v", p)
+	}
+	p = previewWindow("/a.c", content, 5, 1)
+	if p.Start != 4 || strings.Join(p.Lines, ",") != "four,five" {
+		t.Errorf("window at end = %+v", p)
+	}
+	if p := previewWindow("/a.c", content, 6, 1); p != nil {
+		t.Errorf("line past the end = %+v", p)
+	}
+}
+
+func TestPrintPreview(t *testing.T) {
+	var buf bytes.Buffer
+	printPreview(&buf, &hitPreview{Path: "/a.c", Start: 9, Line: 10, Lines: []string{"a();", "b();", "c();"}}, false, themeNone)
+	want := "     9  a();\n  > 10  b();\n    11  c();\n\n"
+	if buf.String() != want {
+		t.Errorf("printPreview() =\n%q\nwant\n%q", buf.String(), want)
+	}
+	buf.Reset()
+	printPreview(&buf, nil, false, themeNone)
+	if buf.Len() != 0 {
+		t.Errorf("nil preview printed %q", buf.String())
+	}
+}
+
+func TestFetchPreviews(t *testing.T) {
+	fetched := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched[r.URL.Path]++
+		if strings.HasSuffix(r.URL.Path, "/gone.c") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("l1\nl2\nl3\nl4\nl5\n"))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &SearchResponse{Results: map[string][]SearchResult{
+		"proj": {
+			{Path: "/proj/a.c", LineNo: "2"},
+			{Path: "/proj/a.c", LineNo: "4"},
+			{Path: "/proj/gone.c", LineNo: "1"},
+			{Path: "/proj/b.c", LineNo: "1"},
+		},
+	}}
+	previews, failed, err := fetchPreviews(context.Background(), client, resp, 3, 1, newProgress(true).Start(""))
+	if failed != 1 || err == nil || !strings.Contains(err.Error(), "proj/gone.c") {
+		t.Errorf("failed = %d, err = %v", failed, err)
+	}
+	if p := previews.get("proj", "/a.c", 4); p == nil || strings.Join(p.Lines, ",") != "l3,l4,l5" {
+		t.Errorf("preview of a.c:4 = %+v", p)
+	}
+	if previews.get("proj", "/b.c", 1) != nil {
+		t.Errorf("previewed past the hit limit")
+	}
+	if len(fetched) != 2 {
+		t.Errorf("fetched %v, want a.c once and gone.c", fetched)
+	}
+}
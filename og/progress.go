@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+)
+
+// Progress shows what a command is working on while it waits on the server:
+// a spinner on a terminal, one line per step when stderr is redirected, and
+// nothing with --quiet. Tasks nest, so a fan-out can show
+// "Comparing projects: searching illumos (3/7)", and tasks may be started,
+// updated and finished from several goroutines.
+type Progress struct {
+	mu     sync.Mutex
+	out    progressOutput
+	active []*ProgressTask // Running tasks, in start order
+	latest *ProgressTask   // Task whose message changed last
+	shown  string
+}
+
+// ProgressTask is one running step of a Progress. Methods on a nil task do
+// nothing, so functions can take an optional task to report under.
+type ProgressTask struct {
+	progress *Progress
+	parent   *ProgressTask
+	message  string
+	done     bool
+}
+
+// progressOutput displays the current progress line
+type progressOutput interface {
+	show(line string) // Called only when the line changes
+	clear()           // Called when the last task finishes
+}
+
+// newProgress returns the progress display for stderr
+func newProgress(quiet bool) *Progress {
+	switch {
+	case quiet:
+		return &Progress{out: nopProgress{}}
+	case isTerminal(os.Stderr):
+		return &Progress{out: newSpinnerProgress(os.Stderr)}
+	}
+	return &Progress{out: lineProgress{w: os.Stderr}}
+}
+
+// Start begins a top-level task, shown until Done is called
+func (p *Progress) Start(message string) *ProgressTask {
+	return p.start(nil, message)
+}
+
+// Start begins a subtask, shown after its parent's message
+func (t *ProgressTask) Start(message string) *ProgressTask {
+	if t == nil {
+		return nil
+	}
+	return t.progress.start(t, message)
+}
+
+// Update replaces the task's message
+func (t *ProgressTask) Update(message string) {
+	if t == nil {
+		return
+	}
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.message = message
+	p.latest = t
+	p.render()
+}
+
+// Updatef is Update with a format string
+func (t *ProgressTask) Updatef(format string, args ...interface{}) {
+	t.Update(fmt.Sprintf(format, args...))
+}
+
+// Done finishes the task and any subtasks still running. It is safe to call
+// more than once.
+func (t *ProgressTask) Done() {
+	if t == nil {
+		return
+	}
+	p := t.progress
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running := p.active[:0]
+	for _, task := range p.active {
+		if task.within(t) {
+			task.done = true
+		} else {
+			running = append(running, task)
+		}
+	}
+	p.active = running
+	if p.latest != nil && p.latest.done {
+		p.latest = nil
+		if len(p.active) > 0 {
+			p.latest = p.active[len(p.active)-1]
+		}
+	}
+	p.render()
+}
+
+func (p *Progress) start(parent *ProgressTask, message string) *ProgressTask {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t := &ProgressTask{progress: p, parent: parent, message: message}
+	if parent != nil && parent.done {
+		t.done = true
+		return t
+	}
+	p.active = append(p.active, t)
+	p.latest = t
+	p.render()
+	return t
+}
+
+// within reports whether t is task or one of its subtasks
+func (t *ProgressTask) within(task *ProgressTask) bool {
+	for ; t != nil; t = t.parent {
+		if t == task {
+			return true
+		}
+	}
+	return false
+}
+
+// render shows the messages from the latest task's root down to it. The
+// caller holds p.mu.
+func (p *Progress) render() {
+	if p.latest == nil {
+		if p.shown != "" {
+			p.shown = ""
+			p.out.clear()
+		}
+		return
+	}
+	var messages []string
+	for t := p.latest; t != nil; t = t.parent {
+		if t.message != "" {
+			messages = append([]string{strings.TrimSuffix(t.message, "...")}, messages...)
+		}
+	}
+	line := strings.Join(messages, ": ") + "..."
+	if line != p.shown {
+		p.shown = line
+		p.out.show(line)
+	}
+}
+
+// spinnerProgress animates the progress line on a terminal, in the same
+// style as the gh CLI (CharSet 11 - dots)
+type spinnerProgress struct {
+	s *spinner.Spinner
+}
+
+func newSpinnerProgress(w io.Writer) spinnerProgress {
+	s := spinner.New(spinner.CharSets[11], 120*time.Millisecond, spinner.WithWriter(w))
+	s.FinalMSG = ""
+	return spinnerProgress{s: s}
+}
+
+func (o spinnerProgress) show(line string) {
+	o.s.Lock()
+	o.s.Suffix = " " + line
+	o.s.Unlock()
+	o.s.Start() // No-op while running
+}
+
+func (o spinnerProgress) clear() {
+	o.s.Stop()
+}
+
+// lineProgress prints each progress line once, for logs and CI output
+type lineProgress struct {
+	w io.Writer
+}
+
+func (o lineProgress) show(line string) {
+	fmt.Fprintln(o.w, line)
+}
+
+func (o lineProgress) clear() {}
+
+// nopProgress shows nothing (--quiet)
+type nopProgress struct{}
+
+func (nopProgress) show(string) {}
+func (nopProgress) clear()      {}
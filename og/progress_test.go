@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordProgress records the lines a Progress shows
+type recordProgress struct {
+	lines   []string
+	cleared int
+}
+
+func (r *recordProgress) show(line string) { r.lines = append(r.lines, line) }
+func (r *recordProgress) clear()           { r.cleared++ }
+
+func TestProgressNestedTasks(t *testing.T) {
+	out := &recordProgress{}
+	p := &Progress{out: out}
+
+	task := p.Start("Comparing projects...")
+	sub := task.Start("searching illumos (1/2)")
+	sub.Update("searching illumos (1/2)") // Unchanged: not shown again
+	sub.Updatef("searching %s (%d/%d)", "freebsd", 2, 2)
+	sub.Done()
+	task.Done()
+	task.Done()
+
+	want := []string{
+		"Comparing projects...",
+		"Comparing projects: searching illumos (1/2)...",
+		"Comparing projects: searching freebsd (2/2)...",
+		"Comparing projects...",
+	}
+	if strings.Join(out.lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("shown:\n%s\nwant:\n%s", strings.Join(out.lines, "\n"), strings.Join(want, "\n"))
+	}
+	if out.cleared != 1 {
+		t.Errorf("cleared %d times, want 1", out.cleared)
+	}
+}
+
+func TestProgressDoneFinishesSubtasks(t *testing.T) {
+	out := &recordProgress{}
+	p := &Progress{out: out}
+
+	task := p.Start("Tracing...")
+	sub := task.Start("level 2")
+	task.Done()
+	sub.Update("level 3") // Ignored: its parent is done
+	if len(p.active) != 0 || out.lines[len(out.lines)-1] != "Tracing: level 2..." || out.cleared != 1 {
+		t.Errorf("active = %d, shown = %v, cleared = %d", len(p.active), out.lines, out.cleared)
+	}
+
+	// A nil task (no progress wanted) ignores everything
+	var none *ProgressTask
+	none.Start("x").Updatef("%d", 1)
+	none.Done()
+}
+
+func TestProgressConcurrentTasks(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	p := &Progress{out: lineProgress{w: lockedWriter{&buf, &mu}}}
+
+	task := p.Start("Searching...")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sub := task.Start(fmt.Sprintf("project %d", i))
+			sub.Updatef("project %d done", i)
+			sub.Done()
+		}(i)
+	}
+	wg.Wait()
+	task.Done()
+
+	if len(p.active) != 0 || p.latest != nil {
+		t.Errorf("tasks left running: %d", len(p.active))
+	}
+	if !strings.HasPrefix(buf.String(), "Searching...\n") {
+		t.Errorf("output = %q", buf.String())
+	}
+}
+
+type lockedWriter struct {
+	buf *bytes.Buffer
+	mu  *sync.Mutex
+}
+
+func (w lockedWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
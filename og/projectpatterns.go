@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxPatternProjects is the most projects one --projects pattern may expand
+// to; a pattern matching more is more likely a slip than a plan
+const maxPatternProjects = 50
+
+// projectListTTL is how long the server's project list is reused for
+// expanding patterns before it is fetched again
+const projectListTTL = time.Hour
+
+// isProjectPattern reports whether a project list item is a glob pattern
+// ("linux-*", "illumos-20??") rather than a project name
+func isProjectPattern(item string) bool {
+	return strings.ContainsAny(item, "*?[")
+}
+
+// expandProjectPatterns replaces glob patterns in a comma-separated project
+// list with the projects they match, sorted. projects returns the server's
+// projects; it is only called when the list has a pattern. A pattern
+// matching no project, or more than maxPatternProjects, is an error that
+// lists what it matched. Duplicates are removed, keeping the first
+// occurrence.
+func expandProjectPatterns(list string, projects func() ([]string, error)) (string, error) {
+	items := splitProjectList(list)
+	hasPattern := false
+	for _, item := range items {
+		hasPattern = hasPattern || isProjectPattern(item)
+	}
+	if !hasPattern {
+		return list, nil
+	}
+
+	all, err := projects()
+	if err != nil {
+		return "", fmt.Errorf("listing projects to expand patterns: %w", err)
+	}
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			expanded = append(expanded, name)
+		}
+	}
+	for _, item := range items {
+		if !isProjectPattern(item) {
+			add(item)
+			continue
+		}
+		matches, err := matchProjects(item, all)
+		if err != nil {
+			return "", err
+		}
+		for _, name := range matches {
+			add(name)
+		}
+	}
+	return strings.Join(expanded, ","), nil
+}
+
+// matchProjects returns the projects matching pattern, sorted
+func matchProjects(pattern string, all []string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid project pattern %q", pattern)
+	}
+	var matches []string
+	for _, name := range all {
+		if ok, _ := path.Match(pattern, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	switch {
+	case len(matches) == 0:
+		return nil, fmt.Errorf("no project matches %q (see 'og projects')", pattern)
+	case len(matches) > maxPatternProjects:
+		return nil, fmt.Errorf("project pattern %q matches %d projects, more than %d: %s\nNarrow the pattern, or name the projects in a group with 'og config group'",
+			pattern, len(matches), maxPatternProjects, strings.Join(matches, ", "))
+	}
+	return matches, nil
+}
+
+// expandLevelProjectPatterns expands patterns in each --level-projects
+// entry, leaving "*" (all projects) as is
+func expandLevelProjectPatterns(levels []string, projects func() ([]string, error)) ([]string, error) {
+	var expanded []string
+	for _, level := range levels {
+		if strings.TrimSpace(level) == "*" {
+			expanded = append(expanded, level)
+			continue
+		}
+		list, err := expandProjectPatterns(level, projects)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, list)
+	}
+	return expanded, nil
+}
+
+// projectListCache is the file of project lists fetched for expanding
+// patterns, one per server URL
+type projectListCache map[string]cachedProjectList
+
+type cachedProjectList struct {
+	Fetched  time.Time `json:"fetched"`
+	Projects []string  `json:"projects"`
+}
+
+// getProjectListCachePathDefault returns where project lists are kept
+// between runs, in the user's cache directory
+func getProjectListCachePathDefault() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "og", "projects.json"), nil
+}
+
+// getProjectListCachePath is a variable that can be overridden in tests
+var getProjectListCachePath = getProjectListCachePathDefault
+
+// cachedProjects returns a lister of the client's server's projects for
+// expandProjectPatterns: a list fetched within projectListTTL is reused, so
+// a pattern costs one request an hour rather than one per command. Failing
+// to read or write the cache only costs the request.
+func cachedProjects(client *Client) func() ([]string, error) {
+	return func() ([]string, error) {
+		cachePath, pathErr := getProjectListCachePath()
+		cache := projectListCache{}
+		if pathErr == nil {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				json.Unmarshal(data, &cache)
+			}
+			if entry, ok := cache[client.BaseURL]; ok && time.Since(entry.Fetched) < projectListTTL {
+				return entry.Projects, nil
+			}
+		}
+
+		projects, err := client.GetProjects()
+		if err != nil {
+			return nil, err
+		}
+		if pathErr == nil {
+			cache[client.BaseURL] = cachedProjectList{Fetched: time.Now().UTC(), Projects: projects}
+			if data, err := json.MarshalIndent(cache, "", "  "); err == nil && os.MkdirAll(filepath.Dir(cachePath), 0755) == nil {
+				os.WriteFile(cachePath, append(data, '\n'), 0644)
+			}
+		}
+		return projects, nil
+	}
+}
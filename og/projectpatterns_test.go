@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandProjectPatterns(t *testing.T) {
+	all := []string{"linux-6.1", "linux-5.10", "linux-tools", "illumos-gate", "smartos-live"}
+	listed := 0
+	projects := func() ([]string, error) {
+		listed++
+		return all, nil
+	}
+
+	got, err := expandProjectPatterns("illumos-gate,linux-[0-9]*,linux-6.1", projects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "illumos-gate,linux-5.10,linux-6.1"; got != want {
+		t.Errorf("expandProjectPatterns() = %q, want %q", got, want)
+	}
+
+	listed = 0
+	if got, _ := expandProjectPatterns("illumos-gate, smartos-live", projects); got != "illumos-gate, smartos-live" || listed != 0 {
+		t.Errorf("a list without patterns = %q after %d listings, want it unchanged and unlisted", got, listed)
+	}
+
+	if _, err := expandProjectPatterns("freebsd-*", projects); err == nil || !strings.Contains(err.Error(), `no project matches "freebsd-*"`) {
+		t.Errorf("no match: err = %v", err)
+	}
+	if _, err := expandProjectPatterns("linux-[", projects); err == nil || !strings.Contains(err.Error(), "invalid project pattern") {
+		t.Errorf("bad pattern: err = %v", err)
+	}
+}
+
+func TestExpandProjectPatternsTooMany(t *testing.T) {
+	var all []string
+	for i := 0; i <= maxPatternProjects; i++ {
+		all = append(all, fmt.Sprintf("linux-%d", i))
+	}
+	_, err := expandProjectPatterns("linux-*", func() ([]string, error) { return all, nil })
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("matches %d projects", len(all))) || !strings.Contains(err.Error(), "linux-0, linux-1,") {
+		t.Errorf("err = %v, want the matches listed", err)
+	}
+}
+
+func TestExpandLevelProjectPatterns(t *testing.T) {
+	projects := func() ([]string, error) { return []string{"linux-6.1", "linux-5.10"}, nil }
+	got, err := expandLevelProjectPatterns([]string{"linux-6*", "*"}, projects)
+	if err != nil || strings.Join(got, "|") != "linux-6.1|*" {
+		t.Errorf("expandLevelProjectPatterns() = %q, %v", got, err)
+	}
+}
+
+func TestCachedProjects(t *testing.T) {
+	oldPath := getProjectListCachePath
+	defer func() { getProjectListCachePath = oldPath }()
+	cachePath := filepath.Join(t.TempDir(), "projects.json")
+	getProjectListCachePath = func() (string, error) { return cachePath, nil }
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`["linux-6.1","linux-5.10"]`))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		projects, err := cachedProjects(client)()
+		if err != nil || strings.Join(projects, ",") != "linux-6.1,linux-5.10" {
+			t.Fatalf("cachedProjects() = %v, %v", projects, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("%d project list requests, want 1 with the second answered from the cache", requests)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Labels for files without an extension and files at the project root
+const (
+	noExtension = "(none)"
+	topLevel    = "(top level)"
+)
+
+// statsBarWidth is the width of the longest bar in the dashboard
+const statsBarWidth = 30
+
+// StatCount is the number of files in one category
+type StatCount struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+}
+
+// RepositoryInfo describes one repository of a project
+type RepositoryInfo struct {
+	Path    string `json:"path"`
+	Type    string `json:"type,omitempty"`
+	Branch  string `json:"branch,omitempty"`
+	Version string `json:"version,omitempty"` // Current revision
+}
+
+// ProjectStats profiles an indexed project
+type ProjectStats struct {
+	Project     string      `json:"project"`
+	Files       int         `json:"files"`
+	Types       []StatCount `json:"types"`       // By extension, most files first
+	Directories []StatCount `json:"directories"` // By top-level directory, most files first
+	// Repositories is empty when the server doesn't expose them; see
+	// RepositoryError
+	Repositories    []RepositoryInfo `json:"repositories"`
+	RepositoryError string           `json:"repositoryError,omitempty"`
+}
+
+// CollectProjectStats fetches a project's file list and repositories and
+// aggregates them. The file list is required; repository details are often
+// restricted to the server's administrators, so failing to read them is
+// reported in the stats instead. Steps are shown as subtasks of task, which
+// may be nil.
+func CollectProjectStats(ctx context.Context, client *Client, project string, task *ProgressTask) (*ProjectStats, error) {
+	step := task.Start("listing files")
+	files, err := client.GetProjectFilesContext(ctx, project)
+	step.Done()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s: %w", project, err)
+	}
+	stats := summarizeProjectFiles(project, files)
+
+	step = task.Start("reading repositories")
+	defer step.Done()
+	repos, err := client.GetProjectRepositoriesContext(ctx, project)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		stats.RepositoryError = err.Error()
+		return stats, nil
+	}
+	sort.Strings(repos)
+	stats.Repositories = []RepositoryInfo{}
+	for _, repo := range repos {
+		info := RepositoryInfo{Path: repo}
+		for _, field := range []struct {
+			name  string
+			value *string
+		}{
+			{"type", &info.Type},
+			{"branch", &info.Branch},
+			{"currentVersion", &info.Version},
+		} {
+			// Properties are best effort; older servers lack some
+			value, err := client.GetRepositoryPropertyContext(ctx, repo, field.name)
+			if err != nil && ctx.Err() != nil {
+				return nil, err
+			}
+			*field.value = value
+		}
+		stats.Repositories = append(stats.Repositories, info)
+	}
+	return stats, nil
+}
+
+// summarizeProjectFiles counts a project's files by extension and top-level
+// directory. Paths may start with "/project/" or be relative to the project.
+func summarizeProjectFiles(project string, files []string) *ProjectStats {
+	types := make(map[string]int)
+	dirs := make(map[string]int)
+	for _, f := range files {
+		rel := strings.TrimPrefix(f, "/")
+		rel = strings.TrimPrefix(rel, project+"/")
+
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(rel), "."))
+		if base := path.Base(rel); ext == "" || "."+ext == strings.ToLower(base) {
+			// Dot-files such as .gitignore have no extension either
+			ext = noExtension
+		}
+		types[ext]++
+
+		dir, _, nested := strings.Cut(rel, "/")
+		if !nested {
+			dir = topLevel
+		}
+		dirs[dir]++
+	}
+	return &ProjectStats{
+		Project:     project,
+		Files:       len(files),
+		Types:       sortedStatCounts(types),
+		Directories: sortedStatCounts(dirs),
+	}
+}
+
+// sortedStatCounts orders counts by file count, then name
+func sortedStatCounts(counts map[string]int) []StatCount {
+	sorted := make([]StatCount, 0, len(counts))
+	for name, n := range counts {
+		sorted = append(sorted, StatCount{Name: name, Files: n})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Files != sorted[j].Files {
+			return sorted[i].Files > sorted[j].Files
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// printProjectStats prints the stats as a terminal dashboard, showing the top
+// categories of each breakdown (all with top 0) and folding the rest into
+// one row
+func printProjectStats(w io.Writer, stats *ProjectStats, top int, useColor bool) {
+	heading := func(s string) {
+		if useColor {
+			fmt.Fprintf(w, "\n%s%s%s\n", colorBold, s, colorReset)
+		} else {
+			fmt.Fprintf(w, "\n%s\n", s)
+		}
+	}
+
+	name := stats.Project
+	if useColor {
+		name = colorMagenta + name + colorReset
+	}
+	summary := fmt.Sprintf("%s: %d indexed files", name, stats.Files)
+	if stats.RepositoryError == "" {
+		summary += fmt.Sprintf(" in %d repositories", len(stats.Repositories))
+	}
+	fmt.Fprintln(w, summary)
+	if stats.Files == 0 {
+		return
+	}
+
+	heading("File types")
+	printStatCounts(w, stats.Types, stats.Files, top, "types", useColor)
+	heading("Top-level directories")
+	printStatCounts(w, stats.Directories, stats.Files, top, "directories", useColor)
+
+	heading("Repositories")
+	if stats.RepositoryError != "" {
+		fmt.Fprintf(w, "  (unavailable: %s)\n", stats.RepositoryError)
+		return
+	}
+	if len(stats.Repositories) == 0 {
+		fmt.Fprintln(w, "  (none)")
+		return
+	}
+	for _, r := range stats.Repositories {
+		var details []string
+		for _, d := range []string{r.Type, r.Branch, r.Version} {
+			if d != "" {
+				details = append(details, d)
+			}
+		}
+		repoPath := r.Path
+		if useColor {
+			repoPath = colorCyan + repoPath + colorReset
+		}
+		fmt.Fprintf(w, "  %s  %s\n", repoPath, strings.Join(details, "  "))
+	}
+}
+
+// printStatCounts prints one breakdown as rows of name, count, share and bar
+func printStatCounts(w io.Writer, counts []StatCount, total, top int, noun string, useColor bool) {
+	shown := counts
+	var rest StatCount
+	if top > 0 && len(counts) > top {
+		shown = counts[:top]
+		for _, c := range counts[top:] {
+			rest.Files += c.Files
+		}
+		rest.Name = fmt.Sprintf("(%d more %s)", len(counts)-top, noun)
+	}
+
+	nameWidth, countWidth := len(rest.Name), len(fmt.Sprint(rest.Files))
+	for _, c := range shown {
+		nameWidth = max(nameWidth, len(c.Name))
+		countWidth = max(countWidth, len(fmt.Sprint(c.Files)))
+	}
+	largest := max(rest.Files, 1)
+	if len(shown) > 0 {
+		largest = max(largest, shown[0].Files)
+	}
+
+	row := func(c StatCount) {
+		bar := strings.Repeat("#", max(1, c.Files*statsBarWidth/largest))
+		if useColor {
+			bar = colorCyan + bar + colorReset
+		}
+		fmt.Fprintf(w, "  %-*s  %*d  %5.1f%%  %s\n", nameWidth, c.Name, countWidth, c.Files, 100*float64(c.Files)/float64(total), bar)
+	}
+	for _, c := range shown {
+		row(c)
+	}
+	if rest.Files > 0 {
+		row(rest)
+	}
+}
+
+// writeProjectStatsJSON writes the stats as indented JSON
+func writeProjectStatsJSON(w io.Writer, stats *ProjectStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(stats)
+}
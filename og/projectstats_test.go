@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSummarizeProjectFiles(t *testing.T) {
+	stats := summarizeProjectFiles("proj", []string{
+		"/proj/usr/src/a.c",
+		"/proj/usr/src/b.C",
+		"/proj/usr/include/a.h",
+		"/proj/Makefile",
+		"/proj/.gitignore",
+		"lib/c.c",
+	})
+	if stats.Files != 6 {
+		t.Errorf("files = %d, want 6", stats.Files)
+	}
+	wantTypes := []StatCount{{"c", 3}, {noExtension, 2}, {"h", 1}}
+	if len(stats.Types) != len(wantTypes) {
+		t.Fatalf("types = %v, want %v", stats.Types, wantTypes)
+	}
+	for i, want := range wantTypes {
+		if stats.Types[i] != want {
+			t.Errorf("types[%d] = %v, want %v", i, stats.Types[i], want)
+		}
+	}
+	wantDirs := []StatCount{{"usr", 3}, {topLevel, 2}, {"lib", 1}}
+	for i, want := range wantDirs {
+		if i >= len(stats.Directories) || stats.Directories[i] != want {
+			t.Errorf("directories = %v, want %v", stats.Directories, wantDirs)
+			break
+		}
+	}
+}
+
+func TestPrintProjectStats(t *testing.T) {
+	stats := &ProjectStats{
+		Project:      "proj",
+		Files:        10,
+		Types:        []StatCount{{"c", 6}, {"h", 3}, {"md", 1}},
+		Directories:  []StatCount{{"usr", 10}},
+		Repositories: []RepositoryInfo{{Path: "/proj", Type: "git", Branch: "master"}},
+	}
+	var buf bytes.Buffer
+	printProjectStats(&buf, stats, 2, false)
+	want := "proj: 10 indexed files in 1 repositories\n" +
+		"\nFile types\n" +
+		"  c               6   60.0%  ##############################\n" +
+		"  h               3   30.0%  ###############\n" +
+		"  (1 more types)  1   10.0%  #####\n" +
+		"\nTop-level directories\n" +
+		"  usr  10  100.0%  ##############################\n" +
+		"\nRepositories\n" +
+		"  /proj  git  master\n"
+	if buf.String() != want {
+		t.Errorf("dashboard =\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestCollectProjectStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/projects/proj/files":
+			json.NewEncoder(w).Encode([]string{"/proj/a.c", "/proj/src/b.c"})
+		case "/api/v1/projects/proj/repositories":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := CollectProjectStats(context.Background(), client, "proj", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Repository details are optional
+	if stats.Files != 2 || stats.RepositoryError == "" || stats.Repositories != nil {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+)
+
+// QueryOptions describes how a raw command-line query is turned into a Lucene query
+type QueryOptions struct {
+	Phrase bool     // Treat the query as an exact phrase
+	And    []string // Terms that must also match
+	Or     []string // Alternatives to the main query
+	Not    []string // Terms that must not match
+}
+
+// luceneSpecial are the characters Lucene's query parser reads as syntax,
+// apart from the * and ? wildcards
+const luceneSpecial = `+-&|!(){}[]^"~:\/`
+
+// luceneKeywords are the words Lucene reads as operators
+var luceneKeywords = map[string]bool{"AND": true, "OR": true, "NOT": true, "TO": true}
+
+// quotePhrase wraps s in double quotes for an exact phrase match.
+// Embedded quotes and backslashes are escaped, and runs of whitespace
+// (including newlines from multi-line input) collapse to a single space
+// since OpenGrok tokenizes on whitespace anyway.
+func quotePhrase(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// isQuoted returns true if s is already a double-quoted phrase
+func isQuoted(s string) bool {
+	return len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`)
+}
+
+// queryTerm prepares an additional --and/--or/--not term, which is text to
+// match rather than Lucene syntax: terms containing whitespace are quoted so
+// they match as a phrase instead of as separate words, an operator word is
+// quoted so it matches as a word, and other syntax characters are escaped.
+// A term that is already quoted is used as it is; * and ? stay wildcards.
+func queryTerm(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case isQuoted(s):
+		return s
+	case strings.ContainsAny(s, " \t\r\n") || luceneKeywords[s]:
+		return quotePhrase(s)
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(luceneSpecial, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// BuildQuery composes the final query string sent to the server.
+// With alternatives, required and excluded terms the result has the form
+// (query OR alt1 OR alt2) AND req1 AND req2 AND NOT excl1. The query itself
+// is Lucene syntax and sent as it is; the terms are escaped (see queryTerm).
+func BuildQuery(query string, opts QueryOptions) string {
+	if opts.Phrase && !isQuoted(strings.TrimSpace(query)) {
+		query = quotePhrase(query)
+	}
+	if len(opts.And) == 0 && len(opts.Or) == 0 && len(opts.Not) == 0 {
+		return query
+	}
+
+	main := query
+	if len(opts.Or) > 0 {
+		alts := []string{query}
+		for _, term := range opts.Or {
+			alts = append(alts, queryTerm(term))
+		}
+		main = "(" + strings.Join(alts, " OR ") + ")"
+	} else if strings.Contains(query, " ") && !isQuoted(query) {
+		// Keep a multi-word query grouped so AND binds to all of it
+		main = "(" + query + ")"
+	}
+
+	parts := []string{main}
+	for _, term := range opts.And {
+		parts = append(parts, queryTerm(term))
+	}
+	for _, term := range opts.Not {
+		parts = append(parts, "NOT "+queryTerm(term))
+	}
+	return strings.Join(parts, " AND ")
+}
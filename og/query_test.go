@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQuotePhrase(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"simple", "out of memory", `"out of memory"`},
+		{"embedded quotes", `say "hi"`, `"say \"hi\""`},
+		{"backslash", `a\b`, `"a\\b"`},
+		{"multi-line collapses whitespace", "foo(\n    bar)", `"foo( bar)"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := quotePhrase(tt.input); got != tt.expected {
+				t.Errorf("quotePhrase(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		opts     QueryOptions
+		expected string
+	}{
+		{"passthrough", "foo bar", QueryOptions{}, "foo bar"},
+		{"lucene passthrough", `foo AND "bar baz"`, QueryOptions{}, `foo AND "bar baz"`},
+		{"phrase", "out of memory", QueryOptions{Phrase: true}, `"out of memory"`},
+		{"phrase already quoted", `"exact"`, QueryOptions{Phrase: true}, `"exact"`},
+		{"and", "malloc", QueryOptions{And: []string{"free"}}, "malloc AND free"},
+		{"and groups multi-word query", "foo bar", QueryOptions{And: []string{"baz"}}, "(foo bar) AND baz"},
+		{"and term with space is quoted", "malloc", QueryOptions{And: []string{"null pointer"}}, `malloc AND "null pointer"`},
+		{"or", "malloc", QueryOptions{Or: []string{"calloc", "realloc"}}, "(malloc OR calloc OR realloc)"},
+		{
+			"phrase with or and and",
+			"out of memory",
+			QueryOptions{Phrase: true, Or: []string{"ENOMEM"}, And: []string{"kmalloc"}},
+			`("out of memory" OR ENOMEM) AND kmalloc`,
+		},
+		{"not", "malloc", QueryOptions{Not: []string{"free", "test code"}}, `malloc AND NOT free AND NOT "test code"`},
+		{"not groups multi-word query", "foo OR bar", QueryOptions{Not: []string{"baz"}}, "(foo OR bar) AND NOT baz"},
+		{
+			"or, and and not",
+			"kmalloc",
+			QueryOptions{Or: []string{"vmalloc"}, And: []string{"GFP_KERNEL"}, Not: []string{"kfree"}},
+			"(kmalloc OR vmalloc) AND GFP_KERNEL AND NOT kfree",
+		},
+		{"terms are escaped", "x", QueryOptions{And: []string{"foo(", "a:b"}, Not: []string{"-v"}}, `x AND foo\( AND a\:b AND NOT \-v`},
+		{"operator word is quoted", "x", QueryOptions{Or: []string{"OR"}}, `(x OR "OR")`},
+		{"wildcards and quoted terms kept", "x", QueryOptions{And: []string{"kmem_*", `"a:b"`}}, `x AND kmem_* AND "a:b"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildQuery(tt.query, tt.opts); got != tt.expected {
+				t.Errorf("BuildQuery(%q) = %q, want %q", tt.query, got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestSearchQueryEncodingRoundTrip verifies that queries with characters that are
+// special in URLs or Lucene arrive at the server unchanged
+func TestSearchQueryEncodingRoundTrip(t *testing.T) {
+	queries := []string{
+		`"out of memory"`,
+		`a+b && c || !d`,
+		`foo#bar?baz=1&x=%20`,
+		`("out of memory" OR ENOMEM) AND kmalloc`,
+		"path/with spaces/and\ttabs",
+		`unicode ✓ 日本語`,
+		`field:value~0.8 [a TO b] {c TO d} ^2 \*`,
+	}
+
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.URL.Query().Get("full")
+				w.Write([]byte(`{"resultCount":0,"results":{}}`))
+			}))
+			defer server.Close()
+
+			client, err := NewClient(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.Search(SearchOptions{Full: query}); err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if got != query {
+				t.Errorf("server received %q, want %q", got, query)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// hitReplacer previews --replace: the regex replacement applied to the hit
+// lines of a search in their local checkouts. It only reads files.
+type hitReplacer struct {
+	Pattern *regexp.Regexp
+	// With is the replacement, with $1 or ${name} for submatches
+	With  string
+	Local *localPaths
+}
+
+// replaceFile is one local file --replace would change
+type replaceFile struct {
+	Path    string // The local file
+	Changes []lineChange
+}
+
+// lineChange is one line --replace would change
+type lineChange struct {
+	Line     int
+	Old, New string
+}
+
+// replacePreview is what --replace would do to a search's hits
+type replacePreview struct {
+	Files []replaceFile
+	// Lines counts the lines that would change
+	Lines int
+	// Unmatched counts hit lines the pattern doesn't match in the local
+	// file (the checkout differs from the index, or the hit isn't what
+	// the pattern is after)
+	Unmatched int
+	// Failed lists "path: error" for local files that couldn't be read
+	Failed []string
+}
+
+// preview applies the replacement to every line hit in resp that has a
+// local copy (see localPaths), files in result order. Hits without a local
+// checkout are left for r.Local.warn to report.
+func (r *hitReplacer) preview(resp *SearchResponse) replacePreview {
+	var preview replacePreview
+	var order []string
+	hits := make(map[string][]int) // Local file to its hit lines
+	for _, entry := range resp.OrderedEntries() {
+		line, err := strconv.Atoi(string(entry.LineNo))
+		if err != nil || line < 1 {
+			continue
+		}
+		local := r.Local.resolve(entry.Project, entry.FilePath())
+		if local == "" {
+			continue
+		}
+		if _, ok := hits[local]; !ok {
+			order = append(order, local)
+		}
+		hits[local] = append(hits[local], line)
+	}
+
+	for _, path := range order {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			preview.Failed = append(preview.Failed, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		lines := strings.Split(string(data), "\n")
+		file := replaceFile{Path: path}
+		seen := make(map[int]bool)
+		sort.Ints(hits[path])
+		for _, n := range hits[path] {
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+			if n > len(lines) {
+				preview.Unmatched++
+				continue
+			}
+			old := lines[n-1]
+			replaced := r.Pattern.ReplaceAllString(old, r.With)
+			if replaced == old {
+				preview.Unmatched++
+				continue
+			}
+			file.Changes = append(file.Changes, lineChange{Line: n, Old: old, New: replaced})
+		}
+		if len(file.Changes) > 0 {
+			preview.Files = append(preview.Files, file)
+			preview.Lines += len(file.Changes)
+		}
+	}
+	return preview
+}
+
+// printReplaceDiff prints the preview as a unified diff without context,
+// one hunk per run of adjacent changed lines
+func printReplaceDiff(w io.Writer, preview replacePreview, useColor bool) {
+	paint := func(color, s string) string {
+		if useColor {
+			return color + s + colorReset
+		}
+		return s
+	}
+	for _, file := range preview.Files {
+		fmt.Fprintln(w, paint(colorBold, "--- "+file.Path))
+		fmt.Fprintln(w, paint(colorBold, "+++ "+file.Path))
+		for start := 0; start < len(file.Changes); {
+			end := start + 1
+			for end < len(file.Changes) && file.Changes[end].Line == file.Changes[end-1].Line+1 {
+				end++
+			}
+			hunk := file.Changes[start:end]
+			span := strconv.Itoa(hunk[0].Line)
+			if len(hunk) > 1 {
+				span += "," + strconv.Itoa(len(hunk))
+			}
+			fmt.Fprintln(w, paint(colorCyan, fmt.Sprintf("@@ -%s +%s @@", span, span)))
+			for _, c := range hunk {
+				fmt.Fprintln(w, paint(colorRed, "-"+c.Old))
+			}
+			for _, c := range hunk {
+				fmt.Fprintln(w, paint(colorGreen, "+"+c.New))
+			}
+			start = end
+		}
+	}
+}
+
+// printReplaceSummary reports what the preview covered; nothing is written
+func printReplaceSummary(w io.Writer, preview replacePreview) {
+	fmt.Fprintf(w, "%d lines would change in %d files (dry run; no files were written)\n", preview.Lines, len(preview.Files))
+	if preview.Unmatched > 0 {
+		fmt.Fprintf(w, "%d hit lines don't match the pattern in their local file\n", preview.Unmatched)
+	}
+	for _, failure := range preview.Failed {
+		fmt.Fprintf(w, "  failed: %s\n", failure)
+	}
+}
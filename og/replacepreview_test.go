@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestReplacePreview(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "src"), 0755)
+	os.WriteFile(filepath.Join(root, "src", "a.c"), []byte("p = kmem_alloc(n, KM_SLEEP);\nq = kmem_alloc(m, KM_SLEEP);\nfree(p);\nr = kmem_alloc(k, KM_SLEEP);\n"), 0644)
+
+	resp := &SearchResponse{Entries: []ResultEntry{
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "1"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "2"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "2"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "3"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/a.c", LineNo: "4"}},
+		{Project: "proj", SearchResult: SearchResult{Path: "/proj/src/gone.c", LineNo: "1"}},
+		{Project: "other", SearchResult: SearchResult{Path: "/other/x.c", LineNo: "1"}},
+	}}
+	r := &hitReplacer{
+		Pattern: regexp.MustCompile(`kmem_alloc\((\w+), KM_SLEEP\)`),
+		With:    "kmem_zalloc($1, KM_SLEEP)",
+		Local:   newLocalPaths(map[string]string{"proj": root}),
+	}
+	preview := r.preview(resp)
+	if preview.Lines != 3 || preview.Unmatched != 1 || len(preview.Files) != 1 || len(preview.Failed) != 0 {
+		t.Fatalf("preview = %+v", preview)
+	}
+
+	var buf bytes.Buffer
+	printReplaceDiff(&buf, preview, false)
+	path := filepath.Join(root, "src", "a.c")
+	want := strings.Join([]string{
+		"--- " + path,
+		"+++ " + path,
+		"@@ -1,2 +1,2 @@",
+		"-p = kmem_alloc(n, KM_SLEEP);",
+		"-q = kmem_alloc(m, KM_SLEEP);",
+		"+p = kmem_zalloc(n, KM_SLEEP);",
+		"+q = kmem_zalloc(m, KM_SLEEP);",
+		"@@ -4 +4 @@",
+		"-r = kmem_alloc(k, KM_SLEEP);",
+		"+r = kmem_zalloc(k, KM_SLEEP);",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("printReplaceDiff() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// The file is only read
+	if data, _ := os.ReadFile(path); !strings.HasPrefix(string(data), "p = kmem_alloc(") {
+		t.Errorf("file was modified: %q", data)
+	}
+
+	buf.Reset()
+	r.Local.warn(&buf)
+	if out := buf.String(); !strings.Contains(out, "no local checkout configured for other") || !strings.Contains(out, "1 files not found") {
+		t.Errorf("warnings = %q", out)
+	}
+}
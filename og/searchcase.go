@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Case modes for searches, set with --ignore-case, --case-sensitive and
+// --smart-case or the search_case setting. Without one, searches match as
+// the server indexes each field: full, path and hist ignore case, def and
+// symbol don't.
+const (
+	caseIgnore    = "ignore"
+	caseSensitive = "sensitive"
+	caseSmart     = "smart" // Sensitive if the query has an uppercase letter
+)
+
+// caseModes are the values of the search_case setting
+var caseModes = []string{caseSmart, caseIgnore, caseSensitive}
+
+// isCaseMode reports whether name is one of caseModes
+func isCaseMode(name string) bool {
+	for _, m := range caseModes {
+		if name == m {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSearchCase picks the case mode from the flags, falling back to the
+// configured search_case; "" leaves matching to the server
+func resolveSearchCase(ignore, sensitive, smart bool, configured string) (string, error) {
+	var mode string
+	set := 0
+	for _, f := range []struct {
+		on   bool
+		mode string
+	}{{ignore, caseIgnore}, {sensitive, caseSensitive}, {smart, caseSmart}} {
+		if f.on {
+			mode = f.mode
+			set++
+		}
+	}
+	if set > 1 {
+		return "", fmt.Errorf("use only one of --ignore-case, --case-sensitive and --smart-case")
+	}
+	if set == 1 {
+		return mode, nil
+	}
+	if configured != "" && !isCaseMode(configured) {
+		return "", fmt.Errorf("search_case %q is not a case mode (%s)", configured, strings.Join(caseModes, ", "))
+	}
+	return configured, nil
+}
+
+// effectiveCase resolves smart case for a query's terms: case-sensitive if
+// any of them has an uppercase letter, as ripgrep does
+func effectiveCase(mode string, terms []string) string {
+	if mode != caseSmart {
+		return mode
+	}
+	for _, term := range terms {
+		if strings.IndexFunc(term, unicode.IsUpper) >= 0 {
+			return caseSensitive
+		}
+	}
+	return caseIgnore
+}
+
+// serverCaseSensitive reports whether the server matches a search type's
+// field case-sensitively: definitions and symbols are indexed as written,
+// full text, paths and history lowercased
+func serverCaseSensitive(searchType string) bool {
+	return searchType == "def" || searchType == "symbol"
+}
+
+// caseTerms returns the words of a query that a hit must match, case kept:
+// operators, excluded words (NOT, - or !) and regexes are skipped, field
+// prefixes and punctuation around words dropped. Wildcards inside a word
+// are kept.
+func caseTerms(query string) []string {
+	var terms []string
+	negated := false
+	for _, word := range strings.Fields(query) {
+		switch word {
+		case "AND", "OR", "&&", "||":
+			continue
+		case "NOT":
+			negated = true
+			continue
+		}
+		word = strings.TrimLeft(word, `("'+`)
+		if strings.HasPrefix(word, "-") || strings.HasPrefix(word, "!") || negated {
+			negated = false
+			continue
+		}
+		if i := strings.Index(word, ":"); i >= 0 && !strings.Contains(word, "::") {
+			word = word[i+1:]
+		}
+		word = strings.Trim(word, `"'()+~^`)
+		if word == "" || strings.HasPrefix(word, "/") {
+			continue
+		}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// plainTermRegex matches query words ignoreCaseQuery can rewrite:
+// identifiers, optionally with wildcards
+var plainTermRegex = regexp.MustCompile(`^[A-Za-z0-9_$.*?]+$`)
+
+// ignoreCaseQuery rewrites the words of a def or symbol query, which the
+// server matches case-sensitively, into Lucene regexes that match any case:
+// "Mutex*" becomes "/[mM][uU][tT][eE][xX].*/". Phrases, regexes, field
+// prefixes and operators are left as they are.
+func ignoreCaseQuery(query string) string {
+	words := strings.Fields(query)
+	inPhrase := false
+	for i, word := range words {
+		if inPhrase || strings.HasPrefix(strings.TrimLeft(word, "(+-!"), `"`) {
+			if strings.Count(word, `"`)%2 == 1 {
+				inPhrase = !inPhrase
+			}
+			continue
+		}
+		switch word {
+		case "AND", "OR", "NOT", "&&", "||":
+			continue
+		}
+		core := strings.TrimLeft(word, "(+-!")
+		prefix := word[:len(word)-len(core)]
+		core = strings.TrimRight(core, ")")
+		suffix := word[len(prefix)+len(core):]
+		if !plainTermRegex.MatchString(core) || strings.IndexFunc(core, unicode.IsLetter) < 0 {
+			continue
+		}
+		var re strings.Builder
+		for _, r := range core {
+			switch {
+			case unicode.IsLetter(r):
+				fmt.Fprintf(&re, "[%c%c]", unicode.ToLower(r), unicode.ToUpper(r))
+			case r == '*':
+				re.WriteString(".*")
+			case r == '?':
+				re.WriteString(".")
+			case r == '.' || r == '$':
+				re.WriteString(`\` + string(r))
+			default:
+				re.WriteRune(r)
+			}
+		}
+		words[i] = prefix + "/" + re.String() + "/" + suffix
+	}
+	return strings.Join(words, " ")
+}
+
+// caseContains reports whether s contains term with the same case. Wildcards
+// in term match anything: the text between them must appear in order.
+func caseContains(s, term string) bool {
+	for _, piece := range strings.FieldsFunc(term, func(r rune) bool { return r == '*' || r == '?' }) {
+		i := strings.Index(s, piece)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(piece):]
+	}
+	return true
+}
+
+// FilterCaseSensitive keeps the hits that match one of terms with its case,
+// for searches the server matches ignoring case, and returns the number of
+// hits dropped. Line hits are checked by the words the server highlighted
+// (the whole line when it highlighted none), path hits by their path.
+func FilterCaseSensitive(resp *SearchResponse, searchType string, terms []string) int {
+	if len(terms) == 0 {
+		return 0
+	}
+	entries := resp.OrderedEntries()
+	kept := make([]ResultEntry, 0, len(entries))
+	results := make(map[string][]SearchResult)
+	for _, r := range entries {
+		var candidates []string
+		if searchType == "path" {
+			candidates = []string{r.FilePath()}
+		} else {
+			text, spans := parseMatches(r.Line)
+			for _, s := range spans {
+				candidates = append(candidates, text[s.Start:s.End])
+			}
+			if len(candidates) == 0 {
+				candidates = []string{text}
+			}
+		}
+		if !matchesAnyCase(candidates, terms) {
+			continue
+		}
+		kept = append(kept, r)
+		results[r.Project] = append(results[r.Project], r.SearchResult)
+	}
+	dropped := len(entries) - len(kept)
+	if dropped > 0 {
+		resp.Entries = kept
+		resp.Results = results
+		resp.ResultCount = countResultFiles(kept)
+	}
+	return dropped
+}
+
+// matchesAnyCase reports whether one of candidates contains one of terms
+// with its case
+func matchesAnyCase(candidates, terms []string) bool {
+	for _, c := range candidates {
+		for _, term := range terms {
+			if caseContains(c, term) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveSearchCase(t *testing.T) {
+	tests := []struct {
+		name                     string
+		ignore, sensitive, smart bool
+		configured, want         string
+		wantErr                  bool
+	}{
+		{"server default", false, false, false, "", "", false},
+		{"configured", false, false, false, "smart", "smart", false},
+		{"flag over config", true, false, false, "sensitive", "ignore", false},
+		{"sensitive flag", false, true, false, "", "sensitive", false},
+		{"two flags", true, true, false, "", "", true},
+		{"bad config", false, false, false, "insensitive", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSearchCase(tt.ignore, tt.sensitive, tt.smart, tt.configured)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveCase(t *testing.T) {
+	if got := effectiveCase(caseSmart, []string{"mutex", "enter"}); got != caseIgnore {
+		t.Errorf("lowercase smart = %q, want ignore", got)
+	}
+	if got := effectiveCase(caseSmart, []string{"mutex", "Enter"}); got != caseSensitive {
+		t.Errorf("uppercase smart = %q, want sensitive", got)
+	}
+	if got := effectiveCase(caseIgnore, []string{"Mutex"}); got != caseIgnore {
+		t.Errorf("ignore = %q, want ignore", got)
+	}
+	if got := effectiveCase("", []string{"Mutex"}); got != "" {
+		t.Errorf("server = %q, want empty", got)
+	}
+}
+
+func TestCaseTerms(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"KM_SLEEP", []string{"KM_SLEEP"}},
+		{`"Hello World" AND foo*`, []string{"Hello", "World", "foo*"}},
+		{"(Mutex OR Lock) AND NOT Debug -Trace", []string{"Mutex", "Lock"}},
+		{"defs:Foo /[Bb]ar/ ns::Baz", []string{"Foo", "ns::Baz"}},
+	}
+	for _, tt := range tests {
+		if got := caseTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("caseTerms(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreCaseQuery(t *testing.T) {
+	tests := []struct {
+		query, want string
+	}{
+		{"foo", "/[fF][oO][oO]/"},
+		{"Mu*_x?", "/[mM][uU].*_[xX]./"},
+		{"(a1 OR b.c) AND -d", "(/[aA]1/ OR /[bB]\\.[cC]/) AND -/[dD]/"},
+		{`"Foo bar" baz`, `"Foo bar" /[bB][aA][zZ]/`},
+		{"/[Ff]oo/ defs:x 42", "/[Ff]oo/ defs:x 42"},
+	}
+	for _, tt := range tests {
+		if got := ignoreCaseQuery(tt.query); got != tt.want {
+			t.Errorf("ignoreCaseQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCaseContains(t *testing.T) {
+	tests := []struct {
+		s, term string
+		want    bool
+	}{
+		{"KM_SLEEP", "KM_SLEEP", true},
+		{"km_sleep", "KM_SLEEP", false},
+		{"MutexEnter", "Mutex*r", true},
+		{"EnterMutex", "Mutex*r", false},
+		{"anything", "*", true},
+	}
+	for _, tt := range tests {
+		if got := caseContains(tt.s, tt.term); got != tt.want {
+			t.Errorf("caseContains(%q, %q) = %v, want %v", tt.s, tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestFilterCaseSensitive(t *testing.T) {
+	resp := &SearchResponse{Results: map[string][]SearchResult{
+		"proj": {
+			{Path: "/proj/a.c", LineNo: "1", Line: "kmem_alloc(n, <b>KM_SLEEP</b>);"},
+			{Path: "/proj/a.c", LineNo: "2", Line: "/* <b>km_sleep</b> may block */"},
+			{Path: "/proj/b.c", LineNo: "3", Line: "flags = <b>Km_Sleep</b>;"},
+			{Path: "/proj/c.c", LineNo: "4", Line: "no highlight KM_SLEEP here"},
+		},
+	}}
+	if dropped := FilterCaseSensitive(resp, "full", []string{"KM_SLEEP"}); dropped != 2 {
+		t.Errorf("dropped %d, want 2", dropped)
+	}
+	var lines []string
+	for _, r := range resp.OrderedEntries() {
+		lines = append(lines, string(r.LineNo))
+	}
+	if want := []string{"1", "4"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("kept lines %v, want %v", lines, want)
+	}
+	if resp.ResultCount != 2 {
+		t.Errorf("ResultCount = %d, want 2", resp.ResultCount)
+	}
+
+	paths := &SearchResponse{Results: map[string][]SearchResult{
+		"proj": {{Path: "/proj/src/Makefile"}, {Path: "/proj/src/makefile.inc"}},
+	}}
+	if dropped := FilterCaseSensitive(paths, "path", []string{"Makefile"}); dropped != 1 {
+		t.Errorf("path search dropped %d, want 1", dropped)
+	}
+}
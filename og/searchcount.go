@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"og/pkg/opengrok"
+)
+
+// MatchCount is the number of files and line hits matching a query in one
+// project
+type MatchCount = opengrok.MatchCount
+
+// printMatchCounts prints 'og <search> --count': files and line hits per
+// project, most files first, with a bar scaled to the project with the most
+// files and a total line
+func printMatchCounts(w io.Writer, counts []MatchCount, useColor bool) {
+	if len(counts) == 0 {
+		fmt.Fprintln(w, "No results found.")
+		return
+	}
+	sort.SliceStable(counts, func(i, j int) bool {
+		if counts[i].Files != counts[j].Files {
+			return counts[i].Files > counts[j].Files
+		}
+		return counts[i].Project < counts[j].Project
+	})
+
+	var total MatchCount
+	for _, c := range counts {
+		total.Files += c.Files
+		total.Lines += c.Lines
+	}
+	// Path searches match files, not lines
+	showLines := total.Lines > 0
+	nameWidth := 0
+	if len(counts) > 1 {
+		nameWidth = len("total")
+	}
+	filesWidth, linesWidth := len(fmt.Sprint(total.Files)), len(fmt.Sprint(total.Lines))
+	for _, c := range counts {
+		nameWidth = max(nameWidth, len(c.Project))
+	}
+
+	columns := func(files, lines int) string {
+		s := fmt.Sprintf("%*d files", filesWidth, files)
+		if showLines {
+			s += fmt.Sprintf("  %*d lines", linesWidth, lines)
+		}
+		return s
+	}
+	largest := max(counts[0].Files, 1)
+	for _, c := range counts {
+		name := fmt.Sprintf("%-*s", nameWidth, c.Project)
+		bar := strings.Repeat("#", max(1, c.Files*statsBarWidth/largest))
+		if useColor {
+			name = colorMagenta + name + colorReset
+			bar = colorCyan + bar + colorReset
+		}
+		fmt.Fprintf(w, "  %s  %s  %s\n", name, columns(c.Files, c.Lines), bar)
+	}
+	if len(counts) > 1 {
+		fmt.Fprintf(w, "  %-*s  %s  in %d projects\n", nameWidth, "total", columns(total.Files, total.Lines), len(counts))
+	}
+}
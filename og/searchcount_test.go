@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintMatchCounts(t *testing.T) {
+	var buf bytes.Buffer
+	printMatchCounts(&buf, []MatchCount{
+		{Project: "drivers", Files: 3, Lines: 4},
+		{Project: "kernel", Files: 12, Lines: 130},
+		{Project: "libc", Files: 3, Lines: 3},
+	}, false)
+	want := "" +
+		"  kernel   12 files  130 lines  ##############################\n" +
+		"  drivers   3 files    4 lines  #######\n" +
+		"  libc      3 files    3 lines  #######\n" +
+		"  total    18 files  137 lines  in 3 projects\n"
+	if buf.String() != want {
+		t.Errorf("printMatchCounts() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// Path searches have no line hits to count
+	buf.Reset()
+	printMatchCounts(&buf, []MatchCount{{Project: "kernel", Files: 2}}, false)
+	if want := "  kernel  2 files  ##############################\n"; buf.String() != want {
+		t.Errorf("printMatchCounts() = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	printMatchCounts(&buf, nil, false)
+	if buf.String() != "No results found.\n" {
+		t.Errorf("printMatchCounts(nil) = %q", buf.String())
+	}
+}
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"og/pkg/opengrok"
+
+	flag "github.com/spf13/pflag"
+)
+
+// maxAnnotateMessage matches og_annotate's native messaging size limit
+const maxAnnotateMessage = 1024 * 1024
+
+// ttlCacheSize caps the bytes of responses the daemon keeps in memory
+const ttlCacheSize = 64 * 1024 * 1024
+
+// ttlCache is a small in-memory response cache shared by all daemon
+// requests. All entries live for the same ttl, so they expire in the order
+// they were put; expired ones are dropped on each put, and the oldest ones
+// when the cache grows past maxBytes.
+type ttlCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int
+	size     int
+	entries  map[string]*list.Element // Of *ttlCacheEntry, oldest first
+	order    *list.List
+}
+
+type ttlCacheEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func newTTLCache(ttl time.Duration) *ttlCache {
+	return &ttlCache{ttl: ttl, maxBytes: ttlCacheSize, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *ttlCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*ttlCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	return entry.data, true
+}
+
+func (c *ttlCache) put(key string, data []byte) {
+	if c.ttl <= 0 || len(data) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	now := time.Now()
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		if entry := front.Value.(*ttlCacheEntry); now.Before(entry.expires) && c.size+len(data) <= c.maxBytes {
+			break
+		}
+		c.remove(front)
+	}
+	c.entries[key] = c.order.PushBack(&ttlCacheEntry{key: key, data: data, expires: now.Add(c.ttl)})
+	c.size += len(data)
+}
+
+// remove drops an entry; c.mu must be held
+func (c *ttlCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*ttlCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= len(entry.data)
+}
+
+// nativeHost keeps one og_annotate process running and forwards messages to
+// it using the Chrome native messaging framing (4-byte little-endian length)
+type nativeHost struct {
+	mu     sync.Mutex
+	bin    string
+	args   []string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// call sends one request and returns the raw JSON response.
+// The process is started lazily and restarted after any I/O error.
+func (h *nativeHost) call(msg []byte) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(msg) > maxAnnotateMessage {
+		return nil, fmt.Errorf("message too large")
+	}
+	if h.cmd == nil {
+		if err := h.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := h.roundTrip(msg)
+	if err != nil {
+		h.stop()
+		return nil, fmt.Errorf("og_annotate: %w", err)
+	}
+	return resp, nil
+}
+
+func (h *nativeHost) roundTrip(msg []byte) ([]byte, error) {
+	if err := binary.Write(h.stdin, binary.LittleEndian, uint32(len(msg))); err != nil {
+		return nil, err
+	}
+	if _, err := h.stdin.Write(msg); err != nil {
+		return nil, err
+	}
+
+	var length uint32
+	if err := binary.Read(h.stdout, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > maxAnnotateMessage*16 {
+		return nil, fmt.Errorf("response too large (%d bytes)", length)
+	}
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(h.stdout, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (h *nativeHost) start() error {
+	cmd := exec.Command(h.bin, h.args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", h.bin, err)
+	}
+	h.cmd = cmd
+	h.stdin = stdin
+	h.stdout = bufio.NewReader(stdout)
+	return nil
+}
+
+func (h *nativeHost) stop() {
+	if h.cmd == nil {
+		return
+	}
+	h.stdin.Close()
+	h.cmd.Process.Kill()
+	h.cmd.Wait()
+	h.cmd = nil
+}
+
+// Close stops the og_annotate process if running
+func (h *nativeHost) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stop()
+}
+
+// daemon serves search, trace, and annotation operations over localhost HTTP,
+// sharing one API client (and its connection pool) and a response cache
+type daemon struct {
+	client   *Client
+	cache    *ttlCache
+	annotate *nativeHost
+	groups   map[string][]string // Project groups for @name in projects parameters
+	excludes []string            // Trace exclusion patterns unless noDefaultExcludes is set
+	token    string              // Bearer token every request must carry
+}
+
+// handler returns the daemon's HTTP routes
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "server": d.client.BaseURL})
+	})
+	mux.HandleFunc("/api/projects", d.cached(d.handleProjects))
+	mux.HandleFunc("/api/search", d.cached(d.handleSearch))
+	mux.HandleFunc("/api/trace", d.cached(d.handleTrace))
+	mux.HandleFunc("/api/annotate", d.handleAnnotate)
+	mux.HandleFunc("/upstream", d.handleUpstream)
+	return localOnly(d.token, mux)
+}
+
+// cached wraps a GET handler that returns JSON-encodable data, caching
+// successful responses by request URI
+func (d *daemon) cached(fn func(r *http.Request) (interface{}, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if data, ok := d.cache.get(key); ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Og-Cache", "hit")
+			w.Write(data)
+			return
+		}
+
+		result, status, err := fn(r)
+		if err != nil {
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		d.cache.put(key, data)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+func (d *daemon) handleProjects(r *http.Request) (interface{}, int, error) {
+	projects, err := d.client.GetProjectsContext(r.Context())
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	return projects, http.StatusOK, nil
+}
+
+// expandProjects expands the group references and then the patterns in a
+// projects parameter
+func (d *daemon) expandProjects(list string) (string, error) {
+	expanded, err := expandProjects(list, d.groups)
+	if err != nil {
+		return "", err
+	}
+	return expandProjectPatterns(expanded, cachedProjects(d.client))
+}
+
+func (d *daemon) handleSearch(r *http.Request) (interface{}, int, error) {
+	q := r.URL.Query()
+	query := q.Get("q")
+	if query == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("missing required parameter: q")
+	}
+
+	projects, err := d.expandProjects(q.Get("projects"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	opts := SearchOptions{
+		Type:     q.Get("filetype"),
+		Projects: projects,
+	}
+	opts.MaxResults, _ = strconv.Atoi(q.Get("max"))
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = 25
+	}
+	sortBy, err := sortParam(q.Get("sort"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	opts.Sort = sortBy
+
+	switch q.Get("type") {
+	case "", "full":
+		opts.Full = query
+	case "def":
+		opts.Def = query
+	case "symbol":
+		opts.Symbol = query
+	case "path":
+		opts.Path = query
+	case "hist":
+		opts.Hist = query
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid search type %q", q.Get("type"))
+	}
+
+	resp, err := d.client.SearchContext(r.Context(), opts)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	sortResults(resp, q.Get("sort"))
+	if q.Get("sort") == "lastmod" {
+		if err := sortByLastChange(r.Context(), d.client, resp, nil); err != nil {
+			return nil, http.StatusBadGateway, err
+		}
+	}
+	return resp, http.StatusOK, nil
+}
+
+func (d *daemon) handleTrace(r *http.Request) (interface{}, int, error) {
+	q := r.URL.Query()
+	symbol := q.Get("symbol")
+	if symbol == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("missing required parameter: symbol")
+	}
+
+	projects, err := d.expandProjects(q.Get("projects"))
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	levelProjects, err := expandLevelProjects(q["levelProjects"], d.groups)
+	if err == nil {
+		levelProjects, err = expandLevelProjectPatterns(levelProjects, cachedProjects(d.client))
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	aliases, err := parseTraceAliases(q["alias"])
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	opts := TraceOptions{
+		Symbol:        symbol,
+		Projects:      projects,
+		Type:          q.Get("filetype"),
+		LevelProjects: levelProjects,
+		DefPath:       q.Get("defPath"),
+		Aliases:       aliases,
+	}
+	opts.Depth, _ = strconv.Atoi(q.Get("depth"))
+	noDefaults, _ := strconv.ParseBool(q.Get("noDefaultExcludes"))
+	opts.Exclude = traceExcludes(d.excludes, noDefaults, q["exclude"])
+	opts.MaxTotal, _ = strconv.Atoi(q.Get("maxTotal"))
+	opts.SameProjectOnly, _ = strconv.ParseBool(q.Get("sameProjectOnly"))
+
+	// Without a defPath, a symbol defined in several places is traced
+	// through all of them; the result lists them as candidates
+	opts.AnyDefinition = true
+	result, err := Trace(r.Context(), d.client, opts)
+	var ambiguous *AmbiguousDefinitionError
+	if errors.As(err, &ambiguous) {
+		return nil, http.StatusConflict, err
+	}
+	warnAnyDefinition(result)
+	if err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	return result, http.StatusOK, nil
+}
+
+// handleAnnotate forwards a native messaging request body to og_annotate
+func (d *daemon) handleAnnotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	if d.annotate == nil {
+		writeJSON(w, http.StatusNotImplemented, map[string]string{"error": "annotations not enabled (use --annotate-bin)"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAnnotateMessage+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if !json.Valid(body) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "request body must be JSON"})
+		return
+	}
+
+	resp, err := d.annotate.call(body)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// handleUpstream forwards a GET request from another og process (see
+// daemonTransport) to the OpenGrok server, through the daemon's rate limit,
+// response cache and connection pool. Conditional requests and their
+// validators pass through, so the caller's file cache still works. The request is sent with the
+// daemon's credentials; callers send none. Requests for another server are
+// refused with 421 so the caller goes there directly.
+func (d *daemon) handleUpstream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	target := r.Header.Get(upstreamHeader)
+	if !d.servesURL(target) {
+		writeJSON(w, http.StatusMisdirectedRequest, map[string]string{"error": "this daemon serves " + d.client.BaseURL})
+		return
+	}
+
+	key := "upstream " + target
+	if data, ok := d.cache.get(key); ok {
+		var cached upstreamResponse
+		if json.Unmarshal(data, &cached) == nil {
+			cached.write(w, r)
+			return
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	for _, name := range upstreamRequestHeaders {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	if err := d.client.Authorize(req); err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	resp, err := d.client.HTTPClient.Do(req)
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+	for _, name := range upstreamResponseHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+
+	// Raw files can be of any size and the caller keeps its own copy of
+	// them (see opengrok.FileCache), so only API responses are cached, and
+	// only those under MaxResponseSize; the rest is streamed through
+	var head []byte
+	if resp.StatusCode == http.StatusOK && !d.isRawURL(target) {
+		head, err = io.ReadAll(io.LimitReader(resp.Body, opengrok.MaxResponseSize))
+		if err != nil {
+			writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+			return
+		}
+		if len(head) < opengrok.MaxResponseSize {
+			cached := upstreamResponse{Header: map[string]string{}, Body: head}
+			for _, name := range upstreamResponseHeaders {
+				if v := resp.Header.Get(name); v != "" {
+					cached.Header[name] = v
+				}
+			}
+			if data, err := json.Marshal(cached); err == nil {
+				d.cache.put(key, data)
+			}
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(head)
+	io.Copy(w, resp.Body)
+}
+
+// upstreamRequestHeaders are the headers of a caller's request sent on to
+// the server: the caller's credentials are not, and the conditional ones let
+// it revalidate its file cache
+var upstreamRequestHeaders = []string{"Accept", "If-None-Match", "If-Modified-Since"}
+
+// upstreamResponseHeaders are the headers of the server's response
+// returned to the caller, and kept with it in the daemon's cache
+var upstreamResponseHeaders = []string{"Content-Type", "ETag", "Last-Modified"}
+
+// upstreamResponse is a server response in the daemon's cache
+type upstreamResponse struct {
+	Header map[string]string `json:"header"`
+	Body   []byte            `json:"body"`
+}
+
+// write answers r with the cached response: 304 when r's validators match
+// it, else the whole response with its validators
+func (u upstreamResponse) write(w http.ResponseWriter, r *http.Request) {
+	for name, v := range u.Header {
+		w.Header().Set(name, v)
+	}
+	w.Header().Set("X-Og-Cache", "hit")
+	if notModified(r, u.Header["ETag"], u.Header["Last-Modified"]) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(u.Body)
+}
+
+// notModified reports whether a conditional request's validators match a
+// response with the given ETag and Last-Modified. If-None-Match takes
+// precedence over If-Modified-Since, as in RFC 9110.
+func notModified(r *http.Request, etag, lastModified string) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && inm == etag
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	return err == nil && !modified.After(since)
+}
+
+// isRawURL reports whether target is a file on the server's raw endpoint
+func (d *daemon) isRawURL(target string) bool {
+	return strings.HasPrefix(target, d.client.XrefBaseURL()+"/raw/")
+}
+
+// servesURL reports whether target is under the daemon's server: its URL,
+// or the API or xref base configured for it
+func (d *daemon) servesURL(target string) bool {
+	for _, base := range []string{d.client.BaseURL, strings.TrimSuffix(d.client.APIURL("/"), "/"), d.client.XrefBaseURL()} {
+		if target == base || strings.HasPrefix(target, base+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// localOnly admits only the user's own programs: the Host must name the
+// loopback interface, browser requests must come from an extension, and
+// every request but a CORS preflight must carry the daemon's token as
+// "Authorization: Bearer <token>".
+func localOnly(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "host not allowed"})
+			return
+		}
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			if !strings.HasPrefix(origin, "chrome-extension://") && !strings.HasPrefix(origin, "vscode-webview://") {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "origin not allowed"})
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// isLoopbackAddr returns true if addr (host:port) binds only to loopback
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func handleServe() {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	serverURL := fs.StringP("server", "s", "", "OpenGrok server URL (overrides config)")
+	listen := fs.String("listen", "127.0.0.1:7878", "Address to listen on (loopback only)")
+	cacheTTL := fs.Duration("cache-ttl", time.Minute, "How long to cache search/trace responses (0 disables)")
+	annotateBin := fs.String("annotate-bin", "", "Path to og_annotate for /api/annotate (disabled if empty)")
+	token := fs.String("token", "", "Bearer token clients must send (default: $"+envDaemonToken+", or a random one)")
+	rate := fs.Float64("rate", 10, "Maximum requests per second sent to the OpenGrok server (0 for no limit)")
+	burst := fs.Int("burst", 20, "Requests allowed at once before --rate applies")
+	username := fs.String("username", "", "Username for basic authentication")
+	password := fs.String("password", "", "Password for basic authentication")
+	apiKey := fs.String("api-key", "", "API key for authentication")
+	bearerToken := fs.String("bearer-token", "", "Bearer token for authentication")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s serve [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Run a local daemon exposing search, trace, and annotations over HTTP.\n\n")
+		fmt.Fprintf(os.Stderr, "Endpoints:\n")
+		fmt.Fprintf(os.Stderr, "  GET  /health\n")
+		fmt.Fprintf(os.Stderr, "  GET  /api/projects\n")
+		fmt.Fprintf(os.Stderr, "  GET  /api/search?q=<query>&type=full|def|symbol|path|hist&projects=&filetype=&max=&sort=\n")
+		fmt.Fprintf(os.Stderr, "  GET  /api/trace?symbol=<name>&depth=&maxTotal=&projects=&filetype=&levelProjects=&defPath=&alias=&exclude=&noDefaultExcludes=&sameProjectOnly=\n")
+		fmt.Fprintf(os.Stderr, "  POST /api/annotate   (og_annotate request JSON)\n")
+		fmt.Fprintf(os.Stderr, "  GET  /upstream       (OpenGrok requests from og processes with OG_DAEMON set)\n\n")
+		fmt.Fprintf(os.Stderr, "Requests must send \"Authorization: Bearer <token>\"; the token is written to a\n")
+		fmt.Fprintf(os.Stderr, "file only you can read, printed when the daemon starts.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[2:])
+
+	if !isLoopbackAddr(*listen) {
+		fmt.Fprint(os.Stderr, trf("Error: --listen must be a loopback address (e.g. 127.0.0.1:7878)\n"))
+		os.Exit(1)
+	}
+
+	url := getServerURL(*serverURL)
+	// The daemon talks to the server itself, never through a daemon
+	client, err := opengrok.NewClient(url)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	cfg, _ := LoadConfig()
+	applyServerBases(client, cfg)
+	configureClientAuth(client, AuthOptions{
+		Username:    *username,
+		Password:    *password,
+		APIKey:      *apiKey,
+		BearerToken: *bearerToken,
+	})
+	// One bucket covers every request the daemon makes, however many og
+	// processes and editor plugins send them
+	if *rate > 0 {
+		client.HTTPClient.Transport = &rateLimitedTransport{bucket: newTokenBucket(*rate, *burst), next: http.DefaultTransport}
+	}
+
+	daemonToken, err := resolveDaemonToken(*token)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+
+	d := &daemon{
+		client:   client,
+		cache:    newTTLCache(*cacheTTL),
+		groups:   loadProjectGroups(),
+		excludes: loadTraceExcludes(),
+		token:    daemonToken,
+	}
+	if *annotateBin != "" {
+		d.annotate = &nativeHost{bin: *annotateBin}
+		defer d.annotate.Close()
+	}
+
+	// The token is written once the address is ours, so a second daemon
+	// failing to start leaves the running one's token in place
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+	tokenPath, err := writeDaemonToken(daemonToken)
+	if err != nil {
+		listener.Close()
+		fmt.Fprint(os.Stderr, trf("Error: failed to save the daemon token: %v\n", err))
+		os.Exit(1)
+	}
+	srv := &http.Server{Handler: d.handler()}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "og serve: listening on http://%s (OpenGrok: %s)\n", *listen, url)
+	fmt.Fprintf(os.Stderr, "og serve: token in %s\n", tokenPath)
+	err = srv.Serve(listener)
+	os.Remove(tokenPath)
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+		os.Exit(1)
+	}
+}
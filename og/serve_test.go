@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestDaemon(t *testing.T) (*daemon, *int) {
+	t.Helper()
+	searches := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/search":
+			searches++
+			w.Write([]byte(`{"resultCount":1,"results":{"/proj/a.c":[{"line":"foo()","lineNo":"3"}]}}`))
+		case "/api/v1/projects":
+			w.Write([]byte(`["proj"]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	client, err := NewClient(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &daemon{client: client, cache: newTTLCache(time.Minute), token: testDaemonToken}, &searches
+}
+
+// testDaemonToken is the token of the daemons newTestDaemon returns
+const testDaemonToken = "test-token"
+
+// daemonRequest sends a request with the test daemon's token
+func daemonRequest(method, url, body string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+testDaemonToken)
+	return http.DefaultClient.Do(req)
+}
+
+func TestDaemonSearchCaches(t *testing.T) {
+	d, searches := newTestDaemon(t)
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := daemonRequest("GET", srv.URL+"/api/search?q=foo&type=def", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body SearchResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || body.ResultCount != 1 {
+			t.Fatalf("request %d: status %d, resultCount %d", i, resp.StatusCode, body.ResultCount)
+		}
+		if i == 1 && resp.Header.Get("X-Og-Cache") != "hit" {
+			t.Error("second request should be served from cache")
+		}
+	}
+	if *searches != 1 {
+		t.Errorf("expected 1 upstream search, got %d", *searches)
+	}
+}
+
+func TestTTLCacheEvicts(t *testing.T) {
+	c := newTTLCache(time.Minute)
+	c.maxBytes = 10
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.put(key, []byte("abcd"))
+	}
+	// Oldest first, to stay within 10 bytes
+	for key, want := range map[string]bool{"a": false, "b": false, "c": true, "d": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%q) found = %v, want %v", key, ok, want)
+		}
+	}
+	if c.size != 8 || c.order.Len() != 2 {
+		t.Errorf("size = %d bytes in %d entries, want 8 in 2", c.size, c.order.Len())
+	}
+	c.put("big", make([]byte, 11))
+	if _, ok := c.get("big"); ok || c.order.Len() != 2 {
+		t.Error("entry larger than the cache was kept")
+	}
+
+	// Expired entries go on the next put, read or not
+	c = newTTLCache(time.Millisecond)
+	c.put("a", []byte("abcd"))
+	time.Sleep(5 * time.Millisecond)
+	c.put("b", []byte("abcd"))
+	if len(c.entries) != 1 || c.size != 4 {
+		t.Errorf("expired entry kept: %d entries, %d bytes", len(c.entries), c.size)
+	}
+}
+
+func TestDaemonRejectsBadRequests(t *testing.T) {
+	d, _ := newTestDaemon(t)
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		origin string
+		host   string
+		token  string
+		status int
+	}{
+		{"missing query", "GET", "/api/search", "", "", testDaemonToken, http.StatusBadRequest},
+		{"invalid type", "GET", "/api/search?q=x&type=bogus", "", "", testDaemonToken, http.StatusBadRequest},
+		{"missing symbol", "GET", "/api/trace", "", "", testDaemonToken, http.StatusBadRequest},
+		{"unknown project group", "GET", "/api/search?q=x&projects=@nope", "", "", testDaemonToken, http.StatusBadRequest},
+		{"web page origin", "GET", "/api/projects", "https://evil.example.com", "", testDaemonToken, http.StatusForbidden},
+		{"extension origin", "GET", "/api/projects", "chrome-extension://abcdef", "", testDaemonToken, http.StatusOK},
+		{"extension preflight", "OPTIONS", "/api/projects", "chrome-extension://abcdef", "", "", http.StatusNoContent},
+		{"annotations disabled", "GET", "/api/annotate", "", "", testDaemonToken, http.StatusMethodNotAllowed},
+		{"no token", "GET", "/api/projects", "", "", "", http.StatusUnauthorized},
+		{"wrong token", "GET", "/health", "", "", "guess", http.StatusUnauthorized},
+		{"rebound host", "GET", "/api/projects", "", "evil.example.com:7878", testDaemonToken, http.StatusForbidden},
+		{"localhost host", "GET", "/api/projects", "", "localhost:7878", testDaemonToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status: got %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
+
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:7878": true,
+		"localhost:7878": true,
+		"[::1]:7878":     true,
+		"0.0.0.0:7878":   false,
+		":7878":          false,
+		"10.0.0.5:7878":  false,
+	}
+	for addr, want := range tests {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// TestHelperNativeHost is not a real test: it acts as a fake og_annotate that
+// echoes each framed message back, when run as a subprocess by the daemon tests
+func TestHelperNativeHost(t *testing.T) {
+	if os.Getenv("OG_WANT_HELPER_NATIVE_HOST") != "1" {
+		return
+	}
+	for {
+		var length uint32
+		if err := binary.Read(os.Stdin, binary.LittleEndian, &length); err != nil {
+			os.Exit(0)
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(os.Stdin, msg); err != nil {
+			os.Exit(1)
+		}
+		resp := []byte(`{"success":true,"echo":` + string(msg) + `}`)
+		binary.Write(os.Stdout, binary.LittleEndian, uint32(len(resp)))
+		os.Stdout.Write(resp)
+	}
+}
+
+func TestDaemonAnnotateProxy(t *testing.T) {
+	t.Setenv("OG_WANT_HELPER_NATIVE_HOST", "1")
+	d, _ := newTestDaemon(t)
+	d.annotate = &nativeHost{bin: os.Args[0], args: []string{"-test.run=TestHelperNativeHost"}}
+	defer d.annotate.Close()
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	// Two calls reuse the same process
+	for i := 0; i < 2; i++ {
+		resp, err := daemonRequest("POST", srv.URL+"/api/annotate", `{"action":"ping"}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d: %s", resp.StatusCode, body)
+		}
+		if !strings.Contains(string(body), `"echo":{"action":"ping"}`) {
+			t.Errorf("unexpected response: %s", body)
+		}
+	}
+
+	resp, err := daemonRequest("POST", srv.URL+"/api/annotate", `not json`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("invalid JSON: got status %d", resp.StatusCode)
+	}
+}
+
+func TestDaemonUpstreamSharesCache(t *testing.T) {
+	d, searches := newTestDaemon(t)
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	// Two og processes routed through the daemon share its cache
+	for i := 0; i < 2; i++ {
+		client, err := NewClient(d.client.BaseURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		client.HTTPClient.Transport = &daemonTransport{addr: strings.TrimPrefix(srv.URL, "http://"), token: testDaemonToken, next: http.DefaultTransport}
+		resp, err := client.Search(SearchOptions{Def: "foo"})
+		if err != nil || resp.ResultCount != 1 {
+			t.Fatalf("search %d: %+v, %v", i, resp, err)
+		}
+	}
+	if *searches != 1 {
+		t.Errorf("expected 1 upstream search, got %d", *searches)
+	}
+
+	// A process using another server, or with no daemon running, goes
+	// straight to its server
+	other, otherSearches := newTestDaemon(t)
+	for _, addr := range []string{strings.TrimPrefix(srv.URL, "http://"), "127.0.0.1:1"} {
+		client := other.client
+		client.HTTPClient.Transport = &daemonTransport{addr: addr, token: testDaemonToken, next: http.DefaultTransport}
+		if _, err := client.Search(SearchOptions{Def: "foo"}); err != nil {
+			t.Fatalf("daemon %s: %v", addr, err)
+		}
+	}
+	if *otherSearches != 2 || *searches != 1 {
+		t.Errorf("searches = %d direct, %d through the daemon; want 2, 1", *otherSearches, *searches)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(2, 3)
+	start := b.last
+	for i := 0; i < 3; i++ {
+		if delay := b.reserve(start); delay != 0 {
+			t.Fatalf("request %d within the burst waited %v", i, delay)
+		}
+	}
+	if delay := b.reserve(start); delay != 500*time.Millisecond {
+		t.Errorf("request past the burst: delay %v, want 500ms", delay)
+	}
+	if delay := b.reserve(start.Add(500 * time.Millisecond)); delay != 0 {
+		t.Errorf("request after refill: delay %v, want none", delay)
+	}
+	// The bucket never holds more than the burst
+	for i := 0; i < 3; i++ {
+		b.reserve(start.Add(time.Hour))
+	}
+	if delay := b.reserve(start.Add(time.Hour)); delay == 0 {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+func TestWriteDaemonToken(t *testing.T) {
+	oldGetDaemonTokenPath := getDaemonTokenPath
+	defer func() { getDaemonTokenPath = oldGetDaemonTokenPath }()
+	path := filepath.Join(t.TempDir(), "og", "daemon.token")
+	getDaemonTokenPath = func() (string, error) { return path, nil }
+
+	// A link planted at the path is replaced, not written through
+	target := filepath.Join(t.TempDir(), "target")
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.Symlink(target, path); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	if _, err := writeDaemonToken("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("token written through a symlink: %v", err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0077 != 0 {
+		t.Errorf("token file mode = %v, %v; want a regular file only the user can read", info.Mode(), err)
+	}
+	if token, err := readDaemonToken(); err != nil || token != "secret" {
+		t.Errorf("readDaemonToken() = %q, %v", token, err)
+	}
+
+	// Clients refuse a token others could have written or read
+	if runtime.GOOS != "windows" {
+		os.Chmod(path, 0644)
+		if _, err := readDaemonToken(); err == nil {
+			t.Error("readDaemonToken() accepted a file others can read")
+		}
+	}
+}
+
+func TestDaemonUpstreamUsesDaemonCredentials(t *testing.T) {
+	var auth []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"resultCount":0,"results":{}}`))
+	}))
+	defer upstream.Close()
+
+	daemonClient, _ := NewClient(upstream.URL)
+	daemonClient.BearerToken = "daemon-secret"
+	d := &daemon{client: daemonClient, cache: newTTLCache(time.Minute), token: testDaemonToken}
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	// The caller's credentials never leave the process
+	var sent []string
+	client, _ := NewClient(upstream.URL)
+	client.BearerToken = "caller-secret"
+	client.HTTPClient.Transport = &daemonTransport{
+		addr:  strings.TrimPrefix(srv.URL, "http://"),
+		token: testDaemonToken,
+		next: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			sent = append(sent, r.Header.Get("Authorization"))
+			return http.DefaultTransport.RoundTrip(r)
+		}),
+	}
+	if _, err := client.Search(SearchOptions{Def: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 || sent[0] != "Bearer "+testDaemonToken {
+		t.Errorf("sent to the daemon: %q, want only its token", sent)
+	}
+	if len(auth) != 1 || auth[0] != "Bearer daemon-secret" {
+		t.Errorf("upstream got %q, want the daemon's credentials", auth)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestDaemonUpstreamConditional(t *testing.T) {
+	const etag = `"v1"`
+	var fetches, notModified int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fetches++
+		w.Write([]byte("int x;\n"))
+	}))
+	defer upstream.Close()
+
+	client, _ := NewClient(upstream.URL)
+	d := &daemon{client: client, cache: newTTLCache(time.Minute), token: testDaemonToken}
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	get := func(target, ifNoneMatch string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+"/upstream", nil)
+		req.Header.Set("Authorization", "Bearer "+testDaemonToken)
+		req.Header.Set(upstreamHeader, target)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	// Raw files are not cached by the daemon; the server revalidates them
+	raw := upstream.URL + "/raw/proj/a.c"
+	if resp := get(raw, ""); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag {
+		t.Errorf("raw: status %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if resp := get(raw, etag); resp.StatusCode != http.StatusNotModified || notModified != 1 {
+		t.Errorf("raw revalidation: status %d, %d upstream 304s", resp.StatusCode, notModified)
+	}
+
+	// Cached API responses keep their validators and answer 304 themselves
+	api := upstream.URL + "/api/v1/projects"
+	get(api, "")
+	if resp := get(api, etag); resp.StatusCode != http.StatusNotModified || resp.Header.Get("X-Og-Cache") != "hit" {
+		t.Errorf("cached revalidation: status %d, cache %q", resp.StatusCode, resp.Header.Get("X-Og-Cache"))
+	}
+	if resp := get(api, ""); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag {
+		t.Errorf("cached: status %d, ETag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if fetches != 2 {
+		t.Errorf("upstream fetches = %d, want 2", fetches)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotVersion is the format version written to saved result files
+const snapshotVersion = 1
+
+// ResultSnapshot is a search result saved with --save-results, for comparing
+// against a later run with 'og diff-results'
+type ResultSnapshot struct {
+	Version int           `json:"version"`
+	Server  string        `json:"server"`
+	Search  string        `json:"search"` // Search type: full, def, symbol, path or hist
+	Query   string        `json:"query"`
+	Saved   string        `json:"saved"` // RFC 3339 timestamp
+	Hits    []SnapshotHit `json:"hits"`
+}
+
+// SnapshotHit is one saved result line, with highlighting markup removed
+type SnapshotHit struct {
+	Project string `json:"project"`
+	Path    string `json:"path"`
+	LineNo  string `json:"lineNo,omitempty"`
+	Line    string `json:"line"`
+}
+
+// String formats a hit like og's plain search output
+func (h SnapshotHit) String() string {
+	location := h.Project + h.Path
+	if h.LineNo != "" {
+		location += ":" + h.LineNo
+	}
+	return location + ":" + h.Line
+}
+
+// key identifies a hit across runs. Line numbers are left out so that hits
+// which only moved within their file do not show up as changes.
+func (h SnapshotHit) key() string {
+	return h.Project + "\x00" + h.Path + "\x00" + strings.TrimSpace(h.Line)
+}
+
+// newResultSnapshot captures the hits of a search response
+func newResultSnapshot(resp *SearchResponse, serverURL, searchType, query string) *ResultSnapshot {
+	snap := &ResultSnapshot{
+		Version: snapshotVersion,
+		Server:  serverURL,
+		Search:  searchType,
+		Query:   query,
+		Saved:   time.Now().UTC().Format(time.RFC3339),
+		Hits:    []SnapshotHit{},
+	}
+	for _, r := range resp.OrderedEntries() {
+		path := r.FilePath()
+		snap.Hits = append(snap.Hits, SnapshotHit{
+			Project: r.Project,
+			Path:    path,
+			LineNo:  string(r.LineNo),
+			Line:    strings.TrimSpace(stripHTMLTags(r.Line)),
+		})
+	}
+	return snap
+}
+
+// saveResultSnapshot writes snap to path as indented JSON
+func saveResultSnapshot(path string, snap *ResultSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// loadResultSnapshot reads a file written by saveResultSnapshot
+func loadResultSnapshot(path string) (*ResultSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap ResultSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("%s: not a saved result file: %w", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("%s: unsupported saved result version %d", path, snap.Version)
+	}
+	return &snap, nil
+}
+
+// ResultDiff holds the hits that differ between two snapshots
+type ResultDiff struct {
+	Added   []SnapshotHit // In the later snapshot only
+	Removed []SnapshotHit // In the earlier snapshot only
+}
+
+// diffSnapshots compares two snapshots. Hits are matched by project, path
+// and line text, so a line that merely moved is unchanged; repeated identical
+// lines in a file are matched by count.
+func diffSnapshots(before, after *ResultSnapshot) ResultDiff {
+	remaining := make(map[string]int)
+	for _, h := range before.Hits {
+		remaining[h.key()]++
+	}
+
+	var diff ResultDiff
+	for _, h := range after.Hits {
+		if remaining[h.key()] > 0 {
+			remaining[h.key()]--
+			continue
+		}
+		diff.Added = append(diff.Added, h)
+	}
+	for _, h := range before.Hits {
+		if remaining[h.key()] > 0 {
+			remaining[h.key()]--
+			diff.Removed = append(diff.Removed, h)
+		}
+	}
+
+	sortHits(diff.Added)
+	sortHits(diff.Removed)
+	return diff
+}
+
+// sortHits orders hits by project, path and numeric line number
+func sortHits(hits []SnapshotHit) {
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		lineA, _ := strconv.Atoi(a.LineNo)
+		lineB, _ := strconv.Atoi(b.LineNo)
+		return lineA < lineB
+	})
+}
+
+// printResultDiff prints removed hits prefixed with "-" and added hits with
+// "+", then a summary line
+func printResultDiff(w io.Writer, diff ResultDiff, useColor bool) {
+	for _, h := range diff.Removed {
+		if useColor {
+			fmt.Fprintf(w, "%s- %s%s\n", colorRed, h, colorReset)
+		} else {
+			fmt.Fprintf(w, "- %s\n", h)
+		}
+	}
+	for _, h := range diff.Added {
+		if useColor {
+			fmt.Fprintf(w, "%s+ %s%s\n", colorGreen, h, colorReset)
+		} else {
+			fmt.Fprintf(w, "+ %s\n", h)
+		}
+	}
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		fmt.Fprintln(w, "No differences.")
+		return
+	}
+	fmt.Fprintf(w, "%d added, %d removed\n", len(diff.Added), len(diff.Removed))
+}
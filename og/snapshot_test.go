@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestResultSnapshotRoundTrip(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 1,
+		Results: map[string][]SearchResult{
+			"proj": {
+				{Path: "/src/a.c", LineNo: "12", Line: "  <b>legacy_api</b>(ctx);"},
+				{Directory: "/src", Filename: "b.c", LineNo: "3", Line: "legacy_api();"},
+			},
+		},
+	}
+	path := filepath.Join(t.TempDir(), "saved.json")
+	if err := saveResultSnapshot(path, newResultSnapshot(resp, "http://og", "symbol", "legacy_api")); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := loadResultSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Search != "symbol" || snap.Query != "legacy_api" || snap.Server != "http://og" {
+		t.Errorf("unexpected snapshot header: %+v", snap)
+	}
+	want := []SnapshotHit{
+		{Project: "proj", Path: "/src/a.c", LineNo: "12", Line: "legacy_api(ctx);"},
+		{Project: "proj", Path: "/src/b.c", LineNo: "3", Line: "legacy_api();"},
+	}
+	if len(snap.Hits) != len(want) {
+		t.Fatalf("got %d hits, want %d", len(snap.Hits), len(want))
+	}
+	for i := range want {
+		if snap.Hits[i] != want[i] {
+			t.Errorf("hit %d = %+v, want %+v", i, snap.Hits[i], want[i])
+		}
+	}
+}
+
+func TestLoadResultSnapshotInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.json")
+	if err := saveResultSnapshot(path, &ResultSnapshot{Version: 99}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadResultSnapshot(path); err == nil {
+		t.Error("expected an error for an unsupported version")
+	}
+	if _, err := loadResultSnapshot(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	before := &ResultSnapshot{Hits: []SnapshotHit{
+		{Project: "proj", Path: "/a.c", LineNo: "10", Line: "legacy_api();"},
+		{Project: "proj", Path: "/a.c", LineNo: "20", Line: "legacy_api();"},
+		{Project: "proj", Path: "/b.c", LineNo: "5", Line: "x = legacy_api();"},
+	}}
+	after := &ResultSnapshot{Hits: []SnapshotHit{
+		// Moved by an unrelated edit: not a change
+		{Project: "proj", Path: "/a.c", LineNo: "14", Line: "legacy_api();"},
+		{Project: "proj", Path: "/c.c", LineNo: "2", Line: "legacy_api(1);"},
+	}}
+
+	diff := diffSnapshots(before, after)
+	if len(diff.Removed) != 2 || diff.Removed[0].Path != "/a.c" || diff.Removed[1].Path != "/b.c" {
+		t.Errorf("Removed = %+v", diff.Removed)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Path != "/c.c" {
+		t.Errorf("Added = %+v", diff.Added)
+	}
+
+	var buf bytes.Buffer
+	printResultDiff(&buf, diff, false)
+	want := "- proj/a.c:10:legacy_api();\n" +
+		"- proj/b.c:5:x = legacy_api();\n" +
+		"+ proj/c.c:2:legacy_api(1);\n" +
+		"1 added, 2 removed\n"
+	if buf.String() != want {
+		t.Errorf("printResultDiff() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	printResultDiff(&buf, diffSnapshots(before, before), false)
+	if buf.String() != "No differences.\n" {
+		t.Errorf("identical snapshots: %q", buf.String())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// sortParams maps --sort values to the OpenGrok API sort parameter
+var sortParams = map[string]string{
+	"relevance": "relevancy",
+	"lastmod":   "lastmodtime",
+	"path":      "fullpath",
+}
+
+// sortParam returns the API sort parameter for a --sort value
+func sortParam(mode string) (string, error) {
+	if mode == "" {
+		return "", nil
+	}
+	param, ok := sortParams[mode]
+	if !ok {
+		return "", fmt.Errorf("invalid sort %q: must be path, lastmod, or relevance", mode)
+	}
+	return param, nil
+}
+
+// sortResults orders resp.Entries client-side by path for --sort path.
+// Servers that ignore the sort parameter return results in index order, so
+// path sorting is always applied locally; see sortByLastChange for lastmod.
+// Relevance has no client-side data to sort on and keeps the server order.
+func sortResults(resp *SearchResponse, mode string) {
+	if mode != "path" {
+		return
+	}
+	entries := resp.OrderedEntries()
+	sort.SliceStable(entries, func(i, j int) bool {
+		pi := entries[i].Project + entries[i].Path
+		pj := entries[j].Project + entries[j].Path
+		if pi != pj {
+			return pi < pj
+		}
+		lineI, _ := strconv.Atoi(string(entries[i].LineNo))
+		lineJ, _ := strconv.Atoi(string(entries[j].LineNo))
+		return lineI < lineJ
+	})
+	resp.Entries = entries
+}
+
+// sortByLastChange orders resp.Entries for --sort lastmod, newest file
+// first, hits within a file in the server's order. Last changes come from
+// each file's history, one request per file as for --changed-since, since
+// search results don't carry them; files without a dated commit go last.
+// The file being checked is shown as a subtask of task, which may be nil.
+// On error resp is unchanged.
+func sortByLastChange(ctx context.Context, client *Client, resp *SearchResponse, task *ProgressTask) error {
+	entries := resp.OrderedEntries()
+	changed, err := lastChanged(ctx, client, entries, task)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		ti := changed[buildTraceFilePath(entries[i].Project, entries[i].SearchResult)]
+		tj := changed[buildTraceFilePath(entries[j].Project, entries[j].SearchResult)]
+		return ti.After(tj)
+	})
+	resp.Entries = entries
+	return nil
+}
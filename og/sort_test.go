@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSortParam(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"path", "fullpath", false},
+		{"lastmod", "lastmodtime", false},
+		{"relevance", "relevancy", false},
+		{"date", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := sortParam(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sortParam(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("sortParam(%q) = %q, want %q", tt.mode, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSearchPreservesServerOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("sort"); got != "lastmodtime" {
+			t.Errorf("sort param: got %q, want %q", got, "lastmodtime")
+		}
+		w.Write([]byte(`{"resultCount":3,"results":{
+			"/proj/z/newest.c":[{"line":"a","lineNo":"5"}],
+			"/proj/a/older.c":[{"line":"b","lineNo":"1"}],
+			"/other/m/oldest.c":[{"line":"c","lineNo":"9"}]
+		}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Search(SearchOptions{Full: "x", Sort: "lastmodtime"})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	want := []string{"proj/z/newest.c", "proj/a/older.c", "other/m/oldest.c"}
+	if len(resp.Entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d", len(want), len(resp.Entries))
+	}
+	for i, e := range resp.Entries {
+		if got := e.Project + e.Path; got != want[i] {
+			t.Errorf("entry %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestSortResultsByPath(t *testing.T) {
+	resp := &SearchResponse{
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/b.c", LineNo: "10"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c", LineNo: "20"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/b.c", LineNo: "2"}},
+		},
+	}
+
+	sortResults(resp, "path")
+
+	want := []string{"/a.c:20", "/b.c:2", "/b.c:10"}
+	for i, e := range resp.Entries {
+		if got := e.Path + ":" + string(e.LineNo); got != want[i] {
+			t.Errorf("entry %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestSortResultsKeepsServerOrder(t *testing.T) {
+	resp := &SearchResponse{
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/b.c"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c"}},
+		},
+	}
+
+	sortResults(resp, "relevance")
+
+	if resp.Entries[0].Path != "/b.c" {
+		t.Error("relevance sort should keep server order")
+	}
+}
+
+func TestSortByLastChange(t *testing.T) {
+	histories := map[string][]HistoryEntry{
+		"/proj/new.c": {{Revision: "r3", Date: "1680307200000"}}, // 2023-04-01
+		"/proj/old.c": {{Revision: "r1", Date: "1640995200000"}}, // 2022-01-01
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"entries": histories[r.URL.Query().Get("path")]})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &SearchResponse{
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/untracked.c", LineNo: "1"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/old.c", LineNo: "1"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/new.c", LineNo: "7"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/new.c", LineNo: "3"}},
+		},
+	}
+	if err := sortByLastChange(context.Background(), client, resp, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/new.c:7", "/new.c:3", "/old.c:1", "/untracked.c:1"}
+	for i, e := range resp.Entries {
+		if got := e.Path + ":" + string(e.LineNo); got != want[i] {
+			t.Errorf("entry %d: got %q, want %q", i, got, want[i])
+		}
+	}
+}
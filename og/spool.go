@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// allPageSize is the number of files requested per page by --all
+const allPageSize = 200
+
+// spoolChunkSize is the number of results formatted at a time when a spool
+// is read back
+const spoolChunkSize = 1000
+
+// spoolMemoryBudget is roughly how many bytes of results --all keeps in
+// memory before spilling them to a temporary file (a variable for tests)
+var spoolMemoryBudget = 32 << 20
+
+// resultSpool collects search results in memory up to a budget and spills
+// them to a temporary file beyond it, so fetching every page of a large
+// search keeps peak memory bounded however many results match. Results are
+// read back in the order they were added.
+type resultSpool struct {
+	budget  int
+	size    int           // Estimated bytes of entries
+	entries []ResultEntry // Results while in memory
+	count   int
+
+	file *os.File // Spill file of JSON lines, once spilled
+	w    *bufio.Writer
+	enc  *json.Encoder
+}
+
+// spooledEntry is a result as written to the spill file. ResultEntry can't
+// be used directly: its embedded SearchResult's UnmarshalJSON would drop
+// the project.
+type spooledEntry struct {
+	Project string       `json:"project"`
+	Result  SearchResult `json:"result"`
+}
+
+func newResultSpool(budget int) *resultSpool {
+	return &resultSpool{budget: budget}
+}
+
+// entrySize estimates the memory a result takes
+func entrySize(e ResultEntry) int {
+	return 128 + len(e.Project) + len(e.Line) + len(e.LineNo) + len(e.Path) + len(e.Filename) + len(e.Directory)
+}
+
+// Add appends results, spilling everything to disk once the budget is
+// exceeded
+func (s *resultSpool) Add(entries []ResultEntry) error {
+	s.count += len(entries)
+	if s.file == nil {
+		for _, e := range entries {
+			s.size += entrySize(e)
+		}
+		s.entries = append(s.entries, entries...)
+		if s.size <= s.budget {
+			return nil
+		}
+		if err := s.spill(); err != nil {
+			return err
+		}
+		entries, s.entries = s.entries, nil
+	}
+	for _, e := range entries {
+		if err := s.enc.Encode(spooledEntry{Project: e.Project, Result: e.SearchResult}); err != nil {
+			return fmt.Errorf("failed to spool results: %w", err)
+		}
+	}
+	return nil
+}
+
+// spill creates the temporary file results are written to from now on
+func (s *resultSpool) spill() error {
+	file, err := os.CreateTemp("", "og-results-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to spool results: %w", err)
+	}
+	s.file = file
+	s.w = bufio.NewWriter(file)
+	s.enc = json.NewEncoder(s.w)
+	return nil
+}
+
+// Len returns the number of results added
+func (s *resultSpool) Len() int {
+	return s.count
+}
+
+// Spilled reports whether the results went to disk
+func (s *resultSpool) Spilled() bool {
+	return s.file != nil
+}
+
+// Each calls fn with the results in order, at most chunk at a time
+func (s *resultSpool) Each(chunk int, fn func([]ResultEntry) error) error {
+	if s.file == nil {
+		for start := 0; start < len(s.entries); start += chunk {
+			if err := fn(s.entries[start:min(start+chunk, len(s.entries))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("failed to spool results: %w", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read spooled results: %w", err)
+	}
+	dec := json.NewDecoder(bufio.NewReader(s.file))
+	batch := make([]ResultEntry, 0, chunk)
+	for {
+		var e spooledEntry
+		err := dec.Decode(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read spooled results: %w", err)
+		}
+		batch = append(batch, ResultEntry{Project: e.Project, SearchResult: e.Result})
+		if len(batch) == chunk {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// Close removes the spill file, if any
+func (s *resultSpool) Close() error {
+	s.entries = nil
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// errStopSpool ends reading a spool early once --max-lines is reached
+var errStopSpool = errors.New("line limit reached")
+
+// fetchAllResults pages through every result of opts into spool, reporting
+// progress on task, and returns the totals with no lines shown yet
+func fetchAllResults(ctx context.Context, client *Client, opts SearchOptions, spool *resultSpool, task *ProgressTask) (ResultTotals, error) {
+	opts.MaxResults = allPageSize
+	opts.Start = 0
+	var elapsed int64
+	for {
+		resp, err := client.SearchContext(ctx, opts)
+		if err != nil {
+			return ResultTotals{}, err
+		}
+		entries := resp.OrderedEntries()
+		if err := spool.Add(entries); err != nil {
+			return ResultTotals{}, err
+		}
+		elapsed += resp.Time
+		// Pages are counted in documents, i.e. files
+		files := countResultFiles(entries)
+		opts.Start += files
+		task.Updatef("Searching... %d of %d files", min(opts.Start, resp.ResultCount), resp.ResultCount)
+		if files == 0 || opts.Start >= resp.ResultCount {
+			totals := ResultTotals{
+				FetchedLines:  spool.Len(),
+				FetchedFiles:  min(opts.Start, resp.ResultCount),
+				MatchingFiles: resp.ResultCount,
+				ElapsedMs:     elapsed,
+			}
+			if totals.FetchedFiles > 0 {
+				totals.FirstFile, totals.LastFile = 1, totals.FetchedFiles
+			}
+			return totals, nil
+		}
+	}
+}
+
+// printSpooledResults reads the spooled results back and formats them a
+// chunk at a time with format, stopping after maxLines line hits (0 for no
+// limit). It returns totals with the lines shown filled in.
+func printSpooledResults(spool *resultSpool, totals ResultTotals, maxLines int, format func(*SearchResponse) error) (ResultTotals, error) {
+	err := spool.Each(spoolChunkSize, func(entries []ResultEntry) error {
+		if maxLines > 0 && totals.ShownLines+len(entries) > maxLines {
+			entries = entries[:maxLines-totals.ShownLines]
+		}
+		if len(entries) == 0 {
+			return errStopSpool
+		}
+		totals.ShownLines += len(entries)
+		return format(&SearchResponse{ResultCount: totals.MatchingFiles, Entries: entries})
+	})
+	if errors.Is(err, errStopSpool) {
+		err = nil
+	}
+	return totals, err
+}
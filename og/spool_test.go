@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func spoolTestEntries(n int) []ResultEntry {
+	var entries []ResultEntry
+	for i := 0; i < n; i++ {
+		entries = append(entries, ResultEntry{
+			Project:      "proj",
+			SearchResult: SearchResult{Path: fmt.Sprintf("/f%03d.c", i), LineNo: FlexibleString(strconv.Itoa(i + 1)), Line: "a <b>match</b>"},
+		})
+	}
+	return entries
+}
+
+// readSpool returns the spooled results and the chunk sizes they came in
+func readSpool(t *testing.T, spool *resultSpool, chunk int) ([]ResultEntry, []int) {
+	t.Helper()
+	var got []ResultEntry
+	var sizes []int
+	err := spool.Each(chunk, func(entries []ResultEntry) error {
+		got = append(got, entries...)
+		sizes = append(sizes, len(entries))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, sizes
+}
+
+func TestResultSpoolInMemory(t *testing.T) {
+	spool := newResultSpool(1 << 20)
+	defer spool.Close()
+	want := spoolTestEntries(25)
+	spool.Add(want[:10])
+	spool.Add(want[10:])
+
+	got, sizes := readSpool(t, spool, 10)
+	if spool.Spilled() || spool.Len() != 25 {
+		t.Errorf("Spilled() = %v, Len() = %d; want results in memory", spool.Spilled(), spool.Len())
+	}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(sizes, []int{10, 10, 5}) {
+		t.Errorf("Each() returned %d results in chunks %v", len(got), sizes)
+	}
+}
+
+func TestResultSpoolSpillsToDisk(t *testing.T) {
+	// The budget holds about three results, so the second page spills
+	spool := newResultSpool(3 * entrySize(spoolTestEntries(1)[0]))
+	want := spoolTestEntries(25)
+	for start := 0; start < len(want); start += 2 {
+		if err := spool.Add(want[start:min(start+2, len(want))]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !spool.Spilled() || len(spool.entries) != 0 {
+		t.Fatalf("expected the results on disk, %d left in memory", len(spool.entries))
+	}
+
+	got, sizes := readSpool(t, spool, 10)
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(sizes, []int{10, 10, 5}) {
+		t.Errorf("Each() returned %d results in chunks %v: %+v", len(got), sizes, got)
+	}
+	// The spool can be read more than once
+	if again, _ := readSpool(t, spool, 100); !reflect.DeepEqual(again, want) {
+		t.Errorf("second Each() returned %d results", len(again))
+	}
+
+	name := spool.file.Name()
+	if err := spool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spill file %s not removed: %v", name, err)
+	}
+}
+
+func TestFetchAllResultsPages(t *testing.T) {
+	var starts []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		max, _ := strconv.Atoi(r.URL.Query().Get("maxresults"))
+		starts = append(starts, start)
+		var files []string
+		for i := start; i < start+max && i < 450; i++ {
+			path := fmt.Sprintf("/proj/f%03d.c", i)
+			files = append(files, fmt.Sprintf(`%q: [{"line": "one", "lineNo": "1", "path": %q}, {"line": "two", "lineNo": "2", "path": %q}]`, path, path, path))
+		}
+		fmt.Fprintf(w, `{"resultCount": 450, "results": {%s}}`, strings.Join(files, ","))
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spool := newResultSpool(1 << 10)
+	defer spool.Close()
+	task := newProgress(true).Start("Searching...")
+	totals, err := fetchAllResults(context.Background(), client, SearchOptions{Full: "x", MaxResults: 25}, spool, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(starts, []int{0, 200, 400}) {
+		t.Errorf("requested starts = %v, want [0 200 400]", starts)
+	}
+	if want := (ResultTotals{FetchedLines: 900, FetchedFiles: 450, MatchingFiles: 450, FirstFile: 1, LastFile: 450}); totals != want || !spool.Spilled() {
+		t.Errorf("totals = %+v (spilled %v), want %+v", totals, spool.Spilled(), want)
+	}
+
+	// Every spooled line is shown, in server order
+	var shown []string
+	totals, err = printSpooledResults(spool, totals, 1001, func(resp *SearchResponse) error {
+		for _, e := range resp.OrderedEntries() {
+			shown = append(shown, e.FilePath()+":"+string(e.LineNo))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals.ShownLines != 900 || len(shown) != 900 || shown[0] != "/f000.c:1" || shown[899] != "/f449.c:2" {
+		t.Errorf("shown %d lines (%d in totals)", len(shown), totals.ShownLines)
+	}
+	// --max-lines stops reading the spool part way through a chunk
+	shown = nil
+	totals, _ = printSpooledResults(spool, ResultTotals{FetchedLines: 900}, 3, func(resp *SearchResponse) error {
+		for _, e := range resp.OrderedEntries() {
+			shown = append(shown, e.FilePath()+":"+string(e.LineNo))
+		}
+		return nil
+	})
+	if want := []string{"/f000.c:1", "/f000.c:2", "/f001.c:1"}; !reflect.DeepEqual(shown, want) || totals.HiddenLines() != 897 {
+		t.Errorf("shown %v with %d hidden, want %v", shown, totals.HiddenLines(), want)
+	}
+}
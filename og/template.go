@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// TemplateResult is the model a --template is executed against, once per line
+// hit. Its fields are a stable interface for user templates: add fields, but
+// don't rename or remove them.
+type TemplateResult struct {
+	Project string // Project name
+	File    string // Path within the project, e.g. "/src/main.c"
+	Path    string // Project and path as og prints it, e.g. "myproject/src/main.c"
+	LineNo  int    // Line number, 0 if the result has none
+	Line    string // Matched line as plain text, trimmed
+	URL     string // OpenGrok xref URL, with a line anchor when LineNo is set
+	// LocalPath is the file in the project's local checkout with --local-paths,
+	// empty if there is none
+	LocalPath string
+	// Labels are what a --pipe filter added, e.g. {{.Labels.owner}}
+	Labels map[string]string
+}
+
+// parseResultTemplate parses a --template value. A trailing newline is added
+// so each result ends up on its own line unless the template ends with one.
+func parseResultTemplate(text string) (*template.Template, error) {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	tmpl, err := template.New("result").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateResults builds the template model for each result in resp
+func templateResults(resp *SearchResponse, serverURL string, local *localPaths) []TemplateResult {
+	var results []TemplateResult
+	for _, r := range resp.OrderedEntries() {
+		file := r.FilePath()
+		lineNo, _ := strconv.Atoi(string(r.LineNo))
+
+		var line string
+		if lineNo > 0 {
+			line = strconv.Itoa(lineNo)
+		}
+		url := xrefURL(serverURL, r.Project, file, line)
+		results = append(results, TemplateResult{
+			Project:   r.Project,
+			File:      file,
+			Path:      r.Project + file,
+			LineNo:    lineNo,
+			Line:      strings.TrimSpace(stripHTMLTags(r.Line)),
+			URL:       url,
+			LocalPath: local.resolve(r.Project, file),
+			Labels:    r.Labels,
+		})
+	}
+	return results
+}
+
+// executeResultTemplate writes each result through tmpl
+func executeResultTemplate(w io.Writer, tmpl *template.Template, resp *SearchResponse, serverURL string, local *localPaths) error {
+	for _, r := range templateResults(resp, serverURL, local) {
+		if err := tmpl.Execute(w, r); err != nil {
+			return fmt.Errorf("template failed for %s: %w", r.Path, err)
+		}
+	}
+	return nil
+}
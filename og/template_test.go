@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTemplateResults(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 2,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/src/main.c", LineNo: "12", Line: "  int <b>main</b>(void)"}},
+			{Project: "proj", SearchResult: SearchResult{Directory: "/docs", Filename: "README"}},
+		},
+	}
+
+	got := templateResults(resp, "http://og", nil)
+	want := []TemplateResult{
+		{Project: "proj", File: "/src/main.c", Path: "proj/src/main.c", LineNo: 12, Line: "int main(void)", URL: "http://og/xref/proj/src/main.c#12"},
+		{Project: "proj", File: "/docs/README", Path: "proj/docs/README", URL: "http://og/xref/proj/docs/README"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("result %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExecuteResultTemplate(t *testing.T) {
+	resp := &SearchResponse{
+		ResultCount: 1,
+		Entries: []ResultEntry{
+			{Project: "proj", SearchResult: SearchResult{Path: "/a.c", LineNo: "3", Line: "x = <b>1</b>;"}},
+			{Project: "proj", SearchResult: SearchResult{Path: "/b.c", LineNo: "7", Line: "y = 1;"}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"default style", "{{.Path}}:{{.LineNo}} {{.Line}}", "proj/a.c:3 x = 1;\nproj/b.c:7 y = 1;\n"},
+		{"tsv", "{{.Project}}{{\"\\t\"}}{{.File}}{{\"\\t\"}}{{.LineNo}}", "proj\t/a.c\t3\nproj\t/b.c\t7\n"},
+		{"org table", "| [[{{.URL}}][{{.Path}}]] | {{.LineNo}} |\n", "| [[http://og/xref/proj/a.c#3][proj/a.c]] | 3 |\n| [[http://og/xref/proj/b.c#7][proj/b.c]] | 7 |\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseResultTemplate(tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := executeResultTemplate(&buf, tmpl, resp, "http://og", nil); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("output = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestResultTemplateErrors(t *testing.T) {
+	if _, err := parseResultTemplate("{{.Path"); err == nil || !strings.Contains(err.Error(), "invalid --template") {
+		t.Errorf("expected parse error, got %v", err)
+	}
+
+	tmpl, err := parseResultTemplate("{{.NoSuchField}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &SearchResponse{ResultCount: 1, Entries: []ResultEntry{{Project: "proj", SearchResult: SearchResult{Path: "/a.c"}}}}
+	if err := executeResultTemplate(&bytes.Buffer{}, tmpl, resp, "http://og", nil); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
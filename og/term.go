@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+// colorOutput reports whether ANSI colors should be written to f: it must be a
+// terminal that understands escape sequences. On Windows this turns on virtual
+// terminal processing, which legacy consoles lack.
+func colorOutput(f *os.File) bool {
+	return isTerminal(f) && enableVirtualTerminal(f)
+}
+
+// hyperlinksOutput reports whether OSC 8 hyperlinks may be written to f.
+// Pipes and files keep them (the reader decides how to show them); consoles
+// without escape sequence support would print them as garbage.
+func hyperlinksOutput(f *os.File) bool {
+	return !isTerminal(f) || enableVirtualTerminal(f)
+}
+
+// terminalWidth returns the number of columns of the terminal f writes to,
+// or 0 if f is not a terminal. $COLUMNS overrides the size the terminal
+// reports.
+func terminalWidth(f *os.File) int {
+	if !isTerminal(f) {
+		return 0
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTerminalOutputForPipes(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if isTerminal(w) {
+		t.Error("pipe should not be a terminal")
+	}
+	if colorOutput(w) {
+		t.Error("colors should not be written to a pipe")
+	}
+	if !hyperlinksOutput(w) {
+		t.Error("hyperlinks should be kept when output is piped")
+	}
+}
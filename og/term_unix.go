@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// isTerminal returns true if the file is a terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
+
+// enableVirtualTerminal reports whether escape sequences written to f are
+// interpreted. Unix terminals always interpret them.
+func enableVirtualTerminal(f *os.File) bool {
+	return true
+}
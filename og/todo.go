@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// todoMarkers are the comment markers og todo looks for, in report order
+var todoMarkers = []string{"TODO", "FIXME", "XXX"}
+
+// todoMarkerRegex matches an upper-case marker as a word, with an optional
+// "(owner)" attribution and the note after it
+var todoMarkerRegex = regexp.MustCompile(`\b(TODO|FIXME|XXX)\b(?:\(([^)]*)\))?:?\s*(.*)`)
+
+// unassignedOwner is the owner shown for markers without an attribution
+const unassignedOwner = "(unassigned)"
+
+// TodoItem is one marker found in the code
+type TodoItem struct {
+	Project string `json:"project"`
+	Path    string `json:"path"` // Path within the project
+	Line    int    `json:"line"`
+	Marker  string `json:"marker"`
+	Owner   string `json:"owner,omitempty"`
+	Text    string `json:"text"`
+}
+
+// TodoOwner counts one owner's markers
+type TodoOwner struct {
+	Owner  string         `json:"owner"`
+	Counts map[string]int `json:"counts"` // Marker -> count
+	Total  int            `json:"total"`
+}
+
+// TodoReport is the result of og todo
+type TodoReport struct {
+	Items  []TodoItem  `json:"items"`
+	Owners []TodoOwner `json:"owners"`
+	// Truncated is true if the search matched more files than were fetched
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// TodoOptions narrows og todo
+type TodoOptions struct {
+	Projects string
+	FileType string
+	Path     string
+	MaxFiles int
+	Markers  []string // Subset of todoMarkers; empty for all
+	Owner    string   // Case-insensitive owner to keep; unassignedOwner for none
+}
+
+// parseTodoLine extracts the marker, owner and note from a line of code. ok
+// is false if the line has no marker from markers.
+func parseTodoLine(line string, markers []string) (marker, owner, text string, ok bool) {
+	for _, m := range todoMarkerRegex.FindAllStringSubmatch(line, -1) {
+		if !containsString(markers, m[1]) {
+			continue
+		}
+		text = strings.TrimSpace(m[3])
+		// Drop the end of a block comment closing on the same line
+		text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+		return m[1], strings.TrimSpace(m[2]), text, true
+	}
+	return "", "", "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// todoQuery builds the full-text query for markers. The index is case
+// insensitive, so hits are checked for the upper-case marker afterwards.
+func todoQuery(markers []string) string {
+	return strings.Join(markers, " OR ")
+}
+
+// FindTodos searches for comment markers and collects them with their owners
+func FindTodos(ctx context.Context, client *Client, opts TodoOptions) (*TodoReport, error) {
+	markers := opts.Markers
+	if len(markers) == 0 {
+		markers = todoMarkers
+	}
+	resp, err := client.SearchContext(ctx, SearchOptions{
+		Full:       todoQuery(markers),
+		Projects:   opts.Projects,
+		Type:       opts.FileType,
+		Path:       opts.Path,
+		MaxResults: opts.MaxFiles,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TodoReport{Items: []TodoItem{}}
+	files := make(map[string]bool)
+	for _, r := range resp.OrderedEntries() {
+		path := r.FilePath()
+		files[projectPath(r.Project, path)] = true
+		marker, owner, text, ok := parseTodoLine(html.UnescapeString(stripHTMLTags(r.Line)), markers)
+		if !ok || !todoOwnerMatches(opts.Owner, owner) {
+			continue
+		}
+		line, _ := strconv.Atoi(string(r.LineNo))
+		report.Items = append(report.Items, TodoItem{
+			Project: r.Project,
+			Path:    path,
+			Line:    line,
+			Marker:  marker,
+			Owner:   owner,
+			Text:    text,
+		})
+	}
+	report.Truncated = resp.ResultCount > len(files)
+
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		a, b := report.Items[i], report.Items[j]
+		if a.Project != b.Project {
+			return a.Project < b.Project
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+	report.Owners = summarizeTodoOwners(report.Items)
+	return report, nil
+}
+
+// todoOwnerMatches reports whether an item's owner passes the --owner filter
+func todoOwnerMatches(filter, owner string) bool {
+	switch filter {
+	case "":
+		return true
+	case unassignedOwner:
+		return owner == ""
+	}
+	return strings.EqualFold(filter, owner)
+}
+
+// summarizeTodoOwners counts markers per owner, most markers first, with
+// unattributed markers last
+func summarizeTodoOwners(items []TodoItem) []TodoOwner {
+	byOwner := make(map[string]*TodoOwner)
+	var owners []*TodoOwner
+	for _, item := range items {
+		name := item.Owner
+		if name == "" {
+			name = unassignedOwner
+		}
+		o := byOwner[name]
+		if o == nil {
+			o = &TodoOwner{Owner: name, Counts: make(map[string]int)}
+			byOwner[name] = o
+			owners = append(owners, o)
+		}
+		o.Counts[item.Marker]++
+		o.Total++
+	}
+	sort.SliceStable(owners, func(i, j int) bool {
+		a, b := owners[i], owners[j]
+		if (a.Owner == unassignedOwner) != (b.Owner == unassignedOwner) {
+			return b.Owner == unassignedOwner
+		}
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Owner < b.Owner
+	})
+	summary := make([]TodoOwner, len(owners))
+	for i, o := range owners {
+		summary[i] = *o
+	}
+	return summary
+}
+
+// printTodoReport prints the markers grouped by file, then a table of counts
+// per owner
+func printTodoReport(w io.Writer, report *TodoReport, useColor bool) {
+	if len(report.Items) == 0 {
+		fmt.Fprintln(w, "No markers found.")
+		return
+	}
+
+	var lastFile string
+	for _, item := range report.Items {
+		name := displayPath(item.Project, item.Path)
+		if name != lastFile {
+			if lastFile != "" {
+				fmt.Fprintln(w)
+			}
+			if useColor {
+				fmt.Fprintf(w, "%s%s%s\n", colorMagenta, name, colorReset)
+			} else {
+				fmt.Fprintln(w, name)
+			}
+			lastFile = name
+		}
+		marker := item.Marker
+		if item.Owner != "" {
+			marker += "(" + item.Owner + ")"
+		}
+		if useColor {
+			fmt.Fprintf(w, "  %s%d%s: %s%s%s %s\n", colorCyan, item.Line, colorReset, colorBold, marker, colorReset, item.Text)
+		} else {
+			fmt.Fprintf(w, "  %d: %s %s\n", item.Line, marker, item.Text)
+		}
+	}
+
+	fmt.Fprintln(w)
+	ownerWidth := len("OWNER")
+	for _, o := range report.Owners {
+		ownerWidth = max(ownerWidth, len(o.Owner))
+	}
+	header := fmt.Sprintf("%-*s", ownerWidth, "OWNER")
+	for _, m := range todoMarkers {
+		header += fmt.Sprintf("  %5s", m)
+	}
+	header += "  TOTAL"
+	if useColor {
+		header = colorBold + header + colorReset
+	}
+	fmt.Fprintln(w, header)
+	for _, o := range report.Owners {
+		row := fmt.Sprintf("%-*s", ownerWidth, o.Owner)
+		for _, m := range todoMarkers {
+			row += fmt.Sprintf("  %5d", o.Counts[m])
+		}
+		fmt.Fprintf(w, "%s  %5d\n", row, o.Total)
+	}
+	if report.Truncated {
+		fmt.Fprintln(w, "(some files were not fetched; raise --max to see them)")
+	}
+}
+
+// writeTodoJSON writes the report as indented JSON
+func writeTodoJSON(w io.Writer, report *TodoReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseTodoLine(t *testing.T) {
+	tests := []struct {
+		line                string
+		marker, owner, text string
+		ok                  bool
+	}{
+		{"// TODO: handle EINTR", "TODO", "", "handle EINTR", true},
+		{"/* FIXME(alice): leaks on error */", "FIXME", "alice", "leaks on error", true},
+		{"# XXX(bob) racy", "XXX", "bob", "racy", true},
+		{"\tx = 1; // TODO(carol)", "TODO", "carol", "", true},
+		{"// todo: lower case is prose", "", "", "", false},
+		{"TODOS = []", "", "", "", false},
+		{"MY_TODO_LIST", "", "", "", false},
+	}
+	for _, tt := range tests {
+		marker, owner, text, ok := parseTodoLine(tt.line, todoMarkers)
+		if marker != tt.marker || owner != tt.owner || text != tt.text || ok != tt.ok {
+			t.Errorf("parseTodoLine(%q) = %q, %q, %q, %v; want %q, %q, %q, %v",
+				tt.line, marker, owner, text, ok, tt.marker, tt.owner, tt.text, tt.ok)
+		}
+	}
+
+	// Only the requested markers count
+	if _, _, _, ok := parseTodoLine("// TODO: later", []string{"FIXME"}); ok {
+		t.Error("TODO matched when only FIXME was requested")
+	}
+}
+
+func TestSummarizeTodoOwners(t *testing.T) {
+	items := []TodoItem{
+		{Marker: "TODO"},
+		{Marker: "TODO", Owner: "bob"},
+		{Marker: "FIXME", Owner: "alice"},
+		{Marker: "TODO", Owner: "alice"},
+		{Marker: "XXX"},
+		{Marker: "XXX"},
+	}
+	owners := summarizeTodoOwners(items)
+	var names []string
+	for _, o := range owners {
+		names = append(names, o.Owner)
+	}
+	if strings.Join(names, ",") != "alice,bob,(unassigned)" {
+		t.Errorf("owner order = %v", names)
+	}
+	if owners[0].Total != 2 || owners[0].Counts["FIXME"] != 1 || owners[2].Counts["XXX"] != 2 {
+		t.Errorf("unexpected counts: %+v", owners)
+	}
+}
+
+func TestFindTodos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("full") != "TODO OR FIXME OR XXX" || q.Get("projects") != "proj" {
+			t.Errorf("unexpected query %v", q)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resultCount": 2, // Files, not lines
+			"results": map[string]interface{}{
+				"proj": []interface{}{
+					map[string]interface{}{"path": "/src/b.c", "lineNo": 7, "line": "/* <b>FIXME</b>(alice): a &lt; b */"},
+					map[string]interface{}{"path": "/src/a.c", "lineNo": 30, "line": "// <b>TODO</b>: retry"},
+					map[string]interface{}{"path": "/src/a.c", "lineNo": 12, "line": "// <b>TODO</b>(bob) check size"},
+					map[string]interface{}{"path": "/src/a.c", "lineNo": 50, "line": "// todo list"},
+				},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := FindTodos(context.Background(), client, TodoOptions{Projects: "proj"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	printTodoReport(&buf, report, false)
+	want := "proj/src/a.c\n" +
+		"  12: TODO(bob) check size\n" +
+		"  30: TODO retry\n" +
+		"\n" +
+		"proj/src/b.c\n" +
+		"  7: FIXME(alice) a < b\n" +
+		"\n" +
+		"OWNER          TODO  FIXME    XXX  TOTAL\n" +
+		"alice             0      1      0      1\n" +
+		"bob               1      0      0      1\n" +
+		"(unassigned)      1      0      0      1\n"
+	if buf.String() != want {
+		t.Errorf("printTodoReport() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	filtered, err := FindTodos(context.Background(), client, TodoOptions{Projects: "proj", Owner: "BOB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.Items) != 1 || filtered.Items[0].Owner != "bob" {
+		t.Errorf("--owner bob = %+v", filtered.Items)
+	}
+
+	buf.Reset()
+	if err := writeTodoJSON(&buf, filtered); err != nil {
+		t.Fatal(err)
+	}
+	var decoded TodoReport
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Owners) != 1 || decoded.Owners[0].Counts["TODO"] != 1 || decoded.Items[0].Path != "/src/a.c" {
+		t.Errorf("JSON round trip = %+v", decoded)
+	}
+}
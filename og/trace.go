@@ -1,448 +1,244 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"sort"
+	"os"
 	"strconv"
 	"strings"
+
+	"og/pkg/trace"
 )
 
-// TraceOptions configures the call graph exploration
-type TraceOptions struct {
-	Symbol    string // The function/symbol to trace
-	Depth     int    // Maximum traversal depth (default: 2)
-	Direction string // "callers" only in v1 (callees would require source parsing)
-	MaxTotal  int    // Max total nodes to explore (prevents runaway)
-	Projects  string // Projects to search in (comma-separated)
-	Type      string // File type filter
-}
+// The call graph explorer lives in og/pkg/trace so other Go programs can
+// drive it; these aliases keep the CLI's names
+type (
+	TraceOptions             = trace.Options
+	CallNode                 = trace.Node
+	TraceResult              = trace.Result
+	Definition               = trace.Definition
+	AmbiguousDefinitionError = trace.AmbiguousDefinitionError
+)
 
-// CallNode represents a node in the call graph
-type CallNode struct {
-	Symbol   string      // Function/symbol name
-	FilePath string      // Full file path where this call occurs
-	LineNo   string      // Line number
-	Relation string      // "caller" or "callee"
-	Children []*CallNode // Child nodes (further callers/callees)
+// Trace performs call graph exploration starting from the given symbol. If
+// ctx is canceled, the partial result is returned with the context's error.
+func Trace(ctx context.Context, client *Client, opts TraceOptions) (*TraceResult, error) {
+	return trace.Trace(ctx, clientSource{client}, opts)
 }
 
-// TraceResult contains the trace output and metadata
-type TraceResult struct {
-	Root       *CallNode // Root of the call tree
-	TotalNodes int       // Total nodes explored
-	MaxReached bool      // True if MaxTotal was reached
+// NewTraceExplorer returns an explorer for expanding the call graph of
+// opts.Symbol one node at a time
+func NewTraceExplorer(ctx context.Context, client *Client, opts TraceOptions) (*trace.Explorer, error) {
+	return trace.NewExplorer(ctx, clientSource{client}, opts)
 }
 
-// Trace performs call graph exploration starting from the given symbol
-func Trace(client *Client, opts TraceOptions) (*TraceResult, error) {
-	if opts.Depth <= 0 {
-		opts.Depth = 2 // Default depth
-	}
-	if opts.MaxTotal <= 0 {
-		opts.MaxTotal = 100 // Conservative default
-	}
-	if opts.Direction == "" {
-		opts.Direction = "callers" // Only callers supported in v1
-	}
-
-	if opts.Direction != "callers" {
-		return nil, fmt.Errorf("only --direction=callers is supported in this version (callees requires source parsing)")
-	}
-
-	root := &CallNode{
-		Symbol:   opts.Symbol,
-		Relation: "root",
+// warnAnyDefinition warns when result traced every definition of a symbol
+// defined in several places (see TraceOptions.AnyDefinition), so some of
+// its callers may call another function of the same name
+func warnAnyDefinition(result *TraceResult) {
+	if result == nil || len(result.Candidates) == 0 {
+		return
 	}
-
-	result := &TraceResult{
-		Root:       root,
-		TotalNodes: 0, // Don't count root node against the limit
+	paths := make([]string, len(result.Candidates))
+	for i, c := range result.Candidates {
+		paths[i] = c.String()
 	}
+	fmt.Fprint(os.Stderr, trf("Warning: %s is defined in %d places (%s); tracing the callers of all of them, use --def-path to pick one\n",
+		result.Root.Symbol, len(result.Candidates), strings.Join(paths, ", ")))
+}
 
-	// Track visited symbols to prevent cycles
-	visited := make(map[string]bool)
-	visited[opts.Symbol] = true
-
-	// BFS queue: (node, remaining depth)
-	type queueItem struct {
-		node  *CallNode
-		depth int
+// parseTraceAliases parses --alias values of the form "old_name=new_name"
+// into trace.Options.Aliases
+func parseTraceAliases(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
 	}
-	queue := []queueItem{{root, opts.Depth}}
-
-	for len(queue) > 0 {
-		item := queue[0]
-		queue = queue[1:]
-
-		if item.depth == 0 {
-			continue
-		}
-
-		if result.TotalNodes >= opts.MaxTotal {
-			result.MaxReached = true
-			break
-		}
-
-		// Skip if the node has no symbol to search for
-		if item.node.Symbol == "" {
-			continue
-		}
-
-		// Find callers of the current symbol using symbol search
-		searchOpts := SearchOptions{
-			Symbol:     item.node.Symbol,
-			Projects:   opts.Projects,
-			Type:       opts.Type,
-			MaxResults: 50, // Reasonable batch size
-		}
-
-		resp, err := client.Search(searchOpts)
-		if err != nil {
-			// Log error but continue with other branches
-			continue
-		}
-
-		// Group results by file and extract unique caller locations
-		// Use xref API to extract function names when depth allows deeper traversal
-		useXref := opts.Depth > 1
-		var callers []callerInfo
-		for project, results := range resp.Results {
-			callers = append(callers, extractCallers(client, project, results, item.node.Symbol, useXref)...)
-		}
-
-		// Sort callers for deterministic output (numerically by line number)
-		sort.Slice(callers, func(i, j int) bool {
-			if callers[i].FilePath != callers[j].FilePath {
-				return callers[i].FilePath < callers[j].FilePath
-			}
-			// Parse line numbers as integers for proper numerical sorting
-			lineI, _ := strconv.Atoi(callers[i].LineNo)
-			lineJ, _ := strconv.Atoi(callers[j].LineNo)
-			return lineI < lineJ
-		})
-
-		for _, caller := range callers {
-			if result.TotalNodes >= opts.MaxTotal {
-				result.MaxReached = true
-				break
-			}
-
-			// Use file:line as unique identifier to prevent duplicate locations
-			locationKey := caller.FilePath + ":" + caller.LineNo
-			if visited[locationKey] {
-				continue
-			}
-			visited[locationKey] = true
-
-			// Also track by symbol name to prevent cycles in the call graph
-			if caller.Symbol != "" && visited[caller.Symbol] {
-				continue
-			}
-			if caller.Symbol != "" {
-				visited[caller.Symbol] = true
-			}
-
-			child := &CallNode{
-				Symbol:   caller.Symbol,
-				FilePath: caller.FilePath,
-				LineNo:   caller.LineNo,
-				Relation: "caller",
-			}
-			item.node.Children = append(item.node.Children, child)
-			result.TotalNodes++
-
-			// Only queue for further exploration if we have a symbol name
-			if caller.Symbol != "" {
-				queue = append(queue, queueItem{child, item.depth - 1})
-			}
+	aliases := make(map[string]string, len(values))
+	for _, v := range values {
+		alias, symbol, ok := strings.Cut(v, "=")
+		alias, symbol = strings.TrimSpace(alias), strings.TrimSpace(symbol)
+		if !ok || alias == "" || symbol == "" || alias == symbol {
+			return nil, fmt.Errorf("invalid alias %q: use old_name=new_name", v)
 		}
+		aliases[alias] = symbol
 	}
-
-	return result, nil
+	return aliases, nil
 }
 
-// callerInfo holds extracted caller information
-type callerInfo struct {
-	Symbol   string
-	FilePath string
-	LineNo   string
-}
-
-// extractCallers extracts caller information from search results
-// If useXref is true, fetches surrounding context to determine enclosing function names
-// This enables depth > 1 traversal but is slower due to additional API calls
-func extractCallers(client *Client, project string, results []SearchResult, searchedSymbol string, useXref bool) []callerInfo {
-	var callers []callerInfo
-	seen := make(map[string]bool)
-
-	// Cache file contents to avoid refetching the same file for multiple line numbers
-	fileCache := make(map[string][]string)
-
-	for _, r := range results {
-		lineNo := string(r.LineNo)
-		if lineNo == "" || lineNo == "0" {
-			continue
-		}
-
-		filePath := buildTraceFilePath(project, r)
-		if filePath == "" {
-			continue
-		}
-
-		// Create a unique key for this location
-		key := filePath + ":" + lineNo
-		if seen[key] {
-			continue
-		}
-		seen[key] = true
-
-		var symbol string
-		if useXref {
-			// Fetch surrounding context to find enclosing function
-			// This is slower but enables multi-level traversal
-			lineNoInt := 0
-			fmt.Sscanf(lineNo, "%d", &lineNoInt)
-			if lineNoInt > 0 {
-				symbol = extractFunctionNameFromContextCached(client, filePath, lineNoInt, fileCache)
-			}
-		}
-
-		// Fallback to simple line-based extraction if xref didn't work
-		if symbol == "" {
-			symbol = extractSymbolFromLine(r.Line, searchedSymbol)
-		}
-
-		callers = append(callers, callerInfo{
-			Symbol:   symbol,
-			FilePath: filePath,
-			LineNo:   lineNo,
-		})
+// loadTraceExcludes returns the exclusion patterns traces start from:
+// "excludes" in the config's trace section if set, else
+// trace.DefaultExcludes
+func loadTraceExcludes() []string {
+	if cfg, _ := LoadConfig(); cfg != nil && cfg.Trace != nil && cfg.Trace.Excludes != nil {
+		return cfg.Trace.Excludes
 	}
-
-	return callers
+	return trace.DefaultExcludes
 }
 
-func buildTraceFilePath(project string, result SearchResult) string {
-	path := result.Path
-	if path == "" && (result.Directory != "" || result.Filename != "") {
-		dir := strings.TrimSuffix(result.Directory, "/")
-		if dir != "" && result.Filename != "" {
-			path = dir + "/" + result.Filename
-		} else if result.Filename != "" {
-			path = result.Filename
-		} else {
-			path = dir
-		}
+// traceExcludes combines the base exclusion patterns with --exclude values;
+// noDefaults (--no-default-excludes) drops the base patterns
+func traceExcludes(base []string, noDefaults bool, extra []string) []string {
+	var excludes []string
+	if !noDefaults {
+		excludes = append(excludes, base...)
 	}
+	return append(excludes, extra...)
+}
 
-	path = strings.TrimPrefix(path, "/")
-	if project != "" && strings.HasPrefix(path, project+"/") {
-		path = strings.TrimPrefix(path, project+"/")
-	}
-	if project != "" {
-		if path == "" {
-			return "/" + project
-		}
-		return "/" + project + "/" + path
-	}
-	if path == "" {
-		return ""
-	}
-	return "/" + path
+// clientSource adapts Client to the searches and fetches trace needs
+type clientSource struct {
+	client *Client
 }
 
-// extractSymbolFromLine attempts to extract a caller function name from a source line
-// This is a heuristic approach - we look for patterns that suggest function calls
-// Returns empty string if no caller can be identified
-//
-// LIMITATION: The basic OpenGrok search API only returns the line where a symbol
-// is referenced, not the enclosing function name. To find the enclosing function,
-// we would need to:
-//  1. Fetch surrounding lines using OpenGrok's xref API
-//  2. Parse backwards to find the function signature
-//  3. Handle complex cases (nested functions, macros, etc.)
-//
-// For now, this returns empty string, which means --depth > 1 will not traverse
-// beyond direct callers. Future enhancement: use xref API for context.
-func extractSymbolFromLine(line, searchedSymbol string) string {
-	// Strip HTML tags that OpenGrok adds for highlighting
-	cleaned := stripHTMLTags(line)
-	cleaned = strings.TrimSpace(cleaned)
-
-	// Skip obvious non-caller patterns
-	lowerLine := strings.ToLower(cleaned)
-	if strings.HasPrefix(lowerLine, "//") || strings.HasPrefix(lowerLine, "/*") ||
-		strings.HasPrefix(lowerLine, "*") || strings.HasPrefix(lowerLine, "#") {
-		return "" // Comment or preprocessor
-	}
+func (s clientSource) Definitions(ctx context.Context, symbol, projects, fileType string, max int) ([]trace.Hit, error) {
+	return s.search(ctx, SearchOptions{Def: symbol, Projects: projects, Type: fileType, MaxResults: max})
+}
 
-	// TODO: Implement function name extraction using OpenGrok xref API
-	// For now, return empty - the file:line location is still useful
-	return ""
+func (s clientSource) References(ctx context.Context, symbol, projects, fileType string, max int) ([]trace.Hit, error) {
+	return s.search(ctx, SearchOptions{Symbol: symbol, Projects: projects, Type: fileType, MaxResults: max})
 }
 
-// extractFunctionNameFromContextCached fetches surrounding source lines and parses
-// backwards to find the enclosing function name.
-// Uses a cache to avoid refetching the same file multiple times.
-func extractFunctionNameFromContextCached(client *Client, filePath string, lineNo int, cache map[string][]string) string {
-	// Fetch lines around the target line (look back up to 100 lines)
-	startLine := lineNo - 100
-	if startLine < 1 {
-		startLine = 1
-	}
+func (s clientSource) FileLines(ctx context.Context, filePath string) ([]string, error) {
+	return s.client.GetFileLinesContext(ctx, filePath, 1, 999999) // Fetch whole file
+}
 
-	// Check cache first - we cache the entire file to help with multiple lookups
-	cacheKey := filePath
-	lines, found := cache[cacheKey]
-
-	if !found {
-		// Fetch the entire file and cache it (more efficient than many small requests)
-		var err error
-		lines, err = client.GetFileLines(filePath, 1, 999999) // Fetch whole file
-		if err != nil {
-			// If we can't fetch context, return empty
-			return ""
-		}
-		cache[cacheKey] = lines
+func (s clientSource) search(ctx context.Context, opts SearchOptions) ([]trace.Hit, error) {
+	resp, err := s.client.SearchContext(ctx, opts)
+	if err != nil {
+		return nil, err
 	}
-
-	// Extract the range we need from the cached full file
-	// Lines are 1-indexed, array is 0-indexed
-	var contextLines []string
-	for i := startLine - 1; i < lineNo && i < len(lines); i++ {
-		if i >= 0 {
-			contextLines = append(contextLines, lines[i])
-		}
+	var hits []trace.Hit
+	for _, r := range resp.OrderedEntries() {
+		hits = append(hits, trace.Hit{
+			FilePath: buildTraceFilePath(r.Project, r.SearchResult),
+			LineNo:   string(r.LineNo),
+			Line:     stripHTMLTags(r.Line),
+		})
 	}
-
-	// Parse backwards to find function definition
-	funcName := parseFunctionName(contextLines)
-	return funcName
+	return hits, nil
 }
 
-// parseFunctionName parses source lines backwards to find the enclosing function
-// Handles C/C++ function definitions with patterns like:
-//
-//	return_type function_name(params) {
-//	type* function_name(params) {
-//	static inline type function_name(params) {
-func parseFunctionName(lines []string) string {
-	// Work backwards from the last line
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := lines[i] // Keep original indentation for analysis
-		trimmed := strings.TrimSpace(line)
-
-		// Skip empty lines, comments, and preprocessor
-		if trimmed == "" || strings.HasPrefix(trimmed, "//") ||
-			strings.HasPrefix(trimmed, "/*") || strings.HasPrefix(trimmed, "*") ||
-			strings.HasPrefix(trimmed, "#") {
-			continue
-		}
-
-		// Function definitions start at column 0 or with minimal indentation
-		// Skip lines that are clearly inside a function body (indented)
-		leadingSpaces := len(line) - len(strings.TrimLeft(line, " \t"))
-		if leadingSpaces > 1 {
-			continue // Too indented to be a function definition
-		}
-
-		// Skip lines that look like function calls or statements, not definitions:
-		// - Lines starting with "if", "for", "while", "return", etc.
-		// - Lines containing "=" before "(" (assignments)
-		// - Lines containing ";" (statements)
-		if strings.Contains(trimmed, ";") {
-			continue
-		}
-		// Look for function definition pattern: identifier followed by (
-		parenIdx := strings.Index(trimmed, "(")
-		if parenIdx == -1 {
-			continue
-		}
-		// Skip assignments where = appears before (
-		if eqIdx := strings.Index(trimmed, "="); eqIdx != -1 && eqIdx < parenIdx {
-			continue
-		}
-
-		// Extract tokens before the (
-		before := trimmed[:parenIdx]
-		tokens := strings.Fields(before)
-
-		if len(tokens) == 0 {
-			continue
-		}
-
-		// The last token before ( is likely the function name
-		funcName := tokens[len(tokens)-1]
-
-		// Clean up any pointer/reference markers (from either side)
-		funcName = strings.Trim(funcName, "*&")
-
-		// Skip common keywords that aren't function names
-		if isCommonKeyword(funcName) {
-			continue
-		}
-
-		// Skip if it looks like a macro or type cast
-		if strings.ToUpper(funcName) == funcName && len(funcName) > 2 {
-			continue // ALL_CAPS likely a macro
-		}
-
-		// For a function definition, the opening brace should be on this line
-		// or within the next few lines (for multi-line parameter lists)
-		if strings.Contains(trimmed, "{") {
-			return funcName
-		}
+func buildTraceFilePath(project string, result SearchResult) string {
+	return projectPath(project, resultPath(project, result))
+}
 
-		// Look ahead a few lines for opening brace (multi-line params)
-		for j := i + 1; j < len(lines) && j < i+10; j++ {
-			nextLine := strings.TrimSpace(lines[j])
-			// If we hit another function-like pattern, stop looking
-			if strings.Contains(nextLine, ";") && !strings.Contains(nextLine, "{") {
-				break
+// AnnotateTrace attaches annotations from og_annotate storage to trace nodes.
+// A node matches annotations on its call line, or anywhere from the enclosing
+// function's definition line down to the call when the definition is known.
+func AnnotateTrace(result *TraceResult, storagePath string) {
+	if storagePath == "" || result == nil || result.Root == nil {
+		return
+	}
+	idx := newAnnotationIndex(storagePath)
+
+	var walk func(node *CallNode)
+	walk = func(node *CallNode) {
+		if node.FilePath != "" {
+			line, _ := strconv.Atoi(node.LineNo)
+			from := line
+			if node.DefLine > 0 && node.DefLine <= line {
+				from = node.DefLine
 			}
-			if strings.HasPrefix(nextLine, "{") || strings.Contains(nextLine, ")") && strings.Contains(nextLine, "{") {
-				return funcName
+			for _, ann := range idx.forFile(node.FilePath) {
+				if ann.Line >= from && ann.Line <= line {
+					node.Annotations = append(node.Annotations, ann)
+				}
 			}
 		}
+		for _, child := range node.Children {
+			walk(child)
+		}
 	}
-
-	return ""
+	walk(result.Root)
 }
 
-// isCommonKeyword returns true if s is a common C/C++ keyword or construct
-func isCommonKeyword(s string) bool {
-	keywords := map[string]bool{
-		"if": true, "for": true, "while": true, "switch": true,
-		"return": true, "sizeof": true, "typeof": true, "struct": true,
-		"union": true, "enum": true, "case": true, "do": true,
-	}
-	return keywords[s]
+// TreeFormatOptions controls how FormatTreeWithOptions renders a trace
+type TreeFormatOptions struct {
+	UseColor        bool
+	WebLinks        bool
+	ServerURL       string
+	ShowAnnotations bool // Inline annotation text under annotated nodes
+	// RelativeTo is a path prefix (e.g. "/proj/usr/src") removed from the
+	// locations shown
+	RelativeTo string
+	// StripCommonPrefix removes the directory shared by all locations and
+	// notes it below the tree (ignored when RelativeTo is set)
+	StripCommonPrefix bool
+	// MaxWidth shortens paths with a middle ellipsis so that lines fit in
+	// this many columns (0 for no limit)
+	MaxWidth int
 }
 
 // FormatTree formats the call graph as an ASCII tree
 func FormatTree(result *TraceResult, useColor bool, webLinks bool, serverURL string) string {
+	return FormatTreeWithOptions(result, TreeFormatOptions{
+		UseColor:  useColor,
+		WebLinks:  webLinks,
+		ServerURL: serverURL,
+	})
+}
+
+// FormatTreeWithOptions formats the call graph as an ASCII tree
+func FormatTreeWithOptions(result *TraceResult, opts TreeFormatOptions) string {
 	var sb strings.Builder
+	paths := newTracePaths(result, opts)
 
-	// Root node
-	if useColor {
-		sb.WriteString(colorBold + result.Root.Symbol + colorReset + "\n")
+	// Root node, with its definition site when known
+	if opts.UseColor {
+		sb.WriteString(colorBold + result.Root.Symbol + colorReset)
 	} else {
-		sb.WriteString(result.Root.Symbol + "\n")
+		sb.WriteString(result.Root.Symbol)
+	}
+	if result.Root.FilePath != "" {
+		used := displayWidth(result.Root.Symbol) + len(" (:)") + len(result.Root.LineNo)
+		shown := paths.display(result.Root.FilePath, used)
+		location := formatShownLocation(result.Root.FilePath, shown, result.Root.LineNo, opts.WebLinks, opts.ServerURL)
+		if opts.UseColor {
+			location = colorMagenta + location + colorReset
+		}
+		sb.WriteString(" " + location)
 	}
+	sb.WriteString("\n")
+
+	// Format children; printed records the functions shown so far, for
+	// pointing Ref nodes above or below
+	printed := map[string]bool{result.Root.Symbol: true}
+	formatTreeNode(&sb, result.Root.Children, "", nodeProject(result.Root), opts, paths, printed)
 
-	// Format children
-	formatTreeNode(&sb, result.Root.Children, "", useColor, webLinks, serverURL)
+	if paths.prefix != "" {
+		sb.WriteString(fmt.Sprintf("\n(paths relative to %s)\n", paths.prefix))
+	}
+	if result.Refs > 0 {
+		sb.WriteString(fmt.Sprintf("\n(%d calls from functions already shown are listed as references; their callers appear once)\n", result.Refs))
+	}
+	if result.Excluded > 0 {
+		sb.WriteString(fmt.Sprintf("\n(%d direct callers of other %s definitions omitted)\n", result.Excluded, result.Root.Symbol))
+	}
+	if result.CrossProject > 0 {
+		sb.WriteString(fmt.Sprintf("\n(%d callers in other projects left out by --same-project-only)\n", result.CrossProject))
+	}
+	if result.Skipped > 0 {
+		sb.WriteString(fmt.Sprintf("\n(%d call sites in excluded files skipped; --no-default-excludes includes test and generated code)\n", result.Skipped))
+	}
 
 	// Add footer if max was reached
 	if result.MaxReached {
 		sb.WriteString(fmt.Sprintf("\n... (stopped at %d nodes, use --max-total to increase)\n", result.TotalNodes))
 	}
+	if result.TimedOut {
+		sb.WriteString(fmt.Sprintf("\n... (time budget exhausted; showing the %d nodes found so far, use --total-timeout to extend)\n", result.TotalNodes))
+	}
+	if result.Interrupted {
+		sb.WriteString(fmt.Sprintf("\n... (interrupted; showing the %d nodes found so far)\n", result.TotalNodes))
+	}
 
 	return sb.String()
 }
 
-// formatTreeNode recursively formats tree nodes
-func formatTreeNode(sb *strings.Builder, children []*CallNode, prefix string, useColor bool, webLinks bool, serverURL string) {
+// formatTreeNode recursively formats tree nodes; a child in another project
+// than parentProject, the project of the node it calls, is marked as
+// crossing into its own
+func formatTreeNode(sb *strings.Builder, children []*CallNode, prefix, parentProject string, opts TreeFormatOptions, paths *tracePaths, printed map[string]bool) {
 	for i, child := range children {
 		isLast := i == len(children)-1
 
@@ -461,8 +257,39 @@ func formatTreeNode(sb *strings.Builder, children []*CallNode, prefix string, us
 		sb.WriteString(connector)
 
 		// Format relation and location
-		location := formatLocation(child.FilePath, child.LineNo, webLinks, serverURL)
-		if useColor {
+		marker := ""
+		if n := len(child.Annotations); n > 0 {
+			marker = fmt.Sprintf(" [%d note", n)
+			if n > 1 {
+				marker += "s"
+			}
+			marker += "]"
+		}
+		// A Ref node points at where its function's callers are listed
+		ref := ""
+		if child.Ref {
+			where := "below"
+			if printed[child.Symbol] {
+				where = "above"
+			}
+			ref = fmt.Sprintf(" → see %s() %s", child.Symbol, where)
+		} else if child.Symbol != "" {
+			printed[child.Symbol] = true
+		}
+		// A caller found through an alias or wrapper macro names it
+		via := ""
+		if child.Via != "" {
+			via = fmt.Sprintf(" via %s()", child.Via)
+		}
+		project := nodeProject(child)
+		crossing := ""
+		if parentProject != "" && project != "" && project != parentProject {
+			crossing = " ↪ project:" + project
+		}
+		used := displayWidth(prefix+connector+child.Relation+child.Symbol+crossing+via+marker+ref) + len("[]  (:)") + len(child.LineNo)
+		shown := paths.display(child.FilePath, used)
+		location := formatShownLocation(child.FilePath, shown, child.LineNo, opts.WebLinks, opts.ServerURL)
+		if opts.UseColor {
 			sb.WriteString(fmt.Sprintf("[%s%s%s] ", colorCyan, child.Relation, colorReset))
 			if child.Symbol != "" {
 				sb.WriteString(colorBold + child.Symbol + colorReset + " ")
@@ -475,31 +302,68 @@ func formatTreeNode(sb *strings.Builder, children []*CallNode, prefix string, us
 			}
 			sb.WriteString(location)
 		}
+		if crossing != "" && opts.UseColor {
+			crossing = colorGreen + crossing + colorReset
+		}
+		sb.WriteString(crossing)
+		sb.WriteString(via)
+		if marker != "" {
+			if opts.UseColor {
+				marker = colorBold + marker + colorReset
+			}
+			sb.WriteString(marker)
+		}
+		sb.WriteString(ref)
 		sb.WriteString("\n")
 
+		if opts.ShowAnnotations {
+			for _, ann := range child.Annotations {
+				tags := ""
+				if len(ann.Tags) > 0 {
+					tags = " [" + strings.Join(ann.Tags, ", ") + "]"
+				}
+				sb.WriteString(fmt.Sprintf("%s  > @%s (line %d)%s:\n", childPrefix, ann.Author, ann.Line, tags))
+				for _, textLine := range strings.Split(ann.Text, "\n") {
+					sb.WriteString(fmt.Sprintf("%s  > %s\n", childPrefix, textLine))
+				}
+			}
+		}
+
 		// Recurse for children
 		if len(child.Children) > 0 {
-			formatTreeNode(sb, child.Children, childPrefix, useColor, webLinks, serverURL)
+			formatTreeNode(sb, child.Children, childPrefix, project, opts, paths, printed)
 		}
 	}
 }
 
+// nodeProject returns the project of a node's call site, taken from its
+// path for traces saved before nodes recorded it
+func nodeProject(node *CallNode) string {
+	if node.Project != "" {
+		return node.Project
+	}
+	return trace.ProjectOf(node.FilePath)
+}
+
 // formatLocation formats a file path and line number for display
 // If webLinks is true, wraps the location in a clickable hyperlink
 func formatLocation(filePath, lineNo string, webLinks bool, serverURL string) string {
+	return formatShownLocation(filePath, filePath, lineNo, webLinks, serverURL)
+}
+
+// formatShownLocation is formatLocation with the path shown as shown (e.g.
+// shortened) while any link still points at filePath
+func formatShownLocation(filePath, shown, lineNo string, webLinks bool, serverURL string) string {
 	var location string
 	if lineNo != "" {
-		location = fmt.Sprintf("(%s:%s)", filePath, lineNo)
+		location = fmt.Sprintf("(%s:%s)", shown, lineNo)
 	} else {
-		location = fmt.Sprintf("(%s)", filePath)
+		location = fmt.Sprintf("(%s)", shown)
 	}
 
 	if webLinks && serverURL != "" {
 		// Construct OpenGrok xref URL
-		webURL := fmt.Sprintf("%s/xref%s", serverURL, filePath)
-		if lineNo != "" {
-			webURL += "#" + lineNo
-		}
+		webURL := xrefURL(serverURL, "", filePath, lineNo)
 		// Wrap in OSC 8 hyperlink escape sequence
 		return fmt.Sprintf("\033]8;;%s\033\\%s\033]8;;\033\\", webURL, location)
 	}
@@ -1,10 +1,14 @@
 package main
 
 import (
-	"sort"
-	"strconv"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+
+	"og/pkg/trace"
 )
 
 func TestFormatTree(t *testing.T) {
@@ -76,6 +80,91 @@ func TestFormatTree(t *testing.T) {
 	t.Logf("Tree output:\n%s", output)
 }
 
+func TestFormatTreeRefs(t *testing.T) {
+	dispatch := &CallNode{Symbol: "dispatch", FilePath: "/p/main.c", LineNo: "2", Relation: "caller"}
+	ref := &CallNode{Symbol: "dispatch", FilePath: "/p/main.c", LineNo: "3", Relation: "caller", Ref: true}
+	result := &TraceResult{
+		Root: &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{
+			{Symbol: "read_a", FilePath: "/p/a.c", LineNo: "2", Relation: "caller", Children: []*CallNode{ref}},
+			{Symbol: "read_b", FilePath: "/p/b.c", LineNo: "2", Relation: "caller", Children: []*CallNode{dispatch}},
+		}},
+		TotalNodes: 3,
+		Refs:       1,
+	}
+	output := FormatTree(result, false, false, "")
+	// The first occurrence printed may be the reference, pointing down
+	if !strings.Contains(output, "[caller] dispatch (/p/main.c:3) → see dispatch() below\n") {
+		t.Errorf("missing reference line:\n%s", output)
+	}
+	if !strings.Contains(output, "1 calls from functions already shown are listed as references") {
+		t.Errorf("missing reference count:\n%s", output)
+	}
+
+	// Once the function has been printed, references point up
+	result.Root.Children[0].Children, result.Root.Children[1].Children = []*CallNode{dispatch}, []*CallNode{ref}
+	if output := FormatTree(result, false, false, ""); !strings.Contains(output, "→ see dispatch() above") {
+		t.Errorf("reference should point above:\n%s", output)
+	}
+}
+
+func TestFormatTreeVia(t *testing.T) {
+	result := &TraceResult{
+		Root: &CallNode{Symbol: "vn_rele", Relation: "root", Children: []*CallNode{
+			{Symbol: "close_b", FilePath: "/p/b.c", LineNo: "2", Relation: "caller", Via: "VN_RELE"},
+		}},
+		TotalNodes: 1,
+	}
+	if output := FormatTree(result, false, false, ""); !strings.Contains(output, "[caller] close_b (/p/b.c:2) via VN_RELE()\n") {
+		t.Errorf("missing via marker:\n%s", output)
+	}
+}
+
+func TestParseTraceAliases(t *testing.T) {
+	aliases, err := parseTraceAliases([]string{"VN_RELE=vn_rele", " old_free = kfree "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 2 || aliases["VN_RELE"] != "vn_rele" || aliases["old_free"] != "kfree" {
+		t.Errorf("parseTraceAliases() = %v", aliases)
+	}
+	for _, bad := range []string{"vn_rele", "=vn_rele", "VN_RELE=", "x=x"} {
+		if _, err := parseTraceAliases([]string{bad}); err == nil {
+			t.Errorf("parseTraceAliases(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTraceExcludes(t *testing.T) {
+	writeTestConfig(t, `{"version": 1, "server_url": "https://x"}`)
+	if got := traceExcludes(loadTraceExcludes(), false, []string{"*_mock.c"}); !reflect.DeepEqual(got, append(append([]string{}, trace.DefaultExcludes...), "*_mock.c")) {
+		t.Errorf("without config: %q, want the defaults and *_mock.c", got)
+	}
+	if got := traceExcludes(loadTraceExcludes(), true, []string{"*_mock.c"}); !reflect.DeepEqual(got, []string{"*_mock.c"}) {
+		t.Errorf("--no-default-excludes: %q, want only *_mock.c", got)
+	}
+
+	// The config's list replaces the defaults; an empty one turns them off
+	writeTestConfig(t, `{"version": 1, "server_url": "https://x", "trace": {"excludes": ["/tests/"]}}`)
+	if got := traceExcludes(loadTraceExcludes(), false, nil); !reflect.DeepEqual(got, []string{"/tests/"}) {
+		t.Errorf("configured excludes: %q, want [/tests/]", got)
+	}
+	writeTestConfig(t, `{"version": 1, "server_url": "https://x", "trace": {"excludes": []}}`)
+	if got := traceExcludes(loadTraceExcludes(), false, nil); len(got) != 0 {
+		t.Errorf("empty configured excludes: %q, want none", got)
+	}
+}
+
+func TestFormatTreeSkipped(t *testing.T) {
+	result := &TraceResult{
+		Root:       &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{{Symbol: "init", FilePath: "/p/a.c", LineNo: "2", Relation: "caller"}}},
+		TotalNodes: 1,
+		Skipped:    3,
+	}
+	if output := FormatTree(result, false, false, ""); !strings.Contains(output, "(3 call sites in excluded files skipped;") {
+		t.Errorf("missing skipped count:\n%s", output)
+	}
+}
+
 func TestFormatTreeWithMaxReached(t *testing.T) {
 	root := &CallNode{
 		Symbol:   "test",
@@ -135,169 +224,6 @@ func TestFormatTreeEmpty(t *testing.T) {
 	t.Logf("Empty tree output:\n%s", output)
 }
 
-func TestExtractSymbolFromLine(t *testing.T) {
-	tests := []struct {
-		name           string
-		line           string
-		searchedSymbol string
-		expected       string
-	}{
-		{
-			name:           "comment line",
-			line:           "// This calls malloc for allocation",
-			searchedSymbol: "malloc",
-			expected:       "",
-		},
-		{
-			name:           "block comment",
-			line:           "/* malloc is used here */",
-			searchedSymbol: "malloc",
-			expected:       "",
-		},
-		{
-			name:           "preprocessor directive",
-			line:           "#define USE_MALLOC 1",
-			searchedSymbol: "malloc",
-			expected:       "",
-		},
-		{
-			name:           "normal code line",
-			line:           "    ptr = malloc(size);",
-			searchedSymbol: "malloc",
-			expected:       "", // Current implementation returns empty
-		},
-		{
-			name:           "html tags stripped",
-			line:           "    ptr = <b>malloc</b>(size);",
-			searchedSymbol: "malloc",
-			expected:       "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := extractSymbolFromLine(tt.line, tt.searchedSymbol)
-			if result != tt.expected {
-				t.Errorf("got %q, want %q", result, tt.expected)
-			}
-		})
-	}
-}
-
-func TestExtractCallers(t *testing.T) {
-	// Create a mock SearchResponse
-	resp := &SearchResponse{
-		ResultCount: 3,
-		Results: map[string][]SearchResult{
-			"project": {
-				{Line: "ptr = malloc(size);", LineNo: "42", Path: "/src/file1.c"},
-				{Line: "buf = malloc(len);", LineNo: "100", Path: "/src/file1.c"},
-				{Line: "data = malloc(n);", LineNo: "50", Path: "/src/file2.c"},
-			},
-		},
-	}
-
-	// Create a minimal client for testing (won't make real calls in this test)
-	client := &Client{BaseURL: "http://test"}
-	callers := extractCallers(client, "project", resp.Results["project"], "malloc", false)
-
-	// Should have 3 unique callers
-	if len(callers) != 3 {
-		t.Errorf("Expected 3 callers, got %d", len(callers))
-	}
-
-	// Verify locations are extracted
-	foundFile1Line42 := false
-	foundFile1Line100 := false
-	foundFile2Line50 := false
-
-	for _, c := range callers {
-		if c.FilePath == "/project/src/file1.c" && c.LineNo == "42" {
-			foundFile1Line42 = true
-		}
-		if c.FilePath == "/project/src/file1.c" && c.LineNo == "100" {
-			foundFile1Line100 = true
-		}
-		if c.FilePath == "/project/src/file2.c" && c.LineNo == "50" {
-			foundFile2Line50 = true
-		}
-	}
-
-	if !foundFile1Line42 {
-		t.Error("Expected to find file1.c:42")
-	}
-	if !foundFile1Line100 {
-		t.Error("Expected to find file1.c:100")
-	}
-	if !foundFile2Line50 {
-		t.Error("Expected to find file2.c:50")
-	}
-}
-
-func TestExtractCallersDeduplication(t *testing.T) {
-	// Create a response with duplicate locations
-	resp := &SearchResponse{
-		ResultCount: 2,
-		Results: map[string][]SearchResult{
-			"project": {
-				{Line: "call1", LineNo: "42", Path: "/src/file.c"},
-				{Line: "call2", LineNo: "42", Path: "/src/file.c"}, // Same line number - should be deduplicated
-			},
-		},
-	}
-
-	client := &Client{BaseURL: "http://test"}
-	callers := extractCallers(client, "project", resp.Results["project"], "test", false)
-
-	// Should only have 1 caller after deduplication
-	if len(callers) != 1 {
-		t.Errorf("Expected 1 caller after deduplication, got %d", len(callers))
-	}
-}
-
-func TestExtractCallersSkipsInvalidLineNumbers(t *testing.T) {
-	resp := &SearchResponse{
-		ResultCount: 3,
-		Results: map[string][]SearchResult{
-			"project": {
-				{Line: "valid", LineNo: "42", Path: "/src/file.c"},
-				{Line: "empty", LineNo: ""}, // Should be skipped
-				{Line: "zero", LineNo: "0"}, // Should be skipped
-				{Line: "another valid", LineNo: "100", Path: "/src/file.c"},
-			},
-		},
-	}
-
-	client := &Client{BaseURL: "http://test"}
-	callers := extractCallers(client, "project", resp.Results["project"], "test", false)
-
-	// Should only have 2 callers (skipping empty and "0" line numbers)
-	if len(callers) != 2 {
-		t.Errorf("Expected 2 valid callers, got %d", len(callers))
-	}
-}
-
-func TestTraceOptionsDefaults(t *testing.T) {
-	// Test that Trace handles default options correctly
-	// This is a unit test that doesn't make network calls
-
-	opts := TraceOptions{
-		Symbol: "test_func",
-		// Leave other options at zero values
-	}
-
-	// Check that zero values exist (the Trace function will set defaults)
-	if opts.Depth != 0 {
-		t.Error("Expected Depth to be zero initially")
-	}
-	if opts.MaxTotal != 0 {
-		t.Error("Expected MaxTotal to be zero initially")
-	}
-	if opts.Direction != "" {
-		t.Error("Expected Direction to be empty initially")
-	}
-}
-
 func TestTraceInvalidDirection(t *testing.T) {
 	// Create a minimal client (won't be used since we expect an error)
 	client := &Client{BaseURL: "http://test"}
@@ -307,7 +233,7 @@ func TestTraceInvalidDirection(t *testing.T) {
 		Direction: "callees", // Not supported in v1
 	}
 
-	_, err := Trace(client, opts)
+	_, err := Trace(context.Background(), client, opts)
 	if err == nil {
 		t.Error("Expected error for unsupported direction 'callees'")
 	}
@@ -389,219 +315,226 @@ func TestFormatLocationWithWebLinks(t *testing.T) {
 	}
 }
 
-func TestCallersSortedNumerically(t *testing.T) {
-	// This test verifies that callers are sorted by line number numerically,
-	// not lexicographically. Without numerical sorting, "100" < "42" < "9"
-	// because string comparison uses character-by-character ordering.
-	resp := &SearchResponse{
-		ResultCount: 4,
-		Results: map[string][]SearchResult{
-			"project": {
-				{Line: "line 100", LineNo: "100", Path: "/src/file.c"},
-				{Line: "line 42", LineNo: "42", Path: "/src/file.c"},
-				{Line: "line 9", LineNo: "9", Path: "/src/file.c"},
-				{Line: "line 1000", LineNo: "1000", Path: "/src/file.c"},
-			},
-		},
+func TestTraceUsesLevelProjects(t *testing.T) {
+	// probe() is called from driver_init() in the drivers project, which is
+	// called from kernel_main() in the kernel project
+	scopes := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/search":
+			symbol := r.URL.Query().Get("symbol")
+			scopes[symbol] = r.URL.Query().Get("projects")
+			switch symbol {
+			case "probe":
+				w.Write([]byte(`{"resultCount":1,"results":{"/drivers/drv.c":[{"line":"probe();","lineNo":"3"}]}}`))
+			case "driver_init":
+				w.Write([]byte(`{"resultCount":1,"results":{"/kernel/main.c":[{"line":"driver_init();","lineNo":"2"}]}}`))
+			default:
+				w.Write([]byte(`{"resultCount":0,"results":{}}`))
+			}
+		case r.URL.Path == "/raw/drivers/drv.c":
+			w.Write([]byte("void driver_init(void) {\n\tint x;\n\tprobe();\n}\n"))
+		case r.URL.Path == "/raw/kernel/main.c":
+			w.Write([]byte("int kernel_main(void) {\n\tdriver_init();\n}\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Trace(context.Background(), client, TraceOptions{
+		Symbol:        "probe",
+		Depth:         2,
+		Projects:      "drivers",
+		LevelProjects: []string{"drivers", "*"},
+	})
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
 	}
 
-	client := &Client{BaseURL: "http://test"}
-	callers := extractCallers(client, "project", resp.Results["project"], "test", false)
+	if scopes["probe"] != "drivers" {
+		t.Errorf("level 1 projects: got %q, want %q", scopes["probe"], "drivers")
+	}
+	if scopes["driver_init"] != "" {
+		t.Errorf("level 2 projects: got %q, want all projects", scopes["driver_init"])
+	}
+	if result.TotalNodes != 2 {
+		t.Errorf("expected 2 nodes, got %d", result.TotalNodes)
+	}
+}
 
-	// Sort using the same logic as in Trace
-	sort.Slice(callers, func(i, j int) bool {
-		if callers[i].FilePath != callers[j].FilePath {
-			return callers[i].FilePath < callers[j].FilePath
-		}
-		// Parse line numbers as integers for proper numerical sorting
-		lineI, _ := strconv.Atoi(callers[i].LineNo)
-		lineJ, _ := strconv.Atoi(callers[j].LineNo)
-		return lineI < lineJ
-	})
+func TestAnnotateTrace(t *testing.T) {
+	dir := t.TempDir()
+	writeAnnotationFile(t, dir, "proj", "src/drv.c", sampleV2Annotations)
 
-	// Verify the order is numerically correct: 9, 42, 100, 1000
-	expected := []string{"9", "42", "100", "1000"}
-	for i, caller := range callers {
-		if caller.LineNo != expected[i] {
-			t.Errorf("Position %d: got line %s, want %s", i, caller.LineNo, expected[i])
-		}
+	callSite := &CallNode{Symbol: "driver_init", FilePath: "/proj/src/drv.c", LineNo: "3", Relation: "caller", DefLine: 1}
+	other := &CallNode{FilePath: "/proj/src/other.c", LineNo: "10", Relation: "caller"}
+	lineOnly := &CallNode{FilePath: "/proj/src/drv.c", LineNo: "3", Relation: "caller"}
+	result := &TraceResult{
+		Root:       &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{callSite, other, lineOnly}},
+		TotalNodes: 3,
 	}
 
-	t.Logf("Sorted callers: %v, %v, %v, %v",
-		callers[0].LineNo, callers[1].LineNo, callers[2].LineNo, callers[3].LineNo)
-}
+	AnnotateTrace(result, dir)
 
-func TestCallersSortedByFileAndLine(t *testing.T) {
-	// Test sorting with multiple files
-	resp := &SearchResponse{
-		ResultCount: 6,
-		Results: map[string][]SearchResult{
-			"project": {
-				{Line: "line 50", LineNo: "50", Path: "/b/file.c"},
-				{Line: "line 10", LineNo: "10", Path: "/b/file.c"},
-				{Line: "line 100", LineNo: "100", Path: "/a/file.c"},
-				{Line: "line 5", LineNo: "5", Path: "/a/file.c"},
-				{Line: "line 1", LineNo: "1", Path: "/c/file.c"},
-				{Line: "line 999", LineNo: "999", Path: "/c/file.c"},
-			},
-		},
+	if len(callSite.Annotations) != 2 {
+		t.Errorf("call site within annotated function: got %d annotations, want 2", len(callSite.Annotations))
+	}
+	if len(lineOnly.Annotations) != 1 {
+		t.Errorf("call site without definition line: got %d annotations, want 1", len(lineOnly.Annotations))
+	}
+	if len(other.Annotations) != 0 {
+		t.Errorf("unannotated file: got %d annotations", len(other.Annotations))
 	}
 
-	client := &Client{BaseURL: "http://test"}
-	callers := extractCallers(client, "project", resp.Results["project"], "test", false)
+	plain := FormatTree(result, false, false, "")
+	if !strings.Contains(plain, "(/proj/src/drv.c:3) [2 notes]") {
+		t.Errorf("expected note marker in output:\n%s", plain)
+	}
+	if strings.Contains(plain, "Probe can fail here.") {
+		t.Error("annotation text should only be shown with ShowAnnotations")
+	}
+
+	withNotes := FormatTreeWithOptions(result, TreeFormatOptions{ShowAnnotations: true})
+	if !strings.Contains(withNotes, "> @bob (line 3) [bug, perf]:") || !strings.Contains(withNotes, "> Probe can fail here.") {
+		t.Errorf("expected inline annotation text:\n%s", withNotes)
+	}
+}
 
-	// Sort using the same logic as in Trace
-	sort.Slice(callers, func(i, j int) bool {
-		if callers[i].FilePath != callers[j].FilePath {
-			return callers[i].FilePath < callers[j].FilePath
+func TestTraceRestrictsCallersToChosenDefinition(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("def") == "init":
+			w.Write([]byte(`{"resultCount":2,"results":{` +
+				`"/proj/kernel/os/init.c":[{"line":"void init(void)","lineNo":"10"}],` +
+				`"/proj/cmd/init/init.c":[{"line":"int init(int argc)","lineNo":"5"}]}}`))
+		case q.Get("symbol") == "init":
+			w.Write([]byte(`{"resultCount":2,"results":{` +
+				`"/proj/kernel/os/main.c":[{"line":"init();","lineNo":"3"}],` +
+				`"/proj/cmd/init/main.c":[{"line":"init(argc);","lineNo":"7"}]}}`))
+		default:
+			w.Write([]byte(`{"resultCount":0,"results":{}}`))
 		}
-		lineI, _ := strconv.Atoi(callers[i].LineNo)
-		lineJ, _ := strconv.Atoi(callers[j].LineNo)
-		return lineI < lineJ
-	})
+	}))
+	defer server.Close()
 
-	// Expected order: /project/a/file.c:5, /project/a/file.c:100, /project/b/file.c:10, /project/b/file.c:50, /project/c/file.c:1, /project/c/file.c:999
-	expectedOrder := []struct {
-		path   string
-		lineNo string
-	}{
-		{"/project/a/file.c", "5"},
-		{"/project/a/file.c", "100"},
-		{"/project/b/file.c", "10"},
-		{"/project/b/file.c", "50"},
-		{"/project/c/file.c", "1"},
-		{"/project/c/file.c", "999"},
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if len(callers) != len(expectedOrder) {
-		t.Fatalf("Expected %d callers, got %d", len(expectedOrder), len(callers))
+	if _, err := Trace(context.Background(), client, TraceOptions{Symbol: "init", Depth: 1}); err == nil {
+		t.Fatal("expected ambiguity error")
 	}
 
-	for i, caller := range callers {
-		if caller.FilePath != expectedOrder[i].path || caller.LineNo != expectedOrder[i].lineNo {
-			t.Errorf("Position %d: got %s:%s, want %s:%s",
-				i, caller.FilePath, caller.LineNo,
-				expectedOrder[i].path, expectedOrder[i].lineNo)
-		}
+	result, err := Trace(context.Background(), client, TraceOptions{Symbol: "init", Depth: 1, DefPath: "kernel/"})
+	if err != nil {
+		t.Fatalf("Trace failed: %v", err)
+	}
+	if result.Definition == nil || result.Definition.FilePath != "/proj/kernel/os/init.c" {
+		t.Errorf("unexpected definition: %+v", result.Definition)
+	}
+	if len(result.Root.Children) != 1 || result.Root.Children[0].FilePath != "/proj/kernel/os/main.c" {
+		t.Errorf("expected only the kernel caller, got %+v", result.Root.Children)
+	}
+	if result.Excluded != 1 {
+		t.Errorf("Excluded = %d, want 1", result.Excluded)
+	}
+
+	output := FormatTree(result, false, false, "")
+	if !strings.HasPrefix(output, "init (/proj/kernel/os/init.c:10)\n") {
+		t.Errorf("root should show the definition site:\n%s", output)
+	}
+	if !strings.Contains(output, "(1 direct callers of other init definitions omitted)") {
+		t.Errorf("expected omitted callers note:\n%s", output)
 	}
 }
 
-func TestParseFunctionName(t *testing.T) {
-	tests := []struct {
-		name     string
-		lines    []string
-		expected string
-	}{
-		{
-			name: "simple function",
-			lines: []string{
-				"int calculate_sum(int a, int b) {",
-				"    return a + b;",
-			},
-			expected: "calculate_sum",
-		},
-		{
-			name: "function with return type on separate line",
-			lines: []string{
-				"static void",
-				"process_data(void *ptr) {",
-				"    // processing",
-			},
-			expected: "process_data",
-		},
-		{
-			name: "function with pointer return type",
-			lines: []string{
-				"char *get_name(void) {",
-				"    return \"test\";",
-			},
-			expected: "get_name",
-		},
-		{
-			name: "function with multiple qualifiers",
-			lines: []string{
-				"static inline int compute_value(int x) {",
-				"    return x * 2;",
-			},
-			expected: "compute_value",
-		},
-		{
-			name: "function definition with opening brace on next line",
-			lines: []string{
-				"void helper_function(void)",
-				"{",
-				"    // code",
-			},
-			expected: "helper_function",
-		},
-		{
-			name: "skip if statement",
-			lines: []string{
-				"if (condition) {",
-				"    do_something();",
-			},
-			expected: "",
-		},
-		{
-			name: "skip for loop",
-			lines: []string{
-				"for (int i = 0; i < 10; i++) {",
-				"    process(i);",
-			},
-			expected: "",
-		},
-		{
-			name: "empty lines",
-			lines: []string{
-				"",
-				"",
-				"",
-			},
-			expected: "",
-		},
-		{
-			name: "comments only",
-			lines: []string{
-				"// This is a comment",
-				"/* Block comment */",
-				"* Another comment line",
-			},
-			expected: "",
-		},
+func TestFormatTreeInterrupted(t *testing.T) {
+	result := &TraceResult{
+		Root: &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{
+			{FilePath: "/proj/drv.c", LineNo: "3", Relation: "caller"},
+		}},
+		TotalNodes:  1,
+		Interrupted: true,
+	}
+	output := FormatTree(result, false, false, "")
+	if !strings.Contains(output, "(interrupted; showing the 1 nodes found so far)") {
+		t.Errorf("expected interrupted footer:\n%s", output)
 	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := parseFunctionName(tt.lines)
-			if result != tt.expected {
-				t.Errorf("got %q, want %q", result, tt.expected)
-			}
-		})
+func TestFormatTreeTimedOut(t *testing.T) {
+	result := &TraceResult{
+		Root: &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{
+			{FilePath: "/proj/drv.c", LineNo: "3", Relation: "caller"},
+		}},
+		TotalNodes: 1,
+		TimedOut:   true,
+	}
+	output := FormatTree(result, false, false, "")
+	if !strings.Contains(output, "(time budget exhausted; showing the 1 nodes found so far, use --total-timeout to extend)") {
+		t.Errorf("expected time budget footer:\n%s", output)
 	}
 }
 
-func TestIsCommonKeyword(t *testing.T) {
-	tests := []struct {
-		word     string
-		expected bool
-	}{
-		{"if", true},
-		{"for", true},
-		{"while", true},
-		{"return", true},
-		{"sizeof", true},
-		{"struct", true},
-		{"my_function", false},
-		{"calculate", false},
-		{"process_data", false},
+func TestFormatTreeMarksProjectCrossings(t *testing.T) {
+	result := &TraceResult{
+		Root: &CallNode{Symbol: "probe", FilePath: "/drivers/drv.c", LineNo: "10", Relation: "root", Children: []*CallNode{
+			{Symbol: "bus_attach", FilePath: "/drivers/bus.c", LineNo: "4", Relation: "caller", Children: []*CallNode{
+				{Symbol: "kernel_main", FilePath: "/kernel/main.c", LineNo: "7", Relation: "caller", Children: []*CallNode{
+					{Symbol: "boot", FilePath: "/kernel/boot.c", LineNo: "2", Relation: "caller"},
+				}},
+			}},
+		}},
+		TotalNodes:   3,
+		CrossProject: 2,
 	}
+	output := FormatTree(result, false, false, "")
+	if !strings.Contains(output, "[caller] kernel_main (/kernel/main.c:7) ↪ project:kernel\n") {
+		t.Errorf("expected the crossing into kernel marked:\n%s", output)
+	}
+	if strings.Count(output, "↪") != 1 {
+		t.Errorf("expected only the crossing marked:\n%s", output)
+	}
+	if !strings.Contains(output, "(2 callers in other projects left out by --same-project-only)") {
+		t.Errorf("expected the cross-project footer:\n%s", output)
+	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.word, func(t *testing.T) {
-			result := isCommonKeyword(tt.word)
-			if result != tt.expected {
-				t.Errorf("isCommonKeyword(%q) = %v, want %v", tt.word, result, tt.expected)
-			}
-		})
+func TestTraceCanceledReturnsPartialResult(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/raw/drivers/drv.c":
+			w.Write([]byte("void driver_init(void) {\n\tprobe();\n}\n"))
+		case r.URL.Query().Get("symbol") == "probe":
+			w.Write([]byte(`{"resultCount":1,"results":{"/drivers/drv.c":[{"line":"probe();","lineNo":"2"}]}}`))
+		case r.URL.Query().Get("symbol") != "":
+			// Ctrl-C while the second level is being searched
+			cancel()
+			<-r.Context().Done()
+		default:
+			w.Write([]byte(`{"resultCount":0,"results":{}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Trace(ctx, client, TraceOptions{Symbol: "probe", Depth: 3})
+	if !isInterrupted(err) {
+		t.Fatalf("expected an interruption, got %v", err)
+	}
+	if result == nil || !result.Interrupted || result.TotalNodes != 1 {
+		t.Errorf("expected the direct caller in an interrupted result, got %+v", result)
 	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+
+	"og/pkg/trace"
+)
+
+// Trace budget estimation: before a trace starts, the first page of direct
+// callers gives a rough idea of how big the call graph is, so og can warn
+// before a run that would spend minutes only to stop at --max-total.
+const (
+	// traceSearchBatch mirrors the results trace requests per node
+	traceSearchBatch = 50
+	// assumedCallerFanIn is the number of callers assumed per caller beyond
+	// the first level, which is only known once the trace runs
+	assumedCallerFanIn = 3
+	// overBudgetFactor is how far the estimate must exceed --max-total before
+	// og asks; traces slightly over the limit just stop early
+	overBudgetFactor = 2
+)
+
+// TraceEstimate is the expected size of a trace
+type TraceEstimate struct {
+	DirectCallers int // Reference lines to the root symbol (extrapolated past the first page)
+	Nodes         int // Estimated nodes a trace of Depth levels would explore
+	Depth         int
+	MaxTotal      int
+}
+
+// OverBudget reports whether the trace would obviously exceed MaxTotal
+func (e TraceEstimate) OverBudget() bool {
+	return e.Nodes > overBudgetFactor*e.MaxTotal
+}
+
+// EstimateTrace searches the first page of direct callers of opts.Symbol and
+// estimates the nodes a trace would explore
+func EstimateTrace(ctx context.Context, client *Client, opts TraceOptions) (TraceEstimate, error) {
+	resp, err := client.SearchContext(ctx, SearchOptions{
+		Symbol:     opts.Symbol,
+		Projects:   opts.ProjectsForLevel(1),
+		Type:       opts.Type,
+		MaxResults: traceSearchBatch,
+	})
+	if err != nil {
+		return TraceEstimate{}, err
+	}
+
+	// resultCount counts files; scale the lines seen by the files not fetched.
+	// Lines in excluded files are not counted, but their files are, so the
+	// share of excluded call sites carries over to the rest.
+	lines := 0
+	files := make(map[string]bool)
+	for _, r := range resp.OrderedEntries() {
+		files[projectPath(r.Project, r.FilePath())] = true
+		if !trace.Excluded(buildTraceFilePath(r.Project, r.SearchResult), opts.Exclude) {
+			lines++
+		}
+	}
+	direct := lines
+	if len(files) > 0 && resp.ResultCount > len(files) {
+		direct = lines * resp.ResultCount / len(files)
+	}
+
+	depth, maxTotal := traceLimits(opts)
+	return TraceEstimate{
+		DirectCallers: direct,
+		Nodes:         estimateTraceNodes(direct, depth),
+		Depth:         depth,
+		MaxTotal:      maxTotal,
+	}, nil
+}
+
+// traceLimits returns the depth and node limit a trace runs with
+func traceLimits(opts TraceOptions) (depth, maxTotal int) {
+	depth, maxTotal = opts.Depth, opts.MaxTotal
+	if depth <= 0 {
+		depth = trace.DefaultDepth
+	}
+	if maxTotal <= 0 {
+		maxTotal = trace.DefaultMaxTotal
+	}
+	return depth, maxTotal
+}
+
+// estimateTraceNodes estimates the nodes explored by a trace of depth levels
+// whose root has direct callers. Each node's callers come from one search
+// page, and deeper levels assume assumedCallerFanIn callers per caller.
+func estimateTraceNodes(direct, depth int) int {
+	level := min(direct, traceSearchBatch)
+	total := level
+	for d := 2; d <= depth && level > 0; d++ {
+		level *= assumedCallerFanIn
+		total += level
+		if total > 1_000_000 { // Plenty to decide; avoid overflow on silly depths
+			break
+		}
+	}
+	return total
+}
+
+// fitTraceDepth returns the deepest depth (at least 1) whose estimate stays
+// within maxTotal
+func fitTraceDepth(direct, depth, maxTotal int) int {
+	for depth > 1 && estimateTraceNodes(direct, depth) > maxTotal {
+		depth--
+	}
+	return depth
+}
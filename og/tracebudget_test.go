@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEstimateTraceNodes(t *testing.T) {
+	tests := []struct {
+		direct, depth, want int
+	}{
+		{0, 3, 0},
+		{10, 1, 10},
+		{10, 2, 40},
+		{10, 3, 130},
+		{400, 1, 50}, // One search page per node
+	}
+	for _, tt := range tests {
+		if got := estimateTraceNodes(tt.direct, tt.depth); got != tt.want {
+			t.Errorf("estimateTraceNodes(%d, %d) = %d, want %d", tt.direct, tt.depth, got, tt.want)
+		}
+	}
+}
+
+func TestFitTraceDepth(t *testing.T) {
+	if got := fitTraceDepth(10, 3, 100); got != 2 {
+		t.Errorf("fitTraceDepth(10, 3, 100) = %d, want 2", got)
+	}
+	if got := fitTraceDepth(400, 2, 10); got != 1 {
+		t.Errorf("fitTraceDepth(400, 2, 10) = %d, want 1", got)
+	}
+}
+
+func TestEstimateTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("symbol") != "kmem_alloc" || q.Get("projects") != "illumos" {
+			t.Errorf("unexpected query %v", q)
+		}
+		// 20 files fetched out of 200, two lines each
+		var hits []interface{}
+		for i := 0; i < 20; i++ {
+			for line := 1; line <= 2; line++ {
+				hits = append(hits, map[string]interface{}{"path": fmt.Sprintf("/f%d.c", i), "lineNo": line, "line": "kmem_alloc(n)"})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"resultCount": 200,
+			"results":     map[string]interface{}{"illumos": hits},
+		})
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	est, err := EstimateTrace(context.Background(), client, TraceOptions{Symbol: "kmem_alloc", Projects: "illumos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if est.DirectCallers != 400 || est.Depth != 2 || est.MaxTotal != 100 || est.Nodes != 200 {
+		t.Errorf("EstimateTrace() = %+v", est)
+	}
+	if est.OverBudget() {
+		t.Error("200 nodes against --max-total 100 should not count as over budget")
+	}
+	est.Depth = 3
+	est.Nodes = estimateTraceNodes(est.DirectCallers, est.Depth)
+	if !est.OverBudget() {
+		t.Errorf("%d nodes against --max-total 100 should be over budget", est.Nodes)
+	}
+}
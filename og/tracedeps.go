@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// cFamilyExtensions are the files where "static" makes a function local to
+// its file
+var cFamilyExtensions = map[string]bool{
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".cxx": true, ".hh": true, ".hpp": true, ".hxx": true, ".m": true, ".mm": true,
+}
+
+// privateSignatureRegex matches the keywords that hide a definition from
+// other files in Java, C#, Kotlin, Swift, Scala and TypeScript
+var privateSignatureRegex = regexp.MustCompile(`(^|\s)(private|fileprivate)\s`)
+
+// staticSignatureRegex matches a C function declared static
+var staticSignatureRegex = regexp.MustCompile(`(^|\s)static\s`)
+
+// isExportedDefinition reports whether other files can call a function
+// defined in file, judged from its signature and the language's
+// conventions: not static in C-like files, not private, capitalized in Go,
+// no leading underscore in Python
+func isExportedDefinition(def DefinitionHit) bool {
+	ext := strings.ToLower(path.Ext(def.Path))
+	switch {
+	case ext == ".go":
+		r, _ := utf8.DecodeRuneInString(def.Symbol)
+		return unicode.IsUpper(r)
+	case ext == ".py":
+		return !strings.HasPrefix(def.Symbol, "_")
+	case cFamilyExtensions[ext] && def.Kind == "function" && staticSignatureRegex.MatchString(def.Signature):
+		return false
+	}
+	return !privateSignatureRegex.MatchString(def.Signature)
+}
+
+// FileDependent is a file that calls into the file traced by
+// 'og trace --callers-of-file'
+type FileDependent struct {
+	File string `json:"file"` // "/project/path"
+	// Calls are the direct calls from this file, in line order; empty for
+	// a file that only calls the traced file's callers
+	Calls []DependentCall `json:"calls,omitempty"`
+	// Indirect counts the call sites at deeper levels: calls to a caller of
+	// the traced file
+	Indirect int `json:"indirect,omitempty"`
+}
+
+// DependentCall is one call from a dependent file to the traced file
+type DependentCall struct {
+	Caller string `json:"caller"` // Enclosing function, "" if not found
+	Line   string `json:"line"`
+	Callee string `json:"callee"` // Function of the traced file called
+}
+
+// FileDependents is the reverse-dependency report of a file
+type FileDependents struct {
+	File  string `json:"file"`
+	Depth int    `json:"depth"`
+	// Exported counts the functions traced, Local those skipped as not
+	// callable from other files
+	Exported int `json:"exported"`
+	Local    int `json:"local"`
+	// Dependents are the calling files, most direct calls first
+	Dependents []FileDependent `json:"dependents"`
+	// Uncalled lists the exported functions no other file calls
+	Uncalled []string `json:"uncalled"`
+	// Failed lists the functions whose trace failed, with the error
+	Failed     []FileFanIn `json:"failed,omitempty"`
+	MaxReached bool        `json:"maxReached,omitempty"`
+}
+
+// newFileDependents folds the traces of a file's exported functions into
+// calling files. Calls from inside the file are left out: they don't make
+// anything depend on it.
+func newFileDependents(filePath string, fanIn []FileFanIn, depth, local int) *FileDependents {
+	deps := &FileDependents{File: filePath, Depth: depth, Exported: len(fanIn), Local: local, Uncalled: []string{}}
+	byFile := make(map[string]*FileDependent)
+	dependent := func(file string) *FileDependent {
+		if byFile[file] == nil {
+			byFile[file] = &FileDependent{File: file}
+		}
+		return byFile[file]
+	}
+	var walk func(node *CallNode)
+	walk = func(node *CallNode) {
+		for _, child := range node.Children {
+			if child.FilePath != filePath && child.FilePath != "" {
+				dependent(child.FilePath).Indirect++
+			}
+			if !child.Ref {
+				walk(child)
+			}
+		}
+	}
+	for _, f := range fanIn {
+		if f.Error != "" {
+			deps.Failed = append(deps.Failed, f)
+			continue
+		}
+		deps.MaxReached = deps.MaxReached || f.MaxReached
+		if f.Outside == 0 {
+			deps.Uncalled = append(deps.Uncalled, f.Symbol)
+		}
+		if f.result == nil {
+			continue
+		}
+		for _, caller := range f.result.Root.Children {
+			if caller.FilePath != filePath && caller.FilePath != "" {
+				d := dependent(caller.FilePath)
+				d.Calls = append(d.Calls, DependentCall{Caller: caller.Symbol, Line: caller.LineNo, Callee: f.Symbol})
+			}
+			if !caller.Ref {
+				walk(caller)
+			}
+		}
+	}
+
+	for _, d := range byFile {
+		sort.SliceStable(d.Calls, func(i, j int) bool { return lineLess(d.Calls[i].Line, d.Calls[j].Line) })
+		deps.Dependents = append(deps.Dependents, *d)
+	}
+	sort.Slice(deps.Dependents, func(i, j int) bool {
+		a, b := deps.Dependents[i], deps.Dependents[j]
+		if len(a.Calls) != len(b.Calls) {
+			return len(a.Calls) > len(b.Calls)
+		}
+		return a.File < b.File
+	})
+	if deps.Dependents == nil {
+		deps.Dependents = []FileDependent{}
+	}
+	return deps
+}
+
+// lineLess orders line numbers given as strings numerically
+func lineLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// FormatFileDependents renders the report printed by
+// 'og trace --callers-of-file': each calling file with the calls it makes
+// into the traced file, then the files that only reach it through them
+func FormatFileDependents(deps *FileDependents, useColor bool) string {
+	var sb strings.Builder
+	name := strings.TrimPrefix(deps.File, "/")
+	title := fmt.Sprintf("Files calling into %s (%d exported functions", name, deps.Exported)
+	if deps.Local > 0 {
+		title += fmt.Sprintf(", %d file-local skipped", deps.Local)
+	}
+	title += fmt.Sprintf(", depth %d):", deps.Depth)
+	if useColor {
+		title = colorBold + title + colorReset
+	}
+	sb.WriteString(title + "\n")
+
+	direct := 0
+	var indirect []FileDependent
+	for _, d := range deps.Dependents {
+		if len(d.Calls) == 0 {
+			indirect = append(indirect, d)
+			continue
+		}
+		direct++
+		file := strings.TrimPrefix(d.File, "/")
+		if useColor {
+			file = colorMagenta + file + colorReset
+		}
+		functions := make(map[string]bool)
+		for _, c := range d.Calls {
+			functions[c.Callee] = true
+		}
+		fmt.Fprintf(&sb, "\n%s  (%d calls to %d functions)\n", file, len(d.Calls), len(functions))
+		width := 0
+		for _, c := range d.Calls {
+			width = max(width, len(callSite(c)))
+		}
+		for _, c := range d.Calls {
+			fmt.Fprintf(&sb, "  %-*s  -> %s\n", width, callSite(c), c.Callee)
+		}
+	}
+	if len(indirect) > 0 {
+		fmt.Fprintf(&sb, "\nIndirectly, through the callers above:\n")
+		for _, d := range indirect {
+			fmt.Fprintf(&sb, "  %s  (%d call sites)\n", strings.TrimPrefix(d.File, "/"), d.Indirect)
+		}
+	}
+	for _, f := range deps.Failed {
+		fmt.Fprintf(&sb, "\n%s: %s", f.Symbol, f.Error)
+	}
+	if len(deps.Failed) > 0 {
+		sb.WriteString("\n")
+	}
+	if len(deps.Uncalled) > 0 {
+		fmt.Fprintf(&sb, "\nNo callers in other files: %s\n", strings.Join(deps.Uncalled, ", "))
+	}
+	fmt.Fprintf(&sb, "\nDirect dependents: %d files; %d of %d exported functions have no callers outside %s.\n",
+		direct, len(deps.Uncalled), deps.Exported, path.Base(name))
+	if deps.MaxReached {
+		sb.WriteString("Some traces stopped at --max-total; raise it for a complete report.\n")
+	}
+	return sb.String()
+}
+
+// callSite labels a dependent call as "function:line"
+func callSite(c DependentCall) string {
+	caller := c.Caller
+	if caller == "" {
+		caller = "?"
+	}
+	return caller + ":" + c.Line
+}
+
+// traceFileDependents runs 'og trace --callers-of-file': it traces the
+// callers of each exported function defined in file and prints the files
+// that depend on it
+func traceFileDependents(ctx context.Context, client *Client, file string, opts TraceOptions, progress *Progress) {
+	filePath := "/" + strings.Trim(file, "/")
+	task := progress.Start("Finding functions in " + strings.TrimPrefix(filePath, "/") + "...")
+	funcs, err := fileFunctions(ctx, client, filePath)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error finding functions: %v\n", err))
+		os.Exit(1)
+	}
+	var exported []DefinitionHit
+	for _, def := range funcs {
+		if isExportedDefinition(def) {
+			exported = append(exported, def)
+		}
+	}
+	if len(exported) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: no exported function definitions found in %s (%d file-local)\n", strings.TrimPrefix(filePath, "/"), len(funcs)))
+		os.Exit(1)
+	}
+
+	task = progress.Start("Tracing callers...")
+	fanIn, err := traceFileFunctions(ctx, client, filePath, exported, opts, task)
+	task.Done()
+	deps := newFileDependents(filePath, fanIn, opts.Depth, len(funcs)-len(exported))
+	fmt.Print(FormatFileDependents(deps, colorOutput(os.Stdout)))
+	if isInterrupted(err) {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d of %d functions.\n", len(fanIn), len(exported))
+		os.Exit(exitInterrupted)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsExportedDefinition(t *testing.T) {
+	tests := []struct {
+		def  DefinitionHit
+		want bool
+	}{
+		{DefinitionHit{Symbol: "vn_rele", Path: "/src/vnode.c", Kind: "function", Signature: "void vn_rele(vnode_t *vp)"}, true},
+		{DefinitionHit{Symbol: "vn_free", Path: "/src/vnode.c", Kind: "function", Signature: "static void vn_free(vnode_t *vp)"}, false},
+		{DefinitionHit{Symbol: "count", Path: "/src/Cache.java", Kind: "method", Signature: "public static int count()"}, true},
+		{DefinitionHit{Symbol: "evict", Path: "/src/Cache.java", Kind: "method", Signature: "private void evict()"}, false},
+		{DefinitionHit{Symbol: "Open", Path: "/pkg/file.go", Kind: "function", Signature: "func Open(name string) error"}, true},
+		{DefinitionHit{Symbol: "open", Path: "/pkg/file.go", Kind: "function", Signature: "func open(name string) error"}, false},
+		{DefinitionHit{Symbol: "_parse", Path: "/lib/conf.py", Kind: "function", Signature: "def _parse(text):"}, false},
+		{DefinitionHit{Symbol: "load", Path: "/lib/conf.py", Kind: "function", Signature: "def load(path):"}, true},
+	}
+	for _, tt := range tests {
+		if got := isExportedDefinition(tt.def); got != tt.want {
+			t.Errorf("isExportedDefinition(%s %q) = %v, want %v", tt.def.Path, tt.def.Signature, got, tt.want)
+		}
+	}
+}
+
+func TestFileDependents(t *testing.T) {
+	// vn_rele() is called from fs.c twice and from vnode.c itself; fs_sync(),
+	// one of its callers, is called from sched.c. vn_hold() has no callers
+	// outside vnode.c.
+	fsSync := &CallNode{Symbol: "fs_sync", FilePath: "/proj/fs.c", LineNo: "30", Children: []*CallNode{
+		{Symbol: "sched_tick", FilePath: "/proj/sched.c", LineNo: "7"},
+	}}
+	fanIn := []FileFanIn{
+		{Symbol: "vn_hold", Callers: 1, result: &TraceResult{Root: &CallNode{Symbol: "vn_hold", Children: []*CallNode{
+			{Symbol: "vn_rele", FilePath: "/proj/vnode.c", LineNo: "8"},
+		}}}},
+		{Symbol: "vn_rele", Callers: 3, Outside: 2, result: &TraceResult{Root: &CallNode{Symbol: "vn_rele", Children: []*CallNode{
+			{Symbol: "fs_unmount", FilePath: "/proj/fs.c", LineNo: "112"},
+			fsSync,
+			{Symbol: "vn_inactive", FilePath: "/proj/vnode.c", LineNo: "50"},
+		}}}},
+		{Symbol: "vn_dump", Error: "defined 2 times"},
+	}
+
+	deps := newFileDependents("/proj/vnode.c", fanIn, 2, 1)
+	if len(deps.Dependents) != 2 {
+		t.Fatalf("dependents = %+v, want fs.c and sched.c", deps.Dependents)
+	}
+	fs, sched := deps.Dependents[0], deps.Dependents[1]
+	if fs.File != "/proj/fs.c" || len(fs.Calls) != 2 || fs.Calls[0].Line != "30" || fs.Calls[1].Caller != "fs_unmount" {
+		t.Errorf("fs.c = %+v, want its two calls in line order", fs)
+	}
+	if sched.File != "/proj/sched.c" || len(sched.Calls) != 0 || sched.Indirect != 1 {
+		t.Errorf("sched.c = %+v, want one indirect call site", sched)
+	}
+	if len(deps.Uncalled) != 1 || deps.Uncalled[0] != "vn_hold" {
+		t.Errorf("uncalled = %v, want vn_hold", deps.Uncalled)
+	}
+	if len(deps.Failed) != 1 || deps.Exported != 3 || deps.Local != 1 {
+		t.Errorf("failed = %v, exported = %d, local = %d", deps.Failed, deps.Exported, deps.Local)
+	}
+
+	output := FormatFileDependents(deps, false)
+	for _, s := range []string{
+		"Files calling into proj/vnode.c (3 exported functions, 1 file-local skipped, depth 2):",
+		"proj/fs.c  (2 calls to 1 functions)",
+		"  fs_sync:30      -> vn_rele",
+		"  fs_unmount:112  -> vn_rele",
+		"Indirectly, through the callers above:\n  proj/sched.c  (1 call sites)",
+		"vn_dump: defined 2 times",
+		"No callers in other files: vn_hold",
+		"Direct dependents: 1 files; 1 of 3 exported functions have no callers outside vnode.c.",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("output missing %q:\n%s", s, output)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fileFunctionKinds are the definition kinds 'og trace --root-from-file'
+// traces; types and macros have no callers to count
+var fileFunctionKinds = map[string]bool{"function": true, "method": true}
+
+// FileFanIn is the caller count of one function defined in a traced file
+type FileFanIn struct {
+	Symbol string `json:"symbol"`
+	Line   int    `json:"line"`
+	// Callers counts the direct call sites, Outside those of them in other
+	// files, and Total the call sites at every level traced
+	Callers    int    `json:"callers"`
+	Outside    int    `json:"outside"`
+	Total      int    `json:"total"`
+	MaxReached bool   `json:"maxReached,omitempty"`
+	Error      string `json:"error,omitempty"`
+
+	result *TraceResult // The trace counted, for --callers-of-file
+}
+
+// fileFunctions returns the functions and methods defined in a file
+// ("/project/path"), in line order. It uses a def search restricted to the
+// file's path; definitions the server matched in other files with a similar
+// path are dropped.
+func fileFunctions(ctx context.Context, client *Client, filePath string) ([]DefinitionHit, error) {
+	project, path, _ := strings.Cut(strings.TrimPrefix(filePath, "/"), "/")
+	resp, err := client.SearchContext(ctx, SearchOptions{
+		Def:        "*",
+		Path:       `"` + path + `"`,
+		Projects:   project,
+		MaxResults: 50,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var funcs []DefinitionHit
+	seen := make(map[string]bool)
+	for _, def := range newDefinitions(resp, "", client.BaseURL) {
+		if projectPath(def.Project, def.Path) != filePath || !fileFunctionKinds[def.Kind] || seen[def.Symbol] {
+			continue
+		}
+		// A function defined twice (under #ifdef, say) is traced once
+		seen[def.Symbol] = true
+		funcs = append(funcs, def)
+	}
+	sort.SliceStable(funcs, func(i, j int) bool { return funcs[i].Line < funcs[j].Line })
+	return funcs, nil
+}
+
+// traceFileFunctions traces the callers of each function in funcs, which
+// are defined in filePath, and counts them. opts supplies the depth, limits
+// and filters; its Symbol and DefPath are set per function. Errors tracing
+// one function are recorded in its entry; if ctx is canceled, the entries
+// traced so far are returned with the context's error.
+func traceFileFunctions(ctx context.Context, client *Client, filePath string, funcs []DefinitionHit, opts TraceOptions, task *ProgressTask) ([]FileFanIn, error) {
+	fanIn := make([]FileFanIn, 0, len(funcs))
+	for i, def := range funcs {
+		task.Updatef("Tracing %s (%d/%d)...", def.Symbol, i+1, len(funcs))
+		opts.Symbol = def.Symbol
+		opts.DefPath = filePath
+		result, err := Trace(ctx, client, opts)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return fanIn, ctxErr
+		}
+		entry := FileFanIn{Symbol: def.Symbol, Line: def.Line}
+		if err != nil {
+			var ambiguous *AmbiguousDefinitionError
+			if errors.As(err, &ambiguous) {
+				err = fmt.Errorf("defined %d times", len(ambiguous.Candidates))
+			}
+			entry.Error = err.Error()
+			fanIn = append(fanIn, entry)
+			continue
+		}
+		for _, caller := range result.Root.Children {
+			entry.Callers++
+			if caller.FilePath != filePath {
+				entry.Outside++
+			}
+		}
+		entry.Total = result.TotalNodes
+		entry.MaxReached = result.MaxReached
+		entry.result = result
+		fanIn = append(fanIn, entry)
+	}
+	return fanIn, nil
+}
+
+// FormatFileFanIn renders the per-function table printed by
+// 'og trace --root-from-file', ending with how many functions are never
+// called from outside the file
+func FormatFileFanIn(filePath string, fanIn []FileFanIn, depth int, useColor bool) string {
+	var sb strings.Builder
+	title := fmt.Sprintf("Callers of the %d functions in %s (depth %d):", len(fanIn), strings.TrimPrefix(filePath, "/"), depth)
+	if useColor {
+		title = colorBold + title + colorReset
+	}
+	sb.WriteString(title + "\n")
+	if len(fanIn) == 0 {
+		return sb.String()
+	}
+
+	nameWidth := len("FUNCTION")
+	for _, f := range fanIn {
+		nameWidth = max(nameWidth, len(f.Symbol))
+	}
+	sb.WriteString(fmt.Sprintf("  %6s  %-*s  %7s  %7s  %5s\n", "LINE", nameWidth, "FUNCTION", "CALLERS", "OUTSIDE", "TOTAL"))
+	unused := 0
+	for _, f := range fanIn {
+		name := fmt.Sprintf("%-*s", nameWidth, f.Symbol)
+		if useColor {
+			name = colorMagenta + name + colorReset
+		}
+		if f.Error != "" {
+			sb.WriteString(fmt.Sprintf("  %6d  %s  (%s)\n", f.Line, name, f.Error))
+			continue
+		}
+		if f.Outside == 0 {
+			unused++
+		}
+		total := fmt.Sprint(f.Total)
+		if f.MaxReached {
+			total += "+"
+		}
+		sb.WriteString(fmt.Sprintf("  %6d  %s  %7d  %7d  %5s\n", f.Line, name, f.Callers, f.Outside, total))
+	}
+	sb.WriteString(fmt.Sprintf("\n%d of %d functions have no callers outside this file.\n", unused, len(fanIn)))
+	return sb.String()
+}
+
+// traceFileRoots runs 'og trace --root-from-file': it finds the functions
+// defined in file and prints the caller counts of each
+func traceFileRoots(ctx context.Context, client *Client, file string, opts TraceOptions, progress *Progress) {
+	filePath := "/" + strings.Trim(file, "/")
+	task := progress.Start("Finding functions in " + strings.TrimPrefix(filePath, "/") + "...")
+	funcs, err := fileFunctions(ctx, client, filePath)
+	task.Done()
+	if err != nil {
+		exitIfInterrupted(os.Stderr, err)
+		fmt.Fprint(os.Stderr, trf("Error finding functions: %v\n", err))
+		os.Exit(1)
+	}
+	if len(funcs) == 0 {
+		fmt.Fprint(os.Stderr, trf("Error: no function definitions found in %s\n", strings.TrimPrefix(filePath, "/")))
+		os.Exit(1)
+	}
+
+	task = progress.Start("Tracing callers...")
+	fanIn, err := traceFileFunctions(ctx, client, filePath, funcs, opts, task)
+	task.Done()
+	fmt.Print(FormatFileFanIn(filePath, fanIn, opts.Depth, colorOutput(os.Stdout)))
+	if isInterrupted(err) {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d of %d functions.\n", len(fanIn), len(funcs))
+		os.Exit(exitInterrupted)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTraceFileFunctions(t *testing.T) {
+	// vnode.c defines vn_hold() and vn_rele(), which calls vn_hold(); only
+	// vn_rele() is called from another file
+	var pathQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/raw/proj/src/vnode.c":
+			w.Write([]byte("void\nvn_hold(vnode_t *vp)\n{\n}\nvoid\nvn_rele(vnode_t *vp)\n{\n\tvn_hold(vp);\n}\n"))
+		case q.Get("def") == "*":
+			pathQuery = q.Get("path")
+			w.Write([]byte(`{"resultCount":2,"results":{` +
+				`"/proj/src/vnode.c":[{"line":"func <b>vn_rele</b>(vp *vnode)","lineNo":"6"},` +
+				`{"line":"func <b>vn_hold</b>(vp *vnode)","lineNo":"2"},` +
+				`{"line":"type <b>vnode</b> struct","lineNo":"1"}],` +
+				`"/proj/src/vnode.c.orig":[{"line":"func <b>vn_old</b>()","lineNo":"3"}]}}`))
+		case q.Get("def") != "":
+			w.Write([]byte(`{"resultCount":1,"results":{"/proj/src/vnode.c":[{"line":"` + q.Get("def") + `(vnode_t *vp)","lineNo":"2"}]}}`))
+		case q.Get("symbol") == "vn_hold":
+			w.Write([]byte(`{"resultCount":1,"results":{"/proj/src/vnode.c":[{"line":"\tvn_hold(vp);","lineNo":"8"}]}}`))
+		case q.Get("symbol") == "vn_rele":
+			w.Write([]byte(`{"resultCount":2,"results":{` +
+				`"/proj/src/fs.c":[{"line":"\tvn_rele(vp);","lineNo":"12"}],` +
+				`"/proj/src/io.c":[{"line":"\tvn_rele(vp);","lineNo":"40"}]}}`))
+		default:
+			w.Write([]byte(`{"resultCount":0,"results":{}}`))
+		}
+	}))
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	funcs, err := fileFunctions(ctx, client, "/proj/src/vnode.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pathQuery != `"src/vnode.c"` {
+		t.Errorf("path query = %q", pathQuery)
+	}
+	if len(funcs) != 2 || funcs[0].Symbol != "vn_hold" || funcs[1].Symbol != "vn_rele" {
+		t.Fatalf("functions = %+v, want vn_hold and vn_rele in line order", funcs)
+	}
+
+	fanIn, err := traceFileFunctions(ctx, client, "/proj/src/vnode.c", funcs, TraceOptions{Depth: 1}, newProgress(true).Start(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range fanIn {
+		if fanIn[i].result == nil {
+			t.Errorf("%s: trace not kept", fanIn[i].Symbol)
+		}
+		fanIn[i].result = nil
+	}
+	want := []FileFanIn{
+		{Symbol: "vn_hold", Line: 2, Callers: 1, Outside: 0, Total: 1},
+		{Symbol: "vn_rele", Line: 6, Callers: 2, Outside: 2, Total: 2},
+	}
+	if len(fanIn) != len(want) || fanIn[0] != want[0] || fanIn[1] != want[1] {
+		t.Errorf("fan-in = %+v, want %+v", fanIn, want)
+	}
+
+	output := FormatFileFanIn("/proj/src/vnode.c", fanIn, 1, false)
+	for _, s := range []string{
+		"Callers of the 2 functions in proj/src/vnode.c (depth 1):",
+		"       2  vn_hold         1        0      1",
+		"1 of 2 functions have no callers outside this file.",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("output missing %q:\n%s", s, output)
+		}
+	}
+}
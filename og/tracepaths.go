@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// minPathWidth is the narrowest a path is shortened to, however deep the tree
+const minPathWidth = 16
+
+// tracePaths shortens the file paths shown in a trace tree
+type tracePaths struct {
+	prefix   string // Directory prefix removed from every path that has it
+	maxWidth int    // Line width to fit paths into (0 for no limit)
+}
+
+// newTracePaths resolves the prefix to strip for a trace: opts.RelativeTo if
+// set, otherwise the directory shared by all nodes when
+// opts.StripCommonPrefix is set
+func newTracePaths(result *TraceResult, opts TreeFormatOptions) *tracePaths {
+	p := &tracePaths{maxWidth: opts.MaxWidth}
+	switch {
+	case opts.RelativeTo != "":
+		p.prefix = "/" + strings.Trim(opts.RelativeTo, "/") + "/"
+	case opts.StripCommonPrefix:
+		p.prefix = commonDirPrefix(result.Root)
+	}
+	return p
+}
+
+// commonDirPrefix returns the longest directory prefix ("/proj/usr/src/")
+// shared by the file paths of root and its descendants, or "" if they share
+// none beyond the root directory
+func commonDirPrefix(root *CallNode) string {
+	var prefix string
+	first := true
+	var walk func(node *CallNode)
+	walk = func(node *CallNode) {
+		if node.FilePath != "" {
+			dir := node.FilePath[:strings.LastIndex(node.FilePath, "/")+1]
+			if first {
+				prefix, first = dir, false
+			} else {
+				for !strings.HasPrefix(dir, prefix) {
+					prefix = prefix[:strings.LastIndex(strings.TrimSuffix(prefix, "/"), "/")+1]
+				}
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	if prefix == "/" {
+		return ""
+	}
+	return prefix
+}
+
+// display returns filePath as shown in the tree: without the prefix, and cut
+// down with a middle ellipsis if the line would otherwise exceed the width.
+// used is the number of columns the rest of the line takes.
+func (p *tracePaths) display(filePath string, used int) string {
+	if p.prefix != "" && strings.HasPrefix(filePath, p.prefix) {
+		filePath = strings.TrimPrefix(filePath, p.prefix)
+	}
+	if p.maxWidth <= 0 {
+		return filePath
+	}
+	return ellipsizeMiddle(filePath, max(p.maxWidth-used, minPathWidth))
+}
+
+// ellipsizeMiddle shortens s to width runes by replacing its middle with
+// "…", keeping more of the end, where the file name is
+func ellipsizeMiddle(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	keep := width - 1
+	head := keep / 3
+	tail := keep - head
+	return string(runes[:head]) + "…" + string(runes[len(runes)-tail:])
+}
+
+// displayWidth returns the number of terminal columns s takes, assuming one
+// column per rune
+func displayWidth(s string) int {
+	return utf8.RuneCountInString(s)
+}
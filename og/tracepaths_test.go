@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func sampleDeepTrace() *TraceResult {
+	return &TraceResult{
+		Root: &CallNode{
+			Symbol:   "mutex_enter",
+			FilePath: "/illumos-gate/usr/src/uts/common/os/mutex.c",
+			LineNo:   "120",
+			Relation: "root",
+			Children: []*CallNode{
+				{
+					Symbol:   "zfs_vnop_read",
+					FilePath: "/illumos-gate/usr/src/uts/common/fs/zfs/zfs_vnops.c",
+					LineNo:   "512",
+					Relation: "caller",
+					Children: []*CallNode{
+						{Symbol: "fop_read", FilePath: "/illumos-gate/usr/src/uts/common/fs/vnode.c", LineNo: "4001", Relation: "caller"},
+					},
+				},
+			},
+		},
+		TotalNodes: 2,
+	}
+}
+
+func TestCommonDirPrefix(t *testing.T) {
+	if got := commonDirPrefix(sampleDeepTrace().Root); got != "/illumos-gate/usr/src/uts/common/" {
+		t.Errorf("commonDirPrefix() = %q", got)
+	}
+
+	other := &CallNode{FilePath: "/a/x.c", Children: []*CallNode{{FilePath: "/b/y.c"}}}
+	if got := commonDirPrefix(other); got != "" {
+		t.Errorf("commonDirPrefix() across projects = %q, want empty", got)
+	}
+}
+
+func TestEllipsizeMiddle(t *testing.T) {
+	if got := ellipsizeMiddle("short.c", 20); got != "short.c" {
+		t.Errorf("ellipsizeMiddle() changed a short path: %q", got)
+	}
+	got := ellipsizeMiddle("usr/src/uts/common/fs/zfs/zfs_vnops.c", 20)
+	if utf8.RuneCountInString(got) != 20 || !strings.Contains(got, "…") || !strings.HasSuffix(got, "zfs_vnops.c") {
+		t.Errorf("ellipsizeMiddle() = %q", got)
+	}
+}
+
+func TestFormatTreeStripsCommonPrefix(t *testing.T) {
+	out := FormatTreeWithOptions(sampleDeepTrace(), TreeFormatOptions{StripCommonPrefix: true})
+	if !strings.Contains(out, "mutex_enter (os/mutex.c:120)") || !strings.Contains(out, "fop_read (fs/vnode.c:4001)") {
+		t.Errorf("expected relative paths:\n%s", out)
+	}
+	if !strings.Contains(out, "(paths relative to /illumos-gate/usr/src/uts/common/)") {
+		t.Errorf("expected prefix note:\n%s", out)
+	}
+}
+
+func TestFormatTreeRelativeTo(t *testing.T) {
+	out := FormatTreeWithOptions(sampleDeepTrace(), TreeFormatOptions{RelativeTo: "illumos-gate/usr/src/", WebLinks: true, ServerURL: "http://og"})
+	if !strings.Contains(out, "uts/common/fs/vnode.c:4001)") || strings.Contains(out, "(/illumos-gate/usr/src/uts") {
+		t.Errorf("expected paths relative to usr/src:\n%s", out)
+	}
+	// Links keep the full path
+	if !strings.Contains(out, "http://og/xref/illumos-gate/usr/src/uts/common/fs/vnode.c#4001") {
+		t.Errorf("expected full path in link:\n%s", out)
+	}
+}
+
+func TestFormatTreeMaxWidth(t *testing.T) {
+	const width = 50
+	out := FormatTreeWithOptions(sampleDeepTrace(), TreeFormatOptions{MaxWidth: width})
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if n := utf8.RuneCountInString(line); n > width {
+			t.Errorf("line is %d columns, want at most %d: %q", n, width, line)
+		}
+	}
+	if !strings.Contains(out, "vnode.c:4001)") {
+		t.Errorf("file name should survive shortening:\n%s", out)
+	}
+
+	// Without a width limit paths are untouched
+	if full := FormatTree(sampleDeepTrace(), false, false, ""); !strings.Contains(full, "(/illumos-gate/usr/src/uts/common/fs/zfs/zfs_vnops.c:512)") {
+		t.Errorf("expected full paths:\n%s", full)
+	}
+}
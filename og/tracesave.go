@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"og/pkg/trace"
+)
+
+// savedTraceVersion is the format version written by 'og trace --save'
+const savedTraceVersion = 1
+
+// traceRenderFormats are the --format values of 'og trace render'
+var traceRenderFormats = []string{"tree", "dot", "mermaid"}
+
+// SavedTrace is a trace written with --save, for re-rendering with
+// 'og trace render' without querying the server again
+type SavedTrace struct {
+	Version int    `json:"version"`
+	Server  string `json:"server"`
+	Symbol  string `json:"symbol"`
+	Depth   int    `json:"depth"`
+	Saved   string `json:"saved"` // RFC 3339 timestamp
+	// Result is saved before annotations are attached, so rendering picks
+	// up the notes current at the time
+	Result *TraceResult `json:"result"`
+}
+
+// saveTrace writes a trace result to path as indented JSON
+func saveTrace(path, serverURL string, opts TraceOptions, result *TraceResult) error {
+	data, err := json.MarshalIndent(SavedTrace{
+		Version: savedTraceVersion,
+		Server:  serverURL,
+		Symbol:  opts.Symbol,
+		Depth:   opts.Depth,
+		Saved:   time.Now().UTC().Format(time.RFC3339),
+		Result:  result,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// loadTrace reads a file written by saveTrace
+func loadTrace(path string) (*SavedTrace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var saved SavedTrace
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("%s: not a saved trace: %w", path, err)
+	}
+	if saved.Version != savedTraceVersion {
+		return nil, fmt.Errorf("%s: unsupported saved trace version %d", path, saved.Version)
+	}
+	if saved.Result == nil || saved.Result.Root == nil {
+		return nil, fmt.Errorf("%s: saved trace has no call tree", path)
+	}
+	return &saved, nil
+}
+
+// pruneTrace returns a copy of result keeping the callers within depth
+// levels of the root (0 for all) whose call sites don't match excludes.
+// TotalNodes and Refs are recounted; MaxReached and TimedOut are kept, as
+// the saved trace is as incomplete as it was.
+func pruneTrace(result *TraceResult, depth int, excludes []string) *TraceResult {
+	out := *result
+	out.TotalNodes, out.Refs = 0, 0
+	var copyNode func(node *CallNode, level int) *CallNode
+	copyNode = func(node *CallNode, level int) *CallNode {
+		n := *node
+		n.Children = nil
+		if depth > 0 && level >= depth {
+			return &n
+		}
+		for _, child := range node.Children {
+			if trace.Excluded(child.FilePath, excludes) {
+				continue
+			}
+			if child.Ref {
+				out.Refs++
+			} else {
+				out.TotalNodes++
+			}
+			n.Children = append(n.Children, copyNode(child, level+1))
+		}
+		return &n
+	}
+	out.Root = copyNode(result.Root, 0)
+	return &out
+}
+
+// traceGraph is a trace as a graph of functions: one vertex per function
+// (call sites in no known function get one each) and an edge from each
+// caller to the function it calls
+type traceGraph struct {
+	vertices []traceVertex
+	edges    []traceEdge
+}
+
+type traceVertex struct {
+	label    string // Function name
+	location string // Where the function is first seen, "" for the root
+}
+
+type traceEdge struct {
+	from, to int    // Vertex indexes: caller, callee
+	line     string // Line of the call site
+}
+
+// newTraceGraph folds a call tree into a graph. Ref nodes become edges to
+// the function's existing vertex, so cycles show as cycles.
+func newTraceGraph(result *TraceResult) *traceGraph {
+	g := &traceGraph{}
+	ids := make(map[string]int)
+	vertex := func(node *CallNode, key string) int {
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		ids[key] = len(g.vertices)
+		label := node.Symbol
+		if label == "" {
+			label = "?"
+		}
+		v := traceVertex{label: label}
+		if node.FilePath != "" {
+			v.location = strings.TrimPrefix(node.FilePath, "/")
+		}
+		g.vertices = append(g.vertices, v)
+		return ids[key]
+	}
+	var walk func(node *CallNode, id int)
+	walk = func(node *CallNode, id int) {
+		for _, child := range node.Children {
+			key := child.Symbol
+			if key == "" {
+				key = child.FilePath + ":" + child.LineNo
+			}
+			childID := vertex(child, key)
+			g.edges = append(g.edges, traceEdge{from: childID, to: id, line: child.LineNo})
+			if !child.Ref {
+				walk(child, childID)
+			}
+		}
+	}
+	root := result.Root
+	walk(root, vertex(&CallNode{Symbol: root.Symbol}, root.Symbol))
+	return g
+}
+
+// FormatTraceDot renders a trace as a Graphviz digraph, callers pointing at
+// the functions they call
+func FormatTraceDot(result *TraceResult) string {
+	g := newTraceGraph(result)
+	var sb strings.Builder
+	sb.WriteString("digraph trace {\n")
+	sb.WriteString("  rankdir=RL;\n")
+	sb.WriteString("  node [shape=box, fontname=\"monospace\"];\n")
+	for i, v := range g.vertices {
+		label := v.label
+		if v.location != "" {
+			label += "\n" + path.Base(v.location)
+		}
+		attrs := "label=" + strconv.Quote(label)
+		if v.location != "" {
+			attrs += ", tooltip=" + strconv.Quote(v.location)
+		}
+		if i == 0 {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(&sb, "  n%d [%s];\n", i, attrs)
+	}
+	for _, e := range g.edges {
+		if e.line != "" {
+			fmt.Fprintf(&sb, "  n%d -> n%d [label=%s];\n", e.from, e.to, strconv.Quote(e.line))
+		} else {
+			fmt.Fprintf(&sb, "  n%d -> n%d;\n", e.from, e.to)
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// FormatTraceMermaid renders a trace as a Mermaid flowchart, callers
+// pointing at the functions they call
+func FormatTraceMermaid(result *TraceResult) string {
+	g := newTraceGraph(result)
+	var sb strings.Builder
+	sb.WriteString("flowchart RL\n")
+	for i, v := range g.vertices {
+		label := mermaidText(v.label)
+		if v.location != "" {
+			label += "<br/><small>" + mermaidText(path.Base(v.location)) + "</small>"
+		}
+		fmt.Fprintf(&sb, "  n%d[\"%s\"]\n", i, label)
+	}
+	for _, e := range g.edges {
+		if e.line != "" {
+			fmt.Fprintf(&sb, "  n%d -->|%s| n%d\n", e.from, mermaidText(e.line), e.to)
+		} else {
+			fmt.Fprintf(&sb, "  n%d --> n%d\n", e.from, e.to)
+		}
+	}
+	return sb.String()
+}
+
+// mermaidText escapes text for a quoted Mermaid label. Quotes and markup
+// characters become entity codes, which Mermaid renders as the characters.
+func mermaidText(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;", "|", "#124;").Replace(s)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// savedTraceResult is a two-level trace in which dispatch calls both
+// readers and read_b is also reached through a reference
+func savedTraceResult() *TraceResult {
+	return &TraceResult{
+		Root: &CallNode{Symbol: "probe", Relation: "root", Children: []*CallNode{
+			{Symbol: "read_a", FilePath: "/p/src/a.c", LineNo: "12", Relation: "caller", Children: []*CallNode{
+				{Symbol: "dispatch", FilePath: "/p/src/main.c", LineNo: "40", Relation: "caller"},
+			}},
+			{Symbol: "read_b", FilePath: "/p/test/b.c", LineNo: "7", Relation: "caller", Children: []*CallNode{
+				{Symbol: "dispatch", FilePath: "/p/src/main.c", LineNo: "41", Relation: "caller", Ref: true},
+			}},
+		}},
+		TotalNodes: 3,
+		Refs:       1,
+	}
+}
+
+func TestSaveAndLoadTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	if err := saveTrace(path, "http://og", TraceOptions{Symbol: "probe", Depth: 2}, savedTraceResult()); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := loadTrace(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Server != "http://og" || saved.Symbol != "probe" || saved.Depth != 2 || saved.Result.TotalNodes != 3 {
+		t.Errorf("saved = %+v", saved)
+	}
+	if want, got := FormatTree(savedTraceResult(), false, false, ""), FormatTree(saved.Result, false, false, ""); got != want {
+		t.Errorf("reloaded tree =\n%s\nwant:\n%s", got, want)
+	}
+
+	for _, data := range []string{`{"version": 2, "result": {"root": {}}}`, `{"version": 1}`, `[1, 2]`} {
+		os.WriteFile(path, []byte(data), 0644)
+		if _, err := loadTrace(path); err == nil {
+			t.Errorf("loadTrace(%s) succeeded", data)
+		}
+	}
+}
+
+func TestPruneTrace(t *testing.T) {
+	result := savedTraceResult()
+	shallow := pruneTrace(result, 1, nil)
+	if len(shallow.Root.Children) != 2 || len(shallow.Root.Children[0].Children) != 0 || shallow.TotalNodes != 2 || shallow.Refs != 0 {
+		t.Errorf("depth 1: %+v", shallow)
+	}
+	noTests := pruneTrace(result, 0, []string{"/test/"})
+	if len(noTests.Root.Children) != 1 || noTests.TotalNodes != 2 || noTests.Refs != 0 {
+		t.Errorf("excluding /test/: %+v", noTests)
+	}
+	// The saved result is untouched
+	if len(result.Root.Children[0].Children) != 1 || result.TotalNodes != 3 {
+		t.Errorf("pruneTrace modified its input")
+	}
+}
+
+func TestFormatTraceGraphs(t *testing.T) {
+	dot := FormatTraceDot(savedTraceResult())
+	for _, want := range []string{
+		"digraph trace {\n",
+		"  n0 [label=\"probe\", style=bold];\n",
+		"  n1 [label=\"read_a\\na.c\", tooltip=\"p/src/a.c\"];\n",
+		"  n1 -> n0 [label=\"12\"];\n",
+		"  n2 -> n1 [label=\"40\"];\n",
+		// The reference is another edge into dispatch's one box
+		"  n2 -> n3 [label=\"41\"];\n",
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("dot output missing %q:\n%s", want, dot)
+		}
+	}
+	if strings.Count(dot, "label=\"dispatch") != 1 {
+		t.Errorf("dispatch drawn more than once:\n%s", dot)
+	}
+
+	mermaid := FormatTraceMermaid(savedTraceResult())
+	for _, want := range []string{
+		"flowchart RL\n",
+		"  n0[\"probe\"]\n",
+		"  n3[\"read_b<br/><small>b.c</small>\"]\n",
+		"  n2 -->|41| n3\n",
+	} {
+		if !strings.Contains(mermaid, want) {
+			t.Errorf("mermaid output missing %q:\n%s", want, mermaid)
+		}
+	}
+	if got := mermaidText(`a"<b>|c`); got != "a#quot;#lt;b#gt;#124;c" {
+		t.Errorf("mermaidText() = %q", got)
+	}
+}
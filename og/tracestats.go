@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// traceStatsTop is the number of entries listed in each summary ranking
+const traceStatsTop = 5
+
+// RankedCount is a name with a count, as listed in a trace summary
+type RankedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TraceStats summarizes the shape of a call tree
+type TraceStats struct {
+	// Levels holds the number of callers found at each depth; Levels[0] is
+	// the direct callers of the traced symbol
+	Levels []int `json:"levels"`
+	// TopFanIn lists the functions with the most distinct callers
+	TopFanIn []RankedCount `json:"topFanIn"`
+	// TopFiles lists the files containing the most call sites
+	TopFiles []RankedCount `json:"topFiles"`
+}
+
+// ComputeTraceStats walks a trace result and counts callers per level, fan-in
+// per function and call sites per file
+func ComputeTraceStats(result *TraceResult) TraceStats {
+	var stats TraceStats
+	callers := make(map[string]map[string]bool) // function -> distinct call sites
+	files := make(map[string]int)
+
+	var walk func(node *CallNode, depth int)
+	walk = func(node *CallNode, depth int) {
+		if len(node.Children) > 0 && node.Symbol != "" {
+			if callers[node.Symbol] == nil {
+				callers[node.Symbol] = make(map[string]bool)
+			}
+			for _, child := range node.Children {
+				callers[node.Symbol][child.FilePath+":"+child.LineNo] = true
+			}
+		}
+		for _, child := range node.Children {
+			if len(stats.Levels) <= depth {
+				stats.Levels = append(stats.Levels, 0)
+			}
+			stats.Levels[depth]++
+			if child.FilePath != "" {
+				files[child.FilePath]++
+			}
+			walk(child, depth+1)
+		}
+	}
+	if result.Root != nil {
+		walk(result.Root, 0)
+	}
+
+	fanIn := make(map[string]int, len(callers))
+	for symbol, sites := range callers {
+		fanIn[symbol] = len(sites)
+	}
+	stats.TopFanIn = topCounts(fanIn, traceStatsTop)
+	stats.TopFiles = topCounts(files, traceStatsTop)
+	return stats
+}
+
+// topCounts returns the n largest counts, ties broken by name
+func topCounts(counts map[string]int, n int) []RankedCount {
+	ranked := make([]RankedCount, 0, len(counts))
+	for name, count := range counts {
+		ranked = append(ranked, RankedCount{Name: name, Count: count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// FormatTraceStats renders the summary section printed by 'og trace --summary'
+func FormatTraceStats(stats TraceStats, useColor bool) string {
+	var sb strings.Builder
+	heading := func(title string) {
+		if useColor {
+			title = colorBold + title + colorReset
+		}
+		sb.WriteString(title + "\n")
+	}
+
+	heading("Callers per level:")
+	if len(stats.Levels) == 0 {
+		sb.WriteString("  (none)\n")
+	}
+	for i, n := range stats.Levels {
+		sb.WriteString(fmt.Sprintf("  %d: %d\n", i+1, n))
+	}
+
+	writeRanking := func(title string, ranked []RankedCount, unit string) {
+		if len(ranked) == 0 {
+			return
+		}
+		heading(title)
+		width := 0
+		for _, r := range ranked {
+			width = max(width, len(r.Name))
+		}
+		for _, r := range ranked {
+			name := fmt.Sprintf("%-*s", width, r.Name)
+			if useColor {
+				name = colorMagenta + name + colorReset
+			}
+			label := unit
+			if r.Count != 1 {
+				label += "s"
+			}
+			sb.WriteString(fmt.Sprintf("  %s  %d %s\n", name, r.Count, label))
+		}
+	}
+	writeRanking("Top fan-in:", stats.TopFanIn, "caller")
+	writeRanking("Top files:", stats.TopFiles, "call site")
+	return sb.String()
+}
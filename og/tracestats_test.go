@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newStatsTestTrace() *TraceResult {
+	// malloc <- alloc_buf (a.c, b.c), xalloc (a.c); alloc_buf <- init (c.c), load (a.c)
+	return &TraceResult{
+		Root: &CallNode{
+			Symbol: "malloc",
+			Children: []*CallNode{
+				{Symbol: "alloc_buf", FilePath: "/proj/a.c", LineNo: "10", Relation: "caller", Children: []*CallNode{
+					{Symbol: "init", FilePath: "/proj/c.c", LineNo: "3", Relation: "caller"},
+					{Symbol: "load", FilePath: "/proj/a.c", LineNo: "40", Relation: "caller"},
+				}},
+				{Symbol: "alloc_buf", FilePath: "/proj/b.c", LineNo: "7", Relation: "caller", Children: []*CallNode{
+					{Symbol: "init", FilePath: "/proj/c.c", LineNo: "3", Relation: "caller"},
+				}},
+				{Symbol: "xalloc", FilePath: "/proj/a.c", LineNo: "22", Relation: "caller"},
+			},
+		},
+		TotalNodes: 6,
+	}
+}
+
+func TestComputeTraceStats(t *testing.T) {
+	stats := ComputeTraceStats(newStatsTestTrace())
+
+	if !reflect.DeepEqual(stats.Levels, []int{3, 3}) {
+		t.Errorf("Levels = %v, want [3 3]", stats.Levels)
+	}
+	// alloc_buf appears twice but its repeated call site (c.c:3) counts once
+	wantFanIn := []RankedCount{{"malloc", 3}, {"alloc_buf", 2}}
+	if !reflect.DeepEqual(stats.TopFanIn, wantFanIn) {
+		t.Errorf("TopFanIn = %v, want %v", stats.TopFanIn, wantFanIn)
+	}
+	wantFiles := []RankedCount{{"/proj/a.c", 3}, {"/proj/c.c", 2}, {"/proj/b.c", 1}}
+	if !reflect.DeepEqual(stats.TopFiles, wantFiles) {
+		t.Errorf("TopFiles = %v, want %v", stats.TopFiles, wantFiles)
+	}
+}
+
+func TestTopCountsLimit(t *testing.T) {
+	counts := map[string]int{"a": 1, "b": 5, "c": 5, "d": 2, "e": 9, "f": 3, "g": 4}
+	got := topCounts(counts, 3)
+	want := []RankedCount{{"e", 9}, {"b", 5}, {"c", 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topCounts = %v, want %v", got, want)
+	}
+}
+
+func TestFormatTraceStats(t *testing.T) {
+	out := FormatTraceStats(ComputeTraceStats(newStatsTestTrace()), false)
+
+	for _, want := range []string{
+		"Callers per level:\n  1: 3\n  2: 3\n",
+		"Top fan-in:\n  malloc     3 callers\n  alloc_buf  2 callers\n",
+		"Top files:\n  /proj/a.c  3 call sites\n  /proj/c.c  2 call sites\n  /proj/b.c  1 call site\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestFormatTraceStatsEmpty(t *testing.T) {
+	out := FormatTraceStats(ComputeTraceStats(&TraceResult{Root: &CallNode{Symbol: "orphan"}}), false)
+	if out != "Callers per level:\n  (none)\n" {
+		t.Errorf("output = %q", out)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// traceFormats are the --format values of 'og trace'
+var traceFormats = []string{"tree", "ndjson"}
+
+// traceStreamNode is the line 'og trace --format ndjson' writes as each
+// node is found. Nodes are numbered in the order found, from 1 for the
+// root; Parent is the id of the node this one calls (0 for the root), so
+// consumers can grow the graph without waiting for the trace to end. The
+// node's own fields (symbol, filePath, lineNo, ...) are inlined, without
+// children.
+type traceStreamNode struct {
+	Type   string `json:"type"` // "node"
+	ID     int    `json:"id"`
+	Parent int    `json:"parent,omitempty"`
+	Level  int    `json:"level"`
+	*CallNode
+}
+
+// traceStreamDone is the last line of 'og trace --format ndjson', with the
+// totals of the trace and the error that ended it, if any
+type traceStreamDone struct {
+	Type         string `json:"type"` // "done"
+	TotalNodes   int    `json:"totalNodes"`
+	Refs         int    `json:"refs,omitempty"`
+	Skipped      int    `json:"skipped,omitempty"`
+	Excluded     int    `json:"excluded,omitempty"`
+	CrossProject int    `json:"crossProject,omitempty"`
+	MaxReached   bool   `json:"maxReached,omitempty"`
+	TimedOut     bool   `json:"timedOut,omitempty"`
+	Interrupted  bool   `json:"interrupted,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// traceStream writes a trace as newline-delimited JSON while it runs: its
+// node method is set as TraceOptions.OnNode, and done ends the stream
+type traceStream struct {
+	enc *json.Encoder
+	ids map[*CallNode]int
+}
+
+func newTraceStream(w io.Writer) *traceStream {
+	return &traceStream{enc: json.NewEncoder(w), ids: make(map[*CallNode]int)}
+}
+
+// node writes one line for a node just added to the graph. Nodes are
+// written before their callers are searched, so Children is always empty.
+func (s *traceStream) node(node, parent *CallNode, level int) {
+	id := len(s.ids) + 1
+	s.ids[node] = id
+	// A write error (say, the consumer went away) is left for the final
+	// output to run into; the trace itself carries on
+	s.enc.Encode(traceStreamNode{Type: "node", ID: id, Parent: s.ids[parent], Level: level, CallNode: node})
+}
+
+// done writes the closing line for result, which is nil if the trace
+// failed before finding any node, and the error Trace returned with it
+func (s *traceStream) done(result *TraceResult, err error) error {
+	line := traceStreamDone{Type: "done"}
+	if result != nil {
+		line.TotalNodes = result.TotalNodes
+		line.Refs = result.Refs
+		line.Skipped = result.Skipped
+		line.Excluded = result.Excluded
+		line.CrossProject = result.CrossProject
+		line.MaxReached = result.MaxReached
+		line.TimedOut = result.TimedOut
+		line.Interrupted = result.Interrupted
+	}
+	switch {
+	case isInterrupted(err):
+		line.Interrupted = true
+	case err != nil:
+		line.Error = err.Error()
+	}
+	return s.enc.Encode(line)
+}
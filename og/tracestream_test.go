@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTraceStream(t *testing.T) {
+	var buf bytes.Buffer
+	stream := newTraceStream(&buf)
+	root := &CallNode{Symbol: "probe", FilePath: "/proj/drv.c", LineNo: "10", Relation: "root"}
+	caller := &CallNode{Symbol: "driver_init", FilePath: "/proj/init.c", LineNo: "3", Relation: "caller"}
+	ref := &CallNode{Symbol: "probe", FilePath: "/proj/init.c", LineNo: "9", Relation: "caller", Ref: true}
+	stream.node(root, nil, 0)
+	stream.node(caller, root, 1)
+	stream.node(ref, caller, 2)
+	// Children added later are not written again
+	root.Children = []*CallNode{caller}
+	if err := stream.done(&TraceResult{Root: root, TotalNodes: 2, Refs: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []string{
+		`{"type":"node","id":1,"level":0,"symbol":"probe","filePath":"/proj/drv.c","lineNo":"10","relation":"root"}`,
+		`{"type":"node","id":2,"parent":1,"level":1,"symbol":"driver_init","filePath":"/proj/init.c","lineNo":"3","relation":"caller"}`,
+		`{"type":"node","id":3,"parent":2,"level":2,"symbol":"probe","filePath":"/proj/init.c","lineNo":"9","relation":"caller","ref":true}`,
+		`{"type":"done","totalNodes":2,"refs":1}`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("stream =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestTraceStreamDoneErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want traceStreamDone
+	}{
+		{errors.New("search failed"), traceStreamDone{Type: "done", Error: "search failed"}},
+		{context.Canceled, traceStreamDone{Type: "done", Interrupted: true}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		newTraceStream(&buf).done(nil, tt.err)
+		var got traceStreamDone
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("done(%v) = %+v, want %+v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watchlistFileName is the watchlist file in the user's home directory
+const watchlistFileName = ".og_watchlist.json"
+
+// watchMaxTotal is the default --max-total of 'og watchlist run'
+const watchMaxTotal = 500
+
+// Watchlist is the symbols 'og watchlist run' traces, with the callers each
+// had at the last run
+type Watchlist struct {
+	Symbols []WatchedSymbol `json:"symbols"`
+}
+
+// WatchedSymbol is one symbol in the watchlist
+type WatchedSymbol struct {
+	Symbol string `json:"symbol"`
+	// Projects is the --projects list as given to 'og watchlist add';
+	// groups and patterns are expanded at each run
+	Projects string    `json:"projects,omitempty"`
+	DefPath  string    `json:"defPath,omitempty"`
+	Added    time.Time `json:"added"`
+	// Snapshot is nil until the first run
+	Snapshot *WatchSnapshot `json:"snapshot,omitempty"`
+}
+
+// WatchSnapshot is the direct callers of a watched symbol at one run
+type WatchSnapshot struct {
+	Server  string          `json:"server"`
+	Taken   time.Time       `json:"taken"`
+	Callers []WatchedCaller `json:"callers"`
+}
+
+// WatchedCaller is one direct caller in a snapshot
+type WatchedCaller struct {
+	Symbol   string `json:"symbol"`
+	FilePath string `json:"filePath"`
+	Line     int    `json:"line,omitempty"`
+}
+
+// key identifies a caller across runs: the calling function and its file,
+// so a caller whose lines moved is not new. Call sites outside a known
+// function fall back to their line.
+func (c WatchedCaller) key() string {
+	if c.Symbol == "" {
+		return c.FilePath + ":" + strconv.Itoa(c.Line)
+	}
+	return c.FilePath + "\x00" + c.Symbol
+}
+
+// WatchReport is the outcome of one symbol in 'og watchlist run'
+type WatchReport struct {
+	Symbol string
+	// First is true when there was no snapshot to compare with (or it was
+	// taken on another server); New and Gone are empty then
+	First bool
+	// Since is when the previous snapshot was taken
+	Since time.Time
+	New   []WatchedCaller
+	Gone  []WatchedCaller
+	// Total counts the callers in the new snapshot
+	Total int
+	// Partial is true if the trace stopped at --max-total. Callers not
+	// found are kept from the previous snapshot and none are reported gone.
+	Partial bool
+	Err     error
+}
+
+// getWatchlistPathDefault returns the path to the watchlist in the user's
+// home directory
+func getWatchlistPathDefault() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, watchlistFileName), nil
+}
+
+// getWatchlistPath is a variable that can be overridden in tests
+var getWatchlistPath = getWatchlistPathDefault
+
+// loadWatchlist reads the watchlist; a missing file is an empty watchlist
+func loadWatchlist() (*Watchlist, error) {
+	path, err := getWatchlistPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Watchlist{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list Watchlist
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%s: not a watchlist file: %w", path, err)
+	}
+	return &list, nil
+}
+
+// saveWatchlist writes the watchlist
+func saveWatchlist(list *Watchlist) error {
+	path, err := getWatchlistPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// find returns the index of the entry for symbol and defPath, or -1
+func (l *Watchlist) find(symbol, defPath string) int {
+	for i, w := range l.Symbols {
+		if w.Symbol == symbol && w.DefPath == defPath {
+			return i
+		}
+	}
+	return -1
+}
+
+// add appends a symbol; one already watched with the same --def-path is
+// refused
+func (l *Watchlist) add(w WatchedSymbol) error {
+	if l.find(w.Symbol, w.DefPath) >= 0 {
+		return fmt.Errorf("%s is already in the watchlist", w.Symbol)
+	}
+	l.Symbols = append(l.Symbols, w)
+	return nil
+}
+
+// remove drops every entry for symbol and returns how many there were
+func (l *Watchlist) remove(symbol string) int {
+	kept := l.Symbols[:0]
+	for _, w := range l.Symbols {
+		if w.Symbol != symbol {
+			kept = append(kept, w)
+		}
+	}
+	removed := len(l.Symbols) - len(kept)
+	l.Symbols = kept
+	return removed
+}
+
+// watchedCallers returns the direct callers of a depth-1 trace, sorted by
+// file and line, one per calling function
+func watchedCallers(result *TraceResult) []WatchedCaller {
+	var callers []WatchedCaller
+	seen := make(map[string]bool)
+	if result != nil && result.Root != nil {
+		for _, child := range result.Root.Children {
+			line, _ := strconv.Atoi(child.LineNo)
+			c := WatchedCaller{Symbol: child.Symbol, FilePath: child.FilePath, Line: line}
+			if seen[c.key()] {
+				continue
+			}
+			seen[c.key()] = true
+			callers = append(callers, c)
+		}
+	}
+	sortWatchedCallers(callers)
+	return callers
+}
+
+func sortWatchedCallers(callers []WatchedCaller) {
+	sort.SliceStable(callers, func(i, j int) bool {
+		if callers[i].FilePath != callers[j].FilePath {
+			return callers[i].FilePath < callers[j].FilePath
+		}
+		return callers[i].Line < callers[j].Line
+	})
+}
+
+// diffCallers returns the callers in cur but not in prev, and those in
+// prev but not in cur
+func diffCallers(prev, cur []WatchedCaller) (added, gone []WatchedCaller) {
+	inPrev := make(map[string]bool, len(prev))
+	for _, c := range prev {
+		inPrev[c.key()] = true
+	}
+	inCur := make(map[string]bool, len(cur))
+	for _, c := range cur {
+		inCur[c.key()] = true
+		if !inPrev[c.key()] {
+			added = append(added, c)
+		}
+	}
+	for _, c := range prev {
+		if !inCur[c.key()] {
+			gone = append(gone, c)
+		}
+	}
+	return added, gone
+}
+
+// runWatchlist traces each watched symbol with trace, compares its direct
+// callers with the symbol's snapshot and replaces the snapshot. Errors
+// tracing one symbol are recorded in its report and leave its snapshot as
+// it was. If ctx is canceled, the reports of the symbols done so far are
+// returned with the context's error.
+func runWatchlist(ctx context.Context, list *Watchlist, server string, now time.Time, trace func(WatchedSymbol) (*TraceResult, error)) ([]WatchReport, error) {
+	reports := make([]WatchReport, 0, len(list.Symbols))
+	for i := range list.Symbols {
+		w := &list.Symbols[i]
+		result, err := trace(*w)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return reports, ctxErr
+		}
+		report := WatchReport{Symbol: w.Symbol}
+		if err != nil {
+			var ambiguous *AmbiguousDefinitionError
+			if errors.As(err, &ambiguous) {
+				err = fmt.Errorf("defined %d times; add it again with --def-path", len(ambiguous.Candidates))
+			}
+			report.Err = err
+			reports = append(reports, report)
+			continue
+		}
+
+		callers := watchedCallers(result)
+		report.Partial = result.MaxReached
+		prev := w.Snapshot
+		if prev == nil || prev.Server != server {
+			report.First = true
+		} else {
+			report.Since = prev.Taken
+			report.New, report.Gone = diffCallers(prev.Callers, callers)
+			if report.Partial {
+				callers = append(callers, report.Gone...)
+				sortWatchedCallers(callers)
+				report.Gone = nil
+			}
+		}
+		report.Total = len(callers)
+		w.Snapshot = &WatchSnapshot{Server: server, Taken: now, Callers: callers}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// formatWatchReports prints what changed for each watched symbol: new
+// callers (+) and callers gone (-) since the previous run
+func formatWatchReports(w io.Writer, reports []WatchReport, useColor bool) {
+	paint := func(color, s string) string {
+		if useColor {
+			return color + s + colorReset
+		}
+		return s
+	}
+	for _, r := range reports {
+		name := paint(colorBold, r.Symbol)
+		note := ""
+		if r.Partial {
+			note = " (partial: --max-total reached)"
+		}
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(w, "%s: %s\n", name, paint(colorRed, "error: "+r.Err.Error()))
+			continue
+		case r.First:
+			fmt.Fprintf(w, "%s: first snapshot, %d callers%s\n", name, r.Total, note)
+			continue
+		case len(r.New) == 0 && len(r.Gone) == 0:
+			fmt.Fprintf(w, "%s: no new callers (%d total)%s\n", name, r.Total, note)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %d new callers since %s (%d total)%s\n", name, len(r.New), r.Since.Format("2006-01-02 15:04"), r.Total, note)
+		for _, c := range r.New {
+			fmt.Fprintln(w, paint(colorGreen, "  + "+formatWatchedCaller(c)))
+		}
+		for _, c := range r.Gone {
+			fmt.Fprintln(w, paint(colorRed, "  - "+formatWatchedCaller(c)))
+		}
+	}
+}
+
+// formatWatchedCaller formats a caller as "func (project/path:line)"
+func formatWatchedCaller(c WatchedCaller) string {
+	loc := strings.TrimPrefix(c.FilePath, "/")
+	if c.Line > 0 {
+		loc += ":" + strconv.Itoa(c.Line)
+	}
+	if c.Symbol == "" {
+		return loc
+	}
+	return c.Symbol + " (" + loc + ")"
+}
+
+// formatWatchlist lists the watched symbols with their last snapshot
+func formatWatchlist(w io.Writer, list *Watchlist) {
+	for _, s := range list.Symbols {
+		line := s.Symbol
+		if s.Projects != "" {
+			line += " --projects " + s.Projects
+		}
+		if s.DefPath != "" {
+			line += " --def-path " + s.DefPath
+		}
+		if s.Snapshot == nil {
+			line += "  (not run yet)"
+		} else {
+			line += fmt.Sprintf("  (%d callers at %s)", len(s.Snapshot.Callers), s.Snapshot.Taken.Format("2006-01-02 15:04"))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
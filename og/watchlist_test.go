@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watchTrace returns a depth-1 trace result with the given callers, each
+// "symbol@/project/path:line"
+func watchTrace(callers ...string) *TraceResult {
+	root := &CallNode{Symbol: "api"}
+	for _, c := range callers {
+		symbol, loc, _ := strings.Cut(c, "@")
+		path, line, _ := strings.Cut(loc, ":")
+		root.Children = append(root.Children, &CallNode{Symbol: symbol, FilePath: path, LineNo: line, Relation: "caller"})
+	}
+	return &TraceResult{Root: root, TotalNodes: len(callers) + 1}
+}
+
+func TestWatchlistRun(t *testing.T) {
+	oldGetWatchlistPath := getWatchlistPath
+	defer func() { getWatchlistPath = oldGetWatchlistPath }()
+	path := filepath.Join(t.TempDir(), ".og_watchlist.json")
+	getWatchlistPath = func() (string, error) { return path, nil }
+
+	list, err := loadWatchlist()
+	if err != nil || len(list.Symbols) != 0 {
+		t.Fatalf("loadWatchlist() with no file = %+v, %v", list, err)
+	}
+	list.add(WatchedSymbol{Symbol: "api"})
+	list.add(WatchedSymbol{Symbol: "dup"})
+	if err := list.add(WatchedSymbol{Symbol: "api"}); err == nil {
+		t.Error("add() accepted a symbol already watched")
+	}
+
+	traces := map[string]*TraceResult{"api": watchTrace("a@/p/a.c:10", "b@/p/b.c:20")}
+	trace := func(w WatchedSymbol) (*TraceResult, error) {
+		if w.Symbol == "dup" {
+			return nil, &AmbiguousDefinitionError{Symbol: "dup", Candidates: make([]Definition, 2)}
+		}
+		return traces[w.Symbol], nil
+	}
+	first := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	reports, err := runWatchlist(context.Background(), list, "http://og", first, trace)
+	if err != nil || len(reports) != 2 || !reports[0].First || reports[0].Total != 2 {
+		t.Fatalf("first run = %+v, %v", reports, err)
+	}
+	if reports[1].Err == nil || !strings.Contains(reports[1].Err.Error(), "--def-path") || list.Symbols[1].Snapshot != nil {
+		t.Errorf("ambiguous symbol: report %+v, snapshot %+v", reports[1], list.Symbols[1].Snapshot)
+	}
+	if err := saveWatchlist(list); err != nil {
+		t.Fatal(err)
+	}
+
+	// b moved, c is new and a is gone
+	list, _ = loadWatchlist()
+	list.remove("dup")
+	traces["api"] = watchTrace("b@/p/b.c:25", "c@/p/c.c:5")
+	reports, err = runWatchlist(context.Background(), list, "http://og", first.Add(24*time.Hour), trace)
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("second run = %+v, %v", reports, err)
+	}
+	r := reports[0]
+	if r.First || !r.Since.Equal(first) || len(r.New) != 1 || r.New[0].Symbol != "c" || len(r.Gone) != 1 || r.Gone[0].Symbol != "a" || r.Total != 2 {
+		t.Errorf("second run report = %+v", r)
+	}
+
+	var buf bytes.Buffer
+	formatWatchReports(&buf, reports, false)
+	want := "api: 1 new callers since 2026-10-01 09:00 (2 total)\n  + c (p/c.c:5)\n  - a (p/a.c:10)\n"
+	if buf.String() != want {
+		t.Errorf("formatWatchReports() =\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// A partial trace reports nothing gone and keeps what it didn't reach
+	traces["api"] = watchTrace("d@/p/d.c:1")
+	traces["api"].MaxReached = true
+	reports, _ = runWatchlist(context.Background(), list, "http://og", first.Add(48*time.Hour), trace)
+	if r := reports[0]; len(r.New) != 1 || len(r.Gone) != 0 || r.Total != 3 || !r.Partial {
+		t.Errorf("partial run report = %+v", r)
+	}
+
+	// Another server starts a new baseline
+	reports, _ = runWatchlist(context.Background(), list, "http://other", first.Add(72*time.Hour), trace)
+	if !reports[0].First {
+		t.Errorf("run on another server = %+v, want a first snapshot", reports[0])
+	}
+}
+
+func TestWatchlistRunInterrupted(t *testing.T) {
+	list := &Watchlist{Symbols: []WatchedSymbol{{Symbol: "a"}, {Symbol: "b"}}}
+	ctx, cancel := context.WithCancel(context.Background())
+	reports, err := runWatchlist(ctx, list, "http://og", time.Now(), func(w WatchedSymbol) (*TraceResult, error) {
+		if w.Symbol == "b" {
+			cancel()
+		}
+		return watchTrace("x@/p/x.c:1"), nil
+	})
+	if !errors.Is(err, context.Canceled) || len(reports) != 1 || list.Symbols[0].Snapshot == nil || list.Symbols[1].Snapshot != nil {
+		t.Errorf("interrupted run = %+v, %v", reports, err)
+	}
+}
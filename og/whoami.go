@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// authChoice is the set of credentials configureClientAuth uses, and where
+// it came from
+type authChoice struct {
+	AuthOptions
+	OIDC *OIDCConfig
+	// Source is "flag", "env" or "config", "" when no credentials are set
+	Source string
+}
+
+// chooseAuth picks credentials the way every command does: flags first,
+// then the environment, then the config file. Within one source a bearer
+// token beats an API key, which beats basic auth (and, in the config,
+// OIDC, once logged in).
+func chooseAuth(flags, env AuthOptions, config *Config) authChoice {
+	pick := func(opts AuthOptions, source string) authChoice {
+		switch {
+		case opts.BearerToken != "":
+			return authChoice{AuthOptions: AuthOptions{BearerToken: opts.BearerToken}, Source: source}
+		case opts.APIKey != "":
+			return authChoice{AuthOptions: AuthOptions{APIKey: opts.APIKey}, Source: source}
+		case opts.Username != "":
+			return authChoice{AuthOptions: AuthOptions{Username: opts.Username, Password: opts.Password}, Source: source}
+		}
+		return authChoice{}
+	}
+	switch {
+	case !flags.empty():
+		return pick(flags, "flag")
+	case !env.empty():
+		return pick(env, "env")
+	case config == nil:
+		return authChoice{}
+	}
+	choice := pick(AuthOptions{
+		Username:    config.Username,
+		Password:    config.Password,
+		APIKey:      config.APIKey,
+		BearerToken: config.BearerToken,
+	}, "config")
+	if choice.Source == "" && config.OIDC != nil && config.OIDC.loggedIn() {
+		choice = authChoice{OIDC: config.OIDC, Source: "config"}
+	}
+	return choice
+}
+
+// method names the kind of credentials chosen
+func (c authChoice) method() string {
+	switch {
+	case c.BearerToken != "":
+		return "bearer token"
+	case c.APIKey != "":
+		return "API key"
+	case c.Username != "":
+		return "basic auth"
+	case c.OIDC != nil:
+		return "OIDC"
+	}
+	return "none"
+}
+
+// origin names where the credentials came from: the flag or environment
+// variable, or the config file's path
+func (c authChoice) origin(configPath string) string {
+	var flagName, envName string
+	switch c.method() {
+	case "bearer token":
+		flagName, envName = "--bearer-token", envBearerToken
+	case "API key":
+		flagName, envName = "--api-key", envAPIKey
+	case "basic auth":
+		flagName, envName = "--username", envUsername
+	}
+	switch c.Source {
+	case "flag":
+		return flagName
+	case "env":
+		return envName
+	case "config":
+		return configPath
+	}
+	return ""
+}
+
+// secretFingerprint identifies a secret without revealing it: the first 12
+// hex digits of its SHA-256, enough to tell two tokens apart or match one
+// against a token store
+func secretFingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return "sha256:" + hex.EncodeToString(sum[:])[:12]
+}
+
+// maskSecret shows the last 4 characters of a secret long enough that they
+// give nothing away, and hides the rest
+func maskSecret(secret string) string {
+	if len(secret) < 16 {
+		return strings.Repeat("*", 8)
+	}
+	return strings.Repeat("*", 8) + secret[len(secret)-4:]
+}
+
+// serverSource names where getServerURL finds the server URL, given the
+// --server flag's value
+func serverSource(flagURL, configPath string) string {
+	switch {
+	case flagURL != "":
+		return "--server"
+	case globalServerURL != "":
+		return "og --server"
+	case os.Getenv(envServer) != "":
+		return envServer
+	}
+	return configPath
+}
+
+// printWhoami prints the server and the credentials a command would send
+// to it, with secrets masked
+func printWhoami(w io.Writer, server, serverFrom string, choice authChoice, configPath string, config *Config) {
+	fmt.Fprintf(w, "Server: %s (from %s)\n", server, serverFrom)
+	if choice.Source == "" {
+		fmt.Fprintln(w, "Credentials: none")
+		return
+	}
+	from := choice.origin(configPath)
+	if choice.Source == "config" && config != nil && config.Encrypted != nil {
+		from += fmt.Sprintf(", encrypted (%s)", config.Encrypted.KeySource)
+	}
+	fmt.Fprintf(w, "Credentials: %s (from %s)\n", choice.method(), from)
+	switch {
+	case choice.BearerToken != "":
+		fmt.Fprintf(w, "Token: %s %s\n", maskSecret(choice.BearerToken), secretFingerprint(choice.BearerToken))
+	case choice.APIKey != "":
+		fmt.Fprintf(w, "API key: %s %s\n", maskSecret(choice.APIKey), secretFingerprint(choice.APIKey))
+	case choice.Username != "":
+		// A password's hash could be attacked offline, so it gets no fingerprint
+		password := "set"
+		if choice.Password == "" {
+			password = "not set"
+		}
+		fmt.Fprintf(w, "User: %s (password %s)\n", choice.Username, password)
+	case choice.OIDC != nil:
+		fmt.Fprintf(w, "OIDC: %s\n", NewOIDCProvider(choice.OIDC, nil).Describe())
+		if choice.OIDC.AccessToken != "" {
+			fmt.Fprintf(w, "Token: %s %s\n", maskSecret(choice.OIDC.AccessToken), secretFingerprint(choice.OIDC.AccessToken))
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChooseAuth(t *testing.T) {
+	config := &Config{APIKey: "config-key", OIDC: &OIDCConfig{Issuer: "https://idp"}}
+	tests := []struct {
+		name   string
+		flags  AuthOptions
+		env    AuthOptions
+		config *Config
+		method string
+		source string
+	}{
+		{"flag beats env and config", AuthOptions{Username: "alice", Password: "pw"}, AuthOptions{BearerToken: "env-tok"}, config, "basic auth", "flag"},
+		{"env beats config", AuthOptions{}, AuthOptions{BearerToken: "env-tok"}, config, "bearer token", "env"},
+		{"config", AuthOptions{}, AuthOptions{}, config, "API key", "config"},
+		{"config OIDC", AuthOptions{}, AuthOptions{}, &Config{OIDC: &OIDCConfig{AccessToken: "tok"}}, "OIDC", "config"},
+		{"config OIDC after logout", AuthOptions{}, AuthOptions{}, &Config{OIDC: &OIDCConfig{Issuer: "https://idp"}}, "none", ""},
+		{"token beats key in one source", AuthOptions{APIKey: "k", BearerToken: "t"}, AuthOptions{}, nil, "bearer token", "flag"},
+		{"none", AuthOptions{}, AuthOptions{}, nil, "none", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chooseAuth(tt.flags, tt.env, tt.config)
+			if got.method() != tt.method || got.Source != tt.source {
+				t.Errorf("chooseAuth() = %s from %q, want %s from %q", got.method(), got.Source, tt.method, tt.source)
+			}
+		})
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	if got := maskSecret("0123456789abcdef9f3a"); got != "********9f3a" {
+		t.Errorf("maskSecret(long) = %q", got)
+	}
+	if got := maskSecret("short"); got != "********" {
+		t.Errorf("maskSecret(short) = %q", got)
+	}
+	if a, b := secretFingerprint("one"), secretFingerprint("two"); a == b || !strings.HasPrefix(a, "sha256:") || len(a) != len("sha256:")+12 {
+		t.Errorf("fingerprints = %q, %q", a, b)
+	}
+}
+
+func TestPrintWhoami(t *testing.T) {
+	token := "eyJhbGciOiJIUzI1NiJ9.secret-part.tail"
+	var buf bytes.Buffer
+	printWhoami(&buf, "http://h/source", envServer, chooseAuth(AuthOptions{}, AuthOptions{BearerToken: token}, nil), "/home/me/.og.json", nil)
+	out := buf.String()
+	for _, want := range []string{
+		"Server: http://h/source (from OG_SERVER)",
+		"Credentials: bearer token (from OG_BEARER_TOKEN)",
+		"Token: ********tail " + secretFingerprint(token),
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret-part") {
+		t.Errorf("token leaked:\n%s", out)
+	}
+
+	buf.Reset()
+	config := &Config{Username: "alice", Password: "hunter22", Encrypted: &EncryptedCredentials{KeySource: "keyring"}}
+	printWhoami(&buf, "http://h/source", "/home/me/.og.json", chooseAuth(AuthOptions{}, AuthOptions{}, config), "/home/me/.og.json", config)
+	if out := buf.String(); !strings.Contains(out, "basic auth (from /home/me/.og.json, encrypted (keyring))") || !strings.Contains(out, "User: alice (password set)") || strings.Contains(out, "hunter22") {
+		t.Errorf("basic auth output:\n%s", out)
+	}
+}
@@ -169,8 +169,8 @@ func TestUpdateExistingAnnotation(t *testing.T) {
 		t.Fatalf("SaveAnnotation failed: %v", err)
 	}
 
-	// Update same line (file exists, no source needed)
-	err = SaveAnnotationV2(tmpDir, "proj", "file.go", 42, "bob", "Updated text", "", "")
+	// Update same line by the same author (file exists, no source needed)
+	err = SaveAnnotationV2(tmpDir, "proj", "file.go", 42, "alice", "Updated text", "", "")
 	if err != nil {
 		t.Fatalf("SaveAnnotation update failed: %v", err)
 	}
@@ -185,14 +185,82 @@ func TestUpdateExistingAnnotation(t *testing.T) {
 		t.Fatalf("expected 1 annotation after update, got %d", len(annotations))
 	}
 
-	if annotations[0].Author != "bob" {
-		t.Errorf("author after update: got %q, want %q", annotations[0].Author, "bob")
+	if annotations[0].Author != "alice" {
+		t.Errorf("author after update: got %q, want %q", annotations[0].Author, "alice")
 	}
 	if annotations[0].Text != "Updated text" {
 		t.Errorf("text after update: got %q, want %q", annotations[0].Text, "Updated text")
 	}
 }
 
+func TestSeveralAnnotationsPerLine(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceContent := mockSourceContent(50)
+
+	first, err := SaveTaggedAnnotation(tmpDir, "proj", "file.go", 42, "alice", "First", nil, sourceContent, "")
+	if err != nil {
+		t.Fatalf("SaveTaggedAnnotation failed: %v", err)
+	}
+	second, err := SaveTaggedAnnotation(tmpDir, "proj", "file.go", 42, "bob", "Second", []string{"bug"}, "", "")
+	if err != nil {
+		t.Fatalf("SaveTaggedAnnotation failed: %v", err)
+	}
+	if first.ID == "" || second.ID == "" || first.ID == second.ID {
+		t.Fatalf("IDs = %q, %q, want two different ones", first.ID, second.ID)
+	}
+
+	annotations, err := ReadAnnotations(tmpDir, "proj", "file.go")
+	if err != nil {
+		t.Fatalf("ReadAnnotations failed: %v", err)
+	}
+	if len(annotations) != 2 || annotations[0].ID != first.ID || annotations[1].ID != second.ID {
+		t.Fatalf("expected alice's then bob's note on line 42, got %+v", annotations)
+	}
+
+	// Update by ID, by its author only
+	if _, err := UpdateAnnotation(tmpDir, "proj", "file.go", first.ID, "carol", "First, hijacked", nil); err == nil {
+		t.Error("expected an error updating another author's note")
+	}
+	updated, err := UpdateAnnotation(tmpDir, "proj", "file.go", first.ID, "alice", "First, edited", nil)
+	if err != nil {
+		t.Fatalf("UpdateAnnotation failed: %v", err)
+	}
+	if updated.ID != first.ID || updated.Line != 42 || updated.Author != "alice" {
+		t.Errorf("updated = %+v", updated)
+	}
+	if _, err := UpdateAnnotation(tmpDir, "proj", "file.go", "0000beef", "alice", "text", nil); err == nil {
+		t.Error("expected an error updating an unknown ID")
+	}
+
+	// A line with several notes needs the ID to delete one
+	if err := DeleteAnnotation(tmpDir, "proj", "file.go", 42); err == nil {
+		t.Error("expected an error deleting by line with two notes on it")
+	}
+	// Delete by ID, by its author only
+	if _, err := DeleteAnnotationByID(tmpDir, "proj", "file.go", second.ID, "carol"); err == nil || !strings.Contains(err.Error(), "only its author") {
+		t.Errorf("deleting another author's note: err = %v", err)
+	}
+	deleted, err := DeleteAnnotationByID(tmpDir, "proj", "file.go", second.ID, "bob")
+	if err != nil {
+		t.Fatalf("DeleteAnnotationByID failed: %v", err)
+	}
+	if deleted.Author != "bob" {
+		t.Errorf("deleted = %+v", deleted)
+	}
+	annotations, _ = ReadAnnotations(tmpDir, "proj", "file.go")
+	if len(annotations) != 1 || annotations[0].Text != "First, edited" || annotations[0].ID != first.ID {
+		t.Errorf("after delete: %+v", annotations)
+	}
+
+	check, err := FsckStorage(tmpDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Issues) != 0 {
+		t.Errorf("fsck issues: %+v", check.Issues)
+	}
+}
+
 func TestDeleteAnnotation(t *testing.T) {
 	tmpDir := t.TempDir()
 	sourceContent := mockSourceContent(30)
@@ -387,6 +455,132 @@ This is line 4 after blank.
 	}
 }
 
+func TestTaggedAnnotations(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceContent := mockSourceContent(30)
+
+	if _, err := SaveTaggedAnnotation(tmpDir, "proj", "file.go", 10, "alice", "Races on close", []string{"Bug", "#perf", "bug"}, sourceContent, ""); err != nil {
+		t.Fatalf("SaveTaggedAnnotation failed: %v", err)
+	}
+	if err := SaveAnnotationV2(tmpDir, "proj", "file.go", 20, "bob", "Why?", "", ""); err != nil {
+		t.Fatalf("SaveAnnotationV2 failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(tmpDir, encodeFilename("proj", "file.go")))
+	if !strings.Contains(string(content), "> **@alice** (") || !strings.Contains(string(content), ") [bug, perf] ^") {
+		t.Errorf("tags not written to the annotation header:\n%s", content)
+	}
+
+	annotations, err := ReadAnnotations(tmpDir, "proj", "file.go")
+	if err != nil {
+		t.Fatalf("ReadAnnotations failed: %v", err)
+	}
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(annotations))
+	}
+	if got := strings.Join(annotations[0].Tags, ","); got != "bug,perf" {
+		t.Errorf("tags = %q, want %q", got, "bug,perf")
+	}
+	if annotations[0].Text != "Races on close" {
+		t.Errorf("text = %q, want %q", annotations[0].Text, "Races on close")
+	}
+	if annotations[1].Tags != nil {
+		t.Errorf("untagged annotation has tags %v", annotations[1].Tags)
+	}
+
+	bugs := FilterByTag(annotations, "BUG")
+	if len(bugs) != 1 || bugs[0].Line != 10 {
+		t.Errorf("FilterByTag(bug) = %+v, want the line 10 annotation", bugs)
+	}
+	if got := FilterByTag(annotations, "question"); len(got) != 0 {
+		t.Errorf("FilterByTag(question) = %+v, want none", got)
+	}
+	if got := FilterByTag(annotations, ""); len(got) != 2 {
+		t.Errorf("FilterByTag(\"\") returned %d annotations, want 2", len(got))
+	}
+}
+
+func TestNormalizeTagsInvalid(t *testing.T) {
+	for _, tag := range []string{"two words", "a,b", "]", "-lead"} {
+		if _, err := NormalizeTags([]string{tag}); err == nil {
+			t.Errorf("NormalizeTags(%q) succeeded, want error", tag)
+		}
+	}
+}
+
+func TestHandleRequestTagFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	save := func(line int, tags ...string) {
+		resp := handleRequest(Request{
+			Action: "save", StoragePath: tmpDir, Project: "proj", FilePath: "src/a.c",
+			Line: line, Author: "alice", Text: "note", Tags: tags, Source: mockSourceContent(20),
+		})
+		if !resp.Success {
+			t.Fatalf("save line %d failed: %s", line, resp.Error)
+		}
+	}
+	save(3, "bug")
+	save(7, "question")
+
+	read := handleRequest(Request{Action: "read", StoragePath: tmpDir, Project: "proj", FilePath: "src/a.c", Tag: "bug"})
+	if !read.Success || len(read.Annotations) != 1 || read.Annotations[0].Line != 3 {
+		t.Errorf("read with tag = %+v, want only line 3", read)
+	}
+	list := handleRequest(Request{Action: "listAnnotatedFiles", StoragePath: tmpDir, Project: "proj", Tag: "question"})
+	if !list.Success || len(list.Annotations) != 1 || list.Annotations[0].Line != 7 {
+		t.Errorf("listAnnotatedFiles with tag = %+v, want only line 7", list)
+	}
+
+	bad := handleRequest(Request{
+		Action: "save", StoragePath: tmpDir, Project: "proj", FilePath: "src/a.c",
+		Line: 9, Author: "alice", Text: "note", Tags: []string{"not valid"}, Source: mockSourceContent(20),
+	})
+	if bad.Success {
+		t.Error("save with an invalid tag should fail")
+	}
+}
+
+func TestHandleRequestReadSnapshot(t *testing.T) {
+	tmpDir := t.TempDir()
+	source := mockSourceContent(10)
+	resp := handleRequest(Request{
+		Action: "save", StoragePath: tmpDir, Project: "proj", FilePath: "src/a.c",
+		Line: 4, Author: "alice", Text: "note", Source: source,
+	})
+	if !resp.Success {
+		t.Fatalf("save failed: %s", resp.Error)
+	}
+
+	read := Request{Action: "read", StoragePath: tmpDir, Project: "proj", FilePath: "src/a.c"}
+	if resp := handleRequest(read); !resp.Success || resp.Snapshot != nil {
+		t.Errorf("read without includeSnapshot = %+v, want no snapshot", resp)
+	}
+
+	read.IncludeSnapshot = true
+	resp = handleRequest(read)
+	if !resp.Success || resp.Snapshot == nil || len(resp.Snapshot.Lines) != 10 || resp.Snapshot.Hash != computeSourceHash(source) || resp.Snapshot.Drifted {
+		t.Fatalf("read with includeSnapshot = %+v", resp)
+	}
+	if len(resp.Annotations) != 1 || resp.Annotations[0].Line != 4 {
+		t.Errorf("annotations = %+v", resp.Annotations)
+	}
+
+	read.Source = source
+	if resp := handleRequest(read); resp.Snapshot == nil || resp.Snapshot.Drifted {
+		t.Errorf("unchanged source reported as drifted: %+v", resp.Snapshot)
+	}
+	read.Source = "// new header\n" + source
+	if resp := handleRequest(read); resp.Snapshot == nil || !resp.Snapshot.Drifted {
+		t.Errorf("changed source not reported as drifted: %+v", resp.Snapshot)
+	}
+
+	// A file not annotated yet has no snapshot
+	read = Request{Action: "read", StoragePath: tmpDir, Project: "proj", FilePath: "src/b.c", IncludeSnapshot: true}
+	if resp := handleRequest(read); !resp.Success || resp.Snapshot != nil {
+		t.Errorf("read of an unannotated file = %+v", resp)
+	}
+}
+
 func TestReadAnnotationsWithLongLine(t *testing.T) {
 	tmpDir := t.TempDir()
 	longLine := strings.Repeat("a", 200000)
@@ -548,3 +742,50 @@ func TestHandleRequestSaveFirstAnnotation(t *testing.T) {
 		t.Fatalf("expected 1 annotation, got %d", len(readResp.Annotations))
 	}
 }
+
+// TestHandleRequestBatch tests that batch runs sub-requests in order and
+// reports each result separately
+func TestHandleRequestBatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	resp := handleRequest(Request{
+		Action: "batch",
+		Requests: []Request{
+			{Action: "save", StoragePath: tmpDir, Project: "proj", FilePath: "a.go", Line: 1, Author: "alice", Text: "note", Source: "package a\n"},
+			{Action: "read", StoragePath: tmpDir, Project: "proj", FilePath: "a.go"},
+			{Action: "read", StoragePath: tmpDir}, // missing fields
+			{Action: "batch", Requests: []Request{{Action: "ping"}}},
+			{Action: "listAnnotatedFiles", StoragePath: tmpDir, Project: "proj"},
+		},
+	})
+	if !resp.Success {
+		t.Fatalf("batch failed: %s", resp.Error)
+	}
+	if len(resp.Responses) != 5 {
+		t.Fatalf("expected 5 responses, got %d", len(resp.Responses))
+	}
+
+	if !resp.Responses[0].Success {
+		t.Errorf("save failed: %s", resp.Responses[0].Error)
+	}
+	// The read sees the save that ran before it
+	if !resp.Responses[1].Success || len(resp.Responses[1].Annotations) != 1 {
+		t.Errorf("read: %+v", resp.Responses[1])
+	}
+	if resp.Responses[2].Success || resp.Responses[2].Error == "" {
+		t.Error("sub-request with missing fields should fail on its own")
+	}
+	if resp.Responses[3].Success || !strings.Contains(resp.Responses[3].Error, "Nested batch") {
+		t.Errorf("nested batch should be rejected: %+v", resp.Responses[3])
+	}
+	if !resp.Responses[4].Success || len(resp.Responses[4].Annotations) != 1 {
+		t.Errorf("listAnnotatedFiles: %+v", resp.Responses[4])
+	}
+}
+
+func TestHandleRequestBatchEmpty(t *testing.T) {
+	resp := handleRequest(Request{Action: "batch"})
+	if resp.Success || resp.Error == "" {
+		t.Error("batch without requests should fail")
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -12,19 +13,27 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"og/pkg/annotation"
 )
 
-const maxScanToken = 1024 * 1024
+const maxScanToken = annotation.MaxLineLength
 
-// Annotation represents a single annotation on a line
-type Annotation struct {
-	Line      int      `json:"line"`
-	Author    string   `json:"author"`
-	Timestamp string   `json:"timestamp"`
-	Text      string   `json:"text"`
-	Context   []string `json:"context,omitempty"`
-	FilePath  string   `json:"filePath,omitempty"` // Used when listing all annotated files
-}
+// The annotation file format lives in og/pkg/annotation so og reads notes
+// with the same parser; these aliases keep the host's names
+type (
+	Annotation   = annotation.Annotation
+	V2FileHeader = annotation.Header
+)
+
+var (
+	encodeFilename   = annotation.Filename
+	decodeFilename   = annotation.ParseFilename
+	annotationHeader = annotation.FormatHeader
+	parseV2File      = annotation.ParseFile
+	parseV2          = annotation.Parse
+	formatV2File     = annotation.Format
+)
 
 // EditEntry represents someone currently editing
 type EditEntry struct {
@@ -34,196 +43,45 @@ type EditEntry struct {
 	Timestamp string `json:"timestamp"`
 }
 
-// V2FileHeader contains metadata for v2 annotation files
-type V2FileHeader struct {
-	Source   string // project/path
-	Hash     string // SHA-256 prefix (12 chars)
-	Captured string // ISO 8601 timestamp
-}
-
-// encodeFilename converts project/path to filename format
-// Uses __ as path separator, ___ to escape actual __ in names
-func encodeFilename(project, filePath string) string {
-	// First escape any existing __ as ___
-	project = strings.ReplaceAll(project, "__", "___")
-	filePath = strings.ReplaceAll(filePath, "__", "___")
-
-	// Replace path separators with __
-	filePath = strings.ReplaceAll(filePath, "/", "__")
-
-	return project + "__" + filePath + ".md"
-}
-
-// decodeFilename converts filename back to project/path
-func decodeFilename(filename string) (project, filePath string, ok bool) {
-	// Remove .md suffix
-	if !strings.HasSuffix(filename, ".md") {
-		return "", "", false
-	}
-	filename = strings.TrimSuffix(filename, ".md")
-
-	// Split into parts by __ (but not ___)
-	// We need to handle ___ (escaped __) vs __ (separator)
-	// Strategy: replace ___ with a placeholder, split by __, then restore
-
-	placeholder := "\x00"
-	temp := strings.ReplaceAll(filename, "___", placeholder)
-	parts := strings.Split(temp, "__")
-
-	if len(parts) < 2 {
-		return "", "", false
-	}
-
-	// First part is project
-	project = strings.ReplaceAll(parts[0], placeholder, "__")
-
-	// Rest is the file path
-	pathParts := parts[1:]
-	for i := range pathParts {
-		pathParts[i] = strings.ReplaceAll(pathParts[i], placeholder, "__")
-	}
-	filePath = strings.Join(pathParts, "/")
-
-	return project, filePath, true
-}
-
 // computeSourceHash computes SHA-256 hash prefix of source content
 func computeSourceHash(content string) string {
 	hash := sha256.Sum256([]byte(content))
 	return hex.EncodeToString(hash[:])[:12]
 }
 
-// formatLineNumber formats a line number with right-aligned padding
-func formatLineNumber(lineNum, maxLineNum int) string {
-	width := len(strconv.Itoa(maxLineNum))
-	return fmt.Sprintf("%*d|", width, lineNum)
-}
-
-// parseV2File parses a v2 format annotation file
-func parseV2File(path string) (header V2FileHeader, annotations []Annotation, sourceLines []string, err error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return header, nil, nil, err
-	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	scanner.Buffer(make([]byte, 0, 64*1024), maxScanToken)
-
-	// Parse frontmatter
-	inFrontmatter := false
-	frontmatterDone := false
-
-	// Regex patterns
-	sourceLineRe := regexp.MustCompile(`^\s*(\d+)\|(.*)$`)
-	lineMarkerRe := regexp.MustCompile(`^## Line (\d+)$`)
-	annotationHeaderRe := regexp.MustCompile(`^> \*\*@([^*]+)\*\* \(([^)]+)\):$`)
-
-	var currentAnnotation *Annotation
-	var annotationLines []string
-	lastSourceLine := 0
-
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		// Handle frontmatter
-		if line == "---" {
-			if !inFrontmatter && !frontmatterDone {
-				inFrontmatter = true
-				continue
-			} else if inFrontmatter {
-				inFrontmatter = false
-				frontmatterDone = true
-				continue
-			}
-		}
-
-		if inFrontmatter {
-			if strings.HasPrefix(line, "source:") {
-				header.Source = strings.TrimSpace(strings.TrimPrefix(line, "source:"))
-			} else if strings.HasPrefix(line, "hash:") {
-				header.Hash = strings.TrimSpace(strings.TrimPrefix(line, "hash:"))
-			} else if strings.HasPrefix(line, "captured:") {
-				header.Captured = strings.TrimSpace(strings.TrimPrefix(line, "captured:"))
-			}
-			continue
-		}
-
-		// Check if this is a source line
-		if matches := sourceLineRe.FindStringSubmatch(line); matches != nil {
-			// Save any pending annotation
-			if currentAnnotation != nil {
-				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
-				annotations = append(annotations, *currentAnnotation)
-				currentAnnotation = nil
-				annotationLines = nil
-			}
-
-			lineNum, _ := strconv.Atoi(matches[1])
-			lastSourceLine = lineNum
-			// Remove leading space after the | separator
-			content := matches[2]
-			if len(content) > 0 && content[0] == ' ' {
-				content = content[1:]
-			}
-			sourceLines = append(sourceLines, content)
-			continue
-		}
-
-		// Check if this is a line marker (used when no source content)
-		if matches := lineMarkerRe.FindStringSubmatch(line); matches != nil {
-			// Save any pending annotation
-			if currentAnnotation != nil {
-				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
-				annotations = append(annotations, *currentAnnotation)
-				currentAnnotation = nil
-				annotationLines = nil
-			}
-
-			lineNum, _ := strconv.Atoi(matches[1])
-			lastSourceLine = lineNum
+// tagRe matches a valid annotation tag
+var tagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// NormalizeTags lowercases tags, strips a leading "#" and drops duplicates.
+// Tags may contain letters, digits, "-" and "_".
+func NormalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
 			continue
 		}
-
-		// Check if this is an annotation header
-		if matches := annotationHeaderRe.FindStringSubmatch(line); matches != nil {
-			// Save any pending annotation first
-			if currentAnnotation != nil {
-				currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
-				annotations = append(annotations, *currentAnnotation)
-				annotationLines = nil
-			}
-
-			currentAnnotation = &Annotation{
-				Line:      lastSourceLine,
-				Author:    matches[1],
-				Timestamp: matches[2],
-			}
-			continue
-		}
-
-		// Check if this is annotation content (blockquote)
-		if strings.HasPrefix(line, "> ") && currentAnnotation != nil {
-			annotationLines = append(annotationLines, strings.TrimPrefix(line, "> "))
-			continue
-		}
-
-		// Empty line might end an annotation
-		if line == "" && currentAnnotation != nil && len(annotationLines) > 0 {
-			currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
-			annotations = append(annotations, *currentAnnotation)
-			currentAnnotation = nil
-			annotationLines = nil
+		if !tagRe.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use letters, digits, - and _", tag)
 		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
 	}
+	return normalized, nil
+}
 
-	// Save final annotation if any
-	if currentAnnotation != nil {
-		currentAnnotation.Text = strings.TrimSpace(strings.Join(annotationLines, "\n"))
-		annotations = append(annotations, *currentAnnotation)
-	}
+// FilterByTag returns the annotations carrying tag, or all of them if tag is empty
+func FilterByTag(annotations []Annotation, tag string) []Annotation {
+	return AnnotationFilter{Tag: tag}.Apply(annotations)
+}
 
-	return header, annotations, sourceLines, scanner.Err()
+// newAnnotationID returns a random ID for a new annotation: 8 hex digits,
+// plenty to tell apart the notes of one file
+func newAnnotationID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 // writeV2File writes a v2 format annotation file
@@ -234,73 +92,7 @@ func writeV2File(path string, header V2FileHeader, sourceLines []string, annotat
 	}
 	defer file.Close()
 
-	// Write frontmatter
-	fmt.Fprintln(file, "---")
-	fmt.Fprintf(file, "source: %s\n", header.Source)
-	fmt.Fprintf(file, "hash: %s\n", header.Hash)
-	fmt.Fprintf(file, "captured: %s\n", header.Captured)
-	fmt.Fprintln(file, "---")
-	fmt.Fprintln(file)
-
-	// Build annotation map by line
-	annotationMap := make(map[int][]Annotation)
-	for _, ann := range annotations {
-		annotationMap[ann.Line] = append(annotationMap[ann.Line], ann)
-	}
-
-	maxLineNum := len(sourceLines)
-
-	// If we have source lines, write them with inline annotations
-	if len(sourceLines) > 0 {
-		for i, sourceLine := range sourceLines {
-			lineNum := i + 1
-			fmt.Fprintf(file, "%s %s\n", formatLineNumber(lineNum, maxLineNum), sourceLine)
-
-			// Write any annotations for this line
-			if anns, ok := annotationMap[lineNum]; ok {
-				for _, ann := range anns {
-					fmt.Fprintln(file)
-					// Format date from timestamp (extract date part)
-					dateStr := ann.Timestamp
-					if len(dateStr) >= 10 {
-						dateStr = dateStr[:10] // YYYY-MM-DD
-					}
-					fmt.Fprintf(file, "> **@%s** (%s):\n", ann.Author, dateStr)
-					for _, textLine := range strings.Split(ann.Text, "\n") {
-						fmt.Fprintf(file, "> %s\n", textLine)
-					}
-					fmt.Fprintln(file)
-				}
-			}
-		}
-	} else {
-		// No source lines - write annotations with explicit line markers
-		// Sort annotations by line for consistent output
-		sortedLines := make([]int, 0, len(annotationMap))
-		for line := range annotationMap {
-			sortedLines = append(sortedLines, line)
-		}
-		sort.Ints(sortedLines)
-
-		for _, lineNum := range sortedLines {
-			// Write line marker
-			fmt.Fprintf(file, "## Line %d\n", lineNum)
-
-			for _, ann := range annotationMap[lineNum] {
-				fmt.Fprintln(file)
-				dateStr := ann.Timestamp
-				if len(dateStr) >= 10 {
-					dateStr = dateStr[:10]
-				}
-				fmt.Fprintf(file, "> **@%s** (%s):\n", ann.Author, dateStr)
-				for _, textLine := range strings.Split(ann.Text, "\n") {
-					fmt.Fprintf(file, "> %s\n", textLine)
-				}
-				fmt.Fprintln(file)
-			}
-		}
-	}
-
+	formatV2File(file, header, sourceLines, annotations)
 	return nil
 }
 
@@ -317,24 +109,75 @@ func ReadAnnotationsV2(storagePath, project, filePath string) ([]Annotation, err
 	return annotations, err
 }
 
-// SaveAnnotationV2 saves an annotation in v2 format
+// SourceSnapshot is the source a v2 file captured with its first
+// annotation, as a read with includeSnapshot returns it
+type SourceSnapshot struct {
+	Lines    []string `json:"lines"`
+	Hash     string   `json:"hash,omitempty"`
+	Captured string   `json:"captured,omitempty"`
+	// Drifted is set when the read sent the current source and it no
+	// longer matches Hash
+	Drifted bool `json:"drifted,omitempty"`
+}
+
+// ReadAnnotationsWithSnapshot reads the annotations of a v2 file along with
+// its source snapshot, which is nil when the file doesn't exist or captured
+// no source
+func ReadAnnotationsWithSnapshot(storagePath, project, filePath string) ([]Annotation, *SourceSnapshot, error) {
+	fullPath := filepath.Join(storagePath, encodeFilename(project, filePath))
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		return []Annotation{}, nil, nil
+	}
+
+	header, annotations, sourceLines, err := parseV2File(fullPath)
+	if err != nil || len(sourceLines) == 0 {
+		return annotations, nil, err
+	}
+	return annotations, &SourceSnapshot{Lines: sourceLines, Hash: header.Hash, Captured: header.Captured}, nil
+}
+
+// SaveAnnotationV2 saves an untagged annotation in v2 format
 // If sourceContent is provided and file doesn't exist, creates new v2 file
-// If file exists, adds/updates annotation in place
+// If file exists, adds the annotation, or updates the author's own note on
+// the line in place; other authors' notes on the line are kept
 func SaveAnnotationV2(storagePath, project, filePath string, line int, author, text string, sourceContent, sourceHash string) error {
+	_, err := SaveTaggedAnnotation(storagePath, project, filePath, line, author, text, nil, sourceContent, sourceHash)
+	return err
+}
+
+// SaveTaggedAnnotation saves an annotation with tags in v2 format, like
+// SaveAnnotationV2, and returns it as stored. Tags are normalized with
+// NormalizeTags.
+func SaveTaggedAnnotation(storagePath, project, filePath string, line int, author, text string, tags []string, sourceContent, sourceHash string) (Annotation, error) {
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return Annotation{}, err
+	}
+	return saveAnnotation(storagePath, project, filePath, Annotation{
+		Line:   line,
+		Author: author,
+		Text:   strings.TrimSpace(text), // As it reads back
+		Tags:   tags,
+	}, sourceContent, sourceHash)
+}
+
+// saveAnnotation stores newAnn, stamped with the current time, and returns
+// it as stored. The author's own note on the line, if any, is replaced and
+// keeps its ID; otherwise newAnn is added under a new ID. A new file's
+// snapshot is sourceContent.
+func saveAnnotation(storagePath, project, filePath string, newAnn Annotation, sourceContent, sourceHash string) (Annotation, error) {
 	if err := os.MkdirAll(storagePath, 0755); err != nil {
-		return fmt.Errorf("failed to create storage directory: %w", err)
+		return Annotation{}, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
 	filename := encodeFilename(project, filePath)
 	fullPath := filepath.Join(storagePath, filename)
+	defer refreshIndex(storagePath, filename)
 
 	timestamp := time.Now().UTC().Format(time.RFC3339)
-	newAnn := Annotation{
-		Line:      line,
-		Author:    author,
-		Timestamp: timestamp,
-		Text:      text,
-	}
+	newAnn.Timestamp = timestamp
+	newAnn.ID = newAnnotationID()
+	line := newAnn.Line
 
 	// Check if file exists
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
@@ -359,19 +202,22 @@ func SaveAnnotationV2(storagePath, project, filePath string, line int, author, t
 			Captured: timestamp,
 		}
 
-		return writeV2File(fullPath, header, sourceLines, []Annotation{newAnn})
+		return newAnn, writeCheckedV2File(fullPath, header, sourceLines, []Annotation{newAnn})
 	}
 
 	// Read existing file
 	header, annotations, sourceLines, err := parseV2File(fullPath)
 	if err != nil {
-		return err
+		return Annotation{}, err
 	}
 
-	// Find and update or append
+	// Update the author's note on the line, or add one next to any others
 	found := false
 	for i := range annotations {
-		if annotations[i].Line == line {
+		if annotations[i].Line == line && annotations[i].Author == newAnn.Author {
+			if annotations[i].ID != "" {
+				newAnn.ID = annotations[i].ID
+			}
 			annotations[i] = newAnn
 			found = true
 			break
@@ -381,42 +227,118 @@ func SaveAnnotationV2(storagePath, project, filePath string, line int, author, t
 		annotations = append(annotations, newAnn)
 	}
 
-	// Sort by line number
-	sort.Slice(annotations, func(i, j int) bool {
+	// Sort by line number, notes on one line in the order they were added
+	sort.SliceStable(annotations, func(i, j int) bool {
 		return annotations[i].Line < annotations[j].Line
 	})
 
-	return writeV2File(fullPath, header, sourceLines, annotations)
+	return newAnn, writeCheckedV2File(fullPath, header, sourceLines, annotations)
+}
+
+// UpdateAnnotation rewrites the text and tags of the annotation with the
+// given ID, as of now, and returns it as stored. It stays on its line. Only
+// its author can update it; others add a note of their own.
+func UpdateAnnotation(storagePath, project, filePath, id, author, text string, tags []string) (Annotation, error) {
+	if id == "" {
+		return Annotation{}, fmt.Errorf("missing annotation id")
+	}
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return Annotation{}, err
+	}
+	filename := encodeFilename(project, filePath)
+	fullPath := filepath.Join(storagePath, filename)
+	header, annotations, sourceLines, err := parseV2File(fullPath)
+	if os.IsNotExist(err) {
+		return Annotation{}, fmt.Errorf("no annotations for %s/%s", project, filePath)
+	}
+	if err != nil {
+		return Annotation{}, err
+	}
+	defer refreshIndex(storagePath, filename)
+
+	for i := range annotations {
+		if annotations[i].ID != id {
+			continue
+		}
+		if annotations[i].Author != author {
+			return Annotation{}, fmt.Errorf("annotation %s was written by %s; only its author can edit it", id, annotations[i].Author)
+		}
+		annotations[i].Text = strings.TrimSpace(text)
+		annotations[i].Tags = tags
+		annotations[i].Timestamp = time.Now().UTC().Format(time.RFC3339)
+		return annotations[i], writeCheckedV2File(fullPath, header, sourceLines, annotations)
+	}
+	return Annotation{}, fmt.Errorf("no annotation %s in %s/%s", id, project, filePath)
 }
 
-// DeleteAnnotationV2 removes an annotation from a v2 format file
+// DeleteAnnotationV2 removes the annotation on a line from a v2 format
+// file. A line with several annotations is left alone with an error: they
+// are deleted one at a time with DeleteAnnotationByID.
 func DeleteAnnotationV2(storagePath, project, filePath string, line int) error {
+	_, err := deleteAnnotation(storagePath, project, filePath, func(annotations []Annotation) (int, error) {
+		found := -1
+		for i, ann := range annotations {
+			if ann.Line != line {
+				continue
+			}
+			if found >= 0 {
+				return -1, fmt.Errorf("line %d has several annotations: give the id of the one to delete", line)
+			}
+			found = i
+		}
+		return found, nil
+	})
+	return err
+}
+
+// DeleteAnnotationByID removes the annotation with the given ID and returns
+// it. As with UpdateAnnotation, only its author can delete it.
+func DeleteAnnotationByID(storagePath, project, filePath, id, author string) (Annotation, error) {
+	return deleteAnnotation(storagePath, project, filePath, func(annotations []Annotation) (int, error) {
+		for i, ann := range annotations {
+			if id == "" || ann.ID != id {
+				continue
+			}
+			if ann.Author != author {
+				return -1, fmt.Errorf("annotation %s was written by %s; only its author can delete it", id, ann.Author)
+			}
+			return i, nil
+		}
+		return -1, fmt.Errorf("no annotation %s in %s/%s", id, project, filePath)
+	})
+}
+
+// deleteAnnotation removes the annotation find picks (-1 for none) from a
+// file, and the file once it has no annotations left
+func deleteAnnotation(storagePath, project, filePath string, find func([]Annotation) (int, error)) (Annotation, error) {
 	filename := encodeFilename(project, filePath)
 	fullPath := filepath.Join(storagePath, filename)
 
+	defer refreshIndex(storagePath, filename)
+
 	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		return nil // Nothing to delete
+		_, err := find(nil)
+		return Annotation{}, err // Nothing to delete
 	}
 
 	header, annotations, sourceLines, err := parseV2File(fullPath)
 	if err != nil {
-		return err
+		return Annotation{}, err
 	}
-
-	// Filter out the annotation
-	var filtered []Annotation
-	for _, ann := range annotations {
-		if ann.Line != line {
-			filtered = append(filtered, ann)
-		}
+	i, err := find(annotations)
+	if err != nil || i < 0 {
+		return Annotation{}, err
 	}
+	deleted := annotations[i]
+	annotations = append(annotations[:i], annotations[i+1:]...)
 
 	// If no annotations left, delete the file
-	if len(filtered) == 0 {
-		return os.Remove(fullPath)
+	if len(annotations) == 0 {
+		return deleted, os.Remove(fullPath)
 	}
 
-	return writeV2File(fullPath, header, sourceLines, filtered)
+	return deleted, writeV2File(fullPath, header, sourceLines, annotations)
 }
 
 // StartEditing marks a user as editing a file/line
@@ -546,43 +468,24 @@ func writeEditingFile(path string, entries []EditEntry) error {
 
 // ListAnnotatedFiles returns all files with annotations for a project
 func ListAnnotatedFiles(storagePath, project string) ([]Annotation, error) {
-	entries, err := os.ReadDir(storagePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []Annotation{}, nil
-		}
-		return nil, err
-	}
+	annotations, _, err := ListAnnotatedFilesPage(storagePath, project, 0, 0)
+	return annotations, err
+}
 
+// ListAnnotatedFilesPage returns the annotations of one page of a project's
+// annotated files (files in name order, starting at offset, at most limit
+// files; 0 for no limit) and the total number of annotated files
+func ListAnnotatedFilesPage(storagePath, project string, offset, limit int) ([]Annotation, int, error) {
 	var results []Annotation
-
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
-			continue
-		}
-		if entry.Name() == ".editing.md" {
-			continue
-		}
-
-		fileProject, filePath, ok := decodeFilename(entry.Name())
-		if !ok || fileProject != project {
-			continue
-		}
-
-		// Read annotations from this file
-		annotations, err := ReadAnnotationsV2(storagePath, project, filePath)
-		if err != nil {
-			continue
-		}
-
-		// Add file path to each annotation
-		for _, ann := range annotations {
-			ann.FilePath = filePath
-			results = append(results, ann)
-		}
+	var total int
+	err := streamAnnotatedFiles(storagePath, project, offset, limit, 0, func(pg annotatedFilesPage) error {
+		results, total = pg.Annotations, pg.Total
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
 	}
-
-	return results, nil
+	return results, total, nil
 }
 
 // Wrapper functions for backward compatibility with main.go
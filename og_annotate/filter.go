@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnnotationFilter selects the annotations read and listAnnotatedFiles
+// return. Empty fields match every annotation.
+type AnnotationFilter struct {
+	Tag string
+	// Author matches the annotation's author exactly, ignoring case
+	Author string
+	// Since and Until bound the annotation's date, inclusive
+	Since, Until string // YYYY-MM-DD
+	// Contains matches a substring of the text, ignoring case
+	Contains string
+}
+
+// requestFilter builds the filter a read or listAnnotatedFiles request asks
+// for. Dates may be given as YYYY-MM-DD or RFC 3339 timestamps; only their
+// date is used, as only the date of an annotation is stored.
+func requestFilter(req Request) (AnnotationFilter, error) {
+	f := AnnotationFilter{Tag: req.Tag, Author: req.Author, Contains: req.Contains}
+	var err error
+	if f.Since, err = filterDate("since", req.Since); err != nil {
+		return f, err
+	}
+	if f.Until, err = filterDate("until", req.Until); err != nil {
+		return f, err
+	}
+	if f.Since != "" && f.Until != "" && f.Since > f.Until {
+		return f, fmt.Errorf("since (%s) is after until (%s)", f.Since, f.Until)
+	}
+	return f, nil
+}
+
+// filterDate returns the YYYY-MM-DD date of a since or until value
+func filterDate(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC().Format(time.DateOnly), nil
+	}
+	if _, err := time.Parse(time.DateOnly, value); err != nil {
+		return "", fmt.Errorf("invalid %s date %q: use YYYY-MM-DD", field, value)
+	}
+	return value, nil
+}
+
+// Match reports whether ann passes every set field of the filter. With a
+// date bound set, annotations without a readable date don't match.
+func (f AnnotationFilter) Match(ann Annotation) bool {
+	if f.Tag != "" && !ann.HasTag(f.Tag) {
+		return false
+	}
+	if f.Author != "" && !strings.EqualFold(f.Author, ann.Author) {
+		return false
+	}
+	if f.Since != "" || f.Until != "" {
+		date := annotationDate(ann)
+		if date == "" || (f.Since != "" && date < f.Since) || (f.Until != "" && date > f.Until) {
+			return false
+		}
+	}
+	if f.Contains != "" && !strings.Contains(strings.ToLower(ann.Text), strings.ToLower(f.Contains)) {
+		return false
+	}
+	return true
+}
+
+// Apply returns the annotations matching the filter
+func (f AnnotationFilter) Apply(annotations []Annotation) []Annotation {
+	if f == (AnnotationFilter{}) {
+		return annotations
+	}
+	filtered := []Annotation{}
+	for _, ann := range annotations {
+		if f.Match(ann) {
+			filtered = append(filtered, ann)
+		}
+	}
+	return filtered
+}
+
+// annotationDate returns the YYYY-MM-DD date of an annotation's timestamp,
+// which is a bare date in v2 files and RFC 3339 in older ones, or "" if it
+// has none
+func annotationDate(ann Annotation) string {
+	if len(ann.Timestamp) < len(time.DateOnly) {
+		return ""
+	}
+	date := ann.Timestamp[:len(time.DateOnly)]
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return ""
+	}
+	return date
+}
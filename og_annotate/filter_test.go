@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAnnotationFilter(t *testing.T) {
+	annotations := []Annotation{
+		{Line: 1, Author: "alice", Timestamp: "2024-01-10", Text: "Races on close", Tags: []string{"bug"}},
+		{Line: 2, Author: "Bob", Timestamp: "2024-01-15", Text: "Why not a mutex?"},
+		{Line: 3, Author: "alice", Timestamp: "2024-01-20T09:30:00Z", Text: "Fixed the RACE upstream"},
+		{Line: 4, Author: "alice", Timestamp: "", Text: "undated"},
+	}
+	tests := []struct {
+		name string
+		req  Request
+		want []int
+	}{
+		{"no filter", Request{}, []int{1, 2, 3, 4}},
+		{"author ignores case", Request{Author: "bob"}, []int{2}},
+		{"since", Request{Since: "2024-01-15"}, []int{2, 3}},
+		{"until", Request{Until: "2024-01-15"}, []int{1, 2}},
+		{"range from timestamps", Request{Since: "2024-01-11T00:00:00Z", Until: "2024-01-20T23:59:59Z"}, []int{2, 3}},
+		{"contains ignores case", Request{Contains: "race"}, []int{1, 3}},
+		{"all at once", Request{Author: "alice", Since: "2024-01-01", Contains: "race", Tag: "bug"}, []int{1}},
+	}
+	for _, tt := range tests {
+		filter, err := requestFilter(tt.req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []int
+		for _, ann := range filter.Apply(annotations) {
+			got = append(got, ann.Line)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: lines %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, req := range []Request{{Since: "last week"}, {Until: "2024-13-01"}, {Since: "2024-02-01", Until: "2024-01-01"}} {
+		if _, err := requestFilter(req); err == nil {
+			t.Errorf("requestFilter(%+v) accepted", req)
+		}
+	}
+}
+
+func TestReadAndListFiltered(t *testing.T) {
+	dir := t.TempDir()
+	for _, a := range []struct {
+		file, author, text string
+		line               int
+	}{
+		{"a.c", "alice", "check the lock", 1},
+		{"a.c", "bob", "looks fine", 2},
+		{"b.c", "alice", "another lock", 1},
+	} {
+		if err := SaveAnnotationV2(dir, "proj", a.file, a.line, a.author, a.text, "x\ny\n", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := handleRequest(Request{Action: "read", StoragePath: dir, Project: "proj", FilePath: "a.c", Author: "bob"})
+	if !resp.Success || len(resp.Annotations) != 1 || resp.Annotations[0].Author != "bob" {
+		t.Errorf("read by author: %+v", resp)
+	}
+	resp = handleRequest(Request{Action: "listAnnotatedFiles", StoragePath: dir, Project: "proj", Author: "alice", Contains: "LOCK"})
+	if !resp.Success || len(resp.Annotations) != 2 || resp.Total != 2 {
+		t.Errorf("list by author and text: %+v", resp)
+	}
+	resp = handleRequest(Request{Action: "listAnnotatedFiles", StoragePath: dir, Project: "proj", Until: "2000-01-01"})
+	if !resp.Success || len(resp.Annotations) != 0 {
+		t.Errorf("list until 2000: %+v", resp)
+	}
+	resp = handleRequest(Request{Action: "read", StoragePath: dir, Project: "proj", FilePath: "a.c", Since: "yesterday"})
+	if resp.Success || !strings.Contains(resp.Error, "invalid since date") {
+		t.Errorf("bad date: %+v", resp)
+	}
+}
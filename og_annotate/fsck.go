@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of problems fsck reports
+const (
+	fsckSyntax    = "syntax"    // Lines the parser would drop or misread
+	fsckDuplicate = "duplicate" // Repeated source lines, markers or annotations
+	fsckHash      = "hash"      // Header hash doesn't match the snapshot
+	fsckTimestamp = "timestamp" // Unparseable captured or annotation date
+	fsckSource    = "source"    // Header source doesn't match the file name
+	fsckFormat    = "format"    // Valid but not as the host writes it
+)
+
+// FsckIssue is one problem found in an annotation file
+type FsckIssue struct {
+	File    string `json:"file"`
+	Line    int    `json:"line,omitempty"` // Line within the annotation file
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// FsckSummary reports the result of checking a storage directory
+type FsckSummary struct {
+	Checked int         `json:"checked"`
+	Issues  []FsckIssue `json:"issues"`
+	// Repaired lists the files rewritten into canonical form
+	Repaired []string `json:"repaired,omitempty"`
+	// Unrepaired lists files with problems a rewrite can't fix without
+	// losing or guessing at data (syntax errors, bad dates, conflicting
+	// annotations on one line); they need editing by hand
+	Unrepaired []string `json:"unrepaired,omitempty"`
+}
+
+var (
+	fsckSourceLineRe = regexp.MustCompile(`^\s*(\d+)\|(.*)$`)
+	fsckLineMarkerRe = regexp.MustCompile(`^## Line (\d+)$`)
+	fsckHeaderRe     = regexp.MustCompile("^> \\*\\*@([^*]+)\\*\\* \\(([^)]+)\\)(?: \\[([^\\]]*)\\])?(?: on `([^`]+)`)?(?: \\^([0-9a-f]+))?:$")
+)
+
+// FsckStorage checks every v2 annotation file in storagePath. With repair,
+// files whose problems can be fixed safely are rewritten into the form the
+// host writes: identical duplicate annotations are dropped, repeated line
+// markers merged, and the hash recomputed from the snapshot.
+func FsckStorage(storagePath string, repair bool) (*FsckSummary, error) {
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	summary := &FsckSummary{Issues: []FsckIssue{}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".md") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		summary.Checked++
+		fullPath := filepath.Join(storagePath, name)
+
+		if v1, err := isV1File(fullPath); err != nil || v1 {
+			msg := "v1 annotation file; convert it with -migrate"
+			if err != nil {
+				msg = err.Error()
+			}
+			summary.Issues = append(summary.Issues, FsckIssue{File: name, Kind: fsckFormat, Message: msg})
+			continue
+		}
+
+		issues, safe, err := checkAnnotationFile(fullPath, name)
+		if err != nil {
+			return summary, err
+		}
+		canonical, err := canonicalAnnotationFile(fullPath)
+		if err != nil {
+			return summary, err
+		}
+		original, err := os.ReadFile(fullPath)
+		if err != nil {
+			return summary, err
+		}
+		if len(issues) == 0 && !bytes.Equal(original, canonical) {
+			issues = append(issues, FsckIssue{File: name, Kind: fsckFormat, Message: "not in canonical form"})
+		}
+		summary.Issues = append(summary.Issues, issues...)
+		if len(issues) == 0 || !repair {
+			continue
+		}
+		if !safe {
+			summary.Unrepaired = append(summary.Unrepaired, name)
+			continue
+		}
+		if !bytes.Equal(original, canonical) {
+			if err := replaceFile(fullPath, canonical); err != nil {
+				return summary, fmt.Errorf("failed to rewrite %s: %w", name, err)
+			}
+			refreshIndex(storagePath, name)
+		}
+		summary.Repaired = append(summary.Repaired, name)
+	}
+	return summary, nil
+}
+
+// checkAnnotationFile reports the problems in one v2 file. safe is false if
+// rewriting the file would lose or guess at content.
+func checkAnnotationFile(path, name string) (issues []FsckIssue, safe bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+
+	safe = true
+	report := func(line int, kind, format string, args ...interface{}) {
+		issues = append(issues, FsckIssue{File: name, Line: line, Kind: kind, Message: fmt.Sprintf(format, args...)})
+		// A rewrite can't know the intended source, date or syntax
+		if kind == fsckSyntax || kind == fsckTimestamp || kind == fsckSource {
+			safe = false
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanToken)
+
+	var header V2FileHeader
+	var sourceLines []string
+	state := "start" // start, frontmatter, body
+	inAnnotation := false
+	current := 0 // Source line annotations attach to
+	markers := make(map[int]bool)
+	type annotationKey struct {
+		line                                 int
+		author, date, tags, symbol, id, text string
+	}
+	seen := make(map[annotationKey]int)
+	annotated := make(map[int]int) // Source line -> file line of its first annotation without an ID
+	ids := make(map[string]int)    // ID -> file line of its annotation
+	var pendingKey *annotationKey
+	pendingAt := 0
+
+	flush := func() {
+		if pendingKey == nil {
+			return
+		}
+		if first, ok := seen[*pendingKey]; ok {
+			report(pendingAt, fsckDuplicate, "annotation repeats the one at line %d", first)
+		} else {
+			seen[*pendingKey] = pendingAt
+			if pendingKey.id != "" {
+				// Annotations with IDs may share a line, but not an ID
+				if first, ok := ids[pendingKey.id]; ok {
+					report(pendingAt, fsckDuplicate, "annotation ID %s repeated (first at line %d)", pendingKey.id, first)
+					safe = false
+				} else {
+					ids[pendingKey.id] = pendingAt
+				}
+			} else if first, ok := annotated[pendingKey.line]; ok {
+				report(pendingAt, fsckDuplicate, "second annotation on source line %d (first at line %d)", pendingKey.line, first)
+				safe = false
+			} else {
+				annotated[pendingKey.line] = pendingAt
+			}
+		}
+		pendingKey = nil
+	}
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := scanner.Text()
+
+		switch state {
+		case "start":
+			if line != "---" {
+				report(n, fsckSyntax, "missing front matter")
+				return issues, false, nil
+			}
+			state = "frontmatter"
+			continue
+		case "frontmatter":
+			if line == "---" {
+				state = "body"
+				continue
+			}
+			key, value, ok := strings.Cut(line, ":")
+			value = strings.TrimSpace(value)
+			switch {
+			case !ok:
+				report(n, fsckSyntax, "unrecognized front matter line %q", line)
+			case key == "source":
+				header.Source = value
+			case key == "hash":
+				header.Hash = value
+			case key == "captured":
+				header.Captured = value
+			default:
+				report(n, fsckSyntax, "unknown front matter key %q", key)
+			}
+			continue
+		}
+
+		switch {
+		case fsckSourceLineRe.MatchString(line):
+			flush()
+			inAnnotation = false
+			m := fsckSourceLineRe.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(m[1])
+			current = num
+			switch {
+			case num == len(sourceLines):
+				// The parser would keep both copies and shift every later line
+				report(n, fsckDuplicate, "source line %d repeated", num)
+				safe = false
+				continue
+			case num != len(sourceLines)+1:
+				report(n, fsckSyntax, "source line %d out of order (expected %d)", num, len(sourceLines)+1)
+			}
+			sourceLines = append(sourceLines, strings.TrimPrefix(m[2], " "))
+		case fsckLineMarkerRe.MatchString(line):
+			flush()
+			inAnnotation = false
+			num, _ := strconv.Atoi(fsckLineMarkerRe.FindStringSubmatch(line)[1])
+			if markers[num] {
+				report(n, fsckDuplicate, "line marker %d repeated", num)
+			}
+			markers[num] = true
+			current = num
+		case fsckHeaderRe.MatchString(line):
+			flush()
+			m := fsckHeaderRe.FindStringSubmatch(line)
+			if current == 0 {
+				report(n, fsckSyntax, "annotation before the first source line or marker")
+			}
+			if !validTimestamp(m[2]) {
+				report(n, fsckTimestamp, "unparseable date %q", m[2])
+			}
+			pendingKey = &annotationKey{line: current, author: m[1], date: m[2], tags: m[3], symbol: m[4], id: m[5]}
+			pendingAt = n
+			inAnnotation = true
+		case strings.HasPrefix(line, "> **@"):
+			flush()
+			report(n, fsckSyntax, "malformed annotation header")
+			inAnnotation = false
+		case line == ">" || strings.HasPrefix(line, "> "):
+			if !inAnnotation {
+				report(n, fsckSyntax, "quoted text outside an annotation")
+			} else if pendingKey != nil {
+				pendingKey.text += line + "\n"
+			}
+		case line == "":
+			// A blank line after the text ends an annotation
+			if pendingKey != nil && pendingKey.text != "" {
+				flush()
+				inAnnotation = false
+			}
+		default:
+			report(n, fsckSyntax, "unrecognized line")
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		report(n, fsckSyntax, "%v", err)
+	}
+	if state != "body" {
+		report(n, fsckSyntax, "unterminated front matter")
+	}
+
+	if header.Source == "" {
+		report(0, fsckSyntax, "front matter has no source")
+	} else if project, filePath, ok := decodeFilename(name); ok && header.Source != project+"/"+filePath {
+		report(0, fsckSource, "source %q does not match file name (%s/%s)", header.Source, project, filePath)
+	}
+	if header.Captured != "" && !validTimestamp(header.Captured) {
+		report(0, fsckTimestamp, "unparseable captured time %q", header.Captured)
+	}
+	if len(sourceLines) > 0 {
+		for line := range annotated {
+			if line > len(sourceLines) {
+				report(0, fsckSyntax, "annotation on line %d is past the end of the %d-line snapshot", line, len(sourceLines))
+			}
+		}
+		if header.Hash != "" && !snapshotMatchesHash(sourceLines, header.Hash) {
+			report(0, fsckHash, "hash %s does not match the source snapshot", header.Hash)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues, safe, nil
+}
+
+// validTimestamp reports whether s is a date or an RFC 3339 time
+func validTimestamp(s string) bool {
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, s)
+	return err == nil
+}
+
+// snapshotMatchesHash reports whether hash was computed from the snapshot,
+// with or without the final newline the stored lines no longer show
+func snapshotMatchesHash(sourceLines []string, hash string) bool {
+	content := strings.Join(sourceLines, "\n")
+	return computeSourceHash(content) == hash || computeSourceHash(content+"\n") == hash
+}
+
+// canonicalAnnotationFile renders a file as the host would write it, with
+// identical duplicate annotations dropped and the hash matching the snapshot
+func canonicalAnnotationFile(path string) ([]byte, error) {
+	header, annotations, sourceLines, err := parseV2File(path)
+	if err != nil {
+		return nil, err
+	}
+	var kept []Annotation
+	for _, ann := range annotations {
+		duplicate := false
+		for _, k := range kept {
+			if k.Line == ann.Line && k.Author == ann.Author && k.Timestamp == ann.Timestamp &&
+				k.Text == ann.Text && strings.Join(k.Tags, ",") == strings.Join(ann.Tags, ",") {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			kept = append(kept, ann)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].Line < kept[j].Line })
+	if len(sourceLines) > 0 && !snapshotMatchesHash(sourceLines, header.Hash) {
+		header.Hash = computeSourceHash(strings.Join(sourceLines, "\n") + "\n")
+	}
+
+	var buf bytes.Buffer
+	formatV2File(&buf, header, sourceLines, kept)
+	return buf.Bytes(), nil
+}
+
+// replaceFile writes data to path through a temporary file, so a reader never
+// sees a partial annotation file
+func replaceFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fsck-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// printFsckSummary writes a human-readable fsck report
+func printFsckSummary(w io.Writer, summary *FsckSummary) {
+	for _, issue := range summary.Issues {
+		location := issue.File
+		if issue.Line > 0 {
+			location += ":" + strconv.Itoa(issue.Line)
+		}
+		fmt.Fprintf(w, "%s: %s: %s\n", location, issue.Kind, issue.Message)
+	}
+	fmt.Fprintf(w, "Checked: %d, issues: %d\n", summary.Checked, len(summary.Issues))
+	if len(summary.Repaired) > 0 {
+		fmt.Fprintf(w, "Repaired: %d\n", len(summary.Repaired))
+		for _, name := range summary.Repaired {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+	if len(summary.Unrepaired) > 0 {
+		fmt.Fprintf(w, "Needs manual repair: %d\n", len(summary.Unrepaired))
+		for _, name := range summary.Unrepaired {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fsckFixture saves a two-annotation file and returns its path
+func fsckFixture(t *testing.T, storagePath, filePath string) string {
+	t.Helper()
+	source := "a\nb\nc\n"
+	if _, err := SaveTaggedAnnotation(storagePath, "proj", filePath, 2, "alice", "Check b.", []string{"bug"}, source, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveTaggedAnnotation(storagePath, "proj", filePath, 3, "bob", "Multi\nline.", nil, source, ""); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(storagePath, encodeFilename("proj", filePath))
+}
+
+// editFile applies a hand edit to an annotation file
+func editFile(t *testing.T, path, old, new string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), old) {
+		t.Fatalf("%s does not contain %q", path, old)
+	}
+	if err := os.WriteFile(path, []byte(strings.Replace(string(data), old, new, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func issueKinds(issues []FsckIssue, file string) []string {
+	var kinds []string
+	for _, issue := range issues {
+		if issue.File == file {
+			kinds = append(kinds, issue.Kind)
+		}
+	}
+	return kinds
+}
+
+func TestFsckCleanStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	fsckFixture(t, tmpDir, "src/x.c")
+
+	summary, err := FsckStorage(tmpDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Checked != 1 || len(summary.Issues) != 0 {
+		t.Errorf("summary = %+v, want 1 file and no issues", summary)
+	}
+}
+
+func TestFsckReportsCorruption(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	dup := fsckFixture(t, tmpDir, "src/dup.c")
+	editFile(t, dup, "> **@bob**", "> **@bob** (2024-01-15):\n> Different note.\n\n> **@bob**")
+
+	hash := fsckFixture(t, tmpDir, "src/hash.c")
+	editFile(t, hash, "2| b\n", "2| b edited\n")
+
+	date := fsckFixture(t, tmpDir, "src/date.c")
+	editFile(t, date, "> **@bob** (", "> **@bob** (yesterday")
+
+	junk := fsckFixture(t, tmpDir, "src/junk.c")
+	editFile(t, junk, "3| c\n", "3| c\nstray text\n")
+
+	summary, err := FsckStorage(tmpDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Checked != 4 {
+		t.Errorf("checked = %d, want 4", summary.Checked)
+	}
+	tests := []struct {
+		file string
+		kind string
+	}{
+		{"proj__src__hash.c.md", fsckHash},
+		{"proj__src__date.c.md", fsckTimestamp},
+		{"proj__src__junk.c.md", fsckSyntax},
+	}
+	for _, tt := range tests {
+		kinds := issueKinds(summary.Issues, tt.file)
+		if len(kinds) != 1 || kinds[0] != tt.kind {
+			t.Errorf("%s issues = %v, want [%s]", tt.file, kinds, tt.kind)
+		}
+	}
+	if kinds := issueKinds(summary.Issues, "proj__src__dup.c.md"); len(kinds) == 0 {
+		t.Errorf("duplicate annotation not reported")
+	}
+	if len(summary.Repaired) != 0 {
+		t.Errorf("repaired %v without repair", summary.Repaired)
+	}
+}
+
+func TestFsckRepair(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	hash := fsckFixture(t, tmpDir, "src/hash.c")
+	editFile(t, hash, "hash: ", "hash: 000")
+	data, _ := os.ReadFile(hash)
+	// Repeat bob's annotation verbatim, as a bad merge would
+	block := string(data[strings.Index(string(data), "> **@bob**"):])
+	if err := os.WriteFile(hash, append(data, []byte("\n"+block)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	date := fsckFixture(t, tmpDir, "src/date.c")
+	editFile(t, date, "> **@bob** (", "> **@bob** (yesterday")
+	before, _ := os.ReadFile(date)
+
+	summary, err := FsckStorage(tmpDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Repaired) != 1 || summary.Repaired[0] != "proj__src__hash.c.md" {
+		t.Errorf("repaired = %v, want the hash file", summary.Repaired)
+	}
+	if len(summary.Unrepaired) != 1 || summary.Unrepaired[0] != "proj__src__date.c.md" {
+		t.Errorf("unrepaired = %v, want the date file", summary.Unrepaired)
+	}
+	if after, _ := os.ReadFile(date); string(after) != string(before) {
+		t.Errorf("unrepairable file was rewritten")
+	}
+
+	annotations, err := ReadAnnotationsV2(tmpDir, "proj", "src/hash.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(annotations) != 2 {
+		t.Errorf("got %d annotations after repair, want 2", len(annotations))
+	}
+
+	// The repaired file now checks clean
+	summary, err = FsckStorage(tmpDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kinds := issueKinds(summary.Issues, "proj__src__hash.c.md"); len(kinds) != 0 {
+		t.Errorf("repaired file still has issues: %v", summary.Issues)
+	}
+}
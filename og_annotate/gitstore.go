@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syncTimeout bounds a sync, which talks to the remote
+const syncTimeout = 60 * time.Second
+
+// fallbackGitIdentity is used for commits when git has no user configured,
+// so auto-commit works on machines that never set one up
+var fallbackGitIdentity = []string{"-c", "user.name=og_annotate", "-c", "user.email=og_annotate@localhost"}
+
+// SyncSummary reports the outcome of a sync action
+type SyncSummary struct {
+	Updated   []SyncFile `json:"updated,omitempty"`   // Files changed by others since the last sync
+	Conflicts []SyncFile `json:"conflicts,omitempty"` // Files both sides changed; the sync was rolled back
+	Pushed    bool       `json:"pushed"`
+}
+
+// SyncFile identifies an annotation file touched by a sync
+type SyncFile struct {
+	Project  string `json:"project,omitempty"`
+	FilePath string `json:"filePath,omitempty"`
+	File     string `json:"file"` // Name in the storage directory
+}
+
+// isGitStorage reports whether the storage directory is the root of a git
+// work tree, which turns on auto-commit and sync
+func isGitStorage(storagePath string) bool {
+	_, err := os.Stat(filepath.Join(storagePath, ".git"))
+	return err == nil
+}
+
+// runGit runs git in the storage directory and returns its trimmed stdout.
+// Errors include git's stderr, which says what went wrong.
+func runGit(ctx context.Context, storagePath string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", storagePath}, args...)...)
+	// Never prompt for credentials: there is no terminal behind Chrome
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, msg)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// commitArgs prefixes a commit command with the fallback identity when git
+// has none configured
+func commitArgs(ctx context.Context, storagePath string, args ...string) []string {
+	if _, err := runGit(ctx, storagePath, "config", "user.email"); err != nil {
+		return append(append([]string{}, fallbackGitIdentity...), args...)
+	}
+	return args
+}
+
+// commitAnnotationFile commits the current state of one annotation file,
+// including its removal, if the storage is a git repo. A file without changes
+// is not committed.
+func commitAnnotationFile(storagePath, filename, message string) error {
+	if !isGitStorage(storagePath) {
+		return nil
+	}
+	ctx := context.Background()
+	if _, err := runGit(ctx, storagePath, "add", "-A", "--", filename); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, storagePath, "diff", "--cached", "--quiet", "--", filename); err == nil {
+		return nil // Nothing staged
+	}
+	_, err := runGit(ctx, storagePath, commitArgs(ctx, storagePath, "commit", "-q", "-m", message, "--", filename)...)
+	return err
+}
+
+// autoCommit commits an annotation file after a change. Failures are logged
+// and never fail the request: the change is on disk and the next commit or
+// sync picks it up.
+func autoCommit(storagePath, project, filePath, message string) {
+	if err := commitAnnotationFile(storagePath, encodeFilename(project, filePath), message); err != nil {
+		log.Printf("auto-commit: %v", err)
+	}
+}
+
+// SyncStorage pulls annotations from the storage repo's upstream, rebasing
+// local commits on top, and pushes the result. If both sides changed the same
+// file, the rebase is aborted so the storage is left as it was, and the
+// conflicting files are reported for the caller to resolve by hand.
+func SyncStorage(storagePath string) (*SyncSummary, error) {
+	if !isGitStorage(storagePath) {
+		return nil, fmt.Errorf("storage path is not a git repository: %s", storagePath)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+
+	// Commit anything saved while auto-commit was failing
+	pending, err := uncommittedFiles(ctx, storagePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) > 0 {
+		if _, err := runGit(ctx, storagePath, append([]string{"add", "-A", "--"}, pending...)...); err != nil {
+			return nil, err
+		}
+		if _, err := runGit(ctx, storagePath, commitArgs(ctx, storagePath, "commit", "-q", "-m", "Update annotations")...); err != nil {
+			return nil, err
+		}
+	}
+
+	before, _ := runGit(ctx, storagePath, "rev-parse", "-q", "--verify", "@{upstream}")
+	summary := &SyncSummary{}
+	if _, pullErr := runGit(ctx, storagePath, commitArgs(ctx, storagePath, "pull", "-q", "--rebase", "--autostash")...); pullErr != nil {
+		conflicts, _ := runGit(ctx, storagePath, "diff", "--name-only", "--diff-filter=U")
+		if conflicts == "" {
+			return nil, pullErr
+		}
+		if _, err := runGit(ctx, storagePath, "rebase", "--abort"); err != nil {
+			return nil, fmt.Errorf("%v (and aborting the rebase failed: %v)", pullErr, err)
+		}
+		summary.Conflicts = syncFiles(conflicts)
+		return summary, fmt.Errorf("sync conflict in %d file(s); local changes were kept but not pushed", len(summary.Conflicts))
+	}
+
+	if before != "" {
+		if changed, err := runGit(ctx, storagePath, "diff", "--name-only", before, "@{upstream}"); err == nil {
+			summary.Updated = syncFiles(changed)
+		}
+	}
+
+	if _, err := runGit(ctx, storagePath, "push", "-q"); err != nil {
+		return summary, err
+	}
+	summary.Pushed = true
+	return summary, nil
+}
+
+// uncommittedFiles returns the annotation files in the top of the storage
+// directory that were changed, added or removed since the last commit. Edit
+// markers and the index are per host and never committed.
+func uncommittedFiles(ctx context.Context, storagePath string) ([]string, error) {
+	out, err := runGit(ctx, storagePath, "ls-files", "-z", "--modified", "--deleted", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".md") {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// syncFiles converts git's list of changed names into annotation files
+func syncFiles(names string) []SyncFile {
+	var files []SyncFile
+	for _, name := range strings.Split(names, "\n") {
+		if name == "" || strings.Contains(name, "/") || !strings.HasSuffix(name, ".md") {
+			continue
+		}
+		file := SyncFile{File: name}
+		if project, filePath, ok := decodeFilename(name); ok {
+			file.Project, file.FilePath = project, filePath
+		}
+		files = append(files, file)
+	}
+	return files
+}
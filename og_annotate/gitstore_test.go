@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupGitStorage creates a bare remote with a first commit and returns two
+// storage clones of it, as two hosts sharing annotations would have
+func setupGitStorage(t *testing.T) (a, b string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	// Keep the user's git config out of the tests
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(t.TempDir(), "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	root := t.TempDir()
+	remote := filepath.Join(root, "remote.git")
+	a = filepath.Join(root, "a")
+	b = filepath.Join(root, "b")
+	mustGit(t, root, "init", "-q", "--bare", remote)
+	mustGit(t, root, "clone", "-q", remote, a)
+	if err := SaveAnnotationV2(a, "proj", "main.c", 1, "alice", "first", "int main() {\n}\n", ""); err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, a, "add", encodeFilename("proj", "main.c"))
+	mustGit(t, a, append(fallbackGitIdentity, "commit", "-q", "-m", "Initial annotations")...)
+	mustGit(t, a, "push", "-q", "-u", "origin", "HEAD")
+	mustGit(t, root, "clone", "-q", remote, b)
+	return a, b
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(context.Background(), dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestAutoCommitOnSaveAndDelete(t *testing.T) {
+	a, _ := setupGitStorage(t)
+
+	resp := handleRequest(Request{Action: "save", StoragePath: a, Project: "proj", FilePath: "main.c", Line: 2, Author: "alice", Text: "closing brace", Source: "int main() {\n}\n"})
+	if !resp.Success {
+		t.Fatal(resp.Error)
+	}
+	if subject := mustGit(t, a, "log", "-1", "--format=%s"); subject != "Annotate proj/main.c:2 (@alice)" {
+		t.Errorf("last commit = %q", subject)
+	}
+
+	resp = handleRequest(Request{Action: "delete", StoragePath: a, Project: "proj", FilePath: "main.c", Line: 2})
+	if !resp.Success {
+		t.Fatal(resp.Error)
+	}
+	if subject := mustGit(t, a, "log", "-1", "--format=%s"); subject != "Delete annotation on proj/main.c:2" {
+		t.Errorf("last commit = %q", subject)
+	}
+	// The index and edit markers stay out of the repo
+	if status := mustGit(t, a, "status", "--porcelain"); strings.Contains(status, "main.c") {
+		t.Errorf("annotation file left uncommitted:\n%s", status)
+	}
+}
+
+func TestSyncStorage(t *testing.T) {
+	a, b := setupGitStorage(t)
+
+	if err := SaveAnnotationV2(a, "proj", "util.c", 4, "alice", "from a", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	autoCommit(a, "proj", "util.c", "Annotate proj/util.c:4")
+	if resp := handleRequest(Request{Action: "sync", StoragePath: a}); !resp.Success || !resp.Sync.Pushed {
+		t.Fatalf("sync a: %+v", resp)
+	}
+
+	// An uncommitted change in b is committed and pushed along the way
+	if err := SaveAnnotationV2(b, "proj", "other.c", 1, "bob", "from b", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	resp := handleRequest(Request{Action: "sync", StoragePath: b})
+	if !resp.Success || !resp.Sync.Pushed {
+		t.Fatalf("sync b: %+v", resp)
+	}
+	if len(resp.Sync.Updated) != 1 || resp.Sync.Updated[0].FilePath != "util.c" || resp.Sync.Updated[0].Project != "proj" {
+		t.Errorf("Updated = %+v", resp.Sync.Updated)
+	}
+	if anns, _ := ReadAnnotationsV2(b, "proj", "util.c"); len(anns) != 1 || anns[0].Text != "from a" {
+		t.Errorf("b did not receive a's annotation: %+v", anns)
+	}
+
+	if resp := handleRequest(Request{Action: "sync", StoragePath: a}); !resp.Success {
+		t.Fatalf("sync a again: %+v", resp)
+	}
+	if anns, _ := ReadAnnotationsV2(a, "proj", "other.c"); len(anns) != 1 || anns[0].Author != "bob" {
+		t.Errorf("a did not receive b's annotation: %+v", anns)
+	}
+}
+
+func TestSyncStorageConflict(t *testing.T) {
+	a, b := setupGitStorage(t)
+
+	for _, host := range []struct{ dir, text string }{{a, "a's view"}, {b, "b's view"}} {
+		if err := SaveAnnotationV2(host.dir, "proj", "main.c", 1, "alice", host.text, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		autoCommit(host.dir, "proj", "main.c", "Edit")
+	}
+	if resp := handleRequest(Request{Action: "sync", StoragePath: a}); !resp.Success {
+		t.Fatalf("sync a: %+v", resp)
+	}
+
+	head := mustGit(t, b, "rev-parse", "HEAD")
+	resp := handleRequest(Request{Action: "sync", StoragePath: b})
+	if resp.Success || resp.Sync == nil || resp.Sync.Pushed {
+		t.Fatalf("expected a conflict: %+v", resp)
+	}
+	if len(resp.Sync.Conflicts) != 1 || resp.Sync.Conflicts[0].FilePath != "main.c" {
+		t.Errorf("Conflicts = %+v", resp.Sync.Conflicts)
+	}
+	// The rebase was rolled back, keeping b's annotation
+	if got := mustGit(t, b, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved from %s to %s", head, got)
+	}
+	if anns, _ := ReadAnnotationsV2(b, "proj", "main.c"); len(anns) != 1 || anns[0].Text != "b's view" {
+		t.Errorf("b's annotation lost: %+v", anns)
+	}
+}
+
+func TestSyncRequiresGitStorage(t *testing.T) {
+	if resp := handleRequest(Request{Action: "sync", StoragePath: t.TempDir()}); resp.Success {
+		t.Error("expected an error for plain storage")
+	}
+}
@@ -1,3 +1,7 @@
 module github.com/alan/opengrok-navigator/og_annotate
 
 go 1.21
+
+require og v0.0.0
+
+replace og => ../og
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// hostConfigFileName is the host's optional config file in the user's home
+// directory. It is per user rather than in the shared storage directory so
+// that nobody else with write access to the storage can make it run commands.
+const hostConfigFileName = ".og_annotate.json"
+
+// defaultHookTimeout bounds a hook when its config sets no timeout
+const defaultHookTimeout = 5 * time.Second
+
+// HostConfig holds optional settings for the native host
+type HostConfig struct {
+	Hooks []Hook `json:"hooks,omitempty"`
+	// Server supplies the source for saves that arrive without it
+	Server *ServerConfig `json:"server,omitempty"`
+	// HTTPToken is the bearer token for -http mode
+	HTTPToken string `json:"http_token,omitempty"`
+	// Text limits the annotation text accepted by saves
+	Text *TextConfig `json:"text,omitempty"`
+	// StorageRoots limits requests to storage paths in these directories
+	// or below them ("~/" is the home directory); empty allows any path
+	StorageRoots []string `json:"storage_roots,omitempty"`
+}
+
+// Hook is notified when an annotation is saved or deleted. The event is
+// POSTed as JSON to URL, or written as JSON to Command's stdin (or both).
+type Hook struct {
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // Extra request headers for URL
+	Command []string          `json:"command,omitempty"` // Program and arguments, not run through a shell
+	// Events limits the hook to "save" and/or "delete"; empty means both
+	Events         []string `json:"events,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+}
+
+// AnnotationEvent is the payload sent to hooks
+type AnnotationEvent struct {
+	Event     string   `json:"event"` // "save" or "delete"
+	Project   string   `json:"project"`
+	FilePath  string   `json:"filePath"`
+	Line      int      `json:"line"`
+	ID        string   `json:"id,omitempty"`
+	Author    string   `json:"author"`
+	Text      string   `json:"text"`
+	Tags      []string `json:"tags,omitempty"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// getHostConfigPath is a variable that can be overridden in tests
+var getHostConfigPath = func() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, hostConfigFileName), nil
+}
+
+// hostConfig is loaded once at startup; nil means no config
+var hostConfig *HostConfig
+
+// loadHostConfig reads the host config file. A missing file is not an error.
+func loadHostConfig() (*HostConfig, error) {
+	path, err := getHostConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config HostConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// wants reports whether the hook is configured for an event
+func (h Hook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// timeout returns the hook's time limit
+func (h Hook) timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return defaultHookTimeout
+}
+
+// notifyHooks sends an event to every configured hook that wants it. Hooks run
+// before the response is sent, since Chrome may end the host right after it.
+// Failures are logged to stderr (Chrome's log) and never fail the request.
+func notifyHooks(config *HostConfig, event AnnotationEvent) {
+	if config == nil || len(config.Hooks) == 0 {
+		return
+	}
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("hook: failed to encode event: %v", err)
+		return
+	}
+
+	for _, hook := range config.Hooks {
+		if !hook.wants(event.Event) {
+			continue
+		}
+		if err := runHook(hook, payload); err != nil {
+			log.Printf("hook: %v", err)
+		}
+	}
+}
+
+// runHook delivers one payload to a hook's URL and command
+func runHook(hook Hook, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.timeout())
+	defer cancel()
+
+	if hook.URL != "" {
+		req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("invalid webhook URL: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range hook.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("webhook %s: %w", hook.URL, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s returned status %d", hook.URL, resp.StatusCode)
+		}
+	}
+
+	if len(hook.Command) > 0 {
+		cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+		cmd.Stdin = bytes.NewReader(payload)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("command %s: %v: %s", hook.Command[0], err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestLoadHostConfig(t *testing.T) {
+	oldPath := getHostConfigPath
+	defer func() { getHostConfigPath = oldPath }()
+	path := filepath.Join(t.TempDir(), hostConfigFileName)
+	getHostConfigPath = func() (string, error) { return path, nil }
+
+	config, err := loadHostConfig()
+	if err != nil || config != nil {
+		t.Fatalf("missing config: got %v, %v", config, err)
+	}
+
+	os.WriteFile(path, []byte(`{"hooks": [{"url": "http://example.com/hook", "events": ["save"], "timeout_seconds": 2}]}`), 0644)
+	config, err = loadHostConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Hooks) != 1 || config.Hooks[0].URL != "http://example.com/hook" || config.Hooks[0].timeout().Seconds() != 2 {
+		t.Errorf("config = %+v", config)
+	}
+
+	os.WriteFile(path, []byte(`{"hooks": [`), 0644)
+	if _, err := loadHostConfig(); err == nil {
+		t.Error("expected error for invalid config")
+	}
+}
+
+func TestHookWants(t *testing.T) {
+	all := Hook{}
+	if !all.wants("save") || !all.wants("delete") {
+		t.Error("hook without events should want everything")
+	}
+	saves := Hook{Events: []string{"save"}}
+	if !saves.wants("save") || saves.wants("delete") {
+		t.Error("save-only hook filtering is wrong")
+	}
+}
+
+// newHookServer records the events POSTed to it
+func newHookServer(t *testing.T) (*httptest.Server, func() []AnnotationEvent) {
+	t.Helper()
+	var mu sync.Mutex
+	var events []AnnotationEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("X-Token") != "secret" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		var event AnnotationEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("bad payload: %v", err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []AnnotationEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]AnnotationEvent(nil), events...)
+	}
+}
+
+func TestHooksFireOnSaveAndDelete(t *testing.T) {
+	server, received := newHookServer(t)
+
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = &HostConfig{Hooks: []Hook{{URL: server.URL, Headers: map[string]string{"X-Token": "secret"}}}}
+
+	storage := t.TempDir()
+	save := handleRequest(Request{
+		Action: "save", StoragePath: storage, Project: "proj", FilePath: "src/main.c",
+		Line: 2, Author: "alice", Text: "Check this", Source: "a\nb\nc\n",
+	})
+	if !save.Success {
+		t.Fatalf("save failed: %s", save.Error)
+	}
+	del := handleRequest(Request{Action: "delete", StoragePath: storage, Project: "proj", FilePath: "src/main.c", Line: 2})
+	if !del.Success {
+		t.Fatalf("delete failed: %s", del.Error)
+	}
+	// Deleting a line with no annotation does not notify
+	handleRequest(Request{Action: "delete", StoragePath: storage, Project: "proj", FilePath: "src/main.c", Line: 9})
+
+	events := received()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+	for i, want := range []string{"save", "delete"} {
+		e := events[i]
+		if e.Event != want || e.Project != "proj" || e.FilePath != "src/main.c" || e.Line != 2 || e.Author != "alice" || e.Text != "Check this" || e.Timestamp == "" {
+			t.Errorf("event %d = %+v", i, e)
+		}
+	}
+}
+
+func TestHookFailureDoesNotFailSave(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = &HostConfig{Hooks: []Hook{{URL: server.URL}}}
+
+	resp := handleRequest(Request{
+		Action: "save", StoragePath: t.TempDir(), Project: "proj", FilePath: "a.c",
+		Line: 1, Author: "bob", Text: "note", Source: "x\n",
+	})
+	if !resp.Success {
+		t.Errorf("save should succeed when a hook fails: %s", resp.Error)
+	}
+	if err := runHook(hostConfig.Hooks[0], []byte("{}")); err == nil {
+		t.Error("expected runHook to report the failing status")
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	out := filepath.Join(t.TempDir(), "event.json")
+	hook := Hook{Command: []string{"sh", "-c", `cat > "$0"`, out}, Events: []string{"save"}}
+
+	notifyHooks(&HostConfig{Hooks: []Hook{hook}}, AnnotationEvent{Event: "save", Project: "proj", FilePath: "a.c", Line: 3, Author: "carol", Text: "hi"})
+	notifyHooks(&HostConfig{Hooks: []Hook{hook}}, AnnotationEvent{Event: "delete", Project: "proj", FilePath: "b.c", Line: 1})
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event AnnotationEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("bad command input %q: %v", data, err)
+	}
+	// The delete event is filtered out, so the file holds the save
+	if event.Event != "save" || event.FilePath != "a.c" || event.Author != "carol" {
+		t.Errorf("command got %+v", event)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// maxMessageSize bounds a request, as Chrome bounds native messages
+const maxMessageSize = 1024 * 1024
+
+// httpTokenEnv names the environment variable holding the bridge token
+const httpTokenEnv = "OG_ANNOTATE_TOKEN"
+
+// httpBridge serves the native messaging actions as a local REST API:
+// POST /v1/<action> with the request's JSON fields as the body (which may
+// be empty, e.g. for ping) returns the same JSON response Chrome gets. Every
+// request needs "Authorization: Bearer <token>".
+type httpBridge struct {
+	token string
+	// storagePath is used for requests that don't name their own
+	storagePath string
+	// mu serializes requests; the actions assume one request at a time, as
+	// Chrome sends them
+	mu sync.Mutex
+}
+
+// httpStatus maps a response to a status code, so scripts can rely on
+// curl --fail
+func httpStatus(resp Response) int {
+	switch {
+	case resp.Success:
+		return http.StatusOK
+	case strings.HasPrefix(resp.Error, "Unknown action"):
+		return http.StatusNotFound
+	case strings.HasPrefix(resp.Error, "Missing required field"):
+		return http.StatusBadRequest
+	case resp.Code != "":
+		return http.StatusForbidden
+	}
+	return http.StatusUnprocessableEntity
+}
+
+func (b *httpBridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, resp Response) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}
+
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte(b.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		reply(http.StatusUnauthorized, Response{Success: false, Error: "Missing or invalid token"})
+		return
+	}
+	action, ok := strings.CutPrefix(r.URL.Path, "/v1/")
+	if !ok || action == "" || strings.Contains(action, "/") {
+		reply(http.StatusNotFound, Response{Success: false, Error: "Not found; use POST /v1/<action>"})
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(http.StatusMethodNotAllowed, Response{Success: false, Error: "Use POST"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize+1))
+	if err != nil {
+		reply(http.StatusBadRequest, Response{Success: false, Error: "Failed to read request: " + err.Error()})
+		return
+	}
+	if len(body) > maxMessageSize {
+		reply(http.StatusRequestEntityTooLarge, Response{Success: false, Error: "Message too large"})
+		return
+	}
+	var req Request
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			reply(http.StatusBadRequest, Response{Success: false, Error: "Failed to parse request: " + err.Error()})
+			return
+		}
+	}
+	req.Action = action
+	b.fillStoragePath(&req)
+
+	b.mu.Lock()
+	resp := handleRequest(req)
+	b.mu.Unlock()
+	reply(httpStatus(resp), resp)
+}
+
+// fillStoragePath applies the default storage path to a request and the
+// sub-requests of a batch
+func (b *httpBridge) fillStoragePath(req *Request) {
+	if req.StoragePath == "" {
+		req.StoragePath = b.storagePath
+	}
+	for i := range req.Requests {
+		b.fillStoragePath(&req.Requests[i])
+	}
+}
+
+// listenAddress binds a bare ":port" to the loopback interface; the bridge
+// is for local editors and scripts, not the network
+func listenAddress(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// resolveHTTPToken returns the bridge token from the flag, the environment
+// or the host config, in that order, or a new random one (generated is true)
+func resolveHTTPToken(flagToken string, config *HostConfig) (token string, generated bool, err error) {
+	switch {
+	case flagToken != "":
+		return flagToken, false, nil
+	case os.Getenv(httpTokenEnv) != "":
+		return os.Getenv(httpTokenEnv), false, nil
+	case config != nil && config.HTTPToken != "":
+		return config.HTTPToken, false, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", false, err
+	}
+	return hex.EncodeToString(buf), true, nil
+}
+
+// runHTTP handles the standalone -http flag: it serves the actions over HTTP
+// until killed, and returns the exit code if it can't start
+func runHTTP(args []string) int {
+	fs := flag.NewFlagSet("og_annotate", flag.ContinueOnError)
+	addr := fs.String("http", "", "Serve the actions as a REST API on `addr` (e.g. :7777, bound to localhost)")
+	token := fs.String("token", "", "Bearer token clients must send (default: $"+httpTokenEnv+", http_token in ~/"+hostConfigFileName+", or a random one)")
+	storagePath := fs.String("storage", "", "Storage path for requests that don't give one")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *addr == "" {
+		fmt.Fprintln(os.Stderr, "Usage: og_annotate -http <addr> [-token <token>] [-storage <storagePath>]")
+		return 2
+	}
+
+	setHostConfig(loadHostConfig())
+
+	bridgeToken, generated, err := resolveHTTPToken(*token, hostConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to generate token: %v\n", err)
+		return 1
+	}
+
+	listener, err := net.Listen("tcp", listenAddress(*addr))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	log.Printf("og_annotate: serving annotations on http://%s/v1/<action>", listener.Addr())
+	if generated {
+		log.Printf("og_annotate: token %s (set -token or %s to keep one across restarts)", bridgeToken, httpTokenEnv)
+	}
+
+	bridge := &httpBridge{token: bridgeToken, storagePath: *storagePath}
+	if err := http.Serve(listener, bridge); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bridgeRequest sends one request to the bridge and decodes its response
+func bridgeRequest(t *testing.T, url, method, token, body string) (int, Response) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded Response
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func TestHTTPBridge(t *testing.T) {
+	storage := t.TempDir()
+	server := httptest.NewServer(&httpBridge{token: "secret", storagePath: storage})
+	defer server.Close()
+
+	tests := []struct {
+		name, method, path, token, body string
+		status                          int
+	}{
+		{"no token", "POST", "/v1/ping", "", "", http.StatusUnauthorized},
+		{"wrong token", "POST", "/v1/ping", "guess", "", http.StatusUnauthorized},
+		{"ping", "POST", "/v1/ping", "secret", "", http.StatusOK},
+		{"GET", "GET", "/v1/ping", "secret", "", http.StatusMethodNotAllowed},
+		{"unknown action", "POST", "/v1/frobnicate", "secret", "{}", http.StatusNotFound},
+		{"outside /v1", "POST", "/ping", "secret", "", http.StatusNotFound},
+		{"missing fields", "POST", "/v1/read", "secret", `{"project": "proj"}`, http.StatusBadRequest},
+		{"bad JSON", "POST", "/v1/read", "secret", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		status, _ := bridgeRequest(t, server.URL+tt.path, tt.method, tt.token, tt.body)
+		if status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+	}
+
+	// Requests without a storage path use the bridge's
+	save := `{"project": "proj", "filePath": "src/x.c", "line": 2, "author": "alice", "text": "Check this.", "source": "a\nb\nc\n"}`
+	if status, resp := bridgeRequest(t, server.URL+"/v1/save", "POST", "secret", save); status != http.StatusOK || !resp.Success {
+		t.Fatalf("save: %d %+v", status, resp)
+	}
+	status, resp := bridgeRequest(t, server.URL+"/v1/read", "POST", "secret", `{"project": "proj", "filePath": "src/x.c"}`)
+	if status != http.StatusOK || len(resp.Annotations) != 1 || resp.Annotations[0].Text != "Check this." {
+		t.Errorf("read: %d %+v", status, resp)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	if got := listenAddress(":7777"); got != "127.0.0.1:7777" {
+		t.Errorf("listenAddress(:7777) = %q", got)
+	}
+	if got := listenAddress("0.0.0.0:7777"); got != "0.0.0.0:7777" {
+		t.Errorf("an explicit host should be kept, got %q", got)
+	}
+}
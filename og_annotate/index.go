@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// indexFileName caches a summary of every annotation file in the storage
+// directory, so listings don't have to parse thousands of files
+const indexFileName = ".index.json"
+
+// indexVersion is bumped when the index format changes; older indexes are
+// rebuilt
+const indexVersion = 1
+
+// FileSummary describes the annotations in one file without their text
+type FileSummary struct {
+	Project  string `json:"project"`
+	FilePath string `json:"filePath"`
+	Count    int    `json:"count"`
+	Lines    []int  `json:"lines"`
+}
+
+// indexEntry is a cached summary with the file state it was built from
+type indexEntry struct {
+	FileSummary
+	ModTime int64 `json:"modTime"` // UnixNano
+	Size    int64 `json:"size"`
+}
+
+// storageIndex maps annotation filenames to their summaries. It is only a
+// cache: entries are checked against the file's size and modification time
+// before use, since other hosts sharing the storage may change files without
+// updating it.
+type storageIndex struct {
+	Version int                   `json:"version"`
+	Files   map[string]indexEntry `json:"files"`
+
+	dirty bool
+}
+
+// loadIndex reads the storage index. A missing or unreadable index yields an
+// empty one, to be rebuilt as files are listed.
+func loadIndex(storagePath string) *storageIndex {
+	idx := &storageIndex{Version: indexVersion, Files: make(map[string]indexEntry)}
+	data, err := os.ReadFile(filepath.Join(storagePath, indexFileName))
+	if err != nil {
+		return idx
+	}
+	var stored storageIndex
+	if json.Unmarshal(data, &stored) != nil || stored.Version != indexVersion || stored.Files == nil {
+		idx.dirty = true
+		return idx
+	}
+	return &stored
+}
+
+// save writes the index if it changed. The file is replaced atomically so
+// concurrent readers never see a partial index.
+func (idx *storageIndex) save(storagePath string) error {
+	if !idx.dirty {
+		return nil
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(storagePath, indexFileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(storagePath, indexFileName)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	idx.dirty = false
+	return nil
+}
+
+// summary returns the summary of an annotation file, from the index if the
+// file is unchanged since it was indexed, otherwise by parsing it
+func (idx *storageIndex) summary(storagePath, filename string, info os.FileInfo) (FileSummary, error) {
+	entry, ok := idx.Files[filename]
+	if ok && entry.ModTime == info.ModTime().UnixNano() && entry.Size == info.Size() {
+		return entry.FileSummary, nil
+	}
+
+	project, filePath, _ := decodeFilename(filename)
+	_, annotations, _, err := parseV2File(filepath.Join(storagePath, filename))
+	if err != nil {
+		return FileSummary{}, err
+	}
+	summary := FileSummary{Project: project, FilePath: filePath, Count: len(annotations), Lines: []int{}}
+	for _, ann := range annotations {
+		// Notes sharing a line list it once; annotations are sorted by line
+		if n := len(summary.Lines); n == 0 || summary.Lines[n-1] != ann.Line {
+			summary.Lines = append(summary.Lines, ann.Line)
+		}
+	}
+	idx.Files[filename] = indexEntry{FileSummary: summary, ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+	idx.dirty = true
+	return summary, nil
+}
+
+// refreshIndex updates the index entry of one annotation file after it was
+// written or removed. Errors are ignored: listings repair a stale index.
+func refreshIndex(storagePath, filename string) {
+	idx := loadIndex(storagePath)
+	info, err := os.Stat(filepath.Join(storagePath, filename))
+	if err != nil {
+		if _, ok := idx.Files[filename]; ok {
+			delete(idx.Files, filename)
+			idx.dirty = true
+		}
+	} else {
+		idx.summary(storagePath, filename, info)
+	}
+	idx.save(storagePath)
+}
+
+// projectFiles returns the annotation filenames of a project, sorted
+func projectFiles(storagePath, project string) ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, err
+	}
+	var files []os.DirEntry
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".md") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if fileProject, _, ok := decodeFilename(name); ok && fileProject == project {
+			files = append(files, entry)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files, nil
+}
+
+// page returns the part of n items starting at offset, at most limit long
+// (0 for no limit)
+func page(n, offset, limit int) (start, end int) {
+	start = min(max(offset, 0), n)
+	end = n
+	if limit > 0 {
+		end = min(start+limit, n)
+	}
+	return start, end
+}
+
+// ListFileSummaries returns the annotated files of a project with their
+// annotation counts and lines, one page at a time, and the total number of
+// annotated files. Only the files on the page are examined, and unchanged
+// ones come from the index.
+func ListFileSummaries(storagePath, project string, offset, limit int) ([]FileSummary, int, error) {
+	files, err := projectFiles(storagePath, project)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []FileSummary{}, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	idx := loadIndex(storagePath)
+	start, end := page(len(files), offset, limit)
+	summaries := []FileSummary{}
+	for _, entry := range files[start:end] {
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since the directory was read
+		}
+		summary, err := idx.summary(storagePath, entry.Name(), info)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+	idx.save(storagePath)
+	return summaries, len(files), nil
+}
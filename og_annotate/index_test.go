@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListFileSummariesPaging(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		filePath := fmt.Sprintf("src/f%d.c", i)
+		for line := 1; line <= i+1; line++ {
+			if err := SaveAnnotationV2(dir, "proj", filePath, line, "alice", "note", "", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := SaveAnnotationV2(dir, "other", "src/f0.c", 1, "bob", "elsewhere", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	files, total, err := ListFileSummaries(dir, "proj", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(files) != 2 {
+		t.Fatalf("got %d files of %d, want 2 of 5", len(files), total)
+	}
+	want := FileSummary{Project: "proj", FilePath: "src/f1.c", Count: 2, Lines: []int{1, 2}}
+	if !reflect.DeepEqual(files[0], want) || files[1].FilePath != "src/f2.c" {
+		t.Errorf("unexpected page: %+v", files)
+	}
+
+	if files, _, _ := ListFileSummaries(dir, "proj", 10, 2); len(files) != 0 {
+		t.Errorf("offset past the end returned %+v", files)
+	}
+	if files, _, _ := ListFileSummaries(filepath.Join(dir, "missing"), "proj", 0, 0); files == nil || len(files) != 0 {
+		t.Errorf("missing directory returned %+v", files)
+	}
+
+	annotations, total, err := ListAnnotatedFilesPage(dir, "proj", 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(annotations) != 4 || annotations[0].FilePath != "src/f3.c" {
+		t.Errorf("ListAnnotatedFilesPage() = %d annotations of %d files: %+v", len(annotations), total, annotations)
+	}
+}
+
+func TestIndexUpdatedOnSaveAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAnnotationV2(dir, "proj", "a.c", 3, "alice", "note", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	filename := encodeFilename("proj", "a.c")
+	if entry, ok := loadIndex(dir).Files[filename]; !ok || entry.Count != 1 {
+		t.Fatalf("index not updated on save: %+v", loadIndex(dir).Files)
+	}
+
+	if err := DeleteAnnotationV2(dir, "proj", "a.c", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadIndex(dir).Files[filename]; ok {
+		t.Errorf("index still lists deleted file: %+v", loadIndex(dir).Files)
+	}
+}
+
+func TestIndexRepairsStaleEntries(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAnnotationV2(dir, "proj", "a.c", 3, "alice", "note", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another host adds an annotation without updating this index
+	other := t.TempDir()
+	for _, line := range []int{3, 9} {
+		if err := SaveAnnotationV2(other, "proj", "a.c", line, "bob", "note", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filename := encodeFilename("proj", "a.c")
+	data, err := os.ReadFile(filepath.Join(other, filename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _, err := ListFileSummaries(dir, "proj", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Count != 2 || !reflect.DeepEqual(files[0].Lines, []int{3, 9}) {
+		t.Errorf("stale index entry was used: %+v", files)
+	}
+
+	// A corrupt index is rebuilt rather than failing the listing
+	if err := os.WriteFile(filepath.Join(dir, indexFileName), []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if files, _, err := ListFileSummaries(dir, "proj", 0, 0); err != nil || len(files) != 1 {
+		t.Errorf("corrupt index: files=%+v err=%v", files, err)
+	}
+	if loadIndex(dir).dirty {
+		t.Error("expected the rebuilt index to be saved")
+	}
+}
+
+func TestHandleListFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, filePath := range []string{"a.c", "b.c", "c.c"} {
+		if err := SaveAnnotationV2(dir, "proj", filePath, 1, "alice", "note", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp := handleRequest(Request{Action: "listFiles", StoragePath: dir, Project: "proj", Limit: 2})
+	if !resp.Success || resp.Total != 3 || len(resp.Files) != 2 || resp.Files[0].FilePath != "a.c" {
+		t.Errorf("listFiles = %+v", resp)
+	}
+
+	resp = handleRequest(Request{Action: "listAnnotatedFiles", StoragePath: dir, Project: "proj", Offset: 2})
+	if !resp.Success || resp.Total != 3 || len(resp.Annotations) != 1 || resp.Annotations[0].FilePath != "c.c" {
+		t.Errorf("listAnnotatedFiles page = %+v", resp)
+	}
+
+	if resp := handleRequest(Request{Action: "listFiles", StoragePath: dir}); resp.Success {
+		t.Error("expected an error without a project")
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"sync"
+)
+
+// maxListWorkers bounds the goroutines parsing annotation files for one
+// listing; parsing is mostly disk reads, so more rarely helps
+const maxListWorkers = 8
+
+// defaultStreamPageSize is the number of files per message of a streamed
+// listAnnotatedFiles response when the request gives no limit
+const defaultStreamPageSize = 50
+
+// PageInfo places one message of a streamed listAnnotatedFiles response
+// within the full listing
+type PageInfo struct {
+	Offset int  `json:"offset"` // Index of the page's first file
+	Files  int  `json:"files"`  // Number of files on the page
+	Done   bool `json:"done"`   // Last message of the stream
+}
+
+// annotatedFilesPage is one page of files handed to a listing callback
+type annotatedFilesPage struct {
+	Annotations []Annotation
+	Info        PageInfo
+	Total       int
+}
+
+// streamAnnotatedFiles parses the files of a listing page (see
+// ListAnnotatedFilesPage) on a bounded pool of goroutines and calls send
+// with their annotations, in name order, every pageSize files (0 for a
+// single call) as soon as those files are parsed. Unreadable files are
+// skipped. send always gets at least one call, the last with Info.Done set;
+// an error from send stops the listing and is returned.
+func streamAnnotatedFiles(storagePath, project string, offset, limit, pageSize int, send func(annotatedFilesPage) error) error {
+	files, err := projectFiles(storagePath, project)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	total := len(files)
+	start, end := page(total, offset, limit)
+	files = files[start:end]
+	if pageSize <= 0 || pageSize > len(files) {
+		pageSize = len(files)
+	}
+
+	// Each file gets its own buffered result channel, so workers never wait
+	// on the reader and results are read back in order
+	results := make([]chan []Annotation, len(files))
+	jobs := make(chan int, len(files))
+	for i := range files {
+		results[i] = make(chan []Annotation, 1)
+		jobs <- i
+	}
+	close(jobs)
+
+	stop := make(chan struct{})
+	workers := min(runtime.NumCPU(), maxListWorkers, max(len(files), 1))
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, filePath, _ := decodeFilename(files[i].Name())
+				annotations, err := ReadAnnotationsV2(storagePath, project, filePath)
+				if err != nil {
+					annotations = nil
+				}
+				for j := range annotations {
+					annotations[j].FilePath = filePath
+				}
+				results[i] <- annotations
+			}
+		}()
+	}
+	// Stop the workers and let them finish before returning, so none
+	// outlives the listing
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	pg := annotatedFilesPage{Annotations: []Annotation{}, Info: PageInfo{Offset: start}, Total: total}
+	for i := range files {
+		pg.Annotations = append(pg.Annotations, <-results[i]...)
+		pg.Info.Files++
+		if pg.Info.Files < pageSize || i == len(files)-1 {
+			continue
+		}
+		if err := send(pg); err != nil {
+			return err
+		}
+		pg.Annotations = []Annotation{}
+		pg.Info = PageInfo{Offset: start + i + 1}
+	}
+	pg.Info.Done = true
+	return send(pg)
+}
+
+// handleStreamRequest answers a listAnnotatedFiles request with stream set
+// in several responses, one per limit files (defaultStreamPageSize if 0)
+// from offset to the end, sent as soon as their files are parsed, so that a
+// client can show the start of a big project while the rest is read. Each
+// response carries page; the last has page.done set, and a failure ends the
+// stream with an error response instead.
+func handleStreamRequest(req Request, send func(Response)) {
+	if err := checkRequestPaths(req, hostConfig); err != nil {
+		send(accessErrorResponse(err))
+		return
+	}
+	if req.StoragePath == "" || req.Project == "" {
+		send(Response{Success: false, Error: "Missing required fields: storagePath, project"})
+		return
+	}
+	filter, err := requestFilter(req)
+	if err != nil {
+		send(Response{Success: false, Error: err.Error()})
+		return
+	}
+	pageSize := req.Limit
+	if pageSize <= 0 {
+		pageSize = defaultStreamPageSize
+	}
+	err = streamAnnotatedFiles(req.StoragePath, req.Project, req.Offset, 0, pageSize, func(pg annotatedFilesPage) error {
+		info := pg.Info
+		send(Response{Success: true, Annotations: filter.Apply(pg.Annotations), Total: pg.Total, Page: &info})
+		return nil
+	})
+	if err != nil {
+		send(Response{Success: false, Error: err.Error()})
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// saveListingFiles annotates src/f00.c .. src/fNN.c, file i on lines 1..i%3+1
+func saveListingFiles(t *testing.T, dir string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		filePath := fmt.Sprintf("src/f%02d.c", i)
+		for line := 1; line <= i%3+1; line++ {
+			if err := SaveAnnotationV2(dir, "proj", filePath, line, "alice", "note", "", ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestStreamAnnotatedFilesInOrder(t *testing.T) {
+	dir := t.TempDir()
+	saveListingFiles(t, dir, 25)
+
+	var pages []PageInfo
+	var files []string
+	err := streamAnnotatedFiles(dir, "proj", 2, 0, 10, func(pg annotatedFilesPage) error {
+		if pg.Total != 25 {
+			t.Errorf("total = %d, want 25", pg.Total)
+		}
+		pages = append(pages, pg.Info)
+		for _, ann := range pg.Annotations {
+			if len(files) == 0 || files[len(files)-1] != ann.FilePath {
+				files = append(files, ann.FilePath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageInfo{{Offset: 2, Files: 10}, {Offset: 12, Files: 10}, {Offset: 22, Files: 3, Done: true}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %+v, want %+v", pages, want)
+	}
+	if len(files) != 23 || files[0] != "src/f02.c" || files[22] != "src/f24.c" {
+		t.Errorf("files out of order or missing: %v", files)
+	}
+	for i := 1; i < len(files); i++ {
+		if files[i-1] >= files[i] {
+			t.Fatalf("files out of order: %v", files)
+		}
+	}
+}
+
+func TestStreamAnnotatedFilesEmpty(t *testing.T) {
+	var pages []PageInfo
+	err := streamAnnotatedFiles(filepath.Join(t.TempDir(), "missing"), "proj", 0, 0, 10, func(pg annotatedFilesPage) error {
+		if pg.Annotations == nil || len(pg.Annotations) != 0 {
+			t.Errorf("annotations = %+v, want empty", pg.Annotations)
+		}
+		pages = append(pages, pg.Info)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []PageInfo{{Done: true}}; !reflect.DeepEqual(pages, want) {
+		t.Errorf("pages = %+v, want %+v", pages, want)
+	}
+}
+
+func TestStreamAnnotatedFilesStops(t *testing.T) {
+	dir := t.TempDir()
+	saveListingFiles(t, dir, 12)
+
+	stop := errors.New("stop")
+	calls := 0
+	err := streamAnnotatedFiles(dir, "proj", 0, 0, 5, func(pg annotatedFilesPage) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got %v after %d calls, want the callback's error after 1", err, calls)
+	}
+}
+
+func TestHandleStreamRequest(t *testing.T) {
+	dir := t.TempDir()
+	saveListingFiles(t, dir, 7)
+
+	var responses []Response
+	handleStreamRequest(Request{Action: "listAnnotatedFiles", StoragePath: dir, Project: "proj", Limit: 3, Stream: true}, func(resp Response) {
+		responses = append(responses, resp)
+	})
+	if len(responses) != 3 {
+		t.Fatalf("got %d responses, want 3: %+v", len(responses), responses)
+	}
+	count := 0
+	for i, resp := range responses {
+		if !resp.Success || resp.Page == nil || resp.Page.Done != (i == 2) || resp.Total != 7 {
+			t.Errorf("response %d = %+v", i, resp)
+		}
+		count += len(resp.Annotations)
+	}
+	// Files 0..6 carry 1, 2, 3, 1, 2, 3 and 1 annotations
+	if count != 13 {
+		t.Errorf("streamed %d annotations, want 13", count)
+	}
+
+	// The streamed and one-shot listings agree
+	all, _, err := ListAnnotatedFilesPage(dir, "proj", 0, 0)
+	if err != nil || len(all) != count {
+		t.Errorf("ListAnnotatedFilesPage() = %d annotations (%v), want %d", len(all), err, count)
+	}
+
+	responses = nil
+	handleStreamRequest(Request{Action: "listAnnotatedFiles", Stream: true}, func(resp Response) {
+		responses = append(responses, resp)
+	})
+	if len(responses) != 1 || responses[0].Success {
+		t.Errorf("missing fields: %+v", responses)
+	}
+}
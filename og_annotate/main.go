@@ -3,9 +3,13 @@ package main
 import (
 	"encoding/binary"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
+
+	"og/pkg/opengrok"
 )
 
 // Request represents an incoming message from Chrome
@@ -19,24 +23,105 @@ type Request struct {
 	Line    int      `json:"line,omitempty"`
 	Author  string   `json:"author,omitempty"`
 	Text    string   `json:"text,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
 	Context []string `json:"context,omitempty"` // 7 lines: 3 before + annotated + 3 after
-	Source  string   `json:"source,omitempty"`  // Full source code for v2 format
+	Source  string   `json:"source,omitempty"`  // Full source code for v2 format (and rebase)
+	// For save: anchor the annotation to this symbol's definition instead
+	// of a line (line, when given, picks between several definitions)
+	Symbol string `json:"symbol,omitempty"`
+	// For read: also return the stored source snapshot, to show notes
+	// against it when the live source has drifted
+	IncludeSnapshot bool `json:"includeSnapshot,omitempty"`
+	// For save and delete: the annotation to update or delete, when a line
+	// has several
+	ID string `json:"id,omitempty"`
+	// For read/listAnnotatedFiles: only return annotations with this tag,
+	// by Author, dated from Since to Until (YYYY-MM-DD, inclusive) and
+	// whose text contains Contains (see AnnotationFilter)
+	Tag      string `json:"tag,omitempty"`
+	Since    string `json:"since,omitempty"`
+	Until    string `json:"until,omitempty"`
+	Contains string `json:"contains,omitempty"`
+	// For listAnnotatedFiles/listFiles: page through files (limit 0 for all)
+	Offset int `json:"offset,omitempty"`
+	Limit  int `json:"limit,omitempty"`
+	// For listAnnotatedFiles over native messaging: send one response per
+	// page of limit files as they are parsed (see handleStreamRequest)
+	Stream bool `json:"stream,omitempty"`
+	// For permalink: the OpenGrok server linked to (default: the host
+	// config's), and for resolvePermalink: the link to resolve
+	ServerURL string `json:"serverUrl,omitempty"`
+	Permalink string `json:"permalink,omitempty"`
 	// For edit tracking
 	User string `json:"user,omitempty"`
+	// For migrate: optional local checkout used to capture full source
+	SourceRoot string `json:"sourceRoot,omitempty"`
+	// For fsck: rewrite files whose problems can be fixed safely
+	Repair bool `json:"repair,omitempty"`
+	// For merge: the other version of the stored file, and optionally the
+	// common ancestor of both (see MergeAnnotations)
+	MergeFrom string `json:"mergeFrom,omitempty"`
+	MergeBase string `json:"mergeBase,omitempty"`
+	// For batch: sub-requests executed in order
+	Requests []Request `json:"requests,omitempty"`
 }
 
 // Response represents an outgoing message to Chrome
 type Response struct {
-	Success     bool         `json:"success"`
-	Error       string       `json:"error,omitempty"`
-	Annotations []Annotation `json:"annotations,omitempty"`
-	Editing     []EditEntry  `json:"editing,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Code classifies a refused request (see checkRequestPaths)
+	Code        string            `json:"code,omitempty"`
+	Annotations []Annotation      `json:"annotations,omitempty"`
+	Snapshot    *SourceSnapshot   `json:"snapshot,omitempty"` // For read with includeSnapshot
+	Editing     []EditEntry       `json:"editing,omitempty"`
+	Migration   *MigrationSummary `json:"migration,omitempty"`
+	Rebase      *RebaseSummary    `json:"rebase,omitempty"`
+	Sync        *SyncSummary      `json:"sync,omitempty"`
+	Fsck        *FsckSummary      `json:"fsck,omitempty"`
+	Status      *StorageStatus    `json:"status,omitempty"`
+	Merge       *MergeSummary     `json:"merge,omitempty"`
+	// For listFiles, and total file count for listAnnotatedFiles
+	Files []FileSummary `json:"files,omitempty"`
+	Total int           `json:"total,omitempty"`
+	// For a streamed listAnnotatedFiles: where this message's files fall
+	Page *PageInfo `json:"page,omitempty"`
+	// For permalink and resolvePermalink (the link to the note's current
+	// line), and the project of the annotation resolvePermalink returns
+	Permalink string `json:"permalink,omitempty"`
+	Project   string `json:"project,omitempty"`
+	// For save: the saved annotation's ID and line (for a symbol anchor,
+	// the line its definition was found on)
+	ID   string `json:"id,omitempty"`
+	Line int    `json:"line,omitempty"`
+	// For batch: one response per sub-request, in the same order
+	Responses []Response `json:"responses,omitempty"`
 }
 
 func main() {
 	// Disable log timestamps for cleaner output
 	log.SetFlags(0)
 
+	// Standalone modes: og_annotate -migrate|-fsck <storagePath>, -merge
+	// <file> to merge versions of an annotation file (a git merge driver),
+	// or -http <addr> to serve the actions over HTTP. Chrome passes the
+	// extension origin as the first argument, so only treat the command line
+	// as flags when it explicitly starts with one of these.
+	if len(os.Args) > 1 && (os.Args[1] == "-migrate" || os.Args[1] == "--migrate") {
+		os.Exit(runMigrate(os.Args[1:]))
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "-fsck" || os.Args[1] == "--fsck") {
+		os.Exit(runFsck(os.Args[1:]))
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "-merge" || os.Args[1] == "--merge") {
+		os.Exit(runMerge(os.Args[1:]))
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "-http" || os.Args[1] == "--http") {
+		os.Exit(runHTTP(os.Args[1:]))
+	}
+
+	setHostConfig(loadHostConfig())
+
 	for {
 		// Read message length (4 bytes, little-endian)
 		var length uint32
@@ -49,7 +134,7 @@ func main() {
 		}
 
 		// Sanity check on length
-		if length > 1024*1024 {
+		if length > maxMessageSize {
 			sendError("Message too large")
 			continue
 		}
@@ -68,13 +153,20 @@ func main() {
 			continue
 		}
 
-		// Handle request
+		// Handle request; a streamed listing sends its own responses
+		if req.Stream && req.Action == "listAnnotatedFiles" {
+			handleStreamRequest(req, sendResponse)
+			continue
+		}
 		resp := handleRequest(req)
 		sendResponse(resp)
 	}
 }
 
 func handleRequest(req Request) Response {
+	if err := checkRequestPaths(req, hostConfig); err != nil {
+		return accessErrorResponse(err)
+	}
 	switch req.Action {
 	case "ping":
 		return Response{Success: true}
@@ -83,38 +175,128 @@ func handleRequest(req Request) Response {
 		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" {
 			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath"}
 		}
-		annotations, err := ReadAnnotations(req.StoragePath, req.Project, req.FilePath)
+		filter, err := requestFilter(req)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		var annotations []Annotation
+		var snapshot *SourceSnapshot
+		if req.IncludeSnapshot {
+			annotations, snapshot, err = ReadAnnotationsWithSnapshot(req.StoragePath, req.Project, req.FilePath)
+		} else {
+			annotations, err = ReadAnnotations(req.StoragePath, req.Project, req.FilePath)
+		}
 		if err != nil {
 			return Response{Success: false, Error: err.Error()}
 		}
-		return Response{Success: true, Annotations: annotations}
+		if req.Source != "" {
+			// The client's current source: place symbol-anchored notes on
+			// their definitions there, wherever the snapshot had them
+			current := splitSourceLines(req.Source)
+			annotations = anchorSymbols(annotations, current)
+			if snapshot != nil && snapshot.Hash != "" {
+				snapshot.Drifted = !snapshotMatchesHash(current, snapshot.Hash)
+			}
+		}
+		return Response{Success: true, Annotations: filter.Apply(annotations), Snapshot: snapshot}
 
 	case "save":
 		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" {
 			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath"}
 		}
-		if req.Line <= 0 || req.Author == "" || req.Text == "" {
-			return Response{Success: false, Error: "Missing required fields: line, author, text"}
+		if (req.Line <= 0 && req.Symbol == "" && req.ID == "") || req.Author == "" || req.Text == "" {
+			return Response{Success: false, Error: "Missing required fields: line (or symbol, or id), author, text"}
 		}
-		if req.Source == "" {
-			return Response{Success: false, Error: "Missing required field: source (full source code required)"}
+		tags, err := NormalizeTags(req.Tags)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
 		}
-		err := SaveAnnotationV2(req.StoragePath, req.Project, req.FilePath, req.Line, req.Author, req.Text, req.Source, "")
+		text, err := CheckAnnotationText(req.Text, hostConfig)
 		if err != nil {
 			return Response{Success: false, Error: err.Error()}
 		}
-		return Response{Success: true}
+		var saved Annotation
+		if req.ID != "" {
+			// An update of one note; the others on its line are untouched
+			saved, err = UpdateAnnotation(req.StoragePath, req.Project, req.FilePath, req.ID, req.Author, text, tags)
+		} else {
+			source := req.Source
+			if source == "" {
+				// Thin clients may leave fetching the source to the host
+				if source, err = fetchSource(hostConfig, req.Project, req.FilePath); err != nil {
+					return Response{Success: false, Error: err.Error()}
+				}
+			}
+			if req.Symbol != "" {
+				saved, err = SaveSymbolAnnotation(req.StoragePath, req.Project, req.FilePath, req.Symbol, req.Line, req.Author, text, tags, source)
+			} else {
+				saved, err = SaveTaggedAnnotation(req.StoragePath, req.Project, req.FilePath, req.Line, req.Author, text, tags, source, "")
+			}
+		}
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		autoCommit(req.StoragePath, req.Project, req.FilePath,
+			fmt.Sprintf("Annotate %s/%s:%d (@%s)", req.Project, req.FilePath, saved.Line, req.Author))
+		notifyHooks(hostConfig, AnnotationEvent{
+			Event:    "save",
+			Project:  req.Project,
+			FilePath: req.FilePath,
+			Line:     saved.Line,
+			ID:       saved.ID,
+			Author:   req.Author,
+			Text:     text,
+			Tags:     tags,
+		})
+		return Response{Success: true, ID: saved.ID, Line: saved.Line}
 
 	case "delete":
 		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" {
 			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath"}
 		}
-		if req.Line <= 0 {
-			return Response{Success: false, Error: "Missing required field: line"}
+		if req.Line <= 0 && req.ID == "" {
+			return Response{Success: false, Error: "Missing required field: line (or id)"}
 		}
-		err := DeleteAnnotation(req.StoragePath, req.Project, req.FilePath, req.Line)
-		if err != nil {
-			return Response{Success: false, Error: err.Error()}
+		var deleted *Annotation
+		if req.ID != "" {
+			ann, err := DeleteAnnotationByID(req.StoragePath, req.Project, req.FilePath, req.ID, req.Author)
+			if err != nil {
+				return Response{Success: false, Error: err.Error()}
+			}
+			deleted = &ann
+		} else {
+			// Look up the annotation first so hooks can report what was removed
+			if hostConfig != nil {
+				if existing, err := ReadAnnotations(req.StoragePath, req.Project, req.FilePath); err == nil {
+					for i := range existing {
+						if existing[i].Line == req.Line {
+							deleted = &existing[i]
+							break
+						}
+					}
+				}
+			}
+			if err := DeleteAnnotation(req.StoragePath, req.Project, req.FilePath, req.Line); err != nil {
+				return Response{Success: false, Error: err.Error()}
+			}
+		}
+		line := req.Line
+		if deleted != nil {
+			line = deleted.Line
+		}
+		autoCommit(req.StoragePath, req.Project, req.FilePath,
+			fmt.Sprintf("Delete annotation on %s/%s:%d", req.Project, req.FilePath, line))
+		if deleted != nil {
+			notifyHooks(hostConfig, AnnotationEvent{
+				Event:    "delete",
+				Project:  req.Project,
+				FilePath: req.FilePath,
+				Line:     line,
+				ID:       deleted.ID,
+				Author:   deleted.Author,
+				Text:     deleted.Text,
+				Tags:     deleted.Tags,
+			})
 		}
 		return Response{Success: true}
 
@@ -152,17 +334,224 @@ func handleRequest(req Request) Response {
 		if req.StoragePath == "" || req.Project == "" {
 			return Response{Success: false, Error: "Missing required fields: storagePath, project"}
 		}
-		annotations, err := ListAnnotatedFiles(req.StoragePath, req.Project)
+		filter, err := requestFilter(req)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		annotations, total, err := ListAnnotatedFilesPage(req.StoragePath, req.Project, req.Offset, req.Limit)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		return Response{Success: true, Annotations: filter.Apply(annotations), Total: total}
+
+	case "listFiles":
+		if req.StoragePath == "" || req.Project == "" {
+			return Response{Success: false, Error: "Missing required fields: storagePath, project"}
+		}
+		files, total, err := ListFileSummaries(req.StoragePath, req.Project, req.Offset, req.Limit)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		return Response{Success: true, Files: files, Total: total}
+
+	case "permalink":
+		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" || req.Line <= 0 {
+			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath, line"}
+		}
+		serverURL := permalinkServer(req.ServerURL)
+		if serverURL == "" {
+			return Response{Success: false, Error: "Missing required field: serverUrl (or a server in " + hostConfigFileName + ")"}
+		}
+		link, err := AnnotationPermalink(req.StoragePath, serverURL, req.Project, req.FilePath, req.Line, req.Author)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		return Response{Success: true, Permalink: link}
+
+	case "resolvePermalink":
+		if req.StoragePath == "" || req.Permalink == "" {
+			return Response{Success: false, Error: "Missing required fields: storagePath, permalink"}
+		}
+		ref, ann, err := ResolvePermalink(req.StoragePath, req.Permalink)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		// The link comes back updated, pointing at the note's current line
+		return Response{Success: true, Project: ref.Project, Annotations: []Annotation{ann}, Permalink: opengrok.AnnotationPermalink(ref)}
+
+	case "rebase":
+		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" {
+			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath"}
+		}
+		if req.Source == "" {
+			return Response{Success: false, Error: "Missing required field: source (new full source code required)"}
+		}
+		summary, err := RebaseAnnotations(req.StoragePath, req.Project, req.FilePath, req.Source)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		autoCommit(req.StoragePath, req.Project, req.FilePath,
+			fmt.Sprintf("Rebase annotations on %s/%s", req.Project, req.FilePath))
+		return Response{Success: true, Rebase: summary}
+
+	case "sync":
+		if req.StoragePath == "" {
+			return Response{Success: false, Error: "Missing required field: storagePath"}
+		}
+		summary, err := SyncStorage(req.StoragePath)
+		if err != nil {
+			return Response{Success: false, Error: err.Error(), Sync: summary}
+		}
+		return Response{Success: true, Sync: summary}
+
+	case "fsck":
+		if req.StoragePath == "" {
+			return Response{Success: false, Error: "Missing required field: storagePath"}
+		}
+		summary, err := FsckStorage(req.StoragePath, req.Repair)
+		if err != nil {
+			return Response{Success: false, Error: err.Error(), Fsck: summary}
+		}
+		for _, name := range summary.Repaired {
+			if project, filePath, ok := decodeFilename(name); ok {
+				autoCommit(req.StoragePath, project, filePath, "Repair annotations on "+project+"/"+filePath)
+			}
+		}
+		return Response{Success: true, Fsck: summary}
+
+	case "status":
+		if req.StoragePath == "" {
+			return Response{Success: false, Error: "Missing required field: storagePath"}
+		}
+		status, err := StorageStatusOf(req.StoragePath)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		return Response{Success: true, Status: status}
+
+	case "merge":
+		if req.StoragePath == "" || req.Project == "" || req.FilePath == "" || req.MergeFrom == "" {
+			return Response{Success: false, Error: "Missing required fields: storagePath, project, filePath, mergeFrom"}
+		}
+		summary, err := MergeIntoStorage(req.StoragePath, req.Project, req.FilePath, req.MergeFrom, req.MergeBase)
+		if err != nil {
+			return Response{Success: false, Error: err.Error()}
+		}
+		autoCommit(req.StoragePath, req.Project, req.FilePath,
+			fmt.Sprintf("Merge annotations on %s/%s", req.Project, req.FilePath))
+		return Response{Success: true, Merge: summary}
+
+	case "batch":
+		if len(req.Requests) == 0 {
+			return Response{Success: false, Error: "Missing required field: requests"}
+		}
+		// Sub-requests run in order; a failure is reported in its own response
+		// and does not stop the rest
+		responses := make([]Response, len(req.Requests))
+		for i, sub := range req.Requests {
+			if sub.Action == "batch" {
+				responses[i] = Response{Success: false, Error: "Nested batch requests are not supported"}
+				continue
+			}
+			responses[i] = handleRequest(sub)
+		}
+		return Response{Success: true, Responses: responses}
+
+	case "migrate":
+		if req.StoragePath == "" {
+			return Response{Success: false, Error: "Missing required field: storagePath"}
+		}
+		summary, err := MigrateStorage(req.StoragePath, req.SourceRoot)
 		if err != nil {
 			return Response{Success: false, Error: err.Error()}
 		}
-		return Response{Success: true, Annotations: annotations}
+		return Response{Success: len(summary.Failed) == 0, Migration: summary}
 
 	default:
 		return Response{Success: false, Error: "Unknown action: " + req.Action}
 	}
 }
 
+// runMigrate handles the standalone -migrate flag and returns the exit code
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("og_annotate", flag.ContinueOnError)
+	storagePath := fs.String("migrate", "", "Convert v1 annotation files in `storagePath` to v2 format")
+	sourceRoot := fs.String("source-root", "", "Local checkout root (`dir`/project/path) used to capture full source")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *storagePath == "" {
+		fmt.Fprintln(os.Stderr, "Usage: og_annotate -migrate <storagePath> [-source-root <dir>]")
+		return 2
+	}
+
+	summary, err := MigrateStorage(*storagePath, *sourceRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	printMigrationSummary(os.Stdout, summary)
+	if len(summary.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runFsck handles the standalone -fsck flag and returns the exit code: 1 if
+// problems remain after any repair
+func runFsck(args []string) int {
+	fs := flag.NewFlagSet("og_annotate", flag.ContinueOnError)
+	storagePath := fs.String("fsck", "", "Check the annotation files in `storagePath`")
+	repair := fs.Bool("repair", false, "Rewrite files whose problems can be fixed safely")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *storagePath == "" {
+		fmt.Fprintln(os.Stderr, "Usage: og_annotate -fsck <storagePath> [-repair]")
+		return 2
+	}
+
+	summary, err := FsckStorage(*storagePath, *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	printFsckSummary(os.Stdout, summary)
+	if len(summary.Issues) > 0 && (!*repair || len(summary.Unrepaired) > 0) {
+		return 1
+	}
+	return 0
+}
+
+// runMerge handles the standalone -merge flag and returns the exit code. The
+// merged file replaces ours unless -o is given, as git expects of a merge
+// driver.
+func runMerge(args []string) int {
+	fs := flag.NewFlagSet("og_annotate", flag.ContinueOnError)
+	ours := fs.String("merge", "", "Merge another version into the annotation file `ours`")
+	theirs := fs.String("theirs", "", "The other version of the annotation `file`")
+	base := fs.String("base", "", "Common ancestor `file` of both versions, to tell deletions from additions")
+	output := fs.String("o", "", "Write the merged file here instead of over ours")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *ours == "" || *theirs == "" {
+		fmt.Fprintln(os.Stderr, "Usage: og_annotate -merge <ours> -theirs <theirs> [-base <base>] [-o <file>]")
+		return 2
+	}
+	if *output == "" {
+		*output = *ours
+	}
+
+	summary, err := MergeAnnotationFiles(*base, *ours, *theirs, *output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	printMergeSummary(os.Stdout, summary)
+	return 0
+}
+
 func sendResponse(resp Response) {
 	data, err := json.Marshal(resp)
 	if err != nil {
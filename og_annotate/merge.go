@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MergeSummary reports how two versions of an annotation file were merged
+type MergeSummary struct {
+	Annotations int `json:"annotations"` // In the merged file
+	// Added counts annotations only the other version had
+	Added int `json:"added"`
+	// Removed counts annotations dropped because one version deleted or
+	// edited them since the common base
+	Removed int `json:"removed"`
+	// Threads lists the lines where both versions had different notes, now
+	// kept in one annotation with the latest first
+	Threads []int `json:"threads,omitempty"`
+	// Source is the version whose source snapshot was kept, "ours" or
+	// "theirs": the one captured last
+	Source string `json:"source"`
+	// SourceDiffers is set when the versions had different snapshots; the
+	// other version's line numbers may need a rebase
+	SourceDiffers bool `json:"sourceDiffers,omitempty"`
+}
+
+// annotationKey identifies an annotation by everything stored about it
+func annotationKey(ann Annotation) string {
+	return fmt.Sprintf("%d\x00%s\x00%s\x00%s", ann.Line, annotationHeader(ann), strings.Join(ann.Tags, ","), ann.Text)
+}
+
+// MergeAnnotations merges two versions of a file's annotations. base is
+// their common ancestor, nil when unknown: an annotation unchanged since base
+// on one side but gone from the other was deleted or edited there, and is
+// dropped. Otherwise the annotations of both sides are kept. Annotations
+// with an ID stay apart, whatever their line; where both sides edited the
+// same one, the latest version (ours on a tie) is kept. Where both have a
+// different note without an ID on a line, the latest (ours on a tie) wins
+// its author, date and tags and the others are appended to its text as a
+// thread (see threadText), so each line still has one such annotation.
+func MergeAnnotations(base, ours, theirs []Annotation) ([]Annotation, *MergeSummary) {
+	summary := &MergeSummary{}
+	keys := func(anns []Annotation) map[string]bool {
+		set := make(map[string]bool)
+		for _, ann := range anns {
+			set[annotationKey(ann)] = true
+		}
+		return set
+	}
+	baseKeys, oursKeys, theirsKeys := keys(base), keys(ours), keys(theirs)
+
+	byLine := make(map[int][]Annotation)
+	byID := make(map[string]Annotation)
+	removed := make(map[string]bool)
+	for _, ann := range append(append([]Annotation{}, ours...), theirs...) {
+		key := annotationKey(ann)
+		if baseKeys[key] && (!oursKeys[key] || !theirsKeys[key]) {
+			removed[key] = true
+			continue
+		}
+		if ann.ID != "" {
+			kept, ok := byID[ann.ID]
+			if !ok && !oursKeys[key] {
+				summary.Added++
+			}
+			if !ok || annotationDate(ann) > annotationDate(kept) {
+				byID[ann.ID] = ann
+			}
+			continue
+		}
+		duplicate := false
+		for _, other := range byLine[ann.Line] {
+			if annotationKey(other) == key {
+				duplicate = true
+				break
+			}
+		}
+		if duplicate {
+			continue
+		}
+		if !oursKeys[key] {
+			summary.Added++
+		}
+		byLine[ann.Line] = append(byLine[ann.Line], ann)
+	}
+	summary.Removed = len(removed)
+
+	lines := make([]int, 0, len(byLine))
+	for line := range byLine {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	merged := make([]Annotation, 0, len(lines)+len(byID))
+	for _, line := range lines {
+		anns := byLine[line]
+		if len(anns) > 1 {
+			summary.Threads = append(summary.Threads, line)
+		}
+		merged = append(merged, threadAnnotations(anns))
+	}
+	for _, ann := range byID {
+		merged = append(merged, ann)
+	}
+	// Notes sharing a line keep their order: threads first, then by date
+	sort.SliceStable(merged, func(i, j int) bool {
+		a, b := merged[i], merged[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if (a.ID == "") != (b.ID == "") {
+			return a.ID == ""
+		}
+		if annotationDate(a) != annotationDate(b) {
+			return annotationDate(a) < annotationDate(b)
+		}
+		return a.ID < b.ID
+	})
+	summary.Annotations = len(merged)
+	return merged, summary
+}
+
+// threadAnnotations combines the notes on one line into one annotation: the
+// latest note with the others' text appended after it, latest first
+func threadAnnotations(anns []Annotation) Annotation {
+	sort.SliceStable(anns, func(i, j int) bool {
+		return annotationDate(anns[i]) > annotationDate(anns[j])
+	})
+	thread := anns[0]
+	thread.Tags = append([]string(nil), thread.Tags...)
+	for _, ann := range anns[1:] {
+		for _, tag := range ann.Tags {
+			if !thread.HasTag(tag) {
+				thread.Tags = append(thread.Tags, tag)
+			}
+		}
+		// A note already in the thread, from an earlier merge, isn't repeated
+		if ann.Text != "" && ann.Text != thread.Text && !strings.Contains(thread.Text, threadText(ann)) {
+			thread.Text += "\n\n" + threadText(ann)
+		}
+	}
+	return thread
+}
+
+// threadText renders a note appended to another's text by a merge, under a
+// "@author (date):" line
+func threadText(ann Annotation) string {
+	return fmt.Sprintf("@%s (%s):\n%s", ann.Author, annotationDate(ann), ann.Text)
+}
+
+// readMergeVersion parses one version of an annotation file for a merge.
+// An empty path or empty file, as git passes for a missing base, is a
+// version without annotations.
+func readMergeVersion(path string) (V2FileHeader, []Annotation, []string, error) {
+	if path == "" {
+		return V2FileHeader{}, nil, nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return V2FileHeader{}, nil, nil, err
+	}
+	if info.Size() == 0 {
+		return V2FileHeader{}, nil, nil, nil
+	}
+	if v1, err := isV1File(path); err != nil {
+		return V2FileHeader{}, nil, nil, err
+	} else if v1 {
+		return V2FileHeader{}, nil, nil, fmt.Errorf("%s is a v1 annotation file; migrate it first", path)
+	}
+	return parseV2File(path)
+}
+
+// MergeAnnotationFiles merges the annotation files oursPath and theirsPath
+// (with their common ancestor basePath, "" if unknown; see MergeAnnotations)
+// into outPath. The snapshot of the version captured last is kept.
+func MergeAnnotationFiles(basePath, oursPath, theirsPath, outPath string) (*MergeSummary, error) {
+	_, base, _, err := readMergeVersion(basePath)
+	if err != nil {
+		return nil, err
+	}
+	oursHeader, ours, oursLines, err := readMergeVersion(oursPath)
+	if err != nil {
+		return nil, err
+	}
+	theirsHeader, theirs, theirsLines, err := readMergeVersion(theirsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, summary := MergeAnnotations(base, ours, theirs)
+	header, sourceLines := oursHeader, oursLines
+	summary.Source = "ours"
+	if oursHeader.Source == "" || theirsHeader.Captured > oursHeader.Captured {
+		header, sourceLines = theirsHeader, theirsLines
+		summary.Source = "theirs"
+	}
+	summary.SourceDiffers = oursHeader.Hash != "" && theirsHeader.Hash != "" && oursHeader.Hash != theirsHeader.Hash
+	if err := writeCheckedV2File(outPath, header, sourceLines, merged); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// MergeIntoStorage merges another version of a stored annotation file, such
+// as a sync tool's conflicted copy, into the stored one
+func MergeIntoStorage(storagePath, project, filePath, otherPath, basePath string) (*MergeSummary, error) {
+	filename := encodeFilename(project, filePath)
+	fullPath := filepath.Join(storagePath, filename)
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no annotations for %s/%s", project, filePath)
+	}
+	defer refreshIndex(storagePath, filename)
+	return MergeAnnotationFiles(basePath, fullPath, otherPath, fullPath)
+}
+
+// printMergeSummary prints the result of a command-line merge
+func printMergeSummary(w io.Writer, summary *MergeSummary) {
+	fmt.Fprintf(w, "Merged: %d annotations (%d added, %d removed)\n", summary.Annotations, summary.Added, summary.Removed)
+	if len(summary.Threads) > 0 {
+		fmt.Fprintf(w, "Threaded: %d lines\n", len(summary.Threads))
+	}
+	if summary.SourceDiffers {
+		fmt.Fprintf(w, "Source snapshots differ; kept %s (rebase if line numbers drifted)\n", summary.Source)
+	}
+}
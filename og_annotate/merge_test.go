@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeAnnotations(t *testing.T) {
+	ann := func(line int, author, date, text string, tags ...string) Annotation {
+		return Annotation{Line: line, Author: author, Timestamp: date, Text: text, Tags: tags}
+	}
+	base := []Annotation{
+		ann(1, "alice", "2024-01-01", "kept"),
+		ann(2, "alice", "2024-01-01", "deleted by theirs"),
+		ann(3, "alice", "2024-01-01", "edited by ours"),
+	}
+	ours := []Annotation{
+		ann(1, "alice", "2024-01-01", "kept"),
+		ann(2, "alice", "2024-01-01", "deleted by theirs"),
+		ann(3, "alice", "2024-02-01", "edited by ours, v2"),
+		ann(5, "alice", "2024-03-01", "ours wins", "bug"),
+		ann(7, "alice", "2024-03-01", "same day"),
+	}
+	theirs := []Annotation{
+		ann(1, "alice", "2024-01-01", "kept"),
+		ann(3, "alice", "2024-01-01", "edited by ours"),
+		ann(4, "bob", "2024-02-01", "only theirs"),
+		ann(5, "bob", "2024-02-15", "older note", "perf", "bug"),
+		ann(7, "bob", "2024-03-01", "tie"),
+	}
+
+	merged, summary := MergeAnnotations(base, ours, theirs)
+	var got []string
+	for _, a := range merged {
+		got = append(got, a.Author+": "+a.Text)
+	}
+	want := []string{
+		"alice: kept",
+		"alice: edited by ours, v2",
+		"bob: only theirs",
+		"alice: ours wins\n\n@bob (2024-02-15):\nolder note",
+		"alice: same day\n\n@bob (2024-03-01):\ntie",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+	if tags := merged[3].Tags; !reflect.DeepEqual(tags, []string{"bug", "perf"}) {
+		t.Errorf("thread tags = %v", tags)
+	}
+	if summary.Annotations != 5 || summary.Added != 3 || summary.Removed != 2 || !reflect.DeepEqual(summary.Threads, []int{5, 7}) {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// Without a base both sides are kept, and merging a merge again is stable
+	merged, _ = MergeAnnotations(nil, merged, theirs)
+	if len(merged) != 5 || merged[1].Text != "edited by ours, v2\n\n@alice (2024-01-01):\nedited by ours" {
+		t.Errorf("no base: %+v", merged)
+	}
+	if merged[3].Text != "ours wins\n\n@bob (2024-02-15):\nolder note" {
+		t.Errorf("re-merged thread = %q", merged[4].Text)
+	}
+}
+
+func TestMergeAnnotationsWithIDs(t *testing.T) {
+	ann := func(id string, line int, author, date, text string) Annotation {
+		return Annotation{ID: id, Line: line, Author: author, Timestamp: date, Text: text}
+	}
+	base := []Annotation{
+		ann("0001", 1, "alice", "2024-01-01", "edited by theirs"),
+		ann("0002", 1, "bob", "2024-01-01", "edited by both"),
+	}
+	ours := []Annotation{
+		ann("0001", 1, "alice", "2024-01-01", "edited by theirs"),
+		ann("0002", 1, "bob", "2024-03-01", "ours, later"),
+		ann("0003", 2, "alice", "2024-01-01", "only ours"),
+	}
+	theirs := []Annotation{
+		ann("0001", 1, "alice", "2024-02-01", "theirs"),
+		ann("0002", 1, "bob", "2024-02-01", "theirs, earlier"),
+		ann("0004", 2, "bob", "2024-02-01", "only theirs"),
+		ann("", 2, "carol", "2024-01-01", "no id"),
+	}
+
+	merged, summary := MergeAnnotations(base, ours, theirs)
+	var got []string
+	for _, a := range merged {
+		got = append(got, a.ID+" "+a.Text)
+	}
+	// Notes with IDs share lines instead of threading
+	want := []string{
+		"0001 theirs",
+		"0002 ours, later",
+		" no id",
+		"0003 only ours",
+		"0004 only theirs",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged = %q, want %q", got, want)
+	}
+	if summary.Annotations != 5 || summary.Added != 3 || summary.Removed != 1 || len(summary.Threads) != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestMergeAnnotationFiles(t *testing.T) {
+	dir := t.TempDir()
+	source := "int a;\nint b;\nint c;\n"
+	name := encodeFilename("proj", "a.c")
+	for _, s := range []struct {
+		storage string
+		line    int
+		author  string
+		text    string
+	}{
+		{"base", 2, "carol", "deleted by theirs"},
+		{"ours", 1, "alice", "from ours"},
+		{"theirs", 3, "bob", "from theirs"},
+	} {
+		if s.storage == "ours" {
+			// Ours starts from base, sharing its note and the note's ID
+			data, _ := os.ReadFile(filepath.Join(dir, "base", name))
+			os.MkdirAll(filepath.Join(dir, "ours"), 0755)
+			os.WriteFile(filepath.Join(dir, "ours", name), data, 0644)
+		}
+		if err := SaveAnnotationV2(filepath.Join(dir, s.storage), "proj", "a.c", s.line, s.author, s.text, source, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp := handleRequest(Request{
+		Action:      "merge",
+		StoragePath: filepath.Join(dir, "ours"),
+		Project:     "proj",
+		FilePath:    "a.c",
+		MergeFrom:   filepath.Join(dir, "theirs", name),
+		MergeBase:   filepath.Join(dir, "base", name),
+	})
+	if !resp.Success || resp.Merge == nil {
+		t.Fatalf("merge: %+v", resp)
+	}
+	if resp.Merge.Annotations != 2 || resp.Merge.Added != 1 || resp.Merge.Removed != 1 || resp.Merge.SourceDiffers {
+		t.Errorf("summary = %+v", resp.Merge)
+	}
+	anns, err := ReadAnnotations(filepath.Join(dir, "ours"), "proj", "a.c")
+	if err != nil || len(anns) != 2 || anns[0].Text != "from ours" || anns[1].Text != "from theirs" {
+		t.Errorf("merged file: %+v, %v", anns, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "ours", name))
+	if !strings.Contains(string(data), "1| int a;") {
+		t.Errorf("source snapshot lost:\n%s", data)
+	}
+
+	// Command line, as a git merge driver with an empty base
+	empty := filepath.Join(dir, "empty.md")
+	os.WriteFile(empty, nil, 0644)
+	out := filepath.Join(dir, "out.md")
+	if code := runMerge([]string{"-merge", filepath.Join(dir, "ours", name), "-base", empty, "-theirs", filepath.Join(dir, "theirs", name), "-o", out}); code != 0 {
+		t.Fatalf("runMerge exit %d", code)
+	}
+	if _, anns, _, err := parseV2File(out); err != nil || len(anns) != 2 {
+		t.Errorf("driver output: %+v, %v", anns, err)
+	}
+
+	resp = handleRequest(Request{Action: "merge", StoragePath: dir, Project: "proj", FilePath: "missing.c", MergeFrom: empty})
+	if resp.Success {
+		t.Errorf("merge into a missing file succeeded")
+	}
+}
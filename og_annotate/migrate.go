@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationBackupDir is the directory (inside storagePath) where original v1
+// files are moved before being rewritten in v2 format
+const migrationBackupDir = ".v1-backup"
+
+// MigrationSummary reports the outcome of a v1 → v2 storage migration
+type MigrationSummary struct {
+	Migrated       []string          `json:"migrated,omitempty"`  // Files converted to v2
+	SourceCaptured int               `json:"sourceCaptured"`      // Migrated files that embed full source
+	Skipped        int               `json:"skipped"`             // Files already in v2 format
+	Failed         map[string]string `json:"failed,omitempty"`    // Filename -> error message
+	BackupDir      string            `json:"backupDir,omitempty"` // Where v1 originals were moved
+}
+
+// isV1File reports whether the annotation file uses the legacy v1 format.
+// v1 files start with "# project/path"; v2 files start with "---" frontmatter.
+func isV1File(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanToken)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		return strings.HasPrefix(line, "# "), nil
+	}
+	return false, scanner.Err()
+}
+
+// parseV1File parses a legacy v1 annotation file.
+// Returns the "project/path" source from the title line and the annotations,
+// each carrying the context lines that were stored alongside it.
+func parseV1File(path string) (source string, annotations []Annotation, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxScanToken)
+
+	// Format: ## Line 42 - alice - 2024-01-15T10:30:00Z
+	entryRe := regexp.MustCompile(`^## Line (\d+) - (.+) - (\S+)$`)
+
+	var current *Annotation
+	var textLines []string
+	section := ""
+
+	flush := func() {
+		if current != nil {
+			current.Text = strings.TrimSpace(strings.Join(textLines, "\n"))
+			annotations = append(annotations, *current)
+		}
+		current = nil
+		textLines = nil
+		section = ""
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if source == "" && current == nil && strings.HasPrefix(line, "# ") {
+			source = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			continue
+		}
+
+		if matches := entryRe.FindStringSubmatch(line); matches != nil {
+			flush()
+			lineNum, _ := strconv.Atoi(matches[1])
+			current = &Annotation{
+				Line:      lineNum,
+				Author:    matches[2],
+				Timestamp: matches[3],
+			}
+			continue
+		}
+
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case line == "### Context":
+			section = "context"
+		case line == "### Annotation":
+			section = "annotation"
+		case line == "---" && section == "annotation":
+			flush()
+		case section == "context" || section == "context-body":
+			if strings.HasPrefix(line, "```") {
+				if section == "context" {
+					section = "context-body"
+				} else {
+					section = ""
+				}
+				continue
+			}
+			if section == "context-body" {
+				current.Context = append(current.Context, strings.TrimPrefix(line, ">>> "))
+			}
+		case section == "annotation":
+			textLines = append(textLines, line)
+		}
+	}
+	flush()
+
+	return source, annotations, scanner.Err()
+}
+
+// MigrateStorage converts every v1 annotation file in storagePath to v2 format.
+// Originals are moved to storagePath/.v1-backup before being rewritten.
+// If sourceRoot is set and contains a checkout at sourceRoot/project/path, the
+// full source is captured into the v2 file; otherwise annotations are written
+// with line markers only (same as a v2 save without source).
+func MigrateStorage(storagePath, sourceRoot string) (*MigrationSummary, error) {
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	summary := &MigrationSummary{Failed: make(map[string]string)}
+	backupDir := filepath.Join(storagePath, migrationBackupDir)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".md") || name == ".editing.md" {
+			continue
+		}
+
+		fullPath := filepath.Join(storagePath, name)
+		v1, err := isV1File(fullPath)
+		if err != nil {
+			summary.Failed[name] = err.Error()
+			continue
+		}
+		if !v1 {
+			summary.Skipped++
+			continue
+		}
+
+		captured, err := migrateV1File(storagePath, backupDir, name, sourceRoot)
+		if err != nil {
+			summary.Failed[name] = err.Error()
+			continue
+		}
+		summary.Migrated = append(summary.Migrated, name)
+		summary.BackupDir = backupDir
+		if captured {
+			summary.SourceCaptured++
+		}
+	}
+
+	sort.Strings(summary.Migrated)
+	return summary, nil
+}
+
+// migrateV1File converts a single v1 file in place, returning true if the full
+// source was captured. On write failure the original file is restored.
+func migrateV1File(storagePath, backupDir, name, sourceRoot string) (bool, error) {
+	fullPath := filepath.Join(storagePath, name)
+
+	source, annotations, err := parseV1File(fullPath)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse v1 file: %w", err)
+	}
+
+	project, filePath, ok := splitSource(source)
+	if !ok {
+		project, filePath, ok = decodeFilename(name)
+		if !ok {
+			return false, fmt.Errorf("cannot determine source path")
+		}
+	}
+
+	header := V2FileHeader{
+		Source: fmt.Sprintf("%s/%s", project, filePath),
+	}
+	for _, ann := range annotations {
+		if ann.Timestamp > header.Captured {
+			header.Captured = ann.Timestamp
+		}
+	}
+
+	var sourceLines []string
+	if sourceRoot != "" {
+		if data, err := os.ReadFile(filepath.Join(sourceRoot, project, filepath.FromSlash(filePath))); err == nil {
+			content := string(data)
+			header.Hash = computeSourceHash(content)
+			sourceLines = strings.Split(content, "\n")
+			if len(sourceLines) > 0 && sourceLines[len(sourceLines)-1] == "" {
+				sourceLines = sourceLines[:len(sourceLines)-1]
+			}
+		}
+	}
+
+	// Context is not part of the v2 format
+	for i := range annotations {
+		annotations[i].Context = nil
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Line < annotations[j].Line
+	})
+
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backupPath := filepath.Join(backupDir, name)
+	if _, err := os.Stat(backupPath); err == nil {
+		return false, fmt.Errorf("backup already exists: %s", backupPath)
+	}
+	if err := os.Rename(fullPath, backupPath); err != nil {
+		return false, fmt.Errorf("failed to back up original: %w", err)
+	}
+
+	if err := writeV2File(fullPath, header, sourceLines, annotations); err != nil {
+		os.Remove(fullPath)
+		os.Rename(backupPath, fullPath)
+		return false, fmt.Errorf("failed to write v2 file: %w", err)
+	}
+
+	return len(sourceLines) > 0, nil
+}
+
+// splitSource splits a "project/path" source string into its parts
+func splitSource(source string) (project, filePath string, ok bool) {
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// printMigrationSummary writes a human-readable migration report
+func printMigrationSummary(w io.Writer, summary *MigrationSummary) {
+	fmt.Fprintf(w, "Migrated: %d (with source: %d)\n", len(summary.Migrated), summary.SourceCaptured)
+	for _, name := range summary.Migrated {
+		fmt.Fprintf(w, "  %s\n", name)
+	}
+	fmt.Fprintf(w, "Already v2: %d\n", summary.Skipped)
+	if len(summary.Failed) > 0 {
+		fmt.Fprintf(w, "Failed: %d\n", len(summary.Failed))
+		names := make([]string, 0, len(summary.Failed))
+		for name := range summary.Failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %s: %s\n", name, summary.Failed[name])
+		}
+	}
+	if summary.BackupDir != "" {
+		fmt.Fprintf(w, "Originals backed up to: %s\n", summary.BackupDir)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleV1File = "# myproject/src/App.java\n" +
+	"\n" +
+	"## Line 3 - alice - 2024-01-15T10:30:00Z\n" +
+	"\n" +
+	"### Context\n" +
+	"```\n" +
+	"    line two\n" +
+	">>> line three\n" +
+	"    line four\n" +
+	"```\n" +
+	"\n" +
+	"### Annotation\n" +
+	"Needs refactoring.\n" +
+	"Split into two.\n" +
+	"\n" +
+	"---\n" +
+	"\n" +
+	"## Line 1 - bob - 2024-01-14T15:45:00Z\n" +
+	"\n" +
+	"### Context\n" +
+	"```\n" +
+	">>> line one\n" +
+	"```\n" +
+	"\n" +
+	"### Annotation\n" +
+	"Header comment.\n" +
+	"\n" +
+	"---\n"
+
+func TestParseV1File(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "myproject__src__App.java.md")
+	if err := os.WriteFile(path, []byte(sampleV1File), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source, annotations, err := parseV1File(path)
+	if err != nil {
+		t.Fatalf("parseV1File failed: %v", err)
+	}
+	if source != "myproject/src/App.java" {
+		t.Errorf("source: got %q", source)
+	}
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(annotations))
+	}
+	if annotations[0].Line != 3 || annotations[0].Author != "alice" {
+		t.Errorf("first annotation: got line %d author %q", annotations[0].Line, annotations[0].Author)
+	}
+	if annotations[0].Text != "Needs refactoring.\nSplit into two." {
+		t.Errorf("text: got %q", annotations[0].Text)
+	}
+	if len(annotations[0].Context) != 3 || annotations[0].Context[1] != "line three" {
+		t.Errorf("context: got %q", annotations[0].Context)
+	}
+}
+
+func TestMigrateStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	v1Name := "myproject__src__App.java.md"
+	if err := os.WriteFile(filepath.Join(tmpDir, v1Name), []byte(sampleV1File), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An existing v2 file must be left untouched
+	if err := SaveAnnotationV2(tmpDir, "myproject", "other.go", 2, "carol", "v2 note", mockSourceContent(5), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := MigrateStorage(tmpDir, "")
+	if err != nil {
+		t.Fatalf("MigrateStorage failed: %v", err)
+	}
+	if len(summary.Migrated) != 1 || summary.Migrated[0] != v1Name {
+		t.Errorf("migrated: got %v", summary.Migrated)
+	}
+	if summary.Skipped != 1 {
+		t.Errorf("skipped: got %d, want 1", summary.Skipped)
+	}
+	if summary.SourceCaptured != 0 {
+		t.Errorf("sourceCaptured: got %d, want 0", summary.SourceCaptured)
+	}
+
+	// Original is backed up
+	backup, err := os.ReadFile(filepath.Join(tmpDir, migrationBackupDir, v1Name))
+	if err != nil {
+		t.Fatalf("backup missing: %v", err)
+	}
+	if string(backup) != sampleV1File {
+		t.Error("backup content differs from original")
+	}
+
+	// Migrated file reads back through the v2 reader
+	annotations, err := ReadAnnotations(tmpDir, "myproject", "src/App.java")
+	if err != nil {
+		t.Fatalf("ReadAnnotations failed: %v", err)
+	}
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(annotations))
+	}
+	if annotations[0].Line != 1 || annotations[1].Line != 3 {
+		t.Errorf("annotations not sorted by line: %d, %d", annotations[0].Line, annotations[1].Line)
+	}
+	if annotations[1].Text != "Needs refactoring.\nSplit into two." {
+		t.Errorf("text: got %q", annotations[1].Text)
+	}
+
+	// Running again is a no-op
+	summary, err = MigrateStorage(tmpDir, "")
+	if err != nil {
+		t.Fatalf("second MigrateStorage failed: %v", err)
+	}
+	if len(summary.Migrated) != 0 || summary.Skipped != 2 {
+		t.Errorf("second run: migrated %d, skipped %d", len(summary.Migrated), summary.Skipped)
+	}
+}
+
+func TestMigrateStorageCapturesSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	storage := filepath.Join(tmpDir, "annotations")
+	sourceRoot := filepath.Join(tmpDir, "src")
+	if err := os.MkdirAll(storage, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(storage, "myproject__src__App.java.md"), []byte(sampleV1File), 0644); err != nil {
+		t.Fatal(err)
+	}
+	srcFile := filepath.Join(sourceRoot, "myproject", "src", "App.java")
+	if err := os.MkdirAll(filepath.Dir(srcFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(srcFile, []byte("line one\nline two\nline three\nline four\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := MigrateStorage(storage, sourceRoot)
+	if err != nil {
+		t.Fatalf("MigrateStorage failed: %v", err)
+	}
+	if summary.SourceCaptured != 1 {
+		t.Errorf("sourceCaptured: got %d, want 1", summary.SourceCaptured)
+	}
+
+	header, annotations, sourceLines, err := parseV2File(filepath.Join(storage, "myproject__src__App.java.md"))
+	if err != nil {
+		t.Fatalf("parseV2File failed: %v", err)
+	}
+	if header.Hash == "" {
+		t.Error("expected source hash to be set")
+	}
+	if len(sourceLines) != 4 || sourceLines[2] != "line three" {
+		t.Errorf("source lines: got %q", sourceLines)
+	}
+	if len(annotations) != 2 {
+		t.Errorf("expected 2 annotations, got %d", len(annotations))
+	}
+}
+
+func TestHandleRequestMigrate(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "proj__file.go.md"), []byte(strings.Replace(sampleV1File, "myproject/src/App.java", "proj/file.go", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := handleRequest(Request{Action: "migrate", StoragePath: tmpDir})
+	if !resp.Success {
+		t.Fatalf("migrate failed: %s", resp.Error)
+	}
+	if resp.Migration == nil || len(resp.Migration.Migrated) != 1 {
+		t.Errorf("unexpected migration summary: %+v", resp.Migration)
+	}
+
+	resp = handleRequest(Request{Action: "migrate"})
+	if resp.Success {
+		t.Error("migrate without storagePath should fail")
+	}
+}
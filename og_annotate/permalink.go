@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"og/pkg/opengrok"
+)
+
+// permalinkServer returns the server permalinks point at: the request's, or
+// else the one in the host config
+func permalinkServer(serverURL string) string {
+	if serverURL == "" && hostConfig != nil && hostConfig.Server != nil {
+		serverURL = hostConfig.Server.URL
+	}
+	return strings.TrimSuffix(serverURL, "/")
+}
+
+// AnnotationPermalink returns a shareable link to the annotation on line of
+// a file (author's, if several authors annotated the line)
+func AnnotationPermalink(storagePath, serverURL, project, filePath string, line int, author string) (string, error) {
+	annotations, err := ReadAnnotationsV2(storagePath, project, filePath)
+	if err != nil {
+		return "", err
+	}
+	for _, ann := range annotations {
+		if ann.Line == line && (author == "" || ann.Author == author) {
+			return opengrok.AnnotationPermalink(opengrok.AnnotationRef{
+				ServerURL: serverURL,
+				Project:   project,
+				Path:      filePath,
+				Line:      ann.Line,
+				Author:    ann.Author,
+				Timestamp: ann.Timestamp,
+			}), nil
+		}
+	}
+	return "", fmt.Errorf("no annotation on %s/%s:%d", project, filePath, line)
+}
+
+// ResolvePermalink finds the annotation a permalink names, at its current
+// line. The note is matched by author and timestamp, so links survive
+// rebases; failing that, the author's note on the linked line is taken, as
+// an edit gives a note a new timestamp. The returned ref is updated to the
+// note's current line and timestamp.
+func ResolvePermalink(storagePath, link string) (opengrok.AnnotationRef, Annotation, error) {
+	ref, err := opengrok.ParseAnnotationPermalink(link)
+	if err != nil {
+		return ref, Annotation{}, err
+	}
+	filePath := strings.TrimPrefix(ref.Path, "/")
+	annotations, err := ReadAnnotationsV2(storagePath, ref.Project, filePath)
+	if err != nil {
+		return ref, Annotation{}, err
+	}
+
+	match := -1
+	for i, ann := range annotations {
+		if ann.Author == ref.Author && ann.Timestamp == ref.Timestamp {
+			match = i
+			break
+		}
+		if match < 0 && ann.Author == ref.Author && ann.Line == ref.Line {
+			match = i
+		}
+	}
+	if match < 0 {
+		return ref, Annotation{}, fmt.Errorf("annotation by %s on %s/%s:%d not found; it may have been deleted", ref.Author, ref.Project, filePath, ref.Line)
+	}
+	ann := annotations[match]
+	ann.FilePath = filePath
+	ref.Line, ref.Timestamp = ann.Line, ann.Timestamp
+	return ref, ann, nil
+}
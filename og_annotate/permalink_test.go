@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPermalinkSurvivesRebase(t *testing.T) {
+	dir := t.TempDir()
+	oldSource := "func a() {\n\tone()\n}\n"
+	if err := SaveAnnotationV2(dir, "proj", "src/x.go", 2, "alice", "calls one", oldSource, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := handleRequest(Request{Action: "permalink", StoragePath: dir, ServerURL: "https://og.example.com/source/", Project: "proj", FilePath: "src/x.go", Line: 2})
+	if !resp.Success || !strings.HasPrefix(resp.Permalink, "https://og.example.com/source/xref/proj/src/x.go?annotation=") || !strings.HasSuffix(resp.Permalink, "#2") {
+		t.Fatalf("permalink = %+v", resp)
+	}
+	link := resp.Permalink
+
+	// Two lines added at the top move the note to line 4
+	if _, err := RebaseAnnotations(dir, "proj", "src/x.go", "// Package x\n\n"+oldSource); err != nil {
+		t.Fatal(err)
+	}
+	resp = handleRequest(Request{Action: "resolvePermalink", StoragePath: dir, Permalink: link})
+	if !resp.Success || resp.Project != "proj" || len(resp.Annotations) != 1 {
+		t.Fatalf("resolvePermalink = %+v", resp)
+	}
+	if ann := resp.Annotations[0]; ann.Line != 4 || ann.FilePath != "src/x.go" || ann.Text != "calls one" {
+		t.Errorf("resolved %+v, want the note at line 4", ann)
+	}
+	if !strings.HasSuffix(resp.Permalink, "#4") {
+		t.Errorf("updated permalink = %q, want the current line", resp.Permalink)
+	}
+}
+
+func TestPermalinkErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAnnotationV2(dir, "proj", "a.c", 3, "alice", "note", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = nil
+
+	tests := []struct {
+		req  Request
+		want string
+	}{
+		{Request{Action: "permalink", StoragePath: dir, Project: "proj", FilePath: "a.c"}, "Missing required fields"},
+		{Request{Action: "permalink", StoragePath: dir, Project: "proj", FilePath: "a.c", Line: 3}, "Missing required field: serverUrl"},
+		{Request{Action: "permalink", StoragePath: dir, ServerURL: "https://x", Project: "proj", FilePath: "a.c", Line: 4}, "no annotation on proj/a.c:4"},
+		{Request{Action: "permalink", StoragePath: dir, ServerURL: "https://x", Project: "proj", FilePath: "a.c", Line: 3, Author: "bob"}, "no annotation on proj/a.c:3"},
+		{Request{Action: "resolvePermalink", StoragePath: dir}, "Missing required fields"},
+		{Request{Action: "resolvePermalink", StoragePath: dir, Permalink: "https://x/xref/proj/a.c#3"}, "no annotation parameter"},
+	}
+	for _, tt := range tests {
+		if resp := handleRequest(tt.req); resp.Success || !strings.Contains(resp.Error, tt.want) {
+			t.Errorf("%+v: got %+v, want error %q", tt.req, resp, tt.want)
+		}
+	}
+
+	// A deleted note no longer resolves
+	link := handleRequest(Request{Action: "permalink", StoragePath: dir, ServerURL: "https://x", Project: "proj", FilePath: "a.c", Line: 3}).Permalink
+	if err := DeleteAnnotationV2(dir, "proj", "a.c", 3); err != nil {
+		t.Fatal(err)
+	}
+	if resp := handleRequest(Request{Action: "resolvePermalink", StoragePath: dir, Permalink: link}); resp.Success || !strings.Contains(resp.Error, "may have been deleted") {
+		t.Errorf("deleted note: %+v", resp)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"og/pkg/linediff"
+)
+
+// RemappedAnnotation is an annotation whose line changed during a rebase.
+// Line holds the new line number and From the line it was attached to before.
+type RemappedAnnotation struct {
+	Annotation
+	From int `json:"from"`
+}
+
+// RebaseSummary reports how annotations were carried over to a new snapshot
+type RebaseSummary struct {
+	OldHash string `json:"oldHash"`
+	NewHash string `json:"newHash"`
+	// Moved annotations sit on a line that still exists, at a new number
+	Moved []RemappedAnnotation `json:"moved,omitempty"`
+	// Orphaned annotations were on lines that were changed or removed. They are
+	// kept, anchored to the nearest following line, so they can be reviewed.
+	Orphaned []RemappedAnnotation `json:"orphaned,omitempty"`
+	// Unchanged counts annotations whose line number stayed the same
+	Unchanged int `json:"unchanged"`
+	// NoBaseline is set when the stored file had no source snapshot to diff
+	// against; line numbers are kept as they were
+	NoBaseline bool `json:"noBaseline,omitempty"`
+}
+
+// RebaseAnnotations remaps a file's annotations onto new source content by
+// diffing it against the stored snapshot, then replaces the snapshot and hash
+func RebaseAnnotations(storagePath, project, filePath, sourceContent string) (*RebaseSummary, error) {
+	filename := encodeFilename(project, filePath)
+	fullPath := filepath.Join(storagePath, filename)
+	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("no annotations for %s/%s", project, filePath)
+	}
+	defer refreshIndex(storagePath, filename)
+
+	header, annotations, oldLines, err := parseV2File(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	newLines := strings.Split(sourceContent, "\n")
+	if len(newLines) > 0 && newLines[len(newLines)-1] == "" {
+		newLines = newLines[:len(newLines)-1]
+	}
+	if len(newLines) == 0 {
+		return nil, fmt.Errorf("new source is empty")
+	}
+
+	summary := &RebaseSummary{OldHash: header.Hash, NewHash: computeSourceHash(sourceContent)}
+
+	var lineMap []int
+	if len(oldLines) > 0 {
+		lineMap = linediff.Map(oldLines, newLines)
+	} else {
+		summary.NoBaseline = true
+	}
+
+	for i, ann := range annotations {
+		from := ann.Line
+		to, orphaned := remapLine(from, lineMap, len(newLines))
+		if ann.Symbol != "" {
+			// Symbol anchors follow their definition wherever it went,
+			// even when its own line was edited
+			if line := ResolveSymbolLine(newLines, ann.Symbol, to); line > 0 {
+				to, orphaned = line, false
+			}
+		}
+		annotations[i].Line = to
+
+		switch {
+		case orphaned:
+			summary.Orphaned = append(summary.Orphaned, RemappedAnnotation{Annotation: annotations[i], From: from})
+		case to != from:
+			summary.Moved = append(summary.Moved, RemappedAnnotation{Annotation: annotations[i], From: from})
+		default:
+			summary.Unchanged++
+		}
+	}
+
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Line < annotations[j].Line
+	})
+
+	header.Hash = summary.NewHash
+	header.Captured = time.Now().UTC().Format(time.RFC3339)
+	if header.Source == "" {
+		header.Source = fmt.Sprintf("%s/%s", project, filePath)
+	}
+
+	if err := writeV2File(fullPath, header, newLines, annotations); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// remapLine maps a 1-based line through lineMap (nil when there is no
+// baseline). Lines that no longer exist are anchored to the line following
+// the last surviving line before them and reported as orphaned.
+func remapLine(line int, lineMap []int, newCount int) (int, bool) {
+	if lineMap == nil {
+		if line > newCount {
+			return newCount, true
+		}
+		return line, false
+	}
+
+	idx := line - 1
+	if idx >= 0 && idx < len(lineMap) && lineMap[idx] >= 0 {
+		return lineMap[idx] + 1, false
+	}
+
+	anchor := 0
+	for i := min(idx, len(lineMap)) - 1; i >= 0; i-- {
+		if lineMap[i] >= 0 {
+			anchor = lineMap[i] + 1
+			break
+		}
+	}
+	if anchor >= newCount {
+		anchor = newCount - 1
+	}
+	return anchor + 1, true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRebaseAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	oldSource := "func a() {\n\tone()\n\ttwo()\n}\n\nfunc b() {\n\tthree()\n}\n"
+	for _, ann := range []struct {
+		line int
+		text string
+	}{{1, "entry"}, {3, "calls two"}, {7, "calls three"}} {
+		if err := SaveAnnotationV2(dir, "proj", "src/x.go", ann.line, "alice", ann.text, oldSource, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Two lines added at the top, two() replaced, b() unchanged
+	newSource := "// Package x\n\nfunc a() {\n\tone()\n\ttwoRenamed()\n}\n\nfunc b() {\n\tthree()\n}\n"
+	summary, err := RebaseAnnotations(dir, "proj", "src/x.go", newSource)
+	if err != nil {
+		t.Fatalf("RebaseAnnotations failed: %v", err)
+	}
+
+	if summary.NewHash != computeSourceHash(newSource) || summary.OldHash != computeSourceHash(oldSource) {
+		t.Errorf("unexpected hashes: %+v", summary)
+	}
+	if len(summary.Moved) != 2 || summary.Moved[0].From != 1 || summary.Moved[0].Line != 3 || summary.Moved[1].From != 7 || summary.Moved[1].Line != 9 {
+		t.Errorf("unexpected moved annotations: %+v", summary.Moved)
+	}
+	if len(summary.Orphaned) != 1 || summary.Orphaned[0].From != 3 || summary.Orphaned[0].Line != 5 || summary.Orphaned[0].Text != "calls two" {
+		t.Errorf("unexpected orphaned annotations: %+v", summary.Orphaned)
+	}
+
+	header, anns, lines, err := parseV2File(dir + "/" + encodeFilename("proj", "src/x.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Hash != summary.NewHash {
+		t.Errorf("stored hash = %q, want %q", header.Hash, summary.NewHash)
+	}
+	if strings.Join(lines, "\n")+"\n" != newSource {
+		t.Errorf("stored snapshot not updated:\n%s", strings.Join(lines, "\n"))
+	}
+	got := map[int]string{}
+	for _, a := range anns {
+		got[a.Line] = a.Text
+	}
+	want := map[int]string{3: "entry", 5: "calls two", 9: "calls three"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stored annotations = %v, want %v", got, want)
+	}
+}
+
+func TestRebaseAnnotationsNoBaseline(t *testing.T) {
+	dir := t.TempDir()
+	if err := SaveAnnotationV2(dir, "proj", "a.c", 2, "bob", "keep", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAnnotationV2(dir, "proj", "a.c", 9, "bob", "past end", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := RebaseAnnotations(dir, "proj", "a.c", "one\ntwo\nthree\n")
+	if err != nil {
+		t.Fatalf("RebaseAnnotations failed: %v", err)
+	}
+	if !summary.NoBaseline || summary.Unchanged != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if len(summary.Orphaned) != 1 || summary.Orphaned[0].Line != 3 {
+		t.Errorf("expected annotation past the end anchored to last line: %+v", summary.Orphaned)
+	}
+}
+
+func TestRebaseAnnotationsMissingFile(t *testing.T) {
+	if _, err := RebaseAnnotations(t.TempDir(), "proj", "none.c", "x\n"); err == nil {
+		t.Error("expected error for file without annotations")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Codes of the errors returned for requests the storage sandbox refuses,
+// sent as the response's code so clients can tell a refusal from a failure
+const (
+	// codeStorageNotAllowed: the storage path (or a file to merge) is
+	// outside the host config's storage_roots
+	codeStorageNotAllowed = "storage_not_allowed"
+	// codePathTraversal: a path climbs out with "..", a project names a
+	// directory, or an annotation file is a symlink out of the storage
+	codePathTraversal = "path_traversal"
+)
+
+// accessError is a request the sandbox refuses
+type accessError struct {
+	Code    string
+	Message string
+}
+
+func (e *accessError) Error() string {
+	return e.Message
+}
+
+// hostConfigErr is the error loading the host config failed with. The
+// config may restrict storage roots, so while it is broken no storage is
+// allowed.
+var hostConfigErr error
+
+// setHostConfig installs the config loaded at startup. A broken config is
+// logged; it disables hooks and, until fixed, refuses storage access.
+func setHostConfig(config *HostConfig, err error) {
+	if err != nil {
+		log.Printf("Ignoring host config: %v", err)
+	}
+	hostConfig, hostConfigErr = config, err
+}
+
+// checkRequestPaths refuses a request whose paths could reach outside the
+// storage: a storage path, merge file or migration source root outside the
+// configured storage roots, any path with a ".." element, a project with a
+// path separator, or an annotation file that is a symlink leading out of
+// its storage directory. Requests
+// for the standalone modes (-fsck, -merge, ...) come from the user's own
+// command line and are not checked.
+func checkRequestPaths(req Request, config *HostConfig) error {
+	if req.StoragePath != "" {
+		if hasDotDot(req.StoragePath) {
+			return &accessError{codePathTraversal, fmt.Sprintf("storage path %q must not contain \"..\"", req.StoragePath)}
+		}
+		if hostConfigErr != nil {
+			return &accessError{codeStorageNotAllowed, fmt.Sprintf("storage refused until the host config is fixed: %v", hostConfigErr)}
+		}
+		if err := checkStorageRoots("storage path", req.StoragePath, config); err != nil {
+			return err
+		}
+	}
+	if req.Project == "." || req.Project == ".." || strings.ContainsAny(req.Project, `/\`) {
+		return &accessError{codePathTraversal, fmt.Sprintf("project %q must be a project name, not a path", req.Project)}
+	}
+	if hasDotDot(req.FilePath) {
+		return &accessError{codePathTraversal, fmt.Sprintf("file path %q must not contain \"..\"", req.FilePath)}
+	}
+	for _, p := range []struct{ what, path string }{
+		{"merge file", req.MergeFrom},
+		{"merge file", req.MergeBase},
+		{"source root", req.SourceRoot},
+	} {
+		if p.path == "" {
+			continue
+		}
+		if hasDotDot(p.path) {
+			return &accessError{codePathTraversal, fmt.Sprintf("%s %q must not contain \"..\"", p.what, p.path)}
+		}
+		if err := checkStorageRoots(p.what, p.path, config); err != nil {
+			return err
+		}
+	}
+	if req.StoragePath != "" && req.Project != "" && req.FilePath != "" {
+		return checkAnnotationSymlink(req.StoragePath, encodeFilename(req.Project, req.FilePath))
+	}
+	return nil
+}
+
+// hasDotDot reports whether a path has a ".." element, with either separator
+func hasDotDot(p string) bool {
+	for _, elem := range strings.FieldsFunc(p, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// checkStorageRoots refuses a path outside every storage root in config,
+// comparing real paths so a symlink can't lead out of a root. Without
+// roots configured, any path is allowed.
+func checkStorageRoots(what, p string, config *HostConfig) error {
+	if config == nil || len(config.StorageRoots) == 0 {
+		return nil
+	}
+	real, err := realPath(p)
+	if err != nil {
+		return &accessError{codeStorageNotAllowed, fmt.Sprintf("%s %s: %v", what, p, err)}
+	}
+	for _, root := range config.StorageRoots {
+		realRoot, err := realPath(expandHome(root))
+		if err == nil && isWithin(real, realRoot) {
+			return nil
+		}
+	}
+	return &accessError{codeStorageNotAllowed, fmt.Sprintf("%s %s is outside the storage roots allowed in ~/%s (%s)",
+		what, p, hostConfigFileName, strings.Join(config.StorageRoots, ", "))}
+}
+
+// checkAnnotationSymlink refuses an annotation file that is a symlink to
+// somewhere outside its storage directory, which a write would follow
+func checkAnnotationSymlink(storagePath, filename string) error {
+	fullPath := filepath.Join(storagePath, filename)
+	if info, err := os.Lstat(fullPath); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	target, err := filepath.EvalSymlinks(fullPath)
+	realStorage, storageErr := realPath(storagePath)
+	if err != nil || storageErr != nil || !isWithin(target, realStorage) {
+		return &accessError{codePathTraversal, fmt.Sprintf("annotation file %s is a symlink out of the storage directory", filename)}
+	}
+	return nil
+}
+
+// realPath returns the absolute path of p with symlinks resolved. The
+// storage directory may not exist yet, so only its longest existing prefix
+// is resolved and the rest appended.
+func realPath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if filepath.Dir(dir) == dir {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// isWithin reports whether path is root or below it
+func isWithin(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// expandHome replaces a leading "~/" with the user's home directory
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return p
+}
+
+// accessErrorResponse is the response for a refused request
+func accessErrorResponse(err error) Response {
+	resp := Response{Success: false, Error: err.Error()}
+	if ae, ok := err.(*accessError); ok {
+		resp.Code = ae.Code
+	}
+	return resp
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckRequestPathsStorageRoots(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "annotations")
+	outside := filepath.Join(base, "elsewhere")
+	os.MkdirAll(root, 0755)
+	os.MkdirAll(outside, 0755)
+	// A symlink inside the root that leads out of it
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	config := &HostConfig{StorageRoots: []string{root}}
+
+	tests := []struct {
+		name string
+		req  Request
+		code string
+	}{
+		{"root", Request{StoragePath: root}, ""},
+		{"below the root, not created yet", Request{StoragePath: filepath.Join(root, "team", "new")}, ""},
+		{"outside", Request{StoragePath: outside}, codeStorageNotAllowed},
+		{"symlink out of the root", Request{StoragePath: filepath.Join(root, "escape")}, codeStorageNotAllowed},
+		{"dot-dot", Request{StoragePath: root + "/../elsewhere"}, codePathTraversal},
+		{"merge file outside", Request{StoragePath: root, MergeFrom: filepath.Join(outside, "theirs.md")}, codeStorageNotAllowed},
+		{"source root outside", Request{StoragePath: root, SourceRoot: outside}, codeStorageNotAllowed},
+		{"source root with dot-dot", Request{StoragePath: root, SourceRoot: root + "/../src"}, codePathTraversal},
+		{"project with a separator", Request{StoragePath: root, Project: "../etc", FilePath: "passwd"}, codePathTraversal},
+		{"file path with dot-dot", Request{StoragePath: root, Project: "proj", FilePath: "src/../../x.c"}, codePathTraversal},
+	}
+	for _, tt := range tests {
+		err := checkRequestPaths(tt.req, config)
+		var ae *accessError
+		switch {
+		case tt.code == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.code != "" && (!errors.As(err, &ae) || ae.Code != tt.code):
+			t.Errorf("%s: error = %v, want code %s", tt.name, err, tt.code)
+		}
+	}
+
+	// Without roots any storage path is allowed, but traversal is still refused
+	if err := checkRequestPaths(Request{StoragePath: outside}, nil); err != nil {
+		t.Errorf("no roots: %v", err)
+	}
+	if err := checkRequestPaths(Request{StoragePath: outside, Project: ".."}, nil); err == nil {
+		t.Error("no roots: project \"..\" accepted")
+	}
+}
+
+func TestCheckRequestPathsAnnotationSymlink(t *testing.T) {
+	storage := t.TempDir()
+	target := filepath.Join(t.TempDir(), "victim.txt")
+	os.WriteFile(target, []byte("keep me\n"), 0644)
+	if err := os.Symlink(target, filepath.Join(storage, encodeFilename("proj", "src/a.c"))); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	resp := handleRequest(Request{Action: "save", StoragePath: storage, Project: "proj", FilePath: "src/a.c", Line: 1, Author: "alice", Text: "note"})
+	if resp.Success || resp.Code != codePathTraversal {
+		t.Fatalf("save through a symlink: %+v", resp)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "keep me\n" {
+		t.Errorf("symlink target was written: %q", data)
+	}
+	if status := httpStatus(resp); status != http.StatusForbidden {
+		t.Errorf("httpStatus() = %d, want 403", status)
+	}
+}
+
+func TestBrokenHostConfigRefusesStorage(t *testing.T) {
+	oldConfig, oldErr := hostConfig, hostConfigErr
+	defer func() { hostConfig, hostConfigErr = oldConfig, oldErr }()
+	setHostConfig(nil, errors.New("invalid ~/.og_annotate.json"))
+
+	resp := handleRequest(Request{Action: "getEditing", StoragePath: t.TempDir()})
+	if resp.Success || resp.Code != codeStorageNotAllowed {
+		t.Errorf("response = %+v, want storage refused", resp)
+	}
+	if resp := handleRequest(Request{Action: "ping"}); !resp.Success {
+		t.Errorf("ping = %+v", resp)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"og/pkg/opengrok"
+)
+
+// sourceFetchTimeout bounds fetching a file from OpenGrok during a save
+const sourceFetchTimeout = 10 * time.Second
+
+// ServerConfig is the OpenGrok server the host fetches source from when a
+// save arrives without it. Credentials are the same kinds og accepts.
+type ServerConfig struct {
+	URL         string `json:"url"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	APIKey      string `json:"api_key,omitempty"`
+	BearerToken string `json:"bearer_token,omitempty"`
+}
+
+// newClient builds an OpenGrok client for the server
+func (s *ServerConfig) newClient() (*opengrok.Client, error) {
+	client, err := opengrok.NewClient(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	client.Username = s.Username
+	client.Password = s.Password
+	client.APIKey = s.APIKey
+	client.BearerToken = s.BearerToken
+	return client, nil
+}
+
+// fetchSource downloads the current content of project/filePath from the
+// configured server, so saves from clients that don't send the source still
+// get an inline snapshot and hash
+func fetchSource(config *HostConfig, project, filePath string) (string, error) {
+	if config == nil || config.Server == nil || config.Server.URL == "" {
+		return "", fmt.Errorf("no source supplied and no server configured in %s to fetch it from", hostConfigFileName)
+	}
+	client, err := config.Server.newClient()
+	if err != nil {
+		return "", fmt.Errorf("invalid server in %s: %w", hostConfigFileName, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sourceFetchTimeout)
+	defer cancel()
+	source, err := client.GetFileContext(ctx, path.Join("/", project, filePath))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch source for %s/%s: %w", project, filePath, err)
+	}
+	return source, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSaveFetchesMissingSource(t *testing.T) {
+	source := "int main() {\n\treturn 0;\n}\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/raw/proj/src/main.c" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(source))
+	}))
+	defer server.Close()
+
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = &HostConfig{Server: &ServerConfig{URL: server.URL, BearerToken: "secret"}}
+
+	dir := t.TempDir()
+	resp := handleRequest(Request{Action: "save", StoragePath: dir, Project: "proj", FilePath: "src/main.c", Line: 2, Author: "alice", Text: "exit code"})
+	if !resp.Success {
+		t.Fatalf("save failed: %s", resp.Error)
+	}
+	header, _, lines, err := parseV2File(dir + "/" + encodeFilename("proj", "src/main.c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Hash != computeSourceHash(source) || len(lines) != 3 {
+		t.Errorf("source not captured: hash %q, %d lines", header.Hash, len(lines))
+	}
+
+	resp = handleRequest(Request{Action: "save", StoragePath: dir, Project: "proj", FilePath: "src/missing.c", Line: 1, Author: "alice", Text: "x"})
+	if resp.Success || !strings.Contains(resp.Error, "404") {
+		t.Errorf("expected a fetch error, got %+v", resp)
+	}
+}
+
+func TestSaveWithoutSourceOrServer(t *testing.T) {
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = nil
+
+	resp := handleRequest(Request{Action: "save", StoragePath: t.TempDir(), Project: "proj", FilePath: "a.c", Line: 1, Author: "alice", Text: "x"})
+	if resp.Success || !strings.Contains(resp.Error, "no server configured") {
+		t.Errorf("expected a missing source error, got %+v", resp)
+	}
+}
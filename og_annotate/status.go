@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StorageStatus describes a storage directory for the extension's health
+// panel
+type StorageStatus struct {
+	Files       int `json:"files"`       // Annotation files
+	Annotations int `json:"annotations"` // Annotations in them
+	Projects    int `json:"projects"`
+	// SizeBytes is the size of everything under the storage directory,
+	// including the index, git history and migration backups
+	SizeBytes int64 `json:"sizeBytes"`
+	// Oldest and Newest are the dates (YYYY-MM-DD) of the oldest and newest
+	// annotations; empty when no annotation has a date
+	Oldest string `json:"oldest,omitempty"`
+	Newest string `json:"newest,omitempty"`
+	// Formats counts files by format version, "v1" or "v2"
+	Formats map[string]int `json:"formats"`
+	// Unreadable lists files that could not be parsed; fsck explains why
+	Unreadable []string `json:"unreadable,omitempty"`
+	// NeedsMigration is set when v1 files remain; the migrate action
+	// converts them
+	NeedsMigration bool `json:"needsMigration"`
+}
+
+// StorageStatusOf gathers the statistics of storagePath. Every annotation
+// file is parsed, so it costs as much as a full listing.
+func StorageStatusOf(storagePath string) (*StorageStatus, error) {
+	entries, err := os.ReadDir(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read storage directory: %w", err)
+	}
+
+	status := &StorageStatus{Formats: map[string]int{}}
+	projects := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".md") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		project, _, ok := decodeFilename(name)
+		if !ok {
+			continue
+		}
+		status.Files++
+		projects[project] = true
+
+		fullPath := filepath.Join(storagePath, name)
+		var annotations []Annotation
+		v1, err := isV1File(fullPath)
+		if err == nil && v1 {
+			status.Formats["v1"]++
+			_, annotations, err = parseV1File(fullPath)
+		} else if err == nil {
+			status.Formats["v2"]++
+			_, annotations, _, err = parseV2File(fullPath)
+		}
+		if err != nil {
+			status.Unreadable = append(status.Unreadable, name)
+			continue
+		}
+
+		status.Annotations += len(annotations)
+		for _, ann := range annotations {
+			date := annotationDate(ann)
+			if date == "" {
+				continue
+			}
+			if status.Oldest == "" || date < status.Oldest {
+				status.Oldest = date
+			}
+			if date > status.Newest {
+				status.Newest = date
+			}
+		}
+	}
+	status.Projects = len(projects)
+	status.NeedsMigration = status.Formats["v1"] > 0
+	sort.Strings(status.Unreadable)
+
+	err = filepath.WalkDir(storagePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Count what can be read
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				status.SizeBytes += info.Size()
+			}
+		}
+		return nil
+	})
+	return status, err
+}
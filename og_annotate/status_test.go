@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStorageStatus(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "myproject__src__App.java.md"), []byte(sampleV1File), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []struct{ project, file, text string }{
+		{"proj", "a.c", "first"},
+		{"proj", "a.c", "second"},
+		{"other", "b.c", "third"},
+	} {
+		line := 1
+		if a.text == "second" {
+			line = 2
+		}
+		if err := SaveAnnotationV2(dir, a.project, a.file, line, "alice", a.text, "x\ny\n", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Host metadata is not counted as annotation files
+	os.WriteFile(filepath.Join(dir, indexFileName), []byte("{}"), 0644)
+
+	resp := handleRequest(Request{Action: "status", StoragePath: dir})
+	if !resp.Success || resp.Status == nil {
+		t.Fatalf("status: %+v", resp)
+	}
+	s := resp.Status
+	today := time.Now().Format(time.DateOnly)
+	if s.Files != 3 || s.Annotations != 5 || s.Projects != 3 {
+		t.Errorf("counts = %+v", s)
+	}
+	if s.Oldest != "2024-01-14" || s.Newest != today {
+		t.Errorf("dates = %s to %s", s.Oldest, s.Newest)
+	}
+	if s.Formats["v1"] != 1 || s.Formats["v2"] != 2 || !s.NeedsMigration {
+		t.Errorf("formats = %v, needsMigration %v", s.Formats, s.NeedsMigration)
+	}
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, _ error) error {
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if s.SizeBytes != size || size == 0 {
+		t.Errorf("sizeBytes = %d, want %d", s.SizeBytes, size)
+	}
+
+	if _, err := MigrateStorage(dir, ""); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := StorageStatusOf(dir); s.Formats["v1"] != 0 || s.NeedsMigration {
+		t.Errorf("after migration: %+v", s)
+	}
+
+	resp = handleRequest(Request{Action: "status", StoragePath: filepath.Join(dir, "missing")})
+	if resp.Success || !strings.Contains(resp.Error, "storage directory") {
+		t.Errorf("missing storage: %+v", resp)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// symbolNameRe matches the names an annotation can be anchored to: an
+// identifier, optionally qualified ("Type.method", "ns::func")
+var symbolNameRe = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(?:(?:\.|::)[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// definitionKeywords come before a defined name in common languages; a
+// parenthesised Go receiver may sit between "func" and the name
+const definitionKeywords = `#\s*define|struct|union|enum|class|interface|trait|impl|type|typedef|def|func|fn|function|sub|proc|module|namespace|record|macro`
+
+// CheckSymbol validates a symbol name for a symbol-anchored annotation
+func CheckSymbol(symbol string) error {
+	if !symbolNameRe.MatchString(symbol) {
+		return fmt.Errorf("invalid symbol %q: use an identifier such as a function or struct name", symbol)
+	}
+	return nil
+}
+
+// symbolMatcher rates source lines as the definition of one symbol
+type symbolMatcher struct {
+	keyword  *regexp.Regexp // Keyword definition: "struct name", "func (r T) name"
+	function *regexp.Regexp // Function-style: "name(" or "name ("
+}
+
+func newSymbolMatcher(symbol string) symbolMatcher {
+	// A qualified name is defined by its last part, as in "func (t *T) method"
+	name := symbol
+	if i := strings.LastIndexAny(name, ".:"); i >= 0 {
+		name = name[i+1:]
+	}
+	quoted := regexp.QuoteMeta(name)
+	return symbolMatcher{
+		keyword:  regexp.MustCompile(`(?:^|[^\w$])(?:` + definitionKeywords + `)\s+(?:\([^)]*\)\s*)?` + quoted + `(?:[^\w$]|$)`),
+		function: regexp.MustCompile(`(?:^|[^\w$.>])` + quoted + `\s*\(`),
+	}
+}
+
+// score rates how likely line is to define the symbol: 2 after a definition
+// keyword, 1 for a function definition (name followed by a parameter list on
+// a line that starts at column 0 or opens a body, and isn't a statement),
+// 0 otherwise
+func (m symbolMatcher) score(line string) int {
+	if m.keyword.MatchString(line) {
+		return 2
+	}
+	if !m.function.MatchString(line) {
+		return 0
+	}
+	trimmed := strings.TrimSpace(line)
+	if strings.HasSuffix(trimmed, ";") || strings.HasPrefix(trimmed, "return ") {
+		return 0
+	}
+	if (line != "" && line[0] != ' ' && line[0] != '\t') || strings.HasSuffix(trimmed, "{") {
+		return 1
+	}
+	return 0
+}
+
+// ResolveSymbolLine finds the line (1-based) defining symbol in lines,
+// preferring the likeliest definition and, among equally likely ones, the
+// one nearest to line near (0 for none). It returns 0 if symbol isn't
+// defined in lines.
+func ResolveSymbolLine(lines []string, symbol string, near int) int {
+	m := newSymbolMatcher(symbol)
+	best, bestScore := 0, 0
+	for i, line := range lines {
+		score := m.score(line)
+		if score == 0 || score < bestScore {
+			continue
+		}
+		if score > bestScore || distance(i+1, near) < distance(best, near) {
+			best, bestScore = i+1, score
+		}
+	}
+	return best
+}
+
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// anchorSymbols moves the symbol-anchored annotations to their symbol's
+// line in lines, a newer version of the file than the stored snapshot, and
+// keeps them sorted by line. Annotations whose symbol is gone keep theirs.
+func anchorSymbols(annotations []Annotation, lines []string) []Annotation {
+	for i, ann := range annotations {
+		if ann.Symbol == "" {
+			continue
+		}
+		if line := ResolveSymbolLine(lines, ann.Symbol, ann.Line); line > 0 {
+			annotations[i].Line = line
+		}
+	}
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Line < annotations[j].Line
+	})
+	return annotations
+}
+
+// SaveSymbolAnnotation saves an annotation anchored to symbol, like
+// SaveTaggedAnnotation, and returns it as stored, on the line it was
+// attached to. The symbol is looked up in the stored snapshot, or in
+// sourceContent for a file not annotated before; near picks between several
+// definitions (0 for the first).
+func SaveSymbolAnnotation(storagePath, project, filePath, symbol string, near int, author, text string, tags []string, sourceContent string) (Annotation, error) {
+	if err := CheckSymbol(symbol); err != nil {
+		return Annotation{}, err
+	}
+	tags, err := NormalizeTags(tags)
+	if err != nil {
+		return Annotation{}, err
+	}
+
+	lines := splitSourceLines(sourceContent)
+	fullPath := filepath.Join(storagePath, encodeFilename(project, filePath))
+	if _, err := os.Stat(fullPath); err == nil {
+		_, _, snapshot, err := parseV2File(fullPath)
+		if err != nil {
+			return Annotation{}, err
+		}
+		if len(snapshot) > 0 {
+			lines = snapshot
+		}
+	}
+	line := ResolveSymbolLine(lines, symbol, near)
+	if line == 0 {
+		return Annotation{}, fmt.Errorf("no definition of %s found in %s/%s", symbol, project, filePath)
+	}
+
+	return saveAnnotation(storagePath, project, filePath, Annotation{
+		Line:   line,
+		Author: author,
+		Text:   strings.TrimSpace(text),
+		Tags:   tags,
+		Symbol: symbol,
+	}, sourceContent, "")
+}
+
+// splitSourceLines splits source content into lines, without the empty one
+// after a final newline
+func splitSourceLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.Split(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveSymbolLine(t *testing.T) {
+	source := strings.Split(`#include "vnode.h"
+
+static void vn_free(vnode_t *);
+
+void
+vn_rele(vnode_t *vp)
+{
+	vn_free(vp);
+}
+
+static void
+vn_free(vnode_t *vp)
+{
+}
+
+struct vattr {
+	int va_mask;
+};
+
+func (v *Vnode) Release() {
+	v.vn_rele()
+}`, "\n")
+	tests := []struct {
+		symbol string
+		near   int
+		want   int
+	}{
+		{"vn_rele", 0, 6},
+		{"vn_free", 0, 12},       // Not the prototype or the call
+		{"vattr", 0, 16},         // struct keyword
+		{"Vnode.Release", 0, 20}, // Go method, by its last part
+		{"vn_missing", 0, 0},     // Not defined
+		{"va_mask", 0, 0},        // A field, not a definition
+		{"vn_rele", 100, 6},      // near only picks among definitions
+		{"Release", 1, 20},
+	}
+	for _, tt := range tests {
+		if got := ResolveSymbolLine(source, tt.symbol, tt.near); got != tt.want {
+			t.Errorf("ResolveSymbolLine(%q, %d) = %d, want %d", tt.symbol, tt.near, got, tt.want)
+		}
+	}
+
+	// Between several definitions, the one nearest to near wins
+	twice := []string{"#ifdef A", "#define FLAG 1", "#else", "#define FLAG 2", "#endif"}
+	if got := ResolveSymbolLine(twice, "FLAG", 5); got != 4 {
+		t.Errorf("nearest definition = %d, want 4", got)
+	}
+}
+
+func TestSymbolAnnotationFollowsDefinition(t *testing.T) {
+	dir := t.TempDir()
+	source := "int x;\n\nvoid\nvn_rele(vnode_t *vp)\n{\n}\n"
+	saved, err := SaveSymbolAnnotation(dir, "proj", "uts/vnode.c", "vn_rele", 0, "alice", "needs the lock", []string{"bug"}, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Line != 4 {
+		t.Errorf("saved on line %d, want 4", saved.Line)
+	}
+	if _, err := SaveSymbolAnnotation(dir, "proj", "uts/vnode.c", "vn_hold", 0, "alice", "text", nil, source); err == nil {
+		t.Error("expected an error for a symbol that isn't defined")
+	}
+	if _, err := SaveSymbolAnnotation(dir, "proj", "uts/vnode.c", "vn rele", 0, "alice", "text", nil, source); err == nil {
+		t.Error("expected an error for an invalid symbol")
+	}
+
+	anns, err := ReadAnnotations(dir, "proj", "uts/vnode.c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anns) != 1 || anns[0].Symbol != "vn_rele" || anns[0].Line != 4 || !anns[0].HasTag("bug") {
+		t.Fatalf("read back %+v", anns)
+	}
+
+	// Lines added above, and the signature itself edited: a line anchor
+	// would be orphaned, the symbol anchor follows the definition
+	newSource := "#include <sys/vnode.h>\n\nint x;\n\nvoid\nvn_rele(vnode_t *vp, int flags)\n{\n}\n"
+	if got := anchorSymbols(append([]Annotation(nil), anns...), splitSourceLines(newSource)); got[0].Line != 6 {
+		t.Errorf("anchored to line %d in the current source, want 6", got[0].Line)
+	}
+	summary, err := RebaseAnnotations(dir, "proj", "uts/vnode.c", newSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Orphaned) != 0 || len(summary.Moved) != 1 || summary.Moved[0].Line != 6 || summary.Moved[0].From != 4 {
+		t.Errorf("rebase summary = %+v", summary)
+	}
+	if anns, _ := ReadAnnotations(dir, "proj", "uts/vnode.c"); len(anns) != 1 || anns[0].Line != 6 || anns[0].Symbol != "vn_rele" {
+		t.Errorf("after rebase = %+v", anns)
+	}
+
+	// The stored file stays valid
+	check, err := FsckStorage(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Issues) != 0 {
+		t.Errorf("fsck issues: %+v", check.Issues)
+	}
+}
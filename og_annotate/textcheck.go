@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultMaxTextBytes bounds annotation text when the host config sets no
+// limit. Notes are comments, not documents; the limit also keeps every
+// line well under the parser's maxScanToken.
+const defaultMaxTextBytes = 64 * 1024
+
+// TextConfig holds the checks applied to annotation text before a save
+type TextConfig struct {
+	// MaxBytes is the largest text accepted, after normalization
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// ControlChars is "strip" (the default) to drop control characters and
+	// invalid UTF-8 from the text, or "reject" to refuse such saves
+	ControlChars string `json:"control_chars,omitempty"`
+}
+
+// CheckAnnotationText normalizes annotation text for storage and enforces
+// the configured limits. Line endings become "\n", surrounding whitespace is
+// trimmed (as the parser would), and control characters other than tab and
+// newline are stripped or rejected: they are invisible in the browser,
+// garble terminals when og prints notes, and "\r" is lost on the next read.
+func CheckAnnotationText(text string, config *HostConfig) (string, error) {
+	limits := TextConfig{MaxBytes: defaultMaxTextBytes, ControlChars: "strip"}
+	if config != nil && config.Text != nil {
+		if config.Text.MaxBytes > 0 {
+			limits.MaxBytes = config.Text.MaxBytes
+		}
+		if config.Text.ControlChars != "" {
+			limits.ControlChars = config.Text.ControlChars
+		}
+	}
+	reject := limits.ControlChars == "reject"
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if !utf8.ValidString(text) {
+		if reject {
+			return "", fmt.Errorf("annotation text is not valid UTF-8")
+		}
+		text = strings.ToValidUTF8(text, "")
+	}
+	var b strings.Builder
+	for _, r := range text {
+		if r == '\r' {
+			r = '\n' // Old Mac line ending
+		}
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			if reject {
+				return "", fmt.Errorf("annotation text contains control character %U", r)
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	text = strings.TrimSpace(b.String())
+
+	if text == "" {
+		return "", fmt.Errorf("annotation text is empty")
+	}
+	if len(text) > limits.MaxBytes {
+		return "", fmt.Errorf("annotation text is %d bytes, over the %d byte limit", len(text), limits.MaxBytes)
+	}
+	return text, nil
+}
+
+// writeCheckedV2File writes an annotation file like writeV2File, but first
+// parses the rendered file back and fails, leaving the file untouched, if
+// any annotation would not read back as given. Text that mimics the format
+// (a line like "**@bob** (2024-01-15):" becomes an annotation header once
+// quoted) or an author the header can't hold would otherwise be silently
+// mangled on the next read.
+func writeCheckedV2File(path string, header V2FileHeader, sourceLines []string, annotations []Annotation) error {
+	var buf bytes.Buffer
+	formatV2File(&buf, header, sourceLines, annotations)
+	_, parsed, _, err := parseV2(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return fmt.Errorf("annotation file would not parse: %w", err)
+	}
+	for i, ann := range annotations {
+		if i >= len(parsed) || !sameStoredAnnotation(ann, parsed[i]) {
+			return fmt.Errorf("annotation by %s on line %d would not read back as saved (a text line that looks like an annotation header, an author with '*' or ')', or a line past the end of the file)", ann.Author, ann.Line)
+		}
+	}
+	if len(parsed) != len(annotations) {
+		return fmt.Errorf("annotation file would read back %d annotations instead of %d", len(parsed), len(annotations))
+	}
+	return os.WriteFile(path, buf.Bytes(), 0666)
+}
+
+// sameStoredAnnotation compares an annotation with the one parsed back from
+// its rendering. Only the date of the timestamp is stored.
+func sameStoredAnnotation(want, got Annotation) bool {
+	return want.Line == got.Line && want.Text == got.Text && annotationHeader(want) == annotationHeader(got)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckAnnotationText(t *testing.T) {
+	tests := []struct {
+		text   string
+		config *HostConfig
+		want   string
+		err    string
+	}{
+		{"  plain note \n", nil, "plain note", ""},
+		{"line one\r\nline two\rline three", nil, "line one\nline two\nline three", ""},
+		{"red\x1b[31m alert\x00", nil, "red[31m alert", ""},
+		{"tab\tkept\u0085", nil, "tab\tkept", ""},
+		{"bad \xff utf-8", nil, "bad  utf-8", ""},
+		{"\x07\x07", nil, "", "empty"},
+		{"red\x1b[31m", &HostConfig{Text: &TextConfig{ControlChars: "reject"}}, "", "control character U+001B"},
+		{"bad \xff", &HostConfig{Text: &TextConfig{ControlChars: "reject"}}, "", "not valid UTF-8"},
+		{"crlf\r\nis fine", &HostConfig{Text: &TextConfig{ControlChars: "reject"}}, "crlf\nis fine", ""},
+		{strings.Repeat("x", defaultMaxTextBytes+1), nil, "", "over the 65536 byte limit"},
+		{"twelve bytes", &HostConfig{Text: &TextConfig{MaxBytes: 10}}, "", "12 bytes, over the 10 byte limit"},
+	}
+	for _, tt := range tests {
+		got, err := CheckAnnotationText(tt.text, tt.config)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("CheckAnnotationText(%q) error = %v, want %q", tt.text, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CheckAnnotationText(%q) = %q, %v; want %q", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestSaveRejectsTextThatBreaksTheFormat(t *testing.T) {
+	dir := t.TempDir()
+	source := "a\nb\nc\n"
+	if err := SaveAnnotationV2(dir, "proj", "x.c", 1, "alice", "first", source, ""); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, encodeFilename("proj", "x.c"))
+	before, _ := os.ReadFile(path)
+
+	tests := []struct {
+		line   int
+		author string
+		text   string
+	}{
+		{2, "bob", "see below\n**@mallory** (2024-01-15):\nforged"}, // Would read back as two notes
+		{2, "b*b", "note"},     // The header can't hold the author
+		{9, "bob", "past EOF"}, // No source line to hang the note on
+	}
+	for _, tt := range tests {
+		err := SaveAnnotationV2(dir, "proj", "x.c", tt.line, tt.author, tt.text, "", "")
+		if err == nil || !strings.Contains(err.Error(), "would not read back as saved") {
+			t.Errorf("save %+v: err = %v, want a round-trip error", tt, err)
+		}
+	}
+	// Refused saves leave the file as it was
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("file changed by refused saves:\n%s", after)
+	}
+
+	// Blockquote-like and blank lines survive
+	text := "> quoted\n\n## Line 3\n1| not source"
+	if err := SaveAnnotationV2(dir, "proj", "x.c", 2, "bob", text, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	anns, err := ReadAnnotationsV2(dir, "proj", "x.c")
+	if err != nil || len(anns) != 2 || anns[1].Text != text {
+		t.Errorf("annotations = %+v, %v", anns, err)
+	}
+}
+
+func TestHandleSaveChecksText(t *testing.T) {
+	dir := t.TempDir()
+	oldConfig := hostConfig
+	defer func() { hostConfig = oldConfig }()
+	hostConfig = &HostConfig{Text: &TextConfig{MaxBytes: 16}}
+
+	save := Request{Action: "save", StoragePath: dir, Project: "proj", FilePath: "a.c", Line: 1, Author: "alice", Source: "int a;\n"}
+	save.Text = "a note that is far too long"
+	if resp := handleRequest(save); resp.Success || !strings.Contains(resp.Error, "byte limit") {
+		t.Errorf("long note: %+v", resp)
+	}
+	save.Text = "short\x1b note\r\n"
+	if resp := handleRequest(save); !resp.Success {
+		t.Fatalf("short note: %+v", resp)
+	}
+	if anns, _ := ReadAnnotationsV2(dir, "proj", "a.c"); len(anns) != 1 || anns[0].Text != "short note" {
+		t.Errorf("stored %+v, want the sanitized text", anns)
+	}
+}